@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/conf"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// runFHIRImport implements the import-fhir subcommand: it imports the FHIR
+// Bundles in the files named by args and prints a report for each as JSON.
+//
+//	medical-service -conf config.yaml import-fhir -source clinic-a bundle.json...
+func runFHIRImport(bc *conf.Bootstrap, logger log.Logger, args []string) error {
+	fs := flag.NewFlagSet("import-fhir", flag.ContinueOnError)
+	source := fs.String("source", "", "name of the system the bundles were exported from")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: import-fhir [-source name] bundle.json...")
+	}
+
+	importer, cleanup, err := wireFHIRImport(bc.Data, bc.Clinical, logger)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	out := json.NewEncoder(os.Stdout)
+	out.SetIndent("", "  ")
+	for _, name := range fs.Args() {
+		bundle, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		report, err := importer.ImportBundle(context.Background(), &biz.ImportFHIRBundleRequest{Source: *source, Bundle: bundle})
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := out.Encode(map[string]interface{}{"file": name, "report": report}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/arm-1234/medical-service/internal/pkg/hl7"
+)
+
+// runMLLP implements the mllp subcommand, a client for trying the HL7
+// interface locally. It sends the HL7 v2 messages in the files named by args
+// ("-" for stdin) to the configured MLLP listener and prints each ACK; with
+// -listen it instead stands in for a partner, printing the messages it is
+// sent, such as SIU notifications, and accepting them.
+//
+//	medical-service -conf config.yaml mllp [-addr host:port] messages.hl7...
+//	medical-service -conf config.yaml mllp -listen 127.0.0.1:2576
+func runMLLP(bc *conf.Bootstrap, args []string) error {
+	fs := flag.NewFlagSet("mllp", flag.ContinueOnError)
+	addr := fs.String("addr", bc.GetServer().GetMllp().GetAddr(), "MLLP listener to send to")
+	listen := fs.String("listen", "", "address to receive messages on instead of sending")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for each ACK")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *listen != "" {
+		return listenMLLP(*listen)
+	}
+	if fs.NArg() == 0 || *addr == "" {
+		return fmt.Errorf("usage: mllp [-addr host:port] [-timeout d] file...|-, or mllp -listen host:port")
+	}
+
+	failed := 0
+	for _, name := range fs.Args() {
+		var raw []byte
+		var err error
+		if name == "-" {
+			raw, err = io.ReadAll(os.Stdin)
+		} else {
+			raw, err = os.ReadFile(name)
+		}
+		if err != nil {
+			return err
+		}
+		for _, msg := range hl7.Split(string(raw)) {
+			m, err := hl7.Parse(msg)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			reply, err := hl7.Exchange(context.Background(), *addr, msg+"\r", *timeout)
+			if err != nil {
+				return fmt.Errorf("%s: %s %s: %w", name, m.Type(), m.ControlID(), err)
+			}
+			code, text := reply.Ack()
+			fmt.Printf("%s\t%s %s\t%s\t%s\n", name, m.Type(), m.ControlID(), code, text)
+			if code != hl7.AckAccept {
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d messages were not accepted", failed)
+	}
+	return nil
+}
+
+// listenMLLP prints the messages sent to addr and accepts each of them,
+// until interrupted.
+func listenMLLP(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	fmt.Fprintf(os.Stderr, "listening for MLLP messages on %s\n", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			for {
+				raw, err := hl7.ReadFrame(r)
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						fmt.Fprintf(os.Stderr, "%s: %v\n", conn.RemoteAddr(), err)
+					}
+					return
+				}
+				fmt.Println(strings.ReplaceAll(strings.TrimRight(raw, "\r"), "\r", "\n"))
+				fmt.Println()
+
+				m, err := hl7.Parse(raw)
+				reply := hl7.ACK(m, hl7.AckAccept, "", "MLLP-CLIENT", "LOCAL")
+				if err != nil {
+					reply = hl7.ACK(nil, hl7.AckReject, err.Error(), "MLLP-CLIENT", "LOCAL")
+				}
+				if err := hl7.WriteFrame(conn, reply); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", conn.RemoteAddr(), err)
+					return
+				}
+			}
+		}()
+	}
+}
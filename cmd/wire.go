@@ -9,6 +9,14 @@ import (
 	"github.com/arm-1234/medical-service/internal/biz"
 	"github.com/arm-1234/medical-service/internal/conf"
 	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/pkg/archive"
+	"github.com/arm-1234/medical-service/internal/pkg/drugcheck"
+	"github.com/arm-1234/medical-service/internal/pkg/formulary"
+	"github.com/arm-1234/medical-service/internal/pkg/hl7"
+	"github.com/arm-1234/medical-service/internal/pkg/rxpdf"
+	"github.com/arm-1234/medical-service/internal/pkg/signing"
+	"github.com/arm-1234/medical-service/internal/pkg/video"
+	"github.com/arm-1234/medical-service/internal/pkg/vitals"
 	"github.com/arm-1234/medical-service/internal/server"
 	"github.com/arm-1234/medical-service/internal/service"
 
@@ -17,6 +25,10 @@ import (
 	"github.com/google/wire"
 )
 
-func wireApp(*conf.Server, *conf.Data, log.Logger) (*kratos.App, func(), error) {
-	panic(wire.Build(server.ProviderSet, data.ProviderSet, biz.ProviderSet, service.ProviderSet, newApp))
+func wireApp(*conf.Server, *conf.Data, *conf.Video, *conf.Clinical, log.Logger) (*kratos.App, func(), error) {
+	panic(wire.Build(server.ProviderSet, data.ProviderSet, biz.ProviderSet, service.ProviderSet, video.ProviderSet, drugcheck.ProviderSet, formulary.ProviderSet, rxpdf.ProviderSet, signing.ProviderSet, vitals.ProviderSet, hl7.ProviderSet, archive.ProviderSet, newApp))
+}
+
+func wireFHIRImport(*conf.Data, *conf.Clinical, log.Logger) (*biz.FHIRImportHandler, func(), error) {
+	panic(wire.Build(data.ProviderSet, biz.ProviderSet, formulary.ProviderSet))
 }
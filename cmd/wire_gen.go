@@ -7,6 +7,14 @@ import (
 	"github.com/arm-1234/medical-service/internal/biz"
 	"github.com/arm-1234/medical-service/internal/conf"
 	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/pkg/archive"
+	"github.com/arm-1234/medical-service/internal/pkg/drugcheck"
+	"github.com/arm-1234/medical-service/internal/pkg/formulary"
+	"github.com/arm-1234/medical-service/internal/pkg/hl7"
+	"github.com/arm-1234/medical-service/internal/pkg/rxpdf"
+	"github.com/arm-1234/medical-service/internal/pkg/signing"
+	"github.com/arm-1234/medical-service/internal/pkg/video"
+	"github.com/arm-1234/medical-service/internal/pkg/vitals"
 	"github.com/arm-1234/medical-service/internal/server"
 	"github.com/arm-1234/medical-service/internal/service"
 	"github.com/go-kratos/kratos/v2"
@@ -17,28 +25,144 @@ import (
 	_ "go.uber.org/automaxprocs"
 )
 
-func wireApp(confServer *conf.Server, confData *conf.Data, logger log.Logger) (*kratos.App, func(), error) {
-	dataData, cleanup, err := data.NewData(confData, logger)
+func wireApp(confServer *conf.Server, confData *conf.Data, confVideo *conf.Video, clinical *conf.Clinical, logger log.Logger) (*kratos.App, func(), error) {
+	formularyFormulary, err := formulary.NewFormulary(clinical, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataData, cleanup, err := data.NewData(confData, formularyFormulary, logger)
 	if err != nil {
 		return nil, nil, err
 	}
 	patientRepo := data.NewPatientRepo(dataData, logger)
 	medicalRecordRepo := data.NewMedicalRecordRepo(dataData, logger)
-	patientHandler := biz.NewPatientHandler(patientRepo, medicalRecordRepo, logger)
+	patientMergeRepo := data.NewPatientMergeRepo(dataData, logger)
+	nameSyncRepo := data.NewNameSyncRepo(dataData, logger)
+	patientProfileRepo := data.NewPatientProfileRepo(dataData, logger)
+	transaction := data.NewTransaction(dataData)
+	patientExportRepo := data.NewPatientExportRepo(dataData, logger)
+	accessAuditor := biz.NewAccessAuditor(patientExportRepo, logger)
+	patientHandler := biz.NewPatientHandler(patientRepo, medicalRecordRepo, patientMergeRepo, nameSyncRepo, patientProfileRepo, transaction, accessAuditor, logger)
 	patientService := service.NewPatientService(patientHandler, logger)
 	doctorRepo := data.NewDoctorRepo(dataData, logger)
-	doctorHandler := biz.NewDoctorHandler(doctorRepo, logger)
-	doctorService := service.NewDoctorService(doctorHandler, logger)
+	clinicRepo := data.NewClinicRepo(dataData, logger)
 	appointmentRepo := data.NewAppointmentRepo(dataData, logger)
-	appointmentHandler := biz.NewAppointmentHandler(appointmentRepo, patientRepo, doctorRepo, logger)
+	doctorHandler := biz.NewDoctorHandler(doctorRepo, clinicRepo, appointmentRepo, nameSyncRepo, transaction, logger)
+	doctorService := service.NewDoctorService(doctorHandler, logger)
+	resourceRepo := data.NewResourceRepo(dataData, logger)
+	videoSessionRepo := data.NewVideoSessionRepo(dataData, logger)
+	provider, err := video.NewProvider(confVideo, logger)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	joinKeys, err := video.NewJoinKeys(confVideo)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	notifier, cleanup2, err := hl7.NewNotifier(confServer, logger)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	appointmentHandler := biz.NewAppointmentHandler(appointmentRepo, patientRepo, doctorRepo, clinicRepo, resourceRepo, videoSessionRepo, transaction, provider, joinKeys, notifier, accessAuditor, logger)
 	appointmentService := service.NewAppointmentService(appointmentHandler, logger)
 	prescriptionRepo := data.NewPrescriptionRepo(dataData, logger)
-	prescriptionHandler := biz.NewPrescriptionHandler(prescriptionRepo, patientRepo, doctorRepo, logger)
+	dataset, err := drugcheck.NewDataset(clinical, logger)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	renderer := rxpdf.NewRenderer(clinical)
+	keystore, err := signing.NewKeystore(clinical, logger)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	recordSigner := biz.NewRecordSigner(keystore, patientMergeRepo, logger)
+	prescriptionHandler := biz.NewPrescriptionHandler(prescriptionRepo, patientRepo, doctorRepo, patientProfileRepo, transaction, dataset, formularyFormulary, renderer, recordSigner, accessAuditor, logger)
 	prescriptionService := service.NewPrescriptionService(prescriptionHandler, logger)
 	grpcServer := server.NewGRPCServer(confServer, patientService, doctorService, appointmentService, prescriptionService)
-	httpServer := server.NewHTTPServer(confServer, patientService, doctorService, appointmentService, prescriptionService)
-	app := newApp(logger, grpcServer, httpServer)
+	clinicHandler := biz.NewClinicHandler(clinicRepo, resourceRepo, logger)
+	clinicService := service.NewClinicService(clinicHandler, doctorHandler, appointmentHandler, logger)
+	calendarFeedRepo := data.NewCalendarFeedRepo(dataData, logger)
+	calendarHandler := biz.NewCalendarHandler(calendarFeedRepo, appointmentRepo, patientRepo, doctorRepo, clinicRepo, logger)
+	calendarService := service.NewCalendarService(calendarHandler, logger)
+	reviewRepo := data.NewReviewRepo(dataData, logger)
+	reviewHandler := biz.NewReviewHandler(reviewRepo, appointmentRepo, doctorRepo, transaction, logger)
+	reviewService := service.NewReviewService(reviewHandler, logger)
+	vitalSignRepo := data.NewVitalSignRepo(dataData, logger)
+	medicalRecordHandler := biz.NewMedicalRecordHandler(medicalRecordRepo, patientRepo, doctorRepo, vitalSignRepo, transaction, recordSigner, accessAuditor, logger)
+	medicalRecordService := service.NewMedicalRecordService(medicalRecordHandler, logger)
+	ranges, err := vitals.NewRanges(clinical)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	vitalSignHandler := biz.NewVitalSignHandler(vitalSignRepo, patientRepo, ranges, accessAuditor, logger)
+	vitalSignService := service.NewVitalSignService(vitalSignHandler, logger)
+	labRepo := data.NewLabRepo(dataData, logger)
+	drop, err := hl7.NewDrop(clinical, logger)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	labHandler := biz.NewLabHandler(labRepo, appointmentRepo, patientRepo, doctorRepo, transaction, drop, accessAuditor, logger)
+	labService := service.NewLabService(labHandler, logger)
+	fhirRepo := data.NewFHIRRepo(dataData, logger)
+	fhirHandler := biz.NewFHIRHandler(fhirRepo, doctorRepo, appointmentRepo, clinicRepo, logger)
+	importRepo := data.NewImportRepo(dataData, logger)
+	fhirImportHandler := biz.NewFHIRImportHandler(importRepo, patientRepo, doctorRepo, appointmentRepo, prescriptionRepo, medicalRecordRepo, transaction, logger)
+	fhirService := service.NewFHIRService(fhirHandler, fhirImportHandler, logger)
+	exportRepo := data.NewExportRepo(dataData, logger)
+	bulkHandler := biz.NewBulkHandler(patientRepo, doctorRepo, clinicRepo, nameSyncRepo, exportRepo, transaction, logger)
+	bulkService := service.NewBulkService(bulkHandler, logger)
+	store, err := archive.NewStore(clinical, logger)
+	if err != nil {
+		cleanup2()
+		cleanup()
+		return nil, nil, err
+	}
+	patientExportHandler := biz.NewPatientExportHandler(patientExportRepo, patientRepo, doctorRepo, appointmentRepo, prescriptionRepo, medicalRecordRepo, vitalSignRepo, labRepo, patientMergeRepo, patientHandler, appointmentHandler, prescriptionHandler, vitalSignHandler, accessAuditor, store, logger)
+	patientExportService := service.NewPatientExportService(patientExportHandler, logger)
+	analyticsRepo := data.NewAnalyticsRepo(dataData, logger)
+	analyticsHandler := biz.NewAnalyticsHandler(analyticsRepo, doctorRepo, clinicRepo, prescriptionRepo, logger)
+	analyticsService := service.NewAnalyticsService(analyticsHandler, logger)
+	httpServer := server.NewHTTPServer(confServer, patientService, doctorService, appointmentService, prescriptionService, clinicService, calendarService, reviewService, medicalRecordService, vitalSignService, labService, fhirService, bulkService, patientExportService, analyticsService)
+	jobServer := server.NewJobServer(clinical, prescriptionService, labService, patientExportService, analyticsService, logger)
+	hl7Handler := biz.NewHL7Handler(patientHandler, appointmentHandler, importRepo, patientRepo, doctorRepo, appointmentRepo, transaction, logger)
+	hl7Service := service.NewHL7Service(hl7Handler, logger)
+	mllpServer := server.NewMLLPServer(confServer, hl7Service, logger)
+	app := newApp(logger, grpcServer, httpServer, jobServer, mllpServer)
 	return app, func() {
+		cleanup2()
+		cleanup()
+	}, nil
+}
+
+func wireFHIRImport(confData *conf.Data, clinical *conf.Clinical, logger log.Logger) (*biz.FHIRImportHandler, func(), error) {
+	formularyFormulary, err := formulary.NewFormulary(clinical, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	dataData, cleanup, err := data.NewData(confData, formularyFormulary, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	importRepo := data.NewImportRepo(dataData, logger)
+	patientRepo := data.NewPatientRepo(dataData, logger)
+	doctorRepo := data.NewDoctorRepo(dataData, logger)
+	appointmentRepo := data.NewAppointmentRepo(dataData, logger)
+	prescriptionRepo := data.NewPrescriptionRepo(dataData, logger)
+	medicalRecordRepo := data.NewMedicalRecordRepo(dataData, logger)
+	transaction := data.NewTransaction(dataData)
+	fhirImportHandler := biz.NewFHIRImportHandler(importRepo, patientRepo, doctorRepo, appointmentRepo, prescriptionRepo, medicalRecordRepo, transaction, logger)
+	return fhirImportHandler, func() {
 		cleanup()
 	}, nil
 }
@@ -0,0 +1,884 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// Names of the rollups tracked in analytics_refreshes.
+const (
+	analyticsAppointments = "appointments"
+	analyticsMedications  = "medications"
+)
+
+const (
+	// analyticsRefreshOverlap is how far before the last refresh changes are
+	// read again, to pick up writes that committed while it was running.
+	analyticsRefreshOverlap = time.Minute
+	defaultReportDays       = 30
+	maxReportDays           = 366
+	defaultTopMedications   = 10
+	maxTopMedications       = 100
+)
+
+// AnalyticsReportRequest selects the appointments or prescriptions a report
+// covers: calendar days from FromDate to ToDate inclusive, defaulting to the
+// last 30 days, optionally narrowed to one doctor or a specialization.
+type AnalyticsReportRequest struct {
+	FromDate       string `json:"from_date"`
+	ToDate         string `json:"to_date"`
+	DoctorID       string `json:"doctor_id"`
+	Specialization int32  `json:"specialization"`
+	Limit          int    `json:"limit"`
+}
+
+// AnalyticsPeriod describes what a report covers. RefreshedAt is when the
+// rollups the report reads were last brought up to date; changes made since
+// are not reflected yet.
+type AnalyticsPeriod struct {
+	FromDate       string `json:"from_date"`
+	ToDate         string `json:"to_date"`
+	DoctorID       string `json:"doctor_id,omitempty"`
+	Specialization int32  `json:"specialization,omitempty"`
+	RefreshedAt    string `json:"refreshed_at,omitempty"`
+}
+
+type BookingCounts struct {
+	Appointments int32 `json:"appointments"`
+	Completed    int32 `json:"completed"`
+	Cancelled    int32 `json:"cancelled"`
+	NoShow       int32 `json:"no_show"`
+}
+
+type DailyBookings struct {
+	Date       string `json:"date"`
+	DoctorID   string `json:"doctor_id"`
+	DoctorName string `json:"doctor_name"`
+	BookingCounts
+}
+
+type BookingsReport struct {
+	Period *AnalyticsPeriod `json:"period"`
+	Days   []*DailyBookings `json:"days"`
+	Totals *BookingCounts   `json:"totals"`
+}
+
+// DoctorUtilization compares the minutes booked with a doctor, cancelled
+// appointments left out, with the minutes their schedule offers.
+// Utilization is booked over available, and zero when nothing is available.
+type DoctorUtilization struct {
+	DoctorID         string  `json:"doctor_id,omitempty"`
+	DoctorName       string  `json:"doctor_name,omitempty"`
+	BookedMinutes    int64   `json:"booked_minutes"`
+	AvailableMinutes int64   `json:"available_minutes"`
+	Utilization      float64 `json:"utilization"`
+}
+
+type UtilizationReport struct {
+	Period  *AnalyticsPeriod     `json:"period"`
+	Doctors []*DoctorUtilization `json:"doctors"`
+	Totals  *DoctorUtilization   `json:"totals"`
+}
+
+// DoctorCancellations gives the share of a doctor's appointments that were
+// cancelled or not attended.
+type DoctorCancellations struct {
+	DoctorID         string  `json:"doctor_id,omitempty"`
+	DoctorName       string  `json:"doctor_name,omitempty"`
+	Appointments     int32   `json:"appointments"`
+	Cancelled        int32   `json:"cancelled"`
+	NoShow           int32   `json:"no_show"`
+	CancellationRate float64 `json:"cancellation_rate"`
+	NoShowRate       float64 `json:"no_show_rate"`
+}
+
+type CancellationsReport struct {
+	Period  *AnalyticsPeriod       `json:"period"`
+	Doctors []*DoctorCancellations `json:"doctors"`
+	Totals  *DoctorCancellations   `json:"totals"`
+}
+
+// DoctorLeadTime is how far ahead, on average, appointments with a doctor
+// were booked.
+type DoctorLeadTime struct {
+	DoctorID             string  `json:"doctor_id,omitempty"`
+	DoctorName           string  `json:"doctor_name,omitempty"`
+	Appointments         int32   `json:"appointments"`
+	AverageLeadTimeHours float64 `json:"average_lead_time_hours"`
+}
+
+type LeadTimeReport struct {
+	Period  *AnalyticsPeriod  `json:"period"`
+	Doctors []*DoctorLeadTime `json:"doctors"`
+	Totals  *DoctorLeadTime   `json:"totals"`
+}
+
+// HourlyBookings counts the appointments starting in one hour of one
+// weekday, in the local time of the appointment. Weekday is 0 for Sunday.
+type HourlyBookings struct {
+	Weekday      int32  `json:"weekday"`
+	WeekdayName  string `json:"weekday_name"`
+	Hour         int32  `json:"hour"`
+	Appointments int32  `json:"appointments"`
+}
+
+// BusiestHoursReport is a weekday by hour heatmap of appointments, cancelled
+// ones left out. Hours without appointments are omitted.
+type BusiestHoursReport struct {
+	Period *AnalyticsPeriod  `json:"period"`
+	Cells  []*HourlyBookings `json:"cells"`
+}
+
+type MedicationUsage struct {
+	DrugCode       string `json:"drug_code,omitempty"`
+	MedicationName string `json:"medication_name"`
+	Prescriptions  int32  `json:"prescriptions"`
+	Quantity       int64  `json:"quantity"`
+}
+
+type MedicationsReport struct {
+	Period      *AnalyticsPeriod   `json:"period"`
+	Medications []*MedicationUsage `json:"medications"`
+}
+
+// AnalyticsHandler reports on how the clinic is used. Reports read daily
+// rollups of appointments and prescriptions, which the job server keeps up
+// to date, rather than the live tables. Available minutes are the exception:
+// they are worked out from the doctors' current schedules when the report is
+// run, as past schedules are not kept.
+type AnalyticsHandler struct {
+	repo             data.AnalyticsRepo
+	doctorRepo       data.DoctorRepo
+	clinicRepo       data.ClinicRepo
+	prescriptionRepo data.PrescriptionRepo
+	log              *log.Helper
+}
+
+func NewAnalyticsHandler(repo data.AnalyticsRepo, doctorRepo data.DoctorRepo, clinicRepo data.ClinicRepo, prescriptionRepo data.PrescriptionRepo, logger log.Logger) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		repo:             repo,
+		doctorRepo:       doctorRepo,
+		clinicRepo:       clinicRepo,
+		prescriptionRepo: prescriptionRepo,
+		log:              log.NewHelper(logger),
+	}
+}
+
+// RefreshAnalytics rolls up again every doctor-day touched by appointments
+// changed, or prescriptions written, since the last refresh. A refresh that
+// fails part way leaves its watermark alone, so the next one redoes it.
+func (h *AnalyticsHandler) RefreshAnalytics(ctx context.Context) error {
+	ctx, span := otel.Trace(ctx, "AnalyticsHandler.RefreshAnalytics")
+	defer span.End()
+
+	started := time.Now()
+	if err := h.refreshAppointments(ctx, started); err != nil {
+		return err
+	}
+	return h.refreshMedications(ctx, started)
+}
+
+// refreshSince returns the time changes to a rollup are read from.
+func (h *AnalyticsHandler) refreshSince(ctx context.Context, name string) (time.Time, error) {
+	refresh, err := h.repo.GetRefresh(ctx, name)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get %s refresh: %v", name, err)
+		return time.Time{}, fmt.Errorf("failed to get %s refresh: %w", name, err)
+	}
+	if refresh == nil {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	return refresh.Watermark.Add(-analyticsRefreshOverlap), nil
+}
+
+func (h *AnalyticsHandler) refreshAppointments(ctx context.Context, started time.Time) error {
+	since, err := h.refreshSince(ctx, analyticsAppointments)
+	if err != nil {
+		return err
+	}
+
+	keys, err := h.repo.ListChangedAppointmentDays(ctx, since)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list changed appointment days: %v", err)
+		return fmt.Errorf("failed to list changed appointment days: %w", err)
+	}
+
+	done := make(map[data.DoctorDay]bool)
+	for _, key := range keys {
+		if done[key] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		appointments, err := h.repo.GetDoctorDayAppointments(ctx, key.DoctorID, key.Day)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get appointments of %s on %s: %v", key.DoctorID, key.Day, err)
+			return fmt.Errorf("failed to get appointments: %w", err)
+		}
+		row, hours, members := rollUpAppointments(key, appointments)
+		if err := h.repo.ReplaceDoctorDay(ctx, key, row, hours, members); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to save appointment rollup of %s on %s: %v", key.DoctorID, key.Day, err)
+			return fmt.Errorf("failed to save appointment rollup: %w", err)
+		}
+		done[key] = true
+	}
+
+	if err := h.repo.SetRefresh(ctx, analyticsAppointments, started); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to record appointment refresh: %v", err)
+		return fmt.Errorf("failed to record appointment refresh: %w", err)
+	}
+	if len(done) > 0 {
+		h.log.WithContext(ctx).Infof("Rolled up appointments of %d doctor-days", len(done))
+	}
+	return nil
+}
+
+// rollUpAppointments summarizes a doctor's appointments on one day. It
+// returns no day row when there are no appointments left on it.
+func rollUpAppointments(key data.DoctorDay, appointments []*entity.Appointment) (*entity.AnalyticsDoctorDay, []*entity.AnalyticsDoctorHour, []*entity.AnalyticsAppointmentDay) {
+	if len(appointments) == 0 {
+		return nil, nil, nil
+	}
+
+	row := &entity.AnalyticsDoctorDay{Day: key.Day, DoctorID: key.DoctorID}
+	var members []*entity.AnalyticsAppointmentDay
+	byHour := make(map[int32]*entity.AnalyticsDoctorHour)
+	for _, a := range appointments {
+		members = append(members, &entity.AnalyticsAppointmentDay{AppointmentID: a.ID, DoctorID: key.DoctorID, Day: key.Day})
+
+		row.Appointments++
+		if lead := a.StartsAt.Sub(a.CreatedAt); lead > 0 {
+			row.LeadTimeMinutes += int64(lead / time.Minute)
+		}
+		switch a.Status {
+		case entity.AppointmentStatusCancelled:
+			row.Cancelled++
+			continue
+		case entity.AppointmentStatusCompleted:
+			row.Completed++
+		case entity.AppointmentStatusNoShow:
+			row.NoShow++
+		}
+		if booked := a.EndsAt.Sub(a.StartsAt); booked > 0 {
+			row.BookedMinutes += int64(booked / time.Minute)
+		}
+
+		loc, err := loadLocation(a.Timezone)
+		if err != nil || a.StartsAt.IsZero() {
+			continue
+		}
+		start := a.StartsAt.In(loc)
+		hour := int32(start.Hour())
+		cell, ok := byHour[hour]
+		if !ok {
+			cell = &entity.AnalyticsDoctorHour{Day: key.Day, DoctorID: key.DoctorID, Hour: hour, Weekday: int32(start.Weekday())}
+			byHour[hour] = cell
+		}
+		cell.Appointments++
+	}
+
+	hours := make([]*entity.AnalyticsDoctorHour, 0, len(byHour))
+	for _, cell := range byHour {
+		hours = append(hours, cell)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Hour < hours[j].Hour })
+	return row, hours, members
+}
+
+func (h *AnalyticsHandler) refreshMedications(ctx context.Context, started time.Time) error {
+	since, err := h.refreshSince(ctx, analyticsMedications)
+	if err != nil {
+		return err
+	}
+
+	prescriptions, err := h.repo.ListChangedPrescriptions(ctx, since)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list changed prescriptions: %v", err)
+		return fmt.Errorf("failed to list changed prescriptions: %w", err)
+	}
+
+	// An amendment takes the prescription it corrects out of the counts, so
+	// the day of that one is rolled up again too.
+	locs := make(map[string]*time.Location)
+	var keys []data.DoctorDay
+	for _, p := range prescriptions {
+		loc, err := h.doctorLocation(ctx, locs, p.DoctorID)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, data.DoctorDay{DoctorID: p.DoctorID, Day: p.PrescriptionDate.In(loc).Format(dateLayout)})
+
+		if p.AmendedFrom == "" {
+			continue
+		}
+		original, err := h.prescriptionRepo.Get(ctx, p.AmendedFrom)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get prescription: %v", err)
+			return fmt.Errorf("failed to get prescription: %w", err)
+		}
+		if original == nil {
+			continue
+		}
+		if loc, err = h.doctorLocation(ctx, locs, original.DoctorID); err != nil {
+			return err
+		}
+		keys = append(keys, data.DoctorDay{DoctorID: original.DoctorID, Day: original.PrescriptionDate.In(loc).Format(dateLayout)})
+	}
+
+	done := make(map[data.DoctorDay]bool)
+	for _, key := range keys {
+		if done[key] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := h.rollUpMedicationDay(ctx, key, locs[key.DoctorID]); err != nil {
+			return err
+		}
+		done[key] = true
+	}
+
+	if err := h.repo.SetRefresh(ctx, analyticsMedications, started); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to record medication refresh: %v", err)
+		return fmt.Errorf("failed to record medication refresh: %w", err)
+	}
+	if len(done) > 0 {
+		h.log.WithContext(ctx).Infof("Rolled up prescriptions of %d doctor-days", len(done))
+	}
+	return nil
+}
+
+// doctorLocation returns the doctor's timezone, caching it in locs. Doctors
+// that no longer exist are taken to be in the service default.
+func (h *AnalyticsHandler) doctorLocation(ctx context.Context, locs map[string]*time.Location, doctorID string) (*time.Location, error) {
+	if loc, ok := locs[doctorID]; ok {
+		return loc, nil
+	}
+	doctor, err := h.doctorRepo.Get(ctx, doctorID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, fmt.Errorf("failed to get doctor: %w", err)
+	}
+	var timezone string
+	if doctor != nil {
+		timezone = doctor.Timezone
+	}
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	locs[doctorID] = loc
+	return loc, nil
+}
+
+// rollUpMedicationDay counts the medications a doctor prescribed on one day.
+// Prescriptions superseded by an amendment are left out. A medication is
+// counted once per prescription it appears on.
+func (h *AnalyticsHandler) rollUpMedicationDay(ctx context.Context, key data.DoctorDay, loc *time.Location) error {
+	from, err := time.ParseInLocation(dateLayout, key.Day, loc)
+	if err != nil {
+		return fmt.Errorf("invalid rollup day %q", key.Day)
+	}
+	prescriptions, err := h.repo.GetDoctorPrescriptions(ctx, key.DoctorID, from, from.AddDate(0, 0, 1))
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescriptions of %s on %s: %v", key.DoctorID, key.Day, err)
+		return fmt.Errorf("failed to get prescriptions: %w", err)
+	}
+
+	var counted []*entity.Prescription
+	var ids []string
+	for _, p := range prescriptions {
+		if p.Status == entity.PrescriptionStatusAmended {
+			continue
+		}
+		counted = append(counted, p)
+		ids = append(ids, p.ID)
+	}
+
+	itemsByPrescription := make(map[string][]*entity.PrescriptionItem)
+	if len(ids) > 0 {
+		items, err := h.prescriptionRepo.GetItems(ctx, ids)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get prescription items: %v", err)
+			return fmt.Errorf("failed to get prescription items: %w", err)
+		}
+		for _, item := range items {
+			itemsByPrescription[item.PrescriptionID] = append(itemsByPrescription[item.PrescriptionID], item)
+		}
+	}
+
+	rows := make(map[string]*entity.AnalyticsMedicationDay)
+	var order []string
+	for _, p := range counted {
+		items := itemsByPrescription[p.ID]
+		if len(items) == 0 {
+			// Prescriptions from before items were kept only have the JSON copy.
+			for _, med := range entity.UnmarshalMedications(p.Medications) {
+				items = append(items, &entity.PrescriptionItem{DrugCode: med.DrugCode, MedicationName: med.MedicationName, Quantity: med.Quantity})
+			}
+		}
+
+		seen := make(map[string]bool)
+		for _, item := range items {
+			name := item.MedicationName
+			if item.DrugName != "" {
+				name = item.DrugName
+			}
+			mk := medicationKey(item.DrugCode, name)
+			if mk == "" {
+				continue
+			}
+			row, ok := rows[mk]
+			if !ok {
+				row = &entity.AnalyticsMedicationDay{Day: key.Day, DoctorID: key.DoctorID, MedicationKey: mk, DrugCode: item.DrugCode, MedicationName: name}
+				rows[mk] = row
+				order = append(order, mk)
+			}
+			if !seen[mk] {
+				row.Prescriptions++
+				seen[mk] = true
+			}
+			row.Quantity += int64(item.Quantity)
+		}
+	}
+
+	out := make([]*entity.AnalyticsMedicationDay, 0, len(order))
+	for _, mk := range order {
+		out = append(out, rows[mk])
+	}
+	if err := h.repo.ReplaceMedicationDay(ctx, key, out); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to save medication rollup of %s on %s: %v", key.DoctorID, key.Day, err)
+		return fmt.Errorf("failed to save medication rollup: %w", err)
+	}
+	return nil
+}
+
+// medicationKey identifies a medication across prescriptions: by drug code
+// when it has one, by its name otherwise.
+func medicationKey(drugCode, name string) string {
+	if drugCode != "" {
+		return drugCode
+	}
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// reportScope is a validated report request.
+type reportScope struct {
+	period  *AnalyticsPeriod
+	from    time.Time
+	to      time.Time
+	doctors []*entity.Doctor
+	names   map[string]string
+	filters map[string]interface{}
+}
+
+// scope validates the request and resolves the doctors it covers: the one
+// asked for, those of the specialization asked for, or every doctor.
+func (h *AnalyticsHandler) scope(ctx context.Context, req *AnalyticsReportRequest, rollup string) (*reportScope, error) {
+	to := time.Now().UTC()
+	var err error
+	if req.ToDate != "" {
+		if to, err = time.Parse(dateLayout, req.ToDate); err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid report end: %s", req.ToDate)
+			return nil, fmt.Errorf("invalid to_date %q, expected YYYY-MM-DD", req.ToDate)
+		}
+	}
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, 1-defaultReportDays)
+	if req.FromDate != "" {
+		if from, err = time.Parse(dateLayout, req.FromDate); err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid report start: %s", req.FromDate)
+			return nil, fmt.Errorf("invalid from_date %q, expected YYYY-MM-DD", req.FromDate)
+		}
+	}
+	if from.After(to) {
+		h.log.WithContext(ctx).Errorf("Report start %s is after its end %s", from.Format(dateLayout), to.Format(dateLayout))
+		return nil, fmt.Errorf("from_date must not be after to_date")
+	}
+	if to.Sub(from) >= maxReportDays*24*time.Hour {
+		h.log.WithContext(ctx).Errorf("Report period too long: %s to %s", from.Format(dateLayout), to.Format(dateLayout))
+		return nil, fmt.Errorf("report period must not exceed %d days", maxReportDays)
+	}
+
+	s := &reportScope{
+		period: &AnalyticsPeriod{
+			FromDate:       from.Format(dateLayout),
+			ToDate:         to.Format(dateLayout),
+			DoctorID:       req.DoctorID,
+			Specialization: req.Specialization,
+		},
+		from:  from,
+		to:    to,
+		names: make(map[string]string),
+		filters: map[string]interface{}{
+			"from_date": from.Format(dateLayout),
+			"to_date":   to.Format(dateLayout),
+		},
+	}
+
+	switch {
+	case req.DoctorID != "":
+		doctor, err := h.doctorRepo.Get(ctx, req.DoctorID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+			return nil, fmt.Errorf("failed to get doctor: %w", err)
+		}
+		if doctor == nil {
+			h.log.WithContext(ctx).Errorf("Doctor not found: %s", req.DoctorID)
+			return nil, fmt.Errorf("doctor not found")
+		}
+		if req.Specialization == 0 || doctor.Specialization == req.Specialization {
+			s.doctors = []*entity.Doctor{doctor}
+		}
+	default:
+		filters := map[string]interface{}{}
+		if req.Specialization > 0 {
+			filters["specialization"] = req.Specialization
+		}
+		if s.doctors, err = h.doctorRepo.Search(ctx, filters); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to search doctors: %v", err)
+			return nil, fmt.Errorf("failed to search doctors: %w", err)
+		}
+	}
+
+	ids := make([]string, 0, len(s.doctors))
+	for _, d := range s.doctors {
+		ids = append(ids, d.ID)
+		s.names[d.ID] = d.FirstName + " " + d.LastName
+	}
+	// Without a filter, rollups of doctors since removed are still counted.
+	if req.DoctorID != "" || req.Specialization > 0 {
+		s.filters["doctor_ids"] = ids
+	}
+
+	refresh, err := h.repo.GetRefresh(ctx, rollup)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get %s refresh: %v", rollup, err)
+		return nil, fmt.Errorf("failed to get %s refresh: %w", rollup, err)
+	}
+	if refresh != nil {
+		s.period.RefreshedAt = formatTimestamp(refresh.Watermark.UTC())
+	}
+	return s, nil
+}
+
+func (h *AnalyticsHandler) doctorDays(ctx context.Context, s *reportScope) ([]*entity.AnalyticsDoctorDay, error) {
+	days, err := h.repo.ListDoctorDays(ctx, s.filters)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list appointment rollups: %v", err)
+		return nil, fmt.Errorf("failed to list appointment rollups: %w", err)
+	}
+	return days, nil
+}
+
+// byDoctor sums day rows per doctor, keeping the doctors in name order.
+func byDoctor(days []*entity.AnalyticsDoctorDay, names map[string]string) (map[string]*entity.AnalyticsDoctorDay, []string) {
+	sums := make(map[string]*entity.AnalyticsDoctorDay)
+	var ids []string
+	for _, d := range days {
+		sum, ok := sums[d.DoctorID]
+		if !ok {
+			sum = &entity.AnalyticsDoctorDay{DoctorID: d.DoctorID}
+			sums[d.DoctorID] = sum
+			ids = append(ids, d.DoctorID)
+		}
+		addDoctorDay(sum, d)
+	}
+	sortDoctorIDs(ids, names)
+	return sums, ids
+}
+
+func addDoctorDay(sum, d *entity.AnalyticsDoctorDay) {
+	sum.Appointments += d.Appointments
+	sum.Completed += d.Completed
+	sum.Cancelled += d.Cancelled
+	sum.NoShow += d.NoShow
+	sum.BookedMinutes += d.BookedMinutes
+	sum.LeadTimeMinutes += d.LeadTimeMinutes
+}
+
+func sortDoctorIDs(ids []string, names map[string]string) {
+	sort.Slice(ids, func(i, j int) bool {
+		if names[ids[i]] != names[ids[j]] {
+			return names[ids[i]] < names[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+}
+
+// ratio divides, rounding to three decimals, and is zero for an empty whole.
+func ratio(part, whole float64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return math.Round(part/whole*1000) / 1000
+}
+
+func (h *AnalyticsHandler) GetBookingsReport(ctx context.Context, req *AnalyticsReportRequest) (*BookingsReport, error) {
+	ctx, span := otel.Trace(ctx, "AnalyticsHandler.GetBookingsReport")
+	defer span.End()
+
+	s, err := h.scope(ctx, req, analyticsAppointments)
+	if err != nil {
+		return nil, err
+	}
+	days, err := h.doctorDays(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &BookingsReport{Period: s.period, Days: []*DailyBookings{}, Totals: &BookingCounts{}}
+	for _, d := range days {
+		counts := BookingCounts{Appointments: d.Appointments, Completed: d.Completed, Cancelled: d.Cancelled, NoShow: d.NoShow}
+		out.Days = append(out.Days, &DailyBookings{Date: d.Day, DoctorID: d.DoctorID, DoctorName: s.names[d.DoctorID], BookingCounts: counts})
+		out.Totals.Appointments += d.Appointments
+		out.Totals.Completed += d.Completed
+		out.Totals.Cancelled += d.Cancelled
+		out.Totals.NoShow += d.NoShow
+	}
+	return out, nil
+}
+
+func (h *AnalyticsHandler) GetUtilizationReport(ctx context.Context, req *AnalyticsReportRequest) (*UtilizationReport, error) {
+	ctx, span := otel.Trace(ctx, "AnalyticsHandler.GetUtilizationReport")
+	defer span.End()
+
+	s, err := h.scope(ctx, req, analyticsAppointments)
+	if err != nil {
+		return nil, err
+	}
+	days, err := h.doctorDays(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	sums, _ := byDoctor(days, s.names)
+
+	available := make(map[string]int64)
+	for _, doctor := range s.doctors {
+		minutes, err := h.availableMinutes(ctx, doctor, s.from, s.to)
+		if err != nil {
+			return nil, err
+		}
+		available[doctor.ID] = minutes
+	}
+
+	ids := make([]string, 0, len(sums)+len(available))
+	for id := range sums {
+		ids = append(ids, id)
+	}
+	for id, minutes := range available {
+		if _, ok := sums[id]; !ok && minutes > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sortDoctorIDs(ids, s.names)
+
+	out := &UtilizationReport{Period: s.period, Doctors: []*DoctorUtilization{}, Totals: &DoctorUtilization{}}
+	for _, id := range ids {
+		row := &DoctorUtilization{DoctorID: id, DoctorName: s.names[id], AvailableMinutes: available[id]}
+		if sum, ok := sums[id]; ok {
+			row.BookedMinutes = sum.BookedMinutes
+		}
+		row.Utilization = ratio(float64(row.BookedMinutes), float64(row.AvailableMinutes))
+		out.Doctors = append(out.Doctors, row)
+		out.Totals.BookedMinutes += row.BookedMinutes
+		out.Totals.AvailableMinutes += row.AvailableMinutes
+	}
+	out.Totals.Utilization = ratio(float64(out.Totals.BookedMinutes), float64(out.Totals.AvailableMinutes))
+	return out, nil
+}
+
+// availableMinutes adds up the slots the doctor's current schedule offers on
+// each day from from to to inclusive.
+func (h *AnalyticsHandler) availableMinutes(ctx context.Context, doctor *entity.Doctor, from, to time.Time) (int64, error) {
+	_, windows, err := loadScheduleWindows(ctx, h.doctorRepo, h.clinicRepo, doctor, "")
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to load schedule of %s: %v", doctor.ID, err)
+		return 0, fmt.Errorf("failed to load schedule: %w", err)
+	}
+
+	var minutes int64
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		for _, sl := range generateSlots(day, windows) {
+			minutes += int64(sl.end.Sub(sl.start) / time.Minute)
+		}
+	}
+	return minutes, nil
+}
+
+func (h *AnalyticsHandler) GetCancellationsReport(ctx context.Context, req *AnalyticsReportRequest) (*CancellationsReport, error) {
+	ctx, span := otel.Trace(ctx, "AnalyticsHandler.GetCancellationsReport")
+	defer span.End()
+
+	s, err := h.scope(ctx, req, analyticsAppointments)
+	if err != nil {
+		return nil, err
+	}
+	days, err := h.doctorDays(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	sums, ids := byDoctor(days, s.names)
+
+	total := &entity.AnalyticsDoctorDay{}
+	out := &CancellationsReport{Period: s.period, Doctors: []*DoctorCancellations{}}
+	for _, id := range ids {
+		sum := sums[id]
+		addDoctorDay(total, sum)
+		out.Doctors = append(out.Doctors, cancellations(sum, s.names[id]))
+	}
+	out.Totals = cancellations(total, "")
+	return out, nil
+}
+
+func cancellations(sum *entity.AnalyticsDoctorDay, name string) *DoctorCancellations {
+	return &DoctorCancellations{
+		DoctorID:         sum.DoctorID,
+		DoctorName:       name,
+		Appointments:     sum.Appointments,
+		Cancelled:        sum.Cancelled,
+		NoShow:           sum.NoShow,
+		CancellationRate: ratio(float64(sum.Cancelled), float64(sum.Appointments)),
+		NoShowRate:       ratio(float64(sum.NoShow), float64(sum.Appointments)),
+	}
+}
+
+func (h *AnalyticsHandler) GetLeadTimeReport(ctx context.Context, req *AnalyticsReportRequest) (*LeadTimeReport, error) {
+	ctx, span := otel.Trace(ctx, "AnalyticsHandler.GetLeadTimeReport")
+	defer span.End()
+
+	s, err := h.scope(ctx, req, analyticsAppointments)
+	if err != nil {
+		return nil, err
+	}
+	days, err := h.doctorDays(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	sums, ids := byDoctor(days, s.names)
+
+	total := &entity.AnalyticsDoctorDay{}
+	out := &LeadTimeReport{Period: s.period, Doctors: []*DoctorLeadTime{}}
+	for _, id := range ids {
+		sum := sums[id]
+		addDoctorDay(total, sum)
+		out.Doctors = append(out.Doctors, leadTime(sum, s.names[id]))
+	}
+	out.Totals = leadTime(total, "")
+	return out, nil
+}
+
+func leadTime(sum *entity.AnalyticsDoctorDay, name string) *DoctorLeadTime {
+	return &DoctorLeadTime{
+		DoctorID:             sum.DoctorID,
+		DoctorName:           name,
+		Appointments:         sum.Appointments,
+		AverageLeadTimeHours: ratio(float64(sum.LeadTimeMinutes)/60, float64(sum.Appointments)),
+	}
+}
+
+func (h *AnalyticsHandler) GetBusiestHoursReport(ctx context.Context, req *AnalyticsReportRequest) (*BusiestHoursReport, error) {
+	ctx, span := otel.Trace(ctx, "AnalyticsHandler.GetBusiestHoursReport")
+	defer span.End()
+
+	s, err := h.scope(ctx, req, analyticsAppointments)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := h.repo.ListDoctorHours(ctx, s.filters)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list hourly rollups: %v", err)
+		return nil, fmt.Errorf("failed to list hourly rollups: %w", err)
+	}
+
+	var grid [7][24]int32
+	for _, cell := range hours {
+		if cell.Weekday < 0 || cell.Weekday > 6 || cell.Hour < 0 || cell.Hour > 23 {
+			continue
+		}
+		grid[cell.Weekday][cell.Hour] += cell.Appointments
+	}
+
+	out := &BusiestHoursReport{Period: s.period, Cells: []*HourlyBookings{}}
+	for weekday := range grid {
+		for hour, count := range grid[weekday] {
+			if count == 0 {
+				continue
+			}
+			out.Cells = append(out.Cells, &HourlyBookings{
+				Weekday:      int32(weekday),
+				WeekdayName:  time.Weekday(weekday).String(),
+				Hour:         int32(hour),
+				Appointments: count,
+			})
+		}
+	}
+	return out, nil
+}
+
+// GetMedicationsReport lists the most prescribed medications, by the number
+// of prescriptions they appear on. Limit defaults to 10.
+func (h *AnalyticsHandler) GetMedicationsReport(ctx context.Context, req *AnalyticsReportRequest) (*MedicationsReport, error) {
+	ctx, span := otel.Trace(ctx, "AnalyticsHandler.GetMedicationsReport")
+	defer span.End()
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultTopMedications
+	}
+	if limit > maxTopMedications {
+		limit = maxTopMedications
+	}
+
+	s, err := h.scope(ctx, req, analyticsMedications)
+	if err != nil {
+		return nil, err
+	}
+	days, err := h.repo.ListMedicationDays(ctx, s.filters)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list medication rollups: %v", err)
+		return nil, fmt.Errorf("failed to list medication rollups: %w", err)
+	}
+
+	byKey := make(map[string]*MedicationUsage)
+	var usages []*MedicationUsage
+	for _, d := range days {
+		usage, ok := byKey[d.MedicationKey]
+		if !ok {
+			usage = &MedicationUsage{DrugCode: d.DrugCode, MedicationName: d.MedicationName}
+			byKey[d.MedicationKey] = usage
+			usages = append(usages, usage)
+		}
+		usage.Prescriptions += d.Prescriptions
+		usage.Quantity += d.Quantity
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Prescriptions != usages[j].Prescriptions {
+			return usages[i].Prescriptions > usages[j].Prescriptions
+		}
+		if usages[i].Quantity != usages[j].Quantity {
+			return usages[i].Quantity > usages[j].Quantity
+		}
+		return usages[i].MedicationName < usages[j].MedicationName
+	})
+	if len(usages) > limit {
+		usages = usages[:limit]
+	}
+
+	out := &MedicationsReport{Period: s.period, Medications: usages}
+	if out.Medications == nil {
+		out.Medications = []*MedicationUsage{}
+	}
+	return out, nil
+}
@@ -10,28 +10,64 @@ import (
 	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
 	"github.com/arm-1234/medical-service/internal/data"
 	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/hl7"
 	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/arm-1234/medical-service/internal/pkg/video"
 	"github.com/go-kratos/kratos/v2/log"
 )
 
+type InPersonBookingRequest struct {
+	PatientID         string   `json:"patient_id"`
+	DoctorID          string   `json:"doctor_id"`
+	AppointmentDate   string   `json:"appointment_date"`
+	AppointmentTime   string   `json:"appointment_time"`
+	ReasonForVisit    string   `json:"reason_for_visit"`
+	Notes             string   `json:"notes"`
+	RequiredEquipment []string `json:"required_equipment"`
+}
+
 type AppointmentHandler struct {
-	repo        data.AppointmentRepo
-	patientRepo data.PatientRepo
-	doctorRepo  data.DoctorRepo
-	log         *log.Helper
+	repo         data.AppointmentRepo
+	patientRepo  data.PatientRepo
+	doctorRepo   data.DoctorRepo
+	clinicRepo   data.ClinicRepo
+	resourceRepo data.ResourceRepo
+	videoRepo    data.VideoSessionRepo
+	tx           data.Transaction
+	video        video.Provider
+	joinKeys     *video.JoinKeys
+	notifier     *hl7.Notifier
+	access       *AccessAuditor
+	log          *log.Helper
 }
 
 func NewAppointmentHandler(
 	repo data.AppointmentRepo,
 	patientRepo data.PatientRepo,
 	doctorRepo data.DoctorRepo,
+	clinicRepo data.ClinicRepo,
+	resourceRepo data.ResourceRepo,
+	videoRepo data.VideoSessionRepo,
+	tx data.Transaction,
+	videoProvider video.Provider,
+	joinKeys *video.JoinKeys,
+	notifier *hl7.Notifier,
+	access *AccessAuditor,
 	logger log.Logger,
 ) *AppointmentHandler {
 	return &AppointmentHandler{
-		repo:        repo,
-		patientRepo: patientRepo,
-		doctorRepo:  doctorRepo,
-		log:         log.NewHelper(logger),
+		repo:         repo,
+		patientRepo:  patientRepo,
+		doctorRepo:   doctorRepo,
+		clinicRepo:   clinicRepo,
+		resourceRepo: resourceRepo,
+		videoRepo:    videoRepo,
+		tx:           tx,
+		video:        videoProvider,
+		joinKeys:     joinKeys,
+		notifier:     notifier,
+		access:       access,
+		log:          log.NewHelper(logger),
 	}
 }
 
@@ -39,13 +75,34 @@ func (h *AppointmentHandler) BookAppointment(ctx context.Context, req *requestpb
 	ctx, span := otel.Trace(ctx, "AppointmentHandler.BookAppointment")
 	defer span.End()
 
+	return h.bookAppointment(ctx, req, nil)
+}
+
+// BookInPerson books an in-person appointment that needs specific equipment
+// in addition to an exam room.
+func (h *AppointmentHandler) BookInPerson(ctx context.Context, req *InPersonBookingRequest) (*responsepb.AppointmentResponse, error) {
+	ctx, span := otel.Trace(ctx, "AppointmentHandler.BookInPerson")
+	defer span.End()
+
+	return h.bookAppointment(ctx, &requestpb.BookAppointmentRequest{
+		PatientId:        req.PatientID,
+		DoctorId:         req.DoctorID,
+		AppointmentDate:  req.AppointmentDate,
+		AppointmentTime:  req.AppointmentTime,
+		ConsultationType: commonpb.ConsultationType(entity.ConsultationTypeInPerson),
+		ReasonForVisit:   req.ReasonForVisit,
+		Notes:            req.Notes,
+	}, req.RequiredEquipment)
+}
+
+func (h *AppointmentHandler) bookAppointment(ctx context.Context, req *requestpb.BookAppointmentRequest, requiredEquipment []string) (*responsepb.AppointmentResponse, error) {
 	if req.PatientId == "" || req.DoctorId == "" {
 		h.log.WithContext(ctx).Errorf("Patient ID and doctor ID are required")
 		return nil, fmt.Errorf("patient_id and doctor_id are required")
 	}
-	if req.AppointmentDate == "" || req.AppointmentTime == "" {
-		h.log.WithContext(ctx).Errorf("Appointment date and time are required")
-		return nil, fmt.Errorf("appointment_date and appointment_time are required")
+	if req.AppointmentTime == "" {
+		h.log.WithContext(ctx).Errorf("Appointment time is required")
+		return nil, fmt.Errorf("appointment_time is required")
 	}
 
 	patient, err := h.patientRepo.Get(ctx, req.PatientId)
@@ -72,34 +129,77 @@ func (h *AppointmentHandler) BookAppointment(ctx context.Context, req *requestpb
 		return nil, fmt.Errorf("doctor is not available")
 	}
 
-	conflict, err := h.repo.CheckConflict(ctx, req.DoctorId, req.AppointmentDate, req.AppointmentTime, "")
+	loc, windows, err := h.scheduleWindows(ctx, doctor, "")
 	if err != nil {
-		h.log.WithContext(ctx).Errorf("Failed to check appointment conflict: %v", err)
-		return nil, fmt.Errorf("failed to check appointment conflict: %w", err)
+		h.log.WithContext(ctx).Errorf("Failed to load doctor schedule: %v", err)
+		return nil, err
 	}
-	if conflict != nil {
-		h.log.WithContext(ctx).Errorf("Time slot already booked for doctor %s at %s %s", req.DoctorId, req.AppointmentDate, req.AppointmentTime)
-		return nil, fmt.Errorf("time slot is already booked")
+	booked, err := resolveSlot(req.AppointmentDate, req.AppointmentTime, loc, windows)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid appointment time: %v", err)
+		return nil, err
+	}
+	if err := h.checkClinicPlacement(ctx, int32(req.ConsultationType), booked, windows); err != nil {
+		return nil, err
 	}
 
 	appointment := &entity.Appointment{
-		PatientID:        req.PatientId,
+		PatientID:        patient.ID,
 		PatientName:      patient.FirstName + " " + patient.LastName,
 		DoctorID:         req.DoctorId,
 		DoctorName:       doctor.FirstName + " " + doctor.LastName,
-		AppointmentDate:  req.AppointmentDate,
-		AppointmentTime:  req.AppointmentTime,
+		ClinicID:         booked.clinicID,
+		AppointmentDate:  booked.start.Format(dateLayout),
+		AppointmentTime:  booked.start.Format(clockLayout),
+		StartsAt:         booked.start.UTC(),
+		EndsAt:           booked.end.UTC(),
+		Timezone:         booked.start.Location().String(),
 		Status:           entity.AppointmentStatusScheduled,
 		ConsultationType: int32(req.ConsultationType),
 		ReasonForVisit:   req.ReasonForVisit,
 		Notes:            req.Notes,
 	}
+	if len(requiredEquipment) > 0 {
+		appointment.RequiredEquipment = entity.MarshalStringArray(requiredEquipment)
+	}
+
+	// The doctor row lock serializes bookings for the doctor, so the conflict
+	// check and the insert cannot interleave with a concurrent booking.
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.doctorRepo.Lock(ctx, req.DoctorId); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to lock doctor: %v", err)
+			return fmt.Errorf("failed to lock doctor: %w", err)
+		}
 
-	if err := h.repo.Create(ctx, appointment); err != nil {
-		h.log.WithContext(ctx).Errorf("Failed to create appointment: %v", err)
-		return nil, fmt.Errorf("failed to create appointment: %w", err)
+		conflict, err := h.repo.CheckConflict(ctx, req.DoctorId, booked.start, booked.end, "")
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to check appointment conflict: %v", err)
+			return fmt.Errorf("failed to check appointment conflict: %w", err)
+		}
+		if conflict != nil {
+			h.log.WithContext(ctx).Errorf("Time slot already booked for doctor %s at %s (clinic %q)", req.DoctorId, formatTimestamp(booked.start), conflict.ClinicID)
+			return fmt.Errorf("time slot is already booked")
+		}
+
+		if err := h.repo.Create(ctx, appointment); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to create appointment: %v", err)
+			return fmt.Errorf("failed to create appointment: %w", err)
+		}
+
+		return h.reserveResources(ctx, appointment)
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	if appointment.ConsultationType == entity.ConsultationTypeVideo {
+		if _, err := h.provisionVideo(ctx, appointment); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to provision video session for appointment %s: %v", appointment.ID, err)
+		}
+		h.issueJoinKeys(ctx, appointment)
+	}
+	h.notify(ctx, appointment, hl7.EventBooked)
+
 	return h.entityToProto(appointment), nil
 }
 
@@ -157,11 +257,27 @@ func (h *AppointmentHandler) CancelAppointment(ctx context.Context, id string, r
 	appointment.Status = entity.AppointmentStatusCancelled
 	appointment.CancelledAt = &now
 	appointment.CancellationReason = reason
+	appointment.Sequence++
 
-	if err := h.repo.Update(ctx, appointment); err != nil {
-		h.log.WithContext(ctx).Errorf("Failed to cancel appointment: %v", err)
-		return nil, fmt.Errorf("failed to cancel appointment: %w", err)
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.repo.Update(ctx, appointment); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to cancel appointment: %v", err)
+			return fmt.Errorf("failed to cancel appointment: %w", err)
+		}
+		if err := h.resourceRepo.ReleaseBookings(ctx, appointment.ID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to release resources: %v", err)
+			return fmt.Errorf("failed to release resources: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.endVideo(ctx, appointment); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to end video session for appointment %s: %v", appointment.ID, err)
 	}
+	h.notify(ctx, appointment, hl7.EventCancelled)
 
 	return h.entityToProto(appointment), nil
 }
@@ -174,9 +290,9 @@ func (h *AppointmentHandler) RescheduleAppointment(ctx context.Context, req *req
 		h.log.WithContext(ctx).Errorf("Appointment ID is required")
 		return nil, fmt.Errorf("appointment_id is required")
 	}
-	if req.NewAppointmentDate == "" || req.NewAppointmentTime == "" {
-		h.log.WithContext(ctx).Errorf("New appointment date and time are required")
-		return nil, fmt.Errorf("new_appointment_date and new_appointment_time are required")
+	if req.NewAppointmentTime == "" {
+		h.log.WithContext(ctx).Errorf("New appointment time is required")
+		return nil, fmt.Errorf("new_appointment_time is required")
 	}
 
 	appointment, err := h.repo.Get(ctx, req.AppointmentId)
@@ -198,28 +314,84 @@ func (h *AppointmentHandler) RescheduleAppointment(ctx context.Context, req *req
 		return nil, fmt.Errorf("cannot reschedule a completed appointment")
 	}
 
-	conflict, err := h.repo.CheckConflict(ctx, appointment.DoctorID, req.NewAppointmentDate, req.NewAppointmentTime, appointment.ID)
+	doctor, err := h.doctorRepo.Get(ctx, appointment.DoctorID)
 	if err != nil {
-		h.log.WithContext(ctx).Errorf("Failed to check appointment conflict: %v", err)
-		return nil, fmt.Errorf("failed to check appointment conflict: %w", err)
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, fmt.Errorf("failed to get doctor: %w", err)
 	}
-	if conflict != nil {
-		h.log.WithContext(ctx).Errorf("New time slot already booked: %s %s", req.NewAppointmentDate, req.NewAppointmentTime)
-		return nil, fmt.Errorf("new time slot is already booked")
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", appointment.DoctorID)
+		return nil, fmt.Errorf("doctor not found")
 	}
 
-	appointment.AppointmentDate = req.NewAppointmentDate
-	appointment.AppointmentTime = req.NewAppointmentTime
+	loc, windows, err := h.scheduleWindows(ctx, doctor, "")
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to load doctor schedule: %v", err)
+		return nil, err
+	}
+	booked, err := resolveSlot(req.NewAppointmentDate, req.NewAppointmentTime, loc, windows)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid appointment time: %v", err)
+		return nil, err
+	}
+	if err := h.checkClinicPlacement(ctx, appointment.ConsultationType, booked, windows); err != nil {
+		return nil, err
+	}
+
+	appointment.ClinicID = booked.clinicID
+	appointment.AppointmentDate = booked.start.Format(dateLayout)
+	appointment.AppointmentTime = booked.start.Format(clockLayout)
+	appointment.StartsAt = booked.start.UTC()
+	appointment.EndsAt = booked.end.UTC()
+	appointment.Timezone = booked.start.Location().String()
 	appointment.Status = entity.AppointmentStatusRescheduled
+	appointment.Sequence++
 	if req.Reason != "" {
 		appointment.Notes = appointment.Notes + "\nRescheduled: " + req.Reason
 	}
 
-	if err := h.repo.Update(ctx, appointment); err != nil {
-		h.log.WithContext(ctx).Errorf("Failed to reschedule appointment: %v", err)
-		return nil, fmt.Errorf("failed to reschedule appointment: %w", err)
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.doctorRepo.Lock(ctx, appointment.DoctorID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to lock doctor: %v", err)
+			return fmt.Errorf("failed to lock doctor: %w", err)
+		}
+
+		conflict, err := h.repo.CheckConflict(ctx, appointment.DoctorID, booked.start, booked.end, appointment.ID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to check appointment conflict: %v", err)
+			return fmt.Errorf("failed to check appointment conflict: %w", err)
+		}
+		if conflict != nil {
+			h.log.WithContext(ctx).Errorf("New time slot already booked: %s (clinic %q)", formatTimestamp(booked.start), conflict.ClinicID)
+			return fmt.Errorf("new time slot is already booked")
+		}
+
+		if err := h.repo.Update(ctx, appointment); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to reschedule appointment: %v", err)
+			return fmt.Errorf("failed to reschedule appointment: %w", err)
+		}
+
+		if err := h.resourceRepo.ReleaseBookings(ctx, appointment.ID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to release resources: %v", err)
+			return fmt.Errorf("failed to release resources: %w", err)
+		}
+		return h.reserveResources(ctx, appointment)
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	if appointment.ConsultationType == entity.ConsultationTypeVideo {
+		if err := h.endVideo(ctx, appointment); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to end video session for appointment %s: %v", appointment.ID, err)
+		}
+		if _, err := h.provisionVideo(ctx, appointment); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to provision video session for appointment %s: %v", appointment.ID, err)
+		}
+		h.issueJoinKeys(ctx, appointment)
+	}
+	h.notify(ctx, appointment, hl7.EventRescheduled)
+
 	return h.entityToProto(appointment), nil
 }
 
@@ -249,26 +421,46 @@ func (h *AppointmentHandler) CompleteAppointment(ctx context.Context, req *reque
 		appointment.Notes = req.Notes
 	}
 
-	if err := h.repo.Update(ctx, appointment); err != nil {
-		h.log.Errorf("failed to complete appointment: %v", err)
-		return nil, fmt.Errorf("failed to complete appointment: %w", err)
-	}
-
-	doctor, _ := h.doctorRepo.Get(ctx, appointment.DoctorID)
-	if doctor != nil {
-		doctor.TotalConsultations++
-		_ = h.doctorRepo.Update(ctx, doctor)
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.repo.Update(ctx, appointment); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to complete appointment: %v", err)
+			return fmt.Errorf("failed to complete appointment: %w", err)
+		}
+		if err := h.doctorRepo.IncrementConsultations(ctx, appointment.DoctorID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to count consultation: %v", err)
+			return fmt.Errorf("failed to count consultation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return h.entityToProto(appointment), nil
 }
 
 func (h *AppointmentHandler) GetAvailableSlots(ctx context.Context, req *requestpb.GetAvailableSlotsRequest) (*responsepb.AvailableSlotsResponse, error) {
-	if req.DoctorId == "" || req.Date == "" {
+	return h.availableSlots(ctx, req.DoctorId, req.Date, "", nil)
+}
+
+func (h *AppointmentHandler) GetClinicSlots(ctx context.Context, clinicID, doctorID, date string, equipment []string) (*responsepb.AvailableSlotsResponse, error) {
+	ctx, span := otel.Trace(ctx, "AppointmentHandler.GetClinicSlots")
+	defer span.End()
+
+	if clinicID == "" {
+		h.log.WithContext(ctx).Errorf("Clinic ID is required")
+		return nil, fmt.Errorf("clinic_id is required")
+	}
+
+	return h.availableSlots(ctx, doctorID, date, clinicID, equipment)
+}
+
+func (h *AppointmentHandler) availableSlots(ctx context.Context, doctorID, date, clinicID string, equipment []string) (*responsepb.AvailableSlotsResponse, error) {
+	if doctorID == "" || date == "" {
 		return nil, fmt.Errorf("doctor_id and date are required")
 	}
 
-	doctor, err := h.doctorRepo.Get(ctx, req.DoctorId)
+	doctor, err := h.doctorRepo.Get(ctx, doctorID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get doctor: %w", err)
 	}
@@ -276,42 +468,78 @@ func (h *AppointmentHandler) GetAvailableSlots(ctx context.Context, req *request
 		return nil, fmt.Errorf("doctor not found")
 	}
 
-	existingAppointments, err := h.repo.GetByDoctorAndDate(ctx, req.DoctorId, req.Date)
+	loc, windows, err := h.scheduleWindows(ctx, doctor, clinicID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get existing appointments: %w", err)
+		return nil, err
+	}
+	day, err := parseDay(date, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := generateSlots(day, windows)
+	if len(candidates) == 0 {
+		return &responsepb.AvailableSlotsResponse{
+			DoctorId:   doctorID,
+			DoctorName: doctor.FirstName + " " + doctor.LastName,
+			Date:       day.Format(dateLayout),
+		}, nil
+	}
+
+	from, to := candidates[0].start, candidates[0].end
+	for _, c := range candidates {
+		if c.start.Before(from) {
+			from = c.start
+		}
+		if c.end.After(to) {
+			to = c.end
+		}
 	}
 
-	bookedTimes := make(map[string]bool)
-	for _, apt := range existingAppointments {
-		bookedTimes[apt.AppointmentTime] = true
+	// Appointments are looked up across every clinic, so a slot is only free if
+	// the doctor is not booked anywhere else at that time.
+	existingAppointments, err := h.repo.GetByDoctorInRange(ctx, doctorID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing appointments: %w", err)
 	}
 
+	pools := make(map[string]*resourcePool)
 	var slots []*responsepb.TimeSlot
-	startHour := 9
-	endHour := 17
-	for hour := startHour; hour < endHour; hour++ {
-		for minute := 0; minute < 60; minute += 30 {
-			timeStr := fmt.Sprintf("%02d:%02d", hour, minute)
-			endMinute := minute + 30
-			endHourSlot := hour
-			if endMinute >= 60 {
-				endMinute = 0
-				endHourSlot++
+	for _, c := range candidates {
+		available := true
+		for _, apt := range existingAppointments {
+			if apt.StartsAt.Before(c.end) && apt.EndsAt.After(c.start) {
+				available = false
+				break
 			}
-			endTimeStr := fmt.Sprintf("%02d:%02d", endHourSlot, endMinute)
+		}
 
-			slots = append(slots, &responsepb.TimeSlot{
-				StartTime:   timeStr,
-				EndTime:     endTimeStr,
-				IsAvailable: !bookedTimes[timeStr],
-			})
+		// Slots at a clinic additionally need a free room and the requested
+		// equipment.
+		if available && c.clinicID != "" {
+			pool, ok := pools[c.clinicID]
+			if !ok {
+				if pool, err = h.resourcePool(ctx, c.clinicID, from, to); err != nil {
+					return nil, err
+				}
+				pools[c.clinicID] = pool
+			}
+			if pool.managed(equipment) {
+				_, _, available = pool.allocate(c.start, c.end, equipment)
+			}
 		}
+
+		slots = append(slots, &responsepb.TimeSlot{
+			StartTime:   formatTimestamp(c.start),
+			EndTime:     formatTimestamp(c.end),
+			IsAvailable: available,
+		})
 	}
 
 	return &responsepb.AvailableSlotsResponse{
-		DoctorId:       req.DoctorId,
+		DoctorId:       doctorID,
 		DoctorName:     doctor.FirstName + " " + doctor.LastName,
-		Date:           req.Date,
+		Date:           day.Format(dateLayout),
 		AvailableSlots: slots,
 	}, nil
 }
@@ -337,6 +565,7 @@ func (h *AppointmentHandler) GetPatientAppointments(ctx context.Context, req *re
 		h.log.Errorf("failed to get patient appointments: %v", err)
 		return nil, fmt.Errorf("failed to get patient appointments: %w", err)
 	}
+	h.access.Record(ctx, req.PatientId, accessAppointments, "")
 
 	var protoAppointments []*responsepb.AppointmentResponse
 	for _, apt := range appointments {
@@ -377,26 +606,110 @@ func (h *AppointmentHandler) GetDoctorAppointments(ctx context.Context, req *req
 	}, nil
 }
 
+func (h *AppointmentHandler) scheduleWindows(ctx context.Context, doctor *entity.Doctor, clinicID string) (*time.Location, []scheduleWindow, error) {
+	return loadScheduleWindows(ctx, h.doctorRepo, h.clinicRepo, doctor, clinicID)
+}
+
+func (h *AppointmentHandler) resourcePool(ctx context.Context, clinicID string, from, to time.Time) (*resourcePool, error) {
+	rooms, err := h.clinicRepo.GetRooms(ctx, clinicID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rooms: %w", err)
+	}
+	equipment, err := h.resourceRepo.GetEquipment(ctx, clinicID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get equipment: %w", err)
+	}
+	bookings, err := h.resourceRepo.GetBookings(ctx, clinicID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource bookings: %w", err)
+	}
+
+	return &resourcePool{rooms: rooms, equipment: equipment, bookings: bookings}, nil
+}
+
+// checkClinicPlacement rejects an in-person slot that falls outside every
+// clinic template of a doctor who works at clinics: no room could be reserved
+// for it. Doctors without clinic templates keep booking without a clinic.
+func (h *AppointmentHandler) checkClinicPlacement(ctx context.Context, consultationType int32, booked slot, windows []scheduleWindow) error {
+	if consultationType != entity.ConsultationTypeInPerson || booked.clinicID != "" {
+		return nil
+	}
+	for _, w := range windows {
+		if w.ClinicID != "" {
+			h.log.WithContext(ctx).Errorf("In-person slot at %s is outside the doctor's clinic hours", formatTimestamp(booked.start))
+			return fmt.Errorf("in-person appointments must be booked within the doctor's clinic hours")
+		}
+	}
+	return nil
+}
+
+// reserveResources books a room, and any equipment the appointment requires,
+// for an in-person appointment at a clinic. It must run inside the booking
+// transaction; the clinic row lock serializes concurrent reservations.
+func (h *AppointmentHandler) reserveResources(ctx context.Context, appointment *entity.Appointment) error {
+	required := entity.UnmarshalStringArray(appointment.RequiredEquipment)
+	if appointment.ConsultationType != entity.ConsultationTypeInPerson || appointment.ClinicID == "" {
+		if len(required) > 0 {
+			h.log.WithContext(ctx).Errorf("Equipment requested for appointment outside a clinic: %s", appointment.ID)
+			return fmt.Errorf("equipment can only be reserved for in-person appointments at a clinic")
+		}
+		return nil
+	}
+
+	if err := h.resourceRepo.LockClinic(ctx, appointment.ClinicID); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to lock clinic: %v", err)
+		return fmt.Errorf("failed to lock clinic: %w", err)
+	}
+
+	pool, err := h.resourcePool(ctx, appointment.ClinicID, appointment.StartsAt, appointment.EndsAt)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to load clinic resources: %v", err)
+		return err
+	}
+	if !pool.managed(required) {
+		return nil
+	}
+
+	room, equipment, ok := pool.allocate(appointment.StartsAt, appointment.EndsAt, required)
+	if !ok {
+		h.log.WithContext(ctx).Errorf("No free room for appointment at %s in clinic %s", formatTimestamp(appointment.StartsAt), appointment.ClinicID)
+		return fmt.Errorf("no room with the required equipment is free at this time")
+	}
+
+	if err := h.resourceRepo.CreateBookings(ctx, resourceBookings(appointment, room, equipment)); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to reserve resources: %v", err)
+		return fmt.Errorf("failed to reserve resources: %w", err)
+	}
+
+	return nil
+}
+
 func (h *AppointmentHandler) entityToProto(appointment *entity.Appointment) *responsepb.AppointmentResponse {
+	loc, err := loadLocation(appointment.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	startsAt := appointment.StartsAt.In(loc)
+
 	resp := &responsepb.AppointmentResponse{
 		AppointmentId:    appointment.ID,
 		PatientId:        appointment.PatientID,
 		PatientName:      appointment.PatientName,
 		DoctorId:         appointment.DoctorID,
 		DoctorName:       appointment.DoctorName,
-		AppointmentDate:  appointment.AppointmentDate,
-		AppointmentTime:  appointment.AppointmentTime,
+		AppointmentDate:  startsAt.Format(dateLayout),
+		AppointmentTime:  formatTimestamp(startsAt),
 		Status:           commonpb.AppointmentStatus(appointment.Status),
 		ConsultationType: commonpb.ConsultationType(appointment.ConsultationType),
 		ReasonForVisit:   appointment.ReasonForVisit,
 		Notes:            appointment.Notes,
 		Diagnosis:        appointment.Diagnosis,
-		CreatedAt:        appointment.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt:        appointment.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		CreatedAt:        formatTimestamp(appointment.CreatedAt.In(loc)),
+		UpdatedAt:        formatTimestamp(appointment.UpdatedAt.In(loc)),
 	}
 
 	if appointment.CancelledAt != nil {
-		cancelledAt := appointment.CancelledAt.Format("2006-01-02T15:04:05Z")
+		cancelledAt := formatTimestamp(appointment.CancelledAt.In(loc))
 		resp.CancelledAt = &cancelledAt
 	}
 	if appointment.CancellationReason != "" {
@@ -2,4 +2,4 @@ package biz
 
 import "github.com/google/wire"
 
-var ProviderSet = wire.NewSet(NewPatientHandler, NewDoctorHandler, NewAppointmentHandler, NewPrescriptionHandler)
+var ProviderSet = wire.NewSet(NewPatientHandler, NewDoctorHandler, NewAppointmentHandler, NewPrescriptionHandler, NewClinicHandler, NewCalendarHandler, NewReviewHandler, NewMedicalRecordHandler, NewRecordSigner, NewVitalSignHandler, NewLabHandler, NewFHIRHandler, NewFHIRImportHandler, NewHL7Handler, NewBulkHandler, NewAccessAuditor, NewPatientExportHandler, NewAnalyticsHandler)
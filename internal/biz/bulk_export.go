@@ -0,0 +1,213 @@
+package biz
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+)
+
+// bulkExportBatchSize is how many rows an export reads at a time.
+const bulkExportBatchSize = 500
+
+var bulkAppointmentStatuses = map[int32]string{
+	entity.AppointmentStatusScheduled:   "scheduled",
+	entity.AppointmentStatusConfirmed:   "confirmed",
+	entity.AppointmentStatusInProgress:  "in_progress",
+	entity.AppointmentStatusCompleted:   "completed",
+	entity.AppointmentStatusCancelled:   "cancelled",
+	entity.AppointmentStatusNoShow:      "no_show",
+	entity.AppointmentStatusRescheduled: "rescheduled",
+}
+
+var bulkConsultationTypes = map[int32]string{
+	entity.ConsultationTypeInPerson: "in_person",
+	entity.ConsultationTypeVideo:    "video",
+	entity.ConsultationTypePhone:    "phone",
+}
+
+// bulkExportColumns is the header of each kind of export. The patient and
+// doctor columns are the ones their imports read, so an export can be
+// edited and imported again.
+var bulkExportColumns = map[string][]string{
+	BulkKindPatients: {"id", "first_name", "last_name", "email", "phone_number", "date_of_birth", "gender", "blood_group",
+		"street", "city", "state", "zip_code", "country", "merged_into", "created_at"},
+	BulkKindDoctors: {"id", "first_name", "last_name", "email", "phone_number", "license_number", "specialization",
+		"years_of_experience", "qualifications", "languages", "consultation_fee", "is_available", "timezone",
+		"average_rating", "total_consultations", "created_at"},
+	BulkKindAppointments: {"id", "patient_id", "patient_name", "doctor_id", "doctor_name", "clinic_id", "starts_at", "ends_at",
+		"timezone", "status", "consultation_type", "reason_for_visit", "cancelled_at", "cancellation_reason", "created_at"},
+	BulkKindPrescriptions: {"prescription_id", "patient_id", "patient_name", "doctor_id", "doctor_name", "prescription_date",
+		"valid_until", "status", "refills_allowed", "refills_used", "diagnosis", "position", "drug_code", "medication_name",
+		"dose_amount", "dose_unit", "frequency_code", "route", "duration_days", "quantity", "instructions"},
+}
+
+// BulkExportRequest selects the rows of an export. From and To are
+// YYYY-MM-DD dates, both inclusive, bounding when patients and doctors were
+// created, when appointments start and when prescriptions were issued.
+type BulkExportRequest struct {
+	Kind string `json:"kind"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ExportFilters checks an export request and returns the filters it
+// selects rows by, so that a bad request fails before anything is written.
+func (h *BulkHandler) ExportFilters(ctx context.Context, req *BulkExportRequest) (map[string]interface{}, error) {
+	if _, ok := bulkExportColumns[req.Kind]; !ok {
+		h.log.WithContext(ctx).Errorf("Unknown export kind: %s", req.Kind)
+		return nil, fmt.Errorf("unknown export kind %q, expected patients, doctors, appointments or prescriptions", req.Kind)
+	}
+
+	filters := make(map[string]interface{})
+	if req.From != "" {
+		from, err := time.Parse(dateLayout, req.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from date %q, expected YYYY-MM-DD", req.From)
+		}
+		filters["from"] = from
+	}
+	if req.To != "" {
+		to, err := time.Parse(dateLayout, req.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to date %q, expected YYYY-MM-DD", req.To)
+		}
+		filters["to"] = to.AddDate(0, 0, 1)
+	}
+	if from, ok := filters["from"].(time.Time); ok {
+		if to, ok := filters["to"].(time.Time); ok && !from.Before(to) {
+			return nil, fmt.Errorf("from must not be after to")
+		}
+	}
+	return filters, nil
+}
+
+// Export writes the selected rows to w as CSV, a batch at a time.
+// Prescriptions are written one row per medication item.
+func (h *BulkHandler) Export(ctx context.Context, req *BulkExportRequest, w io.Writer) error {
+	ctx, span := otel.Trace(ctx, "BulkHandler.Export")
+	defer span.End()
+
+	filters, err := h.ExportFilters(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	out := exportWriter{csv.NewWriter(w)}
+	if err := out.Write(bulkExportColumns[req.Kind]); err != nil {
+		return err
+	}
+	flush := func() error {
+		out.Flush()
+		return out.Error()
+	}
+
+	switch req.Kind {
+	case BulkKindPatients:
+		err = h.exportRepo.EachPatient(ctx, filters, bulkExportBatchSize, func(patients []*entity.Patient) error {
+			for _, p := range patients {
+				addr := entity.UnmarshalAddress(p.Address)
+				if addr == nil {
+					addr = &entity.Address{}
+				}
+				if err := out.Write([]string{p.ID, p.FirstName, p.LastName, p.Email, p.PhoneNumber, p.DateOfBirth,
+					fhirGenders[p.Gender], bulkCode(p.BloodGroup), addr.Street, addr.City, addr.State, addr.ZipCode,
+					addr.Country, p.MergedInto, formatTimestamp(p.CreatedAt)}); err != nil {
+					return err
+				}
+			}
+			return flush()
+		})
+	case BulkKindDoctors:
+		err = h.exportRepo.EachDoctor(ctx, filters, bulkExportBatchSize, func(doctors []*entity.Doctor) error {
+			for _, d := range doctors {
+				if err := out.Write([]string{d.ID, d.FirstName, d.LastName, d.Email, d.PhoneNumber, d.LicenseNumber,
+					bulkCode(d.Specialization), strconv.Itoa(int(d.YearsOfExperience)),
+					strings.Join(entity.UnmarshalStringArray(d.Qualifications), "; "),
+					strings.Join(entity.UnmarshalStringArray(d.Languages), "; "),
+					strconv.Itoa(int(d.ConsultationFee)), strconv.FormatBool(d.IsAvailable), d.Timezone,
+					strconv.FormatFloat(float64(d.AverageRating), 'f', 2, 32), strconv.Itoa(int(d.TotalConsultations)),
+					formatTimestamp(d.CreatedAt)}); err != nil {
+					return err
+				}
+			}
+			return flush()
+		})
+	case BulkKindAppointments:
+		err = h.exportRepo.EachAppointment(ctx, filters, bulkExportBatchSize, func(appointments []*entity.Appointment) error {
+			for _, a := range appointments {
+				cancelledAt := ""
+				if a.CancelledAt != nil {
+					cancelledAt = formatTimestamp(*a.CancelledAt)
+				}
+				if err := out.Write([]string{a.ID, a.PatientID, a.PatientName, a.DoctorID, a.DoctorName, a.ClinicID,
+					formatTimestamp(a.StartsAt), formatTimestamp(a.EndsAt), a.Timezone,
+					bulkAppointmentStatuses[a.Status], bulkConsultationTypes[a.ConsultationType], a.ReasonForVisit,
+					cancelledAt, a.CancellationReason, formatTimestamp(a.CreatedAt)}); err != nil {
+					return err
+				}
+			}
+			return flush()
+		})
+	case BulkKindPrescriptions:
+		err = h.exportRepo.EachPrescription(ctx, filters, bulkExportBatchSize, func(prescriptions []*entity.Prescription, items map[string][]*entity.PrescriptionItem) error {
+			for _, p := range prescriptions {
+				prescription := []string{p.ID, p.PatientID, p.PatientName, p.DoctorID, p.DoctorName,
+					formatTimestamp(p.PrescriptionDate), formatTimestamp(p.ValidUntil), p.Status,
+					strconv.Itoa(int(p.RefillsAllowed)), strconv.Itoa(int(p.RefillsUsed)), p.Diagnosis}
+				if len(items[p.ID]) == 0 {
+					if err := out.Write(append(prescription, "", "", "", "", "", "", "", "", "", "")); err != nil {
+						return err
+					}
+					continue
+				}
+				for _, item := range items[p.ID] {
+					if err := out.Write(append(prescription[:len(prescription):len(prescription)],
+						strconv.Itoa(int(item.Position)), item.DrugCode, item.MedicationName,
+						strconv.FormatFloat(item.DoseAmount, 'f', -1, 64), item.DoseUnit, item.FrequencyCode, item.Route,
+						strconv.Itoa(int(item.DurationDays)), strconv.Itoa(int(item.Quantity)), item.Instructions)); err != nil {
+						return err
+					}
+				}
+			}
+			return flush()
+		})
+	}
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to export %s: %v", req.Kind, err)
+		return err
+	}
+	return flush()
+}
+
+// bulkCode writes a numeric code, left empty when it is unset.
+func bulkCode(v int32) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(v))
+}
+
+// exportWriter writes CSV rows that are safe to open in a spreadsheet: a
+// cell starting with a formula trigger is prefixed with a quote so names and
+// free text are shown as typed rather than evaluated.
+type exportWriter struct {
+	*csv.Writer
+}
+
+func (w exportWriter) Write(record []string) error {
+	row := make([]string, len(record))
+	for i, v := range record {
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			v = "'" + v
+		}
+		row[i] = v
+	}
+	return w.Writer.Write(row)
+}
@@ -0,0 +1,27 @@
+package biz
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestExportWriterNeutralizesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	out := exportWriter{csv.NewWriter(&buf)}
+	if err := out.Write([]string{"=HYPERLINK(\"x\")", "+1 555", "-2", "@SUM(A1)", "\tx", "\rx", "Ann", "", "2024-03-10"}); err != nil {
+		t.Fatal(err)
+	}
+	out.Flush()
+
+	got, err := csv.NewReader(&buf).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"'=HYPERLINK(\"x\")", "'+1 555", "'-2", "'@SUM(A1)", "'\tx", "'\rx", "Ann", "", "2024-03-10"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("cell %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,722 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	requestpb "github.com/arm-1234/common-protos/medical/v1/request"
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/arm-1234/medical-service/internal/pkg/sheet"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// Kinds of rows bulk import and export deal in.
+const (
+	BulkKindPatients      = "patients"
+	BulkKindDoctors       = "doctors"
+	BulkKindSchedules     = "schedules"
+	BulkKindAppointments  = "appointments"
+	BulkKindPrescriptions = "prescriptions"
+)
+
+// Outcomes of an imported row.
+const (
+	BulkImportCreated   = "created"
+	BulkImportUpdated   = "updated"
+	BulkImportUnchanged = "unchanged"
+	BulkImportFailed    = "failed"
+)
+
+// bulkImportColumns lists the columns each kind of import requires in the
+// header. Other known columns are optional and unknown ones are ignored.
+var bulkImportColumns = map[string][]string{
+	BulkKindPatients:  {"email"},
+	BulkKindDoctors:   {"license_number"},
+	BulkKindSchedules: {"day_of_week", "start_time", "end_time"},
+}
+
+type BulkImportRequest struct {
+	Kind string `json:"kind"`
+	// DryRun validates the file and reports what importing it would do
+	// without writing anything.
+	DryRun bool   `json:"dry_run"`
+	File   []byte `json:"-"`
+}
+
+// BulkImportRow reports on one data row. Line counts the header as line 1.
+type BulkImportRow struct {
+	Line    int      `json:"line"`
+	Key     string   `json:"key"`
+	Outcome string   `json:"outcome"`
+	ID      string   `json:"id,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+type BulkImportReport struct {
+	Kind      string           `json:"kind"`
+	DryRun    bool             `json:"dry_run"`
+	Rows      int              `json:"rows"`
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Failed    int              `json:"failed"`
+	Results   []*BulkImportRow `json:"results"`
+}
+
+func (r *BulkImportRow) fail(format string, args ...interface{}) {
+	r.Outcome = BulkImportFailed
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+func (r *BulkImportRow) failed() bool {
+	return len(r.Errors) > 0
+}
+
+// BulkHandler imports patients, doctors and doctor schedules from CSV or
+// XLSX files and exports tables as CSV. Imports upsert: patients are keyed
+// by email and doctors by license number, so importing a file again changes
+// nothing.
+type BulkHandler struct {
+	patientRepo data.PatientRepo
+	doctorRepo  data.DoctorRepo
+	clinicRepo  data.ClinicRepo
+	nameRepo    data.NameSyncRepo
+	exportRepo  data.ExportRepo
+	tx          data.Transaction
+	log         *log.Helper
+}
+
+func NewBulkHandler(
+	patientRepo data.PatientRepo,
+	doctorRepo data.DoctorRepo,
+	clinicRepo data.ClinicRepo,
+	nameRepo data.NameSyncRepo,
+	exportRepo data.ExportRepo,
+	tx data.Transaction,
+	logger log.Logger,
+) *BulkHandler {
+	return &BulkHandler{
+		patientRepo: patientRepo,
+		doctorRepo:  doctorRepo,
+		clinicRepo:  clinicRepo,
+		nameRepo:    nameRepo,
+		exportRepo:  exportRepo,
+		tx:          tx,
+		log:         log.NewHelper(logger),
+	}
+}
+
+// bulkImport is the state of one import: its report and the keys of the
+// rows seen so far, so that a file naming the same patient or doctor twice
+// fails the second row instead of applying both.
+type bulkImport struct {
+	dryRun bool
+	report *BulkImportReport
+	seen   map[string]int
+}
+
+func (imp *bulkImport) row(line int, key string) *BulkImportRow {
+	r := &BulkImportRow{Line: line, Key: key}
+	imp.report.Results = append(imp.report.Results, r)
+	return r
+}
+
+// claim records that the row at line uses a unique value, failing it when
+// an earlier row did.
+func (imp *bulkImport) claim(r *BulkImportRow, column, value string) {
+	if value == "" {
+		return
+	}
+	key := column + "\x00" + strings.ToLower(value)
+	if first, ok := imp.seen[key]; ok {
+		r.fail("%s: %q is also used on line %d", column, value, first)
+		return
+	}
+	imp.seen[key] = r.Line
+}
+
+// ImportFile applies a CSV or XLSX file of patients, doctors or schedules.
+// Rows are applied one by one, so a row that fails leaves the others in
+// place; the report says what happened to each.
+func (h *BulkHandler) ImportFile(ctx context.Context, req *BulkImportRequest) (*BulkImportReport, error) {
+	ctx, span := otel.Trace(ctx, "BulkHandler.ImportFile")
+	defer span.End()
+
+	required, ok := bulkImportColumns[req.Kind]
+	if !ok {
+		h.log.WithContext(ctx).Errorf("Unknown import kind: %s", req.Kind)
+		return nil, fmt.Errorf("unknown import kind %q, expected patients, doctors or schedules", req.Kind)
+	}
+	if len(req.File) == 0 {
+		h.log.WithContext(ctx).Errorf("Import file is empty")
+		return nil, fmt.Errorf("file is required")
+	}
+	table, err := sheet.Read(req.File)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to read import file: %v", err)
+		return nil, err
+	}
+	for _, column := range required {
+		if table.Column(column) < 0 {
+			h.log.WithContext(ctx).Errorf("Import file has no %s column", column)
+			return nil, fmt.Errorf("file has no %s column", column)
+		}
+	}
+
+	imp := &bulkImport{
+		dryRun: req.DryRun,
+		report: &BulkImportReport{Kind: req.Kind, DryRun: req.DryRun, Rows: len(table.Rows), Results: []*BulkImportRow{}},
+		seen:   make(map[string]int),
+	}
+	switch req.Kind {
+	case BulkKindPatients:
+		for _, row := range table.Each() {
+			if err := h.importPatient(ctx, imp, row); err != nil {
+				return nil, err
+			}
+		}
+	case BulkKindDoctors:
+		for _, row := range table.Each() {
+			if err := h.importDoctor(ctx, imp, row); err != nil {
+				return nil, err
+			}
+		}
+	case BulkKindSchedules:
+		if err := h.importSchedules(ctx, imp, table.Each()); err != nil {
+			return nil, err
+		}
+	}
+
+	report := imp.report
+	for _, r := range report.Results {
+		switch r.Outcome {
+		case BulkImportCreated:
+			report.Created++
+		case BulkImportUpdated:
+			report.Updated++
+		case BulkImportUnchanged:
+			report.Unchanged++
+		case BulkImportFailed:
+			report.Failed++
+		}
+	}
+	h.log.WithContext(ctx).Infof("Imported %s (dry run %v): %d created, %d updated, %d unchanged, %d failed",
+		req.Kind, req.DryRun, report.Created, report.Updated, report.Unchanged, report.Failed)
+	return report, nil
+}
+
+// importPatient creates the patient of a row, or updates the patient with
+// its email from the row's non-empty cells. Only database errors are
+// returned; problems with the row fail the row.
+func (h *BulkHandler) importPatient(ctx context.Context, imp *bulkImport, row sheet.Row) error {
+	r := imp.row(row.Line, row.Get("email"))
+	email, phone := row.Get("email"), row.Get("phone_number")
+	if email == "" {
+		r.fail("email: is required")
+	}
+	imp.claim(r, "email", email)
+	imp.claim(r, "phone_number", phone)
+
+	patient := &entity.Patient{
+		FirstName:   row.Get("first_name"),
+		LastName:    row.Get("last_name"),
+		Email:       email,
+		PhoneNumber: phone,
+		DateOfBirth: row.Get("date_of_birth"),
+		Address:     bulkAddress(row),
+	}
+	if patient.DateOfBirth != "" {
+		if _, err := time.Parse(dateLayout, patient.DateOfBirth); err != nil {
+			r.fail("date_of_birth: invalid date %q, expected YYYY-MM-DD", patient.DateOfBirth)
+		}
+	}
+	if v := row.Get("gender"); v != "" {
+		if patient.Gender = bulkGender(v); patient.Gender == 0 {
+			r.fail("gender: unknown gender %q, expected male, female or other", v)
+		}
+	}
+	patient.BloodGroup = bulkInt(r, row, "blood_group")
+	if r.failed() {
+		return nil
+	}
+
+	existing, err := h.patientRepo.GetByEmail(ctx, email)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to check existing email: %v", err)
+		return fmt.Errorf("failed to check existing email: %w", err)
+	}
+	if phone != "" {
+		other, err := h.patientRepo.GetByPhone(ctx, phone)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to check existing phone: %v", err)
+			return fmt.Errorf("failed to check existing phone: %w", err)
+		}
+		if other != nil && (existing == nil || other.ID != existing.ID) {
+			r.fail("phone_number: already registered to another patient")
+			return nil
+		}
+	}
+
+	if existing == nil {
+		if patient.FirstName == "" || patient.LastName == "" || phone == "" {
+			r.fail("first_name, last_name and phone_number are required for a new patient")
+			return nil
+		}
+		r.Outcome = BulkImportCreated
+		if imp.dryRun {
+			return nil
+		}
+		if err := h.patientRepo.Create(ctx, patient); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to create patient on line %d: %v", row.Line, err)
+			r.fail("failed to create patient: %v", err)
+			return nil
+		}
+		r.ID = patient.ID
+		return nil
+	}
+
+	r.ID = existing.ID
+	oldName := existing.FirstName + " " + existing.LastName
+	changed := bulkSet(&existing.FirstName, patient.FirstName)
+	changed = bulkSet(&existing.LastName, patient.LastName) || changed
+	changed = bulkSet(&existing.PhoneNumber, patient.PhoneNumber) || changed
+	changed = bulkSet(&existing.DateOfBirth, patient.DateOfBirth) || changed
+	changed = bulkSet(&existing.Address, patient.Address) || changed
+	changed = bulkSetInt(&existing.Gender, patient.Gender) || changed
+	changed = bulkSetInt(&existing.BloodGroup, patient.BloodGroup) || changed
+	if !changed {
+		r.Outcome = BulkImportUnchanged
+		return nil
+	}
+	r.Outcome = BulkImportUpdated
+	if imp.dryRun {
+		return nil
+	}
+
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.patientRepo.Update(ctx, existing); err != nil {
+			return fmt.Errorf("failed to update patient: %w", err)
+		}
+		if name := existing.FirstName + " " + existing.LastName; name != oldName {
+			if _, err := h.nameRepo.SyncName(ctx, data.NamePartyPatient, existing.ID, name, nameSyncTargets(data.NamePartyPatient)); err != nil {
+				return fmt.Errorf("failed to sync patient name: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to update patient on line %d: %v", row.Line, err)
+		r.fail("%v", err)
+	}
+	return nil
+}
+
+// importDoctor creates the doctor of a row, or updates the doctor with its
+// license number from the row's non-empty cells.
+func (h *BulkHandler) importDoctor(ctx context.Context, imp *bulkImport, row sheet.Row) error {
+	license := row.Get("license_number")
+	r := imp.row(row.Line, license)
+	email, phone := row.Get("email"), row.Get("phone_number")
+	if license == "" {
+		r.fail("license_number: is required")
+	}
+	imp.claim(r, "license_number", license)
+	imp.claim(r, "email", email)
+	imp.claim(r, "phone_number", phone)
+
+	doctor := &entity.Doctor{
+		FirstName:         row.Get("first_name"),
+		LastName:          row.Get("last_name"),
+		Email:             email,
+		PhoneNumber:       phone,
+		LicenseNumber:     license,
+		Specialization:    bulkInt(r, row, "specialization"),
+		YearsOfExperience: bulkInt(r, row, "years_of_experience"),
+		ConsultationFee:   bulkInt(r, row, "consultation_fee"),
+		Timezone:          row.Get("timezone"),
+		IsAvailable:       true,
+	}
+	if v := row.Get("qualifications"); v != "" {
+		doctor.Qualifications = entity.MarshalStringArray(bulkList(v))
+	}
+	if v := row.Get("languages"); v != "" {
+		doctor.Languages = entity.MarshalStringArray(bulkList(v))
+	}
+	if v := row.Get("is_available"); v != "" {
+		available, err := strconv.ParseBool(v)
+		if err != nil {
+			r.fail("is_available: invalid boolean %q", v)
+		}
+		doctor.IsAvailable = available
+	}
+	if doctor.Timezone != "" {
+		if _, err := loadLocation(doctor.Timezone); err != nil {
+			r.fail("timezone: %v", err)
+		}
+	}
+	if r.failed() {
+		return nil
+	}
+
+	existing, err := h.doctorRepo.GetByLicense(ctx, license)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to check existing license: %v", err)
+		return fmt.Errorf("failed to check existing license: %w", err)
+	}
+	for column, lookup := range map[string]func(context.Context, string) (*entity.Doctor, error){
+		"email":        h.doctorRepo.GetByEmail,
+		"phone_number": h.doctorRepo.GetByPhone,
+	} {
+		value := row.Get(column)
+		if value == "" {
+			continue
+		}
+		other, err := lookup(ctx, value)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to check existing %s: %v", column, err)
+			return fmt.Errorf("failed to check existing %s: %w", column, err)
+		}
+		if other != nil && (existing == nil || other.ID != existing.ID) {
+			r.fail("%s: already registered to the doctor with license %s", column, other.LicenseNumber)
+		}
+	}
+	if r.failed() {
+		sort.Strings(r.Errors)
+		return nil
+	}
+
+	if existing == nil {
+		if doctor.FirstName == "" || doctor.LastName == "" || email == "" || phone == "" {
+			r.fail("first_name, last_name, email and phone_number are required for a new doctor")
+			return nil
+		}
+		if doctor.Timezone == "" {
+			doctor.Timezone = entity.DefaultTimezone
+		}
+		if doctor.Qualifications == "" {
+			doctor.Qualifications = entity.MarshalStringArray(nil)
+		}
+		if doctor.Languages == "" {
+			doctor.Languages = entity.MarshalStringArray(nil)
+		}
+		r.Outcome = BulkImportCreated
+		if imp.dryRun {
+			return nil
+		}
+		if err := h.doctorRepo.Create(ctx, doctor); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to create doctor on line %d: %v", row.Line, err)
+			r.fail("failed to create doctor: %v", err)
+			return nil
+		}
+		r.ID = doctor.ID
+		return nil
+	}
+
+	r.ID = existing.ID
+	oldName := existing.FirstName + " " + existing.LastName
+	changed := bulkSet(&existing.FirstName, doctor.FirstName)
+	changed = bulkSet(&existing.LastName, doctor.LastName) || changed
+	changed = bulkSet(&existing.Email, doctor.Email) || changed
+	changed = bulkSet(&existing.PhoneNumber, doctor.PhoneNumber) || changed
+	changed = bulkSet(&existing.Qualifications, doctor.Qualifications) || changed
+	changed = bulkSet(&existing.Languages, doctor.Languages) || changed
+	changed = bulkSet(&existing.Timezone, doctor.Timezone) || changed
+	changed = bulkSetInt(&existing.Specialization, doctor.Specialization) || changed
+	changed = bulkSetInt(&existing.YearsOfExperience, doctor.YearsOfExperience) || changed
+	changed = bulkSetInt(&existing.ConsultationFee, doctor.ConsultationFee) || changed
+	if row.Get("is_available") != "" && existing.IsAvailable != doctor.IsAvailable {
+		existing.IsAvailable, changed = doctor.IsAvailable, true
+	}
+	if !changed {
+		r.Outcome = BulkImportUnchanged
+		return nil
+	}
+	r.Outcome = BulkImportUpdated
+	if imp.dryRun {
+		return nil
+	}
+
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.doctorRepo.Update(ctx, existing); err != nil {
+			return fmt.Errorf("failed to update doctor: %w", err)
+		}
+		if name := existing.FirstName + " " + existing.LastName; name != oldName {
+			if _, err := h.nameRepo.SyncName(ctx, data.NamePartyDoctor, existing.ID, name, nameSyncTargets(data.NamePartyDoctor)); err != nil {
+				return fmt.Errorf("failed to sync doctor name: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to update doctor on line %d: %v", row.Line, err)
+		r.fail("%v", err)
+	}
+	return nil
+}
+
+// bulkSchedule is the weekly availability a file gives one doctor at one
+// clinic, or outside any clinic.
+type bulkSchedule struct {
+	doctor *entity.Doctor
+	clinic *entity.Clinic
+	rows   []*BulkImportRow
+	slots  []*entity.DoctorAvailability
+}
+
+// importSchedules replaces the availability of each doctor and clinic the
+// file names with the rows given for it. A doctor's rows for a clinic are
+// applied together or not at all.
+func (h *BulkHandler) importSchedules(ctx context.Context, imp *bulkImport, rows []sheet.Row) error {
+	doctors := make(map[string]*entity.Doctor)
+	clinics := make(map[string]*entity.Clinic)
+	schedules := make(map[string]*bulkSchedule)
+	var order []*bulkSchedule
+
+	for _, row := range rows {
+		license, email := row.Get("doctor_license"), row.Get("doctor_email")
+		key := license
+		if key == "" {
+			key = email
+		}
+		r := imp.row(row.Line, key)
+
+		doctor, ok := doctors[key]
+		if !ok && key != "" {
+			var err error
+			if license != "" {
+				doctor, err = h.doctorRepo.GetByLicense(ctx, license)
+			} else {
+				doctor, err = h.doctorRepo.GetByEmail(ctx, email)
+			}
+			if err != nil {
+				h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+				return fmt.Errorf("failed to get doctor: %w", err)
+			}
+			doctors[key] = doctor
+		}
+		switch {
+		case key == "":
+			r.fail("doctor_license or doctor_email is required")
+		case doctor == nil:
+			r.fail("no doctor with license or email %q", key)
+		}
+
+		clinicID := row.Get("clinic_id")
+		clinic, ok := clinics[clinicID]
+		if !ok && clinicID != "" {
+			var err error
+			if clinic, err = h.clinicRepo.Get(ctx, clinicID); err != nil {
+				h.log.WithContext(ctx).Errorf("Failed to get clinic: %v", err)
+				return fmt.Errorf("failed to get clinic: %w", err)
+			}
+			clinics[clinicID] = clinic
+		}
+		if clinicID != "" && clinic == nil {
+			r.fail("clinic_id: no clinic %q", clinicID)
+		}
+
+		slot := &requestpb.AvailabilitySlot{
+			DayOfWeek:           bulkWeekday(r, row.Get("day_of_week")),
+			StartTime:           row.Get("start_time"),
+			EndTime:             row.Get("end_time"),
+			SlotDurationMinutes: bulkInt(r, row, "slot_duration_minutes"),
+		}
+		if slot.SlotDurationMinutes == 0 {
+			slot.SlotDurationMinutes = entity.DefaultSlotDurationMinutes
+		}
+		if slot.SlotDurationMinutes < 0 {
+			r.fail("slot_duration_minutes: must be positive")
+		}
+		startErr, endErr := validateClock(slot.StartTime), validateClock(slot.EndTime)
+		for column, err := range map[string]error{"start_time": startErr, "end_time": endErr} {
+			if err != nil {
+				r.fail("%s: %v", column, err)
+			}
+		}
+		if startErr == nil && endErr == nil && slot.StartTime >= slot.EndTime {
+			r.fail("start_time must be before end_time")
+		}
+		if clinic != nil && !r.failed() && !withinOpeningHours(entity.UnmarshalOpeningHours(clinic.OpeningHours), slot) {
+			r.fail("%s %s-%s is outside the clinic's opening hours", slot.DayOfWeek, slot.StartTime, slot.EndTime)
+		}
+		sort.Strings(r.Errors)
+		if doctor == nil {
+			continue
+		}
+
+		scheduleKey := doctor.ID + "/" + clinicID
+		s, ok := schedules[scheduleKey]
+		if !ok {
+			s = &bulkSchedule{doctor: doctor, clinic: clinic}
+			schedules[scheduleKey] = s
+			order = append(order, s)
+		}
+		s.rows = append(s.rows, r)
+		s.slots = append(s.slots, &entity.DoctorAvailability{
+			DayOfWeek:           slot.DayOfWeek,
+			StartTime:           slot.StartTime,
+			EndTime:             slot.EndTime,
+			SlotDurationMinutes: slot.SlotDurationMinutes,
+		})
+	}
+
+	for _, s := range order {
+		if err := h.applySchedule(ctx, imp, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *BulkHandler) applySchedule(ctx context.Context, imp *bulkImport, s *bulkSchedule) error {
+	var failedLines []string
+	for _, r := range s.rows {
+		if r.failed() {
+			failedLines = append(failedLines, strconv.Itoa(r.Line))
+		}
+	}
+	if len(failedLines) > 0 {
+		for _, r := range s.rows {
+			if !r.failed() {
+				r.fail("not applied: this schedule has errors on line %s", strings.Join(failedLines, ", "))
+			}
+		}
+		return nil
+	}
+
+	clinicID := ""
+	if s.clinic != nil {
+		clinicID = s.clinic.ID
+	}
+	current, err := h.doctorRepo.GetAvailability(ctx, s.doctor.ID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get availability: %v", err)
+		return fmt.Errorf("failed to get availability: %w", err)
+	}
+	var existing []*entity.DoctorAvailability
+	for _, a := range current {
+		if a.ClinicID == clinicID {
+			existing = append(existing, a)
+		}
+	}
+
+	outcome := BulkImportUpdated
+	switch {
+	case len(existing) == 0:
+		outcome = BulkImportCreated
+	case scheduleSignature(existing) == scheduleSignature(s.slots):
+		outcome = BulkImportUnchanged
+	}
+	if outcome != BulkImportUnchanged && !imp.dryRun {
+		if err := h.doctorRepo.SetAvailability(ctx, s.doctor.ID, clinicID, s.slots); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to set availability of doctor %s: %v", s.doctor.ID, err)
+			for _, r := range s.rows {
+				r.fail("failed to set availability: %v", err)
+			}
+			return nil
+		}
+	}
+	for _, r := range s.rows {
+		r.Outcome, r.ID = outcome, s.doctor.ID
+	}
+	return nil
+}
+
+// scheduleSignature describes availability templates independently of
+// their order, for telling whether an import changes them.
+func scheduleSignature(slots []*entity.DoctorAvailability) string {
+	parts := make([]string, len(slots))
+	for i, s := range slots {
+		parts[i] = fmt.Sprintf("%s %s-%s/%d", strings.ToLower(s.DayOfWeek), s.StartTime, s.EndTime, s.SlotDurationMinutes)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
+
+// bulkWeekday normalizes a day of week to its English name. An empty day is
+// kept: the template then applies to every day.
+func bulkWeekday(r *BulkImportRow, v string) string {
+	if v == "" {
+		return ""
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(v, d.String()) || strings.EqualFold(v, d.String()[:3]) {
+			return d.String()
+		}
+	}
+	r.fail("day_of_week: unknown day %q", v)
+	return v
+}
+
+// bulkGender reads a gender as a name, a single letter or its numeric code.
+func bulkGender(v string) int32 {
+	for g, name := range fhirGenders {
+		if strings.EqualFold(v, name) || strings.EqualFold(v, name[:1]) || v == strconv.Itoa(int(g)) {
+			return g
+		}
+	}
+	return 0
+}
+
+// bulkInt reads a whole number column, failing the row when it is not one.
+// An empty cell is zero.
+func bulkInt(r *BulkImportRow, row sheet.Row, column string) int32 {
+	v := row.Get(column)
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.ParseInt(strings.TrimSuffix(v, ".0"), 10, 32)
+	if err != nil {
+		r.fail("%s: invalid number %q", column, v)
+	}
+	return int32(n)
+}
+
+// bulkList splits a cell of semicolon separated values.
+func bulkList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func bulkAddress(row sheet.Row) string {
+	addr := &entity.Address{
+		Street:  row.Get("street"),
+		City:    row.Get("city"),
+		State:   row.Get("state"),
+		ZipCode: row.Get("zip_code"),
+		Country: row.Get("country"),
+	}
+	if *addr == (entity.Address{}) {
+		return ""
+	}
+	return entity.MarshalAddress(addr)
+}
+
+// bulkSet sets *field to v unless v is empty, reporting whether that changed
+// it.
+func bulkSet(field *string, v string) bool {
+	if v == "" || *field == v {
+		return false
+	}
+	*field = v
+	return true
+}
+
+func bulkSetInt(field *int32, v int32) bool {
+	if v == 0 || *field == v {
+		return false
+	}
+	*field = v
+	return true
+}
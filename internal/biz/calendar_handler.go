@@ -0,0 +1,231 @@
+package biz
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+type CalendarFeedResponse struct {
+	OwnerType string `json:"owner_type"`
+	OwnerID   string `json:"owner_id"`
+	Token     string `json:"token"`
+	FeedPath  string `json:"feed_path"`
+	CreatedAt string `json:"created_at"`
+}
+
+type CalendarHandler struct {
+	feedRepo        data.CalendarFeedRepo
+	appointmentRepo data.AppointmentRepo
+	patientRepo     data.PatientRepo
+	doctorRepo      data.DoctorRepo
+	clinicRepo      data.ClinicRepo
+	log             *log.Helper
+}
+
+func NewCalendarHandler(
+	feedRepo data.CalendarFeedRepo,
+	appointmentRepo data.AppointmentRepo,
+	patientRepo data.PatientRepo,
+	doctorRepo data.DoctorRepo,
+	clinicRepo data.ClinicRepo,
+	logger log.Logger,
+) *CalendarHandler {
+	return &CalendarHandler{
+		feedRepo:        feedRepo,
+		appointmentRepo: appointmentRepo,
+		patientRepo:     patientRepo,
+		doctorRepo:      doctorRepo,
+		clinicRepo:      clinicRepo,
+		log:             log.NewHelper(logger),
+	}
+}
+
+// IssueFeedToken creates a new secret feed token for a doctor or patient,
+// revoking the previous one.
+func (h *CalendarHandler) IssueFeedToken(ctx context.Context, ownerType, ownerID string) (*CalendarFeedResponse, error) {
+	ctx, span := otel.Trace(ctx, "CalendarHandler.IssueFeedToken")
+	defer span.End()
+
+	if ownerID == "" {
+		h.log.WithContext(ctx).Errorf("Owner ID is required")
+		return nil, fmt.Errorf("%s_id is required", ownerType)
+	}
+
+	switch ownerType {
+	case entity.CalendarOwnerDoctor:
+		doctor, err := h.doctorRepo.Get(ctx, ownerID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+			return nil, fmt.Errorf("failed to get doctor: %w", err)
+		}
+		if doctor == nil {
+			h.log.WithContext(ctx).Errorf("Doctor not found: %s", ownerID)
+			return nil, fmt.Errorf("doctor not found")
+		}
+	case entity.CalendarOwnerPatient:
+		patient, err := h.patientRepo.Get(ctx, ownerID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+			return nil, fmt.Errorf("failed to get patient: %w", err)
+		}
+		if patient == nil {
+			h.log.WithContext(ctx).Errorf("Patient not found: %s", ownerID)
+			return nil, fmt.Errorf("patient not found")
+		}
+		ownerID = patient.ID
+	default:
+		return nil, fmt.Errorf("unsupported calendar owner type %q", ownerType)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to generate feed token: %v", err)
+		return nil, fmt.Errorf("failed to generate feed token: %w", err)
+	}
+
+	feed := &entity.CalendarFeed{
+		OwnerType: ownerType,
+		OwnerID:   ownerID,
+		Token:     hex.EncodeToString(secret),
+	}
+	if err := h.feedRepo.Replace(ctx, feed); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to store feed token: %v", err)
+		return nil, fmt.Errorf("failed to store feed token: %w", err)
+	}
+
+	return &CalendarFeedResponse{
+		OwnerType: feed.OwnerType,
+		OwnerID:   feed.OwnerID,
+		Token:     feed.Token,
+		FeedPath:  "/v1/medical/calendar/" + feed.Token + ".ics",
+		CreatedAt: formatTimestamp(feed.CreatedAt),
+	}, nil
+}
+
+// Feed renders the calendar behind a feed token: every appointment of the
+// token's doctor or patient, cancelled ones included so that subscribed
+// calendars drop them.
+func (h *CalendarHandler) Feed(ctx context.Context, token string) ([]byte, error) {
+	ctx, span := otel.Trace(ctx, "CalendarHandler.Feed")
+	defer span.End()
+
+	if token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+
+	feed, err := h.feedRepo.GetByToken(ctx, token)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get calendar feed: %v", err)
+		return nil, fmt.Errorf("failed to get calendar feed: %w", err)
+	}
+	if feed == nil {
+		h.log.WithContext(ctx).Errorf("Unknown calendar feed token")
+		return nil, fmt.Errorf("calendar feed not found")
+	}
+
+	var (
+		name         string
+		appointments []*entity.Appointment
+	)
+	filters := make(map[string]interface{})
+	if feed.OwnerType == entity.CalendarOwnerDoctor {
+		name = "Appointments"
+		if doctor, err := h.doctorRepo.Get(ctx, feed.OwnerID); err == nil && doctor != nil {
+			name = "Dr. " + doctor.FirstName + " " + doctor.LastName + " - Appointments"
+		}
+		appointments, err = h.appointmentRepo.GetByDoctorID(ctx, feed.OwnerID, filters)
+	} else {
+		name = "My appointments"
+		appointments, err = h.appointmentRepo.GetByPatientID(ctx, feed.OwnerID, filters)
+	}
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get appointments: %v", err)
+		return nil, fmt.Errorf("failed to get appointments: %w", err)
+	}
+
+	locations := make(map[string]string)
+	var events []icalEvent
+	for _, apt := range appointments {
+		events = append(events, appointmentEvent(apt, h.summary(apt, feed.OwnerType), h.location(ctx, apt, locations)))
+	}
+
+	return renderCalendar(name, events, time.Now()), nil
+}
+
+// AppointmentICS renders a single appointment as a downloadable calendar file.
+func (h *CalendarHandler) AppointmentICS(ctx context.Context, appointmentID string) ([]byte, error) {
+	ctx, span := otel.Trace(ctx, "CalendarHandler.AppointmentICS")
+	defer span.End()
+
+	if appointmentID == "" {
+		h.log.WithContext(ctx).Errorf("Appointment ID is required")
+		return nil, fmt.Errorf("appointment_id is required")
+	}
+
+	apt, err := h.appointmentRepo.Get(ctx, appointmentID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get appointment: %v", err)
+		return nil, fmt.Errorf("failed to get appointment: %w", err)
+	}
+	if apt == nil {
+		h.log.WithContext(ctx).Errorf("Appointment not found: %s", appointmentID)
+		return nil, fmt.Errorf("appointment not found")
+	}
+
+	event := appointmentEvent(apt, h.summary(apt, entity.CalendarOwnerPatient), h.location(ctx, apt, make(map[string]string)))
+	event.Description = apt.ReasonForVisit
+	return renderCalendar("", []icalEvent{event}, time.Now()), nil
+}
+
+func (h *CalendarHandler) summary(apt *entity.Appointment, ownerType string) string {
+	if ownerType == entity.CalendarOwnerDoctor {
+		return "Appointment with " + apt.PatientName
+	}
+	return "Appointment with Dr. " + apt.DoctorName
+}
+
+// location describes where the appointment takes place, caching clinic
+// lookups in cache.
+func (h *CalendarHandler) location(ctx context.Context, apt *entity.Appointment, cache map[string]string) string {
+	switch apt.ConsultationType {
+	case entity.ConsultationTypeVideo:
+		return "Video consultation"
+	case entity.ConsultationTypePhone:
+		return "Phone consultation"
+	}
+	if apt.ClinicID == "" {
+		return ""
+	}
+
+	if loc, ok := cache[apt.ClinicID]; ok {
+		return loc
+	}
+
+	var loc string
+	clinic, err := h.clinicRepo.Get(ctx, apt.ClinicID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get clinic %s: %v", apt.ClinicID, err)
+	}
+	if clinic != nil {
+		parts := []string{clinic.Name}
+		if addr := entity.UnmarshalAddress(clinic.Address); addr != nil {
+			for _, p := range []string{addr.Street, addr.City, addr.State, addr.ZipCode, addr.Country} {
+				if p != "" {
+					parts = append(parts, p)
+				}
+			}
+		}
+		loc = strings.Join(parts, ", ")
+	}
+	cache[apt.ClinicID] = loc
+	return loc
+}
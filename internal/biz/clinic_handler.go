@@ -0,0 +1,395 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+type ClinicRequest struct {
+	ClinicID     string                 `json:"clinic_id,omitempty"`
+	Name         string                 `json:"name"`
+	PhoneNumber  string                 `json:"phone_number"`
+	Address      *entity.Address        `json:"address,omitempty"`
+	Timezone     string                 `json:"timezone"`
+	OpeningHours []*entity.OpeningHours `json:"opening_hours"`
+	IsActive     *bool                  `json:"is_active,omitempty"`
+}
+
+type ClinicResponse struct {
+	ClinicID     string                 `json:"clinic_id"`
+	Name         string                 `json:"name"`
+	PhoneNumber  string                 `json:"phone_number"`
+	Address      *entity.Address        `json:"address,omitempty"`
+	Timezone     string                 `json:"timezone"`
+	OpeningHours []*entity.OpeningHours `json:"opening_hours"`
+	IsActive     bool                   `json:"is_active"`
+	Rooms        []*RoomResponse        `json:"rooms,omitempty"`
+	CreatedAt    string                 `json:"created_at"`
+	UpdatedAt    string                 `json:"updated_at"`
+}
+
+type ListClinicsResponse struct {
+	Clinics []*ClinicResponse `json:"clinics"`
+}
+
+type RoomRequest struct {
+	ClinicID string `json:"clinic_id,omitempty"`
+	Name     string `json:"name"`
+}
+
+type RoomResponse struct {
+	RoomID   string `json:"room_id"`
+	ClinicID string `json:"clinic_id"`
+	Name     string `json:"name"`
+	IsActive bool   `json:"is_active"`
+}
+
+type EquipmentRequest struct {
+	ClinicID string `json:"clinic_id,omitempty"`
+	RoomID   string `json:"room_id,omitempty"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+}
+
+type EquipmentResponse struct {
+	EquipmentID string `json:"equipment_id"`
+	ClinicID    string `json:"clinic_id"`
+	RoomID      string `json:"room_id,omitempty"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	IsActive    bool   `json:"is_active"`
+}
+
+type ListEquipmentResponse struct {
+	Equipment []*EquipmentResponse `json:"equipment"`
+}
+
+type ClinicHandler struct {
+	repo         data.ClinicRepo
+	resourceRepo data.ResourceRepo
+	log          *log.Helper
+}
+
+func NewClinicHandler(repo data.ClinicRepo, resourceRepo data.ResourceRepo, logger log.Logger) *ClinicHandler {
+	return &ClinicHandler{
+		repo:         repo,
+		resourceRepo: resourceRepo,
+		log:          log.NewHelper(logger),
+	}
+}
+
+func (h *ClinicHandler) CreateClinic(ctx context.Context, req *ClinicRequest) (*ClinicResponse, error) {
+	ctx, span := otel.Trace(ctx, "ClinicHandler.CreateClinic")
+	defer span.End()
+
+	if req.Name == "" {
+		h.log.WithContext(ctx).Errorf("Clinic name is required")
+		return nil, fmt.Errorf("name is required")
+	}
+	loc, err := loadLocation(req.Timezone)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid clinic timezone: %v", err)
+		return nil, err
+	}
+	if err := validateOpeningHours(req.OpeningHours); err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid opening hours: %v", err)
+		return nil, err
+	}
+
+	clinic := &entity.Clinic{
+		Name:         req.Name,
+		PhoneNumber:  req.PhoneNumber,
+		Address:      entity.MarshalAddress(req.Address),
+		Timezone:     loc.String(),
+		OpeningHours: entity.MarshalOpeningHours(req.OpeningHours),
+		IsActive:     true,
+	}
+
+	if err := h.repo.Create(ctx, clinic); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to create clinic: %v", err)
+		return nil, fmt.Errorf("failed to create clinic: %w", err)
+	}
+
+	return h.entityToResponse(clinic, nil), nil
+}
+
+func (h *ClinicHandler) GetClinic(ctx context.Context, id string) (*ClinicResponse, error) {
+	ctx, span := otel.Trace(ctx, "ClinicHandler.GetClinic")
+	defer span.End()
+
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("Clinic ID is required")
+		return nil, fmt.Errorf("clinic_id is required")
+	}
+
+	clinic, err := h.repo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get clinic: %v", err)
+		return nil, fmt.Errorf("failed to get clinic: %w", err)
+	}
+	if clinic == nil {
+		return nil, fmt.Errorf("clinic not found")
+	}
+
+	rooms, err := h.repo.GetRooms(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get rooms: %v", err)
+		return nil, fmt.Errorf("failed to get rooms: %w", err)
+	}
+
+	return h.entityToResponse(clinic, rooms), nil
+}
+
+func (h *ClinicHandler) UpdateClinic(ctx context.Context, id string, req *ClinicRequest) (*ClinicResponse, error) {
+	ctx, span := otel.Trace(ctx, "ClinicHandler.UpdateClinic")
+	defer span.End()
+
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("Clinic ID is required")
+		return nil, fmt.Errorf("clinic_id is required")
+	}
+
+	clinic, err := h.repo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get clinic: %v", err)
+		return nil, fmt.Errorf("failed to get clinic: %w", err)
+	}
+	if clinic == nil {
+		h.log.WithContext(ctx).Errorf("Clinic not found: %s", id)
+		return nil, fmt.Errorf("clinic not found")
+	}
+
+	if req.Name != "" {
+		clinic.Name = req.Name
+	}
+	if req.PhoneNumber != "" {
+		clinic.PhoneNumber = req.PhoneNumber
+	}
+	if req.Address != nil {
+		clinic.Address = entity.MarshalAddress(req.Address)
+	}
+	if req.Timezone != "" {
+		loc, err := loadLocation(req.Timezone)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid clinic timezone: %v", err)
+			return nil, err
+		}
+		clinic.Timezone = loc.String()
+	}
+	if req.OpeningHours != nil {
+		if err := validateOpeningHours(req.OpeningHours); err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid opening hours: %v", err)
+			return nil, err
+		}
+		clinic.OpeningHours = entity.MarshalOpeningHours(req.OpeningHours)
+	}
+	if req.IsActive != nil {
+		clinic.IsActive = *req.IsActive
+	}
+
+	if err := h.repo.Update(ctx, clinic); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to update clinic: %v", err)
+		return nil, fmt.Errorf("failed to update clinic: %w", err)
+	}
+
+	return h.entityToResponse(clinic, nil), nil
+}
+
+func (h *ClinicHandler) ListClinics(ctx context.Context, name string) (*ListClinicsResponse, error) {
+	ctx, span := otel.Trace(ctx, "ClinicHandler.ListClinics")
+	defer span.End()
+
+	filters := make(map[string]interface{})
+	if name != "" {
+		filters["name"] = name
+	}
+
+	clinics, err := h.repo.List(ctx, filters)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list clinics: %v", err)
+		return nil, fmt.Errorf("failed to list clinics: %w", err)
+	}
+
+	resp := &ListClinicsResponse{}
+	for _, c := range clinics {
+		resp.Clinics = append(resp.Clinics, h.entityToResponse(c, nil))
+	}
+
+	return resp, nil
+}
+
+func (h *ClinicHandler) AddRoom(ctx context.Context, clinicID string, req *RoomRequest) (*RoomResponse, error) {
+	ctx, span := otel.Trace(ctx, "ClinicHandler.AddRoom")
+	defer span.End()
+
+	if clinicID == "" || req.Name == "" {
+		h.log.WithContext(ctx).Errorf("Clinic ID and room name are required")
+		return nil, fmt.Errorf("clinic_id and name are required")
+	}
+
+	clinic, err := h.repo.Get(ctx, clinicID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get clinic: %v", err)
+		return nil, fmt.Errorf("failed to get clinic: %w", err)
+	}
+	if clinic == nil {
+		h.log.WithContext(ctx).Errorf("Clinic not found: %s", clinicID)
+		return nil, fmt.Errorf("clinic not found")
+	}
+
+	room := &entity.Room{
+		ClinicID: clinicID,
+		Name:     req.Name,
+		IsActive: true,
+	}
+
+	if err := h.repo.CreateRoom(ctx, room); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to create room: %v", err)
+		return nil, fmt.Errorf("failed to create room: %w", err)
+	}
+
+	return roomToResponse(room), nil
+}
+
+// AddEquipment registers a piece of equipment at a clinic. Equipment with a
+// room ID is installed in that room; equipment without one is portable.
+func (h *ClinicHandler) AddEquipment(ctx context.Context, clinicID string, req *EquipmentRequest) (*EquipmentResponse, error) {
+	ctx, span := otel.Trace(ctx, "ClinicHandler.AddEquipment")
+	defer span.End()
+
+	if clinicID == "" || req.Type == "" {
+		h.log.WithContext(ctx).Errorf("Clinic ID and equipment type are required")
+		return nil, fmt.Errorf("clinic_id and type are required")
+	}
+
+	clinic, err := h.repo.Get(ctx, clinicID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get clinic: %v", err)
+		return nil, fmt.Errorf("failed to get clinic: %w", err)
+	}
+	if clinic == nil {
+		h.log.WithContext(ctx).Errorf("Clinic not found: %s", clinicID)
+		return nil, fmt.Errorf("clinic not found")
+	}
+
+	if req.RoomID != "" {
+		rooms, err := h.repo.GetRooms(ctx, clinicID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get rooms: %v", err)
+			return nil, fmt.Errorf("failed to get rooms: %w", err)
+		}
+		found := false
+		for _, r := range rooms {
+			if r.ID == req.RoomID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			h.log.WithContext(ctx).Errorf("Room %s not found in clinic %s", req.RoomID, clinicID)
+			return nil, fmt.Errorf("room not found")
+		}
+	}
+
+	equipment := &entity.Equipment{
+		ClinicID: clinicID,
+		RoomID:   req.RoomID,
+		Type:     strings.ToLower(req.Type),
+		Name:     req.Name,
+		IsActive: true,
+	}
+
+	if err := h.resourceRepo.CreateEquipment(ctx, equipment); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to create equipment: %v", err)
+		return nil, fmt.Errorf("failed to create equipment: %w", err)
+	}
+
+	return equipmentToResponse(equipment), nil
+}
+
+func (h *ClinicHandler) ListEquipment(ctx context.Context, clinicID string) (*ListEquipmentResponse, error) {
+	ctx, span := otel.Trace(ctx, "ClinicHandler.ListEquipment")
+	defer span.End()
+
+	if clinicID == "" {
+		h.log.WithContext(ctx).Errorf("Clinic ID is required")
+		return nil, fmt.Errorf("clinic_id is required")
+	}
+
+	equipment, err := h.resourceRepo.GetEquipment(ctx, clinicID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get equipment: %v", err)
+		return nil, fmt.Errorf("failed to get equipment: %w", err)
+	}
+
+	resp := &ListEquipmentResponse{}
+	for _, e := range equipment {
+		resp.Equipment = append(resp.Equipment, equipmentToResponse(e))
+	}
+
+	return resp, nil
+}
+
+func validateOpeningHours(hours []*entity.OpeningHours) error {
+	for _, oh := range hours {
+		if oh.DayOfWeek == "" {
+			return fmt.Errorf("day_of_week is required for opening hours")
+		}
+		if err := validateClock(oh.OpenTime); err != nil {
+			return err
+		}
+		if err := validateClock(oh.CloseTime); err != nil {
+			return err
+		}
+		if oh.OpenTime >= oh.CloseTime {
+			return fmt.Errorf("open_time must be before close_time for %s", oh.DayOfWeek)
+		}
+	}
+	return nil
+}
+
+func (h *ClinicHandler) entityToResponse(clinic *entity.Clinic, rooms []*entity.Room) *ClinicResponse {
+	resp := &ClinicResponse{
+		ClinicID:     clinic.ID,
+		Name:         clinic.Name,
+		PhoneNumber:  clinic.PhoneNumber,
+		Address:      entity.UnmarshalAddress(clinic.Address),
+		Timezone:     clinic.Timezone,
+		OpeningHours: entity.UnmarshalOpeningHours(clinic.OpeningHours),
+		IsActive:     clinic.IsActive,
+		CreatedAt:    formatTimestamp(clinic.CreatedAt),
+		UpdatedAt:    formatTimestamp(clinic.UpdatedAt),
+	}
+
+	for _, r := range rooms {
+		resp.Rooms = append(resp.Rooms, roomToResponse(r))
+	}
+
+	return resp
+}
+
+func roomToResponse(room *entity.Room) *RoomResponse {
+	return &RoomResponse{
+		RoomID:   room.ID,
+		ClinicID: room.ClinicID,
+		Name:     room.Name,
+		IsActive: room.IsActive,
+	}
+}
+
+func equipmentToResponse(equipment *entity.Equipment) *EquipmentResponse {
+	return &EquipmentResponse{
+		EquipmentID: equipment.ID,
+		ClinicID:    equipment.ClinicID,
+		RoomID:      equipment.RoomID,
+		Type:        equipment.Type,
+		Name:        equipment.Name,
+		IsActive:    equipment.IsActive,
+	}
+}
@@ -13,15 +13,36 @@ import (
 	"github.com/go-kratos/kratos/v2/log"
 )
 
+type RenameDoctorRequest struct {
+	DoctorID  string `json:"doctor_id,omitempty"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
 type DoctorHandler struct {
-	repo data.DoctorRepo
-	log  *log.Helper
+	repo            data.DoctorRepo
+	clinicRepo      data.ClinicRepo
+	appointmentRepo data.AppointmentRepo
+	nameRepo        data.NameSyncRepo
+	tx              data.Transaction
+	log             *log.Helper
 }
 
-func NewDoctorHandler(repo data.DoctorRepo, logger log.Logger) *DoctorHandler {
+func NewDoctorHandler(
+	repo data.DoctorRepo,
+	clinicRepo data.ClinicRepo,
+	appointmentRepo data.AppointmentRepo,
+	nameRepo data.NameSyncRepo,
+	tx data.Transaction,
+	logger log.Logger,
+) *DoctorHandler {
 	return &DoctorHandler{
-		repo: repo,
-		log:  log.NewHelper(logger),
+		repo:            repo,
+		clinicRepo:      clinicRepo,
+		appointmentRepo: appointmentRepo,
+		nameRepo:        nameRepo,
+		tx:              tx,
+		log:             log.NewHelper(logger),
 	}
 }
 
@@ -146,6 +167,61 @@ func (h *DoctorHandler) UpdateDoctor(ctx context.Context, id string, req *reques
 	return h.entityToProto(doctor), nil
 }
 
+// RenameDoctor changes the doctor's name and propagates it to the rows that
+// copy it, as far as nameSyncTargets allows, in one transaction.
+func (h *DoctorHandler) RenameDoctor(ctx context.Context, req *RenameDoctorRequest) (*responsepb.DoctorResponse, error) {
+	ctx, span := otel.Trace(ctx, "DoctorHandler.RenameDoctor")
+	defer span.End()
+
+	if req.DoctorID == "" {
+		h.log.WithContext(ctx).Errorf("Doctor ID is required")
+		return nil, fmt.Errorf("doctor_id is required")
+	}
+	if req.FirstName == "" || req.LastName == "" {
+		h.log.WithContext(ctx).Errorf("First name and last name are required")
+		return nil, fmt.Errorf("first_name and last_name are required")
+	}
+
+	var doctor *entity.Doctor
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.repo.Lock(ctx, req.DoctorID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to lock doctor: %v", err)
+			return fmt.Errorf("failed to lock doctor: %w", err)
+		}
+
+		var err error
+		doctor, err = h.repo.Get(ctx, req.DoctorID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+			return fmt.Errorf("failed to get doctor: %w", err)
+		}
+		if doctor == nil {
+			h.log.WithContext(ctx).Errorf("Doctor not found: %s", req.DoctorID)
+			return fmt.Errorf("doctor not found")
+		}
+
+		doctor.FirstName = req.FirstName
+		doctor.LastName = req.LastName
+		if err := h.repo.Update(ctx, doctor); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to update doctor: %v", err)
+			return fmt.Errorf("failed to update doctor: %w", err)
+		}
+
+		updated, err := h.nameRepo.SyncName(ctx, data.NamePartyDoctor, doctor.ID, doctor.FirstName+" "+doctor.LastName, nameSyncTargets(data.NamePartyDoctor))
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to sync doctor name: %v", err)
+			return fmt.Errorf("failed to sync doctor name: %w", err)
+		}
+		h.log.WithContext(ctx).Infof("Synced name of doctor %s: %v", doctor.ID, updated)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return h.entityToProto(doctor), nil
+}
+
 func (h *DoctorHandler) SearchDoctors(ctx context.Context, req *requestpb.SearchDoctorsRequest) ([]*responsepb.DoctorResponse, error) {
 	ctx, span := otel.Trace(ctx, "DoctorHandler.SearchDoctors")
 	defer span.End()
@@ -162,6 +238,33 @@ func (h *DoctorHandler) SearchDoctors(ctx context.Context, req *requestpb.Search
 		filters["is_available"] = req.GetIsAvailable()
 	}
 
+	return h.searchDoctors(ctx, filters)
+}
+
+func (h *DoctorHandler) SearchClinicDoctors(ctx context.Context, clinicID string, req *requestpb.SearchDoctorsRequest) ([]*responsepb.DoctorResponse, error) {
+	ctx, span := otel.Trace(ctx, "DoctorHandler.SearchClinicDoctors")
+	defer span.End()
+
+	if clinicID == "" {
+		h.log.WithContext(ctx).Errorf("Clinic ID is required")
+		return nil, fmt.Errorf("clinic_id is required")
+	}
+
+	filters := map[string]interface{}{"clinic_id": clinicID}
+	if req.GetName() != "" {
+		filters["name"] = req.GetName()
+	}
+	if req.Specialization != nil && req.GetSpecialization() > 0 {
+		filters["specialization"] = int32(req.GetSpecialization())
+	}
+	if req.IsAvailable != nil {
+		filters["is_available"] = req.GetIsAvailable()
+	}
+
+	return h.searchDoctors(ctx, filters)
+}
+
+func (h *DoctorHandler) searchDoctors(ctx context.Context, filters map[string]interface{}) ([]*responsepb.DoctorResponse, error) {
 	doctors, err := h.repo.Search(ctx, filters)
 	if err != nil {
 		h.log.WithContext(ctx).Errorf("Failed to search doctors: %v", err)
@@ -180,6 +283,32 @@ func (h *DoctorHandler) SetAvailability(ctx context.Context, doctorID string, sl
 	ctx, span := otel.Trace(ctx, "DoctorHandler.SetAvailability")
 	defer span.End()
 
+	return h.setAvailability(ctx, doctorID, nil, slots)
+}
+
+func (h *DoctorHandler) SetClinicAvailability(ctx context.Context, clinicID, doctorID string, slots []*requestpb.AvailabilitySlot) (*responsepb.DoctorAvailabilityResponse, error) {
+	ctx, span := otel.Trace(ctx, "DoctorHandler.SetClinicAvailability")
+	defer span.End()
+
+	if clinicID == "" {
+		h.log.WithContext(ctx).Errorf("Clinic ID is required")
+		return nil, fmt.Errorf("clinic_id is required")
+	}
+
+	clinic, err := h.clinicRepo.Get(ctx, clinicID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get clinic: %v", err)
+		return nil, fmt.Errorf("failed to get clinic: %w", err)
+	}
+	if clinic == nil {
+		h.log.WithContext(ctx).Errorf("Clinic not found: %s", clinicID)
+		return nil, fmt.Errorf("clinic not found")
+	}
+
+	return h.setAvailability(ctx, doctorID, clinic, slots)
+}
+
+func (h *DoctorHandler) setAvailability(ctx context.Context, doctorID string, clinic *entity.Clinic, slots []*requestpb.AvailabilitySlot) (*responsepb.DoctorAvailabilityResponse, error) {
 	if doctorID == "" {
 		h.log.WithContext(ctx).Errorf("Doctor ID is required")
 		return nil, fmt.Errorf("doctor_id is required")
@@ -197,6 +326,19 @@ func (h *DoctorHandler) SetAvailability(ctx context.Context, doctorID string, sl
 
 	var entitySlots []*entity.DoctorAvailability
 	for _, slot := range slots {
+		if err := validateClock(slot.StartTime); err != nil {
+			return nil, err
+		}
+		if err := validateClock(slot.EndTime); err != nil {
+			return nil, err
+		}
+		if slot.StartTime >= slot.EndTime {
+			return nil, fmt.Errorf("start_time must be before end_time for %s", slot.DayOfWeek)
+		}
+		if clinic != nil && !withinOpeningHours(entity.UnmarshalOpeningHours(clinic.OpeningHours), slot) {
+			h.log.WithContext(ctx).Errorf("Availability %s %s-%s outside opening hours of clinic %s", slot.DayOfWeek, slot.StartTime, slot.EndTime, clinic.ID)
+			return nil, fmt.Errorf("availability on %s %s-%s is outside the clinic's opening hours", slot.DayOfWeek, slot.StartTime, slot.EndTime)
+		}
 		entitySlots = append(entitySlots, &entity.DoctorAvailability{
 			DayOfWeek:           slot.DayOfWeek,
 			StartTime:           slot.StartTime,
@@ -205,7 +347,11 @@ func (h *DoctorHandler) SetAvailability(ctx context.Context, doctorID string, sl
 		})
 	}
 
-	if err := h.repo.SetAvailability(ctx, doctorID, entitySlots); err != nil {
+	clinicID := ""
+	if clinic != nil {
+		clinicID = clinic.ID
+	}
+	if err := h.repo.SetAvailability(ctx, doctorID, clinicID, entitySlots); err != nil {
 		h.log.WithContext(ctx).Errorf("Failed to set availability: %v", err)
 		return nil, fmt.Errorf("failed to set availability: %w", err)
 	}
@@ -254,6 +400,44 @@ func (h *DoctorHandler) GetDoctorAvailability(ctx context.Context, doctorID stri
 	}, nil
 }
 
+type DoctorTimezone struct {
+	DoctorID string `json:"doctor_id"`
+	Timezone string `json:"timezone"`
+}
+
+func (h *DoctorHandler) SetDoctorTimezone(ctx context.Context, doctorID, timezone string) (*DoctorTimezone, error) {
+	ctx, span := otel.Trace(ctx, "DoctorHandler.SetDoctorTimezone")
+	defer span.End()
+
+	if doctorID == "" {
+		h.log.WithContext(ctx).Errorf("Doctor ID is required")
+		return nil, fmt.Errorf("doctor_id is required")
+	}
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid timezone: %v", err)
+		return nil, err
+	}
+
+	doctor, err := h.repo.Get(ctx, doctorID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", doctorID)
+		return nil, fmt.Errorf("doctor not found")
+	}
+
+	doctor.Timezone = loc.String()
+	if err := h.repo.Update(ctx, doctor); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to update doctor timezone: %v", err)
+		return nil, fmt.Errorf("failed to update doctor timezone: %w", err)
+	}
+
+	return &DoctorTimezone{DoctorID: doctor.ID, Timezone: doctor.Timezone}, nil
+}
+
 func (h *DoctorHandler) entityToProto(doctor *entity.Doctor) *responsepb.DoctorResponse {
 	return &responsepb.DoctorResponse{
 		DoctorId:           doctor.ID,
@@ -270,7 +454,7 @@ func (h *DoctorHandler) entityToProto(doctor *entity.Doctor) *responsepb.DoctorR
 		IsAvailable:        doctor.IsAvailable,
 		AverageRating:      doctor.AverageRating,
 		TotalConsultations: doctor.TotalConsultations,
-		CreatedAt:          doctor.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt:          doctor.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		CreatedAt:          formatTimestamp(doctor.CreatedAt),
+		UpdatedAt:          formatTimestamp(doctor.UpdatedAt),
 	}
 }
@@ -0,0 +1,321 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+)
+
+const (
+	defaultDirectoryLimit = 50
+	maxDirectoryLimit     = 200
+	// maxDirectoryCandidates bounds the matches ranked in memory when sorting
+	// by relevance or next available slot.
+	maxDirectoryCandidates = 500
+)
+
+type DoctorSearchRequest struct {
+	Query            string  `json:"q"`
+	Name             string  `json:"name"`
+	Specialization   int32   `json:"specialization"`
+	IsAvailable      *bool   `json:"is_available"`
+	ClinicID         string  `json:"clinic_id"`
+	City             string  `json:"city"`
+	Language         string  `json:"language"`
+	MinFee           int32   `json:"min_fee"`
+	MaxFee           int32   `json:"max_fee"`
+	MinExperience    int32   `json:"min_experience"`
+	ConsultationType int32   `json:"consultation_type"`
+	MinRating        float32 `json:"min_rating"`
+	SortBy           string  `json:"sort_by"`
+	Limit            int     `json:"limit"`
+}
+
+type DoctorDirectoryEntry struct {
+	Doctor            *responsepb.DoctorResponse `json:"doctor"`
+	ConsultationTypes []int32                    `json:"consultation_types,omitempty"`
+	NextAvailableSlot string                     `json:"next_available_slot,omitempty"`
+	Relevance         float64                    `json:"relevance,omitempty"`
+}
+
+type DoctorDirectoryResponse struct {
+	Doctors []*DoctorDirectoryEntry `json:"doctors"`
+}
+
+type ConsultationTypesRequest struct {
+	DoctorID          string  `json:"doctor_id,omitempty"`
+	ConsultationTypes []int32 `json:"consultation_types"`
+}
+
+// FindDoctors searches the doctor directory. Unlike SearchDoctors it filters
+// on the structured profile fields, can rank by relevance to a free-text
+// query, and reports each doctor's next available slot.
+func (h *DoctorHandler) FindDoctors(ctx context.Context, req *DoctorSearchRequest) (*DoctorDirectoryResponse, error) {
+	ctx, span := otel.Trace(ctx, "DoctorHandler.FindDoctors")
+	defer span.End()
+
+	filters := make(map[string]interface{})
+	if req.Query != "" {
+		filters["query"] = req.Query
+	}
+	if req.Name != "" {
+		filters["name"] = req.Name
+	}
+	if req.Specialization > 0 {
+		filters["specialization"] = req.Specialization
+	}
+	if req.IsAvailable != nil {
+		filters["is_available"] = *req.IsAvailable
+	}
+	if req.ClinicID != "" {
+		filters["clinic_id"] = req.ClinicID
+	}
+	if req.City != "" {
+		filters["city"] = req.City
+	}
+	if req.Language != "" {
+		filters["language"] = req.Language
+	}
+	if req.MinFee < 0 || req.MaxFee < 0 || (req.MaxFee > 0 && req.MinFee > req.MaxFee) {
+		h.log.WithContext(ctx).Errorf("Invalid fee range: %d-%d", req.MinFee, req.MaxFee)
+		return nil, fmt.Errorf("invalid fee range")
+	}
+	if req.MinFee > 0 {
+		filters["min_fee"] = req.MinFee
+	}
+	if req.MaxFee > 0 {
+		filters["max_fee"] = req.MaxFee
+	}
+	if req.MinExperience > 0 {
+		filters["min_experience"] = req.MinExperience
+	}
+	if req.ConsultationType > 0 {
+		filters["consultation_type"] = req.ConsultationType
+	}
+	if req.MinRating < 0 || req.MinRating > entity.MaxReviewRating {
+		h.log.WithContext(ctx).Errorf("Invalid minimum rating: %v", req.MinRating)
+		return nil, fmt.Errorf("min_rating must be between 0 and %d", entity.MaxReviewRating)
+	}
+	if req.MinRating > 0 {
+		filters["min_rating"] = req.MinRating
+	}
+
+	sortBy := req.SortBy
+	if sortBy == "" && req.Query != "" {
+		sortBy = "relevance"
+	}
+	switch sortBy {
+	case "", "relevance", "next_available":
+	case "rating", "fee", "experience":
+		filters["sort"] = sortBy
+	default:
+		h.log.WithContext(ctx).Errorf("Invalid sort order: %s", req.SortBy)
+		return nil, fmt.Errorf("unsupported sort_by %q", req.SortBy)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultDirectoryLimit
+	}
+	if limit > maxDirectoryLimit {
+		limit = maxDirectoryLimit
+	}
+	// Ranking by relevance or next slot happens after the query, so it looks
+	// at more matches than it returns.
+	if sortBy != "relevance" && sortBy != "next_available" {
+		filters["limit"] = limit
+	} else {
+		filters["limit"] = maxDirectoryCandidates
+	}
+
+	doctors, err := h.repo.Search(ctx, filters)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to search doctors: %v", err)
+		return nil, fmt.Errorf("failed to search doctors: %w", err)
+	}
+
+	terms := strings.Fields(strings.ToLower(req.Query))
+	matches := make([]*doctorMatch, 0, len(doctors))
+	for _, d := range doctors {
+		m := &doctorMatch{doctor: d, entry: &DoctorDirectoryEntry{Doctor: h.entityToProto(d)}}
+		if len(terms) > 0 {
+			m.entry.Relevance = relevance(d, terms)
+		}
+		matches = append(matches, m)
+	}
+
+	if sortBy == "relevance" {
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].entry.Relevance > matches[j].entry.Relevance })
+	}
+	// Next available slots are costly to compute, so outside of sorting by
+	// them only the page that is returned gets them.
+	if sortBy != "next_available" && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	if err := h.fillDirectoryEntries(ctx, matches, req.ClinicID); err != nil {
+		return nil, err
+	}
+	if sortBy == "next_available" {
+		sort.SliceStable(matches, func(i, j int) bool {
+			a, b := matches[i].next, matches[j].next
+			if a == nil || b == nil {
+				return a != nil
+			}
+			return a.Before(*b)
+		})
+		if len(matches) > limit {
+			matches = matches[:limit]
+		}
+	}
+
+	resp := &DoctorDirectoryResponse{Doctors: make([]*DoctorDirectoryEntry, 0, len(matches))}
+	for _, m := range matches {
+		resp.Doctors = append(resp.Doctors, m.entry)
+	}
+
+	return resp, nil
+}
+
+type doctorMatch struct {
+	doctor *entity.Doctor
+	entry  *DoctorDirectoryEntry
+	next   *time.Time
+}
+
+// fillDirectoryEntries adds the consultation types and the schedule-derived
+// next available slot to each match. What they are worked out from is loaded
+// for all matches at once.
+func (h *DoctorHandler) fillDirectoryEntries(ctx context.Context, matches []*doctorMatch, clinicID string) error {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(matches))
+	var available []string
+	for _, m := range matches {
+		ids = append(ids, m.doctor.ID)
+		if m.doctor.IsAvailable {
+			available = append(available, m.doctor.ID)
+		}
+	}
+
+	types, err := h.repo.GetConsultationTypesByDoctors(ctx, ids)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get consultation types: %v", err)
+		return fmt.Errorf("failed to get consultation types: %w", err)
+	}
+
+	now := time.Now()
+	availability, err := h.repo.GetAvailabilityByDoctors(ctx, available)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get availability: %v", err)
+		return fmt.Errorf("failed to get availability: %w", err)
+	}
+	existing, err := h.appointmentRepo.GetByDoctorsInRange(ctx, available, now, now.AddDate(0, 0, nextAvailableHorizonDays+1))
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get existing appointments: %v", err)
+		return fmt.Errorf("failed to get existing appointments: %w", err)
+	}
+	templates := make(map[string][]*entity.DoctorAvailability)
+	for _, a := range availability {
+		templates[a.DoctorID] = append(templates[a.DoctorID], a)
+	}
+	appointments := make(map[string][]*entity.Appointment)
+	for _, a := range existing {
+		appointments[a.DoctorID] = append(appointments[a.DoctorID], a)
+	}
+
+	clinicLocs := make(map[string]*time.Location)
+	for _, m := range matches {
+		m.entry.ConsultationTypes = types[m.doctor.ID]
+
+		if !m.doctor.IsAvailable {
+			continue
+		}
+		loc, windows, err := scheduleWindows(ctx, h.clinicRepo, m.doctor, templates[m.doctor.ID], clinicID, clinicLocs)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to load schedule of doctor %s: %v", m.doctor.ID, err)
+			continue
+		}
+		if next := firstFreeSlot(appointments[m.doctor.ID], loc, windows, now); next != nil {
+			m.next = &next.start
+			m.entry.NextAvailableSlot = formatTimestamp(next.start)
+		}
+	}
+	return nil
+}
+
+// relevance scores how well a doctor matches the query terms. Name matches
+// weigh most, then qualifications and languages; rating and experience break
+// ties between otherwise equal matches.
+func relevance(d *entity.Doctor, terms []string) float64 {
+	first, last := strings.ToLower(d.FirstName), strings.ToLower(d.LastName)
+	qualifications := strings.ToLower(strings.Join(entity.UnmarshalStringArray(d.Qualifications), " "))
+	languages := entity.UnmarshalStringArray(d.Languages)
+
+	var score float64
+	for _, t := range terms {
+		switch {
+		case t == first || t == last:
+			score += 10
+		case strings.HasPrefix(first, t) || strings.HasPrefix(last, t):
+			score += 6
+		case strings.Contains(first, t) || strings.Contains(last, t):
+			score += 3
+		}
+		if strings.Contains(qualifications, t) {
+			score += 2
+		}
+		for _, l := range languages {
+			if strings.EqualFold(l, t) {
+				score += 2
+				break
+			}
+		}
+	}
+
+	experience := float64(d.YearsOfExperience)
+	if experience > 30 {
+		experience = 30
+	}
+	return score + float64(d.AverageRating)*0.5 + experience*0.05
+}
+
+func (h *DoctorHandler) SetConsultationTypes(ctx context.Context, req *ConsultationTypesRequest) (*ConsultationTypesRequest, error) {
+	ctx, span := otel.Trace(ctx, "DoctorHandler.SetConsultationTypes")
+	defer span.End()
+
+	if req.DoctorID == "" {
+		h.log.WithContext(ctx).Errorf("Doctor ID is required")
+		return nil, fmt.Errorf("doctor_id is required")
+	}
+	for _, t := range req.ConsultationTypes {
+		if t < entity.ConsultationTypeInPerson || t > entity.ConsultationTypePhone {
+			h.log.WithContext(ctx).Errorf("Invalid consultation type: %d", t)
+			return nil, fmt.Errorf("invalid consultation type %d", t)
+		}
+	}
+
+	doctor, err := h.repo.Get(ctx, req.DoctorID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", req.DoctorID)
+		return nil, fmt.Errorf("doctor not found")
+	}
+
+	if err := h.repo.SetConsultationTypes(ctx, req.DoctorID, req.ConsultationTypes); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to set consultation types: %v", err)
+		return nil, fmt.Errorf("failed to set consultation types: %w", err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,353 @@
+package biz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/pkg/fhir"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// Identifier and code systems of this service's own values.
+const (
+	fhirLicenseSystem        = "urn:medical-service:license"
+	fhirSpecializationSystem = "urn:medical-service:specialization"
+	fhirPrescriptionSystem   = "urn:medical-service:prescription"
+)
+
+// FHIRHandler serves the clinic's data as read-only FHIR R4 resources.
+type FHIRHandler struct {
+	repo            data.FHIRRepo
+	doctorRepo      data.DoctorRepo
+	appointmentRepo data.AppointmentRepo
+	clinicRepo      data.ClinicRepo
+	log             *log.Helper
+}
+
+func NewFHIRHandler(
+	repo data.FHIRRepo,
+	doctorRepo data.DoctorRepo,
+	appointmentRepo data.AppointmentRepo,
+	clinicRepo data.ClinicRepo,
+	logger log.Logger,
+) *FHIRHandler {
+	return &FHIRHandler{
+		repo:            repo,
+		doctorRepo:      doctorRepo,
+		appointmentRepo: appointmentRepo,
+		clinicRepo:      clinicRepo,
+		log:             log.NewHelper(logger),
+	}
+}
+
+// fhirQuery is a search of one resource type for one page of matches.
+type fhirQuery struct {
+	params url.Values
+	offset int
+	count  int
+}
+
+// fhirMatch is one resource a search found.
+type fhirMatch struct {
+	id       string
+	resource interface{}
+}
+
+// fhirResource is a resource type the API serves: the search parameters it
+// understands and the search behind them. A read is a search on _id.
+type fhirResource struct {
+	params []fhir.CapabilitySearchParam
+	search func(h *FHIRHandler, ctx context.Context, q *fhirQuery) ([]fhirMatch, int64, error)
+}
+
+var fhirResources = map[string]*fhirResource{
+	"Patient": {
+		params: []fhir.CapabilitySearchParam{
+			{Name: "_id", Type: "token"},
+			{Name: "name", Type: "string"},
+			{Name: "family", Type: "string"},
+			{Name: "given", Type: "string"},
+			{Name: "email", Type: "token"},
+			{Name: "phone", Type: "token"},
+			{Name: "gender", Type: "token"},
+			{Name: "birthdate", Type: "date"},
+			{Name: "active", Type: "token"},
+		},
+		search: (*FHIRHandler).searchPatients,
+	},
+	"Practitioner": {
+		params: []fhir.CapabilitySearchParam{
+			{Name: "_id", Type: "token"},
+			{Name: "name", Type: "string"},
+			{Name: "family", Type: "string"},
+			{Name: "given", Type: "string"},
+			{Name: "email", Type: "token"},
+			{Name: "phone", Type: "token"},
+			{Name: "identifier", Type: "token"},
+		},
+		search: (*FHIRHandler).searchPractitioners,
+	},
+	"Appointment": {
+		params: []fhir.CapabilitySearchParam{
+			{Name: "_id", Type: "token"},
+			{Name: "patient", Type: "reference"},
+			{Name: "practitioner", Type: "reference"},
+			{Name: "date", Type: "date"},
+			{Name: "status", Type: "token"},
+		},
+		search: (*FHIRHandler).searchAppointments,
+	},
+	"MedicationRequest": {
+		params: []fhir.CapabilitySearchParam{
+			{Name: "_id", Type: "token"},
+			{Name: "patient", Type: "reference"},
+			{Name: "requester", Type: "reference"},
+			{Name: "authoredon", Type: "date"},
+			{Name: "status", Type: "token"},
+			{Name: "code", Type: "token"},
+		},
+		search: (*FHIRHandler).searchMedicationRequests,
+	},
+	"Encounter": {
+		params: []fhir.CapabilitySearchParam{
+			{Name: "_id", Type: "token"},
+			{Name: "patient", Type: "reference"},
+			{Name: "practitioner", Type: "reference"},
+			{Name: "date", Type: "date"},
+			{Name: "status", Type: "token"},
+		},
+		search: (*FHIRHandler).searchEncounters,
+	},
+	"Condition": {
+		params: []fhir.CapabilitySearchParam{
+			{Name: "_id", Type: "token"},
+			{Name: "patient", Type: "reference"},
+			{Name: "encounter", Type: "reference"},
+			{Name: "recorded-date", Type: "date"},
+			{Name: "verification-status", Type: "token"},
+		},
+		search: (*FHIRHandler).searchConditions,
+	},
+	"Schedule": {
+		params: []fhir.CapabilitySearchParam{
+			{Name: "_id", Type: "token"},
+			{Name: "actor", Type: "reference"},
+		},
+		search: (*FHIRHandler).searchSchedules,
+	},
+	"Slot": {
+		params: []fhir.CapabilitySearchParam{
+			{Name: "_id", Type: "token"},
+			{Name: "schedule", Type: "reference"},
+			{Name: "start", Type: "date"},
+			{Name: "status", Type: "token"},
+		},
+		search: (*FHIRHandler).searchSlots,
+	},
+}
+
+// CapabilityStatement describes the resource types and search parameters the
+// API supports.
+func (h *FHIRHandler) CapabilityStatement(ctx context.Context) *fhir.CapabilityStatement {
+	_, span := otel.Trace(ctx, "FHIRHandler.CapabilityStatement")
+	defer span.End()
+
+	types := make([]string, 0, len(fhirResources))
+	for t := range fhirResources {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	rest := fhir.CapabilityRest{Mode: "server"}
+	for _, t := range types {
+		rest.Resource = append(rest.Resource, fhir.CapabilityResource{
+			Type:        t,
+			Interaction: []fhir.CapabilityInteraction{{Code: "read"}, {Code: "search-type"}},
+			SearchParam: fhirResources[t].params,
+		})
+	}
+
+	return &fhir.CapabilityStatement{
+		ResourceType: "CapabilityStatement",
+		Status:       "active",
+		Date:         fhir.Instant(time.Now()),
+		Kind:         "instance",
+		Software:     &fhir.CapabilitySoftware{Name: "medical-service"},
+		FHIRVersion:  fhir.Version,
+		Format:       []string{"json"},
+		Rest:         []fhir.CapabilityRest{rest},
+	}
+}
+
+// Read returns the resource of type resourceType with id.
+func (h *FHIRHandler) Read(ctx context.Context, resourceType, id string) (interface{}, error) {
+	ctx, span := otel.Trace(ctx, "FHIRHandler.Read")
+	defer span.End()
+
+	res, err := h.resource(ctx, resourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, _, err := res.search(h, ctx, &fhirQuery{params: url.Values{"_id": {id}}, count: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fhir.NotFound("%s/%s not found", resourceType, id)
+	}
+	return matches[0].resource, nil
+}
+
+// Search runs a search of resourceType and returns one page of matches as a
+// searchset bundle. base is the URL the API is served at, used for links.
+// Parameters the resource type does not understand are ignored.
+func (h *FHIRHandler) Search(ctx context.Context, resourceType string, params url.Values, base string) (*fhir.Bundle, error) {
+	ctx, span := otel.Trace(ctx, "FHIRHandler.Search")
+	defer span.End()
+
+	res, err := h.resource(ctx, resourceType)
+	if err != nil {
+		return nil, err
+	}
+	offset, count, err := fhir.Page(params)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, total, err := res.search(h, ctx, &fhirQuery{params: params, offset: offset, count: count})
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &fhir.Bundle{
+		ResourceType: "Bundle",
+		Type:         "searchset",
+		Timestamp:    fhir.Instant(time.Now()),
+		Total:        &total,
+		Link:         []fhir.BundleLink{{Relation: "self", URL: fhir.SearchURL(base, resourceType, params, offset, count)}},
+	}
+	if count > 0 && int64(offset+count) < total {
+		bundle.Link = append(bundle.Link, fhir.BundleLink{Relation: "next", URL: fhir.SearchURL(base, resourceType, params, offset+count, count)})
+	}
+	if count > 0 && offset > 0 {
+		prev := offset - count
+		if prev < 0 {
+			prev = 0
+		}
+		bundle.Link = append(bundle.Link, fhir.BundleLink{Relation: "previous", URL: fhir.SearchURL(base, resourceType, params, prev, count)})
+	}
+
+	for _, m := range matches {
+		raw, err := json.Marshal(m.resource)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to encode %s/%s: %v", resourceType, m.id, err)
+			return nil, fmt.Errorf("failed to encode %s/%s: %w", resourceType, m.id, err)
+		}
+		bundle.Entry = append(bundle.Entry, fhir.BundleEntry{
+			FullURL:  base + "/" + resourceType + "/" + m.id,
+			Resource: raw,
+			Search:   &fhir.BundleEntrySearch{Mode: "match"},
+		})
+	}
+
+	return bundle, nil
+}
+
+func (h *FHIRHandler) resource(ctx context.Context, resourceType string) (*fhirResource, error) {
+	res, ok := fhirResources[resourceType]
+	if !ok {
+		h.log.WithContext(ctx).Errorf("Unsupported FHIR resource type: %s", resourceType)
+		return nil, fhir.NotSupported("resource type %s is not supported", resourceType)
+	}
+	return res, nil
+}
+
+// setID copies the _id parameter into the id filter.
+func (q *fhirQuery) setID(filters map[string]interface{}) {
+	if id := q.params.Get("_id"); id != "" {
+		filters["id"] = id
+	}
+}
+
+// setText copies a string parameter, honouring its :exact and :contains
+// modifiers, into the filter of the same name.
+func (q *fhirQuery) setText(name string, filters map[string]interface{}) {
+	switch {
+	case q.params.Get(name+":exact") != "":
+		filters[name] = data.TextMatch{Value: q.params.Get(name + ":exact"), Exact: true}
+	case q.params.Get(name+":contains") != "":
+		filters[name] = data.TextMatch{Value: q.params.Get(name + ":contains"), Contains: true}
+	case q.params.Get(name) != "":
+		filters[name] = data.TextMatch{Value: q.params.Get(name)}
+	}
+}
+
+// setReference copies the ID a reference parameter points at into filter.
+func (q *fhirQuery) setReference(name, resourceType, filter string, filters map[string]interface{}) error {
+	v := q.params.Get(name)
+	if v == "" {
+		return nil
+	}
+	id, err := fhir.ReferenceID(name, v, resourceType)
+	if err != nil {
+		return err
+	}
+	filters[filter] = id
+	return nil
+}
+
+// setDates copies a date parameter into the from and to filters.
+func (q *fhirQuery) setDates(name string, filters map[string]interface{}) error {
+	from, to, err := fhir.DateRange(name, q.params[name])
+	if err != nil {
+		return err
+	}
+	if from != nil {
+		filters["from"] = *from
+	}
+	if to != nil {
+		filters["to"] = *to
+	}
+	return nil
+}
+
+// codes returns the codes of a token parameter, which may list several
+// separated by commas.
+func (q *fhirQuery) codes(name string) []string {
+	var codes []string
+	for _, v := range q.params[name] {
+		for _, token := range strings.Split(v, ",") {
+			if _, code := fhir.Token(token); code != "" {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes
+}
+
+// statusCodes maps the codes of a status parameter onto the stored statuses
+// that statuses translates to them.
+func (q *fhirQuery) statusCodes(name string, statuses map[string]string) ([]string, error) {
+	var matched []string
+	for _, code := range q.codes(name) {
+		found := false
+		for stored, fhirCode := range statuses {
+			if fhirCode == code {
+				matched = append(matched, stored)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fhir.Invalid("%s: unknown code %s", name, code)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,487 @@
+package biz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/fhir"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// fhirImportBatchSize is how many resources are written per transaction.
+const fhirImportBatchSize = 50
+
+// Import outcomes of a resource.
+const (
+	FHIRImportCreated = "created"
+	FHIRImportUpdated = "updated"
+	FHIRImportSkipped = "skipped"
+	FHIRImportFailed  = "failed"
+)
+
+// fhirImportOrder lists the resource types an import writes, in the order
+// they are written so that references point at rows that already exist.
+var fhirImportOrder = []string{"Practitioner", "Patient", "Appointment", "Encounter", "MedicationRequest"}
+
+// FHIRImportHandler imports FHIR Bundles exported by other systems.
+type FHIRImportHandler struct {
+	repo             data.ImportRepo
+	patientRepo      data.PatientRepo
+	doctorRepo       data.DoctorRepo
+	appointmentRepo  data.AppointmentRepo
+	prescriptionRepo data.PrescriptionRepo
+	recordRepo       data.MedicalRecordRepo
+	tx               data.Transaction
+	log              *log.Helper
+}
+
+func NewFHIRImportHandler(
+	repo data.ImportRepo,
+	patientRepo data.PatientRepo,
+	doctorRepo data.DoctorRepo,
+	appointmentRepo data.AppointmentRepo,
+	prescriptionRepo data.PrescriptionRepo,
+	recordRepo data.MedicalRecordRepo,
+	tx data.Transaction,
+	logger log.Logger,
+) *FHIRImportHandler {
+	return &FHIRImportHandler{
+		repo:             repo,
+		patientRepo:      patientRepo,
+		doctorRepo:       doctorRepo,
+		appointmentRepo:  appointmentRepo,
+		prescriptionRepo: prescriptionRepo,
+		recordRepo:       recordRepo,
+		tx:               tx,
+		log:              log.NewHelper(logger),
+	}
+}
+
+// ImportFHIRBundleRequest carries a Bundle to import. Source names the system
+// it was exported from; resource IDs are remembered under it, so a later
+// import from the same source updates rather than duplicates, and may
+// reference resources imported earlier.
+type ImportFHIRBundleRequest struct {
+	Source string          `json:"source"`
+	Bundle json.RawMessage `json:"bundle"`
+}
+
+// FHIRImportRecord is the outcome of importing one resource. ID is the row it
+// was imported as or matched to.
+type FHIRImportRecord struct {
+	Reference string `json:"reference"`
+	Outcome   string `json:"outcome"`
+	ID        string `json:"id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type FHIRImportResourceReport struct {
+	ResourceType string              `json:"resource_type"`
+	Created      int32               `json:"created"`
+	Updated      int32               `json:"updated"`
+	Skipped      int32               `json:"skipped"`
+	Failed       int32               `json:"failed"`
+	Records      []*FHIRImportRecord `json:"records"`
+}
+
+type FHIRImportReport struct {
+	Resources []*FHIRImportResourceReport `json:"resources"`
+}
+
+// fhirImportEntry is one resource of the bundle being imported.
+type fhirImportEntry struct {
+	resourceType string
+	id           string
+	raw          json.RawMessage
+	refs         []string
+	record       *FHIRImportRecord
+}
+
+func (e *fhirImportEntry) created(id string) {
+	e.record.Outcome, e.record.ID, e.record.Reason = FHIRImportCreated, id, ""
+}
+
+func (e *fhirImportEntry) updated(id, reason string) {
+	e.record.Outcome, e.record.ID, e.record.Reason = FHIRImportUpdated, id, reason
+}
+
+func (e *fhirImportEntry) skipped(id, format string, args ...interface{}) {
+	e.record.Outcome, e.record.ID, e.record.Reason = FHIRImportSkipped, id, fmt.Sprintf(format, args...)
+}
+
+func (e *fhirImportEntry) failed(format string, args ...interface{}) {
+	e.record.Outcome, e.record.ID, e.record.Reason = FHIRImportFailed, "", fmt.Sprintf(format, args...)
+}
+
+// fhirImportUnit is the resources written together: a single resource, or
+// the medication requests that make up one prescription.
+type fhirImportUnit struct {
+	resourceType string
+	entries      []*fhirImportEntry
+}
+
+// fhirImport is the state of one bundle import.
+type fhirImport struct {
+	source string
+	// resources holds every resource of the bundle by each reference to it.
+	resources map[string]*fhirImportEntry
+	// local maps references to the rows imported in committed batches;
+	// pending holds those of the batch being written.
+	local   map[string]string
+	pending map[string]string
+	// aliases maps references to inactive patients onto their replacement.
+	aliases map[string]string
+}
+
+// imported records that e was imported as the row with id.
+func (imp *fhirImport) imported(e *fhirImportEntry, id string) {
+	for _, ref := range e.refs {
+		imp.pending[ref] = id
+	}
+}
+
+func (imp *fhirImport) commit() {
+	for ref, id := range imp.pending {
+		imp.local[ref] = id
+	}
+	imp.pending = make(map[string]string)
+}
+
+func (imp *fhirImport) rollback() {
+	imp.pending = make(map[string]string)
+}
+
+// keys are the identifiers e is remembered under: its own identifiers, and
+// its ID in the source system.
+func (imp *fhirImport) keys(e *fhirImportEntry, identifiers []fhir.Identifier) []*entity.ImportedResource {
+	var keys []*entity.ImportedResource
+	for _, ident := range identifiers {
+		if ident.System != "" && ident.Value != "" {
+			keys = append(keys, &entity.ImportedResource{ResourceType: e.resourceType, System: ident.System, Value: ident.Value})
+		}
+	}
+	if imp.source != "" && e.id != "" {
+		keys = append(keys, &entity.ImportedResource{ResourceType: e.resourceType, System: imp.source, Value: e.id})
+	}
+	return keys
+}
+
+// ImportBundle imports the Patient, Practitioner, Appointment,
+// MedicationRequest and Encounter resources of a Bundle. Patients and
+// doctors that already exist, by identifier, email, phone or license, are
+// matched rather than created, filling in details missing locally; clinical
+// history already imported is skipped. Resources are written in batches,
+// each in a transaction; a batch that fails is retried one resource at a
+// time so that only the resources at fault fail.
+func (h *FHIRImportHandler) ImportBundle(ctx context.Context, req *ImportFHIRBundleRequest) (*FHIRImportReport, error) {
+	ctx, span := otel.Trace(ctx, "FHIRImportHandler.ImportBundle")
+	defer span.End()
+
+	var bundle fhir.Bundle
+	if err := json.Unmarshal(req.Bundle, &bundle); err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid FHIR bundle: %v", err)
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if bundle.ResourceType != "Bundle" {
+		h.log.WithContext(ctx).Errorf("Not a FHIR bundle: %s", bundle.ResourceType)
+		return nil, fmt.Errorf("resourceType must be Bundle")
+	}
+
+	imp := &fhirImport{
+		source:    strings.TrimSpace(req.Source),
+		resources: make(map[string]*fhirImportEntry),
+		local:     make(map[string]string),
+		pending:   make(map[string]string),
+		aliases:   make(map[string]string),
+	}
+	reports := make(map[string]*FHIRImportResourceReport)
+	report := func(resourceType string) *FHIRImportResourceReport {
+		r, ok := reports[resourceType]
+		if !ok {
+			r = &FHIRImportResourceReport{ResourceType: resourceType, Records: []*FHIRImportRecord{}}
+			reports[resourceType] = r
+		}
+		return r
+	}
+
+	entries := make(map[string][]*fhirImportEntry)
+	for i, be := range bundle.Entry {
+		e := &fhirImportEntry{raw: be.Resource, record: &FHIRImportRecord{Reference: be.FullURL}}
+		resourceType, id, err := fhir.Identify(be.Resource)
+		if len(be.Resource) == 0 || err != nil {
+			if e.record.Reference == "" {
+				e.record.Reference = fmt.Sprintf("entry %d", i)
+			}
+			e.failed("entry has no readable resource")
+			report("Unknown").Records = append(report("Unknown").Records, e.record)
+			continue
+		}
+		e.resourceType, e.id = resourceType, id
+		if be.FullURL != "" {
+			e.refs = append(e.refs, be.FullURL)
+		}
+		if id != "" {
+			e.refs = append(e.refs, resourceType+"/"+id)
+		}
+		if e.record.Reference == "" {
+			e.record.Reference = resourceType + "/" + id
+		}
+		for _, ref := range e.refs {
+			imp.resources[ref] = e
+		}
+		entries[resourceType] = append(entries[resourceType], e)
+		report(resourceType).Records = append(report(resourceType).Records, e.record)
+	}
+
+	for resourceType, list := range entries {
+		if !containsString(fhirImportOrder, resourceType) {
+			for _, e := range list {
+				e.skipped("", "%s resources are not imported", resourceType)
+			}
+		}
+	}
+	for _, resourceType := range fhirImportOrder {
+		units := fhirImportUnits(resourceType, entries[resourceType])
+		for start := 0; start < len(units); start += fhirImportBatchSize {
+			end := start + fhirImportBatchSize
+			if end > len(units) {
+				end = len(units)
+			}
+			h.importBatch(ctx, imp, units[start:end])
+		}
+	}
+
+	var others []string
+	for resourceType := range reports {
+		if !containsString(fhirImportOrder, resourceType) {
+			others = append(others, resourceType)
+		}
+	}
+	sort.Strings(others)
+
+	out := &FHIRImportReport{}
+	for _, resourceType := range append(append([]string{}, fhirImportOrder...), others...) {
+		r, ok := reports[resourceType]
+		if !ok {
+			continue
+		}
+		for _, rec := range r.Records {
+			switch rec.Outcome {
+			case FHIRImportCreated:
+				r.Created++
+			case FHIRImportUpdated:
+				r.Updated++
+			case FHIRImportSkipped:
+				r.Skipped++
+			default:
+				r.Failed++
+			}
+		}
+		out.Resources = append(out.Resources, r)
+	}
+
+	h.log.WithContext(ctx).Infof("Imported FHIR bundle from %q: %d entries", imp.source, len(bundle.Entry))
+	return out, nil
+}
+
+// fhirImportUnits groups entries into the units they are written in.
+// Medication requests sharing a group identifier form one prescription.
+func fhirImportUnits(resourceType string, entries []*fhirImportEntry) []*fhirImportUnit {
+	var units []*fhirImportUnit
+	groups := make(map[string]*fhirImportUnit)
+	for _, e := range entries {
+		if resourceType == "MedicationRequest" {
+			var req struct {
+				GroupIdentifier *fhir.Identifier `json:"groupIdentifier"`
+			}
+			if json.Unmarshal(e.raw, &req) == nil && req.GroupIdentifier != nil && req.GroupIdentifier.Value != "" {
+				key := req.GroupIdentifier.System + "|" + req.GroupIdentifier.Value
+				if u, ok := groups[key]; ok {
+					u.entries = append(u.entries, e)
+					continue
+				}
+				u := &fhirImportUnit{resourceType: resourceType, entries: []*fhirImportEntry{e}}
+				groups[key] = u
+				units = append(units, u)
+				continue
+			}
+		}
+		units = append(units, &fhirImportUnit{resourceType: resourceType, entries: []*fhirImportEntry{e}})
+	}
+	return units
+}
+
+// importBatch writes units in one transaction. If that fails, each unit is
+// retried in a transaction of its own.
+func (h *FHIRImportHandler) importBatch(ctx context.Context, imp *fhirImport, units []*fhirImportUnit) {
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		for _, u := range units {
+			if err := h.importUnit(ctx, imp, u); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		imp.commit()
+		return
+	}
+	imp.rollback()
+
+	if len(units) > 1 {
+		for _, u := range units {
+			h.importBatch(ctx, imp, []*fhirImportUnit{u})
+		}
+		return
+	}
+	h.log.WithContext(ctx).Errorf("Failed to import %s: %v", units[0].entries[0].record.Reference, err)
+	for _, e := range units[0].entries {
+		e.failed("%v", err)
+	}
+}
+
+func (h *FHIRImportHandler) importUnit(ctx context.Context, imp *fhirImport, u *fhirImportUnit) error {
+	switch u.resourceType {
+	case "Practitioner":
+		return h.importPractitioner(ctx, imp, u.entries[0])
+	case "Patient":
+		return h.importPatient(ctx, imp, u.entries[0])
+	case "Appointment":
+		return h.importAppointment(ctx, imp, u.entries[0])
+	case "Encounter":
+		return h.importEncounter(ctx, imp, u.entries[0])
+	case "MedicationRequest":
+		return h.importMedicationRequests(ctx, imp, u.entries)
+	}
+	return nil
+}
+
+// linked returns the row a resource with keys was imported as before, if
+// any.
+func (h *FHIRImportHandler) linked(ctx context.Context, keys []*entity.ImportedResource) (string, error) {
+	for _, k := range keys {
+		link, err := h.repo.GetImported(ctx, k.ResourceType, k.System, k.Value)
+		if err != nil {
+			return "", fmt.Errorf("failed to get imported resource: %w", err)
+		}
+		if link != nil {
+			return link.LocalID, nil
+		}
+	}
+	return "", nil
+}
+
+// link remembers that e, known by keys, was imported as the row with id.
+func (h *FHIRImportHandler) link(ctx context.Context, imp *fhirImport, e *fhirImportEntry, keys []*entity.ImportedResource, id string) error {
+	for _, k := range keys {
+		k.LocalID = id
+	}
+	if err := h.repo.CreateImported(ctx, keys); err != nil {
+		return fmt.Errorf("failed to record imported resource: %w", err)
+	}
+	imp.imported(e, id)
+	return nil
+}
+
+// errUnresolved is a reference that cannot be followed; the resource holding
+// it fails but the batch goes on.
+type errUnresolved struct {
+	reason string
+}
+
+func (e *errUnresolved) Error() string {
+	return e.reason
+}
+
+// resolve returns the local ID of the resource of type resourceType that ref
+// points at: one imported from this bundle, one imported from the same
+// source before, or an existing row with that ID.
+func (h *FHIRImportHandler) resolve(ctx context.Context, imp *fhirImport, ref *fhir.Reference, resourceType string) (string, error) {
+	if ref == nil || ref.Reference == "" {
+		return "", nil
+	}
+	target := ref.Reference
+	for i := 0; i < 2; i++ {
+		if alias, ok := imp.aliases[target]; ok {
+			target = alias
+		}
+	}
+
+	id := target
+	if parts := strings.Split(strings.TrimSuffix(target, "/"), "/"); len(parts) >= 2 && !strings.HasPrefix(target, "urn:") {
+		if parts[len(parts)-2] != resourceType {
+			return "", &errUnresolved{fmt.Sprintf("%s must reference a %s", ref.Reference, resourceType)}
+		}
+		id = parts[len(parts)-1]
+	}
+	for _, key := range []string{target, resourceType + "/" + id} {
+		if local, ok := imp.pending[key]; ok {
+			return local, nil
+		}
+		if local, ok := imp.local[key]; ok {
+			return local, nil
+		}
+	}
+	for _, key := range []string{target, resourceType + "/" + id} {
+		if e, ok := imp.resources[key]; ok {
+			return "", &errUnresolved{fmt.Sprintf("%s was not imported: %s", ref.Reference, e.record.Reason)}
+		}
+	}
+
+	if imp.source != "" {
+		link, err := h.repo.GetImported(ctx, resourceType, imp.source, id)
+		if err != nil {
+			return "", fmt.Errorf("failed to get imported resource: %w", err)
+		}
+		if link != nil {
+			return link.LocalID, nil
+		}
+	}
+
+	var exists bool
+	switch resourceType {
+	case "Patient":
+		patient, err := h.patientRepo.Get(ctx, id)
+		if err != nil {
+			return "", fmt.Errorf("failed to get patient: %w", err)
+		}
+		if patient != nil {
+			id, exists = patient.ID, true
+		}
+	case "Practitioner":
+		doctor, err := h.doctorRepo.Get(ctx, id)
+		if err != nil {
+			return "", fmt.Errorf("failed to get doctor: %w", err)
+		}
+		exists = doctor != nil
+	}
+	if !exists {
+		return "", &errUnresolved{fmt.Sprintf("%s cannot be resolved", ref.Reference)}
+	}
+	return id, nil
+}
+
+// failOnUnresolved marks e failed if err is an unresolved reference, and
+// returns any other error.
+func failOnUnresolved(e *fhirImportEntry, err error) error {
+	if ue, ok := err.(*errUnresolved); ok {
+		e.failed("%s", ue.reason)
+		return nil
+	}
+	return err
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,791 @@
+package biz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/fhir"
+)
+
+// Statuses of imported resources. Resources in a status missing here are
+// skipped: they were never booked, prescribed or seen, or were recorded in
+// error.
+var (
+	fhirImportAppointmentStatuses = map[string]int32{
+		"booked":     entity.AppointmentStatusScheduled,
+		"arrived":    entity.AppointmentStatusInProgress,
+		"checked-in": entity.AppointmentStatusInProgress,
+		"fulfilled":  entity.AppointmentStatusCompleted,
+		"cancelled":  entity.AppointmentStatusCancelled,
+		"noshow":     entity.AppointmentStatusNoShow,
+	}
+	fhirImportMedicationRequestStatuses = map[string]string{
+		"active":    entity.PrescriptionStatusActive,
+		"completed": entity.PrescriptionStatusExpired,
+		"stopped":   entity.PrescriptionStatusRevoked,
+		"cancelled": entity.PrescriptionStatusRevoked,
+	}
+	fhirImportEncounterStatuses = map[string]string{
+		"finished":    entity.MedicalRecordStatusFinal,
+		"in-progress": entity.MedicalRecordStatusDraft,
+		"arrived":     entity.MedicalRecordStatusDraft,
+		"triaged":     entity.MedicalRecordStatusDraft,
+		"onleave":     entity.MedicalRecordStatusDraft,
+	}
+)
+
+// fhirImportValidityDays is how long an imported prescription without a
+// validity period stays valid, as for prescriptions written here.
+const fhirImportValidityDays = 30
+
+func (h *FHIRImportHandler) importPractitioner(ctx context.Context, imp *fhirImport, e *fhirImportEntry) error {
+	var p fhir.Practitioner
+	if err := json.Unmarshal(e.raw, &p); err != nil {
+		e.failed("invalid Practitioner: %v", err)
+		return nil
+	}
+	doctor := &entity.Doctor{IsAvailable: true}
+	doctor.FirstName, doctor.LastName = importName(p.Name)
+	doctor.Email, doctor.PhoneNumber = importTelecom(p.Telecom)
+	doctor.LicenseNumber = importLicense(p.Identifier)
+
+	var qualifications, languages []string
+	for _, q := range p.Qualification {
+		if code, ok := codingIn(q.Code, fhirSpecializationSystem); ok && doctor.Specialization == 0 {
+			fmt.Sscanf(code, "%d", &doctor.Specialization)
+			continue
+		}
+		if text := conceptText(&q.Code); text != "" {
+			qualifications = append(qualifications, text)
+		}
+	}
+	for _, c := range p.Communication {
+		if text := conceptText(&c); text != "" {
+			languages = append(languages, text)
+		}
+	}
+	doctor.Qualifications = entity.MarshalStringArray(qualifications)
+	doctor.Languages = entity.MarshalStringArray(languages)
+
+	keys := imp.keys(e, p.Identifier)
+	existing, matchedBy, err := h.findDoctor(ctx, keys, doctor)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		switch {
+		case doctor.FirstName == "" || doctor.LastName == "":
+			e.failed("name with given and family parts is required")
+			return nil
+		case doctor.Email == "" || doctor.PhoneNumber == "":
+			e.failed("email and phone telecom are required")
+			return nil
+		case doctor.LicenseNumber == "":
+			e.failed("an identifier with the license number is required")
+			return nil
+		}
+		if err := h.doctorRepo.Create(ctx, doctor); err != nil {
+			return fmt.Errorf("failed to create doctor: %w", err)
+		}
+		e.created(doctor.ID)
+		return h.link(ctx, imp, e, keys, doctor.ID)
+	}
+
+	changed := fillString(&existing.PhoneNumber, doctor.PhoneNumber)
+	if existing.Specialization == 0 && doctor.Specialization != 0 {
+		existing.Specialization, changed = doctor.Specialization, true
+	}
+	if len(entity.UnmarshalStringArray(existing.Qualifications)) == 0 && len(qualifications) > 0 {
+		existing.Qualifications, changed = doctor.Qualifications, true
+	}
+	if len(entity.UnmarshalStringArray(existing.Languages)) == 0 && len(languages) > 0 {
+		existing.Languages, changed = doctor.Languages, true
+	}
+	if changed {
+		if err := h.doctorRepo.Update(ctx, existing); err != nil {
+			return fmt.Errorf("failed to update doctor: %w", err)
+		}
+		e.updated(existing.ID, "matched by "+matchedBy)
+	} else {
+		e.skipped(existing.ID, "matches existing doctor by %s", matchedBy)
+	}
+	return h.link(ctx, imp, e, keys, existing.ID)
+}
+
+// findDoctor looks for the doctor a Practitioner was imported as before, or
+// an existing doctor with the same license or email.
+func (h *FHIRImportHandler) findDoctor(ctx context.Context, keys []*entity.ImportedResource, doctor *entity.Doctor) (*entity.Doctor, string, error) {
+	id, err := h.linked(ctx, keys)
+	if err != nil {
+		return nil, "", err
+	}
+	if id != "" {
+		existing, err := h.doctorRepo.Get(ctx, id)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get doctor: %w", err)
+		}
+		if existing != nil {
+			return existing, "identifier", nil
+		}
+	}
+	if doctor.LicenseNumber != "" {
+		existing, err := h.doctorRepo.GetByLicense(ctx, doctor.LicenseNumber)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to check existing license: %w", err)
+		}
+		if existing != nil {
+			return existing, "license", nil
+		}
+	}
+	if doctor.Email != "" {
+		existing, err := h.doctorRepo.GetByEmail(ctx, doctor.Email)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to check existing email: %w", err)
+		}
+		if existing != nil {
+			return existing, "email", nil
+		}
+	}
+	return nil, "", nil
+}
+
+func (h *FHIRImportHandler) importPatient(ctx context.Context, imp *fhirImport, e *fhirImportEntry) error {
+	var p fhir.Patient
+	if err := json.Unmarshal(e.raw, &p); err != nil {
+		e.failed("invalid Patient: %v", err)
+		return nil
+	}
+	if p.Active != nil && !*p.Active {
+		for _, link := range p.Link {
+			if link.Type == "replaced-by" && link.Other.Reference != "" {
+				for _, ref := range e.refs {
+					imp.aliases[ref] = link.Other.Reference
+				}
+			}
+		}
+		e.skipped("", "patient record is inactive")
+		return nil
+	}
+
+	patient := &entity.Patient{}
+	patient.FirstName, patient.LastName = importName(p.Name)
+	patient.Email, patient.PhoneNumber = importTelecom(p.Telecom)
+	for g, code := range fhirGenders {
+		if code == p.Gender {
+			patient.Gender = g
+		}
+	}
+	if _, err := time.Parse(dateLayout, p.BirthDate); err == nil {
+		patient.DateOfBirth = p.BirthDate
+	}
+	if len(p.Address) > 0 {
+		a := p.Address[0]
+		patient.Address = entity.MarshalAddress(&entity.Address{
+			Street:  strings.Join(a.Line, ", "),
+			City:    a.City,
+			State:   a.State,
+			ZipCode: a.PostalCode,
+			Country: a.Country,
+		})
+	}
+
+	keys := imp.keys(e, p.Identifier)
+	existing, matchedBy, err := h.findPatient(ctx, keys, patient)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		switch {
+		case patient.FirstName == "" || patient.LastName == "":
+			e.failed("name with given and family parts is required")
+			return nil
+		case patient.Email == "" || patient.PhoneNumber == "":
+			e.failed("email and phone telecom are required")
+			return nil
+		}
+		if err := h.patientRepo.Create(ctx, patient); err != nil {
+			return fmt.Errorf("failed to create patient: %w", err)
+		}
+		e.created(patient.ID)
+		return h.link(ctx, imp, e, keys, patient.ID)
+	}
+
+	changed := fillString(&existing.DateOfBirth, patient.DateOfBirth)
+	changed = fillString(&existing.Address, patient.Address) || changed
+	if existing.Gender == 0 && patient.Gender != 0 {
+		existing.Gender, changed = patient.Gender, true
+	}
+	if changed {
+		if err := h.patientRepo.Update(ctx, existing); err != nil {
+			return fmt.Errorf("failed to update patient: %w", err)
+		}
+		e.updated(existing.ID, "matched by "+matchedBy)
+	} else {
+		e.skipped(existing.ID, "matches existing patient by %s", matchedBy)
+	}
+	return h.link(ctx, imp, e, keys, existing.ID)
+}
+
+// findPatient looks for the patient a Patient was imported as before, or an
+// existing patient with the same email or phone number.
+func (h *FHIRImportHandler) findPatient(ctx context.Context, keys []*entity.ImportedResource, patient *entity.Patient) (*entity.Patient, string, error) {
+	id, err := h.linked(ctx, keys)
+	if err != nil {
+		return nil, "", err
+	}
+	if id != "" {
+		existing, err := h.patientRepo.Get(ctx, id)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get patient: %w", err)
+		}
+		if existing != nil {
+			return existing, "identifier", nil
+		}
+	}
+	if patient.Email != "" {
+		existing, err := h.patientRepo.GetByEmail(ctx, patient.Email)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to check existing email: %w", err)
+		}
+		if existing != nil {
+			return existing, "email", nil
+		}
+	}
+	if patient.PhoneNumber != "" {
+		existing, err := h.patientRepo.GetByPhone(ctx, patient.PhoneNumber)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to check existing phone: %w", err)
+		}
+		if existing != nil {
+			return existing, "phone", nil
+		}
+	}
+	return nil, "", nil
+}
+
+func (h *FHIRImportHandler) importAppointment(ctx context.Context, imp *fhirImport, e *fhirImportEntry) error {
+	var a fhir.Appointment
+	if err := json.Unmarshal(e.raw, &a); err != nil {
+		e.failed("invalid Appointment: %v", err)
+		return nil
+	}
+	status, ok := fhirImportAppointmentStatuses[a.Status]
+	if !ok {
+		e.skipped("", "status %q is not imported", a.Status)
+		return nil
+	}
+
+	keys := imp.keys(e, a.Identifier)
+	id, err := h.linked(ctx, keys)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		e.skipped(id, "already imported")
+		imp.imported(e, id)
+		return nil
+	}
+
+	start, err := time.Parse(time.RFC3339, a.Start)
+	if err != nil {
+		e.failed("start must be an instant")
+		return nil
+	}
+	end := start.Add(time.Duration(a.MinutesDuration) * time.Minute)
+	if a.End != "" {
+		if end, err = time.Parse(time.RFC3339, a.End); err != nil || !end.After(start) {
+			e.failed("end must be an instant after start")
+			return nil
+		}
+	} else if a.MinutesDuration <= 0 {
+		end = start.Add(entity.DefaultSlotDurationMinutes * time.Minute)
+	}
+
+	var patientRef, doctorRef *fhir.Reference
+	for _, p := range a.Participant {
+		if p.Actor == nil {
+			continue
+		}
+		switch {
+		case strings.Contains(p.Actor.Reference, "Patient/") && patientRef == nil:
+			patientRef = p.Actor
+		case strings.Contains(p.Actor.Reference, "Practitioner/") && doctorRef == nil:
+			doctorRef = p.Actor
+		}
+	}
+	if patientRef == nil || doctorRef == nil {
+		e.failed("a Patient and a Practitioner participant are required")
+		return nil
+	}
+	patient, err := h.resolvePatient(ctx, imp, patientRef)
+	if err != nil {
+		return failOnUnresolved(e, err)
+	}
+	doctor, err := h.resolveDoctor(ctx, imp, doctorRef)
+	if err != nil {
+		return failOnUnresolved(e, err)
+	}
+	loc, err := loadLocation(doctor.Timezone)
+	if err != nil {
+		return err
+	}
+
+	if status == entity.AppointmentStatusScheduled || status == entity.AppointmentStatusInProgress {
+		conflict, err := h.appointmentRepo.CheckConflict(ctx, doctor.ID, start, end, "")
+		if err != nil {
+			return fmt.Errorf("failed to check conflicts: %w", err)
+		}
+		if conflict != nil {
+			e.failed("conflicts with appointment %s", conflict.ID)
+			return nil
+		}
+	}
+
+	appointment := &entity.Appointment{
+		PatientID:        patient.ID,
+		PatientName:      patient.FirstName + " " + patient.LastName,
+		DoctorID:         doctor.ID,
+		DoctorName:       doctor.FirstName + " " + doctor.LastName,
+		AppointmentDate:  start.In(loc).Format(dateLayout),
+		AppointmentTime:  start.In(loc).Format(clockLayout),
+		StartsAt:         start.UTC(),
+		EndsAt:           end.UTC(),
+		Timezone:         loc.String(),
+		Status:           status,
+		ConsultationType: entity.ConsultationTypeInPerson,
+		ReasonForVisit:   a.Description,
+		Notes:            a.Comment,
+	}
+	if a.AppointmentType != nil {
+		for t, text := range fhirConsultationTypes {
+			if strings.EqualFold(conceptText(a.AppointmentType), text) {
+				appointment.ConsultationType = t
+			}
+		}
+	}
+	if appointment.ReasonForVisit == "" && len(a.ReasonCode) > 0 {
+		appointment.ReasonForVisit = conceptText(&a.ReasonCode[0])
+	}
+	if a.CancelationReason != nil {
+		appointment.CancellationReason = conceptText(a.CancelationReason)
+	}
+
+	if err := h.appointmentRepo.Create(ctx, appointment); err != nil {
+		return fmt.Errorf("failed to create appointment: %w", err)
+	}
+	e.created(appointment.ID)
+	return h.link(ctx, imp, e, keys, appointment.ID)
+}
+
+// importEncounter imports an Encounter as a medical record. Finished
+// encounters become final records, which are left unsigned as they were
+// not signed here; diagnoses are read from the Conditions in the bundle.
+func (h *FHIRImportHandler) importEncounter(ctx context.Context, imp *fhirImport, e *fhirImportEntry) error {
+	var enc fhir.Encounter
+	if err := json.Unmarshal(e.raw, &enc); err != nil {
+		e.failed("invalid Encounter: %v", err)
+		return nil
+	}
+	status, ok := fhirImportEncounterStatuses[enc.Status]
+	if !ok {
+		e.skipped("", "status %q is not imported", enc.Status)
+		return nil
+	}
+
+	keys := imp.keys(e, enc.Identifier)
+	id, err := h.linked(ctx, keys)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		e.skipped(id, "already imported")
+		imp.imported(e, id)
+		return nil
+	}
+
+	if enc.Period == nil || enc.Period.Start == "" {
+		e.failed("period.start is required")
+		return nil
+	}
+	visitDate, err := parseRecordTime(enc.Period.Start)
+	if err != nil {
+		e.failed("period.start: %v", err)
+		return nil
+	}
+	if enc.Subject == nil {
+		e.failed("subject is required")
+		return nil
+	}
+	patient, err := h.resolvePatient(ctx, imp, enc.Subject)
+	if err != nil {
+		return failOnUnresolved(e, err)
+	}
+
+	record := &entity.MedicalRecord{
+		PatientID: patient.ID,
+		VisitDate: visitDate,
+		Status:    status,
+	}
+	for _, p := range enc.Participant {
+		if p.Individual != nil && strings.Contains(p.Individual.Reference, "Practitioner/") {
+			doctor, err := h.resolveDoctor(ctx, imp, p.Individual)
+			if err != nil {
+				return failOnUnresolved(e, err)
+			}
+			record.DoctorID = doctor.ID
+			break
+		}
+	}
+	if len(enc.Type) > 0 {
+		record.RecordType = conceptText(&enc.Type[0])
+	}
+	var reasons, diagnoses []string
+	for _, c := range enc.ReasonCode {
+		if text := conceptText(&c); text != "" {
+			reasons = append(reasons, text)
+		}
+	}
+	for _, d := range enc.Diagnosis {
+		ce, ok := imp.resources[d.Condition.Reference]
+		if !ok {
+			if d.Condition.Display != "" {
+				diagnoses = append(diagnoses, d.Condition.Display)
+			}
+			continue
+		}
+		var condition fhir.Condition
+		if err := json.Unmarshal(ce.raw, &condition); err == nil && condition.Code != nil {
+			if text := conceptText(condition.Code); text != "" {
+				diagnoses = append(diagnoses, text)
+			}
+		}
+	}
+	record.Symptoms = strings.Join(reasons, "; ")
+	record.Diagnosis = strings.Join(diagnoses, "; ")
+
+	if err := h.recordRepo.Create(ctx, record); err != nil {
+		return fmt.Errorf("failed to create medical record: %w", err)
+	}
+	e.created(record.ID)
+	return h.link(ctx, imp, e, keys, record.ID)
+}
+
+// importMedicationRequests imports the medication requests of one group as
+// a prescription with an item per request. Like encounters, imported
+// prescriptions are left unsigned.
+func (h *FHIRImportHandler) importMedicationRequests(ctx context.Context, imp *fhirImport, entries []*fhirImportEntry) error {
+	type request struct {
+		entry *fhirImportEntry
+		req   fhir.MedicationRequest
+		keys  []*entity.ImportedResource
+		med   *entity.Medication
+	}
+
+	var requests []*request
+	for _, e := range entries {
+		r := &request{entry: e}
+		if err := json.Unmarshal(e.raw, &r.req); err != nil {
+			e.failed("invalid MedicationRequest: %v", err)
+			continue
+		}
+		if _, ok := fhirImportMedicationRequestStatuses[r.req.Status]; !ok {
+			e.skipped("", "status %q is not imported", r.req.Status)
+			continue
+		}
+		r.keys = imp.keys(e, r.req.Identifier)
+		id, err := h.linked(ctx, r.keys)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			e.skipped(id, "already imported")
+			imp.imported(e, id)
+			continue
+		}
+		if r.med = importMedication(&r.req); r.med == nil {
+			e.failed("medicationCodeableConcept is required")
+			continue
+		}
+		if len(requests) > 0 && (r.req.Subject.Reference != requests[0].req.Subject.Reference ||
+			r.req.Requester == nil || requests[0].req.Requester == nil ||
+			r.req.Requester.Reference != requests[0].req.Requester.Reference) {
+			e.failed("subject and requester must match the rest of its group")
+			continue
+		}
+		requests = append(requests, r)
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+	first := requests[0]
+
+	fail := func(format string, args ...interface{}) error {
+		for _, r := range requests {
+			r.entry.failed(format, args...)
+		}
+		return nil
+	}
+	if first.req.Requester == nil {
+		return fail("requester is required")
+	}
+	authoredOn, err := parseRecordTime(first.req.AuthoredOn)
+	if err != nil {
+		return fail("authoredOn: %v", err)
+	}
+	patient, err := h.resolvePatient(ctx, imp, &first.req.Subject)
+	if err != nil {
+		if ue, ok := err.(*errUnresolved); ok {
+			return fail("%s", ue.reason)
+		}
+		return err
+	}
+	doctor, err := h.resolveDoctor(ctx, imp, first.req.Requester)
+	if err != nil {
+		if ue, ok := err.(*errUnresolved); ok {
+			return fail("%s", ue.reason)
+		}
+		return err
+	}
+
+	status := fhirImportMedicationRequestStatuses[first.req.Status]
+	prescription := &entity.Prescription{
+		PatientID:        patient.ID,
+		PatientName:      patient.FirstName + " " + patient.LastName,
+		DoctorID:         doctor.ID,
+		DoctorName:       doctor.FirstName + " " + doctor.LastName,
+		PrescriptionDate: authoredOn,
+		ValidUntil:       authoredOn.AddDate(0, 0, fhirImportValidityDays),
+		Status:           status,
+		IsActive:         status == entity.PrescriptionStatusActive,
+	}
+	if d := first.req.DispenseRequest; d != nil {
+		prescription.RefillsAllowed = d.NumberOfRepeatsAllowed
+		if d.ValidityPeriod != nil && d.ValidityPeriod.End != "" {
+			if end, err := parseRecordTime(d.ValidityPeriod.End); err == nil {
+				prescription.ValidUntil = end
+			}
+		}
+	}
+	if len(first.req.ReasonCode) > 0 {
+		prescription.Diagnosis = conceptText(&first.req.ReasonCode[0])
+	}
+	var notes []string
+	for _, n := range first.req.Note {
+		notes = append(notes, n.Text)
+	}
+	prescription.AdditionalInstructions = strings.Join(notes, "\n")
+	if status == entity.PrescriptionStatusRevoked && first.req.StatusReason != nil {
+		prescription.RevocationReason = conceptText(first.req.StatusReason)
+	}
+
+	meds := make([]*entity.Medication, 0, len(requests))
+	for _, r := range requests {
+		meds = append(meds, r.med)
+	}
+	prescription.Medications = entity.MarshalMedications(meds)
+	if err := h.prescriptionRepo.Create(ctx, prescription); err != nil {
+		return fmt.Errorf("failed to create prescription: %w", err)
+	}
+
+	items := make([]*entity.PrescriptionItem, 0, len(requests))
+	for i, r := range requests {
+		items = append(items, &entity.PrescriptionItem{
+			PrescriptionID: prescription.ID,
+			Position:       int32(i),
+			DrugCode:       r.med.DrugCode,
+			MedicationName: r.med.MedicationName,
+			DoseAmount:     r.med.DoseAmount,
+			DoseUnit:       r.med.DoseUnit,
+			FrequencyCode:  r.med.FrequencyCode,
+			DurationDays:   r.med.DurationDays,
+			Route:          r.med.Route,
+			Quantity:       r.med.Quantity,
+			Instructions:   r.med.Instructions,
+			DosageText:     r.med.Dosage,
+			FrequencyText:  r.med.Frequency,
+			DurationText:   r.med.Duration,
+		})
+	}
+	if err := h.prescriptionRepo.CreateItems(ctx, items); err != nil {
+		return fmt.Errorf("failed to create prescription items: %w", err)
+	}
+
+	for i, r := range requests {
+		r.entry.created(items[i].ID)
+		if err := h.link(ctx, imp, r.entry, r.keys, items[i].ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *FHIRImportHandler) resolvePatient(ctx context.Context, imp *fhirImport, ref *fhir.Reference) (*entity.Patient, error) {
+	id, err := h.resolve(ctx, imp, ref, "Patient")
+	if err != nil {
+		return nil, err
+	}
+	patient, err := h.patientRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		return nil, &errUnresolved{fmt.Sprintf("%s cannot be resolved", ref.Reference)}
+	}
+	return patient, nil
+}
+
+func (h *FHIRImportHandler) resolveDoctor(ctx context.Context, imp *fhirImport, ref *fhir.Reference) (*entity.Doctor, error) {
+	id, err := h.resolve(ctx, imp, ref, "Practitioner")
+	if err != nil {
+		return nil, err
+	}
+	doctor, err := h.doctorRepo.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		return nil, &errUnresolved{fmt.Sprintf("%s cannot be resolved", ref.Reference)}
+	}
+	return doctor, nil
+}
+
+// importMedication reads the medication and its first dosage instruction, or
+// returns nil if the request names no medication.
+func importMedication(req *fhir.MedicationRequest) *entity.Medication {
+	if req.MedicationCodeableConcept == nil {
+		return nil
+	}
+	med := &entity.Medication{MedicationName: conceptText(req.MedicationCodeableConcept)}
+	if med.MedicationName == "" {
+		return nil
+	}
+	if code, ok := codingIn(*req.MedicationCodeableConcept, fhir.SystemATC); ok {
+		med.DrugCode = code
+	}
+
+	if len(req.DosageInstruction) > 0 {
+		d := req.DosageInstruction[0]
+		med.Instructions = d.Text
+		if d.Route != nil {
+			med.Route = strings.ToLower(conceptText(d.Route))
+		}
+		if d.Timing != nil && d.Timing.Code != nil {
+			med.Frequency = conceptText(d.Timing.Code)
+			if len(d.Timing.Code.Coding) > 0 {
+				med.FrequencyCode = strings.ToUpper(d.Timing.Code.Coding[0].Code)
+			}
+		}
+		if len(d.DoseAndRate) > 0 && d.DoseAndRate[0].DoseQuantity != nil {
+			q := d.DoseAndRate[0].DoseQuantity
+			med.DoseAmount = q.Value
+			med.DoseUnit = q.Unit
+			if med.DoseUnit == "" {
+				med.DoseUnit = q.Code
+			}
+			med.Dosage = strings.TrimSpace(fmt.Sprintf("%g %s", q.Value, med.DoseUnit))
+		}
+	}
+	if d := req.DispenseRequest; d != nil {
+		if d.Quantity != nil {
+			med.Quantity = int32(d.Quantity.Value)
+		}
+		if s := d.ExpectedSupplyDuration; s != nil && (s.Code == "d" || strings.HasPrefix(s.Unit, "day")) {
+			med.DurationDays = int32(s.Value)
+			med.Duration = fmt.Sprintf("%d days", med.DurationDays)
+		}
+	}
+	return med
+}
+
+// importName splits the official name, or else the first one, into first
+// and last name.
+func importName(names []fhir.HumanName) (first, last string) {
+	if len(names) == 0 {
+		return "", ""
+	}
+	name := names[0]
+	for _, n := range names {
+		if n.Use == "official" {
+			name = n
+			break
+		}
+	}
+	first, last = strings.Join(name.Given, " "), name.Family
+	if (first == "" || last == "") && name.Text != "" {
+		if parts := strings.Fields(name.Text); len(parts) > 1 {
+			first, last = strings.Join(parts[:len(parts)-1], " "), parts[len(parts)-1]
+		}
+	}
+	return strings.TrimSpace(first), strings.TrimSpace(last)
+}
+
+// importTelecom returns the first email address and phone number.
+func importTelecom(telecom []fhir.ContactPoint) (email, phone string) {
+	for _, t := range telecom {
+		switch {
+		case t.System == "email" && email == "":
+			email = strings.ToLower(strings.TrimSpace(t.Value))
+		case t.System == "phone" && phone == "":
+			phone = strings.TrimSpace(t.Value)
+		}
+	}
+	return email, phone
+}
+
+// importLicense picks the license number among a practitioner's identifiers:
+// the one in this service's license system, else the official one, else the
+// first.
+func importLicense(identifiers []fhir.Identifier) string {
+	license := ""
+	for _, ident := range identifiers {
+		switch {
+		case ident.System == fhirLicenseSystem:
+			return ident.Value
+		case ident.Use == "official" || license == "":
+			license = ident.Value
+		}
+	}
+	return license
+}
+
+// conceptText is the text of a concept, or else the display or code of its
+// first coding.
+func conceptText(c *fhir.CodeableConcept) string {
+	if c.Text != "" {
+		return c.Text
+	}
+	for _, coding := range c.Coding {
+		if coding.Display != "" {
+			return coding.Display
+		}
+	}
+	for _, coding := range c.Coding {
+		if coding.Code != "" {
+			return coding.Code
+		}
+	}
+	return ""
+}
+
+// codingIn returns the code of the concept's coding in system.
+func codingIn(c fhir.CodeableConcept, system string) (string, bool) {
+	for _, coding := range c.Coding {
+		if coding.System == system && coding.Code != "" {
+			return coding.Code, true
+		}
+	}
+	return "", false
+}
+
+// fillString sets *dst to value if it is empty, reporting whether it did.
+func fillString(dst *string, value string) bool {
+	if *dst != "" || value == "" {
+		return false
+	}
+	*dst = value
+	return true
+}
@@ -0,0 +1,746 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/fhir"
+)
+
+// Slot searches cover a week from now unless start says otherwise, and at
+// most fhirMaxSlotWindow.
+const (
+	fhirDefaultSlotWindow = 7 * 24 * time.Hour
+	fhirMaxSlotWindow     = 31 * 24 * time.Hour
+)
+
+var fhirGenders = map[int32]string{
+	1: "male",
+	2: "female",
+	3: "other",
+}
+
+var fhirAppointmentStatuses = map[int32]string{
+	entity.AppointmentStatusUnspecified: "proposed",
+	entity.AppointmentStatusScheduled:   "booked",
+	entity.AppointmentStatusConfirmed:   "booked",
+	entity.AppointmentStatusInProgress:  "arrived",
+	entity.AppointmentStatusCompleted:   "fulfilled",
+	entity.AppointmentStatusCancelled:   "cancelled",
+	entity.AppointmentStatusNoShow:      "noshow",
+	entity.AppointmentStatusRescheduled: "cancelled",
+}
+
+var fhirConsultationTypes = map[int32]string{
+	entity.ConsultationTypeInPerson: "in-person",
+	entity.ConsultationTypeVideo:    "video",
+	entity.ConsultationTypePhone:    "phone",
+}
+
+var fhirMedicationRequestStatuses = map[string]string{
+	entity.PrescriptionStatusActive:  "active",
+	entity.PrescriptionStatusExpired: "completed",
+	entity.PrescriptionStatusRenewed: "completed",
+	entity.PrescriptionStatusRevoked: "stopped",
+	entity.PrescriptionStatusAmended: "stopped",
+}
+
+var fhirEncounterStatuses = map[string]string{
+	entity.MedicalRecordStatusDraft:          "in-progress",
+	entity.MedicalRecordStatusFinal:          "finished",
+	entity.MedicalRecordStatusEnteredInError: "entered-in-error",
+}
+
+var fhirConditionVerificationStatuses = map[string]string{
+	entity.MedicalRecordStatusDraft:          "provisional",
+	entity.MedicalRecordStatusFinal:          "confirmed",
+	entity.MedicalRecordStatusEnteredInError: "entered-in-error",
+}
+
+func (h *FHIRHandler) searchPatients(ctx context.Context, q *fhirQuery) ([]fhirMatch, int64, error) {
+	filters := make(map[string]interface{})
+	q.setID(filters)
+	q.setText("name", filters)
+	q.setText("family", filters)
+	q.setText("given", filters)
+	if email := q.params.Get("email"); email != "" {
+		_, filters["email"] = fhir.Token(email)
+	}
+	if phone := q.params.Get("phone"); phone != "" {
+		_, filters["phone"] = fhir.Token(phone)
+	}
+	if gender := q.params.Get("gender"); gender != "" {
+		_, code := fhir.Token(gender)
+		value := int32(0)
+		for g, c := range fhirGenders {
+			if c == code {
+				value = g
+			}
+		}
+		if value == 0 && code != "unknown" {
+			return nil, 0, fhir.Invalid("gender: unknown code %s", code)
+		}
+		filters["gender"] = value
+	}
+	from, to, err := fhir.DateRange("birthdate", q.params["birthdate"])
+	if err != nil {
+		return nil, 0, err
+	}
+	if from != nil {
+		filters["birthdate_from"] = from.Format(dateLayout)
+	}
+	if to != nil {
+		filters["birthdate_to"] = to.Format(dateLayout)
+	}
+	if active := q.params.Get("active"); active != "" {
+		v, err := strconv.ParseBool(active)
+		if err != nil {
+			return nil, 0, fhir.Invalid("active must be true or false")
+		}
+		filters["active"] = v
+	}
+
+	patients, total, err := h.repo.SearchPatients(ctx, filters, q.offset, q.count)
+	if err != nil {
+		return nil, 0, err
+	}
+	matches := make([]fhirMatch, 0, len(patients))
+	for _, p := range patients {
+		matches = append(matches, fhirMatch{id: p.ID, resource: fhirPatient(p)})
+	}
+	return matches, total, nil
+}
+
+func (h *FHIRHandler) searchPractitioners(ctx context.Context, q *fhirQuery) ([]fhirMatch, int64, error) {
+	filters := make(map[string]interface{})
+	q.setID(filters)
+	q.setText("name", filters)
+	q.setText("family", filters)
+	q.setText("given", filters)
+	if email := q.params.Get("email"); email != "" {
+		_, filters["email"] = fhir.Token(email)
+	}
+	if phone := q.params.Get("phone"); phone != "" {
+		_, filters["phone"] = fhir.Token(phone)
+	}
+	if identifier := q.params.Get("identifier"); identifier != "" {
+		system, value := fhir.Token(identifier)
+		if system != "" && system != fhirLicenseSystem {
+			return nil, 0, nil
+		}
+		filters["license_number"] = value
+	}
+
+	doctors, total, err := h.repo.SearchDoctors(ctx, filters, q.offset, q.count)
+	if err != nil {
+		return nil, 0, err
+	}
+	matches := make([]fhirMatch, 0, len(doctors))
+	for _, d := range doctors {
+		matches = append(matches, fhirMatch{id: d.ID, resource: fhirPractitioner(d)})
+	}
+	return matches, total, nil
+}
+
+func (h *FHIRHandler) searchAppointments(ctx context.Context, q *fhirQuery) ([]fhirMatch, int64, error) {
+	filters := make(map[string]interface{})
+	q.setID(filters)
+	if err := q.setReference("patient", "Patient", "patient_id", filters); err != nil {
+		return nil, 0, err
+	}
+	if err := q.setReference("practitioner", "Practitioner", "doctor_id", filters); err != nil {
+		return nil, 0, err
+	}
+	if err := q.setDates("date", filters); err != nil {
+		return nil, 0, err
+	}
+	if codes := q.codes("status"); len(codes) > 0 {
+		var statuses []int32
+		for _, code := range codes {
+			found := false
+			for status, c := range fhirAppointmentStatuses {
+				if c == code {
+					statuses = append(statuses, status)
+					found = true
+				}
+			}
+			if !found {
+				return nil, 0, fhir.Invalid("status: unknown code %s", code)
+			}
+		}
+		filters["statuses"] = statuses
+	}
+
+	appointments, total, err := h.repo.SearchAppointments(ctx, filters, q.offset, q.count)
+	if err != nil {
+		return nil, 0, err
+	}
+	matches := make([]fhirMatch, 0, len(appointments))
+	for _, a := range appointments {
+		matches = append(matches, fhirMatch{id: a.ID, resource: fhirAppointment(a)})
+	}
+	return matches, total, nil
+}
+
+// searchMedicationRequests searches prescription items, each of which is a
+// MedicationRequest grouped by its prescription.
+func (h *FHIRHandler) searchMedicationRequests(ctx context.Context, q *fhirQuery) ([]fhirMatch, int64, error) {
+	filters := make(map[string]interface{})
+	q.setID(filters)
+	if err := q.setReference("patient", "Patient", "patient_id", filters); err != nil {
+		return nil, 0, err
+	}
+	if err := q.setReference("requester", "Practitioner", "doctor_id", filters); err != nil {
+		return nil, 0, err
+	}
+	if err := q.setDates("authoredon", filters); err != nil {
+		return nil, 0, err
+	}
+	if code := q.params.Get("code"); code != "" {
+		system, value := fhir.Token(code)
+		if system != "" && system != fhir.SystemATC {
+			return nil, 0, nil
+		}
+		filters["drug_code"] = value
+	}
+	statuses, err := q.statusCodes("status", fhirMedicationRequestStatuses)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(statuses) > 0 {
+		filters["statuses"] = statuses
+	}
+
+	items, total, err := h.repo.SearchPrescriptionItems(ctx, filters, q.offset, q.count)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.PrescriptionID)
+	}
+	prescriptions, err := h.repo.GetPrescriptions(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[string]*entity.Prescription, len(prescriptions))
+	for _, p := range prescriptions {
+		byID[p.ID] = p
+	}
+
+	matches := make([]fhirMatch, 0, len(items))
+	for _, item := range items {
+		p, ok := byID[item.PrescriptionID]
+		if !ok {
+			continue
+		}
+		matches = append(matches, fhirMatch{id: item.ID, resource: fhirMedicationRequest(item, p)})
+	}
+	return matches, total, nil
+}
+
+func (h *FHIRHandler) searchEncounters(ctx context.Context, q *fhirQuery) ([]fhirMatch, int64, error) {
+	filters := make(map[string]interface{})
+	q.setID(filters)
+	if err := q.setReference("patient", "Patient", "patient_id", filters); err != nil {
+		return nil, 0, err
+	}
+	if err := q.setReference("practitioner", "Practitioner", "doctor_id", filters); err != nil {
+		return nil, 0, err
+	}
+	if err := q.setDates("date", filters); err != nil {
+		return nil, 0, err
+	}
+	statuses, err := q.statusCodes("status", fhirEncounterStatuses)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(statuses) > 0 {
+		filters["statuses"] = statuses
+	}
+
+	records, total, err := h.repo.SearchMedicalRecords(ctx, filters, q.offset, q.count)
+	if err != nil {
+		return nil, 0, err
+	}
+	matches := make([]fhirMatch, 0, len(records))
+	for _, r := range records {
+		matches = append(matches, fhirMatch{id: r.ID, resource: fhirEncounter(r)})
+	}
+	return matches, total, nil
+}
+
+// searchConditions searches the diagnoses of medical records. A Condition
+// shares its ID with the Encounter of the record it comes from.
+func (h *FHIRHandler) searchConditions(ctx context.Context, q *fhirQuery) ([]fhirMatch, int64, error) {
+	filters := map[string]interface{}{"has_diagnosis": true}
+	q.setID(filters)
+	if err := q.setReference("patient", "Patient", "patient_id", filters); err != nil {
+		return nil, 0, err
+	}
+	if v := q.params.Get("encounter"); v != "" {
+		id, err := fhir.ReferenceID("encounter", v, "Encounter")
+		if err != nil {
+			return nil, 0, err
+		}
+		if other, ok := filters["id"]; ok && other != id {
+			return nil, 0, nil
+		}
+		filters["id"] = id
+	}
+	if err := q.setDates("recorded-date", filters); err != nil {
+		return nil, 0, err
+	}
+	statuses, err := q.statusCodes("verification-status", fhirConditionVerificationStatuses)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(statuses) > 0 {
+		filters["statuses"] = statuses
+	}
+
+	records, total, err := h.repo.SearchMedicalRecords(ctx, filters, q.offset, q.count)
+	if err != nil {
+		return nil, 0, err
+	}
+	matches := make([]fhirMatch, 0, len(records))
+	for _, r := range records {
+		matches = append(matches, fhirMatch{id: r.ID, resource: fhirCondition(r)})
+	}
+	return matches, total, nil
+}
+
+// searchSchedules searches doctors' weekly availability. Every doctor has one
+// Schedule, sharing the doctor's ID.
+func (h *FHIRHandler) searchSchedules(ctx context.Context, q *fhirQuery) ([]fhirMatch, int64, error) {
+	filters := make(map[string]interface{})
+	q.setID(filters)
+	if v := q.params.Get("actor"); v != "" {
+		id, err := fhir.ReferenceID("actor", v, "Practitioner")
+		if err != nil {
+			return nil, 0, err
+		}
+		if other, ok := filters["id"]; ok && other != id {
+			return nil, 0, nil
+		}
+		filters["id"] = id
+	}
+
+	doctors, total, err := h.repo.SearchDoctors(ctx, filters, q.offset, q.count)
+	if err != nil {
+		return nil, 0, err
+	}
+	matches := make([]fhirMatch, 0, len(doctors))
+	for _, d := range doctors {
+		_, windows, err := loadScheduleWindows(ctx, h.doctorRepo, h.clinicRepo, d, "")
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to load schedule of doctor %s: %v", d.ID, err)
+			return nil, 0, err
+		}
+		matches = append(matches, fhirMatch{id: d.ID, resource: fhirSchedule(d, windows)})
+	}
+	return matches, total, nil
+}
+
+// searchSlots lays out one doctor's slots over a date range, marking those
+// that overlap an appointment busy. Slots are not stored; a slot's ID is the
+// doctor's ID and its start in Unix seconds, separated by a dot.
+func (h *FHIRHandler) searchSlots(ctx context.Context, q *fhirQuery) ([]fhirMatch, int64, error) {
+	var doctorID string
+	var from, to *time.Time
+	if id := q.params.Get("_id"); id != "" {
+		i := strings.LastIndexByte(id, '.')
+		if i < 0 {
+			return nil, 0, nil
+		}
+		sec, err := strconv.ParseInt(id[i+1:], 10, 64)
+		if err != nil {
+			return nil, 0, nil
+		}
+		start := time.Unix(sec, 0).UTC()
+		end := start.Add(time.Second)
+		doctorID, from, to = id[:i], &start, &end
+	}
+	if v := q.params.Get("schedule"); v != "" {
+		id, err := fhir.ReferenceID("schedule", v, "Schedule")
+		if err != nil {
+			return nil, 0, err
+		}
+		if doctorID != "" && doctorID != id {
+			return nil, 0, nil
+		}
+		doctorID = id
+	}
+	if doctorID == "" {
+		return nil, 0, fhir.Invalid("schedule is required to search slots")
+	}
+
+	startFrom, startTo, err := fhir.DateRange("start", q.params["start"])
+	if err != nil {
+		return nil, 0, err
+	}
+	if startFrom != nil && (from == nil || startFrom.After(*from)) {
+		from = startFrom
+	}
+	if startTo != nil && (to == nil || startTo.Before(*to)) {
+		to = startTo
+	}
+	if from == nil {
+		now := time.Now().UTC()
+		from = &now
+	}
+	if to == nil {
+		end := from.Add(fhirDefaultSlotWindow)
+		to = &end
+	}
+	if to.Sub(*from) > fhirMaxSlotWindow {
+		return nil, 0, fhir.Invalid("start may span at most %d days", int(fhirMaxSlotWindow/(24*time.Hour)))
+	}
+	if !to.After(*from) {
+		return nil, 0, nil
+	}
+
+	var wantFree, wantBusy bool
+	for _, code := range q.codes("status") {
+		switch code {
+		case "free":
+			wantFree = true
+		case "busy":
+			wantBusy = true
+		default:
+			return nil, 0, fhir.Invalid("status: unknown code %s", code)
+		}
+	}
+	if !wantFree && !wantBusy {
+		wantFree, wantBusy = true, true
+	}
+
+	doctor, err := h.doctorRepo.Get(ctx, doctorID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, 0, fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		return nil, 0, nil
+	}
+	loc, windows, err := loadScheduleWindows(ctx, h.doctorRepo, h.clinicRepo, doctor, "")
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to load schedule of doctor %s: %v", doctor.ID, err)
+		return nil, 0, err
+	}
+	existing, err := h.appointmentRepo.GetByDoctorInRange(ctx, doctor.ID, *from, *to)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get existing appointments: %v", err)
+		return nil, 0, fmt.Errorf("failed to get existing appointments: %w", err)
+	}
+
+	// Windows may be in other zones than the doctor's, so the days around
+	// the range are laid out too and their slots filtered by the range.
+	first := from.In(loc)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -1)
+	var slots []*fhir.Slot
+	for ; day.Before(to.AddDate(0, 0, 1)); day = day.AddDate(0, 0, 1) {
+		for _, s := range generateSlots(day, windows) {
+			if s.start.Before(*from) || !s.start.Before(*to) {
+				continue
+			}
+			busy := false
+			for _, apt := range existing {
+				if apt.StartsAt.Before(s.end) && apt.EndsAt.After(s.start) {
+					busy = true
+					break
+				}
+			}
+			if (busy && wantBusy) || (!busy && wantFree) {
+				slots = append(slots, fhirSlot(doctor.ID, s, busy))
+			}
+		}
+	}
+	sort.SliceStable(slots, func(i, j int) bool { return slots[i].Start < slots[j].Start })
+
+	total := int64(len(slots))
+	if q.offset >= len(slots) {
+		return nil, total, nil
+	}
+	slots = slots[q.offset:]
+	if len(slots) > q.count {
+		slots = slots[:q.count]
+	}
+	matches := make([]fhirMatch, 0, len(slots))
+	for _, s := range slots {
+		matches = append(matches, fhirMatch{id: s.ID, resource: s})
+	}
+	return matches, total, nil
+}
+
+func fhirPatient(p *entity.Patient) *fhir.Patient {
+	patient := &fhir.Patient{
+		ResourceType: "Patient",
+		ID:           p.ID,
+		Meta:         &fhir.Meta{LastUpdated: fhir.Instant(p.UpdatedAt)},
+		Active:       fhir.Bool(p.MergedInto == ""),
+		Name:         fhirName(p.FirstName, p.LastName),
+		Telecom:      fhirTelecom(p.Email, p.PhoneNumber),
+		Gender:       fhirGenders[p.Gender],
+		BirthDate:    p.DateOfBirth,
+	}
+	if addr := entity.UnmarshalAddress(p.Address); addr != nil {
+		a := fhir.Address{City: addr.City, State: addr.State, PostalCode: addr.ZipCode, Country: addr.Country}
+		if addr.Street != "" {
+			a.Line = []string{addr.Street}
+		}
+		patient.Address = []fhir.Address{a}
+	}
+	if p.MergedInto != "" {
+		patient.Link = []fhir.PatientLink{{Other: *fhir.Ref("Patient", p.MergedInto), Type: "replaced-by"}}
+	}
+	return patient
+}
+
+func fhirPractitioner(d *entity.Doctor) *fhir.Practitioner {
+	practitioner := &fhir.Practitioner{
+		ResourceType: "Practitioner",
+		ID:           d.ID,
+		Meta:         &fhir.Meta{LastUpdated: fhir.Instant(d.UpdatedAt)},
+		Identifier:   []fhir.Identifier{{Use: "official", System: fhirLicenseSystem, Value: d.LicenseNumber}},
+		Active:       fhir.Bool(true),
+		Name:         fhirName(d.FirstName, d.LastName),
+		Telecom:      fhirTelecom(d.Email, d.PhoneNumber),
+	}
+	if d.Specialization > 0 {
+		practitioner.Qualification = append(practitioner.Qualification, fhir.PractitionerQualification{
+			Code: fhir.CodeableConcept{Coding: []fhir.Coding{{System: fhirSpecializationSystem, Code: strconv.Itoa(int(d.Specialization))}}},
+		})
+	}
+	for _, q := range entity.UnmarshalStringArray(d.Qualifications) {
+		practitioner.Qualification = append(practitioner.Qualification, fhir.PractitionerQualification{Code: fhir.CodeableConcept{Text: q}})
+	}
+	for _, lang := range entity.UnmarshalStringArray(d.Languages) {
+		practitioner.Communication = append(practitioner.Communication, fhir.CodeableConcept{Text: lang})
+	}
+	return practitioner
+}
+
+func fhirAppointment(a *entity.Appointment) *fhir.Appointment {
+	appointment := &fhir.Appointment{
+		ResourceType:    "Appointment",
+		ID:              a.ID,
+		Meta:            &fhir.Meta{LastUpdated: fhir.Instant(a.UpdatedAt)},
+		Status:          fhirAppointmentStatuses[a.Status],
+		Description:     a.ReasonForVisit,
+		Start:           fhir.Instant(a.StartsAt),
+		End:             fhir.Instant(a.EndsAt),
+		MinutesDuration: int(a.EndsAt.Sub(a.StartsAt) / time.Minute),
+		Created:         fhir.Instant(a.CreatedAt),
+		Comment:         a.Notes,
+	}
+	if t, ok := fhirConsultationTypes[a.ConsultationType]; ok {
+		appointment.AppointmentType = &fhir.CodeableConcept{Text: t}
+	}
+	if a.ReasonForVisit != "" {
+		appointment.ReasonCode = []fhir.CodeableConcept{{Text: a.ReasonForVisit}}
+	}
+	if a.CancellationReason != "" {
+		appointment.CancelationReason = &fhir.CodeableConcept{Text: a.CancellationReason}
+	}
+
+	patient := fhir.Ref("Patient", a.PatientID)
+	patient.Display = a.PatientName
+	doctor := fhir.Ref("Practitioner", a.DoctorID)
+	doctor.Display = a.DoctorName
+	appointment.Participant = []fhir.AppointmentParticipant{
+		{Actor: patient, Required: "required", Status: "accepted"},
+		{Actor: doctor, Required: "required", Status: "accepted"},
+	}
+	return appointment
+}
+
+func fhirMedicationRequest(item *entity.PrescriptionItem, p *entity.Prescription) *fhir.MedicationRequest {
+	patient := fhir.Ref("Patient", p.PatientID)
+	patient.Display = p.PatientName
+	doctor := fhir.Ref("Practitioner", p.DoctorID)
+	doctor.Display = p.DoctorName
+
+	medication := &fhir.CodeableConcept{Text: item.MedicationName}
+	if item.DrugCode != "" {
+		medication.Coding = []fhir.Coding{{System: fhir.SystemATC, Code: item.DrugCode, Display: item.DrugName}}
+	}
+
+	var text []string
+	for _, s := range []string{item.DosageText, item.FrequencyText, item.DurationText, item.Instructions} {
+		if s != "" {
+			text = append(text, s)
+		}
+	}
+	dosage := fhir.Dosage{Sequence: int(item.Position) + 1, Text: strings.Join(text, ", ")}
+	if item.FrequencyCode != "" {
+		dosage.Timing = &fhir.Timing{Code: &fhir.CodeableConcept{
+			Coding: []fhir.Coding{{System: fhir.SystemTiming, Code: item.FrequencyCode}},
+			Text:   item.FrequencyText,
+		}}
+	}
+	if item.Route != "" {
+		dosage.Route = &fhir.CodeableConcept{Text: item.Route}
+	}
+	if item.DoseAmount > 0 {
+		dosage.DoseAndRate = []fhir.DoseAndRate{{DoseQuantity: &fhir.Quantity{Value: item.DoseAmount, Unit: item.DoseUnit}}}
+	}
+
+	dispense := &fhir.DispenseRequest{
+		ValidityPeriod:         &fhir.Period{Start: fhir.Instant(p.PrescriptionDate), End: fhir.Instant(p.ValidUntil)},
+		NumberOfRepeatsAllowed: p.RefillsAllowed,
+	}
+	if item.Quantity > 0 {
+		dispense.Quantity = &fhir.Quantity{Value: float64(item.Quantity)}
+	}
+	if item.DurationDays > 0 {
+		dispense.ExpectedSupplyDuration = &fhir.Quantity{Value: float64(item.DurationDays), Unit: "days", System: fhir.SystemUCUM, Code: "d"}
+	}
+
+	request := &fhir.MedicationRequest{
+		ResourceType:              "MedicationRequest",
+		ID:                        item.ID,
+		Meta:                      &fhir.Meta{LastUpdated: fhir.Instant(item.CreatedAt)},
+		Status:                    fhirMedicationRequestStatuses[p.Status],
+		Intent:                    "order",
+		MedicationCodeableConcept: medication,
+		Subject:                   *patient,
+		AuthoredOn:                fhir.Instant(p.PrescriptionDate),
+		Requester:                 doctor,
+		GroupIdentifier:           &fhir.Identifier{System: fhirPrescriptionSystem, Value: p.ID},
+		DosageInstruction:         []fhir.Dosage{dosage},
+		DispenseRequest:           dispense,
+	}
+	if request.Status == "" {
+		request.Status = "unknown"
+	}
+	if p.RevocationReason != "" {
+		request.StatusReason = &fhir.CodeableConcept{Text: p.RevocationReason}
+	}
+	if p.Diagnosis != "" {
+		request.ReasonCode = []fhir.CodeableConcept{{Text: p.Diagnosis}}
+	}
+	if p.AdditionalInstructions != "" {
+		request.Note = []fhir.Annotation{{Text: p.AdditionalInstructions}}
+	}
+	return request
+}
+
+func fhirEncounter(r *entity.MedicalRecord) *fhir.Encounter {
+	encounter := &fhir.Encounter{
+		ResourceType: "Encounter",
+		ID:           r.ID,
+		Meta:         fhirRecordMeta(r),
+		Status:       fhirEncounterStatuses[r.Status],
+		Class:        fhir.Coding{System: fhir.SystemActCode, Code: "AMB", Display: "ambulatory"},
+		Subject:      fhir.Ref("Patient", r.PatientID),
+		Period:       &fhir.Period{Start: fhir.Instant(r.VisitDate)},
+	}
+	if r.RecordType != "" {
+		encounter.Type = []fhir.CodeableConcept{{Text: r.RecordType}}
+	}
+	if r.DoctorID != "" {
+		encounter.Participant = []fhir.EncounterParticipant{{Individual: fhir.Ref("Practitioner", r.DoctorID)}}
+	}
+	if r.Symptoms != "" {
+		encounter.ReasonCode = []fhir.CodeableConcept{{Text: r.Symptoms}}
+	}
+	if r.Diagnosis != "" {
+		encounter.Diagnosis = []fhir.EncounterDiagnosis{{Condition: *fhir.Ref("Condition", r.ID)}}
+	}
+	return encounter
+}
+
+func fhirCondition(r *entity.MedicalRecord) *fhir.Condition {
+	condition := &fhir.Condition{
+		ResourceType: "Condition",
+		ID:           r.ID,
+		Meta:         fhirRecordMeta(r),
+		VerificationStatus: &fhir.CodeableConcept{Coding: []fhir.Coding{
+			{System: fhir.SystemConditionVer, Code: fhirConditionVerificationStatuses[r.Status]},
+		}},
+		Category: []fhir.CodeableConcept{{Coding: []fhir.Coding{
+			{System: fhir.SystemConditionCat, Code: "encounter-diagnosis"},
+		}}},
+		Code:         &fhir.CodeableConcept{Text: r.Diagnosis},
+		Subject:      *fhir.Ref("Patient", r.PatientID),
+		Encounter:    fhir.Ref("Encounter", r.ID),
+		RecordedDate: fhir.Instant(r.VisitDate),
+	}
+	if r.DoctorID != "" {
+		condition.Recorder = fhir.Ref("Practitioner", r.DoctorID)
+	}
+	return condition
+}
+
+func fhirSchedule(d *entity.Doctor, windows []scheduleWindow) *fhir.Schedule {
+	actor := fhir.Ref("Practitioner", d.ID)
+	actor.Display = strings.TrimSpace(d.FirstName + " " + d.LastName)
+
+	var hours []string
+	for _, w := range windows {
+		day := w.DayOfWeek
+		if day == "" {
+			day = "Daily"
+		}
+		hours = append(hours, fmt.Sprintf("%s %s-%s %s", day, w.StartTime, w.EndTime, w.loc))
+	}
+
+	schedule := &fhir.Schedule{
+		ResourceType: "Schedule",
+		ID:           d.ID,
+		Meta:         &fhir.Meta{LastUpdated: fhir.Instant(d.UpdatedAt)},
+		Active:       fhir.Bool(d.IsAvailable),
+		Actor:        []fhir.Reference{*actor},
+		Comment:      strings.Join(hours, "; "),
+	}
+	if d.Specialization > 0 {
+		schedule.Specialty = []fhir.CodeableConcept{{Coding: []fhir.Coding{
+			{System: fhirSpecializationSystem, Code: strconv.Itoa(int(d.Specialization))},
+		}}}
+	}
+	return schedule
+}
+
+func fhirSlot(doctorID string, s slot, busy bool) *fhir.Slot {
+	status := "free"
+	if busy {
+		status = "busy"
+	}
+	return &fhir.Slot{
+		ResourceType: "Slot",
+		ID:           doctorID + "." + strconv.FormatInt(s.start.Unix(), 10),
+		Schedule:     *fhir.Ref("Schedule", doctorID),
+		Status:       status,
+		Start:        fhir.Instant(s.start),
+		End:          fhir.Instant(s.end),
+	}
+}
+
+func fhirRecordMeta(r *entity.MedicalRecord) *fhir.Meta {
+	return &fhir.Meta{VersionID: strconv.Itoa(int(r.Version)), LastUpdated: fhir.Instant(r.UpdatedAt)}
+}
+
+func fhirName(first, last string) []fhir.HumanName {
+	name := fhir.HumanName{Use: "official", Text: strings.TrimSpace(first + " " + last), Family: last}
+	if first != "" {
+		name.Given = []string{first}
+	}
+	return []fhir.HumanName{name}
+}
+
+func fhirTelecom(email, phone string) []fhir.ContactPoint {
+	var telecom []fhir.ContactPoint
+	if phone != "" {
+		telecom = append(telecom, fhir.ContactPoint{System: "phone", Value: phone})
+	}
+	if email != "" {
+		telecom = append(telecom, fhir.ContactPoint{System: "email", Value: email})
+	}
+	return telecom
+}
@@ -0,0 +1,513 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	commonpb "github.com/arm-1234/common-protos/medical/v1/common"
+	requestpb "github.com/arm-1234/common-protos/medical/v1/request"
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/hl7"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+var hl7Sexes = map[int32]string{
+	1: "M",
+	2: "F",
+	3: "O",
+}
+
+var hl7AppointmentTypes = map[int32]string{
+	entity.ConsultationTypeInPerson: "OFFICE",
+	entity.ConsultationTypeVideo:    "VIDEO",
+	entity.ConsultationTypePhone:    "PHONE",
+}
+
+// HL7Handler applies the ADT and SIU messages hospital partners send over
+// MLLP. Partner identifiers are linked to the patients and appointments they
+// were applied to, as imported resources keyed by the sending facility.
+type HL7Handler struct {
+	patients        *PatientHandler
+	appointments    *AppointmentHandler
+	repo            data.ImportRepo
+	patientRepo     data.PatientRepo
+	doctorRepo      data.DoctorRepo
+	appointmentRepo data.AppointmentRepo
+	tx              data.Transaction
+	log             *log.Helper
+}
+
+func NewHL7Handler(
+	patients *PatientHandler,
+	appointments *AppointmentHandler,
+	repo data.ImportRepo,
+	patientRepo data.PatientRepo,
+	doctorRepo data.DoctorRepo,
+	appointmentRepo data.AppointmentRepo,
+	tx data.Transaction,
+	logger log.Logger,
+) *HL7Handler {
+	return &HL7Handler{
+		patients:        patients,
+		appointments:    appointments,
+		repo:            repo,
+		patientRepo:     patientRepo,
+		doctorRepo:      doctorRepo,
+		appointmentRepo: appointmentRepo,
+		tx:              tx,
+		log:             log.NewHelper(logger),
+	}
+}
+
+// hl7Origin marks a context as applying a partner's message, so the change
+// is not notified back to the partner.
+type hl7Origin struct{}
+
+func fromHL7(ctx context.Context) bool {
+	origin, _ := ctx.Value(hl7Origin{}).(bool)
+	return origin
+}
+
+// HandleMessage applies m. Messages of other types or trigger events fail
+// with hl7.ErrUnsupported.
+func (h *HL7Handler) HandleMessage(ctx context.Context, m *hl7.Message) error {
+	ctx, span := otel.Trace(ctx, "HL7Handler.HandleMessage")
+	defer span.End()
+
+	ctx = context.WithValue(ctx, hl7Origin{}, true)
+	switch m.Type() {
+	case "ADT^A04", "ADT^A08":
+		return h.handleADT(ctx, m)
+	case "SIU^" + hl7.EventBooked:
+		return h.bookAppointment(ctx, m)
+	case "SIU^" + hl7.EventRescheduled, "SIU^" + hl7.EventModified:
+		return h.modifyAppointment(ctx, m)
+	case "SIU^" + hl7.EventCancelled:
+		return h.cancelAppointment(ctx, m)
+	}
+	return fmt.Errorf("%w %s", hl7.ErrUnsupported, m.Type())
+}
+
+// handleADT registers the patient of an A04 or A08 message, or updates the
+// patient it was registered as before. Either event registers a patient
+// that is not known yet.
+func (h *HL7Handler) handleADT(ctx context.Context, m *hl7.Message) error {
+	adt, err := hl7.ParseADT(m)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid ADT message %s: %v", m.ControlID(), err)
+		return err
+	}
+
+	patient, err := h.findPatient(ctx, m, adt.Patient)
+	if err != nil {
+		return err
+	}
+	if patient == nil {
+		_, err := h.registerPatient(ctx, m, adt.Patient)
+		return err
+	}
+
+	p := adt.Patient
+	req := &requestpb.UpdatePatientRequest{
+		PatientId:   patient.ID,
+		FirstName:   optionalString(p.FirstName),
+		LastName:    optionalString(p.LastName),
+		DateOfBirth: optionalString(p.BirthDate),
+		PhoneNumber: optionalString(p.Phone),
+		Email:       optionalString(p.Email),
+		Address:     hl7Address(p),
+	}
+	if gender := hl7Gender(p.Sex); gender != 0 {
+		req.Gender = &gender
+	}
+	return h.tx.InTx(ctx, func(ctx context.Context) error {
+		if _, err := h.patients.UpdatePatient(ctx, patient.ID, req); err != nil {
+			return err
+		}
+		return h.link(ctx, "Patient", hl7PatientSystem(m, p), p.ID, patient.ID)
+	})
+}
+
+// findPatient returns the patient a PID identity names: one linked to it
+// before, one of ours it names by ID, or else one with the same email or
+// phone number.
+func (h *HL7Handler) findPatient(ctx context.Context, m *hl7.Message, p *hl7.PatientIdentity) (*entity.Patient, error) {
+	id := ""
+	if p.Authority == hl7.Application {
+		id = p.ID
+	} else {
+		link, err := h.repo.GetImported(ctx, "Patient", hl7PatientSystem(m, p), p.ID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get linked patient: %v", err)
+			return nil, fmt.Errorf("failed to get linked patient: %w", err)
+		}
+		if link != nil {
+			id = link.LocalID
+		}
+	}
+	if id != "" {
+		patient, err := h.patientRepo.Get(ctx, id)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+			return nil, fmt.Errorf("failed to get patient: %w", err)
+		}
+		if patient != nil {
+			return patient, nil
+		}
+	}
+
+	if p.Email != "" {
+		patient, err := h.patientRepo.GetByEmail(ctx, p.Email)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to check existing email: %v", err)
+			return nil, fmt.Errorf("failed to check existing email: %w", err)
+		}
+		if patient != nil {
+			return patient, nil
+		}
+	}
+	if p.Phone != "" {
+		patient, err := h.patientRepo.GetByPhone(ctx, p.Phone)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to check existing phone: %v", err)
+			return nil, fmt.Errorf("failed to check existing phone: %w", err)
+		}
+		if patient != nil {
+			return patient, nil
+		}
+	}
+	return nil, nil
+}
+
+// registerPatient registers the patient of a PID identity and links the
+// identity to it in one transaction, so a failed link leaves no patient that
+// the next message would register again.
+func (h *HL7Handler) registerPatient(ctx context.Context, m *hl7.Message, p *hl7.PatientIdentity) (string, error) {
+	req := &requestpb.RegisterPatientRequest{
+		FirstName:   p.FirstName,
+		LastName:    p.LastName,
+		Email:       p.Email,
+		PhoneNumber: p.Phone,
+		DateOfBirth: p.BirthDate,
+		Gender:      hl7Gender(p.Sex),
+		Address:     hl7Address(p),
+	}
+	var patientID string
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		resp, err := h.patients.RegisterPatient(ctx, req)
+		if err != nil {
+			return err
+		}
+		patientID = resp.PatientId
+		return h.link(ctx, "Patient", hl7PatientSystem(m, p), p.ID, patientID)
+	})
+	if err != nil {
+		return "", err
+	}
+	return patientID, nil
+}
+
+// bookAppointment books the appointment of an S12 message. A message for an
+// appointment booked before is accepted without booking it again. The
+// booking and its link to the placer ID commit together, so a partner
+// resending the message after a lost ACK finds the link instead of
+// conflicting with its own slot.
+func (h *HL7Handler) bookAppointment(ctx context.Context, m *hl7.Message) error {
+	siu, err := hl7.ParseSIU(m)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid SIU message %s: %v", m.ControlID(), err)
+		return err
+	}
+	if siu.PlacerID == "" {
+		h.log.WithContext(ctx).Errorf("SIU message %s has no placer appointment ID", m.ControlID())
+		return fmt.Errorf("SCH-1: placer appointment ID is required")
+	}
+
+	system := hl7System(m)
+	link, err := h.repo.GetImported(ctx, "Appointment", system, siu.PlacerID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get linked appointment: %v", err)
+		return fmt.Errorf("failed to get linked appointment: %w", err)
+	}
+	if link != nil {
+		h.log.WithContext(ctx).Infof("Appointment %s already booked as %s", siu.PlacerID, link.LocalID)
+		return nil
+	}
+
+	return h.tx.InTx(ctx, func(ctx context.Context) error {
+		patient, err := h.findPatient(ctx, m, siu.Patient)
+		if err != nil {
+			return err
+		}
+		patientID := ""
+		if patient != nil {
+			patientID = patient.ID
+		} else if patientID, err = h.registerPatient(ctx, m, siu.Patient); err != nil {
+			return err
+		}
+
+		doctor, err := h.findDoctor(ctx, m, siu.PersonnelID)
+		if err != nil {
+			return err
+		}
+		start, err := h.start(ctx, doctor, siu)
+		if err != nil {
+			return err
+		}
+
+		consultationType := int32(entity.ConsultationTypeInPerson)
+		for t, code := range hl7AppointmentTypes {
+			if code == siu.Type {
+				consultationType = t
+			}
+		}
+		resp, err := h.appointments.BookAppointment(ctx, &requestpb.BookAppointmentRequest{
+			PatientId:        patientID,
+			DoctorId:         doctor.ID,
+			AppointmentDate:  start.Format(dateLayout),
+			AppointmentTime:  start.Format(clockLayout),
+			ConsultationType: commonpb.ConsultationType(consultationType),
+			ReasonForVisit:   siu.Reason,
+		})
+		if err != nil {
+			return err
+		}
+		return h.link(ctx, "Appointment", system, siu.PlacerID, resp.AppointmentId)
+	})
+}
+
+// modifyAppointment moves the appointment of an S13 or S14 message to the
+// start time it gives. Other changes are not taken over.
+func (h *HL7Handler) modifyAppointment(ctx context.Context, m *hl7.Message) error {
+	siu, err := hl7.ParseSIU(m)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid SIU message %s: %v", m.ControlID(), err)
+		return err
+	}
+	appointment, err := h.findAppointment(ctx, m, siu)
+	if err != nil {
+		return err
+	}
+	doctor, err := h.doctorRepo.Get(ctx, appointment.DoctorID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", appointment.DoctorID)
+		return fmt.Errorf("doctor not found")
+	}
+	start, err := h.start(ctx, doctor, siu)
+	if err != nil {
+		return err
+	}
+	if start.Equal(appointment.StartsAt) {
+		return nil
+	}
+
+	_, err = h.appointments.RescheduleAppointment(ctx, &requestpb.RescheduleAppointmentRequest{
+		AppointmentId:      appointment.ID,
+		NewAppointmentDate: start.Format(dateLayout),
+		NewAppointmentTime: start.Format(clockLayout),
+		Reason:             siu.EventReason,
+	})
+	return err
+}
+
+// cancelAppointment cancels the appointment of an S15 message. Cancelling
+// an appointment that is already cancelled is accepted.
+func (h *HL7Handler) cancelAppointment(ctx context.Context, m *hl7.Message) error {
+	siu, err := hl7.ParseSIU(m)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid SIU message %s: %v", m.ControlID(), err)
+		return err
+	}
+	appointment, err := h.findAppointment(ctx, m, siu)
+	if err != nil {
+		return err
+	}
+	if appointment.Status == entity.AppointmentStatusCancelled {
+		return nil
+	}
+	_, err = h.appointments.CancelAppointment(ctx, appointment.ID, siu.EventReason)
+	return err
+}
+
+// findAppointment returns the appointment an SIU message is about: the one
+// its placer ID was booked as, or ours it names by filler ID.
+func (h *HL7Handler) findAppointment(ctx context.Context, m *hl7.Message, siu *hl7.SIU) (*entity.Appointment, error) {
+	id := siu.FillerID
+	if siu.PlacerID != "" {
+		link, err := h.repo.GetImported(ctx, "Appointment", hl7System(m), siu.PlacerID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get linked appointment: %v", err)
+			return nil, fmt.Errorf("failed to get linked appointment: %w", err)
+		}
+		if link != nil {
+			id = link.LocalID
+		}
+	}
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("Appointment %s not found", siu.PlacerID)
+		return nil, fmt.Errorf("appointment not found")
+	}
+
+	appointment, err := h.appointmentRepo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get appointment: %v", err)
+		return nil, fmt.Errorf("failed to get appointment: %w", err)
+	}
+	if appointment == nil {
+		h.log.WithContext(ctx).Errorf("Appointment not found: %s", id)
+		return nil, fmt.Errorf("appointment not found")
+	}
+	return appointment, nil
+}
+
+// findDoctor returns the doctor an AIP-3 identifier names: ours by ID, or
+// one with that license number.
+func (h *HL7Handler) findDoctor(ctx context.Context, m *hl7.Message, id string) (*entity.Doctor, error) {
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("SIU message %s has no personnel", m.ControlID())
+		return nil, fmt.Errorf("AIP-3: doctor is required")
+	}
+
+	doctor, err := h.doctorRepo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		if doctor, err = h.doctorRepo.GetByLicense(ctx, id); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get doctor by license: %v", err)
+			return nil, fmt.Errorf("failed to get doctor: %w", err)
+		}
+	}
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", id)
+		return nil, fmt.Errorf("doctor not found")
+	}
+	return doctor, nil
+}
+
+// start reads the start time of an SIU message in the doctor's time zone,
+// taking a time without an offset as local to the doctor.
+func (h *HL7Handler) start(ctx context.Context, doctor *entity.Doctor, siu *hl7.SIU) (time.Time, error) {
+	if siu.Start == "" {
+		return time.Time{}, fmt.Errorf("SCH-11: appointment start time is required")
+	}
+	loc, _, err := h.appointments.scheduleWindows(ctx, doctor, "")
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to load doctor schedule: %v", err)
+		return time.Time{}, err
+	}
+	start, err := hl7.ParseTimeIn(siu.Start, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("SCH-11: %w", err)
+	}
+	return start.In(loc), nil
+}
+
+// link remembers that the partner's value for a resource names the row
+// with localID.
+func (h *HL7Handler) link(ctx context.Context, resourceType, system, value, localID string) error {
+	err := h.repo.CreateImported(ctx, []*entity.ImportedResource{
+		{ResourceType: resourceType, System: system, Value: value, LocalID: localID},
+	})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to link %s %s: %v", resourceType, value, err)
+		return fmt.Errorf("failed to link %s: %w", resourceType, err)
+	}
+	return nil
+}
+
+// hl7System names the identifiers a partner assigns itself.
+func hl7System(m *hl7.Message) string {
+	return "hl7:" + m.SendingFacility()
+}
+
+// hl7PatientSystem names the identifiers of p: its assigning authority, or
+// else the sending facility.
+func hl7PatientSystem(m *hl7.Message, p *hl7.PatientIdentity) string {
+	if p.Authority != "" {
+		return "hl7:" + p.Authority
+	}
+	return hl7System(m)
+}
+
+func hl7Gender(sex string) commonpb.Gender {
+	for g, code := range hl7Sexes {
+		if code == sex {
+			return commonpb.Gender(g)
+		}
+	}
+	return 0
+}
+
+func hl7Address(p *hl7.PatientIdentity) *commonpb.Address {
+	if p.Street == "" && p.City == "" && p.State == "" && p.ZipCode == "" && p.Country == "" {
+		return nil
+	}
+	return &commonpb.Address{
+		Street:  p.Street,
+		City:    p.City,
+		State:   p.State,
+		ZipCode: p.ZipCode,
+		Country: p.Country,
+	}
+}
+
+func optionalString(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+// notify queues an SIU notification of a change to appointment for the
+// partner, unless the partner made the change.
+func (h *AppointmentHandler) notify(ctx context.Context, appointment *entity.Appointment, event string) {
+	if !h.notifier.Enabled() || fromHL7(ctx) {
+		return
+	}
+
+	siu := &hl7.SIU{
+		Event:         event,
+		PlacerID:      appointment.ID,
+		FillerID:      appointment.ID,
+		Duration:      appointment.EndsAt.Sub(appointment.StartsAt),
+		Type:          hl7AppointmentTypes[appointment.ConsultationType],
+		Reason:        appointment.ReasonForVisit,
+		Status:        "Booked",
+		Patient:       &hl7.PatientIdentity{ID: appointment.PatientID, Authority: hl7.Application},
+		PersonnelID:   appointment.DoctorID,
+		PersonnelName: appointment.DoctorName,
+	}
+	start := appointment.StartsAt
+	if loc, err := loadLocation(appointment.Timezone); err == nil {
+		start = start.In(loc)
+	}
+	siu.Start = hl7.FormatTime(start)
+	if appointment.Status == entity.AppointmentStatusCancelled {
+		siu.Status = "Cancelled"
+		siu.EventReason = appointment.CancellationReason
+	}
+
+	patient, err := h.patientRepo.Get(ctx, appointment.PatientID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient for SIU notification: %v", err)
+	}
+	if patient != nil {
+		p := siu.Patient
+		p.FirstName, p.LastName = patient.FirstName, patient.LastName
+		p.BirthDate, p.Sex = patient.DateOfBirth, hl7Sexes[patient.Gender]
+		p.Phone, p.Email = patient.PhoneNumber, patient.Email
+		if addr := entity.UnmarshalAddress(patient.Address); addr != nil {
+			p.Street, p.City, p.State, p.ZipCode, p.Country = addr.Street, addr.City, addr.State, addr.ZipCode, addr.Country
+		}
+	}
+	h.notifier.Notify(siu)
+}
@@ -0,0 +1,122 @@
+package biz
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+)
+
+const icalTimeLayout = "20060102T150405Z"
+
+// icalEvent is one VEVENT of an RFC 5545 calendar.
+type icalEvent struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	Start        time.Time
+	End          time.Time
+	Cancelled    bool
+	Sequence     int32
+	LastModified time.Time
+}
+
+// appointmentEvent leaves the description empty: feed URLs are shared with
+// third-party calendar services, so the reason for the visit is only added
+// to the single-appointment download.
+func appointmentEvent(apt *entity.Appointment, summary, location string) icalEvent {
+	return icalEvent{
+		UID:          apt.ID + "@medical-service",
+		Summary:      summary,
+		Location:     location,
+		Start:        apt.StartsAt,
+		End:          apt.EndsAt,
+		Cancelled:    apt.Status == entity.AppointmentStatusCancelled,
+		Sequence:     apt.Sequence,
+		LastModified: apt.UpdatedAt,
+	}
+}
+
+// renderCalendar serializes events as an iCalendar object. Times are written
+// in UTC, so no VTIMEZONE components are needed.
+func renderCalendar(name string, events []icalEvent, now time.Time) []byte {
+	var b strings.Builder
+	line := func(s string) {
+		b.WriteString(foldICalLine(s))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//arm-1234//medical-service//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	if name != "" {
+		line("X-WR-CALNAME:" + escapeICalText(name))
+	}
+
+	for _, e := range events {
+		status := "CONFIRMED"
+		if e.Cancelled {
+			status = "CANCELLED"
+		}
+		stamp := e.LastModified
+		if stamp.IsZero() {
+			stamp = now
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID)
+		line("DTSTAMP:" + stamp.UTC().Format(icalTimeLayout))
+		line("DTSTART:" + e.Start.UTC().Format(icalTimeLayout))
+		line("DTEND:" + e.End.UTC().Format(icalTimeLayout))
+		line("SUMMARY:" + escapeICalText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + escapeICalText(e.Description))
+		}
+		if e.Location != "" {
+			line("LOCATION:" + escapeICalText(e.Location))
+		}
+		line("STATUS:" + status)
+		line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		line("LAST-MODIFIED:" + stamp.UTC().Format(icalTimeLayout))
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
+
+func escapeICalText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// foldICalLine splits content lines longer than 75 octets, as RFC 5545
+// requires, without breaking UTF-8 sequences.
+func foldICalLine(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		n := len(string(r))
+		if width+n > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += n
+	}
+	return b.String()
+}
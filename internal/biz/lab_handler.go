@@ -0,0 +1,461 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/hl7"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+type LabHandler struct {
+	repo            data.LabRepo
+	appointmentRepo data.AppointmentRepo
+	patientRepo     data.PatientRepo
+	doctorRepo      data.DoctorRepo
+	tx              data.Transaction
+	drop            *hl7.Drop
+	access          *AccessAuditor
+	log             *log.Helper
+}
+
+func NewLabHandler(
+	repo data.LabRepo,
+	appointmentRepo data.AppointmentRepo,
+	patientRepo data.PatientRepo,
+	doctorRepo data.DoctorRepo,
+	tx data.Transaction,
+	drop *hl7.Drop,
+	access *AccessAuditor,
+	logger log.Logger,
+) *LabHandler {
+	return &LabHandler{
+		repo:            repo,
+		appointmentRepo: appointmentRepo,
+		patientRepo:     patientRepo,
+		doctorRepo:      doctorRepo,
+		tx:              tx,
+		drop:            drop,
+		access:          access,
+		log:             log.NewHelper(logger),
+	}
+}
+
+// LabTestInput names a test by its code, normally a LOINC code, in
+// CodeSystem.
+type LabTestInput struct {
+	Code       string `json:"code"`
+	CodeSystem string `json:"code_system"`
+	Name       string `json:"name"`
+}
+
+// CreateLabOrderRequest orders tests for the patient of an appointment. The
+// ordering doctor defaults to the appointment's doctor.
+type CreateLabOrderRequest struct {
+	AppointmentID string          `json:"appointment_id"`
+	DoctorID      string          `json:"doctor_id"`
+	Priority      string          `json:"priority"`
+	Notes         string          `json:"notes"`
+	Tests         []*LabTestInput `json:"tests"`
+}
+
+type LabTestDetail struct {
+	Code       string `json:"code"`
+	CodeSystem string `json:"code_system,omitempty"`
+	Name       string `json:"name,omitempty"`
+	// ResultStatus is the status of the test's current result, if any.
+	ResultStatus string `json:"result_status,omitempty"`
+}
+
+type LabResultDetail struct {
+	ResultID       string `json:"result_id"`
+	OrderID        string `json:"order_id"`
+	PatientID      string `json:"patient_id"`
+	DoctorID       string `json:"doctor_id"`
+	TestCode       string `json:"test_code"`
+	CodeSystem     string `json:"code_system,omitempty"`
+	TestName       string `json:"test_name,omitempty"`
+	Value          string `json:"value"`
+	Unit           string `json:"unit,omitempty"`
+	ReferenceRange string `json:"reference_range,omitempty"`
+	AbnormalFlag   string `json:"abnormal_flag,omitempty"`
+	Abnormal       bool   `json:"abnormal"`
+	Critical       bool   `json:"critical"`
+	Status         string `json:"status"`
+	ObservedAt     string `json:"observed_at"`
+	ReceivedAt     string `json:"received_at"`
+	SupersededBy   string `json:"superseded_by,omitempty"`
+	ReviewedBy     string `json:"reviewed_by,omitempty"`
+	ReviewedAt     string `json:"reviewed_at,omitempty"`
+	ReviewNote     string `json:"review_note,omitempty"`
+}
+
+type LabOrderDetail struct {
+	OrderID       string             `json:"order_id"`
+	AppointmentID string             `json:"appointment_id"`
+	PatientID     string             `json:"patient_id"`
+	DoctorID      string             `json:"doctor_id"`
+	Status        string             `json:"status"`
+	Priority      string             `json:"priority"`
+	Notes         string             `json:"notes,omitempty"`
+	OrderedAt     string             `json:"ordered_at"`
+	Tests         []*LabTestDetail   `json:"tests"`
+	Results       []*LabResultDetail `json:"results"`
+}
+
+// PatientLabResultsRequest selects a patient's current results. From and To
+// are RFC3339 timestamps or YYYY-MM-DD days.
+type PatientLabResultsRequest struct {
+	PatientID    string `json:"patient_id"`
+	TestCode     string `json:"test_code"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	AbnormalOnly bool   `json:"abnormal_only"`
+}
+
+type PatientLabResultsResponse struct {
+	PatientID string             `json:"patient_id"`
+	Results   []*LabResultDetail `json:"results"`
+}
+
+type LabInboxResponse struct {
+	DoctorID string             `json:"doctor_id"`
+	Results  []*LabResultDetail `json:"results"`
+}
+
+type ReviewLabResultRequest struct {
+	ResultID   string `json:"result_id"`
+	ReviewedBy string `json:"reviewed_by"`
+	Note       string `json:"note"`
+}
+
+func (h *LabHandler) CreateLabOrder(ctx context.Context, req *CreateLabOrderRequest) (*LabOrderDetail, error) {
+	ctx, span := otel.Trace(ctx, "LabHandler.CreateLabOrder")
+	defer span.End()
+
+	if req.AppointmentID == "" {
+		h.log.WithContext(ctx).Errorf("Appointment ID is required")
+		return nil, fmt.Errorf("appointment_id is required")
+	}
+	if len(req.Tests) == 0 {
+		h.log.WithContext(ctx).Errorf("No tests to order")
+		return nil, fmt.Errorf("tests are required")
+	}
+	priority := strings.ToLower(strings.TrimSpace(req.Priority))
+	switch priority {
+	case "":
+		priority = entity.LabPriorityRoutine
+	case entity.LabPriorityRoutine, entity.LabPriorityUrgent, entity.LabPriorityStat:
+	default:
+		h.log.WithContext(ctx).Errorf("Invalid lab order priority: %s", req.Priority)
+		return nil, fmt.Errorf("priority must be routine, urgent or stat")
+	}
+
+	appointment, err := h.appointmentRepo.Get(ctx, req.AppointmentID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get appointment: %v", err)
+		return nil, fmt.Errorf("failed to get appointment: %w", err)
+	}
+	if appointment == nil {
+		h.log.WithContext(ctx).Errorf("Appointment not found: %s", req.AppointmentID)
+		return nil, fmt.Errorf("appointment not found")
+	}
+	if appointment.Status == entity.AppointmentStatusCancelled {
+		h.log.WithContext(ctx).Errorf("Cannot order tests for cancelled appointment: %s", appointment.ID)
+		return nil, fmt.Errorf("appointment is cancelled")
+	}
+	doctorID := appointment.DoctorID
+	if req.DoctorID != "" && req.DoctorID != doctorID {
+		if err := h.requireDoctor(ctx, req.DoctorID); err != nil {
+			return nil, err
+		}
+		doctorID = req.DoctorID
+	}
+
+	seen := make(map[string]bool)
+	var tests []*entity.LabOrderTest
+	for i, t := range req.Tests {
+		code := strings.TrimSpace(t.Code)
+		if code == "" {
+			h.log.WithContext(ctx).Errorf("Lab test %d has no code", i+1)
+			return nil, fmt.Errorf("test %d: code is required", i+1)
+		}
+		if seen[code] {
+			h.log.WithContext(ctx).Errorf("Lab test ordered twice: %s", code)
+			return nil, fmt.Errorf("test %s is ordered more than once", code)
+		}
+		seen[code] = true
+		tests = append(tests, &entity.LabOrderTest{
+			Position:   int32(i),
+			Code:       code,
+			CodeSystem: strings.TrimSpace(t.CodeSystem),
+			Name:       strings.TrimSpace(t.Name),
+		})
+	}
+
+	order := &entity.LabOrder{
+		AppointmentID: appointment.ID,
+		PatientID:     appointment.PatientID,
+		DoctorID:      doctorID,
+		Status:        entity.LabOrderStatusOrdered,
+		Priority:      priority,
+		Notes:         req.Notes,
+		OrderedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+	if err := h.repo.CreateOrder(ctx, order, tests); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to create lab order: %v", err)
+		return nil, fmt.Errorf("failed to create lab order: %w", err)
+	}
+
+	return labOrderToDetail(order, tests, nil), nil
+}
+
+func (h *LabHandler) GetLabOrder(ctx context.Context, id string) (*LabOrderDetail, error) {
+	ctx, span := otel.Trace(ctx, "LabHandler.GetLabOrder")
+	defer span.End()
+
+	order, err := h.repo.GetOrder(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get lab order: %v", err)
+		return nil, fmt.Errorf("failed to get lab order: %w", err)
+	}
+	if order == nil {
+		h.log.WithContext(ctx).Errorf("Lab order not found: %s", id)
+		return nil, fmt.Errorf("lab order not found")
+	}
+	return h.orderDetail(ctx, order)
+}
+
+// GetPatientLabResults returns the current result of every test reported for
+// a patient, newest first. Corrected results replace the ones they correct.
+func (h *LabHandler) GetPatientLabResults(ctx context.Context, req *PatientLabResultsRequest) (*PatientLabResultsResponse, error) {
+	ctx, span := otel.Trace(ctx, "LabHandler.GetPatientLabResults")
+	defer span.End()
+
+	patient, err := h.patientRepo.Get(ctx, req.PatientID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", req.PatientID)
+		return nil, fmt.Errorf("patient not found")
+	}
+
+	filters := map[string]interface{}{"patient_id": patient.ID}
+	if req.TestCode != "" {
+		filters["test_code"] = req.TestCode
+	}
+	if req.From != "" {
+		from, err := parseRecordTime(req.From)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid results start: %v", err)
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+		filters["from"] = from
+	}
+	if req.To != "" {
+		to, err := parseRecordTime(req.To)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid results end: %v", err)
+			return nil, fmt.Errorf("invalid to: %w", err)
+		}
+		if len(req.To) == len(dateLayout) {
+			to = to.Add(24*time.Hour - time.Second)
+		}
+		filters["to"] = to
+	}
+	if req.AbnormalOnly {
+		filters["abnormal"] = true
+	}
+
+	results, err := h.repo.GetResults(ctx, filters)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get lab results: %v", err)
+		return nil, fmt.Errorf("failed to get lab results: %w", err)
+	}
+	h.access.Record(ctx, patient.ID, accessLabResults, "")
+
+	resp := &PatientLabResultsResponse{PatientID: patient.ID}
+	for _, r := range results {
+		resp.Results = append(resp.Results, labResultToDetail(r))
+	}
+	return resp, nil
+}
+
+// GetLabInbox lists the abnormal results of a doctor's orders that nobody
+// has reviewed yet, critical ones first and then newest first.
+func (h *LabHandler) GetLabInbox(ctx context.Context, doctorID string) (*LabInboxResponse, error) {
+	ctx, span := otel.Trace(ctx, "LabHandler.GetLabInbox")
+	defer span.End()
+
+	if err := h.requireDoctor(ctx, doctorID); err != nil {
+		return nil, err
+	}
+
+	results, err := h.repo.GetResults(ctx, map[string]interface{}{
+		"doctor_id":  doctorID,
+		"abnormal":   true,
+		"unreviewed": true,
+	})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get lab inbox: %v", err)
+		return nil, fmt.Errorf("failed to get lab inbox: %w", err)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return criticalFlag(results[i].AbnormalFlag) && !criticalFlag(results[j].AbnormalFlag)
+	})
+
+	resp := &LabInboxResponse{DoctorID: doctorID}
+	for _, r := range results {
+		resp.Results = append(resp.Results, labResultToDetail(r))
+	}
+	return resp, nil
+}
+
+// ReviewLabResult records that a doctor has seen a result, which takes it
+// out of the inbox.
+func (h *LabHandler) ReviewLabResult(ctx context.Context, req *ReviewLabResultRequest) (*LabResultDetail, error) {
+	ctx, span := otel.Trace(ctx, "LabHandler.ReviewLabResult")
+	defer span.End()
+
+	if req.ReviewedBy == "" {
+		h.log.WithContext(ctx).Errorf("Reviewer is required")
+		return nil, fmt.Errorf("reviewed_by is required")
+	}
+	if err := h.requireDoctor(ctx, req.ReviewedBy); err != nil {
+		return nil, err
+	}
+
+	result, err := h.repo.GetResult(ctx, req.ResultID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get lab result: %v", err)
+		return nil, fmt.Errorf("failed to get lab result: %w", err)
+	}
+	if result == nil {
+		h.log.WithContext(ctx).Errorf("Lab result not found: %s", req.ResultID)
+		return nil, fmt.Errorf("lab result not found")
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := h.repo.MarkReviewed(ctx, result.ID, req.ReviewedBy, req.Note, now); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to review lab result: %v", err)
+		return nil, fmt.Errorf("failed to review lab result: %w", err)
+	}
+	result.ReviewedAt = &now
+	result.ReviewedBy = req.ReviewedBy
+	result.ReviewNote = req.Note
+	return labResultToDetail(result), nil
+}
+
+func (h *LabHandler) orderDetail(ctx context.Context, order *entity.LabOrder) (*LabOrderDetail, error) {
+	tests, err := h.repo.GetOrderTests(ctx, order.ID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get lab order tests: %v", err)
+		return nil, fmt.Errorf("failed to get lab order tests: %w", err)
+	}
+	results, err := h.repo.GetResults(ctx, map[string]interface{}{"order_id": order.ID})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get lab results: %v", err)
+		return nil, fmt.Errorf("failed to get lab results: %w", err)
+	}
+	return labOrderToDetail(order, tests, results), nil
+}
+
+func (h *LabHandler) requireDoctor(ctx context.Context, id string) error {
+	doctor, err := h.doctorRepo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", id)
+		return fmt.Errorf("doctor not found")
+	}
+	return nil
+}
+
+// labOrderStatus derives an order's status from the current results of its
+// tests.
+func labOrderStatus(tests []*entity.LabOrderTest, results []*entity.LabResult) string {
+	if len(results) == 0 {
+		return entity.LabOrderStatusOrdered
+	}
+	done := make(map[string]bool)
+	for _, r := range results {
+		if r.SupersededBy == "" && r.Status != entity.LabResultStatusPreliminary {
+			done[r.TestCode] = true
+		}
+	}
+	for _, t := range tests {
+		if !done[t.Code] {
+			return entity.LabOrderStatusPartial
+		}
+	}
+	return entity.LabOrderStatusResulted
+}
+
+func labOrderToDetail(order *entity.LabOrder, tests []*entity.LabOrderTest, results []*entity.LabResult) *LabOrderDetail {
+	detail := &LabOrderDetail{
+		OrderID:       order.ID,
+		AppointmentID: order.AppointmentID,
+		PatientID:     order.PatientID,
+		DoctorID:      order.DoctorID,
+		Status:        order.Status,
+		Priority:      order.Priority,
+		Notes:         order.Notes,
+		OrderedAt:     formatTimestamp(order.OrderedAt),
+		Tests:         []*LabTestDetail{},
+		Results:       []*LabResultDetail{},
+	}
+	status := make(map[string]string)
+	for _, r := range results {
+		if _, ok := status[r.TestCode]; !ok {
+			status[r.TestCode] = r.Status
+		}
+		detail.Results = append(detail.Results, labResultToDetail(r))
+	}
+	for _, t := range tests {
+		detail.Tests = append(detail.Tests, &LabTestDetail{
+			Code:         t.Code,
+			CodeSystem:   t.CodeSystem,
+			Name:         t.Name,
+			ResultStatus: status[t.Code],
+		})
+	}
+	return detail
+}
+
+func labResultToDetail(r *entity.LabResult) *LabResultDetail {
+	detail := &LabResultDetail{
+		ResultID:       r.ID,
+		OrderID:        r.OrderID,
+		PatientID:      r.PatientID,
+		DoctorID:       r.DoctorID,
+		TestCode:       r.TestCode,
+		CodeSystem:     r.CodeSystem,
+		TestName:       r.TestName,
+		Value:          r.Value,
+		Unit:           r.Unit,
+		ReferenceRange: r.ReferenceRange,
+		AbnormalFlag:   r.AbnormalFlag,
+		Abnormal:       r.Abnormal,
+		Critical:       criticalFlag(r.AbnormalFlag),
+		Status:         r.Status,
+		ObservedAt:     formatTimestamp(r.ObservedAt),
+		ReceivedAt:     formatTimestamp(r.CreatedAt),
+		SupersededBy:   r.SupersededBy,
+		ReviewedBy:     r.ReviewedBy,
+		ReviewNote:     r.ReviewNote,
+	}
+	if r.ReviewedAt != nil {
+		detail.ReviewedAt = formatTimestamp(*r.ReviewedAt)
+	}
+	return detail
+}
@@ -0,0 +1,437 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/hl7"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+)
+
+// labSourceAPI is the source of results posted to the ingestion endpoint.
+const labSourceAPI = "api"
+
+// LabResultInput is one reported value. AbnormalFlag uses the HL7 codes N,
+// L, H, LL, HH, A and AA; when it is left out it is derived from a numeric
+// value and a "low-high", "<high" or ">low" reference range. Status is
+// preliminary, final (the default), corrected or cancelled.
+type LabResultInput struct {
+	TestCode       string `json:"test_code"`
+	CodeSystem     string `json:"code_system"`
+	TestName       string `json:"test_name"`
+	Value          string `json:"value"`
+	Unit           string `json:"unit"`
+	ReferenceRange string `json:"reference_range"`
+	AbnormalFlag   string `json:"abnormal_flag"`
+	Status         string `json:"status"`
+	ObservedAt     string `json:"observed_at"`
+}
+
+// IngestLabResultsRequest reports results for a lab order. PatientID, when
+// given, must identify the order's patient. A MessageID makes the request
+// idempotent: a second request with the same ID is acknowledged without
+// being ingested again.
+type IngestLabResultsRequest struct {
+	OrderID   string            `json:"order_id"`
+	PatientID string            `json:"patient_id"`
+	MessageID string            `json:"message_id"`
+	Results   []*LabResultInput `json:"results"`
+}
+
+type IngestLabResultsResponse struct {
+	// Duplicate is set when the message had been ingested before.
+	Duplicate bool              `json:"duplicate"`
+	Orders    []*LabOrderDetail `json:"orders"`
+}
+
+func (h *LabHandler) IngestLabResults(ctx context.Context, req *IngestLabResultsRequest) (*IngestLabResultsResponse, error) {
+	ctx, span := otel.Trace(ctx, "LabHandler.IngestLabResults")
+	defer span.End()
+
+	return h.ingest(ctx, labSourceAPI, req.MessageID, []*IngestLabResultsRequest{req}, false)
+}
+
+// IngestHL7 ingests an HL7 v2 ORU^R01 message. Each OBR segment must carry
+// the lab order's ID as its placer order number, and PID-3 the patient's ID.
+func (h *LabHandler) IngestHL7(ctx context.Context, raw string) (*IngestLabResultsResponse, error) {
+	ctx, span := otel.Trace(ctx, "LabHandler.IngestHL7")
+	defer span.End()
+
+	msg, err := hl7.Parse(raw)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid HL7 message: %v", err)
+		return nil, fmt.Errorf("invalid HL7 message: %w", err)
+	}
+	oru, err := hl7.ParseORU(msg)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid ORU message: %v", err)
+		return nil, fmt.Errorf("invalid ORU message: %w", err)
+	}
+	if oru.ControlID == "" {
+		h.log.WithContext(ctx).Errorf("HL7 message has no control ID")
+		return nil, fmt.Errorf("MSH-10 message control ID is required")
+	}
+
+	var batches []*IngestLabResultsRequest
+	for _, order := range oru.Orders {
+		if order.PlacerOrderNumber == "" {
+			h.log.WithContext(ctx).Errorf("HL7 order in message %s has no placer order number", oru.ControlID)
+			return nil, fmt.Errorf("OBR-2 placer order number is required")
+		}
+		batch := &IngestLabResultsRequest{OrderID: order.PlacerOrderNumber, PatientID: oru.PatientID}
+		for _, obs := range order.Observations {
+			input, err := hl7ResultInput(obs)
+			if err != nil {
+				h.log.WithContext(ctx).Errorf("Invalid HL7 observation %s: %v", obs.Code, err)
+				return nil, fmt.Errorf("observation %s: %w", obs.Code, err)
+			}
+			batch.Results = append(batch.Results, input)
+		}
+		batches = append(batches, batch)
+	}
+
+	source := "hl7"
+	if oru.SendingFacility != "" {
+		source += ":" + oru.SendingFacility
+	}
+	return h.ingest(ctx, source, oru.ControlID, batches, true)
+}
+
+// IngestDropFiles ingests the HL7 files waiting in the lab drop directory.
+// A file whose messages all ingest is moved to processed/; otherwise it is
+// moved to failed/ with the reason. Messages of a failed file that did
+// ingest are recognized as duplicates if it is dropped again.
+func (h *LabHandler) IngestDropFiles(ctx context.Context) error {
+	ctx, span := otel.Trace(ctx, "LabHandler.IngestDropFiles")
+	defer span.End()
+
+	files, err := h.drop.Pending()
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list lab drop files: %v", err)
+		return err
+	}
+	for _, path := range files {
+		err := h.ingestDropFile(ctx, path)
+		if err == nil {
+			err = h.drop.Done(path)
+		} else {
+			h.log.WithContext(ctx).Warnf("Lab drop file %s failed: %v", path, err)
+			err = h.drop.Fail(path, err)
+		}
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to file lab drop file: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *LabHandler) ingestDropFile(ctx context.Context, path string) error {
+	raw, err := h.drop.Read(path)
+	if err != nil {
+		return err
+	}
+	messages := hl7.Split(raw)
+	if len(messages) == 0 {
+		return fmt.Errorf("file holds no HL7 messages")
+	}
+	for i, msg := range messages {
+		if _, err := h.IngestHL7(ctx, msg); err != nil {
+			return fmt.Errorf("message %d: %w", i+1, err)
+		}
+	}
+	h.log.WithContext(ctx).Infof("Ingested %d HL7 messages from %s", len(messages), path)
+	return nil
+}
+
+// ingest stores the results of one message in a single transaction. Each new
+// result supersedes the current result for the same test on its order.
+// Flags written by a laboratory system that are not in the HL7 abnormal
+// flag table are kept as a generic abnormal flag when lenient is set, and
+// rejected otherwise.
+func (h *LabHandler) ingest(ctx context.Context, source, messageID string, batches []*IngestLabResultsRequest, lenient bool) (*IngestLabResultsResponse, error) {
+	resp := &IngestLabResultsResponse{}
+	var orders []*entity.LabOrder
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		if messageID != "" {
+			existing, err := h.repo.GetMessage(ctx, source, messageID)
+			if err != nil {
+				h.log.WithContext(ctx).Errorf("Failed to get lab message: %v", err)
+				return fmt.Errorf("failed to get lab message: %w", err)
+			}
+			if existing != nil {
+				resp.Duplicate = true
+			}
+		}
+
+		for _, batch := range batches {
+			order, err := h.lockOrder(ctx, batch.OrderID)
+			if err != nil {
+				return err
+			}
+			orders = append(orders, order)
+		}
+		if resp.Duplicate {
+			h.log.WithContext(ctx).Infof("Lab message %s from %s was already ingested", messageID, source)
+			return nil
+		}
+
+		message := &entity.LabMessage{
+			Source:     source,
+			ExternalID: messageID,
+			ReceivedAt: time.Now().UTC().Truncate(time.Second),
+		}
+		for _, batch := range batches {
+			message.ResultCount += int32(len(batch.Results))
+		}
+		if err := h.repo.CreateMessage(ctx, message); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to record lab message: %v", err)
+			return fmt.Errorf("failed to record lab message: %w", err)
+		}
+
+		for i, batch := range batches {
+			if err := h.ingestBatch(ctx, orders[i], message, batch, lenient); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, order := range orders {
+		detail, err := h.orderDetail(ctx, order)
+		if err != nil {
+			return nil, err
+		}
+		resp.Orders = append(resp.Orders, detail)
+	}
+	return resp, nil
+}
+
+func (h *LabHandler) ingestBatch(ctx context.Context, order *entity.LabOrder, message *entity.LabMessage, batch *IngestLabResultsRequest, lenient bool) error {
+	if len(batch.Results) == 0 {
+		h.log.WithContext(ctx).Errorf("No results for lab order %s", order.ID)
+		return fmt.Errorf("lab order %s: results are required", order.ID)
+	}
+	if batch.PatientID != "" && batch.PatientID != order.PatientID {
+		patient, err := h.patientRepo.Get(ctx, batch.PatientID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+			return fmt.Errorf("failed to get patient: %w", err)
+		}
+		// A merged patient's old ID still resolves to the order's patient.
+		if patient == nil || patient.ID != order.PatientID {
+			h.log.WithContext(ctx).Errorf("Patient %s does not match lab order %s", batch.PatientID, order.ID)
+			return fmt.Errorf("lab order %s belongs to a different patient", order.ID)
+		}
+	}
+
+	var results []*entity.LabResult
+	for _, input := range batch.Results {
+		result, err := newLabResult(order, message.ID, input, lenient)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid lab result for order %s: %v", order.ID, err)
+			return fmt.Errorf("lab order %s: %w", order.ID, err)
+		}
+		results = append(results, result)
+	}
+	if err := h.repo.CreateResults(ctx, results); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to store lab results: %v", err)
+		return fmt.Errorf("failed to store lab results: %w", err)
+	}
+	for _, r := range results {
+		if err := h.repo.Supersede(ctx, order.ID, r.TestCode, r.ID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to supersede lab results: %v", err)
+			return fmt.Errorf("failed to supersede lab results: %w", err)
+		}
+	}
+
+	tests, err := h.repo.GetOrderTests(ctx, order.ID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get lab order tests: %v", err)
+		return fmt.Errorf("failed to get lab order tests: %w", err)
+	}
+	current, err := h.repo.GetResults(ctx, map[string]interface{}{"order_id": order.ID})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get lab results: %v", err)
+		return fmt.Errorf("failed to get lab results: %w", err)
+	}
+	if status := labOrderStatus(tests, current); status != order.Status {
+		if err := h.repo.SetOrderStatus(ctx, order.ID, status); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to update lab order status: %v", err)
+			return fmt.Errorf("failed to update lab order status: %w", err)
+		}
+		order.Status = status
+	}
+	return nil
+}
+
+func (h *LabHandler) lockOrder(ctx context.Context, id string) (*entity.LabOrder, error) {
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("Lab order ID is required")
+		return nil, fmt.Errorf("order_id is required")
+	}
+	if err := h.repo.LockOrder(ctx, id); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to lock lab order: %v", err)
+		return nil, fmt.Errorf("failed to lock lab order: %w", err)
+	}
+	order, err := h.repo.GetOrder(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get lab order: %v", err)
+		return nil, fmt.Errorf("failed to get lab order: %w", err)
+	}
+	if order == nil {
+		h.log.WithContext(ctx).Errorf("Lab order not found: %s", id)
+		return nil, fmt.Errorf("lab order %s not found", id)
+	}
+	return order, nil
+}
+
+func newLabResult(order *entity.LabOrder, messageID string, input *LabResultInput, lenient bool) (*entity.LabResult, error) {
+	code := strings.TrimSpace(input.TestCode)
+	if code == "" {
+		return nil, fmt.Errorf("test_code is required")
+	}
+	status := strings.ToLower(strings.TrimSpace(input.Status))
+	switch status {
+	case "":
+		status = entity.LabResultStatusFinal
+	case entity.LabResultStatusPreliminary, entity.LabResultStatusFinal, entity.LabResultStatusCorrected, entity.LabResultStatusCancelled:
+	default:
+		return nil, fmt.Errorf("%s: unknown result status %q", code, input.Status)
+	}
+	value := strings.TrimSpace(input.Value)
+	if value == "" && status != entity.LabResultStatusCancelled {
+		return nil, fmt.Errorf("%s: value is required", code)
+	}
+
+	observedAt := time.Now().UTC().Truncate(time.Second)
+	if input.ObservedAt != "" {
+		t, err := parseRecordTime(input.ObservedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid observed_at: %w", code, err)
+		}
+		observedAt = t
+	}
+
+	result := &entity.LabResult{
+		OrderID:        order.ID,
+		PatientID:      order.PatientID,
+		DoctorID:       order.DoctorID,
+		MessageID:      messageID,
+		TestCode:       code,
+		CodeSystem:     strings.TrimSpace(input.CodeSystem),
+		TestName:       strings.TrimSpace(input.TestName),
+		Value:          value,
+		Unit:           strings.TrimSpace(input.Unit),
+		ReferenceRange: strings.TrimSpace(input.ReferenceRange),
+		Status:         status,
+		ObservedAt:     observedAt,
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		result.NumericValue = &n
+	}
+
+	flag, ok := normalizeAbnormalFlag(input.AbnormalFlag)
+	switch {
+	case !ok && lenient:
+		flag = "A"
+	case !ok:
+		return nil, fmt.Errorf("%s: unknown abnormal flag %q", code, input.AbnormalFlag)
+	case flag == "" && result.NumericValue != nil:
+		flag = deriveAbnormalFlag(*result.NumericValue, result.ReferenceRange)
+	}
+	result.AbnormalFlag = flag
+	result.Abnormal = flag != "" && flag != "N"
+	return result, nil
+}
+
+// normalizeAbnormalFlag accepts the HL7 table 0078 flags for normal, low,
+// high, critically low or high, and abnormal or critically abnormal.
+func normalizeAbnormalFlag(flag string) (string, bool) {
+	flag = strings.ToUpper(strings.TrimSpace(flag))
+	switch flag {
+	case "", "N", "L", "H", "LL", "HH", "A", "AA":
+		return flag, true
+	}
+	return "", false
+}
+
+// deriveAbnormalFlag flags a value outside a "low-high", "<high" or ">low"
+// reference range. A range it cannot read yields no flag.
+func deriveAbnormalFlag(value float64, referenceRange string) string {
+	r := strings.ReplaceAll(referenceRange, " ", "")
+	var low, high *float64
+	parse := func(s string) *float64 {
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			return &v
+		}
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(r, "<="):
+		high = parse(r[2:])
+	case strings.HasPrefix(r, ">="):
+		low = parse(r[2:])
+	case strings.HasPrefix(r, "<"):
+		high = parse(r[1:])
+	case strings.HasPrefix(r, ">"):
+		low = parse(r[1:])
+	default:
+		// The separator is the first dash that is not a leading minus sign.
+		if i := strings.Index(r[min(1, len(r)):], "-"); i >= 0 {
+			low, high = parse(r[:i+1]), parse(r[i+2:])
+		}
+	}
+	switch {
+	case low != nil && value < *low:
+		return "L"
+	case high != nil && value > *high:
+		return "H"
+	case low != nil || high != nil:
+		return "N"
+	}
+	return ""
+}
+
+// criticalFlag reports whether a flag marks a critical result.
+func criticalFlag(flag string) bool {
+	return flag == "LL" || flag == "HH" || flag == "AA"
+}
+
+// hl7ResultInput maps an OBX segment to a result. OBX-11 status F is final,
+// C corrected and X cancelled; P, R, S and I are preliminary. Deletions are
+// not accepted.
+func hl7ResultInput(obs *hl7.Observation) (*LabResultInput, error) {
+	input := &LabResultInput{
+		TestCode:       obs.Code,
+		CodeSystem:     obs.CodeSystem,
+		TestName:       obs.Name,
+		Value:          obs.Value,
+		Unit:           obs.Units,
+		ReferenceRange: obs.ReferenceRange,
+		AbnormalFlag:   obs.AbnormalFlag,
+	}
+	switch strings.ToUpper(obs.Status) {
+	case "", "F":
+		input.Status = entity.LabResultStatusFinal
+	case "C":
+		input.Status = entity.LabResultStatusCorrected
+	case "X":
+		input.Status = entity.LabResultStatusCancelled
+	case "P", "R", "S", "I":
+		input.Status = entity.LabResultStatusPreliminary
+	default:
+		return nil, fmt.Errorf("result status %q is not supported", obs.Status)
+	}
+	if !obs.ObservedAt.IsZero() {
+		input.ObservedAt = formatTimestamp(obs.ObservedAt)
+	}
+	return input, nil
+}
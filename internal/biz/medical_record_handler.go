@@ -0,0 +1,646 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+type MedicalRecordHandler struct {
+	repo        data.MedicalRecordRepo
+	patientRepo data.PatientRepo
+	doctorRepo  data.DoctorRepo
+	vitalRepo   data.VitalSignRepo
+	tx          data.Transaction
+	signer      *RecordSigner
+	access      *AccessAuditor
+	log         *log.Helper
+}
+
+func NewMedicalRecordHandler(
+	repo data.MedicalRecordRepo,
+	patientRepo data.PatientRepo,
+	doctorRepo data.DoctorRepo,
+	vitalRepo data.VitalSignRepo,
+	tx data.Transaction,
+	signer *RecordSigner,
+	access *AccessAuditor,
+	logger log.Logger,
+) *MedicalRecordHandler {
+	return &MedicalRecordHandler{
+		repo:        repo,
+		patientRepo: patientRepo,
+		doctorRepo:  doctorRepo,
+		vitalRepo:   vitalRepo,
+		tx:          tx,
+		signer:      signer,
+		access:      access,
+		log:         log.NewHelper(logger),
+	}
+}
+
+// MedicalRecordContent is the clinical content of a medical record. Dates
+// are RFC3339 timestamps or YYYY-MM-DD days.
+type MedicalRecordContent struct {
+	VisitDate     string             `json:"visit_date"`
+	RecordType    string             `json:"record_type"`
+	Diagnosis     string             `json:"diagnosis"`
+	Symptoms      string             `json:"symptoms"`
+	Treatment     string             `json:"treatment"`
+	Prescriptions string             `json:"prescriptions"`
+	LabResults    string             `json:"lab_results"`
+	VitalSigns    *entity.VitalSigns `json:"vital_signs"`
+	Notes         string             `json:"notes"`
+	FollowUpDate  string             `json:"follow_up_date"`
+}
+
+// CreateMedicalRecordRequest writes a draft record, or a final signed one
+// when Finalize is set.
+type CreateMedicalRecordRequest struct {
+	PatientID string `json:"patient_id"`
+	DoctorID  string `json:"doctor_id"`
+	Finalize  bool   `json:"finalize"`
+	MedicalRecordContent
+}
+
+type UpdateMedicalRecordRequest struct {
+	RecordID string `json:"record_id"`
+	MedicalRecordContent
+}
+
+type FinalizeMedicalRecordRequest struct {
+	RecordID string `json:"record_id"`
+}
+
+// AmendMedicalRecordRequest corrects a final record. Fields left out keep
+// the original's value; an empty string clears one.
+type AmendMedicalRecordRequest struct {
+	RecordID      string             `json:"record_id"`
+	AuthorID      string             `json:"author_id"`
+	Reason        string             `json:"reason"`
+	VisitDate     *string            `json:"visit_date"`
+	RecordType    *string            `json:"record_type"`
+	Diagnosis     *string            `json:"diagnosis"`
+	Symptoms      *string            `json:"symptoms"`
+	Treatment     *string            `json:"treatment"`
+	Prescriptions *string            `json:"prescriptions"`
+	LabResults    *string            `json:"lab_results"`
+	VitalSigns    *entity.VitalSigns `json:"vital_signs"`
+	Notes         *string            `json:"notes"`
+	FollowUpDate  *string            `json:"follow_up_date"`
+}
+
+// EnterMedicalRecordInErrorRequest retracts a record written by mistake.
+type EnterMedicalRecordInErrorRequest struct {
+	RecordID string `json:"record_id"`
+	By       string `json:"by"`
+	Reason   string `json:"reason"`
+}
+
+type MedicalRecordDetail struct {
+	RecordID        string             `json:"record_id"`
+	OriginalID      string             `json:"original_id"`
+	Version         int32              `json:"version"`
+	PatientID       string             `json:"patient_id"`
+	DoctorID        string             `json:"doctor_id"`
+	Status          string             `json:"status"`
+	VisitDate       string             `json:"visit_date"`
+	RecordType      string             `json:"record_type,omitempty"`
+	Diagnosis       string             `json:"diagnosis,omitempty"`
+	Symptoms        string             `json:"symptoms,omitempty"`
+	Treatment       string             `json:"treatment,omitempty"`
+	Prescriptions   string             `json:"prescriptions,omitempty"`
+	LabResults      string             `json:"lab_results,omitempty"`
+	VitalSigns      *entity.VitalSigns `json:"vital_signs,omitempty"`
+	Notes           string             `json:"notes,omitempty"`
+	FollowUpDate    string             `json:"follow_up_date,omitempty"`
+	AmendedFrom     string             `json:"amended_from,omitempty"`
+	AmendmentReason string             `json:"amendment_reason,omitempty"`
+	SignedBy        string             `json:"signed_by,omitempty"`
+	SignedAt        string             `json:"signed_at,omitempty"`
+	// Set on a record entered in error.
+	EnteredInErrorAt     string `json:"entered_in_error_at,omitempty"`
+	EnteredInErrorBy     string `json:"entered_in_error_by,omitempty"`
+	EnteredInErrorReason string `json:"entered_in_error_reason,omitempty"`
+	CreatedAt            string `json:"created_at"`
+}
+
+// MedicalRecordHistoryResponse lists every version of a record, oldest
+// first. Each amendment names the version it replaced, its author
+// (signed_by), reason and time (signed_at).
+type MedicalRecordHistoryResponse struct {
+	OriginalID string                 `json:"original_id"`
+	CurrentID  string                 `json:"current_id"`
+	Versions   []*MedicalRecordDetail `json:"versions"`
+}
+
+func (h *MedicalRecordHandler) CreateMedicalRecord(ctx context.Context, req *CreateMedicalRecordRequest) (*MedicalRecordDetail, error) {
+	ctx, span := otel.Trace(ctx, "MedicalRecordHandler.CreateMedicalRecord")
+	defer span.End()
+
+	if req.PatientID == "" || req.DoctorID == "" {
+		h.log.WithContext(ctx).Errorf("Patient ID and doctor ID are required")
+		return nil, fmt.Errorf("patient_id and doctor_id are required")
+	}
+
+	patient, err := h.patientRepo.Get(ctx, req.PatientID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", req.PatientID)
+		return nil, fmt.Errorf("patient not found")
+	}
+	if err := h.requireDoctor(ctx, req.DoctorID); err != nil {
+		return nil, err
+	}
+
+	record := &entity.MedicalRecord{
+		PatientID: patient.ID,
+		DoctorID:  req.DoctorID,
+		Status:    entity.MedicalRecordStatusDraft,
+	}
+	if err := applyRecordContent(record, &req.MedicalRecordContent); err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid medical record: %v", err)
+		return nil, err
+	}
+
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.repo.Create(ctx, record); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to create medical record: %v", err)
+			return fmt.Errorf("failed to create medical record: %w", err)
+		}
+		if req.Finalize {
+			return h.finalize(ctx, record, record.DoctorID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordToDetail(record), nil
+}
+
+// GetMedicalRecord returns the current version of a record, whichever of
+// its versions id names.
+func (h *MedicalRecordHandler) GetMedicalRecord(ctx context.Context, id string) (*MedicalRecordDetail, error) {
+	ctx, span := otel.Trace(ctx, "MedicalRecordHandler.GetMedicalRecord")
+	defer span.End()
+
+	record, err := h.getRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status == entity.MedicalRecordStatusAmended {
+		versions, err := h.versions(ctx, record)
+		if err != nil {
+			return nil, err
+		}
+		record = currentVersion(versions)
+	}
+	h.access.Record(ctx, record.PatientID, accessMedicalRecord, record.ID)
+	return recordToDetail(record), nil
+}
+
+// GetMedicalRecordHistory returns the full revision history of a record.
+func (h *MedicalRecordHandler) GetMedicalRecordHistory(ctx context.Context, id string) (*MedicalRecordHistoryResponse, error) {
+	ctx, span := otel.Trace(ctx, "MedicalRecordHandler.GetMedicalRecordHistory")
+	defer span.End()
+
+	record, err := h.getRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := h.versions(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	h.access.Record(ctx, record.PatientID, accessMedicalRecord, record.OriginalID)
+
+	response := &MedicalRecordHistoryResponse{
+		OriginalID: record.OriginalID,
+		CurrentID:  currentVersion(versions).ID,
+		Versions:   []*MedicalRecordDetail{},
+	}
+	for _, v := range versions {
+		response.Versions = append(response.Versions, recordToDetail(v))
+	}
+	return response, nil
+}
+
+// UpdateMedicalRecord replaces the content of a draft. Final records cannot
+// be edited, only amended.
+func (h *MedicalRecordHandler) UpdateMedicalRecord(ctx context.Context, req *UpdateMedicalRecordRequest) (*MedicalRecordDetail, error) {
+	ctx, span := otel.Trace(ctx, "MedicalRecordHandler.UpdateMedicalRecord")
+	defer span.End()
+
+	var record *entity.MedicalRecord
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		record, err = h.lockRecord(ctx, req.RecordID)
+		if err != nil {
+			return err
+		}
+		if record.Status != entity.MedicalRecordStatusDraft {
+			h.log.WithContext(ctx).Errorf("Cannot edit %s medical record: %s", record.Status, record.ID)
+			return fmt.Errorf("medical record is %s and can no longer be edited; amend it instead", record.Status)
+		}
+		if err := applyRecordContent(record, &req.MedicalRecordContent); err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid medical record: %v", err)
+			return err
+		}
+		if err := h.repo.UpdateDraft(ctx, record); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to update medical record: %v", err)
+			return fmt.Errorf("failed to update medical record: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordToDetail(record), nil
+}
+
+// FinalizeMedicalRecord signs a draft with its doctor's key. From then on
+// the record is read-only.
+func (h *MedicalRecordHandler) FinalizeMedicalRecord(ctx context.Context, req *FinalizeMedicalRecordRequest) (*MedicalRecordDetail, error) {
+	ctx, span := otel.Trace(ctx, "MedicalRecordHandler.FinalizeMedicalRecord")
+	defer span.End()
+
+	var record *entity.MedicalRecord
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		record, err = h.lockRecord(ctx, req.RecordID)
+		if err != nil {
+			return err
+		}
+		if record.Status != entity.MedicalRecordStatusDraft {
+			h.log.WithContext(ctx).Errorf("Medical record is already %s: %s", record.Status, record.ID)
+			return fmt.Errorf("medical record is already %s", record.Status)
+		}
+		if record.DoctorID == "" {
+			h.log.WithContext(ctx).Errorf("Medical record has no doctor to sign it: %s", record.ID)
+			return fmt.Errorf("medical record has no doctor to sign it")
+		}
+		return h.finalize(ctx, record, record.DoctorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordToDetail(record), nil
+}
+
+// AmendMedicalRecord corrects the current version of a final record. The
+// version is left as it was signed and marked amended; the correction is
+// the next version, final and signed by its author, pointing back at it.
+func (h *MedicalRecordHandler) AmendMedicalRecord(ctx context.Context, req *AmendMedicalRecordRequest) (*MedicalRecordDetail, error) {
+	ctx, span := otel.Trace(ctx, "MedicalRecordHandler.AmendMedicalRecord")
+	defer span.End()
+
+	reason := strings.TrimSpace(req.Reason)
+	if req.AuthorID == "" || reason == "" {
+		h.log.WithContext(ctx).Errorf("Amendment author and reason are required")
+		return nil, fmt.Errorf("author_id and reason are required")
+	}
+	if err := h.requireDoctor(ctx, req.AuthorID); err != nil {
+		return nil, err
+	}
+
+	var amendment *entity.MedicalRecord
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		original, err := h.lockRecord(ctx, req.RecordID)
+		if err != nil {
+			return err
+		}
+		if original.Status != entity.MedicalRecordStatusFinal {
+			h.log.WithContext(ctx).Errorf("Cannot amend %s medical record: %s", original.Status, original.ID)
+			return fmt.Errorf("only a final medical record can be amended, this one is %s", original.Status)
+		}
+
+		amendment = &entity.MedicalRecord{
+			Status:          entity.MedicalRecordStatusDraft,
+			OriginalID:      original.OriginalID,
+			Version:         original.Version + 1,
+			PatientID:       original.PatientID,
+			DoctorID:        original.DoctorID,
+			VisitDate:       original.VisitDate,
+			Diagnosis:       original.Diagnosis,
+			Symptoms:        original.Symptoms,
+			Treatment:       original.Treatment,
+			Prescriptions:   original.Prescriptions,
+			LabResults:      original.LabResults,
+			VitalSigns:      original.VitalSigns,
+			Notes:           original.Notes,
+			FollowUpDate:    original.FollowUpDate,
+			RecordType:      original.RecordType,
+			AmendedFrom:     original.ID,
+			AmendmentReason: reason,
+		}
+		if err := applyAmendment(amendment, req); err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid medical record amendment: %v", err)
+			return err
+		}
+
+		if err := h.repo.MarkAmended(ctx, original.ID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to mark medical record amended: %v", err)
+			return fmt.Errorf("failed to mark medical record amended: %w", err)
+		}
+		if err := h.repo.Create(ctx, amendment); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to create medical record amendment: %v", err)
+			return fmt.Errorf("failed to create medical record amendment: %w", err)
+		}
+		return h.finalize(ctx, amendment, req.AuthorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordToDetail(amendment), nil
+}
+
+// EnterMedicalRecordInError retracts a record in place of deleting it. The
+// record stays in its revision history but drops out of the patient's
+// medical history. Only the current version can be retracted.
+func (h *MedicalRecordHandler) EnterMedicalRecordInError(ctx context.Context, req *EnterMedicalRecordInErrorRequest) (*MedicalRecordDetail, error) {
+	ctx, span := otel.Trace(ctx, "MedicalRecordHandler.EnterMedicalRecordInError")
+	defer span.End()
+
+	reason := strings.TrimSpace(req.Reason)
+	if req.By == "" || reason == "" {
+		h.log.WithContext(ctx).Errorf("Retraction author and reason are required")
+		return nil, fmt.Errorf("by and reason are required")
+	}
+
+	var record *entity.MedicalRecord
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		record, err = h.lockRecord(ctx, req.RecordID)
+		if err != nil {
+			return err
+		}
+		switch record.Status {
+		case entity.MedicalRecordStatusAmended:
+			h.log.WithContext(ctx).Errorf("Cannot retract superseded medical record version: %s", record.ID)
+			return fmt.Errorf("medical record has been amended; enter the current version in error instead")
+		case entity.MedicalRecordStatusEnteredInError:
+			h.log.WithContext(ctx).Errorf("Medical record already entered in error: %s", record.ID)
+			return fmt.Errorf("medical record is already entered in error")
+		}
+
+		now := time.Now().Truncate(time.Second)
+		if err := h.repo.MarkEnteredInError(ctx, record.ID, req.By, reason, now); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to enter medical record in error: %v", err)
+			return fmt.Errorf("failed to enter medical record in error: %w", err)
+		}
+		record.Status = entity.MedicalRecordStatusEnteredInError
+		record.EnteredInErrorAt = &now
+		record.EnteredInErrorBy = req.By
+		record.EnteredInErrorReason = reason
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordToDetail(record), nil
+}
+
+// VerifyMedicalRecordSignature checks that a final record is unchanged since
+// it was signed.
+func (h *MedicalRecordHandler) VerifyMedicalRecordSignature(ctx context.Context, id string) (*SignatureVerification, error) {
+	ctx, span := otel.Trace(ctx, "MedicalRecordHandler.VerifyMedicalRecordSignature")
+	defer span.End()
+
+	record, err := h.getRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	verification, err := h.signer.verify(ctx, "medical_records", "medical_record", record.ID, record.PatientID, record.Signature, func(patientID string) []byte {
+		return medicalRecordContent(record, patientID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if verification.Signed && !verification.Valid {
+		h.log.WithContext(ctx).Warnf("Medical record %s failed signature verification: %s", record.ID, verification.Problem)
+	}
+	return verification, nil
+}
+
+// finalize signs the record as signerID, stores it as final and records its
+// vital signs as observations.
+func (h *MedicalRecordHandler) finalize(ctx context.Context, record *entity.MedicalRecord, signerID string) error {
+	record.Status = entity.MedicalRecordStatusFinal
+	if err := h.signer.sign(&record.Signature, signerID, time.Now(), func() []byte {
+		return medicalRecordContent(record, record.PatientID)
+	}); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to sign medical record: %v", err)
+		return err
+	}
+	if err := h.repo.UpdateDraft(ctx, record); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to finalize medical record: %v", err)
+		return fmt.Errorf("failed to finalize medical record: %w", err)
+	}
+	if err := h.vitalRepo.Create(ctx, data.RecordVitalSigns(record)); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to record vital signs: %v", err)
+		return fmt.Errorf("failed to record vital signs: %w", err)
+	}
+	return nil
+}
+
+// versions returns every version of the record, oldest first.
+func (h *MedicalRecordHandler) versions(ctx context.Context, record *entity.MedicalRecord) ([]*entity.MedicalRecord, error) {
+	versions, err := h.repo.GetVersions(ctx, record.OriginalID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get medical record versions: %v", err)
+		return nil, fmt.Errorf("failed to get medical record versions: %w", err)
+	}
+	if len(versions) == 0 {
+		versions = []*entity.MedicalRecord{record}
+	}
+	return versions, nil
+}
+
+// currentVersion is the latest version that has not been amended.
+func currentVersion(versions []*entity.MedicalRecord) *entity.MedicalRecord {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].Status != entity.MedicalRecordStatusAmended {
+			return versions[i]
+		}
+	}
+	return versions[len(versions)-1]
+}
+
+func (h *MedicalRecordHandler) requireDoctor(ctx context.Context, id string) error {
+	doctor, err := h.doctorRepo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", id)
+		return fmt.Errorf("doctor not found")
+	}
+	return nil
+}
+
+func (h *MedicalRecordHandler) getRecord(ctx context.Context, id string) (*entity.MedicalRecord, error) {
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("Medical record ID is required")
+		return nil, fmt.Errorf("record_id is required")
+	}
+	record, err := h.repo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get medical record: %v", err)
+		return nil, fmt.Errorf("failed to get medical record: %w", err)
+	}
+	if record == nil {
+		h.log.WithContext(ctx).Errorf("Medical record not found: %s", id)
+		return nil, fmt.Errorf("medical record not found")
+	}
+	return record, nil
+}
+
+func (h *MedicalRecordHandler) lockRecord(ctx context.Context, id string) (*entity.MedicalRecord, error) {
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("Medical record ID is required")
+		return nil, fmt.Errorf("record_id is required")
+	}
+	if err := h.repo.Lock(ctx, id); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to lock medical record: %v", err)
+		return nil, fmt.Errorf("failed to lock medical record: %w", err)
+	}
+	return h.getRecord(ctx, id)
+}
+
+func applyRecordContent(record *entity.MedicalRecord, content *MedicalRecordContent) error {
+	visitDate := time.Now()
+	if content.VisitDate != "" {
+		t, err := parseRecordTime(content.VisitDate)
+		if err != nil {
+			return fmt.Errorf("invalid visit_date: %w", err)
+		}
+		visitDate = t
+	}
+	var followUp *time.Time
+	if content.FollowUpDate != "" {
+		t, err := parseRecordTime(content.FollowUpDate)
+		if err != nil {
+			return fmt.Errorf("invalid follow_up_date: %w", err)
+		}
+		followUp = &t
+	}
+
+	record.VisitDate = visitDate.Truncate(time.Second)
+	record.FollowUpDate = followUp
+	record.RecordType = content.RecordType
+	record.Diagnosis = content.Diagnosis
+	record.Symptoms = content.Symptoms
+	record.Treatment = content.Treatment
+	record.Prescriptions = content.Prescriptions
+	record.LabResults = content.LabResults
+	record.VitalSigns = entity.MarshalVitalSigns(content.VitalSigns)
+	record.Notes = content.Notes
+	return nil
+}
+
+func applyAmendment(record *entity.MedicalRecord, req *AmendMedicalRecordRequest) error {
+	if req.VisitDate != nil {
+		t, err := parseRecordTime(*req.VisitDate)
+		if err != nil {
+			return fmt.Errorf("invalid visit_date: %w", err)
+		}
+		record.VisitDate = t
+	}
+	if req.FollowUpDate != nil {
+		record.FollowUpDate = nil
+		if *req.FollowUpDate != "" {
+			t, err := parseRecordTime(*req.FollowUpDate)
+			if err != nil {
+				return fmt.Errorf("invalid follow_up_date: %w", err)
+			}
+			record.FollowUpDate = &t
+		}
+	}
+	for _, f := range []struct {
+		value *string
+		field *string
+	}{
+		{req.RecordType, &record.RecordType},
+		{req.Diagnosis, &record.Diagnosis},
+		{req.Symptoms, &record.Symptoms},
+		{req.Treatment, &record.Treatment},
+		{req.Prescriptions, &record.Prescriptions},
+		{req.LabResults, &record.LabResults},
+		{req.Notes, &record.Notes},
+	} {
+		if f.value != nil {
+			*f.field = *f.value
+		}
+	}
+	if req.VitalSigns != nil {
+		record.VitalSigns = entity.MarshalVitalSigns(req.VitalSigns)
+	}
+	return nil
+}
+
+// parseRecordTime reads an RFC3339 timestamp or a YYYY-MM-DD day in UTC,
+// kept to the second like every signed timestamp.
+func parseRecordTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC().Truncate(time.Second), nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC3339 nor YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
+func recordToDetail(r *entity.MedicalRecord) *MedicalRecordDetail {
+	detail := &MedicalRecordDetail{
+		RecordID:             r.ID,
+		OriginalID:           r.OriginalID,
+		Version:              r.Version,
+		PatientID:            r.PatientID,
+		DoctorID:             r.DoctorID,
+		Status:               r.Status,
+		VisitDate:            formatTimestamp(r.VisitDate),
+		RecordType:           r.RecordType,
+		Diagnosis:            r.Diagnosis,
+		Symptoms:             r.Symptoms,
+		Treatment:            r.Treatment,
+		Prescriptions:        r.Prescriptions,
+		LabResults:           r.LabResults,
+		VitalSigns:           entity.UnmarshalVitalSigns(r.VitalSigns),
+		Notes:                r.Notes,
+		AmendedFrom:          r.AmendedFrom,
+		AmendmentReason:      r.AmendmentReason,
+		SignedBy:             r.SignedBy,
+		EnteredInErrorBy:     r.EnteredInErrorBy,
+		EnteredInErrorReason: r.EnteredInErrorReason,
+		CreatedAt:            formatTimestamp(r.CreatedAt),
+	}
+	if r.EnteredInErrorAt != nil {
+		detail.EnteredInErrorAt = formatTimestamp(*r.EnteredInErrorAt)
+	}
+	if r.FollowUpDate != nil {
+		detail.FollowUpDate = formatTimestamp(*r.FollowUpDate)
+	}
+	if r.SignedAt != nil {
+		detail.SignedAt = formatTimestamp(*r.SignedAt)
+	}
+	return detail
+}
@@ -0,0 +1,26 @@
+package biz
+
+import (
+	"github.com/arm-1234/medical-service/internal/data"
+)
+
+// nameSyncTargets is the policy deciding which denormalized copies of a
+// patient's or doctor's name follow a rename. Appointments and reviews are
+// working records and always show the current name, past ones included.
+// Issued prescriptions are legal documents: they keep the names they were
+// issued under, so they are never rewritten.
+func nameSyncTargets(party string) []data.NameSyncTarget {
+	switch party {
+	case data.NamePartyPatient:
+		return []data.NameSyncTarget{
+			{Table: "appointments"},
+			{Table: "doctor_reviews"},
+		}
+	case data.NamePartyDoctor:
+		return []data.NameSyncTarget{
+			{Table: "appointments"},
+		}
+	default:
+		return nil
+	}
+}
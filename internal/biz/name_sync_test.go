@@ -0,0 +1,55 @@
+package biz
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arm-1234/medical-service/internal/data"
+)
+
+func TestNameSyncTargets(t *testing.T) {
+	tests := []struct {
+		party string
+		want  []string
+	}{
+		{party: data.NamePartyPatient, want: []string{"appointments", "doctor_reviews"}},
+		{party: data.NamePartyDoctor, want: []string{"appointments"}},
+		{party: "nurse", want: nil},
+		{party: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.party, func(t *testing.T) {
+			targets := nameSyncTargets(tt.party)
+			if tt.want == nil {
+				if targets != nil {
+					t.Fatalf("nameSyncTargets(%q) = %v, want nil", tt.party, targets)
+				}
+				return
+			}
+
+			var tables []string
+			for _, target := range targets {
+				tables = append(tables, target.Table)
+				if len(target.Where) > 0 {
+					t.Errorf("target %s restricted by %v, want every row", target.Table, target.Where)
+				}
+			}
+			if !reflect.DeepEqual(tables, tt.want) {
+				t.Errorf("nameSyncTargets(%q) tables = %v, want %v", tt.party, tables, tt.want)
+			}
+		})
+	}
+}
+
+// Issued prescriptions are legal documents and keep the names they were
+// issued under, whoever is renamed.
+func TestNameSyncTargetsNeverRewritePrescriptions(t *testing.T) {
+	for _, party := range []string{data.NamePartyPatient, data.NamePartyDoctor} {
+		for _, target := range nameSyncTargets(party) {
+			if target.Table == "prescriptions" {
+				t.Errorf("%s rename rewrites prescriptions", party)
+			}
+		}
+	}
+}
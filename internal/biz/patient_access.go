@@ -0,0 +1,69 @@
+package biz
+
+import (
+	"context"
+	"strings"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// accessActorHeader is the request header callers name themselves in when
+// reading patient data. Requests without it are logged as unknownActor.
+const (
+	accessActorHeader = "X-Actor"
+	unknownActor      = "unknown"
+)
+
+// Kinds of patient data an access is logged against.
+const (
+	accessPatient        = "patient"
+	accessProfile        = "profile"
+	accessMedicalHistory = "medical_history"
+	accessAppointments   = "appointments"
+	accessPrescription   = "prescription"
+	accessPrescriptions  = "prescriptions"
+	accessMedicalRecord  = "medical_record"
+	accessVitalSigns     = "vital_signs"
+	accessLabResults     = "lab_results"
+	accessExport         = "export"
+)
+
+// AccessAuditor keeps the log of who read which patient's data, which
+// patients receive with their data export.
+type AccessAuditor struct {
+	repo data.PatientExportRepo
+	log  *log.Helper
+}
+
+func NewAccessAuditor(repo data.PatientExportRepo, logger log.Logger) *AccessAuditor {
+	return &AccessAuditor{
+		repo: repo,
+		log:  log.NewHelper(logger),
+	}
+}
+
+// Record logs a read of a patient's data by the caller of ctx. A read that
+// cannot be logged is still served.
+func (a *AccessAuditor) Record(ctx context.Context, patientID, resource, resourceID string) {
+	access := &entity.PatientAccess{
+		PatientID:  patientID,
+		Actor:      unknownActor,
+		Resource:   resource,
+		ResourceID: resourceID,
+	}
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		if actor := strings.TrimSpace(tr.RequestHeader().Get(accessActorHeader)); actor != "" {
+			if len(actor) > 100 {
+				actor = actor[:100]
+			}
+			access.Actor = actor
+		}
+		access.Operation = tr.Operation()
+	}
+	if err := a.repo.RecordAccess(ctx, access); err != nil {
+		a.log.WithContext(ctx).Errorf("Failed to log access to patient %s: %v", patientID, err)
+	}
+}
@@ -0,0 +1,750 @@
+package biz
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/archive"
+	"github.com/arm-1234/medical-service/internal/pkg/fhir"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// staleExportAfter is how long an export may stay running before it is
+// taken to have been abandoned by a stopped process and built again.
+const staleExportAfter = time.Hour
+
+// Files of a patient data export archive.
+const (
+	exportDataFile    = "patient.json"
+	exportBundleFile  = "fhir-bundle.json"
+	exportSummaryFile = "summary.pdf"
+)
+
+type RequestPatientExportRequest struct {
+	PatientID   string `json:"patient_id,omitempty"`
+	RequestedBy string `json:"requested_by"`
+}
+
+// PatientExportStatus reports how far an export has got. The archive can be
+// downloaded once Status is completed, until ExpiresAt.
+type PatientExportStatus struct {
+	ExportID      string `json:"export_id"`
+	PatientID     string `json:"patient_id"`
+	Status        string `json:"status"`
+	RequestedBy   string `json:"requested_by"`
+	Error         string `json:"error,omitempty"`
+	ArchiveSize   int64  `json:"archive_size,omitempty"`
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+	RequestedAt   string `json:"requested_at"`
+	StartedAt     string `json:"started_at,omitempty"`
+	CompletedAt   string `json:"completed_at,omitempty"`
+	ExpiresAt     string `json:"expires_at,omitempty"`
+}
+
+// PatientDataExport is the patient.json file of an export: everything held
+// about the patient, in the shapes the API returns it in.
+type PatientDataExport struct {
+	ExportID       string                            `json:"export_id"`
+	GeneratedAt    string                            `json:"generated_at"`
+	Profile        *PatientProfileResponse           `json:"profile"`
+	Appointments   []*responsepb.AppointmentResponse `json:"appointments"`
+	Prescriptions  []*ExportedPrescription           `json:"prescriptions"`
+	MedicalRecords []*MedicalRecordDetail            `json:"medical_records"`
+	VitalSigns     []*VitalObservation               `json:"vital_signs"`
+	LabOrders      []*LabOrderDetail                 `json:"lab_orders"`
+	Merges         []*PatientMergeResponse           `json:"merges"`
+	AccessLog      []*PatientAccessEntry             `json:"access_log"`
+}
+
+type ExportedPrescription struct {
+	Prescription *responsepb.PrescriptionResponse `json:"prescription"`
+	Items        []*PrescriptionItemResponse      `json:"items"`
+}
+
+// PatientAccessEntry is one read of the patient's data. PatientID differs
+// from the exported patient for reads of a record since merged into it.
+type PatientAccessEntry struct {
+	AccessedAt string `json:"accessed_at"`
+	Actor      string `json:"actor"`
+	Operation  string `json:"operation,omitempty"`
+	Resource   string `json:"resource"`
+	ResourceID string `json:"resource_id,omitempty"`
+	PatientID  string `json:"patient_id"`
+}
+
+// PatientExportHandler builds a patient's copy of their data: a zip archive
+// of the data as JSON, the same data as a FHIR collection Bundle, and a PDF
+// summary. Requests are queued and built by the job server.
+type PatientExportHandler struct {
+	repo             data.PatientExportRepo
+	patientRepo      data.PatientRepo
+	doctorRepo       data.DoctorRepo
+	appointmentRepo  data.AppointmentRepo
+	prescriptionRepo data.PrescriptionRepo
+	recordRepo       data.MedicalRecordRepo
+	vitalRepo        data.VitalSignRepo
+	labRepo          data.LabRepo
+	mergeRepo        data.PatientMergeRepo
+	patients         *PatientHandler
+	appointments     *AppointmentHandler
+	prescriptions    *PrescriptionHandler
+	vitals           *VitalSignHandler
+	access           *AccessAuditor
+	store            *archive.Store
+	log              *log.Helper
+}
+
+func NewPatientExportHandler(
+	repo data.PatientExportRepo,
+	patientRepo data.PatientRepo,
+	doctorRepo data.DoctorRepo,
+	appointmentRepo data.AppointmentRepo,
+	prescriptionRepo data.PrescriptionRepo,
+	recordRepo data.MedicalRecordRepo,
+	vitalRepo data.VitalSignRepo,
+	labRepo data.LabRepo,
+	mergeRepo data.PatientMergeRepo,
+	patients *PatientHandler,
+	appointments *AppointmentHandler,
+	prescriptions *PrescriptionHandler,
+	vitals *VitalSignHandler,
+	access *AccessAuditor,
+	store *archive.Store,
+	logger log.Logger,
+) *PatientExportHandler {
+	return &PatientExportHandler{
+		repo:             repo,
+		patientRepo:      patientRepo,
+		doctorRepo:       doctorRepo,
+		appointmentRepo:  appointmentRepo,
+		prescriptionRepo: prescriptionRepo,
+		recordRepo:       recordRepo,
+		vitalRepo:        vitalRepo,
+		labRepo:          labRepo,
+		mergeRepo:        mergeRepo,
+		patients:         patients,
+		appointments:     appointments,
+		prescriptions:    prescriptions,
+		vitals:           vitals,
+		access:           access,
+		store:            store,
+		log:              log.NewHelper(logger),
+	}
+}
+
+// RequestPatientExport queues an export of the patient's data. While an
+// export of the patient is still queued or being built, that export is
+// returned instead of queueing another.
+func (h *PatientExportHandler) RequestPatientExport(ctx context.Context, req *RequestPatientExportRequest) (*PatientExportStatus, error) {
+	ctx, span := otel.Trace(ctx, "PatientExportHandler.RequestPatientExport")
+	defer span.End()
+
+	if req.PatientID == "" {
+		h.log.WithContext(ctx).Errorf("Patient ID is required")
+		return nil, fmt.Errorf("patient_id is required")
+	}
+	requestedBy := strings.TrimSpace(req.RequestedBy)
+	if requestedBy == "" {
+		h.log.WithContext(ctx).Errorf("Export requester is required")
+		return nil, fmt.Errorf("requested_by is required")
+	}
+
+	patient, err := h.patientRepo.Get(ctx, req.PatientID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", req.PatientID)
+		return nil, fmt.Errorf("patient not found")
+	}
+
+	active, err := h.repo.GetActive(ctx, patient.ID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to check for a running export: %v", err)
+		return nil, fmt.Errorf("failed to request export: %w", err)
+	}
+	if active != nil {
+		return exportToStatus(active), nil
+	}
+
+	export := &entity.PatientExport{
+		PatientID:   patient.ID,
+		Status:      entity.PatientExportStatusPending,
+		RequestedBy: requestedBy,
+	}
+	if err := h.repo.Create(ctx, export); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to create patient export: %v", err)
+		return nil, fmt.Errorf("failed to request export: %w", err)
+	}
+	return exportToStatus(export), nil
+}
+
+func (h *PatientExportHandler) GetPatientExport(ctx context.Context, id string) (*PatientExportStatus, error) {
+	ctx, span := otel.Trace(ctx, "PatientExportHandler.GetPatientExport")
+	defer span.End()
+
+	export, err := h.getExport(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return exportToStatus(export), nil
+}
+
+// OpenPatientExport opens the archive of a completed export for download.
+// The caller closes it.
+func (h *PatientExportHandler) OpenPatientExport(ctx context.Context, id string) (*os.File, *PatientExportStatus, error) {
+	ctx, span := otel.Trace(ctx, "PatientExportHandler.OpenPatientExport")
+	defer span.End()
+
+	export, err := h.getExport(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if export.Status != entity.PatientExportStatusCompleted {
+		h.log.WithContext(ctx).Errorf("Patient export %s is %s", export.ID, export.Status)
+		return nil, nil, fmt.Errorf("patient export is %s", export.Status)
+	}
+
+	f, err := h.store.Open(export.ID)
+	if errors.Is(err, archive.ErrNotFound) {
+		h.log.WithContext(ctx).Errorf("Archive of patient export %s is missing", export.ID)
+		return nil, nil, fmt.Errorf("patient export archive is missing")
+	}
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to open patient export %s: %v", export.ID, err)
+		return nil, nil, err
+	}
+	h.access.Record(ctx, export.PatientID, accessExport, export.ID)
+	return f, exportToStatus(export), nil
+}
+
+// RunPatientExports builds every queued export and deletes the archives
+// that have expired. It is run by the job server.
+func (h *PatientExportHandler) RunPatientExports(ctx context.Context) error {
+	ctx, span := otel.Trace(ctx, "PatientExportHandler.RunPatientExports")
+	defer span.End()
+
+	for ctx.Err() == nil {
+		export, err := h.repo.Claim(ctx, time.Now().Add(-staleExportAfter))
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to claim patient export: %v", err)
+			return fmt.Errorf("failed to claim patient export: %w", err)
+		}
+		if export == nil {
+			break
+		}
+		h.build(ctx, export)
+	}
+
+	expired, err := h.repo.ListExpired(ctx, time.Now())
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list expired patient exports: %v", err)
+		return fmt.Errorf("failed to list expired patient exports: %w", err)
+	}
+	for _, export := range expired {
+		if err := h.store.Remove(export.ID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to delete patient export %s: %v", export.ID, err)
+			continue
+		}
+		if err := h.repo.MarkExpired(ctx, export.ID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to expire patient export %s: %v", export.ID, err)
+			continue
+		}
+		h.log.WithContext(ctx).Infof("Deleted expired patient export %s", export.ID)
+	}
+	return nil
+}
+
+// build writes the archive of a claimed export and records the outcome.
+func (h *PatientExportHandler) build(ctx context.Context, export *entity.PatientExport) {
+	started := time.Now()
+	size, sum, err := h.store.Write(export.ID, func(w *zip.Writer) error {
+		return h.writeArchive(ctx, export, w)
+	})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to build patient export %s: %v", export.ID, err)
+		if err := h.repo.Fail(ctx, export.ID, err.Error()); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to record failure of patient export %s: %v", export.ID, err)
+		}
+		return
+	}
+
+	if err := h.repo.Complete(ctx, export.ID, size, sum, time.Now().Add(h.store.Retention())); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to complete patient export %s: %v", export.ID, err)
+		// Left running, the export is built again once it goes stale.
+		return
+	}
+	h.log.WithContext(ctx).Infof("Built patient export %s for patient %s: %d bytes in %s", export.ID, export.PatientID, size, time.Since(started).Round(time.Millisecond))
+}
+
+func (h *PatientExportHandler) writeArchive(ctx context.Context, export *entity.PatientExport, w *zip.Writer) error {
+	patient, err := h.patientRepo.Get(ctx, export.PatientID)
+	if err != nil {
+		return fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		return fmt.Errorf("patient %s no longer exists", export.PatientID)
+	}
+	now := time.Now()
+
+	profile, err := h.patients.loadProfile(ctx, patient)
+	if err != nil {
+		return err
+	}
+	appointments, err := h.appointmentRepo.GetByPatientID(ctx, patient.ID, map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("failed to get appointments: %w", err)
+	}
+	prescriptions, err := h.prescriptionRepo.GetByPatientID(ctx, patient.ID, map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("failed to get prescriptions: %w", err)
+	}
+	prescriptionIDs := make([]string, 0, len(prescriptions))
+	for _, p := range prescriptions {
+		prescriptionIDs = append(prescriptionIDs, p.ID)
+	}
+	items := make(map[string][]*entity.PrescriptionItem)
+	if len(prescriptionIDs) > 0 {
+		all, err := h.prescriptionRepo.GetItems(ctx, prescriptionIDs)
+		if err != nil {
+			return fmt.Errorf("failed to get prescription items: %w", err)
+		}
+		for _, item := range all {
+			items[item.PrescriptionID] = append(items[item.PrescriptionID], item)
+		}
+	}
+	records, err := h.recordRepo.GetByPatientID(ctx, patient.ID, map[string]interface{}{})
+	if err != nil {
+		return fmt.Errorf("failed to get medical records: %w", err)
+	}
+	signs, err := h.vitalRepo.GetSeries(ctx, patient.ID, nil, time.Unix(0, 0), now)
+	if err != nil {
+		return fmt.Errorf("failed to get vital signs: %w", err)
+	}
+	orders, err := h.labRepo.GetOrdersByPatient(ctx, patient.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get lab orders: %w", err)
+	}
+	results, err := h.labRepo.GetResults(ctx, map[string]interface{}{"patient_id": patient.ID, "include_superseded": true})
+	if err != nil {
+		return fmt.Errorf("failed to get lab results: %w", err)
+	}
+	merges, err := h.mergeRepo.ListByPatient(ctx, patient.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get patient merges: %w", err)
+	}
+	// Reads of the records merged into the patient belong to the trail too.
+	accessIDs := []string{patient.ID}
+	for _, m := range merges {
+		if m.SurvivorID == patient.ID {
+			accessIDs = append(accessIDs, m.MergedID)
+		}
+	}
+	accesses, err := h.repo.ListAccess(ctx, accessIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get access log: %w", err)
+	}
+
+	doc := &PatientDataExport{
+		ExportID:       export.ID,
+		GeneratedAt:    formatTimestamp(now),
+		Profile:        profile,
+		Appointments:   []*responsepb.AppointmentResponse{},
+		Prescriptions:  []*ExportedPrescription{},
+		MedicalRecords: []*MedicalRecordDetail{},
+		VitalSigns:     []*VitalObservation{},
+		LabOrders:      []*LabOrderDetail{},
+		Merges:         []*PatientMergeResponse{},
+		AccessLog:      []*PatientAccessEntry{},
+	}
+	for _, a := range appointments {
+		doc.Appointments = append(doc.Appointments, h.appointments.entityToProto(a))
+	}
+	for _, p := range prescriptions {
+		exported := &ExportedPrescription{
+			Prescription: h.prescriptions.entityToProto(p),
+			Items:        []*PrescriptionItemResponse{},
+		}
+		for _, item := range items[p.ID] {
+			exported.Items = append(exported.Items, h.prescriptions.itemToResponse(item))
+		}
+		doc.Prescriptions = append(doc.Prescriptions, exported)
+	}
+	for _, r := range records {
+		doc.MedicalRecords = append(doc.MedicalRecords, recordToDetail(r))
+	}
+	for _, s := range signs {
+		doc.VitalSigns = append(doc.VitalSigns, h.vitals.toObservation(s))
+	}
+	resultsByOrder := make(map[string][]*entity.LabResult)
+	for _, r := range results {
+		resultsByOrder[r.OrderID] = append(resultsByOrder[r.OrderID], r)
+	}
+	for _, o := range orders {
+		tests, err := h.labRepo.GetOrderTests(ctx, o.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get lab order tests: %w", err)
+		}
+		doc.LabOrders = append(doc.LabOrders, labOrderToDetail(o, tests, resultsByOrder[o.ID]))
+	}
+	for _, m := range merges {
+		doc.Merges = append(doc.Merges, h.patients.mergeToResponse(m))
+	}
+	for _, a := range accesses {
+		doc.AccessLog = append(doc.AccessLog, &PatientAccessEntry{
+			AccessedAt: formatTimestamp(a.CreatedAt),
+			Actor:      a.Actor,
+			Operation:  a.Operation,
+			Resource:   a.Resource,
+			ResourceID: a.ResourceID,
+			PatientID:  a.PatientID,
+		})
+	}
+
+	doctors, err := h.exportDoctors(ctx, appointments, prescriptions, records, orders)
+	if err != nil {
+		return err
+	}
+	bundle, err := exportBundle(now, patient, doctors, appointments, prescriptions, items, records)
+	if err != nil {
+		return err
+	}
+	summary, err := archive.RenderSummary(exportSummary(now, patient, doc, doctors, appointments, prescriptions, records, results))
+	if err != nil {
+		return err
+	}
+
+	if err := writeArchiveJSON(w, exportDataFile, doc); err != nil {
+		return err
+	}
+	if err := writeArchiveJSON(w, exportBundleFile, bundle); err != nil {
+		return err
+	}
+	f, err := w.Create(exportSummaryFile)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", exportSummaryFile, err)
+	}
+	if _, err := f.Write(summary); err != nil {
+		return fmt.Errorf("failed to write %s: %w", exportSummaryFile, err)
+	}
+	return nil
+}
+
+// exportDoctors loads every doctor the patient's data refers to, keyed by
+// ID. Doctors that no longer exist are left out.
+func (h *PatientExportHandler) exportDoctors(ctx context.Context, appointments []*entity.Appointment, prescriptions []*entity.Prescription, records []*entity.MedicalRecord, orders []*entity.LabOrder) (map[string]*entity.Doctor, error) {
+	var ids []string
+	for _, a := range appointments {
+		ids = append(ids, a.DoctorID)
+	}
+	for _, p := range prescriptions {
+		ids = append(ids, p.DoctorID)
+	}
+	for _, r := range records {
+		ids = append(ids, r.DoctorID)
+	}
+	for _, o := range orders {
+		ids = append(ids, o.DoctorID)
+	}
+
+	doctors := make(map[string]*entity.Doctor)
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		doctor, err := h.doctorRepo.Get(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get doctor: %w", err)
+		}
+		if doctor != nil {
+			doctors[id] = doctor
+		}
+	}
+	return doctors, nil
+}
+
+func (h *PatientExportHandler) getExport(ctx context.Context, id string) (*entity.PatientExport, error) {
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("Export ID is required")
+		return nil, fmt.Errorf("export_id is required")
+	}
+
+	export, err := h.repo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient export: %v", err)
+		return nil, fmt.Errorf("failed to get patient export: %w", err)
+	}
+	if export == nil {
+		h.log.WithContext(ctx).Errorf("Patient export not found: %s", id)
+		return nil, fmt.Errorf("patient export not found")
+	}
+	return export, nil
+}
+
+// exportBundle is the patient's data as a FHIR collection Bundle, using the
+// same resources the FHIR facade serves.
+func exportBundle(now time.Time, patient *entity.Patient, doctors map[string]*entity.Doctor, appointments []*entity.Appointment, prescriptions []*entity.Prescription, items map[string][]*entity.PrescriptionItem, records []*entity.MedicalRecord) (*fhir.Bundle, error) {
+	type entry struct {
+		resourceType string
+		id           string
+		resource     interface{}
+	}
+	entries := []entry{{"Patient", patient.ID, fhirPatient(patient)}}
+
+	doctorIDs := make([]string, 0, len(doctors))
+	for id := range doctors {
+		doctorIDs = append(doctorIDs, id)
+	}
+	sort.Strings(doctorIDs)
+	for _, id := range doctorIDs {
+		entries = append(entries, entry{"Practitioner", id, fhirPractitioner(doctors[id])})
+	}
+	for _, a := range appointments {
+		entries = append(entries, entry{"Appointment", a.ID, fhirAppointment(a)})
+	}
+	for _, p := range prescriptions {
+		for _, item := range items[p.ID] {
+			entries = append(entries, entry{"MedicationRequest", item.ID, fhirMedicationRequest(item, p)})
+		}
+	}
+	for _, r := range records {
+		entries = append(entries, entry{"Encounter", r.ID, fhirEncounter(r)})
+		if r.Diagnosis != "" {
+			entries = append(entries, entry{"Condition", r.ID, fhirCondition(r)})
+		}
+	}
+
+	total := int64(len(entries))
+	bundle := &fhir.Bundle{
+		ResourceType: "Bundle",
+		Type:         "collection",
+		Timestamp:    fhir.Instant(now),
+		Total:        &total,
+	}
+	for _, e := range entries {
+		raw, err := json.Marshal(e.resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s/%s: %w", e.resourceType, e.id, err)
+		}
+		bundle.Entry = append(bundle.Entry, fhir.BundleEntry{
+			FullURL:  "urn:uuid:" + e.id,
+			Resource: raw,
+		})
+	}
+	return bundle, nil
+}
+
+// exportSummary lays out the human-readable summary of an export. Only the
+// current version of each medical record and the current value of each lab
+// result are summarized; patient.json has the full history.
+func exportSummary(now time.Time, patient *entity.Patient, doc *PatientDataExport, doctors map[string]*entity.Doctor, appointments []*entity.Appointment, prescriptions []*entity.Prescription, records []*entity.MedicalRecord, results []*entity.LabResult) *archive.Summary {
+	name := strings.TrimSpace(patient.FirstName + " " + patient.LastName)
+	doctorName := func(id, fallback string) string {
+		if d, ok := doctors[id]; ok {
+			return "Dr. " + strings.TrimSpace(d.FirstName+" "+d.LastName)
+		}
+		return fallback
+	}
+	address := ""
+	if addr := entity.UnmarshalAddress(patient.Address); addr != nil {
+		var parts []string
+		for _, p := range []string{addr.Street, addr.City, addr.State, addr.ZipCode, addr.Country} {
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+		address = strings.Join(parts, ", ")
+	}
+
+	summary := &archive.Summary{
+		Title:       "Patient data summary: " + name,
+		Subject:     "Patient " + patient.ID,
+		GeneratedAt: now.UTC().Format("2006-01-02 15:04 MST"),
+		Details: [][2]string{
+			{"Patient ID", patient.ID},
+			{"Name", name},
+			{"Date of birth", patient.DateOfBirth},
+			{"Gender", fhirGenders[patient.Gender]},
+			{"Email", patient.Email},
+			{"Phone", patient.PhoneNumber},
+			{"Address", address},
+			{"Medical history", patient.MedicalHistory},
+		},
+	}
+
+	allergies := archive.Section{Title: "Allergies", Empty: "No allergies recorded."}
+	for _, a := range doc.Profile.Allergies {
+		allergies.Entries = append(allergies.Entries, archive.Entry{
+			Heading: a.Allergen,
+			Lines:   []string{joinNonEmpty(", ", a.Reaction, a.Severity), a.Notes},
+		})
+	}
+	conditions := archive.Section{Title: "Conditions", Empty: "No conditions recorded."}
+	for _, c := range doc.Profile.Conditions {
+		conditions.Entries = append(conditions.Entries, archive.Entry{
+			Heading: joinNonEmpty(" ", c.Name, bracketed(c.Code)),
+			Lines:   []string{joinNonEmpty(", ", c.Status, prefixed("diagnosed ", c.DiagnosedOn)), c.Notes},
+		})
+	}
+	medications := archive.Section{Title: "Medications", Empty: "No medications recorded."}
+	for _, m := range doc.Profile.Medications {
+		medications.Entries = append(medications.Entries, archive.Entry{
+			Heading: m.Name,
+			Lines:   []string{joinNonEmpty(", ", m.Dosage, m.Frequency, prefixed("from ", m.StartedOn), prefixed("until ", m.EndedOn)), m.Notes},
+		})
+	}
+
+	visits := archive.Section{Title: "Appointments", Empty: "No appointments."}
+	for _, a := range appointments {
+		visits.Entries = append(visits.Entries, archive.Entry{
+			Heading: a.StartsAt.UTC().Format("2006-01-02 15:04 MST") + " with " + doctorName(a.DoctorID, a.DoctorName),
+			Lines:   []string{joinNonEmpty(", ", bulkAppointmentStatuses[a.Status], bulkConsultationTypes[a.ConsultationType]), a.ReasonForVisit},
+		})
+	}
+
+	scripts := archive.Section{Title: "Prescriptions", Empty: "No prescriptions."}
+	for i, p := range prescriptions {
+		entry := archive.Entry{
+			Heading: p.PrescriptionDate.Format(dateLayout) + " by " + doctorName(p.DoctorID, p.DoctorName),
+			Lines:   []string{joinNonEmpty(", ", p.Status, prefixed("valid until ", p.ValidUntil.Format(dateLayout))), prefixed("Diagnosis: ", p.Diagnosis)},
+		}
+		for _, item := range doc.Prescriptions[i].Items {
+			entry.Lines = append(entry.Lines, "- "+joinNonEmpty(", ", item.MedicationName, item.DosageText, item.FrequencyText, item.DurationText))
+		}
+		scripts.Entries = append(scripts.Entries, entry)
+	}
+
+	visitNotes := archive.Section{Title: "Medical records", Empty: "No medical records."}
+	for _, r := range records {
+		if r.Status == entity.MedicalRecordStatusAmended {
+			continue
+		}
+		heading := r.VisitDate.Format(dateLayout) + " " + joinNonEmpty(" ", r.RecordType, "by "+doctorName(r.DoctorID, r.DoctorID))
+		if r.Status != entity.MedicalRecordStatusFinal {
+			heading += " (" + strings.ReplaceAll(r.Status, "_", " ") + ")"
+		}
+		visitNotes.Entries = append(visitNotes.Entries, archive.Entry{
+			Heading: heading,
+			Lines:   []string{prefixed("Symptoms: ", r.Symptoms), prefixed("Diagnosis: ", r.Diagnosis), prefixed("Treatment: ", r.Treatment), prefixed("Notes: ", r.Notes)},
+		})
+	}
+
+	labs := archive.Section{Title: "Lab results", Empty: "No lab results."}
+	for _, r := range results {
+		if r.SupersededBy != "" {
+			continue
+		}
+		flag := ""
+		if r.Abnormal {
+			flag = "abnormal"
+		}
+		labs.Entries = append(labs.Entries, archive.Entry{
+			Heading: r.ObservedAt.Format(dateLayout) + " " + joinNonEmpty(" ", r.TestName, bracketed(r.TestCode)),
+			Lines:   []string{joinNonEmpty(", ", joinNonEmpty(" ", r.Value, r.Unit), prefixed("reference ", r.ReferenceRange), flag, r.Status)},
+		})
+	}
+
+	// The latest reading of each vital sign.
+	latest := make(map[string]*VitalObservation)
+	var codes []string
+	for _, v := range doc.VitalSigns {
+		if _, ok := latest[v.Code]; !ok {
+			codes = append(codes, v.Code)
+		}
+		latest[v.Code] = v
+	}
+	sort.Strings(codes)
+	vitalSigns := archive.Section{Title: "Latest vital signs", Empty: "No vital signs recorded."}
+	for _, code := range codes {
+		v := latest[code]
+		vitalSigns.Entries = append(vitalSigns.Entries, archive.Entry{
+			Heading: strings.ReplaceAll(code, "_", " "),
+			Lines:   []string{joinNonEmpty(", ", joinNonEmpty(" ", fmt.Sprint(v.Value), v.Unit), v.Flag, prefixed("on ", v.ObservedAt))},
+		})
+	}
+
+	trail := archive.Section{Title: "Who accessed your data", Empty: "No recorded accesses."}
+	for _, a := range doc.AccessLog {
+		trail.Entries = append(trail.Entries, archive.Entry{
+			Heading: a.AccessedAt + " by " + a.Actor,
+			Lines:   []string{joinNonEmpty(" ", strings.ReplaceAll(a.Resource, "_", " "), a.ResourceID), a.Operation},
+		})
+	}
+
+	summary.Sections = []archive.Section{allergies, conditions, medications, visits, scripts, visitNotes, labs, vitalSigns, trail}
+	return summary
+}
+
+func exportToStatus(e *entity.PatientExport) *PatientExportStatus {
+	status := &PatientExportStatus{
+		ExportID:      e.ID,
+		PatientID:     e.PatientID,
+		Status:        e.Status,
+		RequestedBy:   e.RequestedBy,
+		Error:         e.Error,
+		ArchiveSize:   e.ArchiveSize,
+		ArchiveSHA256: e.ArchiveSHA256,
+		RequestedAt:   formatTimestamp(e.CreatedAt),
+	}
+	if e.StartedAt != nil {
+		status.StartedAt = formatTimestamp(*e.StartedAt)
+	}
+	if e.CompletedAt != nil {
+		status.CompletedAt = formatTimestamp(*e.CompletedAt)
+	}
+	if e.ExpiresAt != nil {
+		status.ExpiresAt = formatTimestamp(*e.ExpiresAt)
+	}
+	return status
+}
+
+func writeArchiveJSON(w *zip.Writer, name string, v interface{}) error {
+	f, err := w.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+func prefixed(prefix, v string) string {
+	if v == "" {
+		return ""
+	}
+	return prefix + v
+}
+
+func bracketed(v string) string {
+	if v == "" {
+		return ""
+	}
+	return "[" + v + "]"
+}
@@ -3,6 +3,7 @@ package biz
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	commonpb "github.com/arm-1234/common-protos/medical/v1/common"
 	requestpb "github.com/arm-1234/common-protos/medical/v1/request"
@@ -14,16 +15,35 @@ import (
 )
 
 type PatientHandler struct {
-	repo       data.PatientRepo
-	recordRepo data.MedicalRecordRepo
-	log        *log.Helper
+	repo        data.PatientRepo
+	recordRepo  data.MedicalRecordRepo
+	mergeRepo   data.PatientMergeRepo
+	nameRepo    data.NameSyncRepo
+	profileRepo data.PatientProfileRepo
+	tx          data.Transaction
+	access      *AccessAuditor
+	log         *log.Helper
 }
 
-func NewPatientHandler(repo data.PatientRepo, recordRepo data.MedicalRecordRepo, logger log.Logger) *PatientHandler {
+func NewPatientHandler(
+	repo data.PatientRepo,
+	recordRepo data.MedicalRecordRepo,
+	mergeRepo data.PatientMergeRepo,
+	nameRepo data.NameSyncRepo,
+	profileRepo data.PatientProfileRepo,
+	tx data.Transaction,
+	access *AccessAuditor,
+	logger log.Logger,
+) *PatientHandler {
 	return &PatientHandler{
-		repo:       repo,
-		recordRepo: recordRepo,
-		log:        log.NewHelper(logger),
+		repo:        repo,
+		recordRepo:  recordRepo,
+		mergeRepo:   mergeRepo,
+		nameRepo:    nameRepo,
+		profileRepo: profileRepo,
+		tx:          tx,
+		access:      access,
+		log:         log.NewHelper(logger),
 	}
 }
 
@@ -81,6 +101,8 @@ func (h *PatientHandler) RegisterPatient(ctx context.Context, req *requestpb.Reg
 		patient.Address = entity.MarshalAddress(addr)
 	}
 
+	h.warnDuplicates(ctx, patient)
+
 	if err := h.repo.Create(ctx, patient); err != nil {
 		h.log.WithContext(ctx).Errorf("Failed to create patient: %v", err)
 		return nil, fmt.Errorf("failed to create patient: %w", err)
@@ -108,6 +130,7 @@ func (h *PatientHandler) GetPatient(ctx context.Context, id string) (*responsepb
 		return nil, fmt.Errorf("patient not found")
 	}
 
+	h.access.Record(ctx, patient.ID, accessPatient, "")
 	return h.entityToProto(patient), nil
 }
 
@@ -129,6 +152,7 @@ func (h *PatientHandler) UpdatePatient(ctx context.Context, id string, req *requ
 		h.log.WithContext(ctx).Errorf("Patient not found: %s", id)
 		return nil, fmt.Errorf("patient not found")
 	}
+	oldName := patient.FirstName + " " + patient.LastName
 
 	if req.FirstName != nil {
 		patient.FirstName = req.GetFirstName()
@@ -163,23 +187,42 @@ func (h *PatientHandler) UpdatePatient(ctx context.Context, id string, req *requ
 		patient.Address = entity.MarshalAddress(addr)
 	}
 
-	if err := h.repo.Update(ctx, patient); err != nil {
-		h.log.WithContext(ctx).Errorf("Failed to update patient: %v", err)
-		return nil, fmt.Errorf("failed to update patient: %w", err)
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.repo.Update(ctx, patient); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to update patient: %v", err)
+			return fmt.Errorf("failed to update patient: %w", err)
+		}
+		if name := patient.FirstName + " " + patient.LastName; name != oldName {
+			return h.syncName(ctx, patient.ID, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return h.entityToProto(patient), nil
 }
 
+// syncName propagates a patient's new name to the rows that copy it, as far
+// as nameSyncTargets allows.
+func (h *PatientHandler) syncName(ctx context.Context, patientID, name string) error {
+	updated, err := h.nameRepo.SyncName(ctx, data.NamePartyPatient, patientID, name, nameSyncTargets(data.NamePartyPatient))
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to sync patient name: %v", err)
+		return fmt.Errorf("failed to sync patient name: %w", err)
+	}
+
+	h.log.WithContext(ctx).Infof("Synced name of patient %s: %v", patientID, updated)
+	return nil
+}
+
 func (h *PatientHandler) SearchPatients(ctx context.Context, req *requestpb.SearchPatientsRequest) ([]*responsepb.PatientResponse, error) {
 	ctx, span := otel.Trace(ctx, "PatientHandler.SearchPatients")
 	defer span.End()
 
 	filters := make(map[string]interface{})
 
-	if req.GetName() != "" {
-		filters["name"] = req.GetName()
-	}
 	if req.GetEmail() != "" {
 		filters["email"] = req.GetEmail()
 	}
@@ -190,6 +233,10 @@ func (h *PatientHandler) SearchPatients(ctx context.Context, req *requestpb.Sear
 		filters["patient_id"] = req.GetPatientId()
 	}
 
+	if req.GetName() != "" {
+		return h.searchPatientsByName(ctx, req.GetName(), filters)
+	}
+
 	patients, err := h.repo.Search(ctx, filters)
 	if err != nil {
 		h.log.WithContext(ctx).Errorf("Failed to search patients: %v", err)
@@ -204,6 +251,33 @@ func (h *PatientHandler) SearchPatients(ctx context.Context, req *requestpb.Sear
 	return responses, nil
 }
 
+// searchPatientsByName ranks patients by fuzzy name match, keeping only those
+// that also satisfy the exact filters.
+func (h *PatientHandler) searchPatientsByName(ctx context.Context, name string, filters map[string]interface{}) ([]*responsepb.PatientResponse, error) {
+	matches, err := h.matchPatients(ctx, name, &PatientMatchRequest{}, searchThreshold)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to search patients: %v", err)
+		return nil, fmt.Errorf("failed to search patients: %w", err)
+	}
+
+	var responses []*responsepb.PatientResponse
+	for _, m := range matches {
+		p := m.patient
+		if email, ok := filters["email"].(string); ok && !strings.EqualFold(email, p.Email) {
+			continue
+		}
+		if phone, ok := filters["phone_number"].(string); ok && phone != p.PhoneNumber {
+			continue
+		}
+		if id, ok := filters["patient_id"].(string); ok && id != p.ID {
+			continue
+		}
+		responses = append(responses, h.entityToProto(p))
+	}
+
+	return responses, nil
+}
+
 func (h *PatientHandler) GetMedicalHistory(ctx context.Context, id string, fromDate, toDate string) (*responsepb.MedicalHistoryResponse, error) {
 	ctx, span := otel.Trace(ctx, "PatientHandler.GetMedicalHistory")
 	defer span.End()
@@ -218,7 +292,9 @@ func (h *PatientHandler) GetMedicalHistory(ctx context.Context, id string, fromD
 		return nil, fmt.Errorf("patient not found")
 	}
 
-	filters := make(map[string]interface{})
+	// The history shows the current version of each finalized record;
+	// drafts, superseded versions and records entered in error are left out.
+	filters := map[string]interface{}{"status": entity.MedicalRecordStatusFinal}
 	if fromDate != "" {
 		filters["from_date"] = fromDate
 	}
@@ -226,11 +302,12 @@ func (h *PatientHandler) GetMedicalHistory(ctx context.Context, id string, fromD
 		filters["to_date"] = toDate
 	}
 
-	records, err := h.recordRepo.GetByPatientID(ctx, id, filters)
+	records, err := h.recordRepo.GetByPatientID(ctx, patient.ID, filters)
 	if err != nil {
 		h.log.WithContext(ctx).Errorf("Failed to fetch medical records: %v", err)
 		return nil, fmt.Errorf("failed to fetch medical records: %w", err)
 	}
+	h.access.Record(ctx, patient.ID, accessMedicalHistory, "")
 
 	var protoRecords []*responsepb.MedicalRecord
 	for _, record := range records {
@@ -243,6 +320,10 @@ func (h *PatientHandler) GetMedicalHistory(ctx context.Context, id string, fromD
 	}, nil
 }
 
+// entityToProto maps the patient onto the shared PatientResponse message. The
+// message, like RegisterPatientRequest and UpdatePatientRequest, has no fields
+// for the medical history or emergency contacts, so those and the other
+// profile sections are served by GetPatientProfile instead.
 func (h *PatientHandler) entityToProto(patient *entity.Patient) *responsepb.PatientResponse {
 	response := &responsepb.PatientResponse{
 		PatientId:   patient.ID,
@@ -0,0 +1,283 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/namematch"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+const (
+	// searchThreshold is the lowest score a search result may have.
+	searchThreshold = 0.3
+	// duplicateThreshold is the score above which an existing patient is
+	// reported as a likely duplicate: e.g. a near-identical name plus the
+	// same date of birth.
+	duplicateThreshold = 0.75
+
+	defaultMatchLimit = 20
+	maxMatchLimit     = 100
+	candidateLimit    = 500
+
+	duplicateCandidatesHeader = "X-Duplicate-Candidates"
+)
+
+type PatientMatchRequest struct {
+	Query       string `json:"q"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	DateOfBirth string `json:"date_of_birth"`
+	PhoneNumber string `json:"phone_number"`
+	Email       string `json:"email"`
+	Limit       int    `json:"limit"`
+}
+
+type PatientMatch struct {
+	Patient   *responsepb.PatientResponse `json:"patient"`
+	Score     float64                     `json:"score"`
+	MatchedOn []string                    `json:"matched_on"`
+}
+
+type PatientMatchResponse struct {
+	Matches []*PatientMatch `json:"matches"`
+}
+
+type scoredPatient struct {
+	patient   *entity.Patient
+	score     float64
+	matchedOn []string
+}
+
+// FindPatients runs a fuzzy patient search: name tokens are matched
+// phonetically and by similarity, and combined with exact date of birth,
+// phone and email matches into a single score.
+func (h *PatientHandler) FindPatients(ctx context.Context, req *PatientMatchRequest) (*PatientMatchResponse, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.FindPatients")
+	defer span.End()
+
+	name := strings.TrimSpace(req.Query + " " + req.FirstName + " " + req.LastName)
+	if name == "" && req.DateOfBirth == "" && req.PhoneNumber == "" && req.Email == "" {
+		h.log.WithContext(ctx).Errorf("Empty patient search")
+		return nil, fmt.Errorf("a name, date_of_birth, phone_number or email is required")
+	}
+
+	matches, err := h.matchPatients(ctx, name, req, searchThreshold)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to search patients: %v", err)
+		return nil, fmt.Errorf("failed to search patients: %w", err)
+	}
+
+	return h.matchResponse(matches, req.Limit), nil
+}
+
+// FindDuplicates lists existing patients that are likely the same person as
+// the given details.
+func (h *PatientHandler) FindDuplicates(ctx context.Context, req *PatientMatchRequest) (*PatientMatchResponse, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.FindDuplicates")
+	defer span.End()
+
+	if req.FirstName == "" || req.LastName == "" {
+		h.log.WithContext(ctx).Errorf("First name and last name are required")
+		return nil, fmt.Errorf("first_name and last_name are required")
+	}
+
+	matches, err := h.matchPatients(ctx, req.FirstName+" "+req.LastName, req, duplicateThreshold)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to find duplicate patients: %v", err)
+		return nil, fmt.Errorf("failed to find duplicate patients: %w", err)
+	}
+
+	return h.matchResponse(matches, req.Limit), nil
+}
+
+// FindPatientDuplicates lists likely duplicates of an existing patient.
+func (h *PatientHandler) FindPatientDuplicates(ctx context.Context, id string) (*PatientMatchResponse, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.FindPatientDuplicates")
+	defer span.End()
+
+	patient, err := h.repo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", id)
+		return nil, fmt.Errorf("patient not found")
+	}
+
+	matches, err := h.duplicatesOf(ctx, patient)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to find duplicate patients: %v", err)
+		return nil, fmt.Errorf("failed to find duplicate patients: %w", err)
+	}
+
+	return h.matchResponse(matches, 0), nil
+}
+
+func (h *PatientHandler) duplicatesOf(ctx context.Context, patient *entity.Patient) ([]*scoredPatient, error) {
+	matches, err := h.matchPatients(ctx, patient.FirstName+" "+patient.LastName, &PatientMatchRequest{
+		DateOfBirth: patient.DateOfBirth,
+		PhoneNumber: patient.PhoneNumber,
+		Email:       patient.Email,
+	}, duplicateThreshold)
+	if err != nil {
+		return nil, err
+	}
+
+	var others []*scoredPatient
+	for _, m := range matches {
+		if m.patient.ID != patient.ID {
+			others = append(others, m)
+		}
+	}
+	return others, nil
+}
+
+// warnDuplicates reports likely duplicates of a patient about to be
+// registered through the reply header, so that clients can prompt for a
+// review. Registration goes ahead regardless.
+func (h *PatientHandler) warnDuplicates(ctx context.Context, patient *entity.Patient) {
+	matches, err := h.duplicatesOf(ctx, patient)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to check for duplicate patients: %v", err)
+		return
+	}
+	if len(matches) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m.patient.ID)
+	}
+	h.log.WithContext(ctx).Warnf("Patient %s %s may duplicate existing patients: %s", patient.FirstName, patient.LastName, strings.Join(ids, ", "))
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		tr.ReplyHeader().Set(duplicateCandidatesHeader, strings.Join(ids, ","))
+	}
+}
+
+func (h *PatientHandler) matchPatients(ctx context.Context, name string, req *PatientMatchRequest, threshold float64) ([]*scoredPatient, error) {
+	queryTokens := namematch.Tokenize(name)
+
+	filters := map[string]interface{}{"limit": candidateLimit}
+	var codes []string
+	for _, t := range queryTokens {
+		if c := namematch.Soundex(t); c != "" {
+			codes = append(codes, c)
+		}
+	}
+	if len(queryTokens) > 0 {
+		filters["tokens"] = queryTokens
+		filters["phonetic"] = codes
+		// The last token may still be being typed.
+		if last := queryTokens[len(queryTokens)-1]; len(last) >= 3 {
+			filters["prefixes"] = []string{last}
+		}
+	}
+	if req.DateOfBirth != "" {
+		filters["date_of_birth"] = req.DateOfBirth
+	}
+	if req.PhoneNumber != "" {
+		filters["phone_number"] = req.PhoneNumber
+	}
+	if req.Email != "" {
+		filters["email"] = req.Email
+	}
+
+	candidates, err := h.repo.SearchCandidates(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*scoredPatient
+	for _, p := range candidates {
+		score, matchedOn := scorePatient(queryTokens, req, p)
+		if score >= threshold {
+			matches = append(matches, &scoredPatient{patient: p, score: score, matchedOn: matchedOn})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	return matches, nil
+}
+
+// scorePatient rates a candidate between 0 and 1. The name contributes up to
+// 0.6; each exact date of birth, phone or email match adds 0.25.
+func scorePatient(queryTokens []string, req *PatientMatchRequest, p *entity.Patient) (float64, []string) {
+	var score float64
+	var matchedOn []string
+
+	if len(queryTokens) > 0 {
+		if s := nameScore(queryTokens, namematch.Tokenize(p.FirstName+" "+p.LastName)); s > 0 {
+			score += 0.6 * s
+			matchedOn = append(matchedOn, "name")
+		}
+	}
+	if req.DateOfBirth != "" && req.DateOfBirth == p.DateOfBirth {
+		score += 0.25
+		matchedOn = append(matchedOn, "date_of_birth")
+	}
+	if phone := namematch.NormalizePhone(req.PhoneNumber); phone != "" && phone == namematch.NormalizePhone(p.PhoneNumber) {
+		score += 0.25
+		matchedOn = append(matchedOn, "phone_number")
+	}
+	if req.Email != "" && strings.EqualFold(req.Email, p.Email) {
+		score += 0.25
+		matchedOn = append(matchedOn, "email")
+	}
+
+	if score > 1 {
+		score = 1
+	}
+	return score, matchedOn
+}
+
+// nameScore averages, over the query tokens, the best similarity to any of
+// the candidate's name tokens, ignoring weak matches.
+func nameScore(query, candidate []string) float64 {
+	var total float64
+	for _, q := range query {
+		best := 0.0
+		for _, c := range candidate {
+			s := namematch.Similarity(q, c)
+			if len(q) >= 3 && strings.HasPrefix(c, q) && s < 0.9 {
+				s = 0.9
+			}
+			if s > best {
+				best = s
+			}
+		}
+		if best >= 0.75 {
+			total += best
+		}
+	}
+	return total / float64(len(query))
+}
+
+func (h *PatientHandler) matchResponse(matches []*scoredPatient, limit int) *PatientMatchResponse {
+	if limit <= 0 {
+		limit = defaultMatchLimit
+	}
+	if limit > maxMatchLimit {
+		limit = maxMatchLimit
+	}
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	resp := &PatientMatchResponse{Matches: make([]*PatientMatch, 0, len(matches))}
+	for _, m := range matches {
+		resp.Matches = append(resp.Matches, &PatientMatch{
+			Patient:   h.entityToProto(m.patient),
+			Score:     m.score,
+			MatchedOn: m.matchedOn,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,243 @@
+package biz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+)
+
+type MergePatientsRequest struct {
+	SurvivorID          string `json:"survivor_id,omitempty"`
+	DuplicateID         string `json:"duplicate_id"`
+	PerformedBy         string `json:"performed_by"`
+	Reason              string `json:"reason"`
+	UseDuplicateContact bool   `json:"use_duplicate_contact"`
+}
+
+type PatientMergeResponse struct {
+	MergeID      string                      `json:"merge_id"`
+	SurvivorID   string                      `json:"survivor_id"`
+	MergedID     string                      `json:"merged_id"`
+	PerformedBy  string                      `json:"performed_by"`
+	Reason       string                      `json:"reason"`
+	MovedRecords map[string][]string         `json:"moved_records"`
+	CreatedAt    string                      `json:"created_at"`
+	Survivor     *responsepb.PatientResponse `json:"survivor,omitempty"`
+}
+
+type ListPatientMergesResponse struct {
+	PatientID string                  `json:"patient_id"`
+	Merges    []*PatientMergeResponse `json:"merges"`
+}
+
+// MergePatients folds a duplicate registration into the surviving patient:
+// every appointment, prescription, medical record, review and calendar feed
+// of the duplicate is moved over, and the duplicate is left behind as a
+// tombstone that redirects to the survivor. Everything happens in one
+// transaction together with the audit record.
+func (h *PatientHandler) MergePatients(ctx context.Context, req *MergePatientsRequest) (*PatientMergeResponse, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.MergePatients")
+	defer span.End()
+
+	if req.SurvivorID == "" || req.DuplicateID == "" {
+		h.log.WithContext(ctx).Errorf("Survivor and duplicate patient IDs are required")
+		return nil, fmt.Errorf("patient_id and duplicate_id are required")
+	}
+	if req.SurvivorID == req.DuplicateID {
+		h.log.WithContext(ctx).Errorf("Cannot merge patient into itself: %s", req.SurvivorID)
+		return nil, fmt.Errorf("a patient cannot be merged into itself")
+	}
+	if strings.TrimSpace(req.PerformedBy) == "" {
+		h.log.WithContext(ctx).Errorf("Merge performer is required")
+		return nil, fmt.Errorf("performed_by is required")
+	}
+
+	var survivor *entity.Patient
+	var merge *entity.PatientMerge
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		// Lock in a fixed order so that two merges of the same pair
+		// cannot deadlock.
+		first, second := req.SurvivorID, req.DuplicateID
+		if second < first {
+			first, second = second, first
+		}
+		for _, id := range []string{first, second} {
+			if err := h.repo.Lock(ctx, id); err != nil {
+				h.log.WithContext(ctx).Errorf("Failed to lock patient: %v", err)
+				return fmt.Errorf("failed to lock patient: %w", err)
+			}
+		}
+
+		var err error
+		if survivor, err = h.mergeParticipant(ctx, req.SurvivorID); err != nil {
+			return err
+		}
+		duplicate, err := h.mergeParticipant(ctx, req.DuplicateID)
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := json.Marshal(duplicate)
+		if err != nil {
+			return fmt.Errorf("failed to snapshot duplicate patient: %w", err)
+		}
+
+		moved, err := h.mergeRepo.MoveReferences(ctx, duplicate.ID, survivor.ID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to move patient records: %v", err)
+			return fmt.Errorf("failed to move patient records: %w", err)
+		}
+		movedJSON, err := json.Marshal(moved)
+		if err != nil {
+			return fmt.Errorf("failed to encode moved records: %w", err)
+		}
+
+		fillMissingDetails(survivor, duplicate)
+		email, phone := duplicate.Email, duplicate.PhoneNumber
+
+		// The tombstone gives up its email and phone number so that they
+		// stay unique and can be taken over by the survivor.
+		now := time.Now().UTC()
+		duplicate.MergedInto = survivor.ID
+		duplicate.MergedAt = &now
+		duplicate.Email, duplicate.PhoneNumber = tombstoneContact(duplicate.ID)
+		if err := h.repo.Update(ctx, duplicate); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to tombstone duplicate patient: %v", err)
+			return fmt.Errorf("failed to tombstone duplicate patient: %w", err)
+		}
+
+		if req.UseDuplicateContact {
+			survivor.Email, survivor.PhoneNumber = email, phone
+		}
+		if err := h.repo.Update(ctx, survivor); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to update surviving patient: %v", err)
+			return fmt.Errorf("failed to update surviving patient: %w", err)
+		}
+		if err := h.syncName(ctx, survivor.ID, survivor.FirstName+" "+survivor.LastName); err != nil {
+			return err
+		}
+
+		merge = &entity.PatientMerge{
+			SurvivorID:    survivor.ID,
+			MergedID:      duplicate.ID,
+			MergedPatient: string(snapshot),
+			MovedRecords:  string(movedJSON),
+			PerformedBy:   req.PerformedBy,
+			Reason:        req.Reason,
+		}
+		if err := h.mergeRepo.Create(ctx, merge); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to record patient merge: %v", err)
+			return fmt.Errorf("failed to record patient merge: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.log.WithContext(ctx).Infof("Merged patient %s into %s by %s", merge.MergedID, merge.SurvivorID, merge.PerformedBy)
+
+	response := h.mergeToResponse(merge)
+	response.Survivor = h.entityToProto(survivor)
+	return response, nil
+}
+
+// ListPatientMerges returns the merge audit trail of a patient, covering both
+// merges into it and the merge that retired it.
+func (h *PatientHandler) ListPatientMerges(ctx context.Context, patientID string) (*ListPatientMergesResponse, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.ListPatientMerges")
+	defer span.End()
+
+	if patientID == "" {
+		h.log.WithContext(ctx).Errorf("Patient ID is required")
+		return nil, fmt.Errorf("patient_id is required")
+	}
+
+	merges, err := h.mergeRepo.ListByPatient(ctx, patientID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list patient merges: %v", err)
+		return nil, fmt.Errorf("failed to list patient merges: %w", err)
+	}
+
+	response := &ListPatientMergesResponse{PatientID: patientID, Merges: []*PatientMergeResponse{}}
+	for _, m := range merges {
+		response.Merges = append(response.Merges, h.mergeToResponse(m))
+	}
+	return response, nil
+}
+
+// mergeParticipant loads a patient taking part in a merge, refusing patients
+// that have already been merged away.
+func (h *PatientHandler) mergeParticipant(ctx context.Context, id string) (*entity.Patient, error) {
+	patient, err := h.repo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", id)
+		return nil, fmt.Errorf("patient %s not found", id)
+	}
+	if patient.ID != id {
+		h.log.WithContext(ctx).Errorf("Patient %s already merged into %s", id, patient.ID)
+		return nil, fmt.Errorf("patient %s has already been merged into %s", id, patient.ID)
+	}
+	return patient, nil
+}
+
+// fillMissingDetails copies details the survivor lacks from the duplicate.
+// Details both records have are left as the survivor has them.
+func fillMissingDetails(survivor, duplicate *entity.Patient) {
+	if survivor.DateOfBirth == "" {
+		survivor.DateOfBirth = duplicate.DateOfBirth
+	}
+	if survivor.Gender == 0 {
+		survivor.Gender = duplicate.Gender
+	}
+	if survivor.BloodGroup == 0 {
+		survivor.BloodGroup = duplicate.BloodGroup
+	}
+	if survivor.Address == "" {
+		survivor.Address = duplicate.Address
+	}
+	if survivor.EmergencyContact == "" {
+		survivor.EmergencyContact = duplicate.EmergencyContact
+	}
+	if survivor.MedicalHistory == "" {
+		survivor.MedicalHistory = duplicate.MedicalHistory
+	} else if duplicate.MedicalHistory != "" && duplicate.MedicalHistory != survivor.MedicalHistory {
+		survivor.MedicalHistory += "\n" + duplicate.MedicalHistory
+	}
+}
+
+// tombstoneContact derives placeholder contact details for a merged patient
+// from its ID, keeping the unique email and phone columns unique.
+func tombstoneContact(id string) (email, phone string) {
+	compact := strings.ReplaceAll(id, "-", "")
+	if len(compact) > 19 {
+		compact = compact[:19]
+	}
+	return id + "@merged.invalid", "m" + compact
+}
+
+func (h *PatientHandler) mergeToResponse(m *entity.PatientMerge) *PatientMergeResponse {
+	response := &PatientMergeResponse{
+		MergeID:      m.ID,
+		SurvivorID:   m.SurvivorID,
+		MergedID:     m.MergedID,
+		PerformedBy:  m.PerformedBy,
+		Reason:       m.Reason,
+		MovedRecords: map[string][]string{},
+		CreatedAt:    formatTimestamp(m.CreatedAt),
+	}
+	if m.MovedRecords != "" {
+		json.Unmarshal([]byte(m.MovedRecords), &response.MovedRecords)
+	}
+	return response
+}
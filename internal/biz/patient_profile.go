@@ -0,0 +1,555 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+)
+
+// Profile sections, used as the path segment of their endpoints.
+const (
+	ProfileAllergies         = "allergies"
+	ProfileConditions        = "conditions"
+	ProfileMedications       = "medications"
+	ProfileEmergencyContacts = "emergency-contacts"
+	ProfileInsurance         = "insurance"
+)
+
+var ProfileSections = []string{
+	ProfileAllergies,
+	ProfileConditions,
+	ProfileMedications,
+	ProfileEmergencyContacts,
+	ProfileInsurance,
+}
+
+type AllergyItem struct {
+	ID       string `json:"id,omitempty"`
+	Allergen string `json:"allergen"`
+	Reaction string `json:"reaction"`
+	Severity string `json:"severity"`
+	Notes    string `json:"notes"`
+}
+
+type ConditionItem struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Code        string `json:"code"`
+	Status      string `json:"status"`
+	DiagnosedOn string `json:"diagnosed_on"`
+	Notes       string `json:"notes"`
+}
+
+type MedicationItem struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Dosage    string `json:"dosage"`
+	Frequency string `json:"frequency"`
+	StartedOn string `json:"started_on"`
+	EndedOn   string `json:"ended_on"`
+	Notes     string `json:"notes"`
+}
+
+type EmergencyContactItem struct {
+	ID           string `json:"id,omitempty"`
+	Name         string `json:"name"`
+	Relationship string `json:"relationship"`
+	PhoneNumber  string `json:"phone_number"`
+	Email        string `json:"email"`
+	IsPrimary    bool   `json:"is_primary"`
+}
+
+type InsuranceItem struct {
+	ID           string `json:"id,omitempty"`
+	Provider     string `json:"provider"`
+	PolicyNumber string `json:"policy_number"`
+	GroupNumber  string `json:"group_number"`
+	HolderName   string `json:"holder_name"`
+	ValidFrom    string `json:"valid_from"`
+	ValidUntil   string `json:"valid_until"`
+	IsPrimary    bool   `json:"is_primary"`
+}
+
+type MedicalHistoryRequest struct {
+	PatientID      string `json:"patient_id,omitempty"`
+	MedicalHistory string `json:"medical_history"`
+}
+
+// PatientProfileResponse is the patient together with the structured profile.
+// PatientResponse is generated from the shared protos, so the profile is
+// returned alongside it rather than inside it.
+type PatientProfileResponse struct {
+	Patient           *responsepb.PatientResponse `json:"patient"`
+	MedicalHistory    string                      `json:"medical_history"`
+	Allergies         []*AllergyItem              `json:"allergies"`
+	Conditions        []*ConditionItem            `json:"conditions"`
+	Medications       []*MedicationItem           `json:"medications"`
+	EmergencyContacts []*EmergencyContactItem     `json:"emergency_contacts"`
+	Insurance         []*InsuranceItem            `json:"insurance"`
+}
+
+type ProfileItemsResponse struct {
+	PatientID string        `json:"patient_id"`
+	Section   string        `json:"section"`
+	Items     []interface{} `json:"items"`
+}
+
+type DeleteProfileItemResponse struct {
+	ID      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+}
+
+// ProfileItemRequest is the body of a create or update request for one
+// profile section.
+type ProfileItemRequest interface {
+	validate() error
+	applyTo(item entity.PatientProfileItem)
+}
+
+// NewProfileItemRequest returns an empty request body for the section.
+func NewProfileItemRequest(section string) (ProfileItemRequest, error) {
+	switch section {
+	case ProfileAllergies:
+		return &AllergyItem{}, nil
+	case ProfileConditions:
+		return &ConditionItem{}, nil
+	case ProfileMedications:
+		return &MedicationItem{}, nil
+	case ProfileEmergencyContacts:
+		return &EmergencyContactItem{}, nil
+	case ProfileInsurance:
+		return &InsuranceItem{}, nil
+	default:
+		return nil, fmt.Errorf("unknown profile section %q", section)
+	}
+}
+
+func newProfileEntity(section string) (entity.PatientProfileItem, error) {
+	switch section {
+	case ProfileAllergies:
+		return &entity.PatientAllergy{}, nil
+	case ProfileConditions:
+		return &entity.PatientCondition{}, nil
+	case ProfileMedications:
+		return &entity.PatientMedication{}, nil
+	case ProfileEmergencyContacts:
+		return &entity.PatientEmergencyContact{}, nil
+	case ProfileInsurance:
+		return &entity.PatientInsurance{}, nil
+	default:
+		return nil, fmt.Errorf("unknown profile section %q", section)
+	}
+}
+
+// AddProfileItem adds an allergy, condition, medication, emergency contact or
+// insurance policy to the patient's profile.
+func (h *PatientHandler) AddProfileItem(ctx context.Context, patientID, section string, req ProfileItemRequest) (interface{}, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.AddProfileItem")
+	defer span.End()
+
+	patient, item, err := h.profileTarget(ctx, patientID, section)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid %s item: %v", section, err)
+		return nil, err
+	}
+
+	req.applyTo(item)
+	item.Item().PatientID = patient.ID
+
+	if err := h.saveProfileItem(ctx, item, h.profileRepo.Create); err != nil {
+		return nil, err
+	}
+
+	return profileItemResponse(item), nil
+}
+
+func (h *PatientHandler) UpdateProfileItem(ctx context.Context, patientID, section, itemID string, req ProfileItemRequest) (interface{}, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.UpdateProfileItem")
+	defer span.End()
+
+	patient, item, err := h.profileTarget(ctx, patientID, section)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid %s item: %v", section, err)
+		return nil, err
+	}
+
+	found, err := h.profileRepo.Get(ctx, item, patient.ID, itemID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get %s item: %v", section, err)
+		return nil, fmt.Errorf("failed to get %s item: %w", section, err)
+	}
+	if !found {
+		h.log.WithContext(ctx).Errorf("Profile item not found: %s/%s", section, itemID)
+		return nil, fmt.Errorf("%s item not found", section)
+	}
+
+	req.applyTo(item)
+
+	if err := h.saveProfileItem(ctx, item, h.profileRepo.Update); err != nil {
+		return nil, err
+	}
+
+	return profileItemResponse(item), nil
+}
+
+func (h *PatientHandler) DeleteProfileItem(ctx context.Context, patientID, section, itemID string) (*DeleteProfileItemResponse, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.DeleteProfileItem")
+	defer span.End()
+
+	patient, item, err := h.profileTarget(ctx, patientID, section)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := h.profileRepo.Get(ctx, item, patient.ID, itemID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get %s item: %v", section, err)
+		return nil, fmt.Errorf("failed to get %s item: %w", section, err)
+	}
+	if !found {
+		h.log.WithContext(ctx).Errorf("Profile item not found: %s/%s", section, itemID)
+		return nil, fmt.Errorf("%s item not found", section)
+	}
+
+	if err := h.profileRepo.Delete(ctx, item, patient.ID, itemID); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to delete %s item: %v", section, err)
+		return nil, fmt.Errorf("failed to delete %s item: %w", section, err)
+	}
+
+	return &DeleteProfileItemResponse{ID: itemID, Deleted: true}, nil
+}
+
+func (h *PatientHandler) ListProfileItems(ctx context.Context, patientID, section string) (*ProfileItemsResponse, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.ListProfileItems")
+	defer span.End()
+
+	patient, _, err := h.profileTarget(ctx, patientID, section)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := h.loadProfile(ctx, patient)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ProfileItemsResponse{PatientID: patient.ID, Section: section, Items: []interface{}{}}
+	switch section {
+	case ProfileAllergies:
+		for _, i := range profile.Allergies {
+			response.Items = append(response.Items, i)
+		}
+	case ProfileConditions:
+		for _, i := range profile.Conditions {
+			response.Items = append(response.Items, i)
+		}
+	case ProfileMedications:
+		for _, i := range profile.Medications {
+			response.Items = append(response.Items, i)
+		}
+	case ProfileEmergencyContacts:
+		for _, i := range profile.EmergencyContacts {
+			response.Items = append(response.Items, i)
+		}
+	case ProfileInsurance:
+		for _, i := range profile.Insurance {
+			response.Items = append(response.Items, i)
+		}
+	}
+	return response, nil
+}
+
+// GetPatientProfile returns the patient with the free-text medical history
+// and every structured profile section.
+func (h *PatientHandler) GetPatientProfile(ctx context.Context, patientID string) (*PatientProfileResponse, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.GetPatientProfile")
+	defer span.End()
+
+	patient, err := h.profilePatient(ctx, patientID)
+	if err != nil {
+		return nil, err
+	}
+	h.access.Record(ctx, patient.ID, accessProfile, "")
+	return h.loadProfile(ctx, patient)
+}
+
+func (h *PatientHandler) SetMedicalHistory(ctx context.Context, req *MedicalHistoryRequest) (*PatientProfileResponse, error) {
+	ctx, span := otel.Trace(ctx, "PatientHandler.SetMedicalHistory")
+	defer span.End()
+
+	patient, err := h.profilePatient(ctx, req.PatientID)
+	if err != nil {
+		return nil, err
+	}
+
+	patient.MedicalHistory = strings.TrimSpace(req.MedicalHistory)
+	if err := h.repo.Update(ctx, patient); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to update medical history: %v", err)
+		return nil, fmt.Errorf("failed to update medical history: %w", err)
+	}
+
+	return h.loadProfile(ctx, patient)
+}
+
+func (h *PatientHandler) profilePatient(ctx context.Context, patientID string) (*entity.Patient, error) {
+	if patientID == "" {
+		h.log.WithContext(ctx).Errorf("Patient ID is required")
+		return nil, fmt.Errorf("patient_id is required")
+	}
+
+	patient, err := h.repo.Get(ctx, patientID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", patientID)
+		return nil, fmt.Errorf("patient not found")
+	}
+	return patient, nil
+}
+
+// profileTarget resolves the patient and an empty entity for the section.
+func (h *PatientHandler) profileTarget(ctx context.Context, patientID, section string) (*entity.Patient, entity.PatientProfileItem, error) {
+	item, err := newProfileEntity(section)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Unknown profile section: %s", section)
+		return nil, nil, err
+	}
+	patient, err := h.profilePatient(ctx, patientID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return patient, item, nil
+}
+
+// saveProfileItem stores item and, if it is marked primary, demotes the
+// patient's other items of the same kind in the same transaction.
+func (h *PatientHandler) saveProfileItem(ctx context.Context, item entity.PatientProfileItem, save func(context.Context, entity.PatientProfileItem) error) error {
+	return h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := save(ctx, item); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to save %s row: %v", item.TableName(), err)
+			return fmt.Errorf("failed to save profile item: %w", err)
+		}
+		if !isPrimaryItem(item) {
+			return nil
+		}
+		if err := h.profileRepo.ClearPrimary(ctx, item); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to clear primary %s row: %v", item.TableName(), err)
+			return fmt.Errorf("failed to update primary profile item: %w", err)
+		}
+		return nil
+	})
+}
+
+func (h *PatientHandler) loadProfile(ctx context.Context, patient *entity.Patient) (*PatientProfileResponse, error) {
+	var (
+		allergies   []*entity.PatientAllergy
+		conditions  []*entity.PatientCondition
+		medications []*entity.PatientMedication
+		contacts    []*entity.PatientEmergencyContact
+		insurance   []*entity.PatientInsurance
+	)
+	for _, rows := range []interface{}{&allergies, &conditions, &medications, &contacts, &insurance} {
+		if err := h.profileRepo.List(ctx, patient.ID, rows); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to load patient profile: %v", err)
+			return nil, fmt.Errorf("failed to load patient profile: %w", err)
+		}
+	}
+
+	response := &PatientProfileResponse{
+		Patient:           h.entityToProto(patient),
+		MedicalHistory:    patient.MedicalHistory,
+		Allergies:         []*AllergyItem{},
+		Conditions:        []*ConditionItem{},
+		Medications:       []*MedicationItem{},
+		EmergencyContacts: []*EmergencyContactItem{},
+		Insurance:         []*InsuranceItem{},
+	}
+	for _, a := range allergies {
+		response.Allergies = append(response.Allergies, profileItemResponse(a).(*AllergyItem))
+	}
+	for _, c := range conditions {
+		response.Conditions = append(response.Conditions, profileItemResponse(c).(*ConditionItem))
+	}
+	for _, m := range medications {
+		response.Medications = append(response.Medications, profileItemResponse(m).(*MedicationItem))
+	}
+	for _, c := range contacts {
+		response.EmergencyContacts = append(response.EmergencyContacts, profileItemResponse(c).(*EmergencyContactItem))
+	}
+	for _, i := range insurance {
+		response.Insurance = append(response.Insurance, profileItemResponse(i).(*InsuranceItem))
+	}
+	return response, nil
+}
+
+func isPrimaryItem(item entity.PatientProfileItem) bool {
+	switch e := item.(type) {
+	case *entity.PatientEmergencyContact:
+		return e.IsPrimary
+	case *entity.PatientInsurance:
+		return e.IsPrimary
+	default:
+		return false
+	}
+}
+
+func profileItemResponse(item entity.PatientProfileItem) interface{} {
+	switch e := item.(type) {
+	case *entity.PatientAllergy:
+		return &AllergyItem{ID: e.ID, Allergen: e.Allergen, Reaction: e.Reaction, Severity: e.Severity, Notes: e.Notes}
+	case *entity.PatientCondition:
+		return &ConditionItem{ID: e.ID, Name: e.Name, Code: e.Code, Status: e.Status, DiagnosedOn: e.DiagnosedOn, Notes: e.Notes}
+	case *entity.PatientMedication:
+		return &MedicationItem{ID: e.ID, Name: e.Name, Dosage: e.Dosage, Frequency: e.Frequency, StartedOn: e.StartedOn, EndedOn: e.EndedOn, Notes: e.Notes}
+	case *entity.PatientEmergencyContact:
+		return &EmergencyContactItem{ID: e.ID, Name: e.Name, Relationship: e.Relationship, PhoneNumber: e.PhoneNumber, Email: e.Email, IsPrimary: e.IsPrimary}
+	case *entity.PatientInsurance:
+		return &InsuranceItem{ID: e.ID, Provider: e.Provider, PolicyNumber: e.PolicyNumber, GroupNumber: e.GroupNumber, HolderName: e.HolderName, ValidFrom: e.ValidFrom, ValidUntil: e.ValidUntil, IsPrimary: e.IsPrimary}
+	default:
+		return nil
+	}
+}
+
+var allergySeverities = []string{
+	entity.AllergySeverityMild,
+	entity.AllergySeverityModerate,
+	entity.AllergySeveritySevere,
+	entity.AllergySeverityLifeThreatening,
+}
+
+var conditionStatuses = []string{
+	entity.ConditionStatusActive,
+	entity.ConditionStatusInRemission,
+	entity.ConditionStatusResolved,
+}
+
+func (i *AllergyItem) validate() error {
+	i.Allergen = strings.TrimSpace(i.Allergen)
+	if i.Allergen == "" {
+		return fmt.Errorf("allergen is required")
+	}
+	i.Severity = strings.ToLower(strings.TrimSpace(i.Severity))
+	if !oneOf(i.Severity, allergySeverities) {
+		return fmt.Errorf("severity must be one of %s", strings.Join(allergySeverities, ", "))
+	}
+	return nil
+}
+
+func (i *AllergyItem) applyTo(item entity.PatientProfileItem) {
+	e := item.(*entity.PatientAllergy)
+	e.Allergen, e.Reaction, e.Severity, e.Notes = i.Allergen, i.Reaction, i.Severity, i.Notes
+}
+
+func (i *ConditionItem) validate() error {
+	i.Name = strings.TrimSpace(i.Name)
+	if i.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	i.Status = strings.ToLower(strings.TrimSpace(i.Status))
+	if i.Status == "" {
+		i.Status = entity.ConditionStatusActive
+	}
+	if !oneOf(i.Status, conditionStatuses) {
+		return fmt.Errorf("status must be one of %s", strings.Join(conditionStatuses, ", "))
+	}
+	return validateOptionalDate("diagnosed_on", i.DiagnosedOn)
+}
+
+func (i *ConditionItem) applyTo(item entity.PatientProfileItem) {
+	e := item.(*entity.PatientCondition)
+	e.Name, e.Code, e.Status, e.DiagnosedOn, e.Notes = i.Name, strings.ToUpper(strings.TrimSpace(i.Code)), i.Status, i.DiagnosedOn, i.Notes
+}
+
+func (i *MedicationItem) validate() error {
+	i.Name = strings.TrimSpace(i.Name)
+	if i.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return validateDateRange("started_on", i.StartedOn, "ended_on", i.EndedOn)
+}
+
+func (i *MedicationItem) applyTo(item entity.PatientProfileItem) {
+	e := item.(*entity.PatientMedication)
+	e.Name, e.Dosage, e.Frequency, e.StartedOn, e.EndedOn, e.Notes = i.Name, i.Dosage, i.Frequency, i.StartedOn, i.EndedOn, i.Notes
+}
+
+func (i *EmergencyContactItem) validate() error {
+	i.Name = strings.TrimSpace(i.Name)
+	if i.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(i.PhoneNumber) == "" && strings.TrimSpace(i.Email) == "" {
+		return fmt.Errorf("phone_number or email is required")
+	}
+	if len(i.PhoneNumber) > 20 {
+		return fmt.Errorf("phone_number is too long")
+	}
+	if i.Email != "" && !strings.Contains(i.Email, "@") {
+		return fmt.Errorf("invalid email %q", i.Email)
+	}
+	return nil
+}
+
+func (i *EmergencyContactItem) applyTo(item entity.PatientProfileItem) {
+	e := item.(*entity.PatientEmergencyContact)
+	e.Name, e.Relationship, e.PhoneNumber, e.Email, e.IsPrimary = i.Name, i.Relationship, strings.TrimSpace(i.PhoneNumber), strings.TrimSpace(i.Email), i.IsPrimary
+}
+
+func (i *InsuranceItem) validate() error {
+	i.Provider = strings.TrimSpace(i.Provider)
+	i.PolicyNumber = strings.TrimSpace(i.PolicyNumber)
+	if i.Provider == "" || i.PolicyNumber == "" {
+		return fmt.Errorf("provider and policy_number are required")
+	}
+	return validateDateRange("valid_from", i.ValidFrom, "valid_until", i.ValidUntil)
+}
+
+func (i *InsuranceItem) applyTo(item entity.PatientProfileItem) {
+	e := item.(*entity.PatientInsurance)
+	e.Provider, e.PolicyNumber, e.GroupNumber, e.HolderName = i.Provider, i.PolicyNumber, i.GroupNumber, i.HolderName
+	e.ValidFrom, e.ValidUntil, e.IsPrimary = i.ValidFrom, i.ValidUntil, i.IsPrimary
+}
+
+func oneOf(value string, allowed []string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+func validateOptionalDate(field, value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := time.Parse(dateLayout, value); err != nil {
+		return fmt.Errorf("invalid %s %q, expected YYYY-MM-DD", field, value)
+	}
+	return nil
+}
+
+func validateDateRange(fromField, from, toField, to string) error {
+	if err := validateOptionalDate(fromField, from); err != nil {
+		return err
+	}
+	if err := validateOptionalDate(toField, to); err != nil {
+		return err
+	}
+	if from != "" && to != "" && to < from {
+		return fmt.Errorf("%s must not be before %s", toField, fromField)
+	}
+	return nil
+}
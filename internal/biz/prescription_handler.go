@@ -3,13 +3,17 @@ package biz
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	requestpb "github.com/arm-1234/common-protos/medical/v1/request"
 	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
 	"github.com/arm-1234/medical-service/internal/data"
 	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/drugcheck"
+	"github.com/arm-1234/medical-service/internal/pkg/formulary"
 	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/arm-1234/medical-service/internal/pkg/rxpdf"
 	"github.com/go-kratos/kratos/v2/log"
 )
 
@@ -17,6 +21,13 @@ type PrescriptionHandler struct {
 	repo        data.PrescriptionRepo
 	patientRepo data.PatientRepo
 	doctorRepo  data.DoctorRepo
+	profileRepo data.PatientProfileRepo
+	tx          data.Transaction
+	drugs       *drugcheck.Dataset
+	formulary   *formulary.Formulary
+	renderer    *rxpdf.Renderer
+	signer      *RecordSigner
+	access      *AccessAuditor
 	log         *log.Helper
 }
 
@@ -24,12 +35,26 @@ func NewPrescriptionHandler(
 	repo data.PrescriptionRepo,
 	patientRepo data.PatientRepo,
 	doctorRepo data.DoctorRepo,
+	profileRepo data.PatientProfileRepo,
+	tx data.Transaction,
+	drugs *drugcheck.Dataset,
+	formulary *formulary.Formulary,
+	renderer *rxpdf.Renderer,
+	signer *RecordSigner,
+	access *AccessAuditor,
 	logger log.Logger,
 ) *PrescriptionHandler {
 	return &PrescriptionHandler{
 		repo:        repo,
 		patientRepo: patientRepo,
 		doctorRepo:  doctorRepo,
+		profileRepo: profileRepo,
+		tx:          tx,
+		drugs:       drugs,
+		formulary:   formulary,
+		renderer:    renderer,
+		signer:      signer,
+		access:      access,
 		log:         log.NewHelper(logger),
 	}
 }
@@ -38,75 +63,185 @@ func (h *PrescriptionHandler) CreatePrescription(ctx context.Context, req *reque
 	ctx, span := otel.Trace(ctx, "PrescriptionHandler.CreatePrescription")
 	defer span.End()
 
-	if req.PatientId == "" || req.DoctorId == "" {
+	var medications []*entity.Medication
+	for _, med := range req.Medications {
+		medications = append(medications, &entity.Medication{
+			MedicationName: med.MedicationName,
+			Dosage:         med.Dosage,
+			Frequency:      med.Frequency,
+			Duration:       med.Duration,
+			Route:          med.Route,
+			Instructions:   med.Instructions,
+			Quantity:       med.Quantity,
+		})
+	}
+
+	prescription, _, err := h.createPrescription(ctx, &CheckedPrescriptionRequest{
+		AppointmentID:          req.AppointmentId,
+		PatientID:              req.PatientId,
+		DoctorID:               req.DoctorId,
+		Medications:            medications,
+		Diagnosis:              req.Diagnosis,
+		AdditionalInstructions: req.AdditionalInstructions,
+		ValidityDays:           req.ValidityDays,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return h.entityToProto(prescription), nil
+}
+
+// createPrescription validates and safety-checks a prescription and stores it
+// together with the overrides the prescriber gave for its warnings.
+func (h *PrescriptionHandler) createPrescription(ctx context.Context, req *CheckedPrescriptionRequest) (*entity.Prescription, []*SafetyFinding, error) {
+	if req.PatientID == "" || req.DoctorID == "" {
 		h.log.WithContext(ctx).Errorf("Patient ID and doctor ID are required")
-		return nil, fmt.Errorf("patient_id and doctor_id are required")
+		return nil, nil, fmt.Errorf("patient_id and doctor_id are required")
 	}
 	if len(req.Medications) == 0 {
 		h.log.WithContext(ctx).Errorf("At least one medication is required")
-		return nil, fmt.Errorf("at least one medication is required")
+		return nil, nil, fmt.Errorf("at least one medication is required")
+	}
+	items, err := h.structureMedications(req.Medications)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid medication: %v", err)
+		return nil, nil, err
 	}
 
-	patient, err := h.patientRepo.Get(ctx, req.PatientId)
+	patient, err := h.patientRepo.Get(ctx, req.PatientID)
 	if err != nil {
 		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
-		return nil, fmt.Errorf("failed to get patient: %w", err)
+		return nil, nil, fmt.Errorf("failed to get patient: %w", err)
 	}
 	if patient == nil {
-		h.log.WithContext(ctx).Errorf("Patient not found: %s", req.PatientId)
-		return nil, fmt.Errorf("patient not found")
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", req.PatientID)
+		return nil, nil, fmt.Errorf("patient not found")
 	}
 
-	doctor, err := h.doctorRepo.Get(ctx, req.DoctorId)
+	doctor, err := h.doctorRepo.Get(ctx, req.DoctorID)
 	if err != nil {
 		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
-		return nil, fmt.Errorf("failed to get doctor: %w", err)
+		return nil, nil, fmt.Errorf("failed to get doctor: %w", err)
 	}
 	if doctor == nil {
-		h.log.WithContext(ctx).Errorf("Doctor not found: %s", req.DoctorId)
-		return nil, fmt.Errorf("doctor not found")
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", req.DoctorID)
+		return nil, nil, fmt.Errorf("doctor not found")
 	}
 
-	var medications []*entity.Medication
-	for _, med := range req.Medications {
-		medications = append(medications, &entity.Medication{
-			MedicationName: med.MedicationName,
-			Dosage:         med.Dosage,
-			Frequency:      med.Frequency,
-			Duration:       med.Duration,
-			Route:          med.Route,
-			Instructions:   med.Instructions,
-			Quantity:       med.Quantity,
-		})
+	replacing := req.renewedFrom
+	if req.amendedFrom != "" {
+		replacing = req.amendedFrom
+	}
+	findings, err := h.safetyFindings(ctx, patient.ID, req.Medications, replacing)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateOverrides(findings, req.Overrides); err != nil {
+		h.log.WithContext(ctx).Errorf("Invalid safety override: %v", err)
+		return nil, nil, err
+	}
+	applied, unresolved := applyOverrides(findings, req.Overrides)
+	if len(unresolved) > 0 {
+		h.log.WithContext(ctx).Errorf("Prescription for patient %s failed safety checks: %s", patient.ID, describeFindings(unresolved))
+		return nil, nil, fmt.Errorf("prescription failed safety checks: %s", describeFindings(unresolved))
+	}
+
+	if req.Refills < 0 || req.Refills > maxRefills {
+		h.log.WithContext(ctx).Errorf("Invalid refill allowance: %d", req.Refills)
+		return nil, nil, fmt.Errorf("refills must be between 0 and %d", maxRefills)
 	}
 
 	validityDays := req.ValidityDays
 	if validityDays <= 0 {
 		validityDays = 30
 	}
-	now := time.Now()
+	// Timestamps are kept to the second so that the signed content matches
+	// what the database stores.
+	now := time.Now().Truncate(time.Second)
 	validUntil := now.AddDate(0, 0, int(validityDays))
+	if !req.validUntil.IsZero() {
+		validUntil = req.validUntil
+	}
 
 	prescription := &entity.Prescription{
-		AppointmentID:          req.AppointmentId,
-		PatientID:              req.PatientId,
+		AppointmentID:          req.AppointmentID,
+		PatientID:              patient.ID,
 		PatientName:            patient.FirstName + " " + patient.LastName,
-		DoctorID:               req.DoctorId,
+		DoctorID:               req.DoctorID,
 		DoctorName:             doctor.FirstName + " " + doctor.LastName,
-		Medications:            entity.MarshalMedications(medications),
+		Medications:            entity.MarshalMedications(req.Medications),
 		Diagnosis:              req.Diagnosis,
 		AdditionalInstructions: req.AdditionalInstructions,
 		PrescriptionDate:       now,
 		ValidUntil:             validUntil,
 		IsActive:               true,
+		Status:                 entity.PrescriptionStatusActive,
+		RefillsAllowed:         req.Refills,
+		RenewedFrom:            req.renewedFrom,
+		AmendedFrom:            req.amendedFrom,
+		AmendmentReason:        req.amendmentReason,
 	}
 
-	if err := h.repo.Create(ctx, prescription); err != nil {
-		h.log.WithContext(ctx).Errorf("Failed to create prescription: %v", err)
-		return nil, fmt.Errorf("failed to create prescription: %w", err)
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		switch {
+		case req.renewedFrom != "":
+			if err := h.supersede(ctx, req.renewedFrom, entity.PrescriptionStatusRenewed, renewable); err != nil {
+				return err
+			}
+		case req.amendedFrom != "":
+			if err := h.supersede(ctx, req.amendedFrom, entity.PrescriptionStatusAmended, amendable); err != nil {
+				return err
+			}
+		}
+		if err := h.repo.Create(ctx, prescription); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to create prescription: %v", err)
+			return fmt.Errorf("failed to create prescription: %w", err)
+		}
+		if err := h.signer.sign(&prescription.Signature, doctor.ID, now, func() []byte {
+			return prescriptionContent(prescription, items, prescription.PatientID)
+		}); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to sign prescription: %v", err)
+			return err
+		}
+		if err := h.repo.Update(ctx, prescription); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to store prescription signature: %v", err)
+			return fmt.Errorf("failed to store prescription signature: %w", err)
+		}
+		for _, item := range items {
+			item.PrescriptionID = prescription.ID
+		}
+		if err := h.repo.CreateItems(ctx, items); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to create prescription items: %v", err)
+			return fmt.Errorf("failed to create prescription items: %w", err)
+		}
+
+		var overrides []*entity.PrescriptionSafetyOverride
+		for _, f := range findings {
+			if o, ok := applied[f.Code]; ok {
+				delete(applied, f.Code)
+				overrides = append(overrides, &entity.PrescriptionSafetyOverride{
+					PrescriptionID: prescription.ID,
+					PrescriberID:   doctor.ID,
+					Code:           f.Code,
+					Kind:           f.Kind,
+					Severity:       f.Severity,
+					Description:    f.Description,
+					Justification:  strings.TrimSpace(o.Justification),
+				})
+			}
+		}
+		if err := h.repo.CreateOverrides(ctx, overrides); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to record safety overrides: %v", err)
+			return fmt.Errorf("failed to record safety overrides: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return h.entityToProto(prescription), nil
+	return prescription, findings, nil
 }
 
 func (h *PrescriptionHandler) GetPrescription(ctx context.Context, id string) (*responsepb.PrescriptionResponse, error) {
@@ -128,10 +263,7 @@ func (h *PrescriptionHandler) GetPrescription(ctx context.Context, id string) (*
 		return nil, fmt.Errorf("prescription not found")
 	}
 
-	if prescription.ValidUntil.Before(time.Now()) {
-		prescription.IsActive = false
-	}
-
+	h.access.Record(ctx, prescription.PatientID, accessPrescription, prescription.ID)
 	return h.entityToProto(prescription), nil
 }
 
@@ -157,12 +289,10 @@ func (h *PrescriptionHandler) GetPatientPrescriptions(ctx context.Context, req *
 		h.log.WithContext(ctx).Errorf("Failed to get patient prescriptions: %v", err)
 		return nil, fmt.Errorf("failed to get patient prescriptions: %w", err)
 	}
+	h.access.Record(ctx, req.PatientId, accessPrescriptions, "")
 
 	var protoPrescriptions []*responsepb.PrescriptionResponse
 	for _, p := range prescriptions {
-		if p.ValidUntil.Before(time.Now()) {
-			p.IsActive = false
-		}
 		protoPrescriptions = append(protoPrescriptions, h.entityToProto(p))
 	}
 
@@ -196,9 +326,6 @@ func (h *PrescriptionHandler) GetDoctorPrescriptions(ctx context.Context, req *r
 
 	var protoPrescriptions []*responsepb.PrescriptionResponse
 	for _, p := range prescriptions {
-		if p.ValidUntil.Before(time.Now()) {
-			p.IsActive = false
-		}
 		protoPrescriptions = append(protoPrescriptions, h.entityToProto(p))
 	}
 
@@ -234,7 +361,7 @@ func (h *PrescriptionHandler) entityToProto(prescription *entity.Prescription) *
 		AdditionalInstructions: prescription.AdditionalInstructions,
 		PrescriptionDate:       prescription.PrescriptionDate.Format("2006-01-02"),
 		ValidUntil:             prescription.ValidUntil.Format("2006-01-02"),
-		IsActive:               prescription.IsActive,
-		CreatedAt:              prescription.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		IsActive:               prescriptionStatus(prescription, time.Now()) == entity.PrescriptionStatusActive,
+		CreatedAt:              formatTimestamp(prescription.CreatedAt),
 	}
 }
@@ -0,0 +1,268 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/formulary"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+)
+
+type PrescriptionItemResponse struct {
+	Position       int32   `json:"position"`
+	DrugCode       string  `json:"drug_code,omitempty"`
+	CodeSystem     string  `json:"code_system,omitempty"`
+	DrugName       string  `json:"drug_name,omitempty"`
+	MedicationName string  `json:"medication_name"`
+	DoseAmount     float64 `json:"dose_amount,omitempty"`
+	DoseUnit       string  `json:"dose_unit,omitempty"`
+	FrequencyCode  string  `json:"frequency_code,omitempty"`
+	DurationDays   int32   `json:"duration_days,omitempty"`
+	Route          string  `json:"route,omitempty"`
+	Quantity       int32   `json:"quantity"`
+	Instructions   string  `json:"instructions,omitempty"`
+	DosageText     string  `json:"dosage_text,omitempty"`
+	FrequencyText  string  `json:"frequency_text,omitempty"`
+	DurationText   string  `json:"duration_text,omitempty"`
+}
+
+type PrescriptionItemsResponse struct {
+	PrescriptionID string                      `json:"prescription_id"`
+	Items          []*PrescriptionItemResponse `json:"items"`
+}
+
+type FormularySearchRequest struct {
+	Query string `json:"q"`
+	Limit int    `json:"limit"`
+}
+
+type FormularyDrug struct {
+	Code        string   `json:"code"`
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases"`
+	Routes      []string `json:"routes"`
+	DoseUnits   []string `json:"dose_units"`
+	MaxQuantity int32    `json:"max_quantity"`
+}
+
+type FormularySearchResponse struct {
+	CodeSystem string           `json:"code_system"`
+	Drugs      []*FormularyDrug `json:"drugs"`
+}
+
+// structureMedications validates the medications on a new prescription and
+// turns them into prescription items. Structured fields given by the caller
+// win over the free text; otherwise the free text is parsed. The medications
+// are updated in place with the normalized values so that the JSON copy on
+// the prescription agrees with the items.
+func (h *PrescriptionHandler) structureMedications(medications []*entity.Medication) ([]*entity.PrescriptionItem, error) {
+	var items []*entity.PrescriptionItem
+	for i, med := range medications {
+		item, err := h.structureMedication(int32(i), med)
+		if err != nil {
+			name := strings.TrimSpace(med.MedicationName)
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return nil, fmt.Errorf("medication %s: %w", name, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (h *PrescriptionHandler) structureMedication(position int32, med *entity.Medication) (*entity.PrescriptionItem, error) {
+	med.MedicationName = strings.TrimSpace(med.MedicationName)
+	if med.MedicationName == "" {
+		return nil, fmt.Errorf("medication_name is required")
+	}
+
+	var drug *formulary.Drug
+	if med.DrugCode != "" {
+		drug = h.formulary.Get(med.DrugCode)
+		if drug == nil {
+			return nil, fmt.Errorf("unknown drug code %q", med.DrugCode)
+		}
+	} else {
+		drug = h.formulary.Lookup(med.MedicationName)
+	}
+
+	if med.DoseAmount > 0 || med.DoseUnit != "" {
+		unit, ok := formulary.NormalizeUnit(med.DoseUnit)
+		if !ok {
+			return nil, fmt.Errorf("unknown dose unit %q", med.DoseUnit)
+		}
+		if med.DoseAmount <= 0 {
+			return nil, fmt.Errorf("dose_amount must be positive")
+		}
+		med.DoseUnit = unit
+		if med.Dosage == "" {
+			med.Dosage = fmt.Sprintf("%g %s", med.DoseAmount, unit)
+		}
+	} else {
+		amount, unit, err := formulary.ParseDose(med.Dosage)
+		if err != nil {
+			return nil, err
+		}
+		med.DoseAmount, med.DoseUnit = amount, unit
+	}
+
+	if med.FrequencyCode != "" {
+		code := strings.ToUpper(strings.TrimSpace(med.FrequencyCode))
+		if !formulary.ValidFrequency(code) {
+			return nil, fmt.Errorf("unknown frequency code %q", med.FrequencyCode)
+		}
+		med.FrequencyCode = code
+		if med.Frequency == "" {
+			med.Frequency = code
+		}
+	} else {
+		code, err := formulary.ParseFrequency(med.Frequency)
+		if err != nil {
+			return nil, err
+		}
+		med.FrequencyCode = code
+	}
+
+	if med.DurationDays < 0 {
+		return nil, fmt.Errorf("duration_days cannot be negative")
+	}
+	if med.DurationDays == 0 {
+		days, err := formulary.ParseDuration(med.Duration)
+		if err != nil {
+			return nil, err
+		}
+		med.DurationDays = days
+	} else if med.Duration == "" {
+		med.Duration = fmt.Sprintf("%d days", med.DurationDays)
+	}
+
+	route, ok := formulary.NormalizeRoute(med.Route)
+	switch {
+	case med.Route == "" && drug != nil && len(drug.Routes) == 1:
+		route = drug.Routes[0]
+	case med.Route == "":
+		return nil, fmt.Errorf("route is required")
+	case !ok:
+		return nil, fmt.Errorf("unknown route %q; use one of %s", med.Route, strings.Join(formulary.Routes, ", "))
+	}
+	med.Route = route
+
+	limit := int32(formulary.DefaultMaxQuantity)
+	if drug != nil {
+		limit = drug.QuantityLimit()
+	}
+	if med.Quantity <= 0 {
+		return nil, fmt.Errorf("quantity must be positive")
+	}
+	if med.Quantity > limit {
+		return nil, fmt.Errorf("quantity %d exceeds the limit of %d", med.Quantity, limit)
+	}
+
+	item := &entity.PrescriptionItem{
+		Position:       position,
+		MedicationName: med.MedicationName,
+		DoseAmount:     med.DoseAmount,
+		DoseUnit:       med.DoseUnit,
+		FrequencyCode:  med.FrequencyCode,
+		DurationDays:   med.DurationDays,
+		Route:          med.Route,
+		Quantity:       med.Quantity,
+		Instructions:   med.Instructions,
+		DosageText:     med.Dosage,
+		FrequencyText:  med.Frequency,
+		DurationText:   med.Duration,
+	}
+	if drug != nil {
+		if !drug.AllowsRoute(route) {
+			return nil, fmt.Errorf("%s cannot be given by the %s route", drug.Name, route)
+		}
+		if !drug.AllowsUnit(med.DoseUnit) {
+			return nil, fmt.Errorf("%s doses cannot be written in %s; use %s", drug.Name, med.DoseUnit, strings.Join(drug.DoseUnits, ", "))
+		}
+		med.DrugCode = drug.Code
+		item.DrugCode, item.DrugName = drug.Code, drug.Name
+	}
+	return item, nil
+}
+
+func (h *PrescriptionHandler) GetPrescriptionItems(ctx context.Context, prescriptionID string) (*PrescriptionItemsResponse, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.GetPrescriptionItems")
+	defer span.End()
+
+	if prescriptionID == "" {
+		h.log.WithContext(ctx).Errorf("Prescription ID is required")
+		return nil, fmt.Errorf("prescription_id is required")
+	}
+
+	items, err := h.repo.GetItems(ctx, []string{prescriptionID})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription items: %v", err)
+		return nil, fmt.Errorf("failed to get prescription items: %w", err)
+	}
+	if len(items) == 0 {
+		prescription, err := h.repo.Get(ctx, prescriptionID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get prescription: %v", err)
+			return nil, fmt.Errorf("failed to get prescription: %w", err)
+		}
+		if prescription == nil {
+			h.log.WithContext(ctx).Errorf("Prescription not found: %s", prescriptionID)
+			return nil, fmt.Errorf("prescription not found")
+		}
+	}
+
+	response := &PrescriptionItemsResponse{PrescriptionID: prescriptionID, Items: []*PrescriptionItemResponse{}}
+	for _, item := range items {
+		response.Items = append(response.Items, h.itemToResponse(item))
+	}
+	return response, nil
+}
+
+func (h *PrescriptionHandler) SearchFormulary(ctx context.Context, req *FormularySearchRequest) (*FormularySearchResponse, error) {
+	_, span := otel.Trace(ctx, "PrescriptionHandler.SearchFormulary")
+	defer span.End()
+
+	limit := req.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	response := &FormularySearchResponse{CodeSystem: h.formulary.CodeSystem(), Drugs: []*FormularyDrug{}}
+	for _, d := range h.formulary.Search(req.Query, limit) {
+		response.Drugs = append(response.Drugs, &FormularyDrug{
+			Code:        d.Code,
+			Name:        d.Name,
+			Aliases:     d.Aliases,
+			Routes:      d.Routes,
+			DoseUnits:   d.DoseUnits,
+			MaxQuantity: d.QuantityLimit(),
+		})
+	}
+	return response, nil
+}
+
+func (h *PrescriptionHandler) itemToResponse(item *entity.PrescriptionItem) *PrescriptionItemResponse {
+	response := &PrescriptionItemResponse{
+		Position:       item.Position,
+		DrugCode:       item.DrugCode,
+		DrugName:       item.DrugName,
+		MedicationName: item.MedicationName,
+		DoseAmount:     item.DoseAmount,
+		DoseUnit:       item.DoseUnit,
+		FrequencyCode:  item.FrequencyCode,
+		DurationDays:   item.DurationDays,
+		Route:          item.Route,
+		Quantity:       item.Quantity,
+		Instructions:   item.Instructions,
+		DosageText:     item.DosageText,
+		FrequencyText:  item.FrequencyText,
+		DurationText:   item.DurationText,
+	}
+	if item.DrugCode != "" {
+		response.CodeSystem = h.formulary.CodeSystem()
+	}
+	return response
+}
@@ -0,0 +1,622 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+)
+
+// maxRefills caps the refill allowance a prescription can be written with.
+const maxRefills = 12
+
+type PrescriptionSearchRequest struct {
+	PatientID string `json:"patient_id"`
+	DoctorID  string `json:"doctor_id"`
+	Status    string `json:"status"`
+	DrugCode  string `json:"drug_code"`
+	FromDate  string `json:"from_date"`
+	ToDate    string `json:"to_date"`
+}
+
+type RevokePrescriptionRequest struct {
+	PrescriptionID string `json:"prescription_id"`
+	RevokedBy      string `json:"revoked_by"`
+	Reason         string `json:"reason"`
+}
+
+type RenewPrescriptionRequest struct {
+	PrescriptionID string            `json:"prescription_id"`
+	DoctorID       string            `json:"doctor_id"`
+	ValidityDays   int32             `json:"validity_days"`
+	Refills        int32             `json:"refills"`
+	Overrides      []*SafetyOverride `json:"overrides"`
+}
+
+// AmendPrescriptionRequest corrects an active prescription. Fields left
+// empty keep the original's value.
+type AmendPrescriptionRequest struct {
+	PrescriptionID         string               `json:"prescription_id"`
+	DoctorID               string               `json:"doctor_id"`
+	Reason                 string               `json:"reason"`
+	Medications            []*entity.Medication `json:"medications"`
+	Diagnosis              string               `json:"diagnosis"`
+	AdditionalInstructions string               `json:"additional_instructions"`
+	Overrides              []*SafetyOverride    `json:"overrides"`
+}
+
+type RecordRefillRequest struct {
+	PrescriptionID string `json:"prescription_id"`
+	DispensedBy    string `json:"dispensed_by"`
+	DispensedAt    string `json:"dispensed_at"`
+	Notes          string `json:"notes"`
+}
+
+// PrescriptionDetail is a prescription with its lifecycle state.
+type PrescriptionDetail struct {
+	Prescription     *responsepb.PrescriptionResponse `json:"prescription"`
+	Status           string                           `json:"status"`
+	RefillsAllowed   int32                            `json:"refills_allowed"`
+	RefillsUsed      int32                            `json:"refills_used"`
+	RenewedFrom      string                           `json:"renewed_from,omitempty"`
+	RevokedAt        string                           `json:"revoked_at,omitempty"`
+	RevokedBy        string                           `json:"revoked_by,omitempty"`
+	RevocationReason string                           `json:"revocation_reason,omitempty"`
+	AmendedFrom      string                           `json:"amended_from,omitempty"`
+	AmendmentReason  string                           `json:"amendment_reason,omitempty"`
+	SignedBy         string                           `json:"signed_by,omitempty"`
+	SignedAt         string                           `json:"signed_at,omitempty"`
+}
+
+type PrescriptionListResponse struct {
+	Prescriptions []*PrescriptionDetail `json:"prescriptions"`
+}
+
+type RenewPrescriptionResponse struct {
+	Prescription *PrescriptionDetail `json:"prescription"`
+	Findings     []*SafetyFinding    `json:"findings"`
+}
+
+type AmendPrescriptionResponse struct {
+	Prescription *PrescriptionDetail `json:"prescription"`
+	Findings     []*SafetyFinding    `json:"findings"`
+}
+
+type PrescriptionRefillResponse struct {
+	RefillID       string `json:"refill_id"`
+	PrescriptionID string `json:"prescription_id"`
+	Sequence       int32  `json:"sequence"`
+	DispensedBy    string `json:"dispensed_by"`
+	DispensedAt    string `json:"dispensed_at"`
+	Notes          string `json:"notes"`
+}
+
+type PrescriptionRefillsResponse struct {
+	PrescriptionID   string                        `json:"prescription_id"`
+	RefillsAllowed   int32                         `json:"refills_allowed"`
+	RefillsRemaining int32                         `json:"refills_remaining"`
+	Refills          []*PrescriptionRefillResponse `json:"refills"`
+}
+
+// prescriptionStatus is the status a prescription has at now. One still
+// marked active past its validity is expired even before the expiry job has
+// updated the row.
+func prescriptionStatus(p *entity.Prescription, now time.Time) string {
+	if p.Status == "" || p.Status == entity.PrescriptionStatusActive {
+		if p.ValidUntil.Before(now) {
+			return entity.PrescriptionStatusExpired
+		}
+		return entity.PrescriptionStatusActive
+	}
+	return p.Status
+}
+
+func validPrescriptionStatus(status string) bool {
+	switch status {
+	case entity.PrescriptionStatusActive, entity.PrescriptionStatusExpired,
+		entity.PrescriptionStatusRevoked, entity.PrescriptionStatusRenewed,
+		entity.PrescriptionStatusAmended:
+		return true
+	}
+	return false
+}
+
+// SearchPrescriptions lists a patient's or doctor's prescriptions, optionally
+// narrowed to one status or to those containing a formulary drug.
+func (h *PrescriptionHandler) SearchPrescriptions(ctx context.Context, req *PrescriptionSearchRequest) (*PrescriptionListResponse, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.SearchPrescriptions")
+	defer span.End()
+
+	if req.PatientID == "" && req.DoctorID == "" {
+		h.log.WithContext(ctx).Errorf("Patient ID or doctor ID is required")
+		return nil, fmt.Errorf("patient_id or doctor_id is required")
+	}
+	if req.Status != "" && !validPrescriptionStatus(req.Status) {
+		h.log.WithContext(ctx).Errorf("Invalid prescription status: %s", req.Status)
+		return nil, fmt.Errorf("invalid status %q", req.Status)
+	}
+
+	filters := map[string]interface{}{
+		"status":    req.Status,
+		"drug_code": req.DrugCode,
+		"from_date": req.FromDate,
+		"to_date":   req.ToDate,
+	}
+
+	var prescriptions []*entity.Prescription
+	var err error
+	if req.PatientID != "" {
+		prescriptions, err = h.repo.GetByPatientID(ctx, req.PatientID, filters)
+	} else {
+		prescriptions, err = h.repo.GetByDoctorID(ctx, req.DoctorID, filters)
+	}
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to search prescriptions: %v", err)
+		return nil, fmt.Errorf("failed to search prescriptions: %w", err)
+	}
+
+	response := &PrescriptionListResponse{Prescriptions: []*PrescriptionDetail{}}
+	for _, p := range prescriptions {
+		if req.PatientID != "" && req.DoctorID != "" && p.DoctorID != req.DoctorID {
+			continue
+		}
+		response.Prescriptions = append(response.Prescriptions, h.toDetail(p))
+	}
+	return response, nil
+}
+
+// RevokePrescription withdraws an active prescription so it can no longer
+// be dispensed or refilled.
+func (h *PrescriptionHandler) RevokePrescription(ctx context.Context, req *RevokePrescriptionRequest) (*PrescriptionDetail, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.RevokePrescription")
+	defer span.End()
+
+	if req.PrescriptionID == "" {
+		h.log.WithContext(ctx).Errorf("Prescription ID is required")
+		return nil, fmt.Errorf("prescription_id is required")
+	}
+	if req.RevokedBy == "" {
+		h.log.WithContext(ctx).Errorf("Revoking doctor is required")
+		return nil, fmt.Errorf("revoked_by is required")
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		h.log.WithContext(ctx).Errorf("Revocation reason is required")
+		return nil, fmt.Errorf("reason is required")
+	}
+
+	doctor, err := h.doctorRepo.Get(ctx, req.RevokedBy)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", req.RevokedBy)
+		return nil, fmt.Errorf("doctor not found")
+	}
+
+	var prescription *entity.Prescription
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		prescription, err = h.lockPrescription(ctx, req.PrescriptionID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if status := prescriptionStatus(prescription, now); status != entity.PrescriptionStatusActive {
+			h.log.WithContext(ctx).Errorf("Cannot revoke %s prescription: %s", status, prescription.ID)
+			return fmt.Errorf("cannot revoke a prescription that is %s", status)
+		}
+
+		prescription.Status = entity.PrescriptionStatusRevoked
+		prescription.IsActive = false
+		prescription.RevokedAt = &now
+		prescription.RevokedBy = doctor.ID
+		prescription.RevocationReason = reason
+		if err := h.repo.Update(ctx, prescription); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to revoke prescription: %v", err)
+			return fmt.Errorf("failed to revoke prescription: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return h.toDetail(prescription), nil
+}
+
+// RenewPrescription issues a new prescription for the same medications with
+// a fresh validity and refill allowance. The renewal goes through the same
+// safety checks as a new prescription, and an original that is still active
+// is marked renewed so only one of the two can be dispensed.
+func (h *PrescriptionHandler) RenewPrescription(ctx context.Context, req *RenewPrescriptionRequest) (*RenewPrescriptionResponse, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.RenewPrescription")
+	defer span.End()
+
+	if req.PrescriptionID == "" {
+		h.log.WithContext(ctx).Errorf("Prescription ID is required")
+		return nil, fmt.Errorf("prescription_id is required")
+	}
+
+	original, err := h.repo.Get(ctx, req.PrescriptionID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription: %v", err)
+		return nil, fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if original == nil {
+		h.log.WithContext(ctx).Errorf("Prescription not found: %s", req.PrescriptionID)
+		return nil, fmt.Errorf("prescription not found")
+	}
+	if err := renewable(original); err != nil {
+		h.log.WithContext(ctx).Errorf("Cannot renew prescription %s: %v", original.ID, err)
+		return nil, err
+	}
+
+	doctorID := req.DoctorID
+	if doctorID == "" {
+		doctorID = original.DoctorID
+	}
+
+	prescription, findings, err := h.createPrescription(ctx, &CheckedPrescriptionRequest{
+		AppointmentID:          original.AppointmentID,
+		PatientID:              original.PatientID,
+		DoctorID:               doctorID,
+		Medications:            entity.UnmarshalMedications(original.Medications),
+		Diagnosis:              original.Diagnosis,
+		AdditionalInstructions: original.AdditionalInstructions,
+		ValidityDays:           req.ValidityDays,
+		Refills:                req.Refills,
+		Overrides:              req.Overrides,
+		renewedFrom:            original.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RenewPrescriptionResponse{
+		Prescription: h.toDetail(prescription),
+		Findings:     findings,
+	}, nil
+}
+
+// AmendPrescription corrects an active prescription. The original is never
+// edited: the correction is issued and signed as a new prescription that
+// keeps the original's validity and remaining refills, and the original is
+// marked amended.
+func (h *PrescriptionHandler) AmendPrescription(ctx context.Context, req *AmendPrescriptionRequest) (*AmendPrescriptionResponse, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.AmendPrescription")
+	defer span.End()
+
+	if req.PrescriptionID == "" {
+		h.log.WithContext(ctx).Errorf("Prescription ID is required")
+		return nil, fmt.Errorf("prescription_id is required")
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		h.log.WithContext(ctx).Errorf("Amendment reason is required")
+		return nil, fmt.Errorf("reason is required")
+	}
+
+	original, err := h.repo.Get(ctx, req.PrescriptionID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription: %v", err)
+		return nil, fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if original == nil {
+		h.log.WithContext(ctx).Errorf("Prescription not found: %s", req.PrescriptionID)
+		return nil, fmt.Errorf("prescription not found")
+	}
+	if err := amendable(original); err != nil {
+		h.log.WithContext(ctx).Errorf("Cannot amend prescription %s: %v", original.ID, err)
+		return nil, err
+	}
+
+	amendment := &CheckedPrescriptionRequest{
+		AppointmentID:          original.AppointmentID,
+		PatientID:              original.PatientID,
+		DoctorID:               req.DoctorID,
+		Medications:            req.Medications,
+		Diagnosis:              req.Diagnosis,
+		AdditionalInstructions: req.AdditionalInstructions,
+		Refills:                original.RefillsAllowed - original.RefillsUsed,
+		Overrides:              req.Overrides,
+		amendedFrom:            original.ID,
+		amendmentReason:        reason,
+		validUntil:             original.ValidUntil,
+	}
+	if amendment.DoctorID == "" {
+		amendment.DoctorID = original.DoctorID
+	}
+	if len(amendment.Medications) == 0 {
+		amendment.Medications = entity.UnmarshalMedications(original.Medications)
+	}
+	if amendment.Diagnosis == "" {
+		amendment.Diagnosis = original.Diagnosis
+	}
+	if amendment.AdditionalInstructions == "" {
+		amendment.AdditionalInstructions = original.AdditionalInstructions
+	}
+
+	prescription, findings, err := h.createPrescription(ctx, amendment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AmendPrescriptionResponse{
+		Prescription: h.toDetail(prescription),
+		Findings:     findings,
+	}, nil
+}
+
+// VerifyPrescriptionSignature checks that a prescription is unchanged since
+// its prescriber signed it.
+func (h *PrescriptionHandler) VerifyPrescriptionSignature(ctx context.Context, id string) (*SignatureVerification, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.VerifyPrescriptionSignature")
+	defer span.End()
+
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("Prescription ID is required")
+		return nil, fmt.Errorf("prescription_id is required")
+	}
+
+	prescription, err := h.repo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription: %v", err)
+		return nil, fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if prescription == nil {
+		h.log.WithContext(ctx).Errorf("Prescription not found: %s", id)
+		return nil, fmt.Errorf("prescription not found")
+	}
+
+	items, err := h.repo.GetItems(ctx, []string{prescription.ID})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription items: %v", err)
+		return nil, fmt.Errorf("failed to get prescription items: %w", err)
+	}
+
+	verification, err := h.signer.verify(ctx, "prescriptions", "prescription", prescription.ID, prescription.PatientID, prescription.Signature, func(patientID string) []byte {
+		return prescriptionContent(prescription, items, patientID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if verification.Signed && !verification.Valid {
+		h.log.WithContext(ctx).Warnf("Prescription %s failed signature verification: %s", prescription.ID, verification.Problem)
+	}
+	return verification, nil
+}
+
+// supersede marks the prescription being renewed or amended with status. It
+// runs inside the new prescription's transaction and re-checks the original
+// under lock, so two concurrent renewals or amendments cannot both succeed.
+func (h *PrescriptionHandler) supersede(ctx context.Context, id, status string, check func(*entity.Prescription) error) error {
+	original, err := h.lockPrescription(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := check(original); err != nil {
+		h.log.WithContext(ctx).Errorf("Cannot supersede prescription %s: %v", original.ID, err)
+		return err
+	}
+	if original.Status != entity.PrescriptionStatusActive {
+		return nil
+	}
+
+	original.Status = status
+	original.IsActive = false
+	if err := h.repo.Update(ctx, original); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to mark prescription %s: %v", status, err)
+		return fmt.Errorf("failed to mark prescription %s: %w", status, err)
+	}
+	return nil
+}
+
+func renewable(p *entity.Prescription) error {
+	switch p.Status {
+	case entity.PrescriptionStatusRevoked:
+		return fmt.Errorf("a revoked prescription cannot be renewed")
+	case entity.PrescriptionStatusRenewed:
+		return fmt.Errorf("prescription has already been renewed")
+	case entity.PrescriptionStatusAmended:
+		return fmt.Errorf("prescription has been amended; renew the amendment instead")
+	}
+	return nil
+}
+
+// amendable allows amending only a prescription that can still be
+// dispensed; anything else should be written as a new prescription.
+func amendable(p *entity.Prescription) error {
+	if status := prescriptionStatus(p, time.Now()); status != entity.PrescriptionStatusActive {
+		return fmt.Errorf("only an active prescription can be amended, this one is %s", status)
+	}
+	return nil
+}
+
+// RecordRefill records a dispensed refill against the prescription's refill
+// allowance.
+func (h *PrescriptionHandler) RecordRefill(ctx context.Context, req *RecordRefillRequest) (*PrescriptionRefillResponse, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.RecordRefill")
+	defer span.End()
+
+	if req.PrescriptionID == "" {
+		h.log.WithContext(ctx).Errorf("Prescription ID is required")
+		return nil, fmt.Errorf("prescription_id is required")
+	}
+	dispensedBy := strings.TrimSpace(req.DispensedBy)
+	if dispensedBy == "" {
+		h.log.WithContext(ctx).Errorf("Dispenser is required")
+		return nil, fmt.Errorf("dispensed_by is required")
+	}
+
+	now := time.Now()
+	dispensedAt := now
+	if req.DispensedAt != "" {
+		t, err := time.Parse(time.RFC3339, req.DispensedAt)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid dispensed_at: %s", req.DispensedAt)
+			return nil, fmt.Errorf("dispensed_at must be an RFC 3339 timestamp")
+		}
+		if t.After(now) {
+			h.log.WithContext(ctx).Errorf("Dispensed_at is in the future: %s", req.DispensedAt)
+			return nil, fmt.Errorf("dispensed_at cannot be in the future")
+		}
+		dispensedAt = t
+	}
+
+	var refill *entity.PrescriptionRefill
+	err := h.tx.InTx(ctx, func(ctx context.Context) error {
+		prescription, err := h.lockPrescription(ctx, req.PrescriptionID)
+		if err != nil {
+			return err
+		}
+
+		// The status is checked now, like revocation and renewal, so a
+		// backdated dispensed_at cannot refill a revoked or lapsed prescription.
+		if status := prescriptionStatus(prescription, now); status != entity.PrescriptionStatusActive {
+			h.log.WithContext(ctx).Errorf("Cannot refill %s prescription: %s", status, prescription.ID)
+			return fmt.Errorf("cannot refill a prescription that is %s", status)
+		}
+		if dispensedAt.Before(prescription.PrescriptionDate) {
+			h.log.WithContext(ctx).Errorf("Refill for %s predates the prescription", prescription.ID)
+			return fmt.Errorf("dispensed_at is before the prescription date")
+		}
+		if prescription.RefillsUsed >= prescription.RefillsAllowed {
+			h.log.WithContext(ctx).Errorf("No refills remaining on prescription %s (%d allowed)", prescription.ID, prescription.RefillsAllowed)
+			return fmt.Errorf("no refills remaining: %d of %d used", prescription.RefillsUsed, prescription.RefillsAllowed)
+		}
+
+		prescription.RefillsUsed++
+		refill = &entity.PrescriptionRefill{
+			PrescriptionID: prescription.ID,
+			Sequence:       prescription.RefillsUsed,
+			DispensedBy:    dispensedBy,
+			DispensedAt:    dispensedAt.UTC(),
+			Notes:          req.Notes,
+		}
+		if err := h.repo.CreateRefill(ctx, refill); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to record refill: %v", err)
+			return fmt.Errorf("failed to record refill: %w", err)
+		}
+		if err := h.repo.Update(ctx, prescription); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to update refill count: %v", err)
+			return fmt.Errorf("failed to update refill count: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refillToResponse(refill), nil
+}
+
+func (h *PrescriptionHandler) GetRefills(ctx context.Context, prescriptionID string) (*PrescriptionRefillsResponse, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.GetRefills")
+	defer span.End()
+
+	if prescriptionID == "" {
+		h.log.WithContext(ctx).Errorf("Prescription ID is required")
+		return nil, fmt.Errorf("prescription_id is required")
+	}
+
+	prescription, err := h.repo.Get(ctx, prescriptionID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription: %v", err)
+		return nil, fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if prescription == nil {
+		h.log.WithContext(ctx).Errorf("Prescription not found: %s", prescriptionID)
+		return nil, fmt.Errorf("prescription not found")
+	}
+
+	refills, err := h.repo.GetRefills(ctx, prescription.ID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get refills: %v", err)
+		return nil, fmt.Errorf("failed to get refills: %w", err)
+	}
+
+	response := &PrescriptionRefillsResponse{
+		PrescriptionID:   prescription.ID,
+		RefillsAllowed:   prescription.RefillsAllowed,
+		RefillsRemaining: prescription.RefillsAllowed - prescription.RefillsUsed,
+		Refills:          []*PrescriptionRefillResponse{},
+	}
+	for _, r := range refills {
+		response.Refills = append(response.Refills, refillToResponse(r))
+	}
+	return response, nil
+}
+
+// ExpirePrescriptions marks active prescriptions past their validity as
+// expired. It is run periodically by the job server.
+func (h *PrescriptionHandler) ExpirePrescriptions(ctx context.Context) error {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.ExpirePrescriptions")
+	defer span.End()
+
+	expired, err := h.repo.ExpireBefore(ctx, time.Now())
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to expire prescriptions: %v", err)
+		return fmt.Errorf("failed to expire prescriptions: %w", err)
+	}
+	if expired > 0 {
+		h.log.WithContext(ctx).Infof("Expired %d prescriptions", expired)
+	}
+	return nil
+}
+
+func (h *PrescriptionHandler) lockPrescription(ctx context.Context, id string) (*entity.Prescription, error) {
+	if err := h.repo.Lock(ctx, id); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to lock prescription: %v", err)
+		return nil, fmt.Errorf("failed to lock prescription: %w", err)
+	}
+	prescription, err := h.repo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription: %v", err)
+		return nil, fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if prescription == nil {
+		h.log.WithContext(ctx).Errorf("Prescription not found: %s", id)
+		return nil, fmt.Errorf("prescription not found")
+	}
+	return prescription, nil
+}
+
+func (h *PrescriptionHandler) toDetail(p *entity.Prescription) *PrescriptionDetail {
+	detail := &PrescriptionDetail{
+		Prescription:     h.entityToProto(p),
+		Status:           prescriptionStatus(p, time.Now()),
+		RefillsAllowed:   p.RefillsAllowed,
+		RefillsUsed:      p.RefillsUsed,
+		RenewedFrom:      p.RenewedFrom,
+		RevokedBy:        p.RevokedBy,
+		RevocationReason: p.RevocationReason,
+		AmendedFrom:      p.AmendedFrom,
+		AmendmentReason:  p.AmendmentReason,
+		SignedBy:         p.SignedBy,
+	}
+	if p.RevokedAt != nil {
+		detail.RevokedAt = formatTimestamp(*p.RevokedAt)
+	}
+	if p.SignedAt != nil {
+		detail.SignedAt = formatTimestamp(*p.SignedAt)
+	}
+	return detail
+}
+
+func refillToResponse(r *entity.PrescriptionRefill) *PrescriptionRefillResponse {
+	return &PrescriptionRefillResponse{
+		RefillID:       r.ID,
+		PrescriptionID: r.PrescriptionID,
+		Sequence:       r.Sequence,
+		DispensedBy:    r.DispensedBy,
+		DispensedAt:    formatTimestamp(r.DispensedAt),
+		Notes:          r.Notes,
+	}
+}
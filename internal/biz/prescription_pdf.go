@@ -0,0 +1,269 @@
+package biz
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/arm-1234/medical-service/internal/pkg/rxpdf"
+)
+
+// PrescriptionVerification is what anyone holding a printed prescription
+// can learn from its verification code: whether it is genuine and still
+// active, and enough to match it to the paper, but no clinical details.
+type PrescriptionVerification struct {
+	Valid            bool   `json:"valid"`
+	Status           string `json:"status"`
+	IssuedOn         string `json:"issued_on,omitempty"`
+	ValidUntil       string `json:"valid_until,omitempty"`
+	Prescriber       string `json:"prescriber,omitempty"`
+	LicenseNumber    string `json:"license_number,omitempty"`
+	PatientInitials  string `json:"patient_initials,omitempty"`
+	ItemCount        int    `json:"item_count,omitempty"`
+	RefillsRemaining int32  `json:"refills_remaining"`
+	Fingerprint      string `json:"fingerprint,omitempty"`
+}
+
+// verificationStatusUnknown is reported for codes that match no
+// prescription.
+const verificationStatusUnknown = "unknown"
+
+// RenderPrescriptionPDF renders an active prescription for printing. The
+// first print assigns the prescription its verification code.
+func (h *PrescriptionHandler) RenderPrescriptionPDF(ctx context.Context, id string) ([]byte, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.RenderPrescriptionPDF")
+	defer span.End()
+
+	if id == "" {
+		h.log.WithContext(ctx).Errorf("Prescription ID is required")
+		return nil, fmt.Errorf("prescription_id is required")
+	}
+
+	prescription, err := h.repo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription: %v", err)
+		return nil, fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if prescription == nil {
+		h.log.WithContext(ctx).Errorf("Prescription not found: %s", id)
+		return nil, fmt.Errorf("prescription not found")
+	}
+	if status := prescriptionStatus(prescription, time.Now()); status != entity.PrescriptionStatusActive {
+		h.log.WithContext(ctx).Errorf("Cannot print %s prescription: %s", status, id)
+		return nil, fmt.Errorf("cannot print a prescription that is %s", status)
+	}
+
+	patient, err := h.patientRepo.Get(ctx, prescription.PatientID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", prescription.PatientID)
+		return nil, fmt.Errorf("patient not found")
+	}
+	doctor, err := h.doctorRepo.Get(ctx, prescription.DoctorID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", prescription.DoctorID)
+		return nil, fmt.Errorf("doctor not found")
+	}
+
+	items, err := h.repo.GetItems(ctx, []string{prescription.ID})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription items: %v", err)
+		return nil, fmt.Errorf("failed to get prescription items: %w", err)
+	}
+
+	code, err := h.verificationCode(ctx, prescription)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &rxpdf.Document{
+		PrescriptionID: prescription.ID,
+		IssuedOn:       prescription.PrescriptionDate.Format(dateLayout),
+		ValidUntil:     prescription.ValidUntil.Format(dateLayout),
+		RefillsAllowed: prescription.RefillsAllowed,
+		Patient: rxpdf.Party{
+			Name:        patient.FirstName + " " + patient.LastName,
+			DateOfBirth: patient.DateOfBirth,
+			PhoneNumber: patient.PhoneNumber,
+		},
+		Doctor: rxpdf.Party{
+			Name:        "Dr. " + doctor.FirstName + " " + doctor.LastName,
+			PhoneNumber: doctor.PhoneNumber,
+			Email:       doctor.Email,
+		},
+		LicenseNumber:    doctor.LicenseNumber,
+		Instructions:     prescription.AdditionalInstructions,
+		VerificationCode: code,
+		Fingerprint:      prescriptionFingerprint(prescription, items),
+	}
+	if len(items) > 0 {
+		for _, item := range items {
+			doc.Items = append(doc.Items, rxpdf.Item{
+				Name:         item.MedicationName,
+				DrugCode:     item.DrugCode,
+				Dose:         item.DosageText,
+				Frequency:    item.FrequencyText,
+				Duration:     item.DurationText,
+				Route:        item.Route,
+				Quantity:     item.Quantity,
+				Instructions: item.Instructions,
+			})
+		}
+	} else {
+		for _, med := range entity.UnmarshalMedications(prescription.Medications) {
+			doc.Items = append(doc.Items, rxpdf.Item{
+				Name:         med.MedicationName,
+				DrugCode:     med.DrugCode,
+				Dose:         med.Dosage,
+				Frequency:    med.Frequency,
+				Duration:     med.Duration,
+				Route:        med.Route,
+				Quantity:     med.Quantity,
+				Instructions: med.Instructions,
+			})
+		}
+	}
+
+	pdf, err := h.renderer.Render(doc)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to render prescription %s: %v", prescription.ID, err)
+		return nil, err
+	}
+	return pdf, nil
+}
+
+// VerifyPrescription looks up a printed prescription by its verification
+// code. It is served without authentication, so it reports nothing beyond
+// PrescriptionVerification.
+func (h *PrescriptionHandler) VerifyPrescription(ctx context.Context, code string) (*PrescriptionVerification, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.VerifyPrescription")
+	defer span.End()
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		h.log.WithContext(ctx).Errorf("Verification code is required")
+		return nil, fmt.Errorf("verification code is required")
+	}
+
+	prescription, err := h.repo.GetByVerificationCode(ctx, code)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription by verification code: %v", err)
+		return nil, fmt.Errorf("failed to verify prescription: %w", err)
+	}
+	if prescription == nil {
+		return &PrescriptionVerification{Status: verificationStatusUnknown}, nil
+	}
+
+	doctor, err := h.doctorRepo.Get(ctx, prescription.DoctorID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, fmt.Errorf("failed to verify prescription: %w", err)
+	}
+
+	items, err := h.repo.GetItems(ctx, []string{prescription.ID})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription items: %v", err)
+		return nil, fmt.Errorf("failed to verify prescription: %w", err)
+	}
+	itemCount := len(items)
+	if itemCount == 0 {
+		itemCount = len(entity.UnmarshalMedications(prescription.Medications))
+	}
+
+	status := prescriptionStatus(prescription, time.Now())
+	verification := &PrescriptionVerification{
+		Valid:            status == entity.PrescriptionStatusActive,
+		Status:           status,
+		IssuedOn:         prescription.PrescriptionDate.Format(dateLayout),
+		ValidUntil:       prescription.ValidUntil.Format(dateLayout),
+		PatientInitials:  initials(prescription.PatientName),
+		ItemCount:        itemCount,
+		RefillsRemaining: prescription.RefillsAllowed - prescription.RefillsUsed,
+		Fingerprint:      prescriptionFingerprint(prescription, items),
+	}
+	if doctor != nil {
+		verification.Prescriber = "Dr. " + doctor.FirstName + " " + doctor.LastName
+		verification.LicenseNumber = doctor.LicenseNumber
+	}
+	return verification, nil
+}
+
+// verificationCode returns the prescription's verification code, assigning
+// a random one on first use.
+func (h *PrescriptionHandler) verificationCode(ctx context.Context, p *entity.Prescription) (string, error) {
+	if p.VerificationCode != nil {
+		return *p.VerificationCode, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate verification code: %w", err)
+	}
+	code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+	if err := h.repo.AssignVerificationCode(ctx, p.ID, code); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to assign verification code: %v", err)
+		return "", fmt.Errorf("failed to assign verification code: %w", err)
+	}
+
+	// Another print may have assigned a code first; use whichever was stored.
+	stored, err := h.repo.Get(ctx, p.ID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get prescription: %v", err)
+		return "", fmt.Errorf("failed to get prescription: %w", err)
+	}
+	if stored == nil || stored.VerificationCode == nil {
+		return "", fmt.Errorf("prescription %s has no verification code", p.ID)
+	}
+	p.VerificationCode = stored.VerificationCode
+	return *stored.VerificationCode, nil
+}
+
+// prescriptionFingerprint is a short digest of what is printed on the
+// prescription, shown on the paper and by verification so a pharmacist can
+// tell an altered printout from the original. Prescriptions are printed from
+// their items; only those without any fall back to the medications column.
+func prescriptionFingerprint(p *entity.Prescription, items []*entity.PrescriptionItem) string {
+	lines := []string{
+		p.ID,
+		p.DoctorID,
+		p.PrescriptionDate.UTC().Format(time.RFC3339),
+		p.ValidUntil.UTC().Format(time.RFC3339),
+		p.AdditionalInstructions,
+		fmt.Sprint(p.RefillsAllowed),
+	}
+	if len(items) > 0 {
+		for _, item := range canonicalItems(items) {
+			b, _ := json.Marshal(item)
+			lines = append(lines, string(b))
+		}
+	} else {
+		lines = append(lines, p.Medications)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:8]))
+	return digest[0:4] + "-" + digest[4:8] + "-" + digest[8:12] + "-" + digest[12:16]
+}
+
+func initials(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Fields(name) {
+		b.WriteString(strings.ToUpper(string([]rune(word)[0])))
+		b.WriteString(".")
+	}
+	return b.String()
+}
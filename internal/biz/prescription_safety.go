@@ -0,0 +1,333 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/drugcheck"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+)
+
+// Safety finding levels. Info findings are only reported, warnings block the
+// prescription unless the prescriber overrides them with a justification,
+// and blocking findings cannot be overridden.
+const (
+	SafetyLevelInfo    = "info"
+	SafetyLevelWarning = "warning"
+	SafetyLevelBlock   = "block"
+)
+
+// minJustificationLength keeps overrides from being waved through with a
+// one-word justification.
+const minJustificationLength = 10
+
+type SafetyFinding struct {
+	Code        string `json:"code"`
+	Kind        string `json:"kind"`
+	Level       string `json:"level"`
+	Severity    string `json:"severity"`
+	Medication  string `json:"medication"`
+	Against     string `json:"against"`
+	Description string `json:"description"`
+	Overridden  bool   `json:"overridden"`
+}
+
+type SafetyOverride struct {
+	Code          string `json:"code"`
+	Justification string `json:"justification"`
+}
+
+type SafetyCheckRequest struct {
+	PatientID   string               `json:"patient_id"`
+	Medications []*entity.Medication `json:"medications"`
+	Overrides   []*SafetyOverride    `json:"overrides"`
+}
+
+type SafetyCheckResponse struct {
+	PatientID string           `json:"patient_id"`
+	Allowed   bool             `json:"allowed"`
+	Findings  []*SafetyFinding `json:"findings"`
+}
+
+// CheckedPrescriptionRequest is CreatePrescription with the overrides the
+// prescriber accepts for the safety warnings it raises.
+type CheckedPrescriptionRequest struct {
+	AppointmentID          string               `json:"appointment_id"`
+	PatientID              string               `json:"patient_id"`
+	DoctorID               string               `json:"doctor_id"`
+	Medications            []*entity.Medication `json:"medications"`
+	Diagnosis              string               `json:"diagnosis"`
+	AdditionalInstructions string               `json:"additional_instructions"`
+	ValidityDays           int32                `json:"validity_days"`
+	Refills                int32                `json:"refills"`
+	Overrides              []*SafetyOverride    `json:"overrides"`
+
+	renewedFrom     string
+	amendedFrom     string
+	amendmentReason string
+	validUntil      time.Time
+}
+
+type CheckedPrescriptionResponse struct {
+	Prescription *responsepb.PrescriptionResponse `json:"prescription"`
+	Findings     []*SafetyFinding                 `json:"findings"`
+}
+
+type SafetyOverrideResponse struct {
+	Code          string `json:"code"`
+	Kind          string `json:"kind"`
+	Severity      string `json:"severity"`
+	Description   string `json:"description"`
+	Justification string `json:"justification"`
+	PrescriberID  string `json:"prescriber_id"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type SafetyOverridesResponse struct {
+	PrescriptionID string                    `json:"prescription_id"`
+	Overrides      []*SafetyOverrideResponse `json:"overrides"`
+}
+
+// safetyLevel is the policy mapping a finding to how it is handled.
+// Interactions follow their severity: contraindicated combinations are
+// blocked, major and moderate ones need an override, minor ones are noted.
+// Allergy matches block when the allergy is recorded as severe or
+// life-threatening and need an override otherwise.
+func safetyLevel(f drugcheck.Finding) string {
+	if f.Kind == drugcheck.KindAllergy {
+		switch f.Severity {
+		case entity.AllergySeveritySevere, entity.AllergySeverityLifeThreatening:
+			return SafetyLevelBlock
+		default:
+			return SafetyLevelWarning
+		}
+	}
+
+	switch f.Severity {
+	case drugcheck.SeverityContraindicated:
+		return SafetyLevelBlock
+	case drugcheck.SeverityMajor, drugcheck.SeverityModerate:
+		return SafetyLevelWarning
+	default:
+		return SafetyLevelInfo
+	}
+}
+
+// CheckPrescriptionSafety runs the safety checks for medications about to be
+// prescribed without writing anything, so prescribers can see the findings
+// and decide on overrides first.
+func (h *PrescriptionHandler) CheckPrescriptionSafety(ctx context.Context, req *SafetyCheckRequest) (*SafetyCheckResponse, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.CheckPrescriptionSafety")
+	defer span.End()
+
+	if req.PatientID == "" {
+		h.log.WithContext(ctx).Errorf("Patient ID is required")
+		return nil, fmt.Errorf("patient_id is required")
+	}
+	if len(req.Medications) == 0 {
+		h.log.WithContext(ctx).Errorf("At least one medication is required")
+		return nil, fmt.Errorf("at least one medication is required")
+	}
+
+	patient, err := h.patientRepo.Get(ctx, req.PatientID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", req.PatientID)
+		return nil, fmt.Errorf("patient not found")
+	}
+
+	findings, err := h.safetyFindings(ctx, patient.ID, req.Medications, "")
+	if err != nil {
+		return nil, err
+	}
+	_, unresolved := applyOverrides(findings, req.Overrides)
+
+	return &SafetyCheckResponse{
+		PatientID: patient.ID,
+		Allowed:   unresolved == nil && validateOverrides(findings, req.Overrides) == nil,
+		Findings:  findings,
+	}, nil
+}
+
+// CreateCheckedPrescription creates a prescription, accepting the given
+// overrides for its safety warnings and recording them with it.
+func (h *PrescriptionHandler) CreateCheckedPrescription(ctx context.Context, req *CheckedPrescriptionRequest) (*CheckedPrescriptionResponse, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.CreateCheckedPrescription")
+	defer span.End()
+
+	prescription, findings, err := h.createPrescription(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CheckedPrescriptionResponse{
+		Prescription: h.entityToProto(prescription),
+		Findings:     findings,
+	}, nil
+}
+
+func (h *PrescriptionHandler) GetSafetyOverrides(ctx context.Context, prescriptionID string) (*SafetyOverridesResponse, error) {
+	ctx, span := otel.Trace(ctx, "PrescriptionHandler.GetSafetyOverrides")
+	defer span.End()
+
+	if prescriptionID == "" {
+		h.log.WithContext(ctx).Errorf("Prescription ID is required")
+		return nil, fmt.Errorf("prescription_id is required")
+	}
+
+	overrides, err := h.repo.GetOverrides(ctx, prescriptionID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get safety overrides: %v", err)
+		return nil, fmt.Errorf("failed to get safety overrides: %w", err)
+	}
+
+	response := &SafetyOverridesResponse{PrescriptionID: prescriptionID, Overrides: []*SafetyOverrideResponse{}}
+	for _, o := range overrides {
+		response.Overrides = append(response.Overrides, &SafetyOverrideResponse{
+			Code:          o.Code,
+			Kind:          o.Kind,
+			Severity:      o.Severity,
+			Description:   o.Description,
+			Justification: o.Justification,
+			PrescriberID:  o.PrescriberID,
+			CreatedAt:     formatTimestamp(o.CreatedAt),
+		})
+	}
+	return response, nil
+}
+
+// safetyFindings compares the medications against the patient's recorded
+// allergies, the medications on their active prescriptions and the current
+// medications in their profile. The prescription being renewed, if any, is
+// left out so that a renewal is not flagged as duplicating itself.
+func (h *PrescriptionHandler) safetyFindings(ctx context.Context, patientID string, medications []*entity.Medication, renewing string) ([]*SafetyFinding, error) {
+	var allergies []*entity.PatientAllergy
+	if err := h.profileRepo.List(ctx, patientID, &allergies); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient allergies: %v", err)
+		return nil, fmt.Errorf("failed to get patient allergies: %w", err)
+	}
+	var profileMeds []*entity.PatientMedication
+	if err := h.profileRepo.List(ctx, patientID, &profileMeds); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient medications: %v", err)
+		return nil, fmt.Errorf("failed to get patient medications: %w", err)
+	}
+	prescriptions, err := h.repo.GetByPatientID(ctx, patientID, map[string]interface{}{})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient prescriptions: %v", err)
+		return nil, fmt.Errorf("failed to get patient prescriptions: %w", err)
+	}
+
+	now := time.Now()
+	today := now.UTC().Format(dateLayout)
+	seen := make(map[string]bool)
+	var current []string
+	addCurrent := func(name string) {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key != "" && !seen[key] {
+			seen[key] = true
+			current = append(current, name)
+		}
+	}
+	for _, p := range prescriptions {
+		if p.ID == renewing || prescriptionStatus(p, now) != entity.PrescriptionStatusActive {
+			continue
+		}
+		for _, m := range entity.UnmarshalMedications(p.Medications) {
+			addCurrent(m.MedicationName)
+		}
+	}
+	for _, m := range profileMeds {
+		if m.EndedOn == "" || m.EndedOn >= today {
+			addCurrent(m.Name)
+		}
+	}
+
+	var names []string
+	for _, m := range medications {
+		names = append(names, m.MedicationName)
+	}
+	var recorded []drugcheck.Allergy
+	for _, a := range allergies {
+		recorded = append(recorded, drugcheck.Allergy{Allergen: a.Allergen, Severity: a.Severity})
+	}
+
+	checks := append(h.drugs.CheckAllergies(names, recorded), h.drugs.CheckInteractions(names, current)...)
+	findings := []*SafetyFinding{}
+	for _, f := range checks {
+		findings = append(findings, &SafetyFinding{
+			Code:        f.Code,
+			Kind:        f.Kind,
+			Level:       safetyLevel(f),
+			Severity:    f.Severity,
+			Medication:  f.Medication,
+			Against:     f.Against,
+			Description: f.Description,
+		})
+	}
+	return findings, nil
+}
+
+// applyOverrides marks the warnings covered by an override as overridden.
+// It returns the overrides that were applied and the findings that still
+// stand in the way: blocking findings and warnings without an override.
+func applyOverrides(findings []*SafetyFinding, overrides []*SafetyOverride) (map[string]*SafetyOverride, []*SafetyFinding) {
+	byCode := make(map[string]*SafetyOverride)
+	for _, o := range overrides {
+		byCode[o.Code] = o
+	}
+
+	applied := make(map[string]*SafetyOverride)
+	var unresolved []*SafetyFinding
+	for _, f := range findings {
+		switch f.Level {
+		case SafetyLevelBlock:
+			unresolved = append(unresolved, f)
+		case SafetyLevelWarning:
+			if o, ok := byCode[f.Code]; ok {
+				f.Overridden = true
+				applied[f.Code] = o
+			} else {
+				unresolved = append(unresolved, f)
+			}
+		}
+	}
+	return applied, unresolved
+}
+
+// validateOverrides checks that every override refers to a warning among the
+// findings and carries a real justification, so that a mistyped code cannot
+// go unnoticed.
+func validateOverrides(findings []*SafetyFinding, overrides []*SafetyOverride) error {
+	levels := make(map[string]string)
+	for _, f := range findings {
+		levels[f.Code] = f.Level
+	}
+	for _, o := range overrides {
+		level, ok := levels[o.Code]
+		if !ok {
+			return fmt.Errorf("override %q does not match any safety finding", o.Code)
+		}
+		if level == SafetyLevelBlock {
+			return fmt.Errorf("safety finding %q cannot be overridden", o.Code)
+		}
+		if len(strings.TrimSpace(o.Justification)) < minJustificationLength {
+			return fmt.Errorf("override %q needs a justification of at least %d characters", o.Code, minJustificationLength)
+		}
+	}
+	return nil
+}
+
+func describeFindings(findings []*SafetyFinding) string {
+	var parts []string
+	for _, f := range findings {
+		parts = append(parts, fmt.Sprintf("%s [%s] %s", f.Code, f.Level, f.Description))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,104 @@
+package biz
+
+import (
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+)
+
+// resourcePool is a snapshot of a clinic's rooms, equipment and the resource
+// bookings that overlap the period being scheduled.
+type resourcePool struct {
+	rooms     []*entity.Room
+	equipment []*entity.Equipment
+	bookings  []*entity.ResourceBooking
+}
+
+func (p *resourcePool) busy(resourceType, id string, start, end time.Time) bool {
+	for _, b := range p.bookings {
+		if b.ResourceType == resourceType && b.ResourceID == id && b.StartsAt.Before(end) && b.EndsAt.After(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// managed reports whether bookings at the clinic go through resource
+// allocation. Clinics that have not set up any rooms keep booking on the
+// doctor's schedule alone, unless specific equipment is requested.
+func (p *resourcePool) managed(required []string) bool {
+	return len(p.rooms) > 0 || len(required) > 0
+}
+
+// allocate picks a free room for [start, end) together with one unit of each
+// required equipment type. Equipment installed in a room comes with the room;
+// portable equipment (no room) is booked on its own. It returns the resources
+// that have to be booked, or false if no combination is free.
+func (p *resourcePool) allocate(start, end time.Time, required []string) (*entity.Room, []*entity.Equipment, bool) {
+	for _, room := range p.rooms {
+		if !room.IsActive || p.busy(entity.ResourceTypeRoom, room.ID, start, end) {
+			continue
+		}
+
+		taken := make(map[string]bool)
+		var portable []*entity.Equipment
+		ok := true
+		for _, kind := range required {
+			unit := p.findEquipment(kind, room.ID, start, end, taken)
+			if unit == nil {
+				ok = false
+				break
+			}
+			taken[unit.ID] = true
+			if unit.RoomID == "" {
+				portable = append(portable, unit)
+			}
+		}
+		if ok {
+			return room, portable, true
+		}
+	}
+
+	return nil, nil, false
+}
+
+func (p *resourcePool) findEquipment(kind, roomID string, start, end time.Time, taken map[string]bool) *entity.Equipment {
+	var portable *entity.Equipment
+	for _, e := range p.equipment {
+		if !e.IsActive || taken[e.ID] || !strings.EqualFold(e.Type, kind) {
+			continue
+		}
+		if e.RoomID == roomID {
+			return e
+		}
+		if e.RoomID == "" && portable == nil && !p.busy(entity.ResourceTypeEquipment, e.ID, start, end) {
+			portable = e
+		}
+	}
+	return portable
+}
+
+// resourceBookings turns an allocation into the rows that reserve it for an
+// appointment.
+func resourceBookings(appointment *entity.Appointment, room *entity.Room, equipment []*entity.Equipment) []*entity.ResourceBooking {
+	bookings := []*entity.ResourceBooking{{
+		AppointmentID: appointment.ID,
+		ClinicID:      appointment.ClinicID,
+		ResourceType:  entity.ResourceTypeRoom,
+		ResourceID:    room.ID,
+		StartsAt:      appointment.StartsAt,
+		EndsAt:        appointment.EndsAt,
+	}}
+	for _, e := range equipment {
+		bookings = append(bookings, &entity.ResourceBooking{
+			AppointmentID: appointment.ID,
+			ClinicID:      appointment.ClinicID,
+			ResourceType:  entity.ResourceTypeEquipment,
+			ResourceID:    e.ID,
+			StartsAt:      appointment.StartsAt,
+			EndsAt:        appointment.EndsAt,
+		})
+	}
+	return bookings
+}
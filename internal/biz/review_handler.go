@@ -0,0 +1,277 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+type ReviewRequest struct {
+	AppointmentID string `json:"appointment_id"`
+	PatientID     string `json:"patient_id"`
+	Rating        int32  `json:"rating"`
+	Comment       string `json:"comment"`
+}
+
+type ModerateReviewRequest struct {
+	ReviewID string `json:"review_id,omitempty"`
+	Action   string `json:"action"`
+	Note     string `json:"note"`
+}
+
+type ReviewResponse struct {
+	ReviewID       string `json:"review_id"`
+	AppointmentID  string `json:"appointment_id"`
+	DoctorID       string `json:"doctor_id"`
+	PatientID      string `json:"patient_id"`
+	PatientName    string `json:"patient_name"`
+	Rating         int32  `json:"rating"`
+	Comment        string `json:"comment"`
+	Status         string `json:"status"`
+	ModerationNote string `json:"moderation_note,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+type ListReviewsResponse struct {
+	DoctorID      string            `json:"doctor_id"`
+	AverageRating float32           `json:"average_rating"`
+	RatingCount   int32             `json:"rating_count"`
+	Reviews       []*ReviewResponse `json:"reviews"`
+}
+
+type ReviewHandler struct {
+	repo            data.ReviewRepo
+	appointmentRepo data.AppointmentRepo
+	doctorRepo      data.DoctorRepo
+	tx              data.Transaction
+	log             *log.Helper
+}
+
+func NewReviewHandler(
+	repo data.ReviewRepo,
+	appointmentRepo data.AppointmentRepo,
+	doctorRepo data.DoctorRepo,
+	tx data.Transaction,
+	logger log.Logger,
+) *ReviewHandler {
+	return &ReviewHandler{
+		repo:            repo,
+		appointmentRepo: appointmentRepo,
+		doctorRepo:      doctorRepo,
+		tx:              tx,
+		log:             log.NewHelper(logger),
+	}
+}
+
+// CreateReview records the patient's review of a completed appointment and
+// folds its rating into the doctor's average in the same transaction.
+func (h *ReviewHandler) CreateReview(ctx context.Context, req *ReviewRequest) (*ReviewResponse, error) {
+	ctx, span := otel.Trace(ctx, "ReviewHandler.CreateReview")
+	defer span.End()
+
+	if req.AppointmentID == "" || req.PatientID == "" {
+		h.log.WithContext(ctx).Errorf("Appointment ID and patient ID are required")
+		return nil, fmt.Errorf("appointment_id and patient_id are required")
+	}
+	if req.Rating < entity.MinReviewRating || req.Rating > entity.MaxReviewRating {
+		h.log.WithContext(ctx).Errorf("Invalid rating: %d", req.Rating)
+		return nil, fmt.Errorf("rating must be between %d and %d", entity.MinReviewRating, entity.MaxReviewRating)
+	}
+
+	appointment, err := h.appointmentRepo.Get(ctx, req.AppointmentID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get appointment: %v", err)
+		return nil, fmt.Errorf("failed to get appointment: %w", err)
+	}
+	if appointment == nil {
+		h.log.WithContext(ctx).Errorf("Appointment not found: %s", req.AppointmentID)
+		return nil, fmt.Errorf("appointment not found")
+	}
+	if appointment.PatientID != req.PatientID {
+		h.log.WithContext(ctx).Errorf("Patient %s did not attend appointment %s", req.PatientID, req.AppointmentID)
+		return nil, fmt.Errorf("only the appointment's patient can review it")
+	}
+	if appointment.Status != entity.AppointmentStatusCompleted {
+		h.log.WithContext(ctx).Errorf("Cannot review appointment %s with status %d", req.AppointmentID, appointment.Status)
+		return nil, fmt.Errorf("only completed appointments can be reviewed")
+	}
+
+	review := &entity.Review{
+		AppointmentID: appointment.ID,
+		DoctorID:      appointment.DoctorID,
+		PatientID:     appointment.PatientID,
+		PatientName:   appointment.PatientName,
+		Rating:        req.Rating,
+		Comment:       req.Comment,
+		Status:        entity.ReviewStatusPublished,
+	}
+
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := h.doctorRepo.Lock(ctx, review.DoctorID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to lock doctor: %v", err)
+			return fmt.Errorf("failed to lock doctor: %w", err)
+		}
+
+		existing, err := h.repo.GetByAppointment(ctx, appointment.ID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to check existing review: %v", err)
+			return fmt.Errorf("failed to check existing review: %w", err)
+		}
+		if existing != nil {
+			h.log.WithContext(ctx).Errorf("Appointment already reviewed: %s", appointment.ID)
+			return fmt.Errorf("appointment has already been reviewed")
+		}
+
+		if err := h.repo.Create(ctx, review); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to create review: %v", err)
+			return fmt.Errorf("failed to create review: %w", err)
+		}
+		if err := h.doctorRepo.AdjustRating(ctx, review.DoctorID, int64(review.Rating), 1); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to update doctor rating: %v", err)
+			return fmt.Errorf("failed to update doctor rating: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reviewToResponse(review), nil
+}
+
+func (h *ReviewHandler) ListDoctorReviews(ctx context.Context, doctorID string, includeHidden bool) (*ListReviewsResponse, error) {
+	ctx, span := otel.Trace(ctx, "ReviewHandler.ListDoctorReviews")
+	defer span.End()
+
+	if doctorID == "" {
+		h.log.WithContext(ctx).Errorf("Doctor ID is required")
+		return nil, fmt.Errorf("doctor_id is required")
+	}
+
+	doctor, err := h.doctorRepo.Get(ctx, doctorID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get doctor: %v", err)
+		return nil, fmt.Errorf("failed to get doctor: %w", err)
+	}
+	if doctor == nil {
+		h.log.WithContext(ctx).Errorf("Doctor not found: %s", doctorID)
+		return nil, fmt.Errorf("doctor not found")
+	}
+
+	reviews, err := h.repo.ListByDoctor(ctx, doctorID, map[string]interface{}{"include_hidden": includeHidden})
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to list reviews: %v", err)
+		return nil, fmt.Errorf("failed to list reviews: %w", err)
+	}
+
+	resp := &ListReviewsResponse{
+		DoctorID:      doctor.ID,
+		AverageRating: doctor.AverageRating,
+		RatingCount:   doctor.RatingCount,
+	}
+	for _, r := range reviews {
+		resp.Reviews = append(resp.Reviews, reviewToResponse(r))
+	}
+
+	return resp, nil
+}
+
+// ModerateReview hides, flags or restores a review. Hidden reviews stop
+// counting towards the doctor's rating; restoring one counts it again.
+func (h *ReviewHandler) ModerateReview(ctx context.Context, req *ModerateReviewRequest) (*ReviewResponse, error) {
+	ctx, span := otel.Trace(ctx, "ReviewHandler.ModerateReview")
+	defer span.End()
+
+	if req.ReviewID == "" {
+		h.log.WithContext(ctx).Errorf("Review ID is required")
+		return nil, fmt.Errorf("review_id is required")
+	}
+
+	var status string
+	switch req.Action {
+	case "hide":
+		status = entity.ReviewStatusHidden
+	case "flag":
+		status = entity.ReviewStatusFlagged
+	case "restore":
+		status = entity.ReviewStatusPublished
+	default:
+		h.log.WithContext(ctx).Errorf("Invalid moderation action: %s", req.Action)
+		return nil, fmt.Errorf("action must be one of hide, flag or restore")
+	}
+
+	review, err := h.repo.Get(ctx, req.ReviewID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get review: %v", err)
+		return nil, fmt.Errorf("failed to get review: %w", err)
+	}
+	if review == nil {
+		h.log.WithContext(ctx).Errorf("Review not found: %s", req.ReviewID)
+		return nil, fmt.Errorf("review not found")
+	}
+
+	err = h.tx.InTx(ctx, func(ctx context.Context) error {
+		// Re-read the review under the doctor lock so that concurrent
+		// moderations cannot both adjust the rating.
+		if err := h.doctorRepo.Lock(ctx, review.DoctorID); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to lock doctor: %v", err)
+			return fmt.Errorf("failed to lock doctor: %w", err)
+		}
+		current, err := h.repo.Get(ctx, review.ID)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to get review: %v", err)
+			return fmt.Errorf("failed to get review: %w", err)
+		}
+		review = current
+
+		wasCounted := review.Status != entity.ReviewStatusHidden
+		counted := status != entity.ReviewStatusHidden
+		review.Status = status
+		if req.Note != "" {
+			review.ModerationNote = req.Note
+		}
+
+		if err := h.repo.Update(ctx, review); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to update review: %v", err)
+			return fmt.Errorf("failed to update review: %w", err)
+		}
+
+		if wasCounted != counted {
+			sign := int32(1)
+			if !counted {
+				sign = -1
+			}
+			if err := h.doctorRepo.AdjustRating(ctx, review.DoctorID, int64(sign*review.Rating), sign); err != nil {
+				h.log.WithContext(ctx).Errorf("Failed to update doctor rating: %v", err)
+				return fmt.Errorf("failed to update doctor rating: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reviewToResponse(review), nil
+}
+
+func reviewToResponse(review *entity.Review) *ReviewResponse {
+	return &ReviewResponse{
+		ReviewID:       review.ID,
+		AppointmentID:  review.AppointmentID,
+		DoctorID:       review.DoctorID,
+		PatientID:      review.PatientID,
+		PatientName:    review.PatientName,
+		Rating:         review.Rating,
+		Comment:        review.Comment,
+		Status:         review.Status,
+		ModerationNote: review.ModerationNote,
+		CreatedAt:      formatTimestamp(review.CreatedAt),
+		UpdatedAt:      formatTimestamp(review.UpdatedAt),
+	}
+}
@@ -0,0 +1,300 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	requestpb "github.com/arm-1234/common-protos/medical/v1/request"
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+)
+
+const (
+	dateLayout  = "2006-01-02"
+	clockLayout = "15:04"
+)
+
+// loadLocation resolves an IANA timezone name, treating an empty name as the
+// service default.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		name = entity.DefaultTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// parseAppointmentStart turns the date/time pair of a booking request into an
+// instant. appointmentTime may be a full RFC3339 timestamp, in which case its
+// offset wins; otherwise date ("2006-01-02") and time ("15:04") are read as
+// wall-clock time in loc. Wall-clock times skipped by a DST transition are
+// rejected rather than silently shifted.
+func parseAppointmentStart(date, appointmentTime string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, appointmentTime); err == nil {
+		return t.In(loc), nil
+	}
+	if t, err := time.Parse(time.RFC3339, date); err == nil && appointmentTime == "" {
+		return t.In(loc), nil
+	}
+
+	day, err := time.ParseInLocation(dateLayout, date, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC3339", date)
+	}
+	clock, err := time.Parse(clockLayout, appointmentTime)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected HH:MM or RFC3339", appointmentTime)
+	}
+
+	t := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	if t.Hour() != clock.Hour() || t.Minute() != clock.Minute() {
+		return time.Time{}, fmt.Errorf("%s %s does not exist in timezone %s", date, appointmentTime, loc)
+	}
+	return t, nil
+}
+
+// parseDay parses a calendar date in loc, accepting RFC3339 input too.
+func parseDay(date string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, date); err == nil {
+		t = t.In(loc)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+	}
+	day, err := time.ParseInLocation(dateLayout, date, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+	}
+	return day, nil
+}
+
+// validateClock checks an "HH:MM" wall-clock string.
+func validateClock(s string) error {
+	if _, err := time.Parse(clockLayout, s); err != nil {
+		return fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return nil
+}
+
+// scheduleWindow is an availability template together with the timezone its
+// wall-clock times are expressed in: the clinic's zone for templates scoped to
+// a clinic, the doctor's zone otherwise.
+type scheduleWindow struct {
+	*entity.DoctorAvailability
+	loc *time.Location
+}
+
+type slot struct {
+	start    time.Time
+	end      time.Time
+	clinicID string
+}
+
+// defaultAvailability is used for doctors who have not configured a weekly
+// schedule: 09:00-17:00 in 30 minute slots.
+var defaultAvailability = &entity.DoctorAvailability{
+	StartTime:           "09:00",
+	EndTime:             "17:00",
+	SlotDurationMinutes: entity.DefaultSlotDurationMinutes,
+}
+
+// generateSlots lays out the slots the windows offer on the calendar date of
+// day. Window bounds are wall-clock times in the window's zone, but the slots
+// in between are stepped in absolute time, so a window that spans a DST
+// change yields exactly as many slots as there are real minutes in it.
+func generateSlots(day time.Time, windows []scheduleWindow) []slot {
+	var slots []slot
+	for _, w := range windows {
+		date := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, w.loc)
+		if w.DayOfWeek != "" && !strings.EqualFold(w.DayOfWeek, date.Weekday().String()) {
+			continue
+		}
+		startClock, err := time.Parse(clockLayout, w.StartTime)
+		if err != nil {
+			continue
+		}
+		endClock, err := time.Parse(clockLayout, w.EndTime)
+		if err != nil {
+			continue
+		}
+		duration := time.Duration(w.SlotDurationMinutes) * time.Minute
+		if duration <= 0 {
+			duration = entity.DefaultSlotDurationMinutes * time.Minute
+		}
+
+		start := time.Date(day.Year(), day.Month(), day.Day(), startClock.Hour(), startClock.Minute(), 0, 0, w.loc)
+		end := time.Date(day.Year(), day.Month(), day.Day(), endClock.Hour(), endClock.Minute(), 0, 0, w.loc)
+		for t := start; !t.Add(duration).After(end); t = t.Add(duration) {
+			slots = append(slots, slot{start: t, end: t.Add(duration), clinicID: w.ClinicID})
+		}
+	}
+
+	return slots
+}
+
+// loadScheduleWindows loads the doctor's availability templates, each bound to the
+// timezone of its clinic, optionally restricted to one clinic. It also returns
+// the doctor's own timezone for requests that match no template.
+func loadScheduleWindows(ctx context.Context, doctorRepo data.DoctorRepo, clinicRepo data.ClinicRepo, doctor *entity.Doctor, clinicID string) (*time.Location, []scheduleWindow, error) {
+	availability, err := doctorRepo.GetAvailability(ctx, doctor.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get availability: %w", err)
+	}
+	return scheduleWindows(ctx, clinicRepo, doctor, availability, clinicID, make(map[string]*time.Location))
+}
+
+// scheduleWindows is loadScheduleWindows for templates already loaded.
+// clinicLocs caches clinic timezones across calls, with nil for clinics that
+// are gone or inactive.
+func scheduleWindows(ctx context.Context, clinicRepo data.ClinicRepo, doctor *entity.Doctor, availability []*entity.DoctorAvailability, clinicID string, clinicLocs map[string]*time.Location) (*time.Location, []scheduleWindow, error) {
+	doctorLoc, err := loadLocation(doctor.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(availability) == 0 && clinicID == "" {
+		return doctorLoc, []scheduleWindow{{DoctorAvailability: defaultAvailability, loc: doctorLoc}}, nil
+	}
+
+	var windows []scheduleWindow
+	for _, a := range availability {
+		if clinicID != "" && a.ClinicID != clinicID {
+			continue
+		}
+		if a.ClinicID == "" {
+			windows = append(windows, scheduleWindow{DoctorAvailability: a, loc: doctorLoc})
+			continue
+		}
+
+		loc, ok := clinicLocs[a.ClinicID]
+		if !ok {
+			clinic, err := clinicRepo.Get(ctx, a.ClinicID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to get clinic: %w", err)
+			}
+			if clinic == nil || !clinic.IsActive {
+				clinicLocs[a.ClinicID] = nil
+				continue
+			}
+			if loc, err = loadLocation(clinic.Timezone); err != nil {
+				return nil, nil, err
+			}
+			clinicLocs[a.ClinicID] = loc
+		}
+		if loc == nil {
+			continue
+		}
+		windows = append(windows, scheduleWindow{DoctorAvailability: a, loc: loc})
+	}
+
+	return doctorLoc, windows, nil
+}
+
+// nextAvailableHorizonDays bounds how far ahead nextAvailableSlot looks.
+const nextAvailableHorizonDays = 14
+
+// nextAvailableSlot returns the first slot starting at or after from in which
+// the doctor has no appointment at any clinic, or nil if there is none within
+// nextAvailableHorizonDays.
+func nextAvailableSlot(ctx context.Context, appointmentRepo data.AppointmentRepo, doctorID string, loc *time.Location, windows []scheduleWindow, from time.Time) (*slot, error) {
+	if len(windows) == 0 {
+		return nil, nil
+	}
+
+	existing, err := appointmentRepo.GetByDoctorInRange(ctx, doctorID, from, from.AddDate(0, 0, nextAvailableHorizonDays+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get existing appointments: %w", err)
+	}
+	return firstFreeSlot(existing, loc, windows, from), nil
+}
+
+// firstFreeSlot is nextAvailableSlot for the doctor's appointments already
+// loaded, covering at least the horizon after from.
+func firstFreeSlot(existing []*entity.Appointment, loc *time.Location, windows []scheduleWindow, from time.Time) *slot {
+	local := from.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i <= nextAvailableHorizonDays; i++ {
+		candidates := generateSlots(day.AddDate(0, 0, i), windows)
+		sort.Slice(candidates, func(a, b int) bool { return candidates[a].start.Before(candidates[b].start) })
+
+		for _, c := range candidates {
+			if c.start.Before(from) {
+				continue
+			}
+			free := true
+			for _, apt := range existing {
+				if apt.StartsAt.Before(c.end) && apt.EndsAt.After(c.start) {
+					free = false
+					break
+				}
+			}
+			if free {
+				return &c
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveSlot maps the date/time of a booking request onto the availability
+// window it falls in, which decides the appointment's clinic, timezone and
+// length. Requests outside every window are kept in the fallback zone with
+// the default slot length and no clinic.
+func resolveSlot(date, appointmentTime string, fallback *time.Location, windows []scheduleWindow) (slot, error) {
+	for _, w := range windows {
+		start, err := parseAppointmentStart(date, appointmentTime, w.loc)
+		if err != nil {
+			continue
+		}
+		for _, s := range generateSlots(start, []scheduleWindow{w}) {
+			if s.start.Equal(start) {
+				return s, nil
+			}
+		}
+	}
+
+	start, err := parseAppointmentStart(date, appointmentTime, fallback)
+	if err != nil {
+		return slot{}, err
+	}
+	return slot{start: start, end: start.Add(entity.DefaultSlotDurationMinutes * time.Minute)}, nil
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+// withinOpeningHours reports whether an availability template fits inside the
+// clinic's opening hours. Clinics without configured hours accept anything; a
+// template without a day of week must fit every day of the week.
+func withinOpeningHours(hours []*entity.OpeningHours, slot *requestpb.AvailabilitySlot) bool {
+	if len(hours) == 0 {
+		return true
+	}
+
+	days := []string{slot.DayOfWeek}
+	if slot.DayOfWeek == "" {
+		days = nil
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			days = append(days, d.String())
+		}
+	}
+
+	for _, day := range days {
+		open := false
+		for _, oh := range hours {
+			if strings.EqualFold(oh.DayOfWeek, day) && oh.OpenTime <= slot.StartTime && slot.EndTime <= oh.CloseTime {
+				open = true
+				break
+			}
+		}
+		if !open {
+			return false
+		}
+	}
+	return true
+}
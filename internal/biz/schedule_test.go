@@ -0,0 +1,165 @@
+package biz
+
+import (
+	"testing"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+)
+
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone database unavailable: %v", err)
+	}
+	return loc
+}
+
+func TestParseAppointmentStartDST(t *testing.T) {
+	loc := newYork(t)
+
+	tests := []struct {
+		name    string
+		date    string
+		time    string
+		want    string
+		wantErr bool
+	}{
+		{name: "before spring forward", date: "2024-03-10", time: "01:30", want: "2024-03-10T06:30:00Z"},
+		{name: "spring forward gap", date: "2024-03-10", time: "02:30", wantErr: true},
+		{name: "after spring forward", date: "2024-03-10", time: "03:00", want: "2024-03-10T07:00:00Z"},
+		{name: "fall back overlap wall clock", date: "2024-11-03", time: "01:30", want: "2024-11-03T05:30:00Z"},
+		{name: "fall back overlap second pass", date: "2024-11-03", time: "2024-11-03T01:30:00-05:00", want: "2024-11-03T06:30:00Z"},
+		{name: "after fall back", date: "2024-11-03", time: "02:00", want: "2024-11-03T07:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAppointmentStart(tt.date, tt.time, loc)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseAppointmentStart(%q, %q) = %v, want error", tt.date, tt.time, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseAppointmentStart(%q, %q): %v", tt.date, tt.time, err)
+			}
+			if s := got.UTC().Format(time.RFC3339); s != tt.want {
+				t.Errorf("parseAppointmentStart(%q, %q) = %s, want %s", tt.date, tt.time, s, tt.want)
+			}
+			if got.Location() != loc {
+				t.Errorf("parseAppointmentStart(%q, %q) in %v, want %v", tt.date, tt.time, got.Location(), loc)
+			}
+		})
+	}
+}
+
+func TestGenerateSlotsDST(t *testing.T) {
+	loc := newYork(t)
+
+	tests := []struct {
+		name  string
+		day   string
+		start string
+		end   string
+		want  []string
+	}{
+		{
+			// 01:00-04:00 on the wall clock is only two real hours.
+			name:  "spring forward gap",
+			day:   "2024-03-10",
+			start: "01:00",
+			end:   "04:00",
+			want: []string{
+				"2024-03-10T06:00:00Z",
+				"2024-03-10T06:30:00Z",
+				"2024-03-10T07:00:00Z",
+				"2024-03-10T07:30:00Z",
+			},
+		},
+		{
+			// 01:00-03:00 on the wall clock is three real hours, with
+			// 01:00-02:00 passed twice.
+			name:  "fall back overlap",
+			day:   "2024-11-03",
+			start: "01:00",
+			end:   "03:00",
+			want: []string{
+				"2024-11-03T05:00:00Z",
+				"2024-11-03T05:30:00Z",
+				"2024-11-03T06:00:00Z",
+				"2024-11-03T06:30:00Z",
+				"2024-11-03T07:00:00Z",
+				"2024-11-03T07:30:00Z",
+			},
+		},
+		{
+			name:  "ordinary day",
+			day:   "2024-11-04",
+			start: "09:00",
+			end:   "10:00",
+			want: []string{
+				"2024-11-04T14:00:00Z",
+				"2024-11-04T14:30:00Z",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			day, err := time.ParseInLocation(dateLayout, tt.day, loc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			window := scheduleWindow{
+				DoctorAvailability: &entity.DoctorAvailability{
+					StartTime:           tt.start,
+					EndTime:             tt.end,
+					SlotDurationMinutes: 30,
+				},
+				loc: loc,
+			}
+
+			slots := generateSlots(day, []scheduleWindow{window})
+			if len(slots) != len(tt.want) {
+				t.Fatalf("generateSlots returned %d slots, want %d: %v", len(slots), len(tt.want), slots)
+			}
+			for i, s := range slots {
+				if got := s.start.UTC().Format(time.RFC3339); got != tt.want[i] {
+					t.Errorf("slot %d starts at %s, want %s", i, got, tt.want[i])
+				}
+				if d := s.end.Sub(s.start); d != 30*time.Minute {
+					t.Errorf("slot %d lasts %v, want 30m", i, d)
+				}
+			}
+		})
+	}
+}
+
+// A slot offered during the repeated hour can be booked by its RFC 3339
+// start, whichever pass of the wall clock it falls in.
+func TestResolveSlotFallBackOverlap(t *testing.T) {
+	loc := newYork(t)
+	window := scheduleWindow{
+		DoctorAvailability: &entity.DoctorAvailability{
+			StartTime:           "01:00",
+			EndTime:             "03:00",
+			SlotDurationMinutes: 30,
+			ClinicID:            "clinic-1",
+		},
+		loc: loc,
+	}
+
+	for _, start := range []string{"2024-11-03T01:30:00-04:00", "2024-11-03T01:30:00-05:00"} {
+		s, err := resolveSlot("2024-11-03", start, time.UTC, []scheduleWindow{window})
+		if err != nil {
+			t.Fatalf("resolveSlot(%s): %v", start, err)
+		}
+		want, _ := time.Parse(time.RFC3339, start)
+		if !s.start.Equal(want) || s.clinicID != "clinic-1" {
+			t.Errorf("resolveSlot(%s) = %v in clinic %q, want %v in clinic-1", start, s.start, s.clinicID, want)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package biz
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/signing"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// SignatureVerification reports whether a signed row is unchanged since it
+// was signed.
+type SignatureVerification struct {
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Signed       bool   `json:"signed"`
+	Valid        bool   `json:"valid"`
+	SignedBy     string `json:"signed_by,omitempty"`
+	SignedAt     string `json:"signed_at,omitempty"`
+	Algorithm    string `json:"algorithm,omitempty"`
+	KeyID        string `json:"key_id,omitempty"`
+	// SignedPatientID is set when the row was signed for a patient that has
+	// since been merged into its current one.
+	SignedPatientID string `json:"signed_patient_id,omitempty"`
+	Problem         string `json:"problem,omitempty"`
+}
+
+// maxMergeDepth bounds how far back a chain of patient merges is followed
+// when verifying a row that was moved between patients.
+const maxMergeDepth = 10
+
+// RecordSigner signs prescriptions and medical records with their doctor's
+// key and verifies them again.
+//
+// A signature covers a canonical serialization of the row's clinical content,
+// a prescription's items included, together with who signed it and when. Lifecycle state that legitimately
+// changes after signing (status, refills used, revocation, the printed
+// verification code) and denormalized names are left out. Patient merges
+// move rows to another patient, so verification also accepts a row signed
+// for a patient whose merge moved it to its current one.
+type RecordSigner struct {
+	keys   *signing.Keystore
+	merges data.PatientMergeRepo
+	log    *log.Helper
+}
+
+func NewRecordSigner(keys *signing.Keystore, merges data.PatientMergeRepo, logger log.Logger) *RecordSigner {
+	return &RecordSigner{
+		keys:   keys,
+		merges: merges,
+		log:    log.NewHelper(logger),
+	}
+}
+
+type canonicalPrescription struct {
+	Kind                   string `json:"kind"`
+	ID                     string `json:"id"`
+	AppointmentID          string `json:"appointment_id"`
+	PatientID              string `json:"patient_id"`
+	DoctorID               string `json:"doctor_id"`
+	Diagnosis              string `json:"diagnosis"`
+	Medications            string `json:"medications"`
+	AdditionalInstructions string `json:"additional_instructions"`
+	PrescriptionDate       string `json:"prescription_date"`
+	ValidUntil             string `json:"valid_until"`
+	RefillsAllowed         int32  `json:"refills_allowed"`
+	RenewedFrom            string `json:"renewed_from"`
+	AmendedFrom            string `json:"amended_from"`
+	AmendmentReason        string `json:"amendment_reason"`
+	SignedBy               string `json:"signed_by"`
+	SignedAt               string `json:"signed_at"`
+	SignatureAlgorithm     string `json:"signature_algorithm"`
+	// Items are the structured medications the prescription is printed and
+	// exported from, in position order.
+	Items []canonicalPrescriptionItem `json:"items"`
+}
+
+type canonicalPrescriptionItem struct {
+	Position       int32  `json:"position"`
+	DrugCode       string `json:"drug_code"`
+	DrugName       string `json:"drug_name"`
+	MedicationName string `json:"medication_name"`
+	DoseAmount     string `json:"dose_amount"`
+	DoseUnit       string `json:"dose_unit"`
+	FrequencyCode  string `json:"frequency_code"`
+	DurationDays   int32  `json:"duration_days"`
+	Route          string `json:"route"`
+	Quantity       int32  `json:"quantity"`
+	Instructions   string `json:"instructions"`
+	DosageText     string `json:"dosage_text"`
+	FrequencyText  string `json:"frequency_text"`
+	DurationText   string `json:"duration_text"`
+}
+
+type canonicalMedicalRecord struct {
+	Kind               string `json:"kind"`
+	ID                 string `json:"id"`
+	PatientID          string `json:"patient_id"`
+	DoctorID           string `json:"doctor_id"`
+	VisitDate          string `json:"visit_date"`
+	RecordType         string `json:"record_type"`
+	Diagnosis          string `json:"diagnosis"`
+	Symptoms           string `json:"symptoms"`
+	Treatment          string `json:"treatment"`
+	Prescriptions      string `json:"prescriptions"`
+	LabResults         string `json:"lab_results"`
+	VitalSigns         string `json:"vital_signs"`
+	Notes              string `json:"notes"`
+	FollowUpDate       string `json:"follow_up_date"`
+	AmendedFrom        string `json:"amended_from"`
+	AmendmentReason    string `json:"amendment_reason"`
+	SignedBy           string `json:"signed_by"`
+	SignedAt           string `json:"signed_at"`
+	SignatureAlgorithm string `json:"signature_algorithm"`
+}
+
+// prescriptionContent is the canonical serialization of a prescription and
+// its items as signed, with patientID standing in for its patient.
+func prescriptionContent(p *entity.Prescription, items []*entity.PrescriptionItem, patientID string) []byte {
+	b, _ := json.Marshal(&canonicalPrescription{
+		Kind:                   "prescription/2",
+		ID:                     p.ID,
+		AppointmentID:          p.AppointmentID,
+		PatientID:              patientID,
+		DoctorID:               p.DoctorID,
+		Diagnosis:              p.Diagnosis,
+		Medications:            p.Medications,
+		AdditionalInstructions: p.AdditionalInstructions,
+		PrescriptionDate:       canonicalTime(&p.PrescriptionDate),
+		ValidUntil:             canonicalTime(&p.ValidUntil),
+		RefillsAllowed:         p.RefillsAllowed,
+		RenewedFrom:            p.RenewedFrom,
+		AmendedFrom:            p.AmendedFrom,
+		AmendmentReason:        p.AmendmentReason,
+		SignedBy:               p.SignedBy,
+		SignedAt:               canonicalTime(p.SignedAt),
+		SignatureAlgorithm:     p.SignatureAlgorithm,
+		Items:                  canonicalItems(items),
+	})
+	return b
+}
+
+// canonicalItems orders items by position. Dose amounts are written with the
+// three decimals the database keeps.
+func canonicalItems(items []*entity.PrescriptionItem) []canonicalPrescriptionItem {
+	ordered := slices.Clone(items)
+	slices.SortStableFunc(ordered, func(a, b *entity.PrescriptionItem) int {
+		return cmp.Compare(a.Position, b.Position)
+	})
+
+	canonical := make([]canonicalPrescriptionItem, 0, len(ordered))
+	for _, item := range ordered {
+		canonical = append(canonical, canonicalPrescriptionItem{
+			Position:       item.Position,
+			DrugCode:       item.DrugCode,
+			DrugName:       item.DrugName,
+			MedicationName: item.MedicationName,
+			DoseAmount:     strconv.FormatFloat(item.DoseAmount, 'f', 3, 64),
+			DoseUnit:       item.DoseUnit,
+			FrequencyCode:  item.FrequencyCode,
+			DurationDays:   item.DurationDays,
+			Route:          item.Route,
+			Quantity:       item.Quantity,
+			Instructions:   item.Instructions,
+			DosageText:     item.DosageText,
+			FrequencyText:  item.FrequencyText,
+			DurationText:   item.DurationText,
+		})
+	}
+	return canonical
+}
+
+// medicalRecordContent is the canonical serialization of a medical record
+// as signed, with patientID standing in for its patient.
+func medicalRecordContent(r *entity.MedicalRecord, patientID string) []byte {
+	b, _ := json.Marshal(&canonicalMedicalRecord{
+		Kind:               "medical_record/1",
+		ID:                 r.ID,
+		PatientID:          patientID,
+		DoctorID:           r.DoctorID,
+		VisitDate:          canonicalTime(&r.VisitDate),
+		RecordType:         r.RecordType,
+		Diagnosis:          r.Diagnosis,
+		Symptoms:           r.Symptoms,
+		Treatment:          r.Treatment,
+		Prescriptions:      r.Prescriptions,
+		LabResults:         r.LabResults,
+		VitalSigns:         r.VitalSigns,
+		Notes:              r.Notes,
+		FollowUpDate:       canonicalTime(r.FollowUpDate),
+		AmendedFrom:        r.AmendedFrom,
+		AmendmentReason:    r.AmendmentReason,
+		SignedBy:           r.SignedBy,
+		SignedAt:           canonicalTime(r.SignedAt),
+		SignatureAlgorithm: r.SignatureAlgorithm,
+	})
+	return b
+}
+
+// canonicalTime formats t to the second in UTC, the precision the database
+// keeps.
+func canonicalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// sign fills in sig as signerID's signature made now. content renders the
+// row once the signature metadata is in place.
+func (s *RecordSigner) sign(sig *entity.Signature, signerID string, now time.Time, content func() []byte) error {
+	signedAt := now.Truncate(time.Second)
+	sig.SignedBy = signerID
+	sig.SignedAt = &signedAt
+	sig.SignatureAlgorithm = signing.Algorithm
+
+	signature, err := s.keys.Sign(signerID, content())
+	if err != nil {
+		*sig = entity.Signature{}
+		return fmt.Errorf("failed to sign as %s: %w", signerID, err)
+	}
+	sig.SignatureKeyID = signature.KeyID
+	sig.SignatureValue = signature.Value
+	return nil
+}
+
+// verify checks the signature on the row id of table, currently belonging to
+// patientID. content renders the row for a given patient.
+func (s *RecordSigner) verify(ctx context.Context, table, resourceType, id, patientID string, sig entity.Signature, content func(patientID string) []byte) (*SignatureVerification, error) {
+	verification := &SignatureVerification{
+		ResourceType: resourceType,
+		ResourceID:   id,
+		Signed:       sig.Signed(),
+	}
+	if !sig.Signed() {
+		verification.Problem = "record is not signed"
+		return verification, nil
+	}
+	verification.SignedBy = sig.SignedBy
+	verification.Algorithm = sig.SignatureAlgorithm
+	verification.KeyID = sig.SignatureKeyID
+	if sig.SignedAt != nil {
+		verification.SignedAt = formatTimestamp(*sig.SignedAt)
+	}
+
+	signature := &signing.Signature{
+		Algorithm: sig.SignatureAlgorithm,
+		KeyID:     sig.SignatureKeyID,
+		Value:     sig.SignatureValue,
+	}
+	err := s.keys.Verify(sig.SignedBy, content(patientID), signature)
+	if errors.Is(err, signing.ErrBadSignature) {
+		former, ferr := s.formerPatients(ctx, table, id, patientID)
+		if ferr != nil {
+			return nil, ferr
+		}
+		for _, candidate := range former {
+			if s.keys.Verify(sig.SignedBy, content(candidate), signature) == nil {
+				verification.SignedPatientID = candidate
+				err = nil
+				break
+			}
+		}
+	}
+	if err != nil {
+		verification.Problem = err.Error()
+		return verification, nil
+	}
+	verification.Valid = true
+	return verification, nil
+}
+
+// formerPatients lists the patients the row belonged to before merges moved
+// it to patientID, most recent first.
+func (s *RecordSigner) formerPatients(ctx context.Context, table, id, patientID string) ([]string, error) {
+	var former []string
+	current := patientID
+	for len(former) < maxMergeDepth {
+		merges, err := s.merges.ListByPatient(ctx, current)
+		if err != nil {
+			s.log.WithContext(ctx).Errorf("Failed to list patient merges: %v", err)
+			return nil, fmt.Errorf("failed to list patient merges: %w", err)
+		}
+
+		previous := ""
+		for _, m := range merges {
+			if m.SurvivorID != current || m.MovedRecords == "" {
+				continue
+			}
+			var moved map[string][]string
+			if err := json.Unmarshal([]byte(m.MovedRecords), &moved); err != nil {
+				continue
+			}
+			if slices.Contains(moved[table], id) {
+				previous = m.MergedID
+				break
+			}
+		}
+		if previous == "" || previous == patientID || slices.Contains(former, previous) {
+			break
+		}
+		former = append(former, previous)
+		current = previous
+	}
+	return former, nil
+}
@@ -0,0 +1,265 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/arm-1234/medical-service/internal/pkg/video"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+type VideoJoinInfo struct {
+	AppointmentID string `json:"appointment_id"`
+	SessionID     string `json:"session_id"`
+	Provider      string `json:"provider"`
+	Role          string `json:"role"`
+	JoinURL       string `json:"join_url"`
+	Token         string `json:"token"`
+	ExpiresAt     string `json:"expires_at"`
+}
+
+// ReissueJoinKeyRequest asks for a participant's join key again. Token is the
+// reissue token configured for trusted clients.
+type ReissueJoinKeyRequest struct {
+	AppointmentID string `json:"-"`
+	ParticipantID string `json:"participant_id"`
+	Token         string `json:"-"`
+}
+
+type VideoJoinKey struct {
+	AppointmentID string `json:"appointment_id"`
+	Role          string `json:"role"`
+	Key           string `json:"key"`
+	ExpiresAt     string `json:"expires_at"`
+}
+
+// Reply headers carrying the join keys of a newly booked or rescheduled video
+// appointment.
+const (
+	patientJoinKeyHeader = "X-Video-Patient-Key"
+	doctorJoinKeyHeader  = "X-Video-Doctor-Key"
+)
+
+// joinKeyGrace is how long after the appointment's scheduled end its join
+// keys keep working, for consultations that overrun.
+const joinKeyGrace = time.Hour
+
+func joinKeyExpiry(appointment *entity.Appointment) time.Time {
+	return appointment.EndsAt.Add(joinKeyGrace)
+}
+
+// issueJoinKeys hands out the patient's and the doctor's join keys for a
+// video appointment through the reply headers of the booking or reschedule.
+// The client passes each key on to its participant only. Appointments booked
+// without an HTTP caller, such as over HL7, get their keys through
+// ReissueJoinKey.
+func (h *AppointmentHandler) issueJoinKeys(ctx context.Context, appointment *entity.Appointment) {
+	tr, ok := transport.FromServerContext(ctx)
+	if !ok {
+		h.log.WithContext(ctx).Infof("Join keys for appointment %s are available through re-issue only", appointment.ID)
+		return
+	}
+	expiresAt := joinKeyExpiry(appointment)
+	tr.ReplyHeader().Set(patientJoinKeyHeader, h.joinKeys.Issue(appointment.ID, appointment.PatientID, video.RolePatient, expiresAt))
+	tr.ReplyHeader().Set(doctorJoinKeyHeader, h.joinKeys.Issue(appointment.ID, appointment.DoctorID, video.RoleDoctor, expiresAt))
+}
+
+// ReissueJoinKey returns one participant's join key for a video appointment,
+// for participants whose key was lost or never delivered. Only clients with
+// the reissue token may call it, and only for the appointment's own patient
+// or doctor.
+func (h *AppointmentHandler) ReissueJoinKey(ctx context.Context, req *ReissueJoinKeyRequest) (*VideoJoinKey, error) {
+	ctx, span := otel.Trace(ctx, "AppointmentHandler.ReissueJoinKey")
+	defer span.End()
+
+	if err := h.joinKeys.AuthorizeReissue(req.Token); err != nil {
+		h.log.WithContext(ctx).Errorf("Rejected join key re-issue for appointment %s: %v", req.AppointmentID, err)
+		return nil, fmt.Errorf("not authorized to re-issue join keys")
+	}
+	if req.AppointmentID == "" || req.ParticipantID == "" {
+		h.log.WithContext(ctx).Errorf("Appointment ID and participant ID are required")
+		return nil, fmt.Errorf("appointment_id and participant_id are required")
+	}
+
+	appointment, err := h.repo.Get(ctx, req.AppointmentID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get appointment: %v", err)
+		return nil, fmt.Errorf("failed to get appointment: %w", err)
+	}
+	if appointment == nil {
+		h.log.WithContext(ctx).Errorf("Appointment not found: %s", req.AppointmentID)
+		return nil, fmt.Errorf("appointment not found")
+	}
+	if appointment.ConsultationType != entity.ConsultationTypeVideo {
+		h.log.WithContext(ctx).Errorf("Appointment is not a video consultation: %s", req.AppointmentID)
+		return nil, fmt.Errorf("appointment is not a video consultation")
+	}
+	if appointment.Status == entity.AppointmentStatusCancelled || appointment.Status == entity.AppointmentStatusCompleted {
+		h.log.WithContext(ctx).Errorf("Cannot re-issue join key for appointment %s with status %d", req.AppointmentID, appointment.Status)
+		return nil, fmt.Errorf("appointment is no longer active")
+	}
+
+	var role video.Role
+	switch req.ParticipantID {
+	case appointment.PatientID:
+		role = video.RolePatient
+	case appointment.DoctorID:
+		role = video.RoleDoctor
+	default:
+		h.log.WithContext(ctx).Errorf("Participant %s is not part of appointment %s", req.ParticipantID, req.AppointmentID)
+		return nil, fmt.Errorf("participant is not part of this appointment")
+	}
+
+	expiresAt := joinKeyExpiry(appointment)
+	if !time.Now().Before(expiresAt) {
+		h.log.WithContext(ctx).Errorf("Appointment %s has ended", req.AppointmentID)
+		return nil, fmt.Errorf("appointment has ended")
+	}
+
+	return &VideoJoinKey{
+		AppointmentID: appointment.ID,
+		Role:          string(role),
+		Key:           h.joinKeys.Issue(appointment.ID, req.ParticipantID, role, expiresAt),
+		ExpiresAt:     formatTimestamp(expiresAt),
+	}, nil
+}
+
+// GetVideoJoinInfo returns the join link and a personal token for a video
+// appointment. Only the appointment's patient and doctor may join, each with
+// an unexpired join key issued to them.
+func (h *AppointmentHandler) GetVideoJoinInfo(ctx context.Context, appointmentID, joinKey string) (*VideoJoinInfo, error) {
+	ctx, span := otel.Trace(ctx, "AppointmentHandler.GetVideoJoinInfo")
+	defer span.End()
+
+	if appointmentID == "" || joinKey == "" {
+		h.log.WithContext(ctx).Errorf("Appointment ID and join key are required")
+		return nil, fmt.Errorf("appointment_id and key are required")
+	}
+
+	participant, err := h.joinKeys.Verify(appointmentID, joinKey, time.Now())
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Rejected join key for appointment %s: %v", appointmentID, err)
+		return nil, fmt.Errorf("invalid join key")
+	}
+
+	appointment, err := h.repo.Get(ctx, appointmentID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get appointment: %v", err)
+		return nil, fmt.Errorf("failed to get appointment: %w", err)
+	}
+	if appointment == nil {
+		h.log.WithContext(ctx).Errorf("Appointment not found: %s", appointmentID)
+		return nil, fmt.Errorf("appointment not found")
+	}
+
+	// A key stops working once its holder is no longer on the appointment.
+	switch {
+	case participant.Role == video.RolePatient && participant.ID == appointment.PatientID:
+		participant.Name = appointment.PatientName
+	case participant.Role == video.RoleDoctor && participant.ID == appointment.DoctorID:
+		participant.Name = appointment.DoctorName
+	default:
+		h.log.WithContext(ctx).Errorf("Participant %s is not part of appointment %s", participant.ID, appointmentID)
+		return nil, fmt.Errorf("participant is not part of this appointment")
+	}
+
+	if appointment.ConsultationType != entity.ConsultationTypeVideo {
+		h.log.WithContext(ctx).Errorf("Appointment is not a video consultation: %s", appointmentID)
+		return nil, fmt.Errorf("appointment is not a video consultation")
+	}
+	if appointment.Status == entity.AppointmentStatusCancelled || appointment.Status == entity.AppointmentStatusCompleted {
+		h.log.WithContext(ctx).Errorf("Cannot join appointment %s with status %d", appointmentID, appointment.Status)
+		return nil, fmt.Errorf("appointment is no longer active")
+	}
+
+	session, err := h.videoRepo.GetByAppointment(ctx, appointmentID)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get video session: %v", err)
+		return nil, fmt.Errorf("failed to get video session: %w", err)
+	}
+	// Provisioning at booking time is best effort; sessions that failed to
+	// provision then are created on first join.
+	if session == nil || session.Status != entity.VideoSessionStatusActive {
+		if session, err = h.provisionVideo(ctx, appointment); err != nil {
+			h.log.WithContext(ctx).Errorf("Failed to provision video session: %v", err)
+			return nil, fmt.Errorf("failed to provision video session: %w", err)
+		}
+	}
+
+	token, err := h.video.IssueToken(ctx, session.ProviderSessionID, participant)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to issue video token: %v", err)
+		return nil, fmt.Errorf("failed to issue video token: %w", err)
+	}
+
+	return &VideoJoinInfo{
+		AppointmentID: appointment.ID,
+		SessionID:     session.ID,
+		Provider:      session.Provider,
+		Role:          string(participant.Role),
+		JoinURL:       token.JoinURL,
+		Token:         token.Value,
+		ExpiresAt:     formatTimestamp(token.ExpiresAt),
+	}, nil
+}
+
+// provisionVideo creates a provider session for a video appointment, replacing
+// the appointment's previous session if there was one.
+func (h *AppointmentHandler) provisionVideo(ctx context.Context, appointment *entity.Appointment) (*entity.VideoSession, error) {
+	created, err := h.video.CreateSession(ctx, &video.SessionRequest{
+		AppointmentID: appointment.ID,
+		Title:         fmt.Sprintf("Consultation with %s", appointment.DoctorName),
+		StartsAt:      appointment.StartsAt,
+		EndsAt:        appointment.EndsAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := h.videoRepo.GetByAppointment(ctx, appointment.ID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		session = &entity.VideoSession{AppointmentID: appointment.ID}
+	}
+	session.Provider = h.video.Name()
+	session.ProviderSessionID = created.ID
+	session.JoinURL = created.JoinURL
+	session.Status = entity.VideoSessionStatusActive
+	session.EndedAt = nil
+
+	if session.ID == "" {
+		err = h.videoRepo.Create(ctx, session)
+	} else {
+		err = h.videoRepo.Update(ctx, session)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// endVideo tears down the appointment's active video session, if any.
+func (h *AppointmentHandler) endVideo(ctx context.Context, appointment *entity.Appointment) error {
+	session, err := h.videoRepo.GetByAppointment(ctx, appointment.ID)
+	if err != nil {
+		return err
+	}
+	if session == nil || session.Status != entity.VideoSessionStatusActive {
+		return nil
+	}
+
+	if err := h.video.EndSession(ctx, session.ProviderSessionID); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	session.Status = entity.VideoSessionStatusEnded
+	session.EndedAt = &now
+	return h.videoRepo.Update(ctx, session)
+}
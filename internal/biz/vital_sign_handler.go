@@ -0,0 +1,314 @@
+package biz
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/arm-1234/medical-service/internal/pkg/vitals"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// defaultVitalWindow is how far back a vital signs series reaches when no
+// start is given.
+const defaultVitalWindow = 90 * 24 * time.Hour
+
+type VitalSignHandler struct {
+	repo        data.VitalSignRepo
+	patientRepo data.PatientRepo
+	ranges      *vitals.Ranges
+	access      *AccessAuditor
+	log         *log.Helper
+}
+
+func NewVitalSignHandler(repo data.VitalSignRepo, patientRepo data.PatientRepo, ranges *vitals.Ranges, access *AccessAuditor, logger log.Logger) *VitalSignHandler {
+	return &VitalSignHandler{
+		repo:        repo,
+		patientRepo: patientRepo,
+		ranges:      ranges,
+		access:      access,
+		log:         log.NewHelper(logger),
+	}
+}
+
+// VitalObservationInput is a measured value in unit, or in the vital sign's
+// own unit when unit is empty.
+type VitalObservationInput struct {
+	Code  string  `json:"code"`
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// RecordVitalsRequest records vital signs measured outside a medical record,
+// such as at triage. ObservedAt defaults to now.
+type RecordVitalsRequest struct {
+	PatientID    string                   `json:"patient_id"`
+	ObservedAt   string                   `json:"observed_at"`
+	RecordedBy   string                   `json:"recorded_by"`
+	Observations []*VitalObservationInput `json:"observations"`
+}
+
+type VitalObservation struct {
+	Code            string  `json:"code"`
+	Value           float64 `json:"value"`
+	Unit            string  `json:"unit"`
+	ObservedAt      string  `json:"observed_at"`
+	Flag            string  `json:"flag,omitempty"`
+	RecordedBy      string  `json:"recorded_by,omitempty"`
+	MedicalRecordID string  `json:"medical_record_id,omitempty"`
+}
+
+type RecordVitalsResponse struct {
+	PatientID    string              `json:"patient_id"`
+	Observations []*VitalObservation `json:"observations"`
+}
+
+// VitalSeriesRequest selects a patient's vital signs. Codes is a comma
+// separated list and defaults to every vital sign; From and To are RFC3339
+// timestamps or YYYY-MM-DD days and default to the last 90 days.
+type VitalSeriesRequest struct {
+	PatientID string `json:"patient_id"`
+	Codes     string `json:"codes"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+type VitalReferenceRange struct {
+	Low          float64 `json:"low,omitempty"`
+	High         float64 `json:"high,omitempty"`
+	CriticalLow  float64 `json:"critical_low,omitempty"`
+	CriticalHigh float64 `json:"critical_high,omitempty"`
+}
+
+// VitalSeries is one vital sign over the window, oldest observation first,
+// with its statistics over the window.
+type VitalSeries struct {
+	Code           string               `json:"code"`
+	Unit           string               `json:"unit"`
+	ReferenceRange *VitalReferenceRange `json:"reference_range,omitempty"`
+	Count          int                  `json:"count"`
+	Min            float64              `json:"min"`
+	Max            float64              `json:"max"`
+	Avg            float64              `json:"avg"`
+	AbnormalCount  int                  `json:"abnormal_count"`
+	Latest         *VitalObservation    `json:"latest"`
+	Points         []*VitalObservation  `json:"points"`
+}
+
+type VitalSeriesResponse struct {
+	PatientID string         `json:"patient_id"`
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Series    []*VitalSeries `json:"series"`
+}
+
+// RecordVitals stores a set of observations taken together. A BMI is
+// derived when a weight is recorded, using the height recorded with it or
+// else the patient's latest height.
+func (h *VitalSignHandler) RecordVitals(ctx context.Context, req *RecordVitalsRequest) (*RecordVitalsResponse, error) {
+	ctx, span := otel.Trace(ctx, "VitalSignHandler.RecordVitals")
+	defer span.End()
+
+	if len(req.Observations) == 0 {
+		h.log.WithContext(ctx).Errorf("No vital signs to record")
+		return nil, fmt.Errorf("observations are required")
+	}
+	patient, err := h.getPatient(ctx, req.PatientID)
+	if err != nil {
+		return nil, err
+	}
+
+	observedAt := time.Now().UTC().Truncate(time.Second)
+	if req.ObservedAt != "" {
+		if observedAt, err = parseRecordTime(req.ObservedAt); err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid observation time: %v", err)
+			return nil, fmt.Errorf("invalid observed_at: %w", err)
+		}
+	}
+
+	var signs []*entity.VitalSign
+	values := make(map[string]float64)
+	for _, o := range req.Observations {
+		sign := vitals.Lookup(o.Code)
+		if sign == nil {
+			h.log.WithContext(ctx).Errorf("Unknown vital sign: %s", o.Code)
+			return nil, fmt.Errorf("unknown vital sign %q", o.Code)
+		}
+		if _, ok := values[sign.Code]; ok {
+			h.log.WithContext(ctx).Errorf("Vital sign recorded twice: %s", sign.Code)
+			return nil, fmt.Errorf("%s is recorded more than once", sign.Code)
+		}
+		value, err := sign.Normalize(o.Value, o.Unit)
+		if err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid vital sign: %v", err)
+			return nil, err
+		}
+		values[sign.Code] = value
+		signs = append(signs, h.newVitalSign(patient.ID, sign, value, observedAt, req.RecordedBy))
+	}
+
+	if weight, ok := values[vitals.Weight]; ok {
+		height, ok := values[vitals.Height]
+		if !ok {
+			latest, err := h.repo.Latest(ctx, patient.ID, vitals.Height, observedAt)
+			if err != nil {
+				h.log.WithContext(ctx).Errorf("Failed to get latest height: %v", err)
+				return nil, fmt.Errorf("failed to get latest height: %w", err)
+			}
+			if latest != nil {
+				height = latest.Value
+			}
+		}
+		if height > 0 {
+			signs = append(signs, h.newVitalSign(patient.ID, vitals.Lookup(vitals.BMI), vitals.DeriveBMI(weight, height), observedAt, req.RecordedBy))
+		}
+	}
+
+	if err := h.repo.Create(ctx, signs); err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to record vital signs: %v", err)
+		return nil, fmt.Errorf("failed to record vital signs: %w", err)
+	}
+
+	resp := &RecordVitalsResponse{PatientID: patient.ID}
+	for _, s := range signs {
+		resp.Observations = append(resp.Observations, h.toObservation(s))
+	}
+	return resp, nil
+}
+
+// GetVitalSeries returns a patient's vital signs over a window as one series
+// per vital sign, each point flagged against the configured reference range.
+func (h *VitalSignHandler) GetVitalSeries(ctx context.Context, req *VitalSeriesRequest) (*VitalSeriesResponse, error) {
+	ctx, span := otel.Trace(ctx, "VitalSignHandler.GetVitalSeries")
+	defer span.End()
+
+	patient, err := h.getPatient(ctx, req.PatientID)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	for _, code := range strings.Split(req.Codes, ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		if vitals.Lookup(code) == nil {
+			h.log.WithContext(ctx).Errorf("Unknown vital sign: %s", code)
+			return nil, fmt.Errorf("unknown vital sign %q", code)
+		}
+		codes = append(codes, code)
+	}
+
+	to := time.Now().UTC().Truncate(time.Second)
+	if req.To != "" {
+		if to, err = parseRecordTime(req.To); err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid series end: %v", err)
+			return nil, fmt.Errorf("invalid to: %w", err)
+		}
+		if len(req.To) == len(dateLayout) {
+			to = to.Add(24*time.Hour - time.Second)
+		}
+	}
+	from := to.Add(-defaultVitalWindow)
+	if req.From != "" {
+		if from, err = parseRecordTime(req.From); err != nil {
+			h.log.WithContext(ctx).Errorf("Invalid series start: %v", err)
+			return nil, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if from.After(to) {
+		h.log.WithContext(ctx).Errorf("Series start %s is after its end %s", from, to)
+		return nil, fmt.Errorf("from must not be after to")
+	}
+
+	signs, err := h.repo.GetSeries(ctx, patient.ID, codes, from, to)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get vital signs: %v", err)
+		return nil, fmt.Errorf("failed to get vital signs: %w", err)
+	}
+	h.access.Record(ctx, patient.ID, accessVitalSigns, "")
+
+	byCode := make(map[string]*VitalSeries)
+	for _, s := range signs {
+		series, ok := byCode[s.Code]
+		if !ok {
+			series = &VitalSeries{Code: s.Code, Unit: s.Unit, Min: s.Value, Max: s.Value}
+			byCode[s.Code] = series
+		}
+		point := h.toObservation(s)
+		series.Points = append(series.Points, point)
+		series.Count++
+		series.Min = math.Min(series.Min, s.Value)
+		series.Max = math.Max(series.Max, s.Value)
+		series.Avg += s.Value
+		series.Latest = point
+		if point.Flag != "" {
+			series.AbnormalCount++
+		}
+	}
+
+	resp := &VitalSeriesResponse{
+		PatientID: patient.ID,
+		From:      formatTimestamp(from),
+		To:        formatTimestamp(to),
+	}
+	for _, sign := range vitals.Signs {
+		series, ok := byCode[sign.Code]
+		if !ok {
+			continue
+		}
+		series.Avg = math.Round(series.Avg/float64(series.Count)*100) / 100
+		if rng, ok := h.ranges.Get(sign.Code); ok {
+			series.ReferenceRange = &VitalReferenceRange{
+				Low:          rng.Low,
+				High:         rng.High,
+				CriticalLow:  rng.CriticalLow,
+				CriticalHigh: rng.CriticalHigh,
+			}
+		}
+		resp.Series = append(resp.Series, series)
+	}
+	return resp, nil
+}
+
+func (h *VitalSignHandler) getPatient(ctx context.Context, id string) (*entity.Patient, error) {
+	patient, err := h.patientRepo.Get(ctx, id)
+	if err != nil {
+		h.log.WithContext(ctx).Errorf("Failed to get patient: %v", err)
+		return nil, fmt.Errorf("failed to get patient: %w", err)
+	}
+	if patient == nil {
+		h.log.WithContext(ctx).Errorf("Patient not found: %s", id)
+		return nil, fmt.Errorf("patient not found")
+	}
+	return patient, nil
+}
+
+func (h *VitalSignHandler) newVitalSign(patientID string, sign *vitals.Sign, value float64, observedAt time.Time, recordedBy string) *entity.VitalSign {
+	return &entity.VitalSign{
+		PatientID:  patientID,
+		Code:       sign.Code,
+		ObservedAt: observedAt,
+		Value:      value,
+		Unit:       sign.Unit,
+		RecordedBy: recordedBy,
+	}
+}
+
+func (h *VitalSignHandler) toObservation(s *entity.VitalSign) *VitalObservation {
+	return &VitalObservation{
+		Code:            s.Code,
+		Value:           s.Value,
+		Unit:            s.Unit,
+		ObservedAt:      formatTimestamp(s.ObservedAt),
+		Flag:            h.ranges.Flag(s.Code, s.Value),
+		RecordedBy:      s.RecordedBy,
+		MedicalRecordID: s.MedicalRecordID,
+	}
+}
@@ -0,0 +1,249 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DoctorDay identifies one doctor's calendar day in the analytics rollups.
+type DoctorDay struct {
+	DoctorID string
+	Day      string
+}
+
+type AnalyticsRepo interface {
+	GetRefresh(ctx context.Context, name string) (*entity.AnalyticsRefresh, error)
+	SetRefresh(ctx context.Context, name string, watermark time.Time) error
+	ListChangedAppointmentDays(ctx context.Context, since time.Time) ([]DoctorDay, error)
+	GetDoctorDayAppointments(ctx context.Context, doctorID, day string) ([]*entity.Appointment, error)
+	ReplaceDoctorDay(ctx context.Context, key DoctorDay, row *entity.AnalyticsDoctorDay, hours []*entity.AnalyticsDoctorHour, members []*entity.AnalyticsAppointmentDay) error
+	ListChangedPrescriptions(ctx context.Context, since time.Time) ([]*entity.Prescription, error)
+	GetDoctorPrescriptions(ctx context.Context, doctorID string, from, to time.Time) ([]*entity.Prescription, error)
+	ReplaceMedicationDay(ctx context.Context, key DoctorDay, rows []*entity.AnalyticsMedicationDay) error
+	ListDoctorDays(ctx context.Context, filters map[string]interface{}) ([]*entity.AnalyticsDoctorDay, error)
+	ListDoctorHours(ctx context.Context, filters map[string]interface{}) ([]*entity.AnalyticsDoctorHour, error)
+	ListMedicationDays(ctx context.Context, filters map[string]interface{}) ([]*entity.AnalyticsMedicationDay, error)
+}
+
+type analyticsRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewAnalyticsRepo(data *Data, logger log.Logger) AnalyticsRepo {
+	return &analyticsRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *analyticsRepo) GetRefresh(ctx context.Context, name string) (*entity.AnalyticsRefresh, error) {
+	var refreshes []*entity.AnalyticsRefresh
+
+	if err := r.data.DB(ctx).Where("name = ?", name).Limit(1).Find(&refreshes).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get analytics refresh: %v", err)
+		return nil, err
+	}
+	if len(refreshes) == 0 {
+		return nil, nil
+	}
+	return refreshes[0], nil
+}
+
+func (r *analyticsRepo) SetRefresh(ctx context.Context, name string, watermark time.Time) error {
+	refresh := &entity.AnalyticsRefresh{Name: name, Watermark: watermark}
+	err := r.data.DB(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"watermark", "updated_at"}),
+	}).Create(refresh).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to set analytics refresh: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ListChangedAppointmentDays returns the doctor-days whose rollups are out of
+// date because of appointments changed since the given time: the day each
+// such appointment is on now, and the day it was last rolled up under.
+func (r *analyticsRepo) ListChangedAppointmentDays(ctx context.Context, since time.Time) ([]DoctorDay, error) {
+	changed := r.data.db.Model(&entity.Appointment{}).Select("id").Where("updated_at >= ?", since)
+
+	var current []DoctorDay
+	err := r.data.DB(ctx).Model(&entity.Appointment{}).
+		Distinct("doctor_id", "appointment_date AS day").
+		Where("updated_at >= ?", since).
+		Scan(&current).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list changed appointment days: %v", err)
+		return nil, err
+	}
+
+	var previous []DoctorDay
+	err = r.data.DB(ctx).Model(&entity.AnalyticsAppointmentDay{}).
+		Distinct("doctor_id", "day").
+		Where("appointment_id IN (?)", changed).
+		Scan(&previous).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list previous appointment days: %v", err)
+		return nil, err
+	}
+
+	return append(current, previous...), nil
+}
+
+func (r *analyticsRepo) GetDoctorDayAppointments(ctx context.Context, doctorID, day string) ([]*entity.Appointment, error) {
+	var appointments []*entity.Appointment
+
+	if err := r.data.DB(ctx).Where("doctor_id = ? AND appointment_date = ?", doctorID, day).Find(&appointments).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get doctor day appointments: %v", err)
+		return nil, err
+	}
+	return appointments, nil
+}
+
+// ReplaceDoctorDay swaps the appointment rollups of a doctor-day for the
+// given ones. row is nil when the doctor has no appointments that day.
+// Members take over any appointment previously rolled up under another day.
+func (r *analyticsRepo) ReplaceDoctorDay(ctx context.Context, key DoctorDay, row *entity.AnalyticsDoctorDay, hours []*entity.AnalyticsDoctorHour, members []*entity.AnalyticsAppointmentDay) error {
+	return r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doctor_id = ? AND day = ?", key.DoctorID, key.Day).Delete(&entity.AnalyticsDoctorDay{}).Error; err != nil {
+			r.log.WithContext(ctx).Errorf("failed to clear analytics doctor day: %v", err)
+			return err
+		}
+		if err := tx.Where("doctor_id = ? AND day = ?", key.DoctorID, key.Day).Delete(&entity.AnalyticsDoctorHour{}).Error; err != nil {
+			r.log.WithContext(ctx).Errorf("failed to clear analytics doctor hours: %v", err)
+			return err
+		}
+		if err := tx.Where("doctor_id = ? AND day = ?", key.DoctorID, key.Day).Delete(&entity.AnalyticsAppointmentDay{}).Error; err != nil {
+			r.log.WithContext(ctx).Errorf("failed to clear analytics appointment days: %v", err)
+			return err
+		}
+
+		if row != nil {
+			if err := tx.Create(row).Error; err != nil {
+				r.log.WithContext(ctx).Errorf("failed to save analytics doctor day: %v", err)
+				return err
+			}
+		}
+		if len(hours) > 0 {
+			if err := tx.Create(hours).Error; err != nil {
+				r.log.WithContext(ctx).Errorf("failed to save analytics doctor hours: %v", err)
+				return err
+			}
+		}
+		if len(members) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "appointment_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"doctor_id", "day"}),
+			}).Create(members).Error
+			if err != nil {
+				r.log.WithContext(ctx).Errorf("failed to save analytics appointment days: %v", err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListChangedPrescriptions returns the prescriptions written since the given
+// time. Only the columns needed to find their rollup day are loaded.
+func (r *analyticsRepo) ListChangedPrescriptions(ctx context.Context, since time.Time) ([]*entity.Prescription, error) {
+	var prescriptions []*entity.Prescription
+
+	err := r.data.DB(ctx).Select("id", "doctor_id", "prescription_date", "amended_from").
+		Where("created_at >= ?", since).
+		Find(&prescriptions).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list changed prescriptions: %v", err)
+		return nil, err
+	}
+	return prescriptions, nil
+}
+
+// GetDoctorPrescriptions returns the doctor's prescriptions dated in
+// [from, to).
+func (r *analyticsRepo) GetDoctorPrescriptions(ctx context.Context, doctorID string, from, to time.Time) ([]*entity.Prescription, error) {
+	var prescriptions []*entity.Prescription
+
+	err := r.data.DB(ctx).
+		Where("doctor_id = ? AND prescription_date >= ? AND prescription_date < ?", doctorID, from, to).
+		Find(&prescriptions).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get doctor prescriptions: %v", err)
+		return nil, err
+	}
+	return prescriptions, nil
+}
+
+func (r *analyticsRepo) ReplaceMedicationDay(ctx context.Context, key DoctorDay, rows []*entity.AnalyticsMedicationDay) error {
+	return r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doctor_id = ? AND day = ?", key.DoctorID, key.Day).Delete(&entity.AnalyticsMedicationDay{}).Error; err != nil {
+			r.log.WithContext(ctx).Errorf("failed to clear analytics medication day: %v", err)
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.Create(rows).Error; err != nil {
+				r.log.WithContext(ctx).Errorf("failed to save analytics medication day: %v", err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *analyticsRepo) ListDoctorDays(ctx context.Context, filters map[string]interface{}) ([]*entity.AnalyticsDoctorDay, error) {
+	var days []*entity.AnalyticsDoctorDay
+
+	if err := r.rollupQuery(ctx, filters).Order("day ASC, doctor_id ASC").Find(&days).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list analytics doctor days: %v", err)
+		return nil, err
+	}
+	return days, nil
+}
+
+func (r *analyticsRepo) ListDoctorHours(ctx context.Context, filters map[string]interface{}) ([]*entity.AnalyticsDoctorHour, error) {
+	var hours []*entity.AnalyticsDoctorHour
+
+	if err := r.rollupQuery(ctx, filters).Find(&hours).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list analytics doctor hours: %v", err)
+		return nil, err
+	}
+	return hours, nil
+}
+
+func (r *analyticsRepo) ListMedicationDays(ctx context.Context, filters map[string]interface{}) ([]*entity.AnalyticsMedicationDay, error) {
+	var days []*entity.AnalyticsMedicationDay
+
+	if err := r.rollupQuery(ctx, filters).Find(&days).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list analytics medication days: %v", err)
+		return nil, err
+	}
+	return days, nil
+}
+
+// rollupQuery applies the report filters shared by every rollup table. A
+// doctor_ids filter that is present but empty matches nothing.
+func (r *analyticsRepo) rollupQuery(ctx context.Context, filters map[string]interface{}) *gorm.DB {
+	query := r.data.DB(ctx)
+
+	if fromDate, ok := filters["from_date"].(string); ok && fromDate != "" {
+		query = query.Where("day >= ?", fromDate)
+	}
+	if toDate, ok := filters["to_date"].(string); ok && toDate != "" {
+		query = query.Where("day <= ?", toDate)
+	}
+	if doctorIDs, ok := filters["doctor_ids"].([]string); ok {
+		if len(doctorIDs) == 0 {
+			query = query.Where("1 = 0")
+		} else {
+			query = query.Where("doctor_id IN ?", doctorIDs)
+		}
+	}
+	return query
+}
@@ -16,8 +16,9 @@ type AppointmentRepo interface {
 	Update(ctx context.Context, appointment *entity.Appointment) error
 	GetByPatientID(ctx context.Context, patientID string, filters map[string]interface{}) ([]*entity.Appointment, error)
 	GetByDoctorID(ctx context.Context, doctorID string, filters map[string]interface{}) ([]*entity.Appointment, error)
-	GetByDoctorAndDate(ctx context.Context, doctorID string, date string) ([]*entity.Appointment, error)
-	CheckConflict(ctx context.Context, doctorID, date, time string, excludeID string) (*entity.Appointment, error)
+	GetByDoctorInRange(ctx context.Context, doctorID string, from, to time.Time) ([]*entity.Appointment, error)
+	GetByDoctorsInRange(ctx context.Context, doctorIDs []string, from, to time.Time) ([]*entity.Appointment, error)
+	CheckConflict(ctx context.Context, doctorID string, startsAt, endsAt time.Time, excludeID string) (*entity.Appointment, error)
 }
 
 type appointmentRepo struct {
@@ -37,7 +38,7 @@ func (r *appointmentRepo) Create(ctx context.Context, appointment *entity.Appoin
 		appointment.ID = uuid.New().String()
 	}
 
-	if err := r.data.db.WithContext(ctx).Create(appointment).Error; err != nil {
+	if err := r.data.DB(ctx).Create(appointment).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to create appointment: %v", err)
 		return err
 	}
@@ -49,7 +50,7 @@ func (r *appointmentRepo) Create(ctx context.Context, appointment *entity.Appoin
 func (r *appointmentRepo) Get(ctx context.Context, id string) (*entity.Appointment, error) {
 	var appointment entity.Appointment
 
-	if err := r.data.db.WithContext(ctx).Where("id = ?", id).First(&appointment).Error; err != nil {
+	if err := r.data.DB(ctx).Where("id = ?", id).First(&appointment).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -61,7 +62,7 @@ func (r *appointmentRepo) Get(ctx context.Context, id string) (*entity.Appointme
 }
 
 func (r *appointmentRepo) Update(ctx context.Context, appointment *entity.Appointment) error {
-	if err := r.data.db.WithContext(ctx).Save(appointment).Error; err != nil {
+	if err := r.data.DB(ctx).Save(appointment).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to update appointment: %v", err)
 		return err
 	}
@@ -72,7 +73,7 @@ func (r *appointmentRepo) Update(ctx context.Context, appointment *entity.Appoin
 
 func (r *appointmentRepo) GetByPatientID(ctx context.Context, patientID string, filters map[string]interface{}) ([]*entity.Appointment, error) {
 	var appointments []*entity.Appointment
-	query := r.data.db.WithContext(ctx).Where("patient_id = ?", patientID)
+	query := r.data.DB(ctx).Where("patient_id = ?", patientID)
 
 	if status, ok := filters["status"].(int32); ok && status > 0 {
 		query = query.Where("status = ?", status)
@@ -84,7 +85,7 @@ func (r *appointmentRepo) GetByPatientID(ctx context.Context, patientID string,
 		query = query.Where("appointment_date <= ?", toDate)
 	}
 
-	query = query.Order("appointment_date DESC, appointment_time DESC")
+	query = query.Order("starts_at DESC")
 
 	if err := query.Find(&appointments).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to get patient appointments: %v", err)
@@ -96,7 +97,7 @@ func (r *appointmentRepo) GetByPatientID(ctx context.Context, patientID string,
 
 func (r *appointmentRepo) GetByDoctorID(ctx context.Context, doctorID string, filters map[string]interface{}) ([]*entity.Appointment, error) {
 	var appointments []*entity.Appointment
-	query := r.data.db.WithContext(ctx).Where("doctor_id = ?", doctorID)
+	query := r.data.DB(ctx).Where("doctor_id = ?", doctorID)
 
 	if status, ok := filters["status"].(int32); ok && status > 0 {
 		query = query.Where("status = ?", status)
@@ -105,7 +106,7 @@ func (r *appointmentRepo) GetByDoctorID(ctx context.Context, doctorID string, fi
 		query = query.Where("appointment_date = ?", date)
 	}
 
-	query = query.Order("appointment_date DESC, appointment_time DESC")
+	query = query.Order("starts_at DESC")
 
 	if err := query.Find(&appointments).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to get doctor appointments: %v", err)
@@ -115,29 +116,52 @@ func (r *appointmentRepo) GetByDoctorID(ctx context.Context, doctorID string, fi
 	return appointments, nil
 }
 
-func (r *appointmentRepo) GetByDoctorAndDate(ctx context.Context, doctorID string, date string) ([]*entity.Appointment, error) {
+// GetByDoctorInRange returns the doctor's non-cancelled appointments that
+// overlap the half-open interval [from, to).
+func (r *appointmentRepo) GetByDoctorInRange(ctx context.Context, doctorID string, from, to time.Time) ([]*entity.Appointment, error) {
 	var appointments []*entity.Appointment
 
-	query := r.data.db.WithContext(ctx).
+	query := r.data.DB(ctx).
 		Where("doctor_id = ?", doctorID).
-		Where("appointment_date = ?", date).
+		Where("starts_at < ? AND ends_at > ?", to.UTC(), from.UTC()).
 		Where("status NOT IN (?)", []int32{entity.AppointmentStatusCancelled})
 
-	if err := query.Order("appointment_time ASC").Find(&appointments).Error; err != nil {
-		r.log.WithContext(ctx).Errorf("failed to get appointments by doctor and date: %v", err)
+	if err := query.Order("starts_at ASC").Find(&appointments).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get appointments by doctor and range: %v", err)
 		return nil, err
 	}
 
 	return appointments, nil
 }
 
-func (r *appointmentRepo) CheckConflict(ctx context.Context, doctorID, date, appointmentTime string, excludeID string) (*entity.Appointment, error) {
+// GetByDoctorsInRange is GetByDoctorInRange for several doctors at once.
+func (r *appointmentRepo) GetByDoctorsInRange(ctx context.Context, doctorIDs []string, from, to time.Time) ([]*entity.Appointment, error) {
+	var appointments []*entity.Appointment
+	if len(doctorIDs) == 0 {
+		return appointments, nil
+	}
+
+	query := r.data.DB(ctx).
+		Where("doctor_id IN ?", doctorIDs).
+		Where("starts_at < ? AND ends_at > ?", to.UTC(), from.UTC()).
+		Where("status NOT IN (?)", []int32{entity.AppointmentStatusCancelled})
+
+	if err := query.Order("starts_at ASC").Find(&appointments).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get appointments by doctors and range: %v", err)
+		return nil, err
+	}
+
+	return appointments, nil
+}
+
+// CheckConflict returns any non-cancelled appointment of the doctor that
+// overlaps [startsAt, endsAt).
+func (r *appointmentRepo) CheckConflict(ctx context.Context, doctorID string, startsAt, endsAt time.Time, excludeID string) (*entity.Appointment, error) {
 	var appointment entity.Appointment
 
-	query := r.data.db.WithContext(ctx).
+	query := r.data.DB(ctx).
 		Where("doctor_id = ?", doctorID).
-		Where("appointment_date = ?", date).
-		Where("appointment_time = ?", appointmentTime).
+		Where("starts_at < ? AND ends_at > ?", endsAt.UTC(), startsAt.UTC()).
 		Where("status NOT IN (?)", []int32{entity.AppointmentStatusCancelled})
 
 	if excludeID != "" {
@@ -159,5 +183,5 @@ func FormatTimePointer(t *time.Time) string {
 	if t == nil {
 		return ""
 	}
-	return t.Format("2006-01-02T15:04:05Z")
+	return t.Format(time.RFC3339)
 }
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CalendarFeedRepo interface {
+	Replace(ctx context.Context, feed *entity.CalendarFeed) error
+	GetByToken(ctx context.Context, token string) (*entity.CalendarFeed, error)
+}
+
+type calendarFeedRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewCalendarFeedRepo(data *Data, logger log.Logger) CalendarFeedRepo {
+	return &calendarFeedRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+// Replace stores feed as the owner's only feed, revoking any earlier token.
+func (r *calendarFeedRepo) Replace(ctx context.Context, feed *entity.CalendarFeed) error {
+	if feed.ID == "" {
+		feed.ID = uuid.New().String()
+	}
+
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("owner_type = ? AND owner_id = ?", feed.OwnerType, feed.OwnerID).Delete(&entity.CalendarFeed{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(feed).Error
+	})
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to replace calendar feed: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("issued calendar feed for %s %s", feed.OwnerType, feed.OwnerID)
+	return nil
+}
+
+func (r *calendarFeedRepo) GetByToken(ctx context.Context, token string) (*entity.CalendarFeed, error) {
+	var feed entity.CalendarFeed
+
+	if err := r.data.DB(ctx).Where("token = ?", token).First(&feed).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.log.WithContext(ctx).Errorf("failed to get calendar feed: %v", err)
+		return nil, err
+	}
+
+	return &feed, nil
+}
@@ -0,0 +1,113 @@
+package data
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ClinicRepo interface {
+	Create(ctx context.Context, clinic *entity.Clinic) error
+	Get(ctx context.Context, id string) (*entity.Clinic, error)
+	Update(ctx context.Context, clinic *entity.Clinic) error
+	List(ctx context.Context, filters map[string]interface{}) ([]*entity.Clinic, error)
+	CreateRoom(ctx context.Context, room *entity.Room) error
+	GetRooms(ctx context.Context, clinicID string) ([]*entity.Room, error)
+}
+
+type clinicRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewClinicRepo(data *Data, logger log.Logger) ClinicRepo {
+	return &clinicRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *clinicRepo) Create(ctx context.Context, clinic *entity.Clinic) error {
+	if clinic.ID == "" {
+		clinic.ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(clinic).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create clinic: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("created clinic with ID: %s", clinic.ID)
+	return nil
+}
+
+func (r *clinicRepo) Get(ctx context.Context, id string) (*entity.Clinic, error) {
+	var clinic entity.Clinic
+
+	if err := r.data.DB(ctx).Where("id = ?", id).First(&clinic).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.log.WithContext(ctx).Errorf("failed to get clinic: %v", err)
+		return nil, err
+	}
+
+	return &clinic, nil
+}
+
+func (r *clinicRepo) Update(ctx context.Context, clinic *entity.Clinic) error {
+	if err := r.data.DB(ctx).Save(clinic).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to update clinic: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("updated clinic with ID: %s", clinic.ID)
+	return nil
+}
+
+func (r *clinicRepo) List(ctx context.Context, filters map[string]interface{}) ([]*entity.Clinic, error) {
+	var clinics []*entity.Clinic
+	query := r.data.DB(ctx)
+
+	if name, ok := filters["name"].(string); ok && name != "" {
+		query = query.Where("name LIKE ?", "%"+name+"%")
+	}
+	if isActive, ok := filters["is_active"].(bool); ok {
+		query = query.Where("is_active = ?", isActive)
+	}
+
+	if err := query.Order("name ASC").Find(&clinics).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list clinics: %v", err)
+		return nil, err
+	}
+
+	return clinics, nil
+}
+
+func (r *clinicRepo) CreateRoom(ctx context.Context, room *entity.Room) error {
+	if room.ID == "" {
+		room.ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(room).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create room: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("created room %s in clinic %s", room.ID, room.ClinicID)
+	return nil
+}
+
+func (r *clinicRepo) GetRooms(ctx context.Context, clinicID string) ([]*entity.Room, error) {
+	var rooms []*entity.Room
+
+	if err := r.data.DB(ctx).Where("clinic_id = ?", clinicID).Order("name ASC").Find(&rooms).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get rooms: %v", err)
+		return nil, err
+	}
+
+	return rooms, nil
+}
@@ -1,24 +1,56 @@
 package data
 
 import (
+	"context"
+	"time"
+
 	"github.com/arm-1234/medical-service/internal/conf"
 	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/formulary"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/google/wire"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
-var ProviderSet = wire.NewSet(NewData, NewPatientRepo, NewMedicalRecordRepo, NewDoctorRepo, NewAppointmentRepo, NewPrescriptionRepo)
+var ProviderSet = wire.NewSet(NewData, NewPatientRepo, NewMedicalRecordRepo, NewDoctorRepo, NewAppointmentRepo, NewPrescriptionRepo, NewClinicRepo, NewResourceRepo, NewVideoSessionRepo, NewCalendarFeedRepo, NewReviewRepo, NewPatientMergeRepo, NewNameSyncRepo, NewPatientProfileRepo, NewVitalSignRepo, NewLabRepo, NewFHIRRepo, NewImportRepo, NewExportRepo, NewPatientExportRepo, NewAnalyticsRepo, NewTransaction)
 
 type Data struct {
 	db *gorm.DB
 }
 
-func NewData(c *conf.Data, logger log.Logger) (*Data, func(), error) {
+type contextTxKey struct{}
+
+// Transaction runs fn in a database transaction. Repositories called with the
+// ctx passed to fn take part in that transaction.
+type Transaction interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+func NewTransaction(d *Data) Transaction {
+	return d
+}
+
+func (d *Data) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return d.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, contextTxKey{}, tx))
+	})
+}
+
+// DB returns the transaction carried by ctx, or the shared handle otherwise.
+func (d *Data) DB(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(contextTxKey{}).(*gorm.DB); ok {
+		return tx
+	}
+	return d.db.WithContext(ctx)
+}
+
+func NewData(c *conf.Data, f *formulary.Formulary, logger log.Logger) (*Data, func(), error) {
 	log := log.NewHelper(logger)
 
-	db, err := gorm.Open(mysql.Open(c.Database.Source), &gorm.Config{})
+	db, err := gorm.Open(mysql.Open(c.Database.Source), &gorm.Config{
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
 	if err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
 		return nil, nil, err
@@ -28,16 +60,61 @@ func NewData(c *conf.Data, logger log.Logger) (*Data, func(), error) {
 
 	if err := db.AutoMigrate(
 		&entity.Patient{},
+		&entity.PatientSearchToken{},
+		&entity.PatientMerge{},
+		&entity.PatientAllergy{},
+		&entity.PatientCondition{},
+		&entity.PatientMedication{},
+		&entity.PatientEmergencyContact{},
+		&entity.PatientInsurance{},
+		&entity.PatientExport{},
+		&entity.PatientAccess{},
 		&entity.MedicalRecord{},
+		&entity.VitalSign{},
+		&entity.LabOrder{},
+		&entity.LabOrderTest{},
+		&entity.LabResult{},
+		&entity.LabMessage{},
 		&entity.Doctor{},
 		&entity.DoctorAvailability{},
+		&entity.DoctorLanguage{},
+		&entity.DoctorConsultationType{},
 		&entity.Appointment{},
 		&entity.Prescription{},
+		&entity.PrescriptionSafetyOverride{},
+		&entity.PrescriptionItem{},
+		&entity.PrescriptionRefill{},
+		&entity.Clinic{},
+		&entity.Room{},
+		&entity.Equipment{},
+		&entity.ResourceBooking{},
+		&entity.VideoSession{},
+		&entity.CalendarFeed{},
+		&entity.Review{},
+		&entity.ImportedResource{},
+		&entity.AnalyticsDoctorDay{},
+		&entity.AnalyticsDoctorHour{},
+		&entity.AnalyticsAppointmentDay{},
+		&entity.AnalyticsMedicationDay{},
+		&entity.AnalyticsRefresh{},
+		&entity.SchemaMigration{},
 	); err != nil {
 		log.Errorf("failed to migrate tables: %v", err)
 		return nil, nil, err
 	}
 
+	var legacyLoc *time.Location
+	if zone := c.Database.GetLegacyTimezone(); zone != "" {
+		if legacyLoc, err = time.LoadLocation(zone); err != nil {
+			log.Errorf("invalid legacy timezone %q: %v", zone, err)
+			return nil, nil, err
+		}
+	}
+	if err := runMigrations(db, f, legacyLoc, log); err != nil {
+		log.Errorf("failed to run data migrations: %v", err)
+		return nil, nil, err
+	}
+
 	log.Info("database migrations completed")
 
 	cleanup := func() {
@@ -2,11 +2,13 @@ package data
 
 import (
 	"context"
+	"strings"
 
 	"github.com/arm-1234/medical-service/internal/data/entity"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type DoctorRepo interface {
@@ -17,8 +19,16 @@ type DoctorRepo interface {
 	Search(ctx context.Context, filters map[string]interface{}) ([]*entity.Doctor, error)
 	GetByEmail(ctx context.Context, email string) (*entity.Doctor, error)
 	GetByLicense(ctx context.Context, license string) (*entity.Doctor, error)
-	SetAvailability(ctx context.Context, doctorID string, slots []*entity.DoctorAvailability) error
+	GetByPhone(ctx context.Context, phone string) (*entity.Doctor, error)
+	SetAvailability(ctx context.Context, doctorID, clinicID string, slots []*entity.DoctorAvailability) error
 	GetAvailability(ctx context.Context, doctorID string) ([]*entity.DoctorAvailability, error)
+	GetAvailabilityByDoctors(ctx context.Context, doctorIDs []string) ([]*entity.DoctorAvailability, error)
+	Lock(ctx context.Context, id string) error
+	AdjustRating(ctx context.Context, id string, sumDelta int64, countDelta int32) error
+	IncrementConsultations(ctx context.Context, id string) error
+	SetConsultationTypes(ctx context.Context, doctorID string, types []int32) error
+	GetConsultationTypes(ctx context.Context, doctorID string) ([]int32, error)
+	GetConsultationTypesByDoctors(ctx context.Context, doctorIDs []string) (map[string][]int32, error)
 }
 
 type doctorRepo struct {
@@ -38,7 +48,13 @@ func (r *doctorRepo) Create(ctx context.Context, doctor *entity.Doctor) error {
 		doctor.ID = uuid.New().String()
 	}
 
-	if err := r.data.db.WithContext(ctx).Create(doctor).Error; err != nil {
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(doctor).Error; err != nil {
+			return err
+		}
+		return syncDoctorLanguages(tx, doctor)
+	})
+	if err != nil {
 		r.log.WithContext(ctx).Errorf("failed to create doctor: %v", err)
 		return err
 	}
@@ -50,7 +66,7 @@ func (r *doctorRepo) Create(ctx context.Context, doctor *entity.Doctor) error {
 func (r *doctorRepo) Get(ctx context.Context, id string) (*entity.Doctor, error) {
 	var doctor entity.Doctor
 
-	if err := r.data.db.WithContext(ctx).Where("id = ?", id).First(&doctor).Error; err != nil {
+	if err := r.data.DB(ctx).Where("id = ?", id).First(&doctor).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -61,8 +77,19 @@ func (r *doctorRepo) Get(ctx context.Context, id string) (*entity.Doctor, error)
 	return &doctor, nil
 }
 
+// doctorCounterColumns are kept by AdjustRating and IncrementConsultations
+// alone. Update leaves them out so that saving a doctor loaded earlier does
+// not write back counts changed since.
+var doctorCounterColumns = []string{"rating_sum", "rating_count", "average_rating", "total_consultations"}
+
 func (r *doctorRepo) Update(ctx context.Context, doctor *entity.Doctor) error {
-	if err := r.data.db.WithContext(ctx).Save(doctor).Error; err != nil {
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(doctor).Select("*").Omit(doctorCounterColumns...).Updates(doctor).Error; err != nil {
+			return err
+		}
+		return syncDoctorLanguages(tx, doctor)
+	})
+	if err != nil {
 		r.log.WithContext(ctx).Errorf("failed to update doctor: %v", err)
 		return err
 	}
@@ -72,7 +99,7 @@ func (r *doctorRepo) Update(ctx context.Context, doctor *entity.Doctor) error {
 }
 
 func (r *doctorRepo) Delete(ctx context.Context, id string) error {
-	if err := r.data.db.WithContext(ctx).Where("id = ?", id).Delete(&entity.Doctor{}).Error; err != nil {
+	if err := r.data.DB(ctx).Where("id = ?", id).Delete(&entity.Doctor{}).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to delete doctor: %v", err)
 		return err
 	}
@@ -83,7 +110,7 @@ func (r *doctorRepo) Delete(ctx context.Context, id string) error {
 
 func (r *doctorRepo) Search(ctx context.Context, filters map[string]interface{}) ([]*entity.Doctor, error) {
 	var doctors []*entity.Doctor
-	query := r.data.db.WithContext(ctx)
+	query := r.data.DB(ctx)
 
 	if name, ok := filters["name"].(string); ok && name != "" {
 		query = query.Where("first_name LIKE ? OR last_name LIKE ?", "%"+name+"%", "%"+name+"%")
@@ -94,6 +121,48 @@ func (r *doctorRepo) Search(ctx context.Context, filters map[string]interface{})
 	if isAvailable, ok := filters["is_available"].(bool); ok {
 		query = query.Where("is_available = ?", isAvailable)
 	}
+	if clinicID, ok := filters["clinic_id"].(string); ok && clinicID != "" {
+		query = query.Where("id IN (?)", r.data.db.Model(&entity.DoctorAvailability{}).Select("doctor_id").Where("clinic_id = ?", clinicID))
+	}
+	if minRating, ok := filters["min_rating"].(float32); ok && minRating > 0 {
+		query = query.Where("average_rating >= ?", minRating)
+	}
+	if language, ok := filters["language"].(string); ok && language != "" {
+		query = query.Where("id IN (?)", r.data.db.Model(&entity.DoctorLanguage{}).Select("doctor_id").Where("language = ?", strings.ToLower(language)))
+	}
+	if minFee, ok := filters["min_fee"].(int32); ok && minFee > 0 {
+		query = query.Where("consultation_fee >= ?", minFee)
+	}
+	if maxFee, ok := filters["max_fee"].(int32); ok && maxFee > 0 {
+		query = query.Where("consultation_fee <= ?", maxFee)
+	}
+	if minExperience, ok := filters["min_experience"].(int32); ok && minExperience > 0 {
+		query = query.Where("years_of_experience >= ?", minExperience)
+	}
+	if consultationType, ok := filters["consultation_type"].(int32); ok && consultationType > 0 {
+		configured := r.data.db.Model(&entity.DoctorConsultationType{}).Select("doctor_id")
+		offering := r.data.db.Model(&entity.DoctorConsultationType{}).Select("doctor_id").Where("consultation_type = ?", consultationType)
+		query = query.Where("id NOT IN (?) OR id IN (?)", configured, offering)
+	}
+	if city, ok := filters["city"].(string); ok && city != "" {
+		clinics := r.data.db.Model(&entity.Clinic{}).Select("id").Where("LOWER(JSON_UNQUOTE(JSON_EXTRACT(address, '$.city'))) = ?", strings.ToLower(city))
+		query = query.Where("id IN (?)", r.data.db.Model(&entity.DoctorAvailability{}).Select("doctor_id").Where("clinic_id IN (?)", clinics))
+	}
+	if q, ok := filters["query"].(string); ok && q != "" {
+		like := "%" + q + "%"
+		query = query.Where("first_name LIKE ? OR last_name LIKE ? OR qualifications LIKE ? OR languages LIKE ?", like, like, like, like)
+	}
+	switch filters["sort"] {
+	case "rating":
+		query = query.Order("average_rating DESC, rating_count DESC")
+	case "fee":
+		query = query.Order("consultation_fee ASC")
+	case "experience":
+		query = query.Order("years_of_experience DESC")
+	}
+	if limit, ok := filters["limit"].(int); ok && limit > 0 {
+		query = query.Limit(limit)
+	}
 
 	if err := query.Find(&doctors).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to search doctors: %v", err)
@@ -106,7 +175,7 @@ func (r *doctorRepo) Search(ctx context.Context, filters map[string]interface{})
 func (r *doctorRepo) GetByEmail(ctx context.Context, email string) (*entity.Doctor, error) {
 	var doctor entity.Doctor
 
-	if err := r.data.db.WithContext(ctx).Where("email = ?", email).First(&doctor).Error; err != nil {
+	if err := r.data.DB(ctx).Where("email = ?", email).First(&doctor).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -120,7 +189,7 @@ func (r *doctorRepo) GetByEmail(ctx context.Context, email string) (*entity.Doct
 func (r *doctorRepo) GetByLicense(ctx context.Context, license string) (*entity.Doctor, error) {
 	var doctor entity.Doctor
 
-	if err := r.data.db.WithContext(ctx).Where("license_number = ?", license).First(&doctor).Error; err != nil {
+	if err := r.data.DB(ctx).Where("license_number = ?", license).First(&doctor).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -131,34 +200,192 @@ func (r *doctorRepo) GetByLicense(ctx context.Context, license string) (*entity.
 	return &doctor, nil
 }
 
-func (r *doctorRepo) SetAvailability(ctx context.Context, doctorID string, slots []*entity.DoctorAvailability) error {
-	if err := r.data.db.WithContext(ctx).Where("doctor_id = ?", doctorID).Delete(&entity.DoctorAvailability{}).Error; err != nil {
-		r.log.WithContext(ctx).Errorf("failed to delete existing availability: %v", err)
-		return err
-	}
+func (r *doctorRepo) GetByPhone(ctx context.Context, phone string) (*entity.Doctor, error) {
+	var doctor entity.Doctor
 
-	for _, slot := range slots {
-		if slot.ID == "" {
-			slot.ID = uuid.New().String()
+	if err := r.data.DB(ctx).Where("phone_number = ?", phone).First(&doctor).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
 		}
-		slot.DoctorID = doctorID
-		if err := r.data.db.WithContext(ctx).Create(slot).Error; err != nil {
-			r.log.WithContext(ctx).Errorf("failed to create availability slot: %v", err)
+		r.log.WithContext(ctx).Errorf("failed to get doctor by phone: %v", err)
+		return nil, err
+	}
+
+	return &doctor, nil
+}
+
+// SetAvailability replaces the doctor's availability templates at a clinic.
+// An empty clinicID addresses the templates that are not tied to a location.
+func (r *doctorRepo) SetAvailability(ctx context.Context, doctorID, clinicID string, slots []*entity.DoctorAvailability) error {
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doctor_id = ? AND clinic_id = ?", doctorID, clinicID).Delete(&entity.DoctorAvailability{}).Error; err != nil {
+			r.log.WithContext(ctx).Errorf("failed to delete existing availability: %v", err)
 			return err
 		}
+
+		for _, slot := range slots {
+			if slot.ID == "" {
+				slot.ID = uuid.New().String()
+			}
+			slot.DoctorID = doctorID
+			slot.ClinicID = clinicID
+			if err := tx.Create(slot).Error; err != nil {
+				r.log.WithContext(ctx).Errorf("failed to create availability slot: %v", err)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	r.log.WithContext(ctx).Infof("set availability for doctor: %s with %d slots", doctorID, len(slots))
+	r.log.WithContext(ctx).Infof("set availability for doctor: %s at clinic: %q with %d slots", doctorID, clinicID, len(slots))
 	return nil
 }
 
 func (r *doctorRepo) GetAvailability(ctx context.Context, doctorID string) ([]*entity.DoctorAvailability, error) {
 	var slots []*entity.DoctorAvailability
 
-	if err := r.data.db.WithContext(ctx).Where("doctor_id = ?", doctorID).Find(&slots).Error; err != nil {
+	if err := r.data.DB(ctx).Where("doctor_id = ?", doctorID).Find(&slots).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to get availability: %v", err)
 		return nil, err
 	}
 
 	return slots, nil
 }
+
+func (r *doctorRepo) GetAvailabilityByDoctors(ctx context.Context, doctorIDs []string) ([]*entity.DoctorAvailability, error) {
+	var slots []*entity.DoctorAvailability
+	if len(doctorIDs) == 0 {
+		return slots, nil
+	}
+
+	if err := r.data.DB(ctx).Where("doctor_id IN ?", doctorIDs).Find(&slots).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get availability of doctors: %v", err)
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+// Lock takes a row lock on the doctor for the rest of the surrounding
+// transaction, serializing concurrent bookings for the same doctor.
+func (r *doctorRepo) Lock(ctx context.Context, id string) error {
+	var doctor entity.Doctor
+
+	if err := r.data.DB(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", id).First(&doctor).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to lock doctor: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// AdjustRating adds to the doctor's rating totals and recomputes the average
+// from them. Both statements run on the locked row, so concurrent reviews
+// cannot lose updates.
+func (r *doctorRepo) AdjustRating(ctx context.Context, id string, sumDelta int64, countDelta int32) error {
+	db := r.data.DB(ctx)
+
+	err := db.Model(&entity.Doctor{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+		"rating_sum":   gorm.Expr("rating_sum + ?", sumDelta),
+		"rating_count": gorm.Expr("rating_count + ?", countDelta),
+	}).Error
+	if err == nil {
+		err = db.Model(&entity.Doctor{}).Where("id = ?", id).
+			UpdateColumn("average_rating", gorm.Expr("CASE WHEN rating_count > 0 THEN rating_sum / rating_count ELSE 0 END")).Error
+	}
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to adjust doctor rating: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// IncrementConsultations counts one more completed consultation for the
+// doctor.
+func (r *doctorRepo) IncrementConsultations(ctx context.Context, id string) error {
+	err := r.data.DB(ctx).Model(&entity.Doctor{}).Where("id = ?", id).
+		UpdateColumn("total_consultations", gorm.Expr("total_consultations + 1")).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to increment doctor consultations: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// SetConsultationTypes replaces the consultation types the doctor offers.
+func (r *doctorRepo) SetConsultationTypes(ctx context.Context, doctorID string, types []int32) error {
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doctor_id = ?", doctorID).Delete(&entity.DoctorConsultationType{}).Error; err != nil {
+			return err
+		}
+		for _, t := range types {
+			if err := tx.Create(&entity.DoctorConsultationType{DoctorID: doctorID, ConsultationType: t}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to set consultation types: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *doctorRepo) GetConsultationTypes(ctx context.Context, doctorID string) ([]int32, error) {
+	var types []int32
+
+	if err := r.data.DB(ctx).Model(&entity.DoctorConsultationType{}).Where("doctor_id = ?", doctorID).Order("consultation_type ASC").Pluck("consultation_type", &types).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get consultation types: %v", err)
+		return nil, err
+	}
+
+	return types, nil
+}
+
+// GetConsultationTypesByDoctors returns the consultation types of each of
+// the doctors that has any configured, keyed by doctor ID.
+func (r *doctorRepo) GetConsultationTypesByDoctors(ctx context.Context, doctorIDs []string) (map[string][]int32, error) {
+	types := make(map[string][]int32)
+	if len(doctorIDs) == 0 {
+		return types, nil
+	}
+
+	var rows []*entity.DoctorConsultationType
+	if err := r.data.DB(ctx).Where("doctor_id IN ?", doctorIDs).Order("consultation_type ASC").Find(&rows).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get consultation types of doctors: %v", err)
+		return nil, err
+	}
+	for _, row := range rows {
+		types[row.DoctorID] = append(types[row.DoctorID], row.ConsultationType)
+	}
+
+	return types, nil
+}
+
+// syncDoctorLanguages rewrites the doctor's rows in doctor_languages from the
+// JSON Languages column.
+func syncDoctorLanguages(tx *gorm.DB, doctor *entity.Doctor) error {
+	if err := tx.Where("doctor_id = ?", doctor.ID).Delete(&entity.DoctorLanguage{}).Error; err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, l := range entity.UnmarshalStringArray(doctor.Languages) {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if l == "" || seen[l] {
+			continue
+		}
+		seen[l] = true
+		if err := tx.Create(&entity.DoctorLanguage{DoctorID: doctor.ID, Language: l}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package entity
+
+import (
+	"time"
+)
+
+// AnalyticsDoctorDay rolls up a doctor's appointments on one day. Day is the
+// appointment's local calendar date. Lead time is summed over every
+// appointment of the day, from when it was booked to when it starts.
+type AnalyticsDoctorDay struct {
+	Day             string    `gorm:"primaryKey;type:varchar(10)"`
+	DoctorID        string    `gorm:"primaryKey;type:varchar(36);index"`
+	Appointments    int32     `gorm:"type:int;not null;default:0"`
+	Completed       int32     `gorm:"type:int;not null;default:0"`
+	Cancelled       int32     `gorm:"type:int;not null;default:0"`
+	NoShow          int32     `gorm:"type:int;not null;default:0"`
+	BookedMinutes   int64     `gorm:"type:bigint;not null;default:0"`
+	LeadTimeMinutes int64     `gorm:"type:bigint;not null;default:0"`
+	RefreshedAt     time.Time `gorm:"autoUpdateTime"`
+}
+
+func (AnalyticsDoctorDay) TableName() string {
+	return "analytics_doctor_days"
+}
+
+// AnalyticsDoctorHour counts the appointments a doctor had starting in one
+// local hour of a day, cancelled ones left out. Weekday is 0 for Sunday.
+type AnalyticsDoctorHour struct {
+	Day          string `gorm:"primaryKey;type:varchar(10)"`
+	DoctorID     string `gorm:"primaryKey;type:varchar(36);index"`
+	Hour         int32  `gorm:"primaryKey;type:int"`
+	Weekday      int32  `gorm:"type:int;not null"`
+	Appointments int32  `gorm:"type:int;not null;default:0"`
+}
+
+func (AnalyticsDoctorHour) TableName() string {
+	return "analytics_doctor_hours"
+}
+
+// AnalyticsAppointmentDay is the doctor and day an appointment was last
+// rolled up under, so that the day it is moved away from is rolled up again
+// too.
+type AnalyticsAppointmentDay struct {
+	AppointmentID string `gorm:"primaryKey;type:varchar(36)"`
+	DoctorID      string `gorm:"type:varchar(36);not null;index:idx_analytics_appointment_day,priority:1"`
+	Day           string `gorm:"type:varchar(10);not null;index:idx_analytics_appointment_day,priority:2"`
+}
+
+func (AnalyticsAppointmentDay) TableName() string {
+	return "analytics_appointment_days"
+}
+
+// AnalyticsMedicationDay counts how often a doctor prescribed a medication
+// on one day, in the doctor's timezone. Medications are keyed by drug code,
+// or by lower-cased name when uncoded.
+type AnalyticsMedicationDay struct {
+	Day            string `gorm:"primaryKey;type:varchar(10)"`
+	DoctorID       string `gorm:"primaryKey;type:varchar(36);index"`
+	MedicationKey  string `gorm:"primaryKey;type:varchar(200)"`
+	DrugCode       string `gorm:"type:varchar(50);not null;default:''"`
+	MedicationName string `gorm:"type:varchar(200);not null"`
+	Prescriptions  int32  `gorm:"type:int;not null;default:0"`
+	Quantity       int64  `gorm:"type:bigint;not null;default:0"`
+}
+
+func (AnalyticsMedicationDay) TableName() string {
+	return "analytics_medication_days"
+}
+
+// AnalyticsRefresh records how far a rollup has been brought up to date:
+// rows changed before Watermark are reflected in it.
+type AnalyticsRefresh struct {
+	Name      string    `gorm:"primaryKey;type:varchar(50)"`
+	Watermark time.Time `gorm:"type:datetime;not null"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (AnalyticsRefresh) TableName() string {
+	return "analytics_refreshes"
+}
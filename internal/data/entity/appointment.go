@@ -10,13 +10,19 @@ type Appointment struct {
 	PatientName        string     `gorm:"type:varchar(200)"`
 	DoctorID           string     `gorm:"type:varchar(36);not null;index"`
 	DoctorName         string     `gorm:"type:varchar(200)"`
+	ClinicID           string     `gorm:"type:varchar(36);not null;default:'';index"`
 	AppointmentDate    string     `gorm:"type:varchar(10);not null;index"`
 	AppointmentTime    string     `gorm:"type:varchar(10);not null"`
+	StartsAt           time.Time  `gorm:"type:datetime;index"`
+	EndsAt             time.Time  `gorm:"type:datetime"`
+	Timezone           string     `gorm:"type:varchar(64);not null;default:'UTC'"`
 	Status             int32      `gorm:"type:int;not null;default:1"`
 	ConsultationType   int32      `gorm:"type:int;not null;default:1"`
 	ReasonForVisit     string     `gorm:"type:text"`
 	Notes              string     `gorm:"type:text"`
 	Diagnosis          string     `gorm:"type:text"`
+	RequiredEquipment  string     `gorm:"type:text"`
+	Sequence           int32      `gorm:"type:int;not null;default:0"`
 	CancelledAt        *time.Time `gorm:"type:datetime"`
 	CancellationReason string     `gorm:"type:text"`
 	CreatedAt          time.Time  `gorm:"autoCreateTime"`
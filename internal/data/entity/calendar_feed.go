@@ -0,0 +1,22 @@
+package entity
+
+import (
+	"time"
+)
+
+type CalendarFeed struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	OwnerType string    `gorm:"type:varchar(20);not null;index:idx_calendar_feed_owner"`
+	OwnerID   string    `gorm:"type:varchar(36);not null;index:idx_calendar_feed_owner"`
+	Token     string    `gorm:"type:varchar(64);not null;uniqueIndex"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (CalendarFeed) TableName() string {
+	return "calendar_feeds"
+}
+
+const (
+	CalendarOwnerDoctor  = "doctor"
+	CalendarOwnerPatient = "patient"
+)
@@ -0,0 +1,58 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Clinic struct {
+	ID           string    `gorm:"primaryKey;type:varchar(36)"`
+	Name         string    `gorm:"type:varchar(200);not null"`
+	PhoneNumber  string    `gorm:"type:varchar(20)"`
+	Address      string    `gorm:"type:text"`
+	Timezone     string    `gorm:"type:varchar(64);not null;default:'UTC'"`
+	OpeningHours string    `gorm:"type:text"`
+	IsActive     bool      `gorm:"type:boolean;default:true"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Clinic) TableName() string {
+	return "clinics"
+}
+
+type Room struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	ClinicID  string    `gorm:"type:varchar(36);not null;index"`
+	Name      string    `gorm:"type:varchar(100);not null"`
+	IsActive  bool      `gorm:"type:boolean;default:true"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Room) TableName() string {
+	return "clinic_rooms"
+}
+
+type OpeningHours struct {
+	DayOfWeek string `json:"day_of_week"`
+	OpenTime  string `json:"open_time"`
+	CloseTime string `json:"close_time"`
+}
+
+func MarshalOpeningHours(hours []*OpeningHours) string {
+	if hours == nil {
+		return "[]"
+	}
+	b, _ := json.Marshal(hours)
+	return string(b)
+}
+
+func UnmarshalOpeningHours(s string) []*OpeningHours {
+	if s == "" {
+		return nil
+	}
+	var hours []*OpeningHours
+	json.Unmarshal([]byte(s), &hours)
+	return hours
+}
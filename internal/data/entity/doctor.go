@@ -19,7 +19,10 @@ type Doctor struct {
 	ConsultationFee    int32     `gorm:"type:int;default:0"`
 	IsAvailable        bool      `gorm:"type:boolean;default:true"`
 	AverageRating      float32   `gorm:"type:float;default:0"`
+	RatingCount        int32     `gorm:"type:int;not null;default:0"`
+	RatingSum          int64     `gorm:"type:bigint;not null;default:0"`
 	TotalConsultations int32     `gorm:"type:int;default:0"`
+	Timezone           string    `gorm:"type:varchar(64);not null;default:'UTC'"`
 	CreatedAt          time.Time `gorm:"autoCreateTime"`
 	UpdatedAt          time.Time `gorm:"autoUpdateTime"`
 }
@@ -28,6 +31,11 @@ func (Doctor) TableName() string {
 	return "doctors"
 }
 
+const (
+	DefaultTimezone            = "UTC"
+	DefaultSlotDurationMinutes = 30
+)
+
 func MarshalStringArray(arr []string) string {
 	if arr == nil {
 		return "[]"
@@ -48,6 +56,7 @@ func UnmarshalStringArray(s string) []string {
 type DoctorAvailability struct {
 	ID                  string    `gorm:"primaryKey;type:varchar(36)"`
 	DoctorID            string    `gorm:"type:varchar(36);not null;index"`
+	ClinicID            string    `gorm:"type:varchar(36);not null;default:'';index"`
 	DayOfWeek           string    `gorm:"type:varchar(20);not null"`
 	StartTime           string    `gorm:"type:varchar(10);not null"`
 	EndTime             string    `gorm:"type:varchar(10);not null"`
@@ -59,3 +68,25 @@ type DoctorAvailability struct {
 func (DoctorAvailability) TableName() string {
 	return "doctor_availability"
 }
+
+// DoctorLanguage is a queryable copy of Doctor.Languages, one lower-cased row
+// per language.
+type DoctorLanguage struct {
+	DoctorID string `gorm:"primaryKey;type:varchar(36)"`
+	Language string `gorm:"primaryKey;type:varchar(50);index"`
+}
+
+func (DoctorLanguage) TableName() string {
+	return "doctor_languages"
+}
+
+// DoctorConsultationType lists the consultation types a doctor offers. Doctors
+// without any rows offer every type.
+type DoctorConsultationType struct {
+	DoctorID         string `gorm:"primaryKey;type:varchar(36)"`
+	ConsultationType int32  `gorm:"primaryKey;type:int;index"`
+}
+
+func (DoctorConsultationType) TableName() string {
+	return "doctor_consultation_types"
+}
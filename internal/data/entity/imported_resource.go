@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"time"
+)
+
+// ImportedResource links a resource imported from another system, named by
+// one of its identifiers, to the row it was imported as, so that importing
+// it again finds that row instead of creating another.
+type ImportedResource struct {
+	ID           string    `gorm:"primaryKey;type:varchar(36)"`
+	ResourceType string    `gorm:"type:varchar(40);not null;uniqueIndex:idx_imported_resources_key,priority:1"`
+	System       string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_imported_resources_key,priority:2"`
+	Value        string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_imported_resources_key,priority:3"`
+	LocalID      string    `gorm:"type:varchar(36);not null;index"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+}
+
+func (ImportedResource) TableName() string {
+	return "imported_resources"
+}
@@ -0,0 +1,107 @@
+package entity
+
+import (
+	"time"
+)
+
+// LabOrder is a set of laboratory tests a doctor orders at an appointment.
+// Its ID is the placer order number the laboratory reports results against.
+type LabOrder struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36)"`
+	AppointmentID string    `gorm:"type:varchar(36);not null;index"`
+	PatientID     string    `gorm:"type:varchar(36);not null;index"`
+	DoctorID      string    `gorm:"type:varchar(36);not null;index"`
+	Status        string    `gorm:"type:varchar(20);not null;default:'ordered';index"`
+	Priority      string    `gorm:"type:varchar(20);not null;default:'routine'"`
+	Notes         string    `gorm:"type:text"`
+	OrderedAt     time.Time `gorm:"type:datetime;not null"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+}
+
+func (LabOrder) TableName() string {
+	return "lab_orders"
+}
+
+// Lab order statuses. An order is partial once some of its tests have a
+// result and resulted once every test has a final one.
+const (
+	LabOrderStatusOrdered  = "ordered"
+	LabOrderStatusPartial  = "partial"
+	LabOrderStatusResulted = "resulted"
+)
+
+// Lab order priorities.
+const (
+	LabPriorityRoutine = "routine"
+	LabPriorityUrgent  = "urgent"
+	LabPriorityStat    = "stat"
+)
+
+// LabOrderTest is one coded test on a lab order.
+type LabOrderTest struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	OrderID    string    `gorm:"type:varchar(36);not null;index"`
+	Position   int32     `gorm:"type:int;not null"`
+	Code       string    `gorm:"type:varchar(50);not null"`
+	CodeSystem string    `gorm:"type:varchar(50);not null;default:''"`
+	Name       string    `gorm:"type:varchar(200)"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+func (LabOrderTest) TableName() string {
+	return "lab_order_tests"
+}
+
+// LabResult is one reported value of a lab order. A corrected value is
+// stored as a new result, and the result it replaces points at it through
+// SupersededBy.
+type LabResult struct {
+	ID             string     `gorm:"primaryKey;type:varchar(36)"`
+	OrderID        string     `gorm:"type:varchar(36);not null;index"`
+	PatientID      string     `gorm:"type:varchar(36);not null;index"`
+	DoctorID       string     `gorm:"type:varchar(36);not null;index:idx_lab_results_inbox,priority:1"`
+	MessageID      string     `gorm:"type:varchar(36);not null;default:'';index"`
+	TestCode       string     `gorm:"type:varchar(50);not null"`
+	CodeSystem     string     `gorm:"type:varchar(50);not null;default:''"`
+	TestName       string     `gorm:"type:varchar(200)"`
+	Value          string     `gorm:"type:text"`
+	NumericValue   *float64   `gorm:"type:double"`
+	Unit           string     `gorm:"type:varchar(50)"`
+	ReferenceRange string     `gorm:"type:varchar(100)"`
+	AbnormalFlag   string     `gorm:"type:varchar(5);not null;default:''"`
+	Abnormal       bool       `gorm:"type:boolean;not null;default:false;index:idx_lab_results_inbox,priority:2"`
+	Status         string     `gorm:"type:varchar(20);not null"`
+	ObservedAt     time.Time  `gorm:"type:datetime;not null;index"`
+	SupersededBy   string     `gorm:"type:varchar(36);not null;default:''"`
+	ReviewedAt     *time.Time `gorm:"type:datetime;index:idx_lab_results_inbox,priority:3"`
+	ReviewedBy     string     `gorm:"type:varchar(36)"`
+	ReviewNote     string     `gorm:"type:text"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime"`
+}
+
+func (LabResult) TableName() string {
+	return "lab_results"
+}
+
+// Lab result statuses.
+const (
+	LabResultStatusPreliminary = "preliminary"
+	LabResultStatusFinal       = "final"
+	LabResultStatusCorrected   = "corrected"
+	LabResultStatusCancelled   = "cancelled"
+)
+
+// LabMessage records an ingested batch of results, so that a message
+// delivered twice is only ingested once.
+type LabMessage struct {
+	ID          string    `gorm:"primaryKey;type:varchar(36)"`
+	Source      string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_lab_messages_source,priority:1"`
+	ExternalID  string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_lab_messages_source,priority:2"`
+	ResultCount int32     `gorm:"type:int;not null;default:0"`
+	ReceivedAt  time.Time `gorm:"type:datetime;not null"`
+}
+
+func (LabMessage) TableName() string {
+	return "lab_messages"
+}
@@ -1,31 +1,57 @@
 package entity
 
 import (
+	"encoding/json"
 	"time"
 )
 
+// MedicalRecord is one version of a medical record. Versions of the same
+// record share OriginalID, the ID of the first version, and each amendment
+// points at the version it replaced through AmendedFrom. Once final, a
+// version is never edited; it can only be amended or marked entered in
+// error.
 type MedicalRecord struct {
-	ID            string     `gorm:"primaryKey;type:varchar(36)"`
-	PatientID     string     `gorm:"type:varchar(36);not null;index"`
-	DoctorID      string     `gorm:"type:varchar(36);index"`
-	VisitDate     time.Time  `gorm:"type:datetime;not null"`
-	Diagnosis     string     `gorm:"type:text"`
-	Symptoms      string     `gorm:"type:text"`
-	Treatment     string     `gorm:"type:text"`
-	Prescriptions string     `gorm:"type:text"`
-	LabResults    string     `gorm:"type:text"`
-	VitalSigns    string     `gorm:"type:text"`
-	Notes         string     `gorm:"type:text"`
-	FollowUpDate  *time.Time `gorm:"type:datetime"`
-	RecordType    string     `gorm:"type:varchar(50)"`
-	CreatedAt     time.Time  `gorm:"autoCreateTime"`
-	UpdatedAt     time.Time  `gorm:"autoUpdateTime"`
+	ID                   string     `gorm:"primaryKey;type:varchar(36)"`
+	PatientID            string     `gorm:"type:varchar(36);not null;index"`
+	DoctorID             string     `gorm:"type:varchar(36);index"`
+	VisitDate            time.Time  `gorm:"type:datetime;not null"`
+	Diagnosis            string     `gorm:"type:text"`
+	Symptoms             string     `gorm:"type:text"`
+	Treatment            string     `gorm:"type:text"`
+	Prescriptions        string     `gorm:"type:text"`
+	LabResults           string     `gorm:"type:text"`
+	VitalSigns           string     `gorm:"type:text"`
+	Notes                string     `gorm:"type:text"`
+	FollowUpDate         *time.Time `gorm:"type:datetime"`
+	RecordType           string     `gorm:"type:varchar(50)"`
+	Status               string     `gorm:"type:varchar(20);not null;default:'final';index"`
+	OriginalID           string     `gorm:"type:varchar(36);not null;default:'';index"`
+	Version              int32      `gorm:"type:int;not null;default:1"`
+	AmendedFrom          string     `gorm:"type:varchar(36);not null;default:'';index"`
+	AmendmentReason      string     `gorm:"type:text"`
+	EnteredInErrorAt     *time.Time `gorm:"type:datetime"`
+	EnteredInErrorBy     string     `gorm:"type:varchar(36)"`
+	EnteredInErrorReason string     `gorm:"type:text"`
+	Signature            `gorm:"embedded"`
+	CreatedAt            time.Time `gorm:"autoCreateTime"`
+	UpdatedAt            time.Time `gorm:"autoUpdateTime"`
 }
 
 func (MedicalRecord) TableName() string {
 	return "medical_records"
 }
 
+// Medical record statuses. A draft can still be edited; finalizing signs it,
+// an amended version has been replaced by a newer signed one, and a record
+// entered in error is kept for the audit trail but no longer shown as part
+// of the patient's history.
+const (
+	MedicalRecordStatusDraft          = "draft"
+	MedicalRecordStatusFinal          = "final"
+	MedicalRecordStatusAmended        = "amended"
+	MedicalRecordStatusEnteredInError = "entered_in_error"
+)
+
 type VitalSigns struct {
 	Temperature      float64 `json:"temperature,omitempty"`
 	BloodPressure    string  `json:"blood_pressure,omitempty"`
@@ -35,3 +61,22 @@ type VitalSigns struct {
 	Weight           float64 `json:"weight,omitempty"`
 	Height           float64 `json:"height,omitempty"`
 }
+
+func MarshalVitalSigns(vitals *VitalSigns) string {
+	if vitals == nil {
+		return ""
+	}
+	b, _ := json.Marshal(vitals)
+	return string(b)
+}
+
+func UnmarshalVitalSigns(s string) *VitalSigns {
+	if s == "" {
+		return nil
+	}
+	var vitals VitalSigns
+	if err := json.Unmarshal([]byte(s), &vitals); err != nil {
+		return nil
+	}
+	return &vitals
+}
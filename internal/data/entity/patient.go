@@ -6,19 +6,21 @@ import (
 )
 
 type Patient struct {
-	ID               string    `gorm:"primaryKey;type:varchar(36)"`
-	FirstName        string    `gorm:"type:varchar(100);not null"`
-	LastName         string    `gorm:"type:varchar(100);not null"`
-	Email            string    `gorm:"type:varchar(255);uniqueIndex;not null"`
-	PhoneNumber      string    `gorm:"type:varchar(20);uniqueIndex;not null"`
-	DateOfBirth      string    `gorm:"type:varchar(10)"`
-	Gender           int32     `gorm:"type:int"`
-	BloodGroup       int32     `gorm:"type:int"`
-	Address          string    `gorm:"type:text"`
-	MedicalHistory   string    `gorm:"type:text"`
-	EmergencyContact string    `gorm:"type:text"`
-	CreatedAt        time.Time `gorm:"autoCreateTime"`
-	UpdatedAt        time.Time `gorm:"autoUpdateTime"`
+	ID               string     `gorm:"primaryKey;type:varchar(36)"`
+	FirstName        string     `gorm:"type:varchar(100);not null"`
+	LastName         string     `gorm:"type:varchar(100);not null"`
+	Email            string     `gorm:"type:varchar(255);uniqueIndex;not null"`
+	PhoneNumber      string     `gorm:"type:varchar(20);uniqueIndex;not null"`
+	DateOfBirth      string     `gorm:"type:varchar(10)"`
+	Gender           int32      `gorm:"type:int"`
+	BloodGroup       int32      `gorm:"type:int"`
+	Address          string     `gorm:"type:text"`
+	MedicalHistory   string     `gorm:"type:text"`
+	EmergencyContact string     `gorm:"type:text"`
+	MergedInto       string     `gorm:"type:varchar(36);not null;default:'';index"`
+	MergedAt         *time.Time `gorm:"type:datetime"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time  `gorm:"autoUpdateTime"`
 }
 
 func (Patient) TableName() string {
@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"time"
+)
+
+// PatientExport is a request for a copy of everything held about a
+// patient. The archive is built in the background and kept until ExpiresAt.
+type PatientExport struct {
+	ID            string     `gorm:"primaryKey;type:varchar(36)"`
+	PatientID     string     `gorm:"type:varchar(36);not null;index"`
+	Status        string     `gorm:"type:varchar(20);not null;default:'pending';index"`
+	RequestedBy   string     `gorm:"type:varchar(100);not null"`
+	Error         string     `gorm:"type:text"`
+	ArchiveSize   int64      `gorm:"type:bigint;not null;default:0"`
+	ArchiveSHA256 string     `gorm:"type:varchar(64);not null;default:''"`
+	StartedAt     *time.Time `gorm:"type:datetime"`
+	CompletedAt   *time.Time `gorm:"type:datetime"`
+	ExpiresAt     *time.Time `gorm:"type:datetime;index"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime"`
+}
+
+func (PatientExport) TableName() string {
+	return "patient_exports"
+}
+
+// Patient export statuses. An export is pending until the job server picks
+// it up, and expired once its archive has been deleted.
+const (
+	PatientExportStatusPending   = "pending"
+	PatientExportStatusRunning   = "running"
+	PatientExportStatusCompleted = "completed"
+	PatientExportStatusFailed    = "failed"
+	PatientExportStatusExpired   = "expired"
+)
+
+// PatientAccess is one read of a patient's data. Actor is who the caller
+// said they were and Operation the API operation that was called.
+type PatientAccess struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)"`
+	PatientID  string    `gorm:"type:varchar(36);not null;index:idx_patient_access,priority:1"`
+	Actor      string    `gorm:"type:varchar(100);not null"`
+	Operation  string    `gorm:"type:varchar(200);not null;default:''"`
+	Resource   string    `gorm:"type:varchar(50);not null"`
+	ResourceID string    `gorm:"type:varchar(36);not null;default:''"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index:idx_patient_access,priority:2"`
+}
+
+func (PatientAccess) TableName() string {
+	return "patient_access_log"
+}
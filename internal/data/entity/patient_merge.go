@@ -0,0 +1,24 @@
+package entity
+
+import (
+	"time"
+)
+
+// PatientMerge is the audit record of a duplicate patient being merged into
+// a surviving one. MergedPatient holds the duplicate as it was before the
+// merge and MovedRecords the IDs of the rows that were reassigned, keyed by
+// table, so that a merge can be reviewed or undone by hand.
+type PatientMerge struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36)"`
+	SurvivorID    string    `gorm:"type:varchar(36);not null;index"`
+	MergedID      string    `gorm:"type:varchar(36);not null;uniqueIndex"`
+	MergedPatient string    `gorm:"type:text"`
+	MovedRecords  string    `gorm:"type:text"`
+	PerformedBy   string    `gorm:"type:varchar(100);not null"`
+	Reason        string    `gorm:"type:text"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+func (PatientMerge) TableName() string {
+	return "patient_merges"
+}
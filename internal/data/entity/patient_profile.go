@@ -0,0 +1,104 @@
+package entity
+
+import (
+	"time"
+)
+
+// ProfileItem holds the columns shared by every row of a patient's
+// structured profile.
+type ProfileItem struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	PatientID string    `gorm:"type:varchar(36);not null;index"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (p *ProfileItem) Item() *ProfileItem {
+	return p
+}
+
+// PatientProfileItem is a row in one of the patient profile tables.
+type PatientProfileItem interface {
+	TableName() string
+	Item() *ProfileItem
+}
+
+type PatientAllergy struct {
+	ProfileItem
+	Allergen string `gorm:"type:varchar(200);not null"`
+	Reaction string `gorm:"type:varchar(255)"`
+	Severity string `gorm:"type:varchar(20);not null"`
+	Notes    string `gorm:"type:text"`
+}
+
+func (PatientAllergy) TableName() string {
+	return "patient_allergies"
+}
+
+const (
+	AllergySeverityMild            = "mild"
+	AllergySeverityModerate        = "moderate"
+	AllergySeveritySevere          = "severe"
+	AllergySeverityLifeThreatening = "life_threatening"
+)
+
+type PatientCondition struct {
+	ProfileItem
+	Name        string `gorm:"type:varchar(200);not null"`
+	Code        string `gorm:"type:varchar(20)"`
+	Status      string `gorm:"type:varchar(20);not null"`
+	DiagnosedOn string `gorm:"type:varchar(10)"`
+	Notes       string `gorm:"type:text"`
+}
+
+func (PatientCondition) TableName() string {
+	return "patient_conditions"
+}
+
+const (
+	ConditionStatusActive      = "active"
+	ConditionStatusInRemission = "in_remission"
+	ConditionStatusResolved    = "resolved"
+)
+
+type PatientMedication struct {
+	ProfileItem
+	Name      string `gorm:"type:varchar(200);not null"`
+	Dosage    string `gorm:"type:varchar(100)"`
+	Frequency string `gorm:"type:varchar(100)"`
+	StartedOn string `gorm:"type:varchar(10)"`
+	EndedOn   string `gorm:"type:varchar(10)"`
+	Notes     string `gorm:"type:text"`
+}
+
+func (PatientMedication) TableName() string {
+	return "patient_medications"
+}
+
+type PatientEmergencyContact struct {
+	ProfileItem
+	Name         string `gorm:"type:varchar(200);not null"`
+	Relationship string `gorm:"type:varchar(50)"`
+	PhoneNumber  string `gorm:"type:varchar(20)"`
+	Email        string `gorm:"type:varchar(255)"`
+	IsPrimary    bool   `gorm:"type:boolean;default:false"`
+}
+
+func (PatientEmergencyContact) TableName() string {
+	return "patient_emergency_contacts"
+}
+
+type PatientInsurance struct {
+	ProfileItem
+	Provider     string `gorm:"type:varchar(200);not null"`
+	PolicyNumber string `gorm:"type:varchar(100);not null"`
+	GroupNumber  string `gorm:"type:varchar(100)"`
+	HolderName   string `gorm:"type:varchar(200)"`
+	ValidFrom    string `gorm:"type:varchar(10)"`
+	ValidUntil   string `gorm:"type:varchar(10)"`
+	IsPrimary    bool   `gorm:"type:boolean;default:false"`
+}
+
+func (PatientInsurance) TableName() string {
+	return "patient_insurance_policies"
+}
@@ -0,0 +1,19 @@
+package entity
+
+// PatientSearchToken indexes one normalized name token or phonetic code of a
+// patient's name, so fuzzy name searches can look up candidates by index
+// instead of scanning the patients table.
+type PatientSearchToken struct {
+	PatientID string `gorm:"primaryKey;type:varchar(36)"`
+	Kind      string `gorm:"primaryKey;type:varchar(10);index:idx_patient_search_token,priority:1"`
+	Token     string `gorm:"primaryKey;type:varchar(64);index:idx_patient_search_token,priority:2"`
+}
+
+func (PatientSearchToken) TableName() string {
+	return "patient_search_tokens"
+}
+
+const (
+	SearchTokenName     = "name"
+	SearchTokenPhonetic = "phonetic"
+)
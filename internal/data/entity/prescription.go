@@ -6,18 +6,29 @@ import (
 )
 
 type Prescription struct {
-	ID                     string    `gorm:"primaryKey;type:varchar(36)"`
-	AppointmentID          string    `gorm:"type:varchar(36);index"`
-	PatientID              string    `gorm:"type:varchar(36);not null;index"`
-	PatientName            string    `gorm:"type:varchar(200)"`
-	DoctorID               string    `gorm:"type:varchar(36);not null;index"`
-	DoctorName             string    `gorm:"type:varchar(200)"`
-	Medications            string    `gorm:"type:text"`
-	Diagnosis              string    `gorm:"type:text"`
-	AdditionalInstructions string    `gorm:"type:text"`
-	PrescriptionDate       time.Time `gorm:"type:datetime;not null"`
-	ValidUntil             time.Time `gorm:"type:datetime;not null"`
-	IsActive               bool      `gorm:"type:boolean;default:true"`
+	ID                     string     `gorm:"primaryKey;type:varchar(36)"`
+	AppointmentID          string     `gorm:"type:varchar(36);index"`
+	PatientID              string     `gorm:"type:varchar(36);not null;index"`
+	PatientName            string     `gorm:"type:varchar(200)"`
+	DoctorID               string     `gorm:"type:varchar(36);not null;index"`
+	DoctorName             string     `gorm:"type:varchar(200)"`
+	Medications            string     `gorm:"type:text"`
+	Diagnosis              string     `gorm:"type:text"`
+	AdditionalInstructions string     `gorm:"type:text"`
+	PrescriptionDate       time.Time  `gorm:"type:datetime;not null"`
+	ValidUntil             time.Time  `gorm:"type:datetime;not null"`
+	IsActive               bool       `gorm:"type:boolean;default:true"`
+	Status                 string     `gorm:"type:varchar(20);not null;default:'active';index"`
+	RefillsAllowed         int32      `gorm:"type:int;not null;default:0"`
+	RefillsUsed            int32      `gorm:"type:int;not null;default:0"`
+	RenewedFrom            string     `gorm:"type:varchar(36);not null;default:'';index"`
+	RevokedAt              *time.Time `gorm:"type:datetime"`
+	RevokedBy              string     `gorm:"type:varchar(36)"`
+	RevocationReason       string     `gorm:"type:text"`
+	VerificationCode       *string    `gorm:"type:varchar(32);uniqueIndex"`
+	AmendedFrom            string     `gorm:"type:varchar(36);not null;default:'';index"`
+	AmendmentReason        string     `gorm:"type:text"`
+	Signature              `gorm:"embedded"`
 	CreatedAt              time.Time `gorm:"autoCreateTime"`
 }
 
@@ -25,14 +36,93 @@ func (Prescription) TableName() string {
 	return "prescriptions"
 }
 
+// Prescription statuses. IsActive mirrors Status == active for callers that
+// only know the flag.
+const (
+	PrescriptionStatusActive  = "active"
+	PrescriptionStatusExpired = "expired"
+	PrescriptionStatusRevoked = "revoked"
+	PrescriptionStatusRenewed = "renewed"
+	PrescriptionStatusAmended = "amended"
+)
+
+// PrescriptionRefill records one dispensed refill of a prescription.
+type PrescriptionRefill struct {
+	ID             string    `gorm:"primaryKey;type:varchar(36)"`
+	PrescriptionID string    `gorm:"type:varchar(36);not null;index"`
+	Sequence       int32     `gorm:"type:int;not null"`
+	DispensedBy    string    `gorm:"type:varchar(200);not null"`
+	DispensedAt    time.Time `gorm:"type:datetime;not null"`
+	Notes          string    `gorm:"type:text"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+func (PrescriptionRefill) TableName() string {
+	return "prescription_refills"
+}
+
+// PrescriptionSafetyOverride records a prescriber accepting a safety warning
+// raised when the prescription was written, with their justification.
+type PrescriptionSafetyOverride struct {
+	ID             string    `gorm:"primaryKey;type:varchar(36)"`
+	PrescriptionID string    `gorm:"type:varchar(36);not null;index"`
+	PrescriberID   string    `gorm:"type:varchar(36);not null"`
+	Code           string    `gorm:"type:varchar(255);not null"`
+	Kind           string    `gorm:"type:varchar(30);not null"`
+	Severity       string    `gorm:"type:varchar(20)"`
+	Description    string    `gorm:"type:text"`
+	Justification  string    `gorm:"type:text;not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+func (PrescriptionSafetyOverride) TableName() string {
+	return "prescription_safety_overrides"
+}
+
+// PrescriptionItem is one medication on a prescription in structured form.
+// The dose, frequency and duration as originally written are kept next to
+// the parsed values; a parsed value is zero when the text could not be read,
+// which only happens for items backfilled from before validation.
+type PrescriptionItem struct {
+	ID             string    `gorm:"primaryKey;type:varchar(36)"`
+	PrescriptionID string    `gorm:"type:varchar(36);not null;index"`
+	Position       int32     `gorm:"type:int;not null"`
+	DrugCode       string    `gorm:"type:varchar(20);not null;default:'';index"`
+	DrugName       string    `gorm:"type:varchar(200)"`
+	MedicationName string    `gorm:"type:varchar(200);not null"`
+	DoseAmount     float64   `gorm:"type:decimal(10,3);not null;default:0"`
+	DoseUnit       string    `gorm:"type:varchar(20)"`
+	FrequencyCode  string    `gorm:"type:varchar(10);index"`
+	DurationDays   int32     `gorm:"type:int;not null;default:0"`
+	Route          string    `gorm:"type:varchar(20);index"`
+	Quantity       int32     `gorm:"type:int;not null;default:0"`
+	Instructions   string    `gorm:"type:text"`
+	DosageText     string    `gorm:"type:varchar(100)"`
+	FrequencyText  string    `gorm:"type:varchar(100)"`
+	DurationText   string    `gorm:"type:varchar(100)"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+func (PrescriptionItem) TableName() string {
+	return "prescription_items"
+}
+
+// Medication is a medication as written on a prescription. The structured
+// fields are optional on input; when they are missing they are parsed from
+// the free-text ones.
 type Medication struct {
-	MedicationName string `json:"medication_name"`
-	Dosage         string `json:"dosage"`
-	Frequency      string `json:"frequency"`
-	Duration       string `json:"duration"`
-	Route          string `json:"route"`
-	Instructions   string `json:"instructions"`
-	Quantity       int32  `json:"quantity"`
+	MedicationName string  `json:"medication_name"`
+	Dosage         string  `json:"dosage"`
+	Frequency      string  `json:"frequency"`
+	Duration       string  `json:"duration"`
+	Route          string  `json:"route"`
+	Instructions   string  `json:"instructions"`
+	Quantity       int32   `json:"quantity"`
+	DrugCode       string  `json:"drug_code,omitempty"`
+	DoseAmount     float64 `json:"dose_amount,omitempty"`
+	DoseUnit       string  `json:"dose_unit,omitempty"`
+	FrequencyCode  string  `json:"frequency_code,omitempty"`
+	DurationDays   int32   `json:"duration_days,omitempty"`
 }
 
 func MarshalMedications(meds []*Medication) string {
@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"time"
+)
+
+type Equipment struct {
+	ID        string    `gorm:"primaryKey;type:varchar(36)"`
+	ClinicID  string    `gorm:"type:varchar(36);not null;index"`
+	RoomID    string    `gorm:"type:varchar(36);not null;default:''"`
+	Type      string    `gorm:"type:varchar(50);not null;index"`
+	Name      string    `gorm:"type:varchar(100)"`
+	IsActive  bool      `gorm:"type:boolean;default:true"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Equipment) TableName() string {
+	return "clinic_equipment"
+}
+
+type ResourceBooking struct {
+	ID            string    `gorm:"primaryKey;type:varchar(36)"`
+	AppointmentID string    `gorm:"type:varchar(36);not null;index"`
+	ClinicID      string    `gorm:"type:varchar(36);not null;index"`
+	ResourceType  string    `gorm:"type:varchar(20);not null"`
+	ResourceID    string    `gorm:"type:varchar(36);not null;index"`
+	StartsAt      time.Time `gorm:"type:datetime;not null;index"`
+	EndsAt        time.Time `gorm:"type:datetime;not null"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+func (ResourceBooking) TableName() string {
+	return "resource_bookings"
+}
+
+const (
+	ResourceTypeRoom      = "room"
+	ResourceTypeEquipment = "equipment"
+)
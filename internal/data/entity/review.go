@@ -0,0 +1,36 @@
+package entity
+
+import (
+	"time"
+)
+
+type Review struct {
+	ID             string    `gorm:"primaryKey;type:varchar(36)"`
+	AppointmentID  string    `gorm:"type:varchar(36);not null;uniqueIndex"`
+	DoctorID       string    `gorm:"type:varchar(36);not null;index"`
+	PatientID      string    `gorm:"type:varchar(36);not null;index"`
+	PatientName    string    `gorm:"type:varchar(200)"`
+	Rating         int32     `gorm:"type:int;not null"`
+	Comment        string    `gorm:"type:text"`
+	Status         string    `gorm:"type:varchar(20);not null;default:'published';index"`
+	ModerationNote string    `gorm:"type:text"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
+}
+
+func (Review) TableName() string {
+	return "doctor_reviews"
+}
+
+// Published and flagged reviews count towards the doctor's rating; hidden
+// ones do not.
+const (
+	ReviewStatusPublished = "published"
+	ReviewStatusFlagged   = "flagged"
+	ReviewStatusHidden    = "hidden"
+)
+
+const (
+	MinReviewRating = 1
+	MaxReviewRating = 5
+)
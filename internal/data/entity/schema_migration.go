@@ -0,0 +1,14 @@
+package entity
+
+import (
+	"time"
+)
+
+type SchemaMigration struct {
+	ID        string    `gorm:"primaryKey;type:varchar(100)"`
+	AppliedAt time.Time `gorm:"type:datetime;not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
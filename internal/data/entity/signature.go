@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"time"
+)
+
+// Signature is a doctor's signature over the canonical content of the row it
+// is embedded in. A row signed once is never edited again; amending it means
+// writing a new signed row.
+type Signature struct {
+	SignedBy           string     `gorm:"type:varchar(36);not null;default:''"`
+	SignedAt           *time.Time `gorm:"type:datetime"`
+	SignatureAlgorithm string     `gorm:"type:varchar(20);not null;default:''"`
+	SignatureKeyID     string     `gorm:"type:varchar(32);not null;default:''"`
+	SignatureValue     string     `gorm:"type:varchar(128);not null;default:''"`
+}
+
+// Signed reports whether the row carries a signature.
+func (s Signature) Signed() bool {
+	return s.SignatureValue != ""
+}
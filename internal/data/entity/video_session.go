@@ -0,0 +1,26 @@
+package entity
+
+import (
+	"time"
+)
+
+type VideoSession struct {
+	ID                string     `gorm:"primaryKey;type:varchar(36)"`
+	AppointmentID     string     `gorm:"type:varchar(36);not null;uniqueIndex"`
+	Provider          string     `gorm:"type:varchar(50);not null"`
+	ProviderSessionID string     `gorm:"type:varchar(255);not null"`
+	JoinURL           string     `gorm:"type:varchar(500)"`
+	Status            string     `gorm:"type:varchar(20);not null"`
+	EndedAt           *time.Time `gorm:"type:datetime"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt         time.Time  `gorm:"autoUpdateTime"`
+}
+
+func (VideoSession) TableName() string {
+	return "video_sessions"
+}
+
+const (
+	VideoSessionStatusActive = "active"
+	VideoSessionStatusEnded  = "ended"
+)
@@ -0,0 +1,24 @@
+package entity
+
+import (
+	"time"
+)
+
+// VitalSign is a single vital sign observation, stored in the canonical
+// unit of its code. Observations taken as part of a medical record point at
+// the record version they came from; those entered on their own do not.
+type VitalSign struct {
+	ID              string    `gorm:"primaryKey;type:varchar(36)"`
+	PatientID       string    `gorm:"type:varchar(36);not null;index:idx_vital_signs_series,priority:1"`
+	Code            string    `gorm:"type:varchar(30);not null;index:idx_vital_signs_series,priority:2"`
+	ObservedAt      time.Time `gorm:"type:datetime;not null;index:idx_vital_signs_series,priority:3"`
+	Value           float64   `gorm:"type:decimal(8,2);not null"`
+	Unit            string    `gorm:"type:varchar(20);not null"`
+	RecordedBy      string    `gorm:"type:varchar(36)"`
+	MedicalRecordID string    `gorm:"type:varchar(36);not null;default:'';index"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+}
+
+func (VitalSign) TableName() string {
+	return "vital_signs"
+}
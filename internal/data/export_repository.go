@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"gorm.io/gorm"
+)
+
+// ExportRepo reads whole tables in batches for CSV export, so an export
+// never holds more than one batch in memory. Rows come in primary key order;
+// the from (inclusive) and to (exclusive) filters bound each table's main
+// date.
+type ExportRepo interface {
+	EachPatient(ctx context.Context, filters map[string]interface{}, batchSize int, fn func([]*entity.Patient) error) error
+	EachDoctor(ctx context.Context, filters map[string]interface{}, batchSize int, fn func([]*entity.Doctor) error) error
+	EachAppointment(ctx context.Context, filters map[string]interface{}, batchSize int, fn func([]*entity.Appointment) error) error
+	// EachPrescription passes each batch of prescriptions with their items,
+	// keyed by prescription ID and in position order.
+	EachPrescription(ctx context.Context, filters map[string]interface{}, batchSize int, fn func([]*entity.Prescription, map[string][]*entity.PrescriptionItem) error) error
+}
+
+type exportRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewExportRepo(data *Data, logger log.Logger) ExportRepo {
+	return &exportRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *exportRepo) EachPatient(ctx context.Context, filters map[string]interface{}, batchSize int, fn func([]*entity.Patient) error) error {
+	var patients []*entity.Patient
+	query := matchPeriod(r.data.DB(ctx).Model(&entity.Patient{}), "created_at", filters)
+
+	err := query.FindInBatches(&patients, batchSize, func(*gorm.DB, int) error {
+		return fn(patients)
+	}).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to export patients: %v", err)
+		return fmt.Errorf("failed to export patients: %w", err)
+	}
+	return nil
+}
+
+func (r *exportRepo) EachDoctor(ctx context.Context, filters map[string]interface{}, batchSize int, fn func([]*entity.Doctor) error) error {
+	var doctors []*entity.Doctor
+	query := matchPeriod(r.data.DB(ctx).Model(&entity.Doctor{}), "created_at", filters)
+
+	err := query.FindInBatches(&doctors, batchSize, func(*gorm.DB, int) error {
+		return fn(doctors)
+	}).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to export doctors: %v", err)
+		return fmt.Errorf("failed to export doctors: %w", err)
+	}
+	return nil
+}
+
+func (r *exportRepo) EachAppointment(ctx context.Context, filters map[string]interface{}, batchSize int, fn func([]*entity.Appointment) error) error {
+	var appointments []*entity.Appointment
+	query := matchPeriod(r.data.DB(ctx).Model(&entity.Appointment{}), "starts_at", filters)
+
+	err := query.FindInBatches(&appointments, batchSize, func(*gorm.DB, int) error {
+		return fn(appointments)
+	}).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to export appointments: %v", err)
+		return fmt.Errorf("failed to export appointments: %w", err)
+	}
+	return nil
+}
+
+func (r *exportRepo) EachPrescription(ctx context.Context, filters map[string]interface{}, batchSize int, fn func([]*entity.Prescription, map[string][]*entity.PrescriptionItem) error) error {
+	var prescriptions []*entity.Prescription
+	query := matchPeriod(r.data.DB(ctx).Model(&entity.Prescription{}), "prescription_date", filters)
+
+	err := query.FindInBatches(&prescriptions, batchSize, func(*gorm.DB, int) error {
+		ids := make([]string, len(prescriptions))
+		for i, p := range prescriptions {
+			ids[i] = p.ID
+		}
+		var items []*entity.PrescriptionItem
+		if err := r.data.DB(ctx).Where("prescription_id IN ?", ids).Order("position ASC").Find(&items).Error; err != nil {
+			return err
+		}
+		byPrescription := make(map[string][]*entity.PrescriptionItem, len(ids))
+		for _, item := range items {
+			byPrescription[item.PrescriptionID] = append(byPrescription[item.PrescriptionID], item)
+		}
+		return fn(prescriptions, byPrescription)
+	}).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to export prescriptions: %v", err)
+		return fmt.Errorf("failed to export prescriptions: %w", err)
+	}
+	return nil
+}
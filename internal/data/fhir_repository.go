@@ -0,0 +1,282 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"gorm.io/gorm"
+)
+
+// TextMatch is a string search value. By default it matches values that
+// start with it; Exact and Contains change that.
+type TextMatch struct {
+	Value    string
+	Exact    bool
+	Contains bool
+}
+
+func (m TextMatch) pattern() string {
+	switch {
+	case m.Exact:
+		return m.Value
+	case m.Contains:
+		return "%" + m.Value + "%"
+	}
+	return m.Value + "%"
+}
+
+func (m TextMatch) operator() string {
+	if m.Exact {
+		return "="
+	}
+	return "LIKE"
+}
+
+// FHIRRepo runs the paged searches behind the FHIR API. Each search returns
+// one page of rows in a stable order together with the total number of
+// matches.
+type FHIRRepo interface {
+	SearchPatients(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.Patient, int64, error)
+	SearchDoctors(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.Doctor, int64, error)
+	SearchAppointments(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.Appointment, int64, error)
+	SearchPrescriptionItems(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.PrescriptionItem, int64, error)
+	SearchMedicalRecords(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.MedicalRecord, int64, error)
+	GetPrescriptions(ctx context.Context, ids []string) ([]*entity.Prescription, error)
+}
+
+type fhirRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewFHIRRepo(data *Data, logger log.Logger) FHIRRepo {
+	return &fhirRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *fhirRepo) SearchPatients(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.Patient, int64, error) {
+	var patients []*entity.Patient
+	query := r.data.DB(ctx).Model(&entity.Patient{})
+
+	if id, ok := filters["id"]; ok {
+		query = query.Where("id = ?", id)
+	}
+	query = matchName(query, filters)
+	if email, ok := filters["email"]; ok {
+		query = query.Where("email = ?", email)
+	}
+	if phone, ok := filters["phone"]; ok {
+		query = query.Where("phone_number = ?", phone)
+	}
+	if gender, ok := filters["gender"]; ok {
+		query = query.Where("gender = ?", gender)
+	}
+	if from, ok := filters["birthdate_from"]; ok {
+		query = query.Where("date_of_birth <> '' AND date_of_birth >= ?", from)
+	}
+	if to, ok := filters["birthdate_to"]; ok {
+		query = query.Where("date_of_birth <> '' AND date_of_birth < ?", to)
+	}
+	if active, ok := filters["active"]; ok {
+		if active.(bool) {
+			query = query.Where("merged_into = ''")
+		} else {
+			query = query.Where("merged_into <> ''")
+		}
+	}
+
+	total, err := r.page(query, &patients, offset, limit)
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to search patients: %v", err)
+		return nil, 0, fmt.Errorf("failed to search patients: %w", err)
+	}
+	return patients, total, nil
+}
+
+func (r *fhirRepo) SearchDoctors(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.Doctor, int64, error) {
+	var doctors []*entity.Doctor
+	query := r.data.DB(ctx).Model(&entity.Doctor{})
+
+	if id, ok := filters["id"]; ok {
+		query = query.Where("id = ?", id)
+	}
+	query = matchName(query, filters)
+	if email, ok := filters["email"]; ok {
+		query = query.Where("email = ?", email)
+	}
+	if phone, ok := filters["phone"]; ok {
+		query = query.Where("phone_number = ?", phone)
+	}
+	if license, ok := filters["license_number"]; ok {
+		query = query.Where("license_number = ?", license)
+	}
+
+	total, err := r.page(query, &doctors, offset, limit)
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to search doctors: %v", err)
+		return nil, 0, fmt.Errorf("failed to search doctors: %w", err)
+	}
+	return doctors, total, nil
+}
+
+func (r *fhirRepo) SearchAppointments(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.Appointment, int64, error) {
+	var appointments []*entity.Appointment
+	query := r.data.DB(ctx).Model(&entity.Appointment{})
+
+	if id, ok := filters["id"]; ok {
+		query = query.Where("id = ?", id)
+	}
+	if patientID, ok := filters["patient_id"]; ok {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if doctorID, ok := filters["doctor_id"]; ok {
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+	if statuses, ok := filters["statuses"]; ok {
+		query = query.Where("status IN ?", statuses)
+	}
+	query = matchPeriod(query, "starts_at", filters)
+
+	total, err := r.page(query, &appointments, offset, limit)
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to search appointments: %v", err)
+		return nil, 0, fmt.Errorf("failed to search appointments: %w", err)
+	}
+	return appointments, total, nil
+}
+
+// SearchPrescriptionItems searches medication items, filtering on the
+// prescriptions they belong to.
+func (r *fhirRepo) SearchPrescriptionItems(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.PrescriptionItem, int64, error) {
+	var items []*entity.PrescriptionItem
+	query := r.data.DB(ctx).Model(&entity.PrescriptionItem{})
+
+	if id, ok := filters["id"]; ok {
+		query = query.Where("id = ?", id)
+	}
+	if code, ok := filters["drug_code"]; ok {
+		query = query.Where("drug_code = ?", code)
+	}
+
+	prescriptions := r.data.DB(ctx).Session(&gorm.Session{NewDB: true}).Model(&entity.Prescription{}).Select("id")
+	filtered := false
+	if patientID, ok := filters["patient_id"]; ok {
+		prescriptions, filtered = prescriptions.Where("patient_id = ?", patientID), true
+	}
+	if doctorID, ok := filters["doctor_id"]; ok {
+		prescriptions, filtered = prescriptions.Where("doctor_id = ?", doctorID), true
+	}
+	if statuses, ok := filters["statuses"]; ok {
+		prescriptions, filtered = prescriptions.Where("status IN ?", statuses), true
+	}
+	if from, ok := filters["from"]; ok {
+		prescriptions, filtered = prescriptions.Where("prescription_date >= ?", from), true
+	}
+	if to, ok := filters["to"]; ok {
+		prescriptions, filtered = prescriptions.Where("prescription_date < ?", to), true
+	}
+	if filtered {
+		query = query.Where("prescription_id IN (?)", prescriptions)
+	}
+
+	total, err := r.page(query, &items, offset, limit)
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to search prescription items: %v", err)
+		return nil, 0, fmt.Errorf("failed to search prescription items: %w", err)
+	}
+	return items, total, nil
+}
+
+// SearchMedicalRecords searches the current versions of medical records;
+// versions replaced by an amendment are left out.
+func (r *fhirRepo) SearchMedicalRecords(ctx context.Context, filters map[string]interface{}, offset, limit int) ([]*entity.MedicalRecord, int64, error) {
+	var records []*entity.MedicalRecord
+	query := r.data.DB(ctx).Model(&entity.MedicalRecord{}).Where("status <> ?", entity.MedicalRecordStatusAmended)
+
+	if id, ok := filters["id"]; ok {
+		query = query.Where("id = ?", id)
+	}
+	if patientID, ok := filters["patient_id"]; ok {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if doctorID, ok := filters["doctor_id"]; ok {
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+	if statuses, ok := filters["statuses"]; ok {
+		query = query.Where("status IN ?", statuses)
+	}
+	if _, ok := filters["has_diagnosis"]; ok {
+		query = query.Where("diagnosis IS NOT NULL AND diagnosis <> ''")
+	}
+	query = matchPeriod(query, "visit_date", filters)
+
+	total, err := r.page(query, &records, offset, limit)
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to search medical records: %v", err)
+		return nil, 0, fmt.Errorf("failed to search medical records: %w", err)
+	}
+	return records, total, nil
+}
+
+func (r *fhirRepo) GetPrescriptions(ctx context.Context, ids []string) ([]*entity.Prescription, error) {
+	var prescriptions []*entity.Prescription
+	if len(ids) == 0 {
+		return prescriptions, nil
+	}
+
+	if err := r.data.DB(ctx).Where("id IN ?", ids).Find(&prescriptions).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get prescriptions: %v", err)
+		return nil, fmt.Errorf("failed to get prescriptions: %w", err)
+	}
+	return prescriptions, nil
+}
+
+// page counts the rows query matches and loads one page of them into dest,
+// oldest first. A limit of zero only counts.
+func (r *fhirRepo) page(query *gorm.DB, dest interface{}, offset, limit int) (int64, error) {
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return 0, err
+	}
+	if limit == 0 || int64(offset) >= total {
+		return total, nil
+	}
+	err := query.Session(&gorm.Session{}).
+		Order("created_at ASC").Order("id ASC").
+		Offset(offset).Limit(limit).
+		Find(dest).Error
+	return total, err
+}
+
+// matchName applies the name, family and given filters to a table with
+// first_name and last_name columns.
+func matchName(query *gorm.DB, filters map[string]interface{}) *gorm.DB {
+	if m, ok := filters["name"].(TextMatch); ok {
+		query = query.Where("first_name "+m.operator()+" ? OR last_name "+m.operator()+" ? OR CONCAT(first_name, ' ', last_name) "+m.operator()+" ?",
+			m.pattern(), m.pattern(), m.pattern())
+	}
+	if m, ok := filters["family"].(TextMatch); ok {
+		query = query.Where("last_name "+m.operator()+" ?", m.pattern())
+	}
+	if m, ok := filters["given"].(TextMatch); ok {
+		query = query.Where("first_name "+m.operator()+" ?", m.pattern())
+	}
+	return query
+}
+
+// matchPeriod applies the from (inclusive) and to (exclusive) filters to a
+// datetime column.
+func matchPeriod(query *gorm.DB, column string, filters map[string]interface{}) *gorm.DB {
+	if from, ok := filters["from"].(time.Time); ok {
+		query = query.Where(column+" >= ?", from)
+	}
+	if to, ok := filters["to"].(time.Time); ok {
+		query = query.Where(column+" < ?", to)
+	}
+	return query
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+type ImportRepo interface {
+	GetImported(ctx context.Context, resourceType, system, value string) (*entity.ImportedResource, error)
+	CreateImported(ctx context.Context, links []*entity.ImportedResource) error
+}
+
+type importRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewImportRepo(data *Data, logger log.Logger) ImportRepo {
+	return &importRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *importRepo) GetImported(ctx context.Context, resourceType, system, value string) (*entity.ImportedResource, error) {
+	var links []*entity.ImportedResource
+
+	err := r.data.DB(ctx).
+		Where("resource_type = ? AND system = ? AND value = ?", resourceType, system, value).
+		Limit(1).Find(&links).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get imported resource: %v", err)
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+	return links[0], nil
+}
+
+// CreateImported records links, leaving identifiers that are already linked
+// as they are.
+func (r *importRepo) CreateImported(ctx context.Context, links []*entity.ImportedResource) error {
+	if len(links) == 0 {
+		return nil
+	}
+	for _, link := range links {
+		if link.ID == "" {
+			link.ID = uuid.New().String()
+		}
+	}
+
+	if err := r.data.DB(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(links).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create imported resources: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LabRepo interface {
+	CreateOrder(ctx context.Context, order *entity.LabOrder, tests []*entity.LabOrderTest) error
+	GetOrder(ctx context.Context, id string) (*entity.LabOrder, error)
+	GetOrdersByPatient(ctx context.Context, patientID string) ([]*entity.LabOrder, error)
+	LockOrder(ctx context.Context, id string) error
+	SetOrderStatus(ctx context.Context, id, status string) error
+	GetOrderTests(ctx context.Context, orderID string) ([]*entity.LabOrderTest, error)
+	GetMessage(ctx context.Context, source, externalID string) (*entity.LabMessage, error)
+	CreateMessage(ctx context.Context, message *entity.LabMessage) error
+	CreateResults(ctx context.Context, results []*entity.LabResult) error
+	GetResult(ctx context.Context, id string) (*entity.LabResult, error)
+	GetResults(ctx context.Context, filters map[string]interface{}) ([]*entity.LabResult, error)
+	Supersede(ctx context.Context, orderID, testCode, byID string) error
+	MarkReviewed(ctx context.Context, id, by, note string, at time.Time) error
+}
+
+type labRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewLabRepo(data *Data, logger log.Logger) LabRepo {
+	return &labRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *labRepo) CreateOrder(ctx context.Context, order *entity.LabOrder, tests []*entity.LabOrderTest) error {
+	if order.ID == "" {
+		order.ID = uuid.New().String()
+	}
+	for _, t := range tests {
+		if t.ID == "" {
+			t.ID = uuid.New().String()
+		}
+		t.OrderID = order.ID
+	}
+
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		return tx.Create(&tests).Error
+	})
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create lab order: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *labRepo) GetOrder(ctx context.Context, id string) (*entity.LabOrder, error) {
+	var order entity.LabOrder
+	if err := r.data.DB(ctx).Where("id = ?", id).First(&order).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.log.WithContext(ctx).Errorf("failed to get lab order: %v", err)
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetOrdersByPatient returns the patient's lab orders, oldest first.
+func (r *labRepo) GetOrdersByPatient(ctx context.Context, patientID string) ([]*entity.LabOrder, error) {
+	var orders []*entity.LabOrder
+	if err := r.data.DB(ctx).Where("patient_id = ?", patientID).Order("ordered_at ASC").Find(&orders).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get patient lab orders: %v", err)
+		return nil, err
+	}
+	return orders, nil
+}
+
+// LockOrder takes a row lock on the order for the rest of the surrounding
+// transaction, so that results for one order are ingested one batch at a
+// time.
+func (r *labRepo) LockOrder(ctx context.Context, id string) error {
+	var orders []*entity.LabOrder
+
+	if err := r.data.DB(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", id).Find(&orders).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to lock lab order: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *labRepo) SetOrderStatus(ctx context.Context, id, status string) error {
+	if err := r.data.DB(ctx).Model(&entity.LabOrder{}).Where("id = ?", id).Update("status", status).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to update lab order status: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *labRepo) GetOrderTests(ctx context.Context, orderID string) ([]*entity.LabOrderTest, error) {
+	var tests []*entity.LabOrderTest
+
+	if err := r.data.DB(ctx).Where("order_id = ?", orderID).Order("position ASC").Find(&tests).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get lab order tests: %v", err)
+		return nil, fmt.Errorf("failed to get lab order tests: %w", err)
+	}
+	return tests, nil
+}
+
+func (r *labRepo) GetMessage(ctx context.Context, source, externalID string) (*entity.LabMessage, error) {
+	var messages []*entity.LabMessage
+
+	if err := r.data.DB(ctx).Where("source = ? AND external_id = ?", source, externalID).Limit(1).Find(&messages).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get lab message: %v", err)
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	return messages[0], nil
+}
+
+func (r *labRepo) CreateMessage(ctx context.Context, message *entity.LabMessage) error {
+	if message.ID == "" {
+		message.ID = uuid.New().String()
+	}
+	if message.ExternalID == "" {
+		message.ExternalID = message.ID
+	}
+
+	if err := r.data.DB(ctx).Create(message).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create lab message: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *labRepo) CreateResults(ctx context.Context, results []*entity.LabResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	for _, result := range results {
+		if result.ID == "" {
+			result.ID = uuid.New().String()
+		}
+	}
+
+	if err := r.data.DB(ctx).Create(&results).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create lab results: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *labRepo) GetResult(ctx context.Context, id string) (*entity.LabResult, error) {
+	var result entity.LabResult
+	if err := r.data.DB(ctx).Where("id = ?", id).First(&result).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.log.WithContext(ctx).Errorf("failed to get lab result: %v", err)
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetResults returns the results matching filters, newest observation first.
+// Superseded results are left out unless include_superseded is set.
+func (r *labRepo) GetResults(ctx context.Context, filters map[string]interface{}) ([]*entity.LabResult, error) {
+	var results []*entity.LabResult
+	query := r.data.DB(ctx)
+
+	if orderID, ok := filters["order_id"]; ok {
+		query = query.Where("order_id = ?", orderID)
+	}
+	if patientID, ok := filters["patient_id"]; ok {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if doctorID, ok := filters["doctor_id"]; ok {
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+	if testCode, ok := filters["test_code"]; ok {
+		query = query.Where("test_code = ?", testCode)
+	}
+	if from, ok := filters["from"]; ok {
+		query = query.Where("observed_at >= ?", from)
+	}
+	if to, ok := filters["to"]; ok {
+		query = query.Where("observed_at <= ?", to)
+	}
+	if abnormal, ok := filters["abnormal"]; ok {
+		query = query.Where("abnormal = ?", abnormal)
+	}
+	if unreviewed, ok := filters["unreviewed"]; ok && unreviewed.(bool) {
+		query = query.Where("reviewed_at IS NULL")
+	}
+	if _, ok := filters["include_superseded"]; !ok {
+		query = query.Where("superseded_by = ''")
+	}
+
+	if err := query.Order("observed_at DESC").Find(&results).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get lab results: %v", err)
+		return nil, fmt.Errorf("failed to get lab results: %w", err)
+	}
+	return results, nil
+}
+
+// Supersede points the order's current results for testCode at the result
+// byID that replaces them.
+func (r *labRepo) Supersede(ctx context.Context, orderID, testCode, byID string) error {
+	err := r.data.DB(ctx).Model(&entity.LabResult{}).
+		Where("order_id = ? AND test_code = ? AND superseded_by = '' AND id <> ?", orderID, testCode, byID).
+		Update("superseded_by", byID).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to supersede lab results: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *labRepo) MarkReviewed(ctx context.Context, id, by, note string, at time.Time) error {
+	result := r.data.DB(ctx).Model(&entity.LabResult{}).
+		Where("id = ? AND reviewed_at IS NULL", id).
+		Updates(map[string]interface{}{
+			"reviewed_at": at,
+			"reviewed_by": by,
+			"review_note": note,
+		})
+	if result.Error != nil {
+		r.log.WithContext(ctx).Errorf("failed to mark lab result reviewed: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("lab result already reviewed")
+	}
+	return nil
+}
@@ -2,20 +2,32 @@ package data
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/arm-1234/medical-service/internal/data/entity"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrMedicalRecordNotEditable is returned when a write would change a
+// medical record that is no longer in the status the write expects.
+var ErrMedicalRecordNotEditable = errors.New("medical record is not editable")
+
+// MedicalRecordRepo stores medical records append-only: rows are only ever
+// written while they are drafts, and afterwards only their status changes.
 type MedicalRecordRepo interface {
 	Create(ctx context.Context, record *entity.MedicalRecord) error
 	Get(ctx context.Context, id string) (*entity.MedicalRecord, error)
 	GetByPatientID(ctx context.Context, patientID string, filters map[string]interface{}) ([]*entity.MedicalRecord, error)
-	Update(ctx context.Context, record *entity.MedicalRecord) error
-	Delete(ctx context.Context, id string) error
+	GetVersions(ctx context.Context, originalID string) ([]*entity.MedicalRecord, error)
+	UpdateDraft(ctx context.Context, record *entity.MedicalRecord) error
+	MarkAmended(ctx context.Context, id string) error
+	MarkEnteredInError(ctx context.Context, id, by, reason string, at time.Time) error
+	Lock(ctx context.Context, id string) error
 }
 
 type medicalRecordRepo struct {
@@ -34,8 +46,14 @@ func (r *medicalRecordRepo) Create(ctx context.Context, record *entity.MedicalRe
 	if record.ID == "" {
 		record.ID = uuid.New().String()
 	}
+	if record.OriginalID == "" {
+		record.OriginalID = record.ID
+	}
+	if record.Version == 0 {
+		record.Version = 1
+	}
 
-	if err := r.data.db.WithContext(ctx).Create(record).Error; err != nil {
+	if err := r.data.DB(ctx).Create(record).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to create medical record: %v", err)
 		return err
 	}
@@ -44,7 +62,7 @@ func (r *medicalRecordRepo) Create(ctx context.Context, record *entity.MedicalRe
 
 func (r *medicalRecordRepo) Get(ctx context.Context, id string) (*entity.MedicalRecord, error) {
 	var record entity.MedicalRecord
-	if err := r.data.db.WithContext(ctx).Where("id = ?", id).First(&record).Error; err != nil {
+	if err := r.data.DB(ctx).Where("id = ?", id).First(&record).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -56,7 +74,7 @@ func (r *medicalRecordRepo) Get(ctx context.Context, id string) (*entity.Medical
 
 func (r *medicalRecordRepo) GetByPatientID(ctx context.Context, patientID string, filters map[string]interface{}) ([]*entity.MedicalRecord, error) {
 	var records []*entity.MedicalRecord
-	query := r.data.db.WithContext(ctx).Where("patient_id = ?", patientID)
+	query := r.data.DB(ctx).Where("patient_id = ?", patientID)
 
 	if fromDate, ok := filters["from_date"]; ok {
 		query = query.Where("visit_date >= ?", fromDate)
@@ -67,6 +85,9 @@ func (r *medicalRecordRepo) GetByPatientID(ctx context.Context, patientID string
 	if recordType, ok := filters["record_type"]; ok {
 		query = query.Where("record_type = ?", recordType)
 	}
+	if status, ok := filters["status"]; ok {
+		query = query.Where("status = ?", status)
+	}
 
 	if err := query.Order("visit_date DESC").Find(&records).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to get medical records: %v", err)
@@ -76,17 +97,74 @@ func (r *medicalRecordRepo) GetByPatientID(ctx context.Context, patientID string
 	return records, nil
 }
 
-func (r *medicalRecordRepo) Update(ctx context.Context, record *entity.MedicalRecord) error {
-	if err := r.data.db.WithContext(ctx).Save(record).Error; err != nil {
-		r.log.WithContext(ctx).Errorf("failed to update medical record: %v", err)
-		return err
+// GetVersions returns every version of a record, oldest first.
+func (r *medicalRecordRepo) GetVersions(ctx context.Context, originalID string) ([]*entity.MedicalRecord, error) {
+	var records []*entity.MedicalRecord
+
+	if err := r.data.DB(ctx).Where("original_id = ?", originalID).Order("version ASC").Find(&records).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get medical record versions: %v", err)
+		return nil, fmt.Errorf("failed to get medical record versions: %w", err)
+	}
+
+	return records, nil
+}
+
+// UpdateDraft writes the record over its stored row, provided the stored row
+// is still a draft. Finalizing a draft goes through here too.
+func (r *medicalRecordRepo) UpdateDraft(ctx context.Context, record *entity.MedicalRecord) error {
+	result := r.data.DB(ctx).Model(record).
+		Where("status = ?", entity.MedicalRecordStatusDraft).
+		Select("*").Omit("id", "created_at").
+		Updates(record)
+	if result.Error != nil {
+		r.log.WithContext(ctx).Errorf("failed to update medical record: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMedicalRecordNotEditable
+	}
+	return nil
+}
+
+// MarkAmended records that a final version has been replaced by a newer one.
+func (r *medicalRecordRepo) MarkAmended(ctx context.Context, id string) error {
+	return r.setStatus(ctx, id, []string{entity.MedicalRecordStatusFinal}, map[string]interface{}{
+		"status": entity.MedicalRecordStatusAmended,
+	})
+}
+
+// MarkEnteredInError retracts a draft or final record in place of deleting
+// it.
+func (r *medicalRecordRepo) MarkEnteredInError(ctx context.Context, id, by, reason string, at time.Time) error {
+	return r.setStatus(ctx, id, []string{entity.MedicalRecordStatusDraft, entity.MedicalRecordStatusFinal}, map[string]interface{}{
+		"status":                  entity.MedicalRecordStatusEnteredInError,
+		"entered_in_error_at":     at,
+		"entered_in_error_by":     by,
+		"entered_in_error_reason": reason,
+	})
+}
+
+func (r *medicalRecordRepo) setStatus(ctx context.Context, id string, from []string, updates map[string]interface{}) error {
+	result := r.data.DB(ctx).Model(&entity.MedicalRecord{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(updates)
+	if result.Error != nil {
+		r.log.WithContext(ctx).Errorf("failed to update medical record status: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMedicalRecordNotEditable
 	}
 	return nil
 }
 
-func (r *medicalRecordRepo) Delete(ctx context.Context, id string) error {
-	if err := r.data.db.WithContext(ctx).Delete(&entity.MedicalRecord{}, "id = ?", id).Error; err != nil {
-		r.log.WithContext(ctx).Errorf("failed to delete medical record: %v", err)
+// Lock takes a row lock on the record for the rest of the surrounding
+// transaction, so that concurrent amendments serialize.
+func (r *medicalRecordRepo) Lock(ctx context.Context, id string) error {
+	var records []*entity.MedicalRecord
+
+	if err := r.data.DB(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", id).Find(&records).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to lock medical record: %v", err)
 		return err
 	}
 	return nil
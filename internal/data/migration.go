@@ -0,0 +1,326 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/formulary"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// migration is a one-off data migration that runs after AutoMigrate has
+// brought the schema up to date. Each migration runs at most once, inside a
+// transaction, and is recorded in schema_migrations.
+type migration struct {
+	id string
+	up func(tx *gorm.DB) error
+}
+
+// migrations lists the data migrations in the order they run. Migrations
+// that need reference data or configuration get it from the arguments.
+func migrations(f *formulary.Formulary, legacyLoc *time.Location) []migration {
+	return []migration{
+		{id: "20261018_convert_local_timestamps_to_utc", up: convertLocalTimestampsToUTC(legacyLoc)},
+		{id: "20261018_backfill_appointment_instants", up: backfillAppointmentInstants(legacyLoc)},
+		{id: "20261018_backfill_doctor_languages", up: backfillDoctorLanguages},
+		{id: "20261018_build_patient_search_index", up: buildPatientSearchIndex},
+		{id: "20261018_split_legacy_emergency_contacts", up: splitLegacyEmergencyContacts},
+		{id: "20261018_backfill_prescription_items", up: backfillPrescriptionItems(f)},
+		{id: "20261018_backfill_medical_record_versions", up: backfillMedicalRecordVersions},
+		{id: "20261018_backfill_vital_signs", up: backfillVitalSigns},
+	}
+}
+
+func runMigrations(db *gorm.DB, f *formulary.Formulary, legacyLoc *time.Location, log *log.Helper) error {
+	for _, m := range migrations(f, legacyLoc) {
+		var count int64
+		if err := db.Model(&entity.SchemaMigration{}).Where("id = ?", m.id).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", m.id, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&entity.SchemaMigration{ID: m.id, AppliedAt: time.Now().UTC()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m.id, err)
+		}
+
+		log.Infof("applied migration: %s", m.id)
+	}
+
+	return nil
+}
+
+// legacyTimestampColumns lists every datetime column written while the DSN
+// used loc=Local. Those values hold the server's local wall clock.
+var legacyTimestampColumns = map[string][]string{
+	"patients":            {"created_at", "updated_at"},
+	"doctors":             {"created_at", "updated_at"},
+	"doctor_availability": {"created_at", "updated_at"},
+	"appointments":        {"cancelled_at", "created_at", "updated_at"},
+	"prescriptions":       {"prescription_date", "valid_until", "created_at"},
+	"medical_records":     {"visit_date", "follow_up_date", "created_at", "updated_at"},
+}
+
+// convertLocalTimestampsToUTC rewrites legacy local wall-clock values as UTC,
+// reading them in loc, the configured zone they were written in. The zone
+// cannot be told from the data or from where the service runs now, so a
+// database that holds legacy rows is not migrated until it is configured;
+// the migration then fails and is retried at the next start.
+func convertLocalTimestampsToUTC(loc *time.Location) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		if loc == nil {
+			for table := range legacyTimestampColumns {
+				var count int64
+				if err := tx.Table(table).Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					return fmt.Errorf("table %s holds timestamps written in local time: set data.database.legacy_timezone to the zone they were written in", table)
+				}
+			}
+			return nil
+		}
+		if loc == time.UTC {
+			return nil
+		}
+
+		type row struct {
+			ID    string
+			Value *time.Time
+		}
+
+		for table, columns := range legacyTimestampColumns {
+			for _, column := range columns {
+				var rows []row
+				query := fmt.Sprintf("SELECT id, %s AS value FROM %s WHERE %s IS NOT NULL", column, table, column)
+				if err := tx.Raw(query).Scan(&rows).Error; err != nil {
+					return err
+				}
+
+				for _, r := range rows {
+					v := *r.Value
+					local := time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), loc)
+					update := fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ?", table, column)
+					if err := tx.Exec(update, local.UTC(), r.ID).Error; err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+// backfillAppointmentInstants derives starts_at/ends_at for appointments that
+// only have the legacy date and "HH:MM" strings. Those were booked before
+// doctors had a timezone, as wall-clock time on the host, so they are read in
+// loc, the configured legacy zone, like convertLocalTimestampsToUTC.
+func backfillAppointmentInstants(loc *time.Location) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		var appointments []*entity.Appointment
+		if err := tx.Where("starts_at IS NULL").Find(&appointments).Error; err != nil {
+			return err
+		}
+		if len(appointments) == 0 {
+			return nil
+		}
+		if loc == nil {
+			return fmt.Errorf("%d appointments hold legacy wall-clock times: set data.database.legacy_timezone to the zone they were booked in", len(appointments))
+		}
+
+		for _, apt := range appointments {
+			start, err := time.ParseInLocation("2006-01-02 15:04", apt.AppointmentDate+" "+apt.AppointmentTime, loc)
+			if err != nil {
+				return fmt.Errorf("appointment %s: %w", apt.ID, err)
+			}
+
+			updates := map[string]interface{}{
+				"starts_at": start.UTC(),
+				"ends_at":   start.Add(entity.DefaultSlotDurationMinutes * time.Minute).UTC(),
+				"timezone":  loc.String(),
+			}
+			if err := tx.Model(&entity.Appointment{}).Where("id = ?", apt.ID).UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func backfillDoctorLanguages(tx *gorm.DB) error {
+	var doctors []*entity.Doctor
+	if err := tx.Select("id", "languages").Find(&doctors).Error; err != nil {
+		return err
+	}
+
+	for _, d := range doctors {
+		if err := syncDoctorLanguages(tx, d); err != nil {
+			return fmt.Errorf("doctor %s: %w", d.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func buildPatientSearchIndex(tx *gorm.DB) error {
+	var patients []*entity.Patient
+	if err := tx.Select("id", "first_name", "last_name").Find(&patients).Error; err != nil {
+		return err
+	}
+
+	for _, p := range patients {
+		if err := indexPatient(tx, p); err != nil {
+			return fmt.Errorf("patient %s: %w", p.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// splitLegacyEmergencyContacts turns the free-form patients.emergency_contact
+// column into a primary emergency contact row. Values holding a JSON object
+// are read field by field; anything else is kept whole as the contact name.
+func splitLegacyEmergencyContacts(tx *gorm.DB) error {
+	var patients []*entity.Patient
+	if err := tx.Select("id", "emergency_contact").Where("emergency_contact <> ''").Find(&patients).Error; err != nil {
+		return err
+	}
+
+	for _, p := range patients {
+		var legacy struct {
+			Name         string `json:"name"`
+			Relationship string `json:"relationship"`
+			PhoneNumber  string `json:"phone_number"`
+			Phone        string `json:"phone"`
+			Email        string `json:"email"`
+		}
+		if err := json.Unmarshal([]byte(p.EmergencyContact), &legacy); err != nil || legacy.Name == "" {
+			legacy.Name = strings.TrimSpace(p.EmergencyContact)
+		}
+		if legacy.PhoneNumber == "" {
+			legacy.PhoneNumber = legacy.Phone
+		}
+		if len(legacy.Name) > 200 {
+			legacy.Name = legacy.Name[:200]
+		}
+		if len(legacy.PhoneNumber) > 20 {
+			legacy.PhoneNumber = legacy.PhoneNumber[:20]
+		}
+
+		contact := &entity.PatientEmergencyContact{
+			ProfileItem:  entity.ProfileItem{ID: uuid.New().String(), PatientID: p.ID},
+			Name:         legacy.Name,
+			Relationship: legacy.Relationship,
+			PhoneNumber:  legacy.PhoneNumber,
+			Email:        legacy.Email,
+			IsPrimary:    true,
+		}
+		if err := tx.Create(contact).Error; err != nil {
+			return fmt.Errorf("patient %s: %w", p.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// backfillPrescriptionItems writes prescription_items rows for the JSON
+// medications of existing prescriptions. Old free text is parsed where it
+// can be and otherwise kept only as text, since these prescriptions were
+// issued before validation and must not be rejected now.
+func backfillPrescriptionItems(f *formulary.Formulary) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		var prescriptions []*entity.Prescription
+		return tx.Select("id", "medications").
+			Where("id NOT IN (?)", tx.Session(&gorm.Session{NewDB: true}).Model(&entity.PrescriptionItem{}).Select("prescription_id")).
+			FindInBatches(&prescriptions, 500, func(batch *gorm.DB, _ int) error {
+				var items []*entity.PrescriptionItem
+				for _, p := range prescriptions {
+					for i, med := range entity.UnmarshalMedications(p.Medications) {
+						items = append(items, legacyPrescriptionItem(f, p.ID, int32(i), med))
+					}
+				}
+				if len(items) == 0 {
+					return nil
+				}
+				return tx.Session(&gorm.Session{NewDB: true}).Create(&items).Error
+			}).Error
+	}
+}
+
+func legacyPrescriptionItem(f *formulary.Formulary, prescriptionID string, position int32, med *entity.Medication) *entity.PrescriptionItem {
+	item := &entity.PrescriptionItem{
+		ID:             uuid.New().String(),
+		PrescriptionID: prescriptionID,
+		Position:       position,
+		MedicationName: truncate(med.MedicationName, 200),
+		Quantity:       med.Quantity,
+		Instructions:   med.Instructions,
+		DosageText:     truncate(med.Dosage, 100),
+		FrequencyText:  truncate(med.Frequency, 100),
+		DurationText:   truncate(med.Duration, 100),
+	}
+	if drug := f.Lookup(med.MedicationName); drug != nil {
+		item.DrugCode, item.DrugName = drug.Code, drug.Name
+	}
+	if amount, unit, err := formulary.ParseDose(med.Dosage); err == nil {
+		item.DoseAmount, item.DoseUnit = amount, unit
+	}
+	if code, err := formulary.ParseFrequency(med.Frequency); err == nil {
+		item.FrequencyCode = code
+	}
+	if days, err := formulary.ParseDuration(med.Duration); err == nil {
+		item.DurationDays = days
+	}
+	if route, ok := formulary.NormalizeRoute(med.Route); ok {
+		item.Route = route
+	}
+	return item
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// backfillMedicalRecordVersions makes every existing medical record the first
+// version of itself.
+func backfillMedicalRecordVersions(tx *gorm.DB) error {
+	return tx.Model(&entity.MedicalRecord{}).
+		Where("original_id = ''").
+		Updates(map[string]interface{}{"original_id": gorm.Expr("id"), "version": 1}).Error
+}
+
+// backfillVitalSigns writes vital_signs observations for the vital signs of
+// existing final medical records. Values that cannot be read are skipped.
+func backfillVitalSigns(tx *gorm.DB) error {
+	var records []*entity.MedicalRecord
+	return tx.Select("id", "patient_id", "doctor_id", "visit_date", "vital_signs").
+		Where("status = ? AND vital_signs <> ''", entity.MedicalRecordStatusFinal).
+		Where("id NOT IN (?)", tx.Session(&gorm.Session{NewDB: true}).Model(&entity.VitalSign{}).Select("medical_record_id")).
+		FindInBatches(&records, 500, func(batch *gorm.DB, _ int) error {
+			var signs []*entity.VitalSign
+			for _, r := range records {
+				signs = append(signs, RecordVitalSigns(r)...)
+			}
+			if len(signs) == 0 {
+				return nil
+			}
+			return tx.Session(&gorm.Session{NewDB: true}).Create(&signs).Error
+		}).Error
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kratos/kratos/v2/log"
+	"gorm.io/gorm"
+)
+
+// Parties whose names are copied onto other rows.
+const (
+	NamePartyPatient = "patient"
+	NamePartyDoctor  = "doctor"
+)
+
+// NameSyncTarget selects the rows of one table whose copy of a party's name
+// follows a rename. Where, if set, further restricts the rows by column
+// value.
+type NameSyncTarget struct {
+	Table string
+	Where map[string]interface{}
+}
+
+type NameSyncRepo interface {
+	SyncName(ctx context.Context, party, id, name string, targets []NameSyncTarget) (map[string]int64, error)
+}
+
+type nameSyncRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewNameSyncRepo(data *Data, logger log.Logger) NameSyncRepo {
+	return &nameSyncRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+// nameColumn is a pair of columns: one referencing the party and one holding
+// its denormalized name.
+type nameColumn struct {
+	ref  string
+	name string
+}
+
+var nameColumns = map[string]map[string]nameColumn{
+	NamePartyPatient: {
+		"appointments":   {"patient_id", "patient_name"},
+		"prescriptions":  {"patient_id", "patient_name"},
+		"doctor_reviews": {"patient_id", "patient_name"},
+	},
+	NamePartyDoctor: {
+		"appointments":  {"doctor_id", "doctor_name"},
+		"prescriptions": {"doctor_id", "doctor_name"},
+	},
+}
+
+// SyncName rewrites the party's denormalized name on the target rows and
+// returns how many rows changed per table.
+func (r *nameSyncRepo) SyncName(ctx context.Context, party, id, name string, targets []NameSyncTarget) (map[string]int64, error) {
+	var updated map[string]int64
+
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		updated, err = syncName(tx, party, id, name, targets)
+		return err
+	})
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to sync %s name: %v", party, err)
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// syncName issues one UPDATE per target on tx.
+func syncName(tx *gorm.DB, party, id, name string, targets []NameSyncTarget) (map[string]int64, error) {
+	updated := make(map[string]int64)
+	for _, t := range targets {
+		column, ok := nameColumns[party][t.Table]
+		if !ok {
+			return nil, fmt.Errorf("no %s name column in table %s", party, t.Table)
+		}
+
+		query := tx.Session(&gorm.Session{NewDB: true}).Table(t.Table).Where(column.ref+" = ? AND "+column.name+" <> ?", id, name)
+		if len(t.Where) > 0 {
+			query = query.Where(t.Where)
+		}
+		result := query.Update(column.name, name)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		updated[t.Table] += result.RowsAffected
+	}
+	return updated, nil
+}
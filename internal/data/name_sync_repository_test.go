@@ -0,0 +1,114 @@
+package data
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// dryRunDB returns a session that builds statements without executing them
+// and the list the UPDATE statements it builds are appended to.
+func dryRunDB(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "dry:run@tcp(127.0.0.1:0)/dry_run", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statements []string
+	err = db.Callback().Update().After("gorm:update").Register("test:capture", func(tx *gorm.DB) {
+		statements = append(statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, &statements
+}
+
+func TestSyncNameStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		party   string
+		targets []NameSyncTarget
+		want    []string
+	}{
+		{
+			name:    "patient rename",
+			party:   NamePartyPatient,
+			targets: []NameSyncTarget{{Table: "appointments"}, {Table: "doctor_reviews"}},
+			want: []string{
+				"UPDATE `appointments` SET `patient_name`='Jane Roe' WHERE patient_id = 'p-1' AND patient_name <> 'Jane Roe'",
+				"UPDATE `doctor_reviews` SET `patient_name`='Jane Roe' WHERE patient_id = 'p-1' AND patient_name <> 'Jane Roe'",
+			},
+		},
+		{
+			name:    "doctor rename",
+			party:   NamePartyDoctor,
+			targets: []NameSyncTarget{{Table: "appointments"}},
+			want: []string{
+				"UPDATE `appointments` SET `doctor_name`='Jane Roe' WHERE doctor_id = 'p-1' AND doctor_name <> 'Jane Roe'",
+			},
+		},
+		{
+			name:    "restricted target",
+			party:   NamePartyDoctor,
+			targets: []NameSyncTarget{{Table: "appointments", Where: map[string]interface{}{"status": 1}}},
+			want: []string{
+				"UPDATE `appointments` SET `doctor_name`='Jane Roe' WHERE (doctor_id = 'p-1' AND doctor_name <> 'Jane Roe') AND `appointments`.`status` = 1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := dryRunDB(t)
+			if _, err := syncName(db, tt.party, "p-1", "Jane Roe", tt.targets); err != nil {
+				t.Fatalf("syncName: %v", err)
+			}
+			if !reflect.DeepEqual(*statements, tt.want) {
+				t.Errorf("syncName issued\n%s\nwant\n%s", strings.Join(*statements, "\n"), strings.Join(tt.want, "\n"))
+			}
+			for _, s := range *statements {
+				if strings.Contains(s, "prescriptions") {
+					t.Errorf("syncName rewrote prescriptions: %s", s)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncNameRejectsUnknownTable(t *testing.T) {
+	tests := []struct {
+		party string
+		table string
+	}{
+		{party: NamePartyPatient, table: "medical_records"},
+		{party: NamePartyDoctor, table: "doctor_reviews"},
+		{party: "nurse", table: "appointments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.party+"/"+tt.table, func(t *testing.T) {
+			db, statements := dryRunDB(t)
+			targets := []NameSyncTarget{{Table: "appointments"}, {Table: tt.table}}
+			if tt.party == "nurse" {
+				targets = targets[1:]
+			}
+			updated, err := syncName(db, tt.party, "id", "New Name", targets)
+			if err == nil {
+				t.Fatalf("syncName(%s, %s) succeeded, want error", tt.party, tt.table)
+			}
+			if !strings.Contains(err.Error(), "no "+tt.party+" name column in table "+tt.table) {
+				t.Errorf("syncName(%s, %s) error = %v", tt.party, tt.table, err)
+			}
+			if updated != nil {
+				t.Errorf("syncName(%s, %s) updated = %v, want nil", tt.party, tt.table, updated)
+			}
+			if tt.party != "nurse" && len(*statements) != 1 {
+				t.Errorf("syncName(%s, %s) issued %v before failing", tt.party, tt.table, *statements)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+)
+
+type PatientExportRepo interface {
+	Create(ctx context.Context, export *entity.PatientExport) error
+	Get(ctx context.Context, id string) (*entity.PatientExport, error)
+	GetActive(ctx context.Context, patientID string) (*entity.PatientExport, error)
+	Claim(ctx context.Context, staleBefore time.Time) (*entity.PatientExport, error)
+	Complete(ctx context.Context, id string, size int64, sum string, expiresAt time.Time) error
+	Fail(ctx context.Context, id, reason string) error
+	ListExpired(ctx context.Context, now time.Time) ([]*entity.PatientExport, error)
+	MarkExpired(ctx context.Context, id string) error
+	RecordAccess(ctx context.Context, access *entity.PatientAccess) error
+	ListAccess(ctx context.Context, patientIDs []string) ([]*entity.PatientAccess, error)
+}
+
+type patientExportRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewPatientExportRepo(data *Data, logger log.Logger) PatientExportRepo {
+	return &patientExportRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *patientExportRepo) Create(ctx context.Context, export *entity.PatientExport) error {
+	if export.ID == "" {
+		export.ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(export).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create patient export: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("patient export requested: %s", export.ID)
+	return nil
+}
+
+func (r *patientExportRepo) Get(ctx context.Context, id string) (*entity.PatientExport, error) {
+	var exports []*entity.PatientExport
+
+	if err := r.data.DB(ctx).Where("id = ?", id).Limit(1).Find(&exports).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get patient export: %v", err)
+		return nil, err
+	}
+	if len(exports) == 0 {
+		return nil, nil
+	}
+	return exports[0], nil
+}
+
+// GetActive returns the patient's export that is still waiting or being
+// built, or nil if there is none.
+func (r *patientExportRepo) GetActive(ctx context.Context, patientID string) (*entity.PatientExport, error) {
+	var exports []*entity.PatientExport
+
+	err := r.data.DB(ctx).
+		Where("patient_id = ? AND status IN ?", patientID, []string{entity.PatientExportStatusPending, entity.PatientExportStatusRunning}).
+		Order("created_at ASC").Limit(1).Find(&exports).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get active patient export: %v", err)
+		return nil, err
+	}
+	if len(exports) == 0 {
+		return nil, nil
+	}
+	return exports[0], nil
+}
+
+// Claim marks the oldest pending export as running and returns it, or nil
+// if none is waiting. An export left running since before staleBefore, by
+// a process that stopped while building it, is claimed again.
+func (r *patientExportRepo) Claim(ctx context.Context, staleBefore time.Time) (*entity.PatientExport, error) {
+	for {
+		var exports []*entity.PatientExport
+		err := r.data.DB(ctx).
+			Where("status = ? OR (status = ? AND started_at < ?)", entity.PatientExportStatusPending, entity.PatientExportStatusRunning, staleBefore).
+			Order("created_at ASC").Limit(1).Find(&exports).Error
+		if err != nil {
+			r.log.WithContext(ctx).Errorf("failed to find pending patient export: %v", err)
+			return nil, err
+		}
+		if len(exports) == 0 {
+			return nil, nil
+		}
+		export := exports[0]
+
+		// Only one process wins the update; the others look again.
+		now := time.Now().UTC()
+		query := r.data.DB(ctx).Model(&entity.PatientExport{}).Where("id = ? AND status = ?", export.ID, export.Status)
+		if export.StartedAt != nil {
+			query = query.Where("started_at = ?", *export.StartedAt)
+		}
+		result := query.Updates(map[string]interface{}{
+			"status":     entity.PatientExportStatusRunning,
+			"started_at": now,
+		})
+		if result.Error != nil {
+			r.log.WithContext(ctx).Errorf("failed to claim patient export: %v", result.Error)
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			export.Status = entity.PatientExportStatusRunning
+			export.StartedAt = &now
+			return export, nil
+		}
+	}
+}
+
+func (r *patientExportRepo) Complete(ctx context.Context, id string, size int64, sum string, expiresAt time.Time) error {
+	err := r.data.DB(ctx).Model(&entity.PatientExport{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":         entity.PatientExportStatusCompleted,
+		"error":          "",
+		"archive_size":   size,
+		"archive_sha256": sum,
+		"completed_at":   time.Now().UTC(),
+		"expires_at":     expiresAt,
+	}).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to complete patient export: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *patientExportRepo) Fail(ctx context.Context, id, reason string) error {
+	err := r.data.DB(ctx).Model(&entity.PatientExport{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       entity.PatientExportStatusFailed,
+		"error":        reason,
+		"completed_at": time.Now().UTC(),
+	}).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to fail patient export: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ListExpired returns the completed exports whose archives are due for
+// deletion.
+func (r *patientExportRepo) ListExpired(ctx context.Context, now time.Time) ([]*entity.PatientExport, error) {
+	var exports []*entity.PatientExport
+
+	err := r.data.DB(ctx).
+		Where("status = ? AND expires_at <= ?", entity.PatientExportStatusCompleted, now).
+		Find(&exports).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list expired patient exports: %v", err)
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (r *patientExportRepo) MarkExpired(ctx context.Context, id string) error {
+	err := r.data.DB(ctx).Model(&entity.PatientExport{}).Where("id = ?", id).
+		Update("status", entity.PatientExportStatusExpired).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to expire patient export: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (r *patientExportRepo) RecordAccess(ctx context.Context, access *entity.PatientAccess) error {
+	if access.ID == "" {
+		access.ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(access).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to record patient access: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ListAccess returns the access log of the given patients, oldest first.
+func (r *patientExportRepo) ListAccess(ctx context.Context, patientIDs []string) ([]*entity.PatientAccess, error) {
+	var accesses []*entity.PatientAccess
+
+	if err := r.data.DB(ctx).Where("patient_id IN ?", patientIDs).Order("created_at ASC").Find(&accesses).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list patient access: %v", err)
+		return nil, err
+	}
+	return accesses, nil
+}
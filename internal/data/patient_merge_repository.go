@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PatientMergeRepo interface {
+	Create(ctx context.Context, merge *entity.PatientMerge) error
+	ListByPatient(ctx context.Context, patientID string) ([]*entity.PatientMerge, error)
+	MoveReferences(ctx context.Context, fromID, toID string) (map[string][]string, error)
+}
+
+type patientMergeRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewPatientMergeRepo(data *Data, logger log.Logger) PatientMergeRepo {
+	return &patientMergeRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+// patientReference is a column that points at a patient, optionally limited
+// to the rows matching scope.
+type patientReference struct {
+	table  string
+	column string
+	scope  string
+}
+
+var patientReferences = []patientReference{
+	{table: "appointments", column: "patient_id"},
+	{table: "prescriptions", column: "patient_id"},
+	{table: "medical_records", column: "patient_id"},
+	{table: "vital_signs", column: "patient_id"},
+	{table: "lab_orders", column: "patient_id"},
+	{table: "lab_results", column: "patient_id"},
+	{table: "doctor_reviews", column: "patient_id"},
+	{table: "patient_allergies", column: "patient_id"},
+	{table: "patient_conditions", column: "patient_id"},
+	{table: "patient_medications", column: "patient_id"},
+	{table: "patient_emergency_contacts", column: "patient_id"},
+	{table: "patient_insurance_policies", column: "patient_id"},
+	{table: "calendar_feeds", column: "owner_id", scope: "owner_type = '" + entity.CalendarOwnerPatient + "'"},
+	{table: "patients", column: "merged_into"},
+}
+
+func (r *patientMergeRepo) Create(ctx context.Context, merge *entity.PatientMerge) error {
+	if merge.ID == "" {
+		merge.ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(merge).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create patient merge: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("recorded merge of patient %s into %s", merge.MergedID, merge.SurvivorID)
+	return nil
+}
+
+// ListByPatient returns the merges the patient took part in on either side,
+// newest first.
+func (r *patientMergeRepo) ListByPatient(ctx context.Context, patientID string) ([]*entity.PatientMerge, error) {
+	var merges []*entity.PatientMerge
+
+	if err := r.data.DB(ctx).Where("survivor_id = ? OR merged_id = ?", patientID, patientID).Order("created_at DESC").Find(&merges).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list patient merges: %v", err)
+		return nil, err
+	}
+
+	return merges, nil
+}
+
+// MoveReferences points every row that references fromID at toID instead.
+// It returns the IDs of the rows it moved, keyed by table.
+func (r *patientMergeRepo) MoveReferences(ctx context.Context, fromID, toID string) (map[string][]string, error) {
+	moved := make(map[string][]string)
+
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, ref := range patientReferences {
+			query := func() *gorm.DB {
+				q := tx.Session(&gorm.Session{NewDB: true}).Table(ref.table).Where(ref.column+" = ?", fromID)
+				if ref.scope != "" {
+					q = q.Where(ref.scope)
+				}
+				return q
+			}
+
+			var ids []string
+			if err := query().Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				continue
+			}
+
+			if err := query().Update(ref.column, toID).Error; err != nil {
+				return err
+			}
+			moved[ref.table] = ids
+		}
+		return nil
+	})
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to move patient references: %v", err)
+		return nil, err
+	}
+
+	return moved, nil
+}
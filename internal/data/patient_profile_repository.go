@@ -0,0 +1,103 @@
+package data
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PatientProfileRepo stores the rows of a patient's structured profile. The
+// table is chosen by the type of the item passed in.
+type PatientProfileRepo interface {
+	Create(ctx context.Context, item entity.PatientProfileItem) error
+	Get(ctx context.Context, item entity.PatientProfileItem, patientID, id string) (bool, error)
+	Update(ctx context.Context, item entity.PatientProfileItem) error
+	Delete(ctx context.Context, item entity.PatientProfileItem, patientID, id string) error
+	List(ctx context.Context, patientID string, items interface{}) error
+	ClearPrimary(ctx context.Context, item entity.PatientProfileItem) error
+}
+
+type patientProfileRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewPatientProfileRepo(data *Data, logger log.Logger) PatientProfileRepo {
+	return &patientProfileRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *patientProfileRepo) Create(ctx context.Context, item entity.PatientProfileItem) error {
+	if item.Item().ID == "" {
+		item.Item().ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(item).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create %s row: %v", item.TableName(), err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("created %s row %s for patient %s", item.TableName(), item.Item().ID, item.Item().PatientID)
+	return nil
+}
+
+// Get loads the patient's row with the given ID into item, reporting whether
+// it exists.
+func (r *patientProfileRepo) Get(ctx context.Context, item entity.PatientProfileItem, patientID, id string) (bool, error) {
+	if err := r.data.DB(ctx).Where("id = ? AND patient_id = ?", id, patientID).First(item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		r.log.WithContext(ctx).Errorf("failed to get %s row: %v", item.TableName(), err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *patientProfileRepo) Update(ctx context.Context, item entity.PatientProfileItem) error {
+	if err := r.data.DB(ctx).Save(item).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to update %s row: %v", item.TableName(), err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *patientProfileRepo) Delete(ctx context.Context, item entity.PatientProfileItem, patientID, id string) error {
+	if err := r.data.DB(ctx).Where("id = ? AND patient_id = ?", id, patientID).Delete(item).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to delete %s row: %v", item.TableName(), err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("deleted %s row %s", item.TableName(), id)
+	return nil
+}
+
+// List loads the patient's rows into items, which must point to a slice of
+// one of the profile entities.
+func (r *patientProfileRepo) List(ctx context.Context, patientID string, items interface{}) error {
+	if err := r.data.DB(ctx).Where("patient_id = ?", patientID).Order("created_at").Find(items).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list patient profile rows: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ClearPrimary unsets is_primary on the patient's other rows in item's
+// table, so that item can be the only primary one.
+func (r *patientProfileRepo) ClearPrimary(ctx context.Context, item entity.PatientProfileItem) error {
+	base := item.Item()
+	if err := r.data.DB(ctx).Table(item.TableName()).Where("patient_id = ? AND id <> ? AND is_primary = ?", base.PatientID, base.ID, true).Update("is_primary", false).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to clear primary %s row: %v", item.TableName(), err)
+		return err
+	}
+
+	return nil
+}
@@ -2,11 +2,15 @@ package data
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/namematch"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PatientRepo interface {
@@ -17,8 +21,13 @@ type PatientRepo interface {
 	Search(ctx context.Context, filters map[string]interface{}) ([]*entity.Patient, error)
 	GetByEmail(ctx context.Context, email string) (*entity.Patient, error)
 	GetByPhone(ctx context.Context, phone string) (*entity.Patient, error)
+	SearchCandidates(ctx context.Context, filters map[string]interface{}) ([]*entity.Patient, error)
+	Lock(ctx context.Context, id string) error
 }
 
+// maxMergeRedirects bounds how many merge tombstones Get follows.
+const maxMergeRedirects = 8
+
 type patientRepo struct {
 	data *Data
 	log  *log.Helper
@@ -36,7 +45,13 @@ func (r *patientRepo) Create(ctx context.Context, patient *entity.Patient) error
 		patient.ID = uuid.New().String()
 	}
 
-	if err := r.data.db.WithContext(ctx).Create(patient).Error; err != nil {
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(patient).Error; err != nil {
+			return err
+		}
+		return indexPatient(tx, patient)
+	})
+	if err != nil {
 		r.log.WithContext(ctx).Errorf("failed to create patient: %v", err)
 		return err
 	}
@@ -45,22 +60,38 @@ func (r *patientRepo) Create(ctx context.Context, patient *entity.Patient) error
 	return nil
 }
 
+// Get returns the patient with the given ID. If that patient has been merged
+// into another one, the surviving patient is returned instead, so callers
+// must compare IDs to tell a redirect from a direct hit.
 func (r *patientRepo) Get(ctx context.Context, id string) (*entity.Patient, error) {
-	var patient entity.Patient
+	for i := 0; i <= maxMergeRedirects; i++ {
+		var patient entity.Patient
 
-	if err := r.data.db.WithContext(ctx).Where("id = ?", id).First(&patient).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, nil
+		if err := r.data.DB(ctx).Where("id = ?", id).First(&patient).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, nil
+			}
+			r.log.WithContext(ctx).Errorf("failed to get patient: %v", err)
+			return nil, err
 		}
-		r.log.WithContext(ctx).Errorf("failed to get patient: %v", err)
-		return nil, err
+		if patient.MergedInto == "" {
+			return &patient, nil
+		}
+		id = patient.MergedInto
 	}
 
-	return &patient, nil
+	r.log.WithContext(ctx).Errorf("too many merge redirects resolving patient: %s", id)
+	return nil, fmt.Errorf("too many merge redirects resolving patient %s", id)
 }
 
 func (r *patientRepo) Update(ctx context.Context, patient *entity.Patient) error {
-	if err := r.data.db.WithContext(ctx).Save(patient).Error; err != nil {
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(patient).Error; err != nil {
+			return err
+		}
+		return indexPatient(tx, patient)
+	})
+	if err != nil {
 		r.log.WithContext(ctx).Errorf("failed to update patient: %v", err)
 		return err
 	}
@@ -70,7 +101,13 @@ func (r *patientRepo) Update(ctx context.Context, patient *entity.Patient) error
 }
 
 func (r *patientRepo) Delete(ctx context.Context, id string) error {
-	if err := r.data.db.WithContext(ctx).Where("id = ?", id).Delete(&entity.Patient{}).Error; err != nil {
+	err := r.data.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("patient_id = ?", id).Delete(&entity.PatientSearchToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&entity.Patient{}).Error
+	})
+	if err != nil {
 		r.log.WithContext(ctx).Errorf("failed to delete patient: %v", err)
 		return err
 	}
@@ -81,7 +118,7 @@ func (r *patientRepo) Delete(ctx context.Context, id string) error {
 
 func (r *patientRepo) Search(ctx context.Context, filters map[string]interface{}) ([]*entity.Patient, error) {
 	var patients []*entity.Patient
-	query := r.data.db.WithContext(ctx)
+	query := r.data.DB(ctx).Where("merged_into = ''")
 
 	if name, ok := filters["name"].(string); ok && name != "" {
 		query = query.Where("first_name LIKE ? OR last_name LIKE ?", "%"+name+"%", "%"+name+"%")
@@ -107,7 +144,7 @@ func (r *patientRepo) Search(ctx context.Context, filters map[string]interface{}
 func (r *patientRepo) GetByEmail(ctx context.Context, email string) (*entity.Patient, error) {
 	var patient entity.Patient
 
-	if err := r.data.db.WithContext(ctx).Where("email = ?", email).First(&patient).Error; err != nil {
+	if err := r.data.DB(ctx).Where("email = ? AND merged_into = ''", email).First(&patient).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -121,7 +158,7 @@ func (r *patientRepo) GetByEmail(ctx context.Context, email string) (*entity.Pat
 func (r *patientRepo) GetByPhone(ctx context.Context, phone string) (*entity.Patient, error) {
 	var patient entity.Patient
 
-	if err := r.data.db.WithContext(ctx).Where("phone_number = ?", phone).First(&patient).Error; err != nil {
+	if err := r.data.DB(ctx).Where("phone_number = ? AND merged_into = ''", phone).First(&patient).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -131,3 +168,134 @@ func (r *patientRepo) GetByPhone(ctx context.Context, phone string) (*entity.Pat
 
 	return &patient, nil
 }
+
+// SearchCandidates returns patients sharing a name token, name prefix or
+// phonetic code with the query, or matching its date of birth, phone number or
+// email exactly. Ranking the candidates is left to the caller.
+//
+// Patients matching an identifier exactly (email, phone number, or date of
+// birth together with a name token) are always returned. The limit filter
+// caps only the looser matches found besides them, so that a common name or
+// birthday cannot crowd out an exact duplicate.
+func (r *patientRepo) SearchCandidates(ctx context.Context, filters map[string]interface{}) ([]*entity.Patient, error) {
+	db := r.data.DB(ctx)
+
+	tokenMatches := func() *gorm.DB {
+		return db.Session(&gorm.Session{NewDB: true}).Model(&entity.PatientSearchToken{}).Select("patient_id")
+	}
+	candidates := func() *gorm.DB {
+		return db.Session(&gorm.Session{NewDB: true}).Model(&entity.Patient{}).Where("merged_into = ''")
+	}
+
+	var exact, fuzzy []string
+	var exactArgs, fuzzyArgs []interface{}
+	tokens, _ := filters["tokens"].([]string)
+	if len(tokens) > 0 {
+		fuzzy = append(fuzzy, "id IN (?)")
+		fuzzyArgs = append(fuzzyArgs, tokenMatches().Where("kind = ? AND token IN (?)", entity.SearchTokenName, tokens))
+	}
+	if codes, ok := filters["phonetic"].([]string); ok && len(codes) > 0 {
+		fuzzy = append(fuzzy, "id IN (?)")
+		fuzzyArgs = append(fuzzyArgs, tokenMatches().Where("kind = ? AND token IN (?)", entity.SearchTokenPhonetic, codes))
+	}
+	if prefixes, ok := filters["prefixes"].([]string); ok {
+		for _, p := range prefixes {
+			fuzzy = append(fuzzy, "id IN (?)")
+			fuzzyArgs = append(fuzzyArgs, tokenMatches().Where("kind = ? AND token LIKE ?", entity.SearchTokenName, p+"%"))
+		}
+	}
+	if dob, ok := filters["date_of_birth"].(string); ok && dob != "" {
+		fuzzy = append(fuzzy, "date_of_birth = ?")
+		fuzzyArgs = append(fuzzyArgs, dob)
+		if len(tokens) > 0 {
+			exact = append(exact, "(date_of_birth = ? AND id IN (?))")
+			exactArgs = append(exactArgs, dob, tokenMatches().Where("kind = ? AND token IN (?)", entity.SearchTokenName, tokens))
+		}
+	}
+	if phone, ok := filters["phone_number"].(string); ok && phone != "" {
+		exact = append(exact, "phone_number = ?")
+		exactArgs = append(exactArgs, phone)
+	}
+	if email, ok := filters["email"].(string); ok && email != "" {
+		exact = append(exact, "email = ?")
+		exactArgs = append(exactArgs, email)
+	}
+	if len(exact) == 0 && len(fuzzy) == 0 {
+		return nil, nil
+	}
+
+	var patients []*entity.Patient
+	if len(exact) > 0 {
+		if err := candidates().Where(strings.Join(exact, " OR "), exactArgs...).Find(&patients).Error; err != nil {
+			r.log.WithContext(ctx).Errorf("failed to search exact patient candidates: %v", err)
+			return nil, err
+		}
+	}
+
+	if len(fuzzy) > 0 {
+		query := candidates().Where(strings.Join(fuzzy, " OR "), fuzzyArgs...)
+		if len(patients) > 0 {
+			ids := make([]string, 0, len(patients))
+			for _, p := range patients {
+				ids = append(ids, p.ID)
+			}
+			query = query.Where("id NOT IN ?", ids)
+		}
+		if limit, ok := filters["limit"].(int); ok && limit > 0 {
+			query = query.Limit(limit)
+		}
+
+		var more []*entity.Patient
+		if err := query.Find(&more).Error; err != nil {
+			r.log.WithContext(ctx).Errorf("failed to search patient candidates: %v", err)
+			return nil, err
+		}
+		patients = append(patients, more...)
+	}
+
+	return patients, nil
+}
+
+// Lock takes a row lock on the patient for the rest of the surrounding
+// transaction. Unlike Get it does not follow merge redirects.
+func (r *patientRepo) Lock(ctx context.Context, id string) error {
+	var patients []*entity.Patient
+
+	if err := r.data.DB(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", id).Find(&patients).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to lock patient: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// indexPatient rewrites the patient's rows in patient_search_tokens. Merged
+// patients are left out of the index.
+func indexPatient(tx *gorm.DB, patient *entity.Patient) error {
+	if err := tx.Where("patient_id = ?", patient.ID).Delete(&entity.PatientSearchToken{}).Error; err != nil {
+		return err
+	}
+	if patient.MergedInto != "" {
+		return nil
+	}
+
+	seen := make(map[entity.PatientSearchToken]bool)
+	var rows []*entity.PatientSearchToken
+	add := func(kind, token string) {
+		row := entity.PatientSearchToken{PatientID: patient.ID, Kind: kind, Token: token}
+		if token == "" || len(token) > 64 || seen[row] {
+			return
+		}
+		seen[row] = true
+		rows = append(rows, &row)
+	}
+	for _, t := range namematch.Tokenize(patient.FirstName + " " + patient.LastName) {
+		add(entity.SearchTokenName, t)
+		add(entity.SearchTokenPhonetic, namematch.Soundex(t))
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return tx.Create(&rows).Error
+}
@@ -2,19 +2,32 @@ package data
 
 import (
 	"context"
+	"time"
 
 	"github.com/arm-1234/medical-service/internal/data/entity"
 	"github.com/go-kratos/kratos/v2/log"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PrescriptionRepo interface {
 	Create(ctx context.Context, prescription *entity.Prescription) error
 	Get(ctx context.Context, id string) (*entity.Prescription, error)
+	Update(ctx context.Context, prescription *entity.Prescription) error
+	Lock(ctx context.Context, id string) error
 	GetByPatientID(ctx context.Context, patientID string, filters map[string]interface{}) ([]*entity.Prescription, error)
 	GetByDoctorID(ctx context.Context, doctorID string, filters map[string]interface{}) ([]*entity.Prescription, error)
 	GetByAppointmentID(ctx context.Context, appointmentID string) (*entity.Prescription, error)
+	GetByVerificationCode(ctx context.Context, code string) (*entity.Prescription, error)
+	AssignVerificationCode(ctx context.Context, id, code string) error
+	CreateItems(ctx context.Context, items []*entity.PrescriptionItem) error
+	GetItems(ctx context.Context, prescriptionIDs []string) ([]*entity.PrescriptionItem, error)
+	CreateOverrides(ctx context.Context, overrides []*entity.PrescriptionSafetyOverride) error
+	GetOverrides(ctx context.Context, prescriptionID string) ([]*entity.PrescriptionSafetyOverride, error)
+	ExpireBefore(ctx context.Context, t time.Time) (int64, error)
+	CreateRefill(ctx context.Context, refill *entity.PrescriptionRefill) error
+	GetRefills(ctx context.Context, prescriptionID string) ([]*entity.PrescriptionRefill, error)
 }
 
 type prescriptionRepo struct {
@@ -34,7 +47,7 @@ func (r *prescriptionRepo) Create(ctx context.Context, prescription *entity.Pres
 		prescription.ID = uuid.New().String()
 	}
 
-	if err := r.data.db.WithContext(ctx).Create(prescription).Error; err != nil {
+	if err := r.data.DB(ctx).Create(prescription).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to create prescription: %v", err)
 		return err
 	}
@@ -46,7 +59,7 @@ func (r *prescriptionRepo) Create(ctx context.Context, prescription *entity.Pres
 func (r *prescriptionRepo) Get(ctx context.Context, id string) (*entity.Prescription, error) {
 	var prescription entity.Prescription
 
-	if err := r.data.db.WithContext(ctx).Where("id = ?", id).First(&prescription).Error; err != nil {
+	if err := r.data.DB(ctx).Where("id = ?", id).First(&prescription).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -57,18 +70,31 @@ func (r *prescriptionRepo) Get(ctx context.Context, id string) (*entity.Prescrip
 	return &prescription, nil
 }
 
-func (r *prescriptionRepo) GetByPatientID(ctx context.Context, patientID string, filters map[string]interface{}) ([]*entity.Prescription, error) {
+func (r *prescriptionRepo) Update(ctx context.Context, prescription *entity.Prescription) error {
+	if err := r.data.DB(ctx).Save(prescription).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to update prescription: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Lock takes a row lock on the prescription for the rest of the surrounding
+// transaction, so that concurrent refills and status changes serialize.
+func (r *prescriptionRepo) Lock(ctx context.Context, id string) error {
 	var prescriptions []*entity.Prescription
-	query := r.data.db.WithContext(ctx).Where("patient_id = ?", patientID)
 
-	if fromDate, ok := filters["from_date"].(string); ok && fromDate != "" {
-		query = query.Where("prescription_date >= ?", fromDate)
-	}
-	if toDate, ok := filters["to_date"].(string); ok && toDate != "" {
-		query = query.Where("prescription_date <= ?", toDate)
+	if err := r.data.DB(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", id).Find(&prescriptions).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to lock prescription: %v", err)
+		return err
 	}
 
-	query = query.Order("prescription_date DESC")
+	return nil
+}
+
+func (r *prescriptionRepo) GetByPatientID(ctx context.Context, patientID string, filters map[string]interface{}) ([]*entity.Prescription, error) {
+	var prescriptions []*entity.Prescription
+	query := filterPrescriptions(r.data.DB(ctx).Where("patient_id = ?", patientID), filters)
 
 	if err := query.Find(&prescriptions).Error; err != nil {
 		r.log.WithContext(ctx).Errorf("failed to get patient prescriptions: %v", err)
@@ -80,35 +106,179 @@ func (r *prescriptionRepo) GetByPatientID(ctx context.Context, patientID string,
 
 func (r *prescriptionRepo) GetByDoctorID(ctx context.Context, doctorID string, filters map[string]interface{}) ([]*entity.Prescription, error) {
 	var prescriptions []*entity.Prescription
-	query := r.data.db.WithContext(ctx).Where("doctor_id = ?", doctorID)
+	query := filterPrescriptions(r.data.DB(ctx).Where("doctor_id = ?", doctorID), filters)
+
+	if err := query.Find(&prescriptions).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get doctor prescriptions: %v", err)
+		return nil, err
+	}
+
+	return prescriptions, nil
+}
 
+// filterPrescriptions applies the date range and status filters. A
+// prescription still marked active past its validity counts as expired, so
+// the filter does not depend on the expiry job having caught up.
+func filterPrescriptions(query *gorm.DB, filters map[string]interface{}) *gorm.DB {
 	if fromDate, ok := filters["from_date"].(string); ok && fromDate != "" {
 		query = query.Where("prescription_date >= ?", fromDate)
 	}
 	if toDate, ok := filters["to_date"].(string); ok && toDate != "" {
 		query = query.Where("prescription_date <= ?", toDate)
 	}
+	if drugCode, ok := filters["drug_code"].(string); ok && drugCode != "" {
+		query = query.Where("id IN (?)", query.Session(&gorm.Session{NewDB: true}).Model(&entity.PrescriptionItem{}).Select("prescription_id").Where("drug_code = ?", drugCode))
+	}
+	if status, ok := filters["status"].(string); ok && status != "" {
+		now := time.Now().UTC()
+		switch status {
+		case entity.PrescriptionStatusActive:
+			query = query.Where("status = ? AND valid_until >= ?", status, now)
+		case entity.PrescriptionStatusExpired:
+			query = query.Where("status = ? OR (status = ? AND valid_until < ?)", status, entity.PrescriptionStatusActive, now)
+		default:
+			query = query.Where("status = ?", status)
+		}
+	}
 
-	query = query.Order("prescription_date DESC")
+	return query.Order("prescription_date DESC")
+}
 
-	if err := query.Find(&prescriptions).Error; err != nil {
-		r.log.WithContext(ctx).Errorf("failed to get doctor prescriptions: %v", err)
+func (r *prescriptionRepo) GetByAppointmentID(ctx context.Context, appointmentID string) (*entity.Prescription, error) {
+	var prescription entity.Prescription
+
+	if err := r.data.DB(ctx).Where("appointment_id = ?", appointmentID).First(&prescription).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.log.WithContext(ctx).Errorf("failed to get prescription by appointment: %v", err)
 		return nil, err
 	}
 
-	return prescriptions, nil
+	return &prescription, nil
 }
 
-func (r *prescriptionRepo) GetByAppointmentID(ctx context.Context, appointmentID string) (*entity.Prescription, error) {
+func (r *prescriptionRepo) GetByVerificationCode(ctx context.Context, code string) (*entity.Prescription, error) {
 	var prescription entity.Prescription
 
-	if err := r.data.db.WithContext(ctx).Where("appointment_id = ?", appointmentID).First(&prescription).Error; err != nil {
+	if err := r.data.DB(ctx).Where("verification_code = ?", code).First(&prescription).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
-		r.log.WithContext(ctx).Errorf("failed to get prescription by appointment: %v", err)
+		r.log.WithContext(ctx).Errorf("failed to get prescription by verification code: %v", err)
 		return nil, err
 	}
 
 	return &prescription, nil
 }
+
+// AssignVerificationCode sets the prescription's verification code unless it
+// already has one, so concurrent first prints agree on a single code.
+func (r *prescriptionRepo) AssignVerificationCode(ctx context.Context, id, code string) error {
+	if err := r.data.DB(ctx).Model(&entity.Prescription{}).Where("id = ? AND verification_code IS NULL", id).Update("verification_code", code).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to assign verification code: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *prescriptionRepo) CreateItems(ctx context.Context, items []*entity.PrescriptionItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	for _, item := range items {
+		if item.ID == "" {
+			item.ID = uuid.New().String()
+		}
+	}
+
+	if err := r.data.DB(ctx).Create(&items).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create prescription items: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *prescriptionRepo) GetItems(ctx context.Context, prescriptionIDs []string) ([]*entity.PrescriptionItem, error) {
+	var items []*entity.PrescriptionItem
+	if len(prescriptionIDs) == 0 {
+		return items, nil
+	}
+
+	if err := r.data.DB(ctx).Where("prescription_id IN ?", prescriptionIDs).Order("prescription_id, position").Find(&items).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get prescription items: %v", err)
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (r *prescriptionRepo) CreateOverrides(ctx context.Context, overrides []*entity.PrescriptionSafetyOverride) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	for _, o := range overrides {
+		if o.ID == "" {
+			o.ID = uuid.New().String()
+		}
+	}
+
+	if err := r.data.DB(ctx).Create(&overrides).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create prescription safety overrides: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *prescriptionRepo) GetOverrides(ctx context.Context, prescriptionID string) ([]*entity.PrescriptionSafetyOverride, error) {
+	var overrides []*entity.PrescriptionSafetyOverride
+
+	if err := r.data.DB(ctx).Where("prescription_id = ?", prescriptionID).Order("created_at").Find(&overrides).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get prescription safety overrides: %v", err)
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// ExpireBefore marks active prescriptions whose validity ended before t as
+// expired and returns how many were changed.
+func (r *prescriptionRepo) ExpireBefore(ctx context.Context, t time.Time) (int64, error) {
+	result := r.data.DB(ctx).Model(&entity.Prescription{}).
+		Where("status = ? AND valid_until < ?", entity.PrescriptionStatusActive, t).
+		Updates(map[string]interface{}{"status": entity.PrescriptionStatusExpired, "is_active": false})
+	if result.Error != nil {
+		r.log.WithContext(ctx).Errorf("failed to expire prescriptions: %v", result.Error)
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
+func (r *prescriptionRepo) CreateRefill(ctx context.Context, refill *entity.PrescriptionRefill) error {
+	if refill.ID == "" {
+		refill.ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(refill).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create prescription refill: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("recorded refill %d for prescription %s", refill.Sequence, refill.PrescriptionID)
+	return nil
+}
+
+func (r *prescriptionRepo) GetRefills(ctx context.Context, prescriptionID string) ([]*entity.PrescriptionRefill, error) {
+	var refills []*entity.PrescriptionRefill
+
+	if err := r.data.DB(ctx).Where("prescription_id = ?", prescriptionID).Order("sequence").Find(&refills).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get prescription refills: %v", err)
+		return nil, err
+	}
+
+	return refills, nil
+}
@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+)
+
+type ResourceRepo interface {
+	CreateEquipment(ctx context.Context, equipment *entity.Equipment) error
+	GetEquipment(ctx context.Context, clinicID string) ([]*entity.Equipment, error)
+	LockClinic(ctx context.Context, clinicID string) error
+	GetBookings(ctx context.Context, clinicID string, from, to time.Time) ([]*entity.ResourceBooking, error)
+	GetBookingsByAppointment(ctx context.Context, appointmentID string) ([]*entity.ResourceBooking, error)
+	CreateBookings(ctx context.Context, bookings []*entity.ResourceBooking) error
+	ReleaseBookings(ctx context.Context, appointmentID string) error
+}
+
+type resourceRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewResourceRepo(data *Data, logger log.Logger) ResourceRepo {
+	return &resourceRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *resourceRepo) CreateEquipment(ctx context.Context, equipment *entity.Equipment) error {
+	if equipment.ID == "" {
+		equipment.ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(equipment).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create equipment: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("created equipment %s in clinic %s", equipment.ID, equipment.ClinicID)
+	return nil
+}
+
+func (r *resourceRepo) GetEquipment(ctx context.Context, clinicID string) ([]*entity.Equipment, error) {
+	var equipment []*entity.Equipment
+
+	if err := r.data.DB(ctx).Where("clinic_id = ?", clinicID).Order("type ASC, name ASC").Find(&equipment).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get equipment: %v", err)
+		return nil, err
+	}
+
+	return equipment, nil
+}
+
+// LockClinic takes a row lock on the clinic for the rest of the surrounding
+// transaction, serializing resource bookings within the clinic.
+func (r *resourceRepo) LockClinic(ctx context.Context, clinicID string) error {
+	var clinic entity.Clinic
+
+	if err := r.data.DB(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", clinicID).First(&clinic).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to lock clinic: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *resourceRepo) GetBookings(ctx context.Context, clinicID string, from, to time.Time) ([]*entity.ResourceBooking, error) {
+	var bookings []*entity.ResourceBooking
+
+	query := r.data.DB(ctx).
+		Where("clinic_id = ?", clinicID).
+		Where("starts_at < ? AND ends_at > ?", to.UTC(), from.UTC())
+
+	if err := query.Find(&bookings).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get resource bookings: %v", err)
+		return nil, err
+	}
+
+	return bookings, nil
+}
+
+func (r *resourceRepo) GetBookingsByAppointment(ctx context.Context, appointmentID string) ([]*entity.ResourceBooking, error) {
+	var bookings []*entity.ResourceBooking
+
+	if err := r.data.DB(ctx).Where("appointment_id = ?", appointmentID).Find(&bookings).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get appointment resource bookings: %v", err)
+		return nil, err
+	}
+
+	return bookings, nil
+}
+
+func (r *resourceRepo) CreateBookings(ctx context.Context, bookings []*entity.ResourceBooking) error {
+	for _, b := range bookings {
+		if b.ID == "" {
+			b.ID = uuid.New().String()
+		}
+		if err := r.data.DB(ctx).Create(b).Error; err != nil {
+			r.log.WithContext(ctx).Errorf("failed to create resource booking: %v", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *resourceRepo) ReleaseBookings(ctx context.Context, appointmentID string) error {
+	if err := r.data.DB(ctx).Where("appointment_id = ?", appointmentID).Delete(&entity.ResourceBooking{}).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to release resource bookings: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("released resource bookings of appointment: %s", appointmentID)
+	return nil
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ReviewRepo interface {
+	Create(ctx context.Context, review *entity.Review) error
+	Get(ctx context.Context, id string) (*entity.Review, error)
+	GetByAppointment(ctx context.Context, appointmentID string) (*entity.Review, error)
+	Update(ctx context.Context, review *entity.Review) error
+	ListByDoctor(ctx context.Context, doctorID string, filters map[string]interface{}) ([]*entity.Review, error)
+}
+
+type reviewRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewReviewRepo(data *Data, logger log.Logger) ReviewRepo {
+	return &reviewRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *reviewRepo) Create(ctx context.Context, review *entity.Review) error {
+	if review.ID == "" {
+		review.ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(review).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create review: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("created review %s for appointment %s", review.ID, review.AppointmentID)
+	return nil
+}
+
+func (r *reviewRepo) Get(ctx context.Context, id string) (*entity.Review, error) {
+	var review entity.Review
+
+	if err := r.data.DB(ctx).Where("id = ?", id).First(&review).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.log.WithContext(ctx).Errorf("failed to get review: %v", err)
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+func (r *reviewRepo) GetByAppointment(ctx context.Context, appointmentID string) (*entity.Review, error) {
+	var review entity.Review
+
+	if err := r.data.DB(ctx).Where("appointment_id = ?", appointmentID).First(&review).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.log.WithContext(ctx).Errorf("failed to get review by appointment: %v", err)
+		return nil, err
+	}
+
+	return &review, nil
+}
+
+func (r *reviewRepo) Update(ctx context.Context, review *entity.Review) error {
+	if err := r.data.DB(ctx).Save(review).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to update review: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *reviewRepo) ListByDoctor(ctx context.Context, doctorID string, filters map[string]interface{}) ([]*entity.Review, error) {
+	var reviews []*entity.Review
+	query := r.data.DB(ctx).Where("doctor_id = ?", doctorID)
+
+	if status, ok := filters["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	} else if includeHidden, _ := filters["include_hidden"].(bool); !includeHidden {
+		query = query.Where("status <> ?", entity.ReviewStatusHidden)
+	}
+
+	if err := query.Order("created_at DESC").Find(&reviews).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to list reviews: %v", err)
+		return nil, err
+	}
+
+	return reviews, nil
+}
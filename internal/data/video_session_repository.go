@@ -0,0 +1,65 @@
+package data
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type VideoSessionRepo interface {
+	Create(ctx context.Context, session *entity.VideoSession) error
+	GetByAppointment(ctx context.Context, appointmentID string) (*entity.VideoSession, error)
+	Update(ctx context.Context, session *entity.VideoSession) error
+}
+
+type videoSessionRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewVideoSessionRepo(data *Data, logger log.Logger) VideoSessionRepo {
+	return &videoSessionRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *videoSessionRepo) Create(ctx context.Context, session *entity.VideoSession) error {
+	if session.ID == "" {
+		session.ID = uuid.New().String()
+	}
+
+	if err := r.data.DB(ctx).Create(session).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create video session: %v", err)
+		return err
+	}
+
+	r.log.WithContext(ctx).Infof("created video session %s for appointment %s", session.ID, session.AppointmentID)
+	return nil
+}
+
+func (r *videoSessionRepo) GetByAppointment(ctx context.Context, appointmentID string) (*entity.VideoSession, error) {
+	var session entity.VideoSession
+
+	if err := r.data.DB(ctx).Where("appointment_id = ?", appointmentID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		r.log.WithContext(ctx).Errorf("failed to get video session: %v", err)
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (r *videoSessionRepo) Update(ctx context.Context, session *entity.VideoSession) error {
+	if err := r.data.DB(ctx).Save(session).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to update video session: %v", err)
+		return err
+	}
+
+	return nil
+}
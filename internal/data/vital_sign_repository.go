@@ -0,0 +1,129 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/vitals"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type VitalSignRepo interface {
+	Create(ctx context.Context, signs []*entity.VitalSign) error
+	GetSeries(ctx context.Context, patientID string, codes []string, from, to time.Time) ([]*entity.VitalSign, error)
+	Latest(ctx context.Context, patientID, code string, before time.Time) (*entity.VitalSign, error)
+}
+
+type vitalSignRepo struct {
+	data *Data
+	log  *log.Helper
+}
+
+func NewVitalSignRepo(data *Data, logger log.Logger) VitalSignRepo {
+	return &vitalSignRepo{
+		data: data,
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (r *vitalSignRepo) Create(ctx context.Context, signs []*entity.VitalSign) error {
+	if len(signs) == 0 {
+		return nil
+	}
+	for _, s := range signs {
+		if s.ID == "" {
+			s.ID = uuid.New().String()
+		}
+	}
+
+	if err := r.data.DB(ctx).Create(&signs).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to create vital signs: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetSeries returns the patient's observations of the given codes (all
+// codes when empty) between from and to, oldest first. Observations from
+// medical record versions that are no longer final are left out, so an
+// amended or retracted record does not count twice or at all.
+func (r *vitalSignRepo) GetSeries(ctx context.Context, patientID string, codes []string, from, to time.Time) ([]*entity.VitalSign, error) {
+	var signs []*entity.VitalSign
+
+	query := r.data.DB(ctx).
+		Where("patient_id = ? AND observed_at BETWEEN ? AND ?", patientID, from, to).
+		Where(currentVitalSigns(r.data.DB(ctx)))
+	if len(codes) > 0 {
+		query = query.Where("code IN ?", codes)
+	}
+
+	if err := query.Order("observed_at ASC").Find(&signs).Error; err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get vital signs: %v", err)
+		return nil, fmt.Errorf("failed to get vital signs: %w", err)
+	}
+	return signs, nil
+}
+
+// Latest returns the patient's most recent observation of code at or before
+// before, or nil if there is none.
+func (r *vitalSignRepo) Latest(ctx context.Context, patientID, code string, before time.Time) (*entity.VitalSign, error) {
+	var signs []*entity.VitalSign
+
+	err := r.data.DB(ctx).
+		Where("patient_id = ? AND code = ? AND observed_at <= ?", patientID, code, before).
+		Where(currentVitalSigns(r.data.DB(ctx))).
+		Order("observed_at DESC").Limit(1).Find(&signs).Error
+	if err != nil {
+		r.log.WithContext(ctx).Errorf("failed to get latest vital sign: %v", err)
+		return nil, err
+	}
+	if len(signs) == 0 {
+		return nil, nil
+	}
+	return signs[0], nil
+}
+
+func currentVitalSigns(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).
+		Where("medical_record_id = ''").
+		Or("medical_record_id IN (?)", db.Session(&gorm.Session{NewDB: true}).
+			Model(&entity.MedicalRecord{}).
+			Select("id").
+			Where("status = ?", entity.MedicalRecordStatusFinal))
+}
+
+// RecordVitalSigns turns the vital signs of a medical record into
+// observations taken at its visit by its doctor.
+func RecordVitalSigns(record *entity.MedicalRecord) []*entity.VitalSign {
+	v := entity.UnmarshalVitalSigns(record.VitalSigns)
+	if v == nil {
+		return nil
+	}
+
+	var signs []*entity.VitalSign
+	for _, o := range vitals.FromRecord(vitals.RecordVitals{
+		Temperature:      v.Temperature,
+		BloodPressure:    v.BloodPressure,
+		HeartRate:        v.HeartRate,
+		RespiratoryRate:  v.RespiratoryRate,
+		OxygenSaturation: v.OxygenSaturation,
+		Weight:           v.Weight,
+		Height:           v.Height,
+	}) {
+		signs = append(signs, &entity.VitalSign{
+			ID:              uuid.New().String(),
+			PatientID:       record.PatientID,
+			Code:            o.Code,
+			ObservedAt:      record.VisitDate,
+			Value:           o.Value,
+			Unit:            vitals.Lookup(o.Code).Unit,
+			RecordedBy:      record.DoctorID,
+			MedicalRecordID: record.ID,
+		})
+	}
+	return signs
+}
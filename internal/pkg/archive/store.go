@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/wire"
+)
+
+var ProviderSet = wire.NewSet(NewStore)
+
+const (
+	defaultDir       = "exports/patients"
+	defaultRetention = 7 * 24 * time.Hour
+)
+
+// ErrNotFound is returned when opening an archive that is not in the store.
+var ErrNotFound = errors.New("archive not found")
+
+var idRe = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// Store keeps zip archives as files in a local directory, one per ID.
+// Archives are written to a temporary file and renamed into place, so an
+// archive that can be opened is complete.
+type Store struct {
+	dir       string
+	retention time.Duration
+	log       *log.Helper
+}
+
+func NewStore(c *conf.Clinical, logger log.Logger) (*Store, error) {
+	s := &Store{
+		dir:       c.GetPatientExportDir(),
+		retention: defaultRetention,
+		log:       log.NewHelper(logger),
+	}
+	if s.dir == "" {
+		s.dir = defaultDir
+	}
+	if c.GetPatientExportRetention() != nil {
+		s.retention = c.GetPatientExportRetention().AsDuration()
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	return s, nil
+}
+
+// Retention is how long an archive is kept once written.
+func (s *Store) Retention() time.Duration {
+	return s.retention
+}
+
+// Write builds the archive id by calling fn with a writer for its entries.
+// It returns the size and SHA-256 digest of the finished archive. If fn
+// fails nothing is stored.
+func (s *Store) Write(id string, fn func(w *zip.Writer) error) (int64, string, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return 0, "", err
+	}
+	tmp, err := os.CreateTemp(s.dir, "."+id+"-*.tmp")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	digest := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, digest)}
+	zw := zip.NewWriter(counter)
+	if err := fn(zw); err != nil {
+		return 0, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, "", fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return 0, "", fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, "", fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, "", fmt.Errorf("failed to store archive: %w", err)
+	}
+	return counter.n, hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// Open returns the stored archive id for reading.
+func (s *Store) Open(id string) (*os.File, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	return f, nil
+}
+
+// Remove deletes the archive id. Removing an archive that is not there is
+// not an error.
+func (s *Store) Remove(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove archive: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) path(id string) (string, error) {
+	if !idRe.MatchString(id) {
+		return "", fmt.Errorf("invalid archive id %q", id)
+	}
+	return filepath.Join(s.dir, id+".zip"), nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
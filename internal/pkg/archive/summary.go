@@ -0,0 +1,95 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Summary is the human-readable part of a patient data export.
+type Summary struct {
+	Title       string
+	Subject     string
+	GeneratedAt string
+	// Details are label and value pairs printed under the title.
+	Details  [][2]string
+	Sections []Section
+}
+
+// Section is a titled list of entries. Empty is printed instead when the
+// section has no entries.
+type Section struct {
+	Title   string
+	Empty   string
+	Entries []Entry
+}
+
+// Entry is a heading followed by lines of detail.
+type Entry struct {
+	Heading string
+	Lines   []string
+}
+
+// RenderSummary lays the summary out on A4 pages.
+func RenderSummary(s *Summary) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(s.Title, true)
+	pdf.SetCreator("medical-service", true)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 5, tr(fmt.Sprintf("%s  |  Generated %s  |  Page %d", s.Subject, s.GeneratedAt, pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.MultiCell(0, 10, tr(s.Title), "", "L", false)
+	pdf.Ln(2)
+	for _, d := range s.Details {
+		if d[1] == "" {
+			continue
+		}
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(40, 6, tr(d[0]), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.MultiCell(0, 6, tr(d[1]), "", "L", false)
+	}
+
+	for _, section := range s.Sections {
+		pdf.Ln(3)
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.CellFormat(0, 8, tr(section.Title), "B", 1, "L", false, 0, "")
+		pdf.Ln(1)
+		if len(section.Entries) == 0 {
+			pdf.SetFont("Helvetica", "I", 10)
+			pdf.MultiCell(0, 6, tr(section.Empty), "", "L", false)
+			continue
+		}
+		for _, e := range section.Entries {
+			pdf.SetFont("Helvetica", "B", 10)
+			pdf.MultiCell(0, 6, tr(e.Heading), "", "L", false)
+			pdf.SetFont("Helvetica", "", 9)
+			for _, line := range e.Lines {
+				if line == "" {
+					continue
+				}
+				pdf.SetX(20)
+				pdf.MultiCell(0, 5, tr(line), "", "L", false)
+			}
+			pdf.Ln(1)
+		}
+	}
+
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("failed to render summary: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write summary PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,137 @@
+package drugcheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Kinds of finding.
+const (
+	KindAllergy     = "allergy"
+	KindInteraction = "interaction"
+	KindDuplicate   = "duplicate_therapy"
+)
+
+// Finding is one safety concern about a medication being prescribed. Code
+// identifies the concern stably, so that a prescriber's override can refer
+// to it. Severity is the interaction severity, or for allergies the severity
+// recorded with the allergy.
+type Finding struct {
+	Code        string
+	Kind        string
+	Severity    string
+	Medication  string
+	Against     string
+	Description string
+}
+
+// Allergy is a recorded patient allergy.
+type Allergy struct {
+	Allergen string
+	Severity string
+}
+
+// CheckAllergies reports medications that match one of the allergies, either
+// by name or through a drug class (an allergy to "penicillin" matches
+// amoxicillin).
+func (d *Dataset) CheckAllergies(medications []string, allergies []Allergy) []Finding {
+	var findings []Finding
+	for _, med := range medications {
+		terms := d.terms(med)
+		padded := " " + normalize(med) + " "
+		for _, a := range allergies {
+			allergen := normalize(a.Allergen)
+			if allergen == "" {
+				continue
+			}
+
+			matched := strings.Contains(padded, " "+allergen+" ") || terms[0] == allergen
+			viaClass := false
+			for _, class := range terms[1:] {
+				if !matched && class == allergen {
+					matched, viaClass = true, true
+				}
+			}
+			if !matched {
+				continue
+			}
+
+			description := fmt.Sprintf("patient has a recorded %s allergy to %s", a.Severity, a.Allergen)
+			if viaClass {
+				description += fmt.Sprintf(", and %s is in that class", terms[0])
+			}
+			findings = append(findings, Finding{
+				Code:        KindAllergy + ":" + allergen + ":" + terms[0],
+				Kind:        KindAllergy,
+				Severity:    a.Severity,
+				Medication:  med,
+				Against:     a.Allergen,
+				Description: description,
+			})
+		}
+	}
+	return findings
+}
+
+// CheckInteractions reports interactions between the medications being
+// prescribed and those the patient already takes, and among the new
+// medications themselves. For every pair only the most severe interaction
+// is reported. Prescribing a drug the patient already takes is reported as
+// duplicate therapy.
+func (d *Dataset) CheckInteractions(medications, current []string) []Finding {
+	var findings []Finding
+	for i, med := range medications {
+		others := append(append([]string{}, current...), medications[i+1:]...)
+		for j, other := range others {
+			if f := d.checkPair(med, other, j < len(current)); f != nil {
+				findings = append(findings, *f)
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(a, b int) bool {
+		return severityRank(findings[a].Severity) > severityRank(findings[b].Severity)
+	})
+	return findings
+}
+
+func (d *Dataset) checkPair(med, other string, current bool) *Finding {
+	medTerms, otherTerms := d.terms(med), d.terms(other)
+	if medTerms[0] == otherTerms[0] {
+		if !current {
+			return nil
+		}
+		return &Finding{
+			Code:        KindDuplicate + ":" + medTerms[0],
+			Kind:        KindDuplicate,
+			Severity:    SeverityModerate,
+			Medication:  med,
+			Against:     other,
+			Description: fmt.Sprintf("patient is already taking %s", other),
+		}
+	}
+
+	var worst *Interaction
+	for _, a := range medTerms {
+		for _, b := range otherTerms {
+			i, ok := d.interactions[pairKey(a, b)]
+			if ok && (worst == nil || severityRank(i.Severity) > severityRank(worst.Severity)) {
+				worst = i
+			}
+		}
+	}
+	if worst == nil {
+		return nil
+	}
+
+	key := pairKey(medTerms[0], otherTerms[0])
+	return &Finding{
+		Code:        KindInteraction + ":" + key[0] + ":" + key[1],
+		Kind:        KindInteraction,
+		Severity:    worst.Severity,
+		Medication:  med,
+		Against:     other,
+		Description: worst.Description,
+	}
+}
@@ -0,0 +1,157 @@
+package drugcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/wire"
+)
+
+var ProviderSet = wire.NewSet(NewDataset)
+
+// Interaction severities, from least to most serious.
+const (
+	SeverityMinor           = "minor"
+	SeverityModerate        = "moderate"
+	SeverityMajor           = "major"
+	SeverityContraindicated = "contraindicated"
+)
+
+// Drug is a known drug with the names it is prescribed under and the classes
+// it belongs to, e.g. amoxicillin in "penicillin" and "beta-lactam".
+type Drug struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Classes []string `json:"classes"`
+}
+
+// Interaction is a known interaction between two drugs or drug classes.
+type Interaction struct {
+	A           string `json:"a"`
+	B           string `json:"b"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+}
+
+type file struct {
+	Drugs        []*Drug        `json:"drugs"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Dataset is the drug interaction dataset, loaded once at startup from a
+// local JSON file.
+type Dataset struct {
+	names        map[string]*Drug
+	interactions map[[2]string]*Interaction
+}
+
+// NewDataset loads the file named in the clinical config. Without a file
+// configured the dataset is empty and only direct allergy matches are found.
+func NewDataset(c *conf.Clinical, logger log.Logger) (*Dataset, error) {
+	helper := log.NewHelper(logger)
+
+	path := c.GetDrugInteractionsFile()
+	if path == "" {
+		helper.Warn("no drug interaction dataset configured, interaction checks are disabled")
+		return newDataset(&file{}), nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read drug interaction dataset: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse drug interaction dataset %s: %w", path, err)
+	}
+	for _, i := range f.Interactions {
+		if severityRank(i.Severity) == 0 {
+			return nil, fmt.Errorf("drug interaction %s/%s has unknown severity %q", i.A, i.B, i.Severity)
+		}
+	}
+
+	helper.Infof("loaded drug interaction dataset: %d drugs, %d interactions", len(f.Drugs), len(f.Interactions))
+	return newDataset(&f), nil
+}
+
+func newDataset(f *file) *Dataset {
+	d := &Dataset{
+		names:        make(map[string]*Drug),
+		interactions: make(map[[2]string]*Interaction),
+	}
+	for _, drug := range f.Drugs {
+		for _, name := range append([]string{drug.Name}, drug.Aliases...) {
+			d.names[normalize(name)] = drug
+		}
+	}
+	for _, i := range f.Interactions {
+		d.interactions[pairKey(normalize(i.A), normalize(i.B))] = i
+	}
+	return d
+}
+
+// Lookup finds the drug a prescribed medication name refers to. Names may
+// carry a strength or form ("Amoxicillin 500mg capsule"), so any known name
+// appearing as a whole word sequence matches; the longest one wins.
+func (d *Dataset) Lookup(medication string) *Drug {
+	padded := " " + normalize(medication) + " "
+	var best *Drug
+	bestLen := 0
+	for name, drug := range d.names {
+		if len(name) > bestLen && strings.Contains(padded, " "+name+" ") {
+			best, bestLen = drug, len(name)
+		}
+	}
+	return best
+}
+
+// terms are the names an interaction or allergy can be recorded against for
+// a medication: its drug name and classes when the drug is known, otherwise
+// the medication name as written.
+func (d *Dataset) terms(medication string) []string {
+	drug := d.Lookup(medication)
+	if drug == nil {
+		return []string{normalize(medication)}
+	}
+	terms := []string{normalize(drug.Name)}
+	for _, c := range drug.Classes {
+		terms = append(terms, normalize(c))
+	}
+	return terms
+}
+
+// normalize lower-cases s and reduces it to words separated by single
+// spaces, treating punctuation other than hyphens as a separator.
+func normalize(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+	return strings.Join(words, " ")
+}
+
+func pairKey(a, b string) [2]string {
+	if b < a {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityMinor:
+		return 1
+	case SeverityModerate:
+		return 2
+	case SeverityMajor:
+		return 3
+	case SeverityContraindicated:
+		return 4
+	default:
+		return 0
+	}
+}
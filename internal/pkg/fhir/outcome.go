@@ -0,0 +1,63 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is a request failure reported to the client as an OperationOutcome
+// with an HTTP status.
+type Error struct {
+	Status int
+	// Code is the OperationOutcome issue type, such as not-found or invalid.
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NotFound reports an unknown resource.
+func NotFound(format string, args ...interface{}) error {
+	return &Error{Status: http.StatusNotFound, Code: "not-found", Message: fmt.Sprintf(format, args...)}
+}
+
+// Invalid reports a malformed request.
+func Invalid(format string, args ...interface{}) error {
+	return &Error{Status: http.StatusBadRequest, Code: "invalid", Message: fmt.Sprintf(format, args...)}
+}
+
+// NotSupported reports a resource type or interaction the server does not
+// offer.
+func NotSupported(format string, args ...interface{}) error {
+	return &Error{Status: http.StatusNotFound, Code: "not-supported", Message: fmt.Sprintf(format, args...)}
+}
+
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+
+type OperationOutcomeIssue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+// Outcome turns err into an OperationOutcome and the HTTP status to send it
+// with. Errors other than *Error are reported as server errors.
+func Outcome(err error) (int, *OperationOutcome) {
+	status, code := http.StatusInternalServerError, "exception"
+	var fe *Error
+	if errors.As(err, &fe) {
+		status, code = fe.Status, fe.Code
+	}
+	return status, &OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue: []OperationOutcomeIssue{
+			{Severity: "error", Code: code, Diagnostics: err.Error()},
+		},
+	}
+}
@@ -0,0 +1,350 @@
+// Package fhir holds the subset of FHIR R4 the service reads and writes as
+// JSON, together with helpers for search parameters and error outcomes.
+package fhir
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version is the FHIR version resources conform to.
+const Version = "4.0.1"
+
+// ContentType is the media type of FHIR JSON.
+const ContentType = "application/fhir+json; charset=utf-8"
+
+// Code systems used in identifiers and codings.
+const (
+	SystemATC          = "http://www.whocc.no/atc"
+	SystemActCode      = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+	SystemTiming       = "http://terminology.hl7.org/CodeSystem/v3-GTSAbbreviation"
+	SystemUCUM         = "http://unitsofmeasure.org"
+	SystemConditionVer = "http://terminology.hl7.org/CodeSystem/condition-ver-status"
+	SystemConditionCat = "http://terminology.hl7.org/CodeSystem/condition-category"
+)
+
+type Meta struct {
+	VersionID   string `json:"versionId,omitempty"`
+	LastUpdated string `json:"lastUpdated,omitempty"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Identifier struct {
+	Use    string `json:"use,omitempty"`
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+}
+
+type Address struct {
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type Quantity struct {
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit,omitempty"`
+	System string  `json:"system,omitempty"`
+	Code   string  `json:"code,omitempty"`
+}
+
+type Annotation struct {
+	Text string `json:"text"`
+}
+
+type Patient struct {
+	ResourceType string         `json:"resourceType"`
+	ID           string         `json:"id"`
+	Meta         *Meta          `json:"meta,omitempty"`
+	Identifier   []Identifier   `json:"identifier,omitempty"`
+	Active       *bool          `json:"active,omitempty"`
+	Name         []HumanName    `json:"name,omitempty"`
+	Telecom      []ContactPoint `json:"telecom,omitempty"`
+	Gender       string         `json:"gender,omitempty"`
+	BirthDate    string         `json:"birthDate,omitempty"`
+	Address      []Address      `json:"address,omitempty"`
+	Link         []PatientLink  `json:"link,omitempty"`
+}
+
+type PatientLink struct {
+	Other Reference `json:"other"`
+	Type  string    `json:"type"`
+}
+
+type Practitioner struct {
+	ResourceType  string                      `json:"resourceType"`
+	ID            string                      `json:"id"`
+	Meta          *Meta                       `json:"meta,omitempty"`
+	Identifier    []Identifier                `json:"identifier,omitempty"`
+	Active        *bool                       `json:"active,omitempty"`
+	Name          []HumanName                 `json:"name,omitempty"`
+	Telecom       []ContactPoint              `json:"telecom,omitempty"`
+	Qualification []PractitionerQualification `json:"qualification,omitempty"`
+	Communication []CodeableConcept           `json:"communication,omitempty"`
+}
+
+type PractitionerQualification struct {
+	Code CodeableConcept `json:"code"`
+}
+
+type Appointment struct {
+	ResourceType       string                   `json:"resourceType"`
+	ID                 string                   `json:"id"`
+	Meta               *Meta                    `json:"meta,omitempty"`
+	Identifier         []Identifier             `json:"identifier,omitempty"`
+	Status             string                   `json:"status"`
+	CancelationReason  *CodeableConcept         `json:"cancelationReason,omitempty"`
+	AppointmentType    *CodeableConcept         `json:"appointmentType,omitempty"`
+	ReasonCode         []CodeableConcept        `json:"reasonCode,omitempty"`
+	Description        string                   `json:"description,omitempty"`
+	Start              string                   `json:"start,omitempty"`
+	End                string                   `json:"end,omitempty"`
+	MinutesDuration    int                      `json:"minutesDuration,omitempty"`
+	Created            string                   `json:"created,omitempty"`
+	Comment            string                   `json:"comment,omitempty"`
+	PatientInstruction string                   `json:"patientInstruction,omitempty"`
+	Participant        []AppointmentParticipant `json:"participant"`
+}
+
+type AppointmentParticipant struct {
+	Actor    *Reference `json:"actor,omitempty"`
+	Required string     `json:"required,omitempty"`
+	Status   string     `json:"status"`
+}
+
+type MedicationRequest struct {
+	ResourceType              string            `json:"resourceType"`
+	ID                        string            `json:"id"`
+	Meta                      *Meta             `json:"meta,omitempty"`
+	Identifier                []Identifier      `json:"identifier,omitempty"`
+	Status                    string            `json:"status"`
+	StatusReason              *CodeableConcept  `json:"statusReason,omitempty"`
+	Intent                    string            `json:"intent"`
+	MedicationCodeableConcept *CodeableConcept  `json:"medicationCodeableConcept,omitempty"`
+	Subject                   Reference         `json:"subject"`
+	AuthoredOn                string            `json:"authoredOn,omitempty"`
+	Requester                 *Reference        `json:"requester,omitempty"`
+	ReasonCode                []CodeableConcept `json:"reasonCode,omitempty"`
+	GroupIdentifier           *Identifier       `json:"groupIdentifier,omitempty"`
+	Note                      []Annotation      `json:"note,omitempty"`
+	DosageInstruction         []Dosage          `json:"dosageInstruction,omitempty"`
+	DispenseRequest           *DispenseRequest  `json:"dispenseRequest,omitempty"`
+}
+
+type Dosage struct {
+	Sequence    int              `json:"sequence,omitempty"`
+	Text        string           `json:"text,omitempty"`
+	Timing      *Timing          `json:"timing,omitempty"`
+	Route       *CodeableConcept `json:"route,omitempty"`
+	DoseAndRate []DoseAndRate    `json:"doseAndRate,omitempty"`
+}
+
+type Timing struct {
+	Code *CodeableConcept `json:"code,omitempty"`
+}
+
+type DoseAndRate struct {
+	DoseQuantity *Quantity `json:"doseQuantity,omitempty"`
+}
+
+type DispenseRequest struct {
+	ValidityPeriod         *Period   `json:"validityPeriod,omitempty"`
+	NumberOfRepeatsAllowed int32     `json:"numberOfRepeatsAllowed,omitempty"`
+	Quantity               *Quantity `json:"quantity,omitempty"`
+	ExpectedSupplyDuration *Quantity `json:"expectedSupplyDuration,omitempty"`
+}
+
+type Encounter struct {
+	ResourceType string                 `json:"resourceType"`
+	ID           string                 `json:"id"`
+	Meta         *Meta                  `json:"meta,omitempty"`
+	Identifier   []Identifier           `json:"identifier,omitempty"`
+	Status       string                 `json:"status"`
+	Class        Coding                 `json:"class"`
+	Type         []CodeableConcept      `json:"type,omitempty"`
+	Subject      *Reference             `json:"subject,omitempty"`
+	Participant  []EncounterParticipant `json:"participant,omitempty"`
+	Period       *Period                `json:"period,omitempty"`
+	ReasonCode   []CodeableConcept      `json:"reasonCode,omitempty"`
+	Diagnosis    []EncounterDiagnosis   `json:"diagnosis,omitempty"`
+}
+
+type EncounterParticipant struct {
+	Individual *Reference `json:"individual,omitempty"`
+}
+
+type EncounterDiagnosis struct {
+	Condition Reference `json:"condition"`
+}
+
+type Condition struct {
+	ResourceType       string            `json:"resourceType"`
+	ID                 string            `json:"id"`
+	Meta               *Meta             `json:"meta,omitempty"`
+	ClinicalStatus     *CodeableConcept  `json:"clinicalStatus,omitempty"`
+	VerificationStatus *CodeableConcept  `json:"verificationStatus,omitempty"`
+	Category           []CodeableConcept `json:"category,omitempty"`
+	Code               *CodeableConcept  `json:"code,omitempty"`
+	Subject            Reference         `json:"subject"`
+	Encounter          *Reference        `json:"encounter,omitempty"`
+	RecordedDate       string            `json:"recordedDate,omitempty"`
+	Recorder           *Reference        `json:"recorder,omitempty"`
+	Note               []Annotation      `json:"note,omitempty"`
+}
+
+type Schedule struct {
+	ResourceType    string            `json:"resourceType"`
+	ID              string            `json:"id"`
+	Meta            *Meta             `json:"meta,omitempty"`
+	Active          *bool             `json:"active,omitempty"`
+	Specialty       []CodeableConcept `json:"specialty,omitempty"`
+	Actor           []Reference       `json:"actor"`
+	PlanningHorizon *Period           `json:"planningHorizon,omitempty"`
+	Comment         string            `json:"comment,omitempty"`
+}
+
+type Slot struct {
+	ResourceType string    `json:"resourceType"`
+	ID           string    `json:"id"`
+	Schedule     Reference `json:"schedule"`
+	Status       string    `json:"status"`
+	Start        string    `json:"start"`
+	End          string    `json:"end"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Timestamp    string        `json:"timestamp,omitempty"`
+	Total        *int64        `json:"total,omitempty"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type BundleEntry struct {
+	FullURL  string             `json:"fullUrl,omitempty"`
+	Resource json.RawMessage    `json:"resource,omitempty"`
+	Search   *BundleEntrySearch `json:"search,omitempty"`
+	Request  *BundleRequest     `json:"request,omitempty"`
+	Response *BundleResponse    `json:"response,omitempty"`
+}
+
+type BundleEntrySearch struct {
+	Mode string `json:"mode"`
+}
+
+type BundleRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type BundleResponse struct {
+	Status   string `json:"status"`
+	Location string `json:"location,omitempty"`
+}
+
+type CapabilityStatement struct {
+	ResourceType string              `json:"resourceType"`
+	Status       string              `json:"status"`
+	Date         string              `json:"date"`
+	Kind         string              `json:"kind"`
+	Software     *CapabilitySoftware `json:"software,omitempty"`
+	FHIRVersion  string              `json:"fhirVersion"`
+	Format       []string            `json:"format"`
+	Rest         []CapabilityRest    `json:"rest"`
+}
+
+type CapabilitySoftware struct {
+	Name string `json:"name"`
+}
+
+type CapabilityRest struct {
+	Mode     string               `json:"mode"`
+	Resource []CapabilityResource `json:"resource"`
+}
+
+type CapabilityResource struct {
+	Type        string                  `json:"type"`
+	Interaction []CapabilityInteraction `json:"interaction"`
+	SearchParam []CapabilitySearchParam `json:"searchParam,omitempty"`
+}
+
+type CapabilityInteraction struct {
+	Code string `json:"code"`
+}
+
+type CapabilitySearchParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Identify reads the type and ID of the resource encoded in raw.
+func Identify(raw json.RawMessage) (resourceType, id string, err error) {
+	var header struct {
+		ResourceType string `json:"resourceType"`
+		ID           string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return "", "", err
+	}
+	if header.ResourceType == "" {
+		return "", "", fmt.Errorf("resourceType is missing")
+	}
+	return header.ResourceType, header.ID, nil
+}
+
+// Instant formats t as a FHIR instant.
+func Instant(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Ref makes a reference to the resource of type resourceType with id.
+func Ref(resourceType, id string) *Reference {
+	return &Reference{Reference: resourceType + "/" + id}
+}
+
+// Bool returns a pointer to b, for optional boolean elements.
+func Bool(b bool) *bool {
+	return &b
+}
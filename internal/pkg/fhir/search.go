@@ -0,0 +1,145 @@
+package fhir
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Paging defaults for search results.
+const (
+	DefaultCount = 20
+	MaxCount     = 100
+)
+
+// Paging parameters: _count is standard, _offset is how this server pages.
+const (
+	ParamCount  = "_count"
+	ParamOffset = "_offset"
+)
+
+// Page reads the paging parameters of a search.
+func Page(params url.Values) (offset, count int, err error) {
+	count = DefaultCount
+	if v := params.Get(ParamCount); v != "" {
+		if count, err = strconv.Atoi(v); err != nil || count < 0 {
+			return 0, 0, Invalid("_count must be a non-negative integer")
+		}
+		if count > MaxCount {
+			count = MaxCount
+		}
+	}
+	if v := params.Get(ParamOffset); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, Invalid("_offset must be a non-negative integer")
+		}
+	}
+	return offset, count, nil
+}
+
+// DateRange reads the values of a date search parameter, each with an
+// optional eq, ge, gt, le or lt prefix, as a half-open range [From, To).
+// Nil bounds are open. A value stands for the whole period its precision
+// covers, so date=2026-10 matches all of October.
+func DateRange(name string, values []string) (from, to *time.Time, err error) {
+	after := func(t time.Time) {
+		if from == nil || t.After(*from) {
+			from = &t
+		}
+	}
+	before := func(t time.Time) {
+		if to == nil || t.Before(*to) {
+			to = &t
+		}
+	}
+	for _, v := range values {
+		prefix := "eq"
+		if len(v) > 2 && !isDigit(v[0]) {
+			prefix, v = v[:2], v[2:]
+		}
+		lo, hi, err := parseDate(v)
+		if err != nil {
+			return nil, nil, Invalid("%s: %v", name, err)
+		}
+		switch prefix {
+		case "eq":
+			after(lo)
+			before(hi)
+		case "ge":
+			after(lo)
+		case "gt":
+			after(hi)
+		case "le":
+			before(hi)
+		case "lt":
+			before(lo)
+		default:
+			return nil, nil, Invalid("%s: prefix %s is not supported", name, prefix)
+		}
+	}
+	return from, to, nil
+}
+
+// parseDate reads a FHIR date or dateTime and returns the period it covers.
+func parseDate(v string) (lo, hi time.Time, err error) {
+	switch len(v) {
+	case 4:
+		lo, err = time.Parse("2006", v)
+		return lo, lo.AddDate(1, 0, 0), err
+	case 7:
+		lo, err = time.Parse("2006-01", v)
+		return lo, lo.AddDate(0, 1, 0), err
+	case 10:
+		lo, err = time.Parse("2006-01-02", v)
+		return lo, lo.AddDate(0, 0, 1), err
+	}
+	// A "+" offset left unescaped in a query string arrives as a space.
+	lo, err = time.Parse(time.RFC3339, strings.ReplaceAll(v, " ", "+"))
+	if err != nil {
+		return lo, hi, err
+	}
+	lo = lo.UTC()
+	return lo, lo.Add(time.Second), nil
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// ReferenceID reads a reference search value, "id", "Type/id" or an absolute
+// URL ending in Type/id, to a resource of type resourceType.
+func ReferenceID(name, value, resourceType string) (string, error) {
+	parts := strings.Split(strings.TrimSuffix(value, "/"), "/")
+	switch {
+	case len(parts) == 1:
+		return parts[0], nil
+	case parts[len(parts)-2] == resourceType:
+		return parts[len(parts)-1], nil
+	}
+	return "", Invalid("%s must reference a %s", name, resourceType)
+}
+
+// Token splits a token search value into its system and code. A value
+// without a bar has no system.
+func Token(value string) (system, code string) {
+	if i := strings.IndexByte(value, '|'); i >= 0 {
+		return value[:i], value[i+1:]
+	}
+	return "", value
+}
+
+// SearchURL is the URL of a page of search results.
+func SearchURL(base, resourceType string, params url.Values, offset, count int) string {
+	q := url.Values{}
+	for k, v := range params {
+		if k != ParamOffset && k != ParamCount {
+			q[k] = v
+		}
+	}
+	q.Set(ParamCount, strconv.Itoa(count))
+	if offset > 0 {
+		q.Set(ParamOffset, strconv.Itoa(offset))
+	}
+	return base + "/" + resourceType + "?" + q.Encode()
+}
@@ -0,0 +1,266 @@
+package formulary
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Routes of administration a prescription item may use.
+var Routes = []string{
+	"oral", "sublingual", "buccal", "topical", "transdermal", "inhaled", "nasal",
+	"ophthalmic", "otic", "rectal", "vaginal", "intravenous", "intramuscular",
+	"subcutaneous",
+}
+
+var routeAliases = map[string]string{
+	"po":         "oral",
+	"by mouth":   "oral",
+	"mouth":      "oral",
+	"sl":         "sublingual",
+	"iv":         "intravenous",
+	"im":         "intramuscular",
+	"sc":         "subcutaneous",
+	"sq":         "subcutaneous",
+	"subcut":     "subcutaneous",
+	"inhalation": "inhaled",
+	"inh":        "inhaled",
+	"eye":        "ophthalmic",
+	"ear":        "otic",
+	"pr":         "rectal",
+	"pv":         "vaginal",
+	"skin":       "topical",
+	"patch":      "transdermal",
+	"intranasal": "nasal",
+}
+
+// DoseUnits are the units a dose may be written in.
+var DoseUnits = []string{
+	"mg", "mcg", "g", "ml", "mmol", "unit", "tablet", "capsule", "puff", "drop",
+	"spray", "patch", "sachet", "application",
+}
+
+var unitAliases = map[string]string{
+	"milligram":    "mg",
+	"milligrams":   "mg",
+	"microgram":    "mcg",
+	"micrograms":   "mcg",
+	"ug":           "mcg",
+	"µg":           "mcg",
+	"gram":         "g",
+	"grams":        "g",
+	"millilitre":   "ml",
+	"milliliter":   "ml",
+	"millilitres":  "ml",
+	"milliliters":  "ml",
+	"units":        "unit",
+	"iu":           "unit",
+	"u":            "unit",
+	"tab":          "tablet",
+	"tabs":         "tablet",
+	"tablets":      "tablet",
+	"cap":          "capsule",
+	"caps":         "capsule",
+	"capsules":     "capsule",
+	"puffs":        "puff",
+	"drops":        "drop",
+	"gtt":          "drop",
+	"sprays":       "spray",
+	"patches":      "patch",
+	"sachets":      "sachet",
+	"applications": "application",
+	"apply":        "application",
+}
+
+// Frequency codes. Besides these, QnH means every n hours and nXD n times a
+// day for n above four.
+const (
+	FrequencyOnceDaily  = "QD"
+	FrequencyTwiceDaily = "BID"
+	FrequencyThreeTimes = "TID"
+	FrequencyFourTimes  = "QID"
+	FrequencyBedtime    = "QHS"
+	FrequencyWeekly     = "QW"
+	FrequencyAsNeeded   = "PRN"
+	FrequencyOnce       = "STAT"
+)
+
+var frequencyPhrases = map[string]string{
+	"qd":             FrequencyOnceDaily,
+	"od":             FrequencyOnceDaily,
+	"daily":          FrequencyOnceDaily,
+	"once daily":     FrequencyOnceDaily,
+	"once a day":     FrequencyOnceDaily,
+	"once per day":   FrequencyOnceDaily,
+	"every day":      FrequencyOnceDaily,
+	"in the morning": FrequencyOnceDaily,
+	"bid":            FrequencyTwiceDaily,
+	"bd":             FrequencyTwiceDaily,
+	"twice daily":    FrequencyTwiceDaily,
+	"twice a day":    FrequencyTwiceDaily,
+	"tid":            FrequencyThreeTimes,
+	"tds":            FrequencyThreeTimes,
+	"qid":            FrequencyFourTimes,
+	"qds":            FrequencyFourTimes,
+	"qhs":            FrequencyBedtime,
+	"nightly":        FrequencyBedtime,
+	"at night":       FrequencyBedtime,
+	"at bedtime":     FrequencyBedtime,
+	"qw":             FrequencyWeekly,
+	"weekly":         FrequencyWeekly,
+	"once weekly":    FrequencyWeekly,
+	"once a week":    FrequencyWeekly,
+	"prn":            FrequencyAsNeeded,
+	"as needed":      FrequencyAsNeeded,
+	"as required":    FrequencyAsNeeded,
+	"when required":  FrequencyAsNeeded,
+	"stat":           FrequencyOnce,
+	"once":           FrequencyOnce,
+	"single dose":    FrequencyOnce,
+	"immediately":    FrequencyOnce,
+}
+
+var (
+	doseRe       = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([a-zµ]+)$`)
+	everyHoursRe = regexp.MustCompile(`^(?:every|q)\s*(\d+)\s*(?:h|hr|hrs|hour|hours)$`)
+	timesDailyRe = regexp.MustCompile(`^(\d+|one|two|three|four|five|six)\s*(?:x|times)\s*(?:daily|a day|per day|/day)$`)
+	durationRe   = regexp.MustCompile(`^(?:for\s+)?(\d+)\s*(d|day|days|w|wk|wks|week|weeks|m|mo|month|months)$`)
+	frequencyRe  = regexp.MustCompile(`^(?:Q([1-9]|1\d|2[0-4])H|([5-9]|1\d|2[0-4])XD)$`)
+)
+
+var numberWords = map[string]int{"one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6}
+
+// NormalizeRoute maps a written route ("PO", "by mouth") to one of Routes.
+func NormalizeRoute(route string) (string, bool) {
+	route = phrase(route)
+	if contains(Routes, route) {
+		return route, true
+	}
+	if canonical, ok := routeAliases[route]; ok {
+		return canonical, true
+	}
+	return "", false
+}
+
+// NormalizeUnit maps a written dose unit ("tabs", "ug") to one of DoseUnits.
+func NormalizeUnit(unit string) (string, bool) {
+	unit = phrase(unit)
+	if contains(DoseUnits, unit) {
+		return unit, true
+	}
+	if canonical, ok := unitAliases[unit]; ok {
+		return canonical, true
+	}
+	return "", false
+}
+
+// ParseDose reads a dose written as an amount and a unit, such as "500mg"
+// or "2 tablets".
+func ParseDose(dosage string) (float64, string, error) {
+	m := doseRe.FindStringSubmatch(phrase(dosage))
+	if m == nil {
+		return 0, "", fmt.Errorf("dosage %q is not an amount and unit such as \"500 mg\"", dosage)
+	}
+	amount, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || amount <= 0 {
+		return 0, "", fmt.Errorf("dosage %q must have a positive amount", dosage)
+	}
+	unit, ok := NormalizeUnit(m[2])
+	if !ok {
+		return 0, "", fmt.Errorf("dosage %q has unknown unit %q", dosage, m[2])
+	}
+	return amount, unit, nil
+}
+
+// ParseFrequency maps a written frequency ("twice daily", "every 8 hours",
+// "BID") to a frequency code.
+func ParseFrequency(frequency string) (string, error) {
+	p := phrase(frequency)
+	if code, ok := frequencyPhrases[p]; ok {
+		return code, nil
+	}
+	if ValidFrequency(strings.ToUpper(p)) {
+		return strings.ToUpper(p), nil
+	}
+	if m := everyHoursRe.FindStringSubmatch(p); m != nil {
+		hours, _ := strconv.Atoi(m[1])
+		if code := fmt.Sprintf("Q%dH", hours); hours > 0 && frequencyRe.MatchString(code) {
+			return code, nil
+		}
+	}
+	if m := timesDailyRe.FindStringSubmatch(p); m != nil {
+		n, ok := numberWords[m[1]]
+		if !ok {
+			n, _ = strconv.Atoi(m[1])
+		}
+		switch {
+		case n == 1:
+			return FrequencyOnceDaily, nil
+		case n == 2:
+			return FrequencyTwiceDaily, nil
+		case n == 3:
+			return FrequencyThreeTimes, nil
+		case n == 4:
+			return FrequencyFourTimes, nil
+		case n > 4 && n <= 24:
+			return fmt.Sprintf("%dXD", n), nil
+		}
+	}
+	return "", fmt.Errorf("frequency %q is not recognised; use e.g. \"twice daily\", \"every 8 hours\" or \"BID\"", frequency)
+}
+
+// ValidFrequency reports whether code is a frequency code.
+func ValidFrequency(code string) bool {
+	for _, c := range frequencyPhrases {
+		if c == code {
+			return true
+		}
+	}
+	return frequencyRe.MatchString(code)
+}
+
+// ParseDuration reads a duration such as "7 days" or "for 2 weeks" as a
+// number of days, counting a month as 30 days. An empty duration, or one
+// such as "ongoing", is 0.
+func ParseDuration(duration string) (int32, error) {
+	p := phrase(duration)
+	switch p {
+	case "", "ongoing", "continuous", "long term", "indefinite", "until further notice":
+		return 0, nil
+	}
+	m := durationRe.FindStringSubmatch(p)
+	if m == nil {
+		return 0, fmt.Errorf("duration %q is not recognised; use e.g. \"7 days\" or \"2 weeks\"", duration)
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 || n > 3650 {
+		return 0, fmt.Errorf("duration %q is out of range", duration)
+	}
+	switch m[2][0] {
+	case 'w':
+		n *= 7
+	case 'm':
+		n *= 30
+	}
+	return int32(n), nil
+}
+
+// phrase lower-cases s and collapses whitespace and punctuation other than
+// dots and slashes.
+func phrase(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '/' && r != 'µ'
+	})
+	return strings.Join(words, " ")
+}
+
+// normalize lower-cases s and reduces it to words separated by single
+// spaces, treating punctuation other than hyphens as a separator.
+func normalize(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+	})
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,183 @@
+package formulary
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/wire"
+)
+
+var ProviderSet = wire.NewSet(NewFormulary)
+
+// DefaultMaxQuantity bounds the quantity of drugs outside the formulary, or
+// of entries that do not set their own limit.
+const DefaultMaxQuantity = 1000
+
+// Drug is a formulary entry: a coded drug with the routes it may be given by
+// and the units its doses are written in.
+type Drug struct {
+	Code        string   `json:"code"`
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases"`
+	Routes      []string `json:"routes"`
+	DoseUnits   []string `json:"dose_units"`
+	MaxQuantity int32    `json:"max_quantity"`
+}
+
+// AllowsRoute reports whether the drug may be given by route. An entry
+// without routes allows any known route.
+func (d *Drug) AllowsRoute(route string) bool {
+	return len(d.Routes) == 0 || contains(d.Routes, route)
+}
+
+// AllowsUnit reports whether doses of the drug may be written in unit. An
+// entry without units allows any known unit.
+func (d *Drug) AllowsUnit(unit string) bool {
+	return len(d.DoseUnits) == 0 || contains(d.DoseUnits, unit)
+}
+
+// QuantityLimit is the largest quantity that may be prescribed at once.
+func (d *Drug) QuantityLimit() int32 {
+	if d.MaxQuantity > 0 {
+		return d.MaxQuantity
+	}
+	return DefaultMaxQuantity
+}
+
+type file struct {
+	CodeSystem string  `json:"code_system"`
+	Drugs      []*Drug `json:"drugs"`
+}
+
+// Formulary is the local drug formulary, loaded once at startup.
+type Formulary struct {
+	codeSystem string
+	drugs      []*Drug
+	codes      map[string]*Drug
+	names      map[string]*Drug
+}
+
+// NewFormulary loads the file named in the clinical config. Without a file
+// configured the formulary is empty and no medication gets a drug code.
+func NewFormulary(c *conf.Clinical, logger log.Logger) (*Formulary, error) {
+	helper := log.NewHelper(logger)
+
+	path := c.GetFormularyFile()
+	if path == "" {
+		helper.Warn("no formulary configured, medications will not be coded")
+		return newFormulary(&file{})
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read formulary: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse formulary %s: %w", path, err)
+	}
+
+	formulary, err := newFormulary(&f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid formulary %s: %w", path, err)
+	}
+	helper.Infof("loaded formulary: %d %s drugs", len(f.Drugs), f.CodeSystem)
+	return formulary, nil
+}
+
+func newFormulary(f *file) (*Formulary, error) {
+	fm := &Formulary{
+		codeSystem: f.CodeSystem,
+		drugs:      f.Drugs,
+		codes:      make(map[string]*Drug),
+		names:      make(map[string]*Drug),
+	}
+	for _, drug := range f.Drugs {
+		if drug.Code == "" || drug.Name == "" {
+			return nil, fmt.Errorf("drug %q has no code or name", drug.Name+drug.Code)
+		}
+		if _, ok := fm.codes[drug.Code]; ok {
+			return nil, fmt.Errorf("duplicate drug code %s", drug.Code)
+		}
+		for _, route := range drug.Routes {
+			if !contains(Routes, route) {
+				return nil, fmt.Errorf("drug %s has unknown route %q", drug.Code, route)
+			}
+		}
+		for _, unit := range drug.DoseUnits {
+			if !contains(DoseUnits, unit) {
+				return nil, fmt.Errorf("drug %s has unknown dose unit %q", drug.Code, unit)
+			}
+		}
+
+		fm.codes[drug.Code] = drug
+		for _, name := range append([]string{drug.Name}, drug.Aliases...) {
+			fm.names[normalize(name)] = drug
+		}
+	}
+	return fm, nil
+}
+
+func (f *Formulary) CodeSystem() string {
+	return f.codeSystem
+}
+
+func (f *Formulary) Get(code string) *Drug {
+	return f.codes[strings.ToUpper(strings.TrimSpace(code))]
+}
+
+// Lookup finds the drug a prescribed medication name refers to. Names may
+// carry a strength or form ("Amoxicillin 500mg capsule"), so any known name
+// appearing as a whole word sequence matches; the longest one wins.
+func (f *Formulary) Lookup(medication string) *Drug {
+	padded := " " + normalize(medication) + " "
+	var best *Drug
+	bestLen := 0
+	for name, drug := range f.names {
+		if len(name) > bestLen && strings.Contains(padded, " "+name+" ") {
+			best, bestLen = drug, len(name)
+		}
+	}
+	return best
+}
+
+// Search returns the drugs whose name, alias or code starts with query,
+// ordered by name.
+func (f *Formulary) Search(query string, limit int) []*Drug {
+	query = normalize(query)
+	var matches []*Drug
+	for _, drug := range f.drugs {
+		if query == "" || strings.HasPrefix(strings.ToLower(drug.Code), query) || matchesName(drug, query) {
+			matches = append(matches, drug)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+func matchesName(drug *Drug, query string) bool {
+	for _, name := range append([]string{drug.Name}, drug.Aliases...) {
+		if strings.HasPrefix(normalize(name), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
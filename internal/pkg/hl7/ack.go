@@ -0,0 +1,52 @@
+package hl7
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Acknowledgment codes, from MSA-1.
+const (
+	AckAccept = "AA"
+	AckError  = "AE"
+	AckReject = "AR"
+)
+
+// ErrUnsupported is returned, wrapped, for messages of a type or trigger
+// event the receiver does not handle. They are rejected rather than failed.
+var ErrUnsupported = errors.New("unsupported message type")
+
+// ACK writes the acknowledgment of m, sent back by application at facility.
+// m may be nil for input that could not be parsed at all. text explains an
+// error or rejection and is left out of an accept.
+func ACK(m *Message, code, text, application, facility string) string {
+	h := Header{
+		SendingApplication: application,
+		SendingFacility:    facility,
+		Type:               "ACK",
+		ControlID:          uuid.New().String(),
+		Time:               time.Now(),
+	}
+	controlID := ""
+	if m != nil {
+		msh := m.Segment("MSH")
+		h.ReceivingApplication = msh.Component(3, 1)
+		h.ReceivingFacility = msh.Component(4, 1)
+		if event := msh.Component(9, 2); event != "" {
+			h.Type = Components("ACK", event, "ACK")
+		}
+		controlID = m.ControlID()
+	}
+	if code == AckAccept {
+		text = ""
+	}
+	return Build(h, []string{"MSA", code, Escape(controlID), Escape(text)})
+}
+
+// Ack is the acknowledgment code and text of an ACK message.
+func (m *Message) Ack() (code, text string) {
+	msa := m.Segment("MSA")
+	return msa.Value(1), msa.Value(3)
+}
@@ -0,0 +1,121 @@
+package hl7
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PatientIdentity is the patient named by a PID segment.
+type PatientIdentity struct {
+	// ID is the first identifier in PID-3, and Authority the namespace of
+	// its assigning authority.
+	ID        string
+	Authority string
+	FirstName string
+	LastName  string
+	// BirthDate is PID-7 as YYYY-MM-DD, empty unless a full date is given.
+	BirthDate string
+	// Sex is the PID-8 administrative sex code, such as M, F, O or U.
+	Sex     string
+	Phone   string
+	Email   string
+	Street  string
+	City    string
+	State   string
+	ZipCode string
+	Country string
+}
+
+// ADT is the content of an ADT^A04 or ADT^A08 message.
+type ADT struct {
+	Event   string
+	Patient *PatientIdentity
+}
+
+// ParseADT extracts the patient of an ADT message.
+func ParseADT(m *Message) (*ADT, error) {
+	if m.Segment("MSH").Component(9, 1) != "ADT" {
+		return nil, fmt.Errorf("message type %s is not ADT", m.Type())
+	}
+	patient, err := parsePID(m)
+	if err != nil {
+		return nil, err
+	}
+	return &ADT{Event: m.Segment("MSH").Component(9, 2), Patient: patient}, nil
+}
+
+func parsePID(m *Message) (*PatientIdentity, error) {
+	pid := m.Segment("PID")
+	if pid == nil {
+		return nil, fmt.Errorf("message has no PID segment")
+	}
+	p := &PatientIdentity{
+		ID:        pid.Component(3, 1),
+		Authority: pid.Component(3, 4),
+		LastName:  pid.Component(5, 1),
+		FirstName: pid.Component(5, 2),
+		Sex:       pid.Value(8),
+		Street:    pid.Component(11, 1),
+		City:      pid.Component(11, 3),
+		State:     pid.Component(11, 4),
+		ZipCode:   pid.Component(11, 5),
+		Country:   pid.Component(11, 6),
+	}
+	if p.ID == "" {
+		return nil, fmt.Errorf("PID-3: patient identifier is required")
+	}
+	if other := pid.Component(11, 2); other != "" {
+		p.Street = strings.TrimSpace(p.Street + ", " + other)
+	}
+	if dob := pid.Value(7); len(dob) >= 8 {
+		t, err := ParseTime(dob[:8])
+		if err != nil {
+			return nil, fmt.Errorf("PID-7: %w", err)
+		}
+		p.BirthDate = t.Format("2006-01-02")
+	}
+	p.Phone, p.Email = pid.telecom(13)
+	if p.Phone == "" || p.Email == "" {
+		phone, email := pid.telecom(14)
+		if p.Phone == "" {
+			p.Phone = phone
+		}
+		if p.Email == "" {
+			p.Email = email
+		}
+	}
+	return p, nil
+}
+
+// telecom returns the first phone number and email address among the
+// repetitions of XTN field n. The number is taken from XTN-12, XTN-6 and
+// XTN-7, or the older XTN-1; the email from XTN-4 of an Internet address.
+func (s *Segment) telecom(n int) (phone, email string) {
+	for _, rep := range strings.Split(s.Field(n), string(s.enc.repetition)) {
+		xtn := strings.Split(rep, string(s.enc.component))
+		component := func(c int) string {
+			if c > len(xtn) {
+				return ""
+			}
+			return s.unescape(xtn[c-1])
+		}
+		if component(2) == "NET" || component(3) == "Internet" || (component(1) == "" && component(4) != "") {
+			if email == "" {
+				email = component(4)
+			}
+			continue
+		}
+		if phone != "" {
+			continue
+		}
+		switch {
+		case component(12) != "":
+			phone = component(12)
+		case component(7) != "":
+			phone = component(6) + component(7)
+		default:
+			phone = component(1)
+		}
+	}
+	return phone, email
+}
@@ -0,0 +1,78 @@
+package hl7
+
+import (
+	"strings"
+	"time"
+)
+
+// Version is the HL7 version of the messages this package writes.
+const Version = "2.5"
+
+// timeLayout is how timestamps are written, always with their offset.
+const timeLayout = "20060102150405-0700"
+
+// Header is the MSH segment of a message being written.
+type Header struct {
+	SendingApplication   string
+	SendingFacility      string
+	ReceivingApplication string
+	ReceivingFacility    string
+	// Type is MSH-9 as written, such as "SIU^S12^SIU_S12".
+	Type      string
+	ControlID string
+	Time      time.Time
+}
+
+// Build writes a message with the standard delimiters. Each segment is its
+// name followed by its fields, which are written as given: values must be
+// escaped, and may be joined into components with Components.
+func Build(h Header, segments ...[]string) string {
+	msh := []string{"MSH", "^~\\&",
+		Escape(h.SendingApplication), Escape(h.SendingFacility),
+		Escape(h.ReceivingApplication), Escape(h.ReceivingFacility),
+		FormatTime(h.Time), "", h.Type, Escape(h.ControlID), "P", Version}
+
+	lines := []string{strings.Join(msh, "|")}
+	for _, seg := range segments {
+		lines = append(lines, strings.TrimRight(strings.Join(seg, "|"), "|"))
+	}
+	return strings.Join(lines, "\r") + "\r"
+}
+
+// Components escapes values and joins them into one field, dropping empty
+// trailing components.
+func Components(values ...string) string {
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = Escape(v)
+	}
+	return strings.Join(escaped, "^")
+}
+
+var escaper = strings.NewReplacer(
+	"\\", "\\E\\",
+	"|", "\\F\\",
+	"^", "\\S\\",
+	"~", "\\R\\",
+	"&", "\\T\\",
+	"\r\n", "\\.br\\",
+	"\n", "\\.br\\",
+	"\r", "\\.br\\",
+)
+
+// Escape escapes the standard delimiters and line breaks in v.
+func Escape(v string) string {
+	return escaper.Replace(v)
+}
+
+// FormatTime writes t as an HL7 timestamp with its offset. The zero time is
+// written as an empty value.
+func FormatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(timeLayout)
+}
@@ -0,0 +1,105 @@
+package hl7
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/wire"
+)
+
+var ProviderSet = wire.NewSet(NewDrop, NewNotifier)
+
+const (
+	processedDir = "processed"
+	failedDir    = "failed"
+)
+
+// Drop is a directory laboratories drop HL7 files into. A file is picked up
+// once it is in place; files still being written should carry a leading dot
+// or a .tmp or .part suffix until they are renamed into place. Picked up
+// files are moved to processed/, or to failed/ next to a .error file
+// explaining why.
+type Drop struct {
+	dir string
+	log *log.Helper
+}
+
+func NewDrop(c *conf.Clinical, logger log.Logger) (*Drop, error) {
+	d := &Drop{dir: c.GetLabDropDir(), log: log.NewHelper(logger)}
+	if d.dir == "" {
+		return d, nil
+	}
+	for _, sub := range []string{"", processedDir, failedDir} {
+		if err := os.MkdirAll(filepath.Join(d.dir, sub), 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create lab drop directory: %w", err)
+		}
+	}
+	d.log.Infof("watching lab drop directory %s", d.dir)
+	return d, nil
+}
+
+// Enabled reports whether a drop directory is configured.
+func (d *Drop) Enabled() bool {
+	return d.dir != ""
+}
+
+// Pending lists the files waiting to be picked up, oldest name first.
+func (d *Drop) Pending() ([]string, error) {
+	if !d.Enabled() {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lab drop directory: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || strings.HasPrefix(name, ".") ||
+			strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		files = append(files, filepath.Join(d.dir, name))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Read returns the content of a pending file.
+func (d *Drop) Read(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+	return string(b), nil
+}
+
+// Done moves a file to processed/.
+func (d *Drop) Done(path string) error {
+	return d.move(path, processedDir)
+}
+
+// Fail moves a file to failed/ and records cause next to it.
+func (d *Drop) Fail(path string, cause error) error {
+	if err := d.move(path, failedDir); err != nil {
+		return err
+	}
+	target := filepath.Join(d.dir, failedDir, filepath.Base(path)+".error")
+	if err := os.WriteFile(target, []byte(cause.Error()+"\n"), 0o640); err != nil {
+		return fmt.Errorf("failed to record lab drop failure: %w", err)
+	}
+	return nil
+}
+
+func (d *Drop) move(path, sub string) error {
+	target := filepath.Join(d.dir, sub, filepath.Base(path))
+	if err := os.Rename(path, target); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", filepath.Base(path), sub, err)
+	}
+	return nil
+}
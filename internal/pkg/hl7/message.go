@@ -0,0 +1,239 @@
+package hl7
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message is a parsed HL7 v2 message in ER7 (pipe and hat) encoding.
+type Message struct {
+	Segments []*Segment
+}
+
+// Segment is one segment of a message. Field n is the HL7 field SEG-n; for
+// MSH that makes MSH-1 the field separator and MSH-2 the encoding
+// characters, as in the standard.
+type Segment struct {
+	Name   string
+	fields []string
+	enc    *encoding
+}
+
+type encoding struct {
+	field, component, repetition, escape, subcomponent byte
+}
+
+// Parse reads a single message. Segments may end in CR, LF or CRLF.
+func Parse(raw string) (*Message, error) {
+	lines := splitSegments(raw)
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "MSH") || len(lines[0]) < 8 {
+		return nil, fmt.Errorf("message does not start with an MSH segment")
+	}
+
+	header := lines[0]
+	enc := &encoding{field: header[3], component: '^', repetition: '~', escape: '\\', subcomponent: '&'}
+	chars := header[4:]
+	if i := strings.IndexByte(chars, enc.field); i >= 0 {
+		chars = chars[:i]
+	}
+	for i, target := range []*byte{&enc.component, &enc.repetition, &enc.escape, &enc.subcomponent} {
+		if i < len(chars) {
+			*target = chars[i]
+		}
+	}
+
+	m := &Message{}
+	for _, line := range lines {
+		if len(line) < 3 {
+			return nil, fmt.Errorf("malformed segment %q", line)
+		}
+		seg := &Segment{Name: line[:3], enc: enc}
+		if seg.Name == "MSH" {
+			// MSH-1 is the separator itself, so it is not split out.
+			seg.fields = append([]string{"MSH", string(enc.field)}, strings.Split(line[4:], string(enc.field))...)
+		} else {
+			seg.fields = strings.Split(line, string(enc.field))
+		}
+		m.Segments = append(m.Segments, seg)
+	}
+	return m, nil
+}
+
+// Split breaks a file of one or more messages into single messages, each
+// starting at an MSH segment. Batch and file header segments are dropped.
+func Split(raw string) []string {
+	var messages []string
+	var current []string
+	for _, line := range splitSegments(raw) {
+		switch {
+		case strings.HasPrefix(line, "MSH"):
+			if len(current) > 0 {
+				messages = append(messages, strings.Join(current, "\r"))
+			}
+			current = []string{line}
+		case strings.HasPrefix(line, "FHS"), strings.HasPrefix(line, "BHS"),
+			strings.HasPrefix(line, "BTS"), strings.HasPrefix(line, "FTS"):
+		case len(current) > 0:
+			current = append(current, line)
+		}
+	}
+	if len(current) > 0 {
+		messages = append(messages, strings.Join(current, "\r"))
+	}
+	return messages
+}
+
+func splitSegments(raw string) []string {
+	raw = strings.ReplaceAll(raw, "\r\n", "\r")
+	raw = strings.ReplaceAll(raw, "\n", "\r")
+	var lines []string
+	for _, line := range strings.Split(raw, "\r") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Segment returns the first segment named name, or nil.
+func (m *Message) Segment(name string) *Segment {
+	for _, s := range m.Segments {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Type is the message type and trigger event from MSH-9, such as "ORU^R01".
+func (m *Message) Type() string {
+	msh := m.Segment("MSH")
+	return msh.Component(9, 1) + "^" + msh.Component(9, 2)
+}
+
+// ControlID is the sender's unique ID for the message, from MSH-10.
+func (m *Message) ControlID() string {
+	return m.Segment("MSH").Value(10)
+}
+
+// SendingFacility is the first component of MSH-4.
+func (m *Message) SendingFacility() string {
+	return m.Segment("MSH").Component(4, 1)
+}
+
+// Field returns field n as written, with repetitions and escapes intact.
+func (s *Segment) Field(n int) string {
+	if s == nil || n < 0 || n >= len(s.fields) {
+		return ""
+	}
+	return s.fields[n]
+}
+
+// Value returns the first repetition of field n, unescaped.
+func (s *Segment) Value(n int) string {
+	if s == nil {
+		return ""
+	}
+	return s.unescape(s.repetition(n))
+}
+
+// Component returns component c (counting from 1) of the first repetition
+// of field n, unescaped.
+func (s *Segment) Component(n, c int) string {
+	if s == nil {
+		return ""
+	}
+	components := strings.Split(s.repetition(n), string(s.enc.component))
+	if c < 1 || c > len(components) {
+		return ""
+	}
+	return s.unescape(components[c-1])
+}
+
+func (s *Segment) repetition(n int) string {
+	field := s.Field(n)
+	if s.Name == "MSH" && n <= 2 {
+		return field
+	}
+	if i := strings.IndexByte(field, s.enc.repetition); i >= 0 {
+		return field[:i]
+	}
+	return field
+}
+
+// unescape replaces the standard escape sequences for the delimiters and
+// line breaks. Other escape sequences are dropped.
+func (s *Segment) unescape(v string) string {
+	esc := s.enc.escape
+	if strings.IndexByte(v, esc) < 0 {
+		return v
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != esc {
+			b.WriteByte(v[i])
+			continue
+		}
+		end := strings.IndexByte(v[i+1:], esc)
+		if end < 0 {
+			b.WriteString(v[i:])
+			break
+		}
+		switch seq := v[i+1 : i+1+end]; seq {
+		case "F":
+			b.WriteByte(s.enc.field)
+		case "S":
+			b.WriteByte(s.enc.component)
+		case "R":
+			b.WriteByte(s.enc.repetition)
+		case "E":
+			b.WriteByte(s.enc.escape)
+		case "T":
+			b.WriteByte(s.enc.subcomponent)
+		case ".br":
+			b.WriteByte('\n')
+		}
+		i += end + 1
+	}
+	return b.String()
+}
+
+// ParseTime reads an HL7 timestamp, YYYY[MM[DD[HH[MM[SS[.S...]]]]]] with an
+// optional +/-ZZZZ offset. Timestamps without an offset are taken as UTC.
+func ParseTime(v string) (time.Time, error) {
+	t, err := ParseTimeIn(v, time.UTC)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// ParseTimeIn is ParseTime with timestamps without an offset taken as wall
+// clock time in loc. Timestamps with an offset keep it.
+func ParseTimeIn(v string, loc *time.Location) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, fmt.Errorf("empty timestamp")
+	}
+	zone := ""
+	if i := strings.IndexAny(v, "+-"); i >= 0 {
+		v, zone = v[:i], v[i:]
+	}
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		v = v[:i]
+	}
+	layouts := map[int]string{4: "2006", 6: "200601", 8: "20060102", 10: "2006010215", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(v)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("malformed timestamp %q", v+zone)
+	}
+	if zone != "" {
+		v, layout = v+zone, layout+"-0700"
+	}
+	t, err := time.ParseInLocation(layout, v, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed timestamp %q", v)
+	}
+	return t, nil
+}
@@ -0,0 +1,423 @@
+package hl7
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const adtMessage = "MSH|^~\\&|ADT|GENERAL|MEDICAL|CLINIC|20240310083000||ADT^A04^ADT_A01|MSG0001|P|2.5\r" +
+	"EVN|A04|20240310083000\r" +
+	"PID|1||12345^^^GENERAL^MR~67890^^^STATE^SS||O\\T\\Brien^Mary Ann\\S\\Jo||19800229|F|||1 Main St^Apt \\F\\2^Springfield^IL^62701^USA||^PRN^PH^^^217^5550100~^NET^Internet^mary@example.com\r"
+
+func TestParseSegmentTerminators(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "CR", raw: adtMessage},
+		{name: "CRLF", raw: strings.ReplaceAll(adtMessage, "\r", "\r\n")},
+		{name: "LF", raw: strings.ReplaceAll(adtMessage, "\r", "\n")},
+		{name: "no final terminator", raw: strings.TrimSuffix(adtMessage, "\r")},
+		{name: "blank lines", raw: strings.ReplaceAll(adtMessage, "\r", "\r\r\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			var names []string
+			for _, s := range m.Segments {
+				names = append(names, s.Name)
+			}
+			if got := strings.Join(names, ","); got != "MSH,EVN,PID" {
+				t.Errorf("segments = %s, want MSH,EVN,PID", got)
+			}
+			if got := m.Segment("PID").Component(11, 5); got != "62701" {
+				t.Errorf("last field of PID read as %q, want 62701", got)
+			}
+		})
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	m, err := Parse(adtMessage)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	msh := m.Segment("MSH")
+	if got := msh.Field(1); got != "|" {
+		t.Errorf("MSH-1 = %q, want |", got)
+	}
+	if got := msh.Field(2); got != "^~\\&" {
+		t.Errorf("MSH-2 = %q, want ^~\\&", got)
+	}
+	if got := m.Type(); got != "ADT^A04" {
+		t.Errorf("Type() = %q, want ADT^A04", got)
+	}
+	if got := m.ControlID(); got != "MSG0001" {
+		t.Errorf("ControlID() = %q, want MSG0001", got)
+	}
+	if got := m.SendingFacility(); got != "GENERAL" {
+		t.Errorf("SendingFacility() = %q, want GENERAL", got)
+	}
+}
+
+func TestParseRejectsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "empty", raw: ""},
+		{name: "only line breaks", raw: "\r\n\r"},
+		{name: "no MSH", raw: "PID|1||12345\r"},
+		{name: "short MSH", raw: "MSH|^~\r"},
+		{name: "short segment", raw: "MSH|^~\\&|A|B\rPI\r"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.raw); err == nil {
+				t.Errorf("Parse(%q) succeeded, want error", tt.raw)
+			}
+		})
+	}
+}
+
+func TestSegmentValues(t *testing.T) {
+	m, err := Parse("MSH|^~\\&|A|B|C|D|20240101||ADT^A08|1|P|2.5\r" +
+		"ZZZ|one~two|a^^c||^b|x\\E\\y\\.br\\z|\\X0D\\kept|open\\F|a^b~c^d\r")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	zzz := m.Segment("ZZZ")
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "repeated field as written", got: zzz.Field(1), want: "one~two"},
+		{name: "first repetition", got: zzz.Value(1), want: "one"},
+		{name: "component of first repetition", got: zzz.Component(8, 2), want: "b"},
+		{name: "empty middle component", got: zzz.Component(2, 2), want: ""},
+		{name: "component after empty one", got: zzz.Component(2, 3), want: "c"},
+		{name: "component past the last", got: zzz.Component(2, 4), want: ""},
+		{name: "component zero", got: zzz.Component(2, 0), want: ""},
+		{name: "empty field", got: zzz.Value(3), want: ""},
+		{name: "empty first component", got: zzz.Component(4, 1), want: ""},
+		{name: "second component", got: zzz.Component(4, 2), want: "b"},
+		{name: "escape and line break", got: zzz.Value(5), want: "x\\y\nz"},
+		{name: "unknown escape dropped", got: zzz.Value(6), want: "kept"},
+		{name: "unterminated escape kept", got: zzz.Value(7), want: "open\\F"},
+		{name: "field past the last", got: zzz.Value(20), want: ""},
+		{name: "negative field", got: zzz.Field(-1), want: ""},
+		{name: "missing segment", got: m.Segment("PV1").Component(3, 1), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+// Delimiters are whatever MSH-1 and MSH-2 declare, escapes included.
+func TestParseCustomDelimiters(t *testing.T) {
+	m, err := Parse("MSH#*@!$#A#B#C#D#20240101##ADT*A08#1#P#2.5\rPID#1##42*x*y*AUTH##Doe*Jane!T!Ann@Other\r")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := m.Type(); got != "ADT^A08" {
+		t.Errorf("Type() = %q, want ADT^A08", got)
+	}
+	pid := m.Segment("PID")
+	if got := pid.Component(3, 4); got != "AUTH" {
+		t.Errorf("PID-3.4 = %q, want AUTH", got)
+	}
+	if got := pid.Component(5, 2); got != "Jane$Ann" {
+		t.Errorf("PID-5.2 = %q, want Jane$Ann", got)
+	}
+}
+
+func TestParseADT(t *testing.T) {
+	m, err := Parse(adtMessage)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	adt, err := ParseADT(m)
+	if err != nil {
+		t.Fatalf("ParseADT: %v", err)
+	}
+
+	want := PatientIdentity{
+		ID:        "12345",
+		Authority: "GENERAL",
+		FirstName: "Mary Ann^Jo",
+		LastName:  "O&Brien",
+		BirthDate: "1980-02-29",
+		Sex:       "F",
+		Phone:     "2175550100",
+		Email:     "mary@example.com",
+		Street:    "1 Main St, Apt |2",
+		City:      "Springfield",
+		State:     "IL",
+		ZipCode:   "62701",
+		Country:   "USA",
+	}
+	if adt.Event != "A04" {
+		t.Errorf("Event = %q, want A04", adt.Event)
+	}
+	if *adt.Patient != want {
+		t.Errorf("Patient = %+v\nwant %+v", *adt.Patient, want)
+	}
+}
+
+func TestParseADTErrors(t *testing.T) {
+	header := "MSH|^~\\&|ADT|GENERAL|MEDICAL|CLINIC|20240310083000||ADT^A08|2|P|2.5\r"
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "wrong type", raw: strings.Replace(header, "ADT^A08", "SIU^S12", 1) + "PID|1||1\r"},
+		{name: "no PID", raw: header},
+		{name: "no identifier", raw: header + "PID|1||^^^GENERAL||Doe^John\r"},
+		{name: "bad birth date", raw: header + "PID|1||1||Doe^John||19801399\r"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if _, err := ParseADT(m); err == nil {
+				t.Errorf("ParseADT succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestParseSIU(t *testing.T) {
+	raw := "MSH|^~\\&|SCHED|GENERAL|MEDICAL|CLINIC|20240310083000||SIU^S12|MSG0002|P|2.5\r" +
+		"SCH|P-77|F-12||||ROUTINE^Routine visit|^Knee pain\\, left|VIDEO|1|H|^^^20240315093000-0400\r" +
+		"PID|1||12345^^^GENERAL||Doe^John\r" +
+		"RGS|1\r" +
+		"AIP|1||D-9^House^Gregory|||20240315100000\r"
+	m, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	siu, err := ParseSIU(m)
+	if err != nil {
+		t.Fatalf("ParseSIU: %v", err)
+	}
+
+	if siu.Event != EventBooked || siu.PlacerID != "P-77" || siu.FillerID != "F-12" {
+		t.Errorf("event and IDs = %s %s %s", siu.Event, siu.PlacerID, siu.FillerID)
+	}
+	if siu.Start != "20240315093000-0400" {
+		t.Errorf("Start = %q, want SCH-11.4", siu.Start)
+	}
+	if siu.Duration != time.Hour {
+		t.Errorf("Duration = %v, want 1h", siu.Duration)
+	}
+	if siu.Type != "VIDEO" || siu.Reason != "Knee pain\\, left" || siu.EventReason != "Routine visit" {
+		t.Errorf("type and reasons = %q %q %q", siu.Type, siu.Reason, siu.EventReason)
+	}
+	if siu.PersonnelID != "D-9" || siu.PersonnelName != "Gregory House" {
+		t.Errorf("personnel = %q %q", siu.PersonnelID, siu.PersonnelName)
+	}
+	if siu.Patient.ID != "12345" {
+		t.Errorf("patient = %q", siu.Patient.ID)
+	}
+}
+
+func TestParseSIUStartFallback(t *testing.T) {
+	raw := "MSH|^~\\&|SCHED|GENERAL|MEDICAL|CLINIC|20240310083000||SIU^S14|MSG0003|P|2.5\r" +
+		"SCH|P-77\r" +
+		"PID|1||12345\r" +
+		"AIP|1||D-9|||20240315100000\r"
+	m, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	siu, err := ParseSIU(m)
+	if err != nil {
+		t.Fatalf("ParseSIU: %v", err)
+	}
+	if siu.Start != "20240315100000" {
+		t.Errorf("Start = %q, want AIP-6", siu.Start)
+	}
+	if siu.Duration != 0 {
+		t.Errorf("Duration = %v, want 0", siu.Duration)
+	}
+
+	bad, err := Parse(strings.Replace(raw, "SCH|P-77", "SCH|P-77||||||||ten", 1))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, err := ParseSIU(bad); err == nil {
+		t.Errorf("ParseSIU with a malformed SCH-9 succeeded, want error")
+	}
+}
+
+// SIU messages this service writes read back as what was written.
+func TestSIURoundTrip(t *testing.T) {
+	want := &SIU{
+		Event:         EventRescheduled,
+		PlacerID:      "a|b",
+		FillerID:      "apt-1",
+		Start:         "20240315093000-0400",
+		Duration:      30 * time.Minute,
+		Type:          "OFFICE",
+		Reason:        "Follow-up ^ labs & x-ray\nfasting",
+		EventReason:   "Patient request",
+		Status:        "Booked",
+		Patient:       &PatientIdentity{ID: "p-1", Authority: Application, FirstName: "Jane", LastName: "Doe~Roe", Phone: "555", Email: "j@example.com"},
+		PersonnelID:   "d-1",
+		PersonnelName: "Gregory House",
+	}
+	raw := Build(Header{Type: "SIU^S13^SIU_S12", ControlID: "1", Time: time.Now()}, want.Segments()...)
+
+	m, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got, err := ParseSIU(m)
+	if err != nil {
+		t.Fatalf("ParseSIU: %v", err)
+	}
+	if got.PlacerID != want.PlacerID || got.Reason != want.Reason || got.EventReason != want.EventReason ||
+		got.Start != want.Start || got.Duration != want.Duration || got.Type != want.Type || got.Status != want.Status {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if got.Patient.LastName != "Doe~Roe" || got.Patient.Phone != "555" || got.Patient.Email != "j@example.com" {
+		t.Errorf("patient = %+v", got.Patient)
+	}
+	if got.PersonnelID != "d-1" {
+		t.Errorf("PersonnelID = %q", got.PersonnelID)
+	}
+}
+
+func TestParseORU(t *testing.T) {
+	raw := "MSH|^~\\&|LAB|CITYLAB|MEDICAL|CLINIC|20240310083000||ORU^R01|MSG0004|P|2.5\r" +
+		"PID|1||12345\r" +
+		"ORC|RE|ORD-1\r" +
+		"OBR|1||FIL-1|CBC^Blood count|||20240310070000\r" +
+		"OBX|1|NM|718-7^Hemoglobin^LN||13.2|g/dL|12.0-16.0|N|||F\r" +
+		"OBX|2|SN|777-3^Platelets^LN||<^5|10*3/uL||L|||F|||20240310071500\r" +
+		"OBX|3|CE|883-9^ABO group^LN||A^Group A||||||F\r"
+	m, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	oru, err := ParseORU(m)
+	if err != nil {
+		t.Fatalf("ParseORU: %v", err)
+	}
+
+	if oru.PatientID != "12345" || oru.SendingFacility != "CITYLAB" || len(oru.Orders) != 1 {
+		t.Fatalf("oru = %+v", oru)
+	}
+	order := oru.Orders[0]
+	if order.PlacerOrderNumber != "ORD-1" || order.FillerOrderNumber != "FIL-1" {
+		t.Errorf("order numbers = %q %q, want placer from ORC-2", order.PlacerOrderNumber, order.FillerOrderNumber)
+	}
+	observed := time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC)
+	if !order.ObservedAt.Equal(observed) {
+		t.Errorf("ObservedAt = %v, want %v", order.ObservedAt, observed)
+	}
+
+	wantValues := []string{"13.2", "<5", "Group A"}
+	if len(order.Observations) != len(wantValues) {
+		t.Fatalf("%d observations, want %d", len(order.Observations), len(wantValues))
+	}
+	for i, obs := range order.Observations {
+		if obs.Value != wantValues[i] {
+			t.Errorf("observation %d value = %q, want %q", i, obs.Value, wantValues[i])
+		}
+	}
+	if !order.Observations[0].ObservedAt.Equal(observed) {
+		t.Errorf("observation without OBX-14 at %v, want the order's time", order.Observations[0].ObservedAt)
+	}
+	if want := observed.Add(15 * time.Minute); !order.Observations[1].ObservedAt.Equal(want) {
+		t.Errorf("observation with OBX-14 at %v, want %v", order.Observations[1].ObservedAt, want)
+	}
+}
+
+func TestParseORUErrors(t *testing.T) {
+	header := "MSH|^~\\&|LAB|CITYLAB|MEDICAL|CLINIC|20240310083000||ORU^R01|MSG0005|P|2.5\r"
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{name: "no PID", raw: header + "OBR|1\r"},
+		{name: "no OBR", raw: header + "PID|1||1\r"},
+		{name: "OBX before OBR", raw: header + "PID|1||1\rOBX|1|NM|X||1\rOBR|1\r"},
+		{name: "bad OBR-7", raw: header + "PID|1||1\rOBR|1||||||2024-03-10\r"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.raw)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if _, err := ParseORU(m); err == nil {
+				t.Errorf("ParseORU succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	first := "MSH|^~\\&|A|B|C|D|1||ORU^R01|1|P|2.5\rPID|1||1"
+	second := "MSH|^~\\&|A|B|C|D|1||ORU^R01|2|P|2.5\rPID|1||2"
+	raw := "FHS|^~\\&\nBHS|^~\\&\n" + strings.ReplaceAll(first, "\r", "\n") + "\n" + strings.ReplaceAll(second, "\r", "\r\n") + "\r\nBTS|2\nFTS|1\n"
+
+	got := Split(raw)
+	if len(got) != 2 || got[0] != first || got[1] != second {
+		t.Errorf("Split = %q, want %q", got, []string{first, second})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "2024", want: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "20240310", want: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)},
+		{in: "202403100830", want: time.Date(2024, 3, 10, 8, 30, 0, 0, time.UTC)},
+		{in: "20240310083015.1234", want: time.Date(2024, 3, 10, 8, 30, 15, 0, time.UTC)},
+		{in: "20240310083015-0500", want: time.Date(2024, 3, 10, 13, 30, 15, 0, time.UTC)},
+		{in: "20240310083015+0100", want: time.Date(2024, 3, 10, 7, 30, 15, 0, time.UTC)},
+		{in: "", wantErr: true},
+		{in: "2024031", wantErr: true},
+		{in: "20241310", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseTime(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseTime(%q) = %v, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTime(%q): %v", tt.in, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseTime(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package hl7
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// MLLP frames each message between a start block and an end block followed
+// by a carriage return.
+const (
+	startBlock = 0x0b
+	endBlock   = 0x1c
+)
+
+// MaxFrameSize bounds a single framed message.
+const MaxFrameSize = 1 << 20
+
+// ReadFrame reads the next MLLP framed message from r. Bytes before the
+// start block are skipped. io.EOF is returned when r ends between frames.
+func ReadFrame(r *bufio.Reader) (string, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == startBlock {
+			break
+		}
+	}
+
+	var frame []byte
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return "", err
+		}
+		if b == endBlock {
+			if next, err := r.Peek(1); err == nil && next[0] == '\r' {
+				_, _ = r.ReadByte()
+			}
+			return string(frame), nil
+		}
+		if len(frame) >= MaxFrameSize {
+			return "", fmt.Errorf("frame exceeds %d bytes", MaxFrameSize)
+		}
+		frame = append(frame, b)
+	}
+}
+
+// WriteFrame writes msg to w as one MLLP frame.
+func WriteFrame(w io.Writer, msg string) error {
+	frame := make([]byte, 0, len(msg)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, msg...)
+	frame = append(frame, endBlock, '\r')
+	_, err := w.Write(frame)
+	return err
+}
+
+// Exchange sends msg to the MLLP listener at addr and returns the parsed
+// reply. The whole exchange is bounded by timeout.
+func Exchange(ctx context.Context, addr, msg string, timeout time.Duration) (*Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := WriteFrame(conn, msg); err != nil {
+		return nil, fmt.Errorf("failed to send message: %w", err)
+	}
+	raw, err := ReadFrame(bufio.NewReader(conn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reply: %w", err)
+	}
+	reply, err := Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reply: %w", err)
+	}
+	return reply, nil
+}
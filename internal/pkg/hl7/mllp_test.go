@@ -0,0 +1,121 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func frame(msg string) string {
+	return "\x0b" + msg + "\x1c\r"
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "one frame", input: frame("MSH|a"), want: []string{"MSH|a"}},
+		{name: "consecutive frames", input: frame("MSH|a") + frame("MSH|b"), want: []string{"MSH|a", "MSH|b"}},
+		{name: "noise before start block", input: "garbage\r\n" + frame("MSH|a"), want: []string{"MSH|a"}},
+		{name: "end block without CR", input: "\x0bMSH|a\x1c" + frame("MSH|b"), want: []string{"MSH|a", "MSH|b"}},
+		{name: "segments kept intact", input: frame("MSH|a\rPID|1\r"), want: []string{"MSH|a\rPID|1\r"}},
+		{name: "empty frame", input: "\x0b\x1c\r", want: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			for i, want := range tt.want {
+				got, err := ReadFrame(r)
+				if err != nil {
+					t.Fatalf("frame %d: %v", i, err)
+				}
+				if got != want {
+					t.Errorf("frame %d = %q, want %q", i, got, want)
+				}
+			}
+			if _, err := ReadFrame(r); err != io.EOF {
+				t.Errorf("after the last frame: err = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestReadFrameTruncated(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{name: "no input", input: "", want: io.EOF},
+		{name: "noise only", input: "MSH|a\r", want: io.EOF},
+		{name: "start block only", input: "\x0b", want: io.ErrUnexpectedEOF},
+		{name: "no end block", input: "\x0bMSH|a\rPID|1\r", want: io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadFrame(bufio.NewReader(strings.NewReader(tt.input)))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ReadFrame(%q) err = %v, want %v", tt.input, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadFrameSizeLimit(t *testing.T) {
+	atLimit := strings.Repeat("x", MaxFrameSize)
+	got, err := ReadFrame(bufio.NewReader(strings.NewReader(frame(atLimit))))
+	if err != nil {
+		t.Fatalf("frame of MaxFrameSize bytes: %v", err)
+	}
+	if len(got) != MaxFrameSize {
+		t.Errorf("frame of MaxFrameSize bytes read as %d bytes", len(got))
+	}
+
+	_, err = ReadFrame(bufio.NewReader(strings.NewReader(frame(atLimit + "x"))))
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("frame over MaxFrameSize: err = %v, want size error", err)
+	}
+
+	// An oversize frame without an end block fails on size, not by reading
+	// the stream to its end.
+	endless := io.MultiReader(strings.NewReader("\x0b"), neverEnding('x'))
+	_, err = ReadFrame(bufio.NewReader(endless))
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("unterminated oversize frame: err = %v, want size error", err)
+	}
+}
+
+type neverEnding byte
+
+func (b neverEnding) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(b)
+	}
+	return len(p), nil
+}
+
+func TestWriteFrameRoundTrip(t *testing.T) {
+	msg := "MSH|^~\\&|A|B|C|D|1||ACK|1|P|2.5\rMSA|AA|1\r"
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, msg); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if got := buf.String(); got != frame(msg) {
+		t.Errorf("WriteFrame wrote %q, want %q", got, frame(msg))
+	}
+
+	got, err := ReadFrame(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if got != msg {
+		t.Errorf("round trip = %q, want %q", got, msg)
+	}
+}
@@ -0,0 +1,141 @@
+package hl7
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/uuid"
+)
+
+// Application is the name the service gives itself in MSH-3 of the messages
+// it sends, and the assigning authority of the identifiers in them.
+const Application = "MEDICAL-SERVICE"
+
+const (
+	defaultNotifyTimeout = 30 * time.Second
+	notifyQueueSize      = 256
+	notifyAttempts       = 3
+	notifyRetryBackoff   = 2 * time.Second
+)
+
+// Notifier sends SIU notifications to a partner's MLLP listener. Messages
+// are queued and sent in order in the background, so a slow or unreachable
+// partner does not hold up the change being notified.
+type Notifier struct {
+	addr        string
+	application string
+	facility    string
+	receiver    string
+	receiverApp string
+	timeout     time.Duration
+	queue       chan *SIU
+	stop        chan struct{}
+	wg          sync.WaitGroup
+	log         *log.Helper
+}
+
+func NewNotifier(c *conf.Server, logger log.Logger) (*Notifier, func(), error) {
+	mllp := c.GetMllp()
+	n := &Notifier{
+		addr:        mllp.GetNotifyAddr(),
+		application: Application,
+		facility:    mllp.GetFacility(),
+		receiver:    mllp.GetNotifyFacility(),
+		receiverApp: mllp.GetNotifyApplication(),
+		timeout:     defaultNotifyTimeout,
+		queue:       make(chan *SIU, notifyQueueSize),
+		stop:        make(chan struct{}),
+		log:         log.NewHelper(logger),
+	}
+	if mllp.GetNotifyTimeout() != nil {
+		n.timeout = mllp.GetNotifyTimeout().AsDuration()
+	}
+	if !n.Enabled() {
+		return n, func() {}, nil
+	}
+
+	n.wg.Add(1)
+	go n.run()
+	n.log.Infof("sending SIU notifications to %s", n.addr)
+	cleanup := func() {
+		close(n.stop)
+		n.wg.Wait()
+	}
+	return n, cleanup, nil
+}
+
+// Enabled reports whether a partner to notify is configured.
+func (n *Notifier) Enabled() bool {
+	return n.addr != ""
+}
+
+// Notify queues s to be sent. It is dropped, with a warning, when the queue
+// is full.
+func (n *Notifier) Notify(s *SIU) {
+	if !n.Enabled() {
+		return
+	}
+	select {
+	case n.queue <- s:
+	case <-n.stop:
+	default:
+		n.log.Warnf("SIU notification queue is full, dropping %s for appointment %s", s.Event, s.FillerID)
+	}
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	for {
+		select {
+		case s := <-n.queue:
+			n.deliver(s)
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// deliver sends s, trying again a few times while the partner cannot be
+// reached or does not accept it.
+func (n *Notifier) deliver(s *SIU) {
+	msg := Build(Header{
+		SendingApplication:   n.application,
+		SendingFacility:      n.facility,
+		ReceivingApplication: n.receiverApp,
+		ReceivingFacility:    n.receiver,
+		Type:                 Components("SIU", s.Event, "SIU_"+s.Event),
+		ControlID:            uuid.New().String(),
+		Time:                 time.Now(),
+	}, s.Segments()...)
+
+	for attempt := 1; ; attempt++ {
+		err := n.send(msg)
+		if err == nil {
+			return
+		}
+		if attempt == notifyAttempts {
+			n.log.Errorf("failed to send %s for appointment %s: %v", s.Event, s.FillerID, err)
+			return
+		}
+		select {
+		case <-time.After(time.Duration(attempt) * notifyRetryBackoff):
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+func (n *Notifier) send(msg string) error {
+	reply, err := Exchange(context.Background(), n.addr, msg, n.timeout)
+	if err != nil {
+		return err
+	}
+	if code, text := reply.Ack(); code != AckAccept {
+		return fmt.Errorf("partner answered %s: %s", code, text)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package hl7
+
+import (
+	"fmt"
+	"time"
+)
+
+// ORU is the content of an ORU^R01 unsolicited observation result.
+type ORU struct {
+	ControlID       string
+	SendingFacility string
+	// PatientID is the first identifier in PID-3.
+	PatientID string
+	Orders    []*ORUOrder
+}
+
+// ORUOrder is an OBR segment and the OBX observations that follow it.
+type ORUOrder struct {
+	// PlacerOrderNumber is the orderer's ID for the order, from OBR-2 or
+	// else ORC-2.
+	PlacerOrderNumber string
+	FillerOrderNumber string
+	ObservedAt        time.Time
+	Observations      []*Observation
+}
+
+// Observation is one OBX segment.
+type Observation struct {
+	ValueType      string
+	Code           string
+	Name           string
+	CodeSystem     string
+	Value          string
+	Units          string
+	ReferenceRange string
+	AbnormalFlag   string
+	// Status is the OBX-11 result status code, such as F, P or C.
+	Status     string
+	ObservedAt time.Time
+}
+
+// ParseORU extracts the results of an ORU^R01 message. Observations without
+// their own time take the time of their order.
+func ParseORU(m *Message) (*ORU, error) {
+	if m.Segment("MSH").Component(9, 1) != "ORU" {
+		return nil, fmt.Errorf("message type %s is not ORU", m.Type())
+	}
+	pid := m.Segment("PID")
+	if pid == nil {
+		return nil, fmt.Errorf("message has no PID segment")
+	}
+
+	oru := &ORU{
+		ControlID:       m.ControlID(),
+		SendingFacility: m.SendingFacility(),
+		PatientID:       pid.Component(3, 1),
+	}
+	var order *ORUOrder
+	var orc *Segment
+	for _, seg := range m.Segments {
+		switch seg.Name {
+		case "ORC":
+			orc = seg
+		case "OBR":
+			order = &ORUOrder{
+				PlacerOrderNumber: seg.Component(2, 1),
+				FillerOrderNumber: seg.Component(3, 1),
+			}
+			if order.PlacerOrderNumber == "" {
+				order.PlacerOrderNumber = orc.Component(2, 1)
+			}
+			if v := seg.Value(7); v != "" {
+				t, err := ParseTime(v)
+				if err != nil {
+					return nil, fmt.Errorf("OBR-7: %w", err)
+				}
+				order.ObservedAt = t
+			}
+			oru.Orders = append(oru.Orders, order)
+		case "OBX":
+			if order == nil {
+				return nil, fmt.Errorf("OBX segment before any OBR segment")
+			}
+			obs := &Observation{
+				ValueType:      seg.Value(2),
+				Code:           seg.Component(3, 1),
+				Name:           seg.Component(3, 2),
+				CodeSystem:     seg.Component(3, 3),
+				Value:          observationValue(seg),
+				Units:          seg.Component(6, 1),
+				ReferenceRange: seg.Value(7),
+				AbnormalFlag:   seg.Value(8),
+				Status:         seg.Value(11),
+				ObservedAt:     order.ObservedAt,
+			}
+			if v := seg.Value(14); v != "" {
+				t, err := ParseTime(v)
+				if err != nil {
+					return nil, fmt.Errorf("OBX-14: %w", err)
+				}
+				obs.ObservedAt = t
+			}
+			order.Observations = append(order.Observations, obs)
+		}
+	}
+	if len(oru.Orders) == 0 {
+		return nil, fmt.Errorf("message has no OBR segment")
+	}
+	return oru, nil
+}
+
+// observationValue renders OBX-5 as text: coded values by their text and
+// structured numerics such as "<^5" or "^10^-^20" joined up.
+func observationValue(obx *Segment) string {
+	switch obx.Value(2) {
+	case "CE", "CWE", "CNE":
+		if text := obx.Component(5, 2); text != "" {
+			return text
+		}
+		return obx.Component(5, 1)
+	case "SN":
+		return obx.Component(5, 1) + obx.Component(5, 2) + obx.Component(5, 3) + obx.Component(5, 4)
+	}
+	return obx.Value(5)
+}
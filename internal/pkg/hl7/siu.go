@@ -0,0 +1,140 @@
+package hl7
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SIU trigger events.
+const (
+	EventBooked       = "S12"
+	EventRescheduled  = "S13"
+	EventModified     = "S14"
+	EventCancelled    = "S15"
+	EventDiscontinued = "S16"
+	EventDeleted      = "S17"
+)
+
+// SIU is the content of a scheduling information unsolicited message, read
+// from or written to SCH, PID and AIP segments.
+type SIU struct {
+	Event string
+	// PlacerID is the appointment ID of the system that booked it, from
+	// SCH-1; FillerID that of the system that fills it, from SCH-2.
+	PlacerID string
+	FillerID string
+	// Start is the appointment start timestamp as written, from SCH-11 or
+	// else AIS-4 or AIP-6. Read it with ParseTimeIn.
+	Start    string
+	Duration time.Duration
+	// Type is the SCH-8 appointment type code, such as NORMAL or VIDEO.
+	Type        string
+	Reason      string
+	EventReason string
+	// Status is the SCH-25 filler status code, such as Booked or Cancelled.
+	Status  string
+	Patient *PatientIdentity
+	// PersonnelID is the first AIP-3 identifier: the doctor seeing the
+	// patient.
+	PersonnelID   string
+	PersonnelName string
+}
+
+// ParseSIU extracts the appointment of an SIU message.
+func ParseSIU(m *Message) (*SIU, error) {
+	if m.Segment("MSH").Component(9, 1) != "SIU" {
+		return nil, fmt.Errorf("message type %s is not SIU", m.Type())
+	}
+	sch := m.Segment("SCH")
+	if sch == nil {
+		return nil, fmt.Errorf("message has no SCH segment")
+	}
+	patient, err := parsePID(m)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &SIU{
+		Event:       m.Segment("MSH").Component(9, 2),
+		PlacerID:    sch.Component(1, 1),
+		FillerID:    sch.Component(2, 1),
+		Start:       sch.Component(11, 4),
+		Type:        sch.Component(8, 1),
+		Reason:      text(sch, 7),
+		EventReason: text(sch, 6),
+		Status:      sch.Component(25, 1),
+		Patient:     patient,
+	}
+	if s.Start == "" {
+		s.Start = m.Segment("AIS").Value(4)
+	}
+	if aip := m.Segment("AIP"); aip != nil {
+		s.PersonnelID = aip.Component(3, 1)
+		s.PersonnelName = strings.TrimSpace(aip.Component(3, 3) + " " + aip.Component(3, 2))
+		if s.Start == "" {
+			s.Start = aip.Value(6)
+		}
+	}
+	if v := sch.Value(9); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("SCH-9: malformed duration %q", v)
+		}
+		unit := time.Minute
+		switch strings.ToUpper(sch.Component(10, 1)) {
+		case "S", "SEC":
+			unit = time.Second
+		case "H", "HR", "HOUR":
+			unit = time.Hour
+		}
+		s.Duration = time.Duration(n) * unit
+	}
+	return s, nil
+}
+
+// text is the text of a CE field: its second component, or else its code.
+func text(s *Segment, n int) string {
+	if v := s.Component(n, 2); v != "" {
+		return v
+	}
+	return s.Component(n, 1)
+}
+
+// Segments writes s as the SCH, PID, RGS and AIP segments of an SIU
+// message, to be passed to Build.
+func (s *SIU) Segments() [][]string {
+	minutes, units, tqDuration := "", "", ""
+	if s.Duration > 0 {
+		minutes = strconv.Itoa(int(s.Duration / time.Minute))
+		units, tqDuration = "MIN", "M"+minutes
+	}
+	sch := []string{"SCH",
+		Escape(s.PlacerID), Escape(s.FillerID), "", "", "",
+		Components("", s.EventReason), Components("", s.Reason), Escape(s.Type),
+		minutes, units, Components("", "", tqDuration, s.Start),
+		"", "", "", "", "", "", "", "", "", "", "", "", "", Escape(s.Status)}
+
+	p := s.Patient
+	if p == nil {
+		p = &PatientIdentity{}
+	}
+	birthDate := strings.ReplaceAll(p.BirthDate, "-", "")
+	var telecom []string
+	if p.Phone != "" {
+		telecom = append(telecom, Components(p.Phone, "PRN", "PH"))
+	}
+	if p.Email != "" {
+		telecom = append(telecom, Components("", "NET", "Internet", p.Email))
+	}
+	pid := []string{"PID", "1", "",
+		Components(p.ID, "", "", p.Authority), "",
+		Components(p.LastName, p.FirstName), "",
+		birthDate, Escape(p.Sex), "", "",
+		Components(p.Street, "", p.City, p.State, p.ZipCode, p.Country), "",
+		strings.Join(telecom, "~")}
+
+	aip := []string{"AIP", "1", "", Components(s.PersonnelID, s.PersonnelName), "", "", s.Start}
+	return [][]string{sch, pid, {"RGS", "1"}, aip}
+}
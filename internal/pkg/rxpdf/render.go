@@ -0,0 +1,179 @@
+package rxpdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/google/wire"
+	"github.com/jung-kurt/gofpdf"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var ProviderSet = wire.NewSet(NewRenderer)
+
+const defaultVerifyURL = "http://127.0.0.1:8000/v1/medical/prescription-verification"
+
+// Document is what is printed on a prescription.
+type Document struct {
+	PrescriptionID   string
+	IssuedOn         string
+	ValidUntil       string
+	RefillsAllowed   int32
+	Patient          Party
+	Doctor           Party
+	LicenseNumber    string
+	Items            []Item
+	Instructions     string
+	VerificationCode string
+	Fingerprint      string
+}
+
+// Party is the patient or the prescriber as printed.
+type Party struct {
+	Name        string
+	DateOfBirth string
+	PhoneNumber string
+	Email       string
+}
+
+type Item struct {
+	Name         string
+	DrugCode     string
+	Dose         string
+	Frequency    string
+	Duration     string
+	Route        string
+	Quantity     int32
+	Instructions string
+}
+
+// Renderer renders prescriptions to PDF in-process.
+type Renderer struct {
+	verifyURL string
+}
+
+func NewRenderer(c *conf.Clinical) *Renderer {
+	verifyURL := c.GetPrescriptionVerifyUrl()
+	if verifyURL == "" {
+		verifyURL = defaultVerifyURL
+	}
+	return &Renderer{
+		verifyURL: strings.TrimRight(verifyURL, "/"),
+	}
+}
+
+// VerifyURL is the public link a verification code resolves at. It is what
+// the QR code on the printed prescription encodes.
+func (r *Renderer) VerifyURL(code string) string {
+	return r.verifyURL + "/" + code
+}
+
+// Render lays the prescription out on a single A4 page (continuing onto more
+// when there are many items) with a QR code linking to its verification page.
+func (r *Renderer) Render(doc *Document) ([]byte, error) {
+	qr, err := qrcode.Encode(r.VerifyURL(doc.VerificationCode), qrcode.Medium, 256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode verification QR code: %w", err)
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Prescription "+doc.PrescriptionID, true)
+	pdf.SetCreator("medical-service", true)
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 20)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-15)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 5, tr(fmt.Sprintf("Prescription %s  |  Fingerprint %s  |  Page %d", doc.PrescriptionID, doc.Fingerprint, pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.RegisterImageOptionsReader("verification-qr", gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(qr))
+	pdf.ImageOptions("verification-qr", 160, 12, 35, 35, false, gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(140, 10, "Prescription", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(140, 5, tr("No. "+doc.PrescriptionID), "", 1, "L", false, 0, "")
+	pdf.CellFormat(140, 5, tr(fmt.Sprintf("Issued %s, valid until %s", doc.IssuedOn, doc.ValidUntil)), "", 1, "L", false, 0, "")
+	if doc.RefillsAllowed > 0 {
+		pdf.CellFormat(140, 5, fmt.Sprintf("Refills allowed: %d", doc.RefillsAllowed), "", 1, "L", false, 0, "")
+	}
+	pdf.SetY(50)
+
+	section := func(title string) {
+		pdf.Ln(2)
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.CellFormat(0, 7, title, "B", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+	}
+	line := func(label, value string) {
+		if value == "" {
+			return
+		}
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(35, 6, label, "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.MultiCell(0, 6, tr(value), "", "L", false)
+	}
+
+	section("Prescriber")
+	line("Name", doc.Doctor.Name)
+	line("License no.", doc.LicenseNumber)
+	line("Phone", doc.Doctor.PhoneNumber)
+	line("Email", doc.Doctor.Email)
+
+	section("Patient")
+	line("Name", doc.Patient.Name)
+	line("Date of birth", doc.Patient.DateOfBirth)
+	line("Phone", doc.Patient.PhoneNumber)
+
+	section("Medications")
+	for i, item := range doc.Items {
+		pdf.SetFont("Helvetica", "B", 10)
+		title := fmt.Sprintf("%d. %s", i+1, item.Name)
+		if item.DrugCode != "" {
+			title += " [" + item.DrugCode + "]"
+		}
+		pdf.MultiCell(0, 6, tr(title), "", "L", false)
+		pdf.SetFont("Helvetica", "", 10)
+
+		var parts []string
+		for _, p := range []string{item.Dose, item.Route, item.Frequency, item.Duration} {
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+		parts = append(parts, fmt.Sprintf("quantity %d", item.Quantity))
+		pdf.SetX(20)
+		pdf.MultiCell(0, 5, tr(strings.Join(parts, ", ")), "", "L", false)
+		if item.Instructions != "" {
+			pdf.SetX(20)
+			pdf.MultiCell(0, 5, tr(item.Instructions), "", "L", false)
+		}
+		pdf.Ln(1)
+	}
+
+	if doc.Instructions != "" {
+		section("Instructions")
+		pdf.MultiCell(0, 5, tr(doc.Instructions), "", "L", false)
+	}
+
+	section("Verification")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.MultiCell(0, 5, tr(fmt.Sprintf(
+		"Issued electronically by %s (license %s). Scan the QR code or open %s to confirm this prescription is authentic and still active; the fingerprint shown there must match %s.",
+		doc.Doctor.Name, doc.LicenseNumber, r.VerifyURL(doc.VerificationCode), doc.Fingerprint)), "", "L", false)
+
+	if err := pdf.Error(); err != nil {
+		return nil, fmt.Errorf("failed to render prescription: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to write prescription PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
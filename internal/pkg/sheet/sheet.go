@@ -0,0 +1,106 @@
+package sheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strings"
+)
+
+// MaxSize bounds the size of a spreadsheet file.
+const MaxSize = 32 << 20
+
+// Table is a spreadsheet read as a header row and the data rows below it.
+// Header names are lower-cased and trimmed; cells are trimmed.
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// Read reads CSV or XLSX data, telling them apart by content. Of an XLSX
+// workbook only the first worksheet is read. Blank rows are skipped.
+func Read(data []byte) (*Table, error) {
+	var rows [][]string
+	var err error
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		rows, err = readXLSX(data)
+	} else {
+		rows, err = readCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Table{}
+	for _, row := range rows {
+		blank := true
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+			blank = blank && row[i] == ""
+		}
+		if blank {
+			continue
+		}
+		if t.Header == nil {
+			for _, name := range row {
+				t.Header = append(t.Header, strings.ToLower(name))
+			}
+			continue
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	if t.Header == nil {
+		return nil, fmt.Errorf("file has no header row")
+	}
+	return t, nil
+}
+
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	return rows, nil
+}
+
+// Column returns the index of the named column, or -1.
+func (t *Table) Column(name string) int {
+	for i, h := range t.Header {
+		if h == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Row is one data row of a table, read by column name.
+type Row struct {
+	// Line is the row's position in the file, counting the header as 1
+	// and leaving out blank rows.
+	Line  int
+	table *Table
+	cells []string
+}
+
+// Each returns the data rows in order.
+func (t *Table) Each() []Row {
+	rows := make([]Row, len(t.Rows))
+	for i, cells := range t.Rows {
+		rows[i] = Row{Line: i + 2, table: t, cells: cells}
+	}
+	return rows
+}
+
+// Get returns the cell in the named column, or "" when the table has no
+// such column or the row is short.
+func (r Row) Get(name string) string {
+	i := r.table.Column(name)
+	if i < 0 || i >= len(r.cells) {
+		return ""
+	}
+	return r.cells[i]
+}
@@ -0,0 +1,285 @@
+package sheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Style  int      `xml:"s,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// cellFormat is how a numeric cell is shown: as a number, a date, a time of
+// day or both.
+type cellFormat int
+
+const (
+	formatNumber cellFormat = iota
+	formatDate
+	formatClock
+	formatDateTime
+)
+
+// excelEpoch is day zero of the 1900 date system, taking its phantom
+// 29 February 1900 into account for the dates after it.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// readXLSX reads the cells of the first worksheet. Numeric cells formatted
+// as dates or times are written as YYYY-MM-DD and HH:MM.
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var workbook xlsxWorkbook
+	var rels xlsxRelationships
+	if err := decodeXLSXPart(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if err := decodeXLSXPart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("invalid XLSX: workbook has no worksheets")
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].ID {
+			sheetPath = rel.Target
+		}
+	}
+	if strings.HasPrefix(sheetPath, "/") {
+		sheetPath = strings.TrimPrefix(sheetPath, "/")
+	} else {
+		sheetPath = path.Join("xl", sheetPath)
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXLSXPart(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+	var formats []cellFormat
+	if _, ok := files["xl/styles.xml"]; ok {
+		var styles xlsxStyles
+		if err := decodeXLSXPart(files, "xl/styles.xml", &styles); err != nil {
+			return nil, err
+		}
+		formats = styleFormats(&styles)
+	}
+
+	var sheet xlsxWorksheet
+	if err := decodeXLSXPart(files, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, r := range sheet.Rows {
+		var row []string
+		for i, c := range r.Cells {
+			col := i
+			if c.Ref != "" {
+				if col, err = columnIndex(c.Ref); err != nil {
+					return nil, err
+				}
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(shared.Items) {
+					return nil, fmt.Errorf("invalid XLSX: cell %s refers to a missing shared string", c.Ref)
+				}
+				row[col] = shared.Items[n].String()
+			case "inlineStr":
+				row[col] = c.Inline.String()
+			case "b":
+				row[col] = map[string]string{"1": "true", "0": "false"}[c.Value]
+			case "", "n":
+				format := formatNumber
+				if c.Style >= 0 && c.Style < len(formats) {
+					format = formats[c.Style]
+				}
+				row[col] = numericCell(c.Value, format)
+			default:
+				row[col] = c.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func decodeXLSXPart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("invalid XLSX: missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("invalid XLSX: %w", err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, MaxSize)).Decode(v); err != nil {
+		return fmt.Errorf("invalid XLSX: %s: %w", name, err)
+	}
+	return nil
+}
+
+// columnIndex turns the letters of a cell reference such as "AB12" into a
+// zero-based column.
+func columnIndex(ref string) (int, error) {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	if col == 0 {
+		return 0, fmt.Errorf("invalid XLSX: malformed cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+// styleFormats tells, for each cell style, whether numbers in it are dates
+// or times, from the built-in format IDs and the codes of custom formats.
+func styleFormats(styles *xlsxStyles) []cellFormat {
+	custom := make(map[int]string, len(styles.NumFmts))
+	for _, f := range styles.NumFmts {
+		custom[f.ID] = f.Code
+	}
+	formats := make([]cellFormat, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		switch id := xf.NumFmtID; {
+		case id >= 14 && id <= 17:
+			formats[i] = formatDate
+		case id >= 18 && id <= 21, id >= 45 && id <= 47:
+			formats[i] = formatClock
+		case id == 22:
+			formats[i] = formatDateTime
+		default:
+			formats[i] = customFormat(custom[id])
+		}
+	}
+	return formats
+}
+
+func customFormat(code string) cellFormat {
+	// Quoted literals and bracketed colors or locales are not format
+	// characters.
+	var b strings.Builder
+	quoted, bracketed := false, false
+	for _, ch := range strings.ToLower(code) {
+		switch {
+		case ch == '"':
+			quoted = !quoted
+		case quoted:
+		case ch == '[':
+			bracketed = true
+		case ch == ']':
+			bracketed = false
+		case !bracketed:
+			b.WriteRune(ch)
+		}
+	}
+	code = b.String()
+	date := strings.ContainsAny(code, "yd")
+	clock := strings.ContainsAny(code, "hs")
+	switch {
+	case date && clock:
+		return formatDateTime
+	case date:
+		return formatDate
+	case clock:
+		return formatClock
+	}
+	return formatNumber
+}
+
+func numericCell(v string, format cellFormat) string {
+	if format == formatNumber || v == "" {
+		return v
+	}
+	serial, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	t := excelEpoch.Add(time.Duration(serial*24*float64(time.Hour) + 0.5*float64(time.Second))).Truncate(time.Second)
+	switch format {
+	case formatDate:
+		return t.Format("2006-01-02")
+	case formatClock:
+		return t.Format("15:04")
+	}
+	return t.Format("2006-01-02 15:04")
+}
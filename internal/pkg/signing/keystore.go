@@ -0,0 +1,196 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/wire"
+)
+
+var ProviderSet = wire.NewSet(NewKeystore)
+
+// Algorithm is the only signature algorithm keys are issued for.
+const Algorithm = "Ed25519"
+
+const defaultKeyDir = "keys/signing"
+
+var (
+	// ErrNoKey is returned when verifying for a signer that has no key in
+	// the keystore.
+	ErrNoKey = errors.New("signer has no signing key")
+	// ErrKeyMismatch is returned when a signature names a key other than the
+	// signer's current one.
+	ErrKeyMismatch = errors.New("signature was made with a different key")
+	// ErrBadSignature is returned when the signature does not match the
+	// content.
+	ErrBadSignature = errors.New("signature does not match content")
+)
+
+var signerIDRe = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// Signature is a detached signature over some content.
+type Signature struct {
+	Algorithm string
+	KeyID     string
+	Value     string
+}
+
+// Keystore holds one Ed25519 key per signer as a PEM file in a local
+// directory. A signer's key is generated the first time they sign.
+type Keystore struct {
+	dir  string
+	mu   sync.Mutex
+	keys map[string]ed25519.PrivateKey
+	log  *log.Helper
+}
+
+func NewKeystore(c *conf.Clinical, logger log.Logger) (*Keystore, error) {
+	dir := c.GetSigningKeyDir()
+	if dir == "" {
+		dir = defaultKeyDir
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create signing key directory: %w", err)
+	}
+	return &Keystore{
+		dir:  dir,
+		keys: make(map[string]ed25519.PrivateKey),
+		log:  log.NewHelper(logger),
+	}, nil
+}
+
+// Sign signs content with the signer's key, creating the key if the signer
+// has none yet.
+func (k *Keystore) Sign(signerID string, content []byte) (*Signature, error) {
+	key, err := k.key(signerID, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		Algorithm: Algorithm,
+		KeyID:     keyID(key.Public().(ed25519.PublicKey)),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, content)),
+	}, nil
+}
+
+// Verify checks that sig is the signer's signature over content.
+func (k *Keystore) Verify(signerID string, content []byte, sig *Signature) error {
+	if sig.Algorithm != Algorithm {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	key, err := k.key(signerID, false)
+	if err != nil {
+		return err
+	}
+	public := key.Public().(ed25519.PublicKey)
+	if sig.KeyID != keyID(public) {
+		return ErrKeyMismatch
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil || !ed25519.Verify(public, content, value) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func (k *Keystore) key(signerID string, create bool) (ed25519.PrivateKey, error) {
+	if !signerIDRe.MatchString(signerID) {
+		return nil, fmt.Errorf("invalid signer ID %q", signerID)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key, ok := k.keys[signerID]; ok {
+		return key, nil
+	}
+
+	path := filepath.Join(k.dir, signerID+".pem")
+	key, err := readKey(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if !create {
+			return nil, ErrNoKey
+		}
+		key, err = writeKey(path)
+		if errors.Is(err, os.ErrExist) {
+			// Another process created the key first.
+			key, err = readKey(path)
+		} else if err == nil {
+			k.log.Infof("generated signing key %s for %s", keyID(key.Public().(ed25519.PublicKey)), signerID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	k.keys[signerID] = key
+	return key, nil
+}
+
+func readKey(path string) (ed25519.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("signing key %s is not a PEM private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an %s key", path, Algorithm)
+	}
+	return key, nil
+}
+
+func writeKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	// Write the key aside and link it into place so that a concurrent
+	// reader never sees a partly written file.
+	f, err := os.CreateTemp(filepath.Dir(path), ".key-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	if err := os.Link(f.Name(), path); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// keyID identifies a public key by the start of its SHA-256 digest.
+func keyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
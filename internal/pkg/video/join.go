@@ -0,0 +1,102 @@
+package video
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+)
+
+// placeholderSecret is the value shipped in the sample configuration.
+const placeholderSecret = "change-me"
+
+// checkSecret rejects a missing secret, or one left at the sample value.
+func checkSecret(secret string) error {
+	if secret == "" || secret == placeholderSecret {
+		return fmt.Errorf("video.secret is not set, set it through MEDICAL_VIDEO_SECRET")
+	}
+	return nil
+}
+
+// JoinKeys issues and checks the per-participant keys that let the patient
+// and doctor of a video appointment join it. A key is bound to one
+// appointment, participant and role, and is signed with the video secret, so
+// knowing a participant's ID is not enough to join in their place. Keys
+// carry their expiry in the signed claims.
+//
+// Keys are re-issued to trusted clients presenting the reissue token, for
+// participants who lost theirs; without one configured, re-issue is off.
+type JoinKeys struct {
+	secret       []byte
+	reissueToken []byte
+}
+
+func NewJoinKeys(c *conf.Video) (*JoinKeys, error) {
+	if err := checkSecret(c.GetSecret()); err != nil {
+		return nil, err
+	}
+	return &JoinKeys{secret: []byte(c.GetSecret()), reissueToken: []byte(c.GetReissueToken())}, nil
+}
+
+// Issue returns the participant's key for the appointment, valid until
+// expiresAt.
+func (k *JoinKeys) Issue(appointmentID, participantID string, role Role, expiresAt time.Time) string {
+	claims := participantID + "|" + string(role) + "|" + strconv.FormatInt(expiresAt.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(claims)) + "." + base64.RawURLEncoding.EncodeToString(k.sign(appointmentID, claims))
+}
+
+// AuthorizeReissue checks the token a client presents to have keys re-issued.
+func (k *JoinKeys) AuthorizeReissue(token string) error {
+	if len(k.reissueToken) == 0 {
+		return fmt.Errorf("join key re-issue is not enabled")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), k.reissueToken) != 1 {
+		return fmt.Errorf("invalid reissue token")
+	}
+	return nil
+}
+
+// Verify checks a key for the appointment at now and returns the participant
+// it was issued to.
+func (k *JoinKeys) Verify(appointmentID, key string, now time.Time) (*Participant, error) {
+	encoded, signature, ok := strings.Cut(key, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed join key")
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed join key")
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("malformed join key")
+	}
+	if !hmac.Equal(mac, k.sign(appointmentID, string(claims))) {
+		return nil, fmt.Errorf("invalid join key")
+	}
+
+	parts := strings.Split(string(claims), "|")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed join key")
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed join key")
+	}
+	if !now.Before(time.Unix(expiresAt, 0)) {
+		return nil, fmt.Errorf("join key expired")
+	}
+	return &Participant{ID: parts[0], Role: Role(parts[1])}, nil
+}
+
+func (k *JoinKeys) sign(appointmentID, claims string) []byte {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(appointmentID + "|" + claims))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,72 @@
+package video
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/google/wire"
+)
+
+var ProviderSet = wire.NewSet(NewProvider, NewJoinKeys)
+
+type Role string
+
+const (
+	RolePatient Role = "patient"
+	RoleDoctor  Role = "doctor"
+)
+
+type SessionRequest struct {
+	AppointmentID string
+	Title         string
+	StartsAt      time.Time
+	EndsAt        time.Time
+}
+
+type Session struct {
+	ID      string
+	JoinURL string
+}
+
+type Participant struct {
+	ID   string
+	Name string
+	Role Role
+}
+
+type Token struct {
+	Value     string
+	JoinURL   string
+	ExpiresAt time.Time
+}
+
+// Provider provisions video consultation sessions with a conferencing
+// backend.
+type Provider interface {
+	Name() string
+	CreateSession(ctx context.Context, req *SessionRequest) (*Session, error)
+	EndSession(ctx context.Context, sessionID string) error
+	IssueToken(ctx context.Context, sessionID string, participant *Participant) (*Token, error)
+}
+
+const defaultTokenTTL = 2 * time.Hour
+
+func NewProvider(c *conf.Video, logger log.Logger) (Provider, error) {
+	if err := checkSecret(c.GetSecret()); err != nil {
+		return nil, err
+	}
+	ttl := defaultTokenTTL
+	if c.GetTokenTtl() != nil {
+		ttl = c.GetTokenTtl().AsDuration()
+	}
+
+	switch c.GetProvider() {
+	case "", "stub":
+		return NewStubProvider(c.GetBaseUrl(), c.GetSecret(), ttl, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown video provider %q", c.GetProvider())
+	}
+}
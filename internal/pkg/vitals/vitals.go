@@ -0,0 +1,275 @@
+package vitals
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/google/wire"
+)
+
+var ProviderSet = wire.NewSet(NewRanges)
+
+// Vital sign codes.
+const (
+	Temperature      = "temperature"
+	BPSystolic       = "bp_systolic"
+	BPDiastolic      = "bp_diastolic"
+	HeartRate        = "heart_rate"
+	RespiratoryRate  = "respiratory_rate"
+	OxygenSaturation = "oxygen_saturation"
+	Weight           = "weight"
+	Height           = "height"
+	BMI              = "bmi"
+)
+
+// Flags for values outside their reference range.
+const (
+	FlagLow          = "low"
+	FlagHigh         = "high"
+	FlagCriticalLow  = "critical_low"
+	FlagCriticalHigh = "critical_high"
+)
+
+// Sign describes a vital sign: the unit values are stored in, the other
+// units it may be written in, and the range a measured value must fall in to
+// be plausible at all.
+type Sign struct {
+	Code    string
+	Unit    string
+	Min     float64
+	Max     float64
+	convert map[string]func(float64) float64
+}
+
+// Signs lists the vital signs in display order. BMI is derived from weight
+// and height and cannot be recorded directly.
+var Signs = []*Sign{
+	{Code: Temperature, Unit: "Cel", Min: 25, Max: 45, convert: map[string]func(float64) float64{
+		"c": same, "°c": same, "cel": same, "celsius": same,
+		"f": fromFahrenheit, "°f": fromFahrenheit, "[degf]": fromFahrenheit, "fahrenheit": fromFahrenheit,
+	}},
+	{Code: BPSystolic, Unit: "mm[Hg]", Min: 40, Max: 300, convert: map[string]func(float64) float64{"mmhg": same, "mm[hg]": same}},
+	{Code: BPDiastolic, Unit: "mm[Hg]", Min: 20, Max: 200, convert: map[string]func(float64) float64{"mmhg": same, "mm[hg]": same}},
+	{Code: HeartRate, Unit: "/min", Min: 20, Max: 300, convert: map[string]func(float64) float64{"/min": same, "bpm": same}},
+	{Code: RespiratoryRate, Unit: "/min", Min: 2, Max: 80, convert: map[string]func(float64) float64{"/min": same, "breaths/min": same}},
+	{Code: OxygenSaturation, Unit: "%", Min: 50, Max: 100, convert: map[string]func(float64) float64{"%": same}},
+	{Code: Weight, Unit: "kg", Min: 0.3, Max: 500, convert: map[string]func(float64) float64{
+		"kg": same, "g": func(v float64) float64 { return v / 1000 },
+		"lb": fromPounds, "lbs": fromPounds, "[lb_av]": fromPounds,
+	}},
+	{Code: Height, Unit: "cm", Min: 20, Max: 272, convert: map[string]func(float64) float64{
+		"cm": same, "m": func(v float64) float64 { return v * 100 },
+		"in": fromInches, "[in_i]": fromInches,
+	}},
+	{Code: BMI, Unit: "kg/m2", Min: 5, Max: 150},
+}
+
+var signs = func() map[string]*Sign {
+	m := make(map[string]*Sign, len(Signs))
+	for _, s := range Signs {
+		m[s.Code] = s
+	}
+	return m
+}()
+
+// Lookup returns the vital sign with the given code, or nil.
+func Lookup(code string) *Sign {
+	return signs[code]
+}
+
+// Normalize converts a value written in unit to the sign's unit and checks
+// that it is plausible. An empty unit means the sign's own unit.
+func (s *Sign) Normalize(value float64, unit string) (float64, error) {
+	if s.Code == BMI {
+		return 0, fmt.Errorf("bmi is derived from weight and height and cannot be recorded")
+	}
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	if unit != "" && unit != strings.ToLower(s.Unit) {
+		convert, ok := s.convert[unit]
+		if !ok {
+			return 0, fmt.Errorf("%s cannot be recorded in %q", s.Code, unit)
+		}
+		value = convert(value)
+	}
+	value = round(value)
+	if value < s.Min || value > s.Max {
+		return 0, fmt.Errorf("%s of %g %s is outside the plausible range %g-%g", s.Code, value, s.Unit, s.Min, s.Max)
+	}
+	return value, nil
+}
+
+// DeriveBMI computes the body mass index from a weight in kg and a height in
+// cm.
+func DeriveBMI(weight, height float64) float64 {
+	m := height / 100
+	return round(weight / (m * m))
+}
+
+// ParseBloodPressure reads a blood pressure written as "120/80".
+func ParseBloodPressure(s string) (systolic, diastolic float64, err error) {
+	parts := strings.Split(strings.TrimSpace(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "mmhg")), "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("blood pressure %q is not systolic/diastolic", s)
+	}
+	systolic, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("blood pressure %q is not systolic/diastolic", s)
+	}
+	diastolic, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("blood pressure %q is not systolic/diastolic", s)
+	}
+	return systolic, diastolic, nil
+}
+
+// Observation is a vital sign value in the sign's unit.
+type Observation struct {
+	Code  string
+	Value float64
+}
+
+// RecordVitals are the vital signs as a medical record holds them: a
+// temperature in °C (or °F when above 45), blood pressure as "120/80",
+// weight in kg and height in cm (or m when below 3).
+type RecordVitals struct {
+	Temperature      float64
+	BloodPressure    string
+	HeartRate        int32
+	RespiratoryRate  int32
+	OxygenSaturation int32
+	Weight           float64
+	Height           float64
+}
+
+// FromRecord turns a medical record's vital signs into observations, with a
+// BMI when both weight and height are given. Values that are missing or
+// implausible are skipped.
+func FromRecord(v RecordVitals) []Observation {
+	var obs []Observation
+	add := func(code string, value float64, unit string) {
+		if value == 0 {
+			return
+		}
+		if normalized, err := Lookup(code).Normalize(value, unit); err == nil {
+			obs = append(obs, Observation{Code: code, Value: normalized})
+		}
+	}
+
+	tempUnit := "Cel"
+	if v.Temperature > 45 {
+		tempUnit = "f"
+	}
+	add(Temperature, v.Temperature, tempUnit)
+	if v.BloodPressure != "" {
+		if systolic, diastolic, err := ParseBloodPressure(v.BloodPressure); err == nil {
+			add(BPSystolic, systolic, "")
+			add(BPDiastolic, diastolic, "")
+		}
+	}
+	add(HeartRate, float64(v.HeartRate), "")
+	add(RespiratoryRate, float64(v.RespiratoryRate), "")
+	add(OxygenSaturation, float64(v.OxygenSaturation), "")
+	add(Weight, v.Weight, "")
+	heightUnit := "cm"
+	if v.Height > 0 && v.Height < 3 {
+		heightUnit = "m"
+	}
+	add(Height, v.Height, heightUnit)
+
+	var weight, height float64
+	for _, o := range obs {
+		switch o.Code {
+		case Weight:
+			weight = o.Value
+		case Height:
+			height = o.Value
+		}
+	}
+	if weight > 0 && height > 0 {
+		obs = append(obs, Observation{Code: BMI, Value: DeriveBMI(weight, height)})
+	}
+	return obs
+}
+
+// Range is the reference range of a vital sign. A zero bound is not checked.
+type Range struct {
+	Low          float64
+	High         float64
+	CriticalLow  float64
+	CriticalHigh float64
+}
+
+// defaultRanges are adult reference ranges.
+var defaultRanges = map[string]Range{
+	Temperature:      {Low: 36.1, High: 37.8, CriticalLow: 35, CriticalHigh: 40},
+	BPSystolic:       {Low: 90, High: 140, CriticalLow: 70, CriticalHigh: 180},
+	BPDiastolic:      {Low: 60, High: 90, CriticalLow: 40, CriticalHigh: 120},
+	HeartRate:        {Low: 60, High: 100, CriticalLow: 40, CriticalHigh: 130},
+	RespiratoryRate:  {Low: 12, High: 20, CriticalLow: 8, CriticalHigh: 30},
+	OxygenSaturation: {Low: 95, CriticalLow: 90},
+	BMI:              {Low: 18.5, High: 25, CriticalLow: 16, CriticalHigh: 40},
+}
+
+// Ranges holds the reference ranges values are flagged against: the
+// built-in ones, with any given in the clinical config in their place.
+type Ranges struct {
+	ranges map[string]Range
+}
+
+func NewRanges(c *conf.Clinical) (*Ranges, error) {
+	ranges := make(map[string]Range, len(defaultRanges))
+	for code, r := range defaultRanges {
+		ranges[code] = r
+	}
+	for code, r := range c.GetVitalRanges() {
+		if Lookup(code) == nil {
+			return nil, fmt.Errorf("vital range for unknown vital sign %q", code)
+		}
+		ranges[code] = Range{
+			Low:          r.GetLow(),
+			High:         r.GetHigh(),
+			CriticalLow:  r.GetCriticalLow(),
+			CriticalHigh: r.GetCriticalHigh(),
+		}
+	}
+	return &Ranges{ranges: ranges}, nil
+}
+
+// Get returns the reference range of a vital sign.
+func (r *Ranges) Get(code string) (Range, bool) {
+	rng, ok := r.ranges[code]
+	return rng, ok
+}
+
+// Flag classifies a value against its sign's reference range, returning ""
+// for a normal value.
+func (r *Ranges) Flag(code string, value float64) string {
+	rng, ok := r.ranges[code]
+	if !ok {
+		return ""
+	}
+	switch {
+	case rng.CriticalLow != 0 && value < rng.CriticalLow:
+		return FlagCriticalLow
+	case rng.CriticalHigh != 0 && value > rng.CriticalHigh:
+		return FlagCriticalHigh
+	case rng.Low != 0 && value < rng.Low:
+		return FlagLow
+	case rng.High != 0 && value > rng.High:
+		return FlagHigh
+	}
+	return ""
+}
+
+func same(v float64) float64           { return v }
+func fromFahrenheit(v float64) float64 { return (v - 32) * 5 / 9 }
+func fromPounds(v float64) float64     { return v * 0.45359237 }
+func fromInches(v float64) float64     { return v * 2.54 }
+
+// round keeps two decimals, the precision values are stored with.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
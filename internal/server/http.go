@@ -16,6 +16,16 @@ func NewHTTPServer(
 	doctor *service.DoctorService,
 	appointment *service.AppointmentService,
 	prescription *service.PrescriptionService,
+	clinic *service.ClinicService,
+	calendar *service.CalendarService,
+	review *service.ReviewService,
+	record *service.MedicalRecordService,
+	vital *service.VitalSignService,
+	lab *service.LabService,
+	fhir *service.FHIRService,
+	bulk *service.BulkService,
+	export *service.PatientExportService,
+	analytics *service.AnalyticsService,
 ) *http.Server {
 	var opts = []http.ServerOption{
 		http.Middleware(
@@ -37,5 +47,92 @@ func NewHTTPServer(
 	v1.RegisterDoctorServiceHTTPServer(srv, doctor)
 	v1.RegisterAppointmentServiceHTTPServer(srv, appointment)
 	v1.RegisterPrescriptionServiceHTTPServer(srv, prescription)
+
+	r := srv.Route("/v1/medical")
+	r.GET("/patient-search", patient.FindPatients)
+	r.POST("/patients/duplicate-check", patient.CheckDuplicates)
+	r.GET("/patients/{patient_id}/duplicates", patient.GetPatientDuplicates)
+	r.POST("/patients/{patient_id}/merge", patient.MergePatient)
+	r.GET("/patients/{patient_id}/merges", patient.ListPatientMerges)
+	r.POST("/patients/{patient_id}/exports", export.RequestPatientExport)
+	r.GET("/patient-exports/{export_id}", export.GetPatientExport)
+	r.GET("/patient-exports/{export_id}/archive", export.DownloadPatientExport)
+	r.PUT("/doctors/{doctor_id}/timezone", doctor.SetDoctorTimezone)
+	r.PUT("/doctors/{doctor_id}/name", doctor.RenameDoctor)
+	r.POST("/appointments/in-person", appointment.BookInPerson)
+	r.GET("/appointments/{appointment_id}/video", appointment.GetVideoJoinInfo)
+	r.POST("/appointments/{appointment_id}/video/key", appointment.ReissueJoinKey)
+	r.POST("/clinics", clinic.CreateClinic)
+	r.GET("/clinics", clinic.ListClinics)
+	r.GET("/clinics/{clinic_id}", clinic.GetClinic)
+	r.PUT("/clinics/{clinic_id}", clinic.UpdateClinic)
+	r.POST("/clinics/{clinic_id}/rooms", clinic.AddRoom)
+	r.POST("/clinics/{clinic_id}/equipment", clinic.AddEquipment)
+	r.GET("/clinics/{clinic_id}/equipment", clinic.ListEquipment)
+	r.GET("/clinics/{clinic_id}/doctors", clinic.SearchClinicDoctors)
+	r.PUT("/clinics/{clinic_id}/doctors/{doctor_id}/availability", clinic.SetClinicAvailability)
+	r.GET("/clinics/{clinic_id}/slots", clinic.GetClinicSlots)
+	r.POST("/doctors/{doctor_id}/calendar-feed", calendar.IssueDoctorFeed)
+	r.POST("/patients/{patient_id}/calendar-feed", calendar.IssuePatientFeed)
+	r.GET("/calendar/{token}.ics", calendar.Feed)
+	r.GET("/appointments/{appointment_id}/ics", calendar.AppointmentICS)
+	r.GET("/doctor-search", doctor.FindDoctors)
+	r.PUT("/doctors/{doctor_id}/consultation-types", doctor.SetConsultationTypes)
+	r.POST("/appointments/{appointment_id}/review", review.CreateReview)
+	r.GET("/doctors/{doctor_id}/reviews", review.ListDoctorReviews)
+	r.PUT("/reviews/{review_id}/moderation", review.ModerateReview)
+	r.POST("/prescriptions/safety-check", prescription.CheckPrescriptionSafety)
+	r.POST("/prescriptions/checked", prescription.CreateCheckedPrescription)
+	r.GET("/prescriptions/{prescription_id}/safety-overrides", prescription.GetSafetyOverrides)
+	r.GET("/prescription-search", prescription.SearchPrescriptions)
+	r.GET("/prescriptions/{prescription_id}/items", prescription.GetPrescriptionItems)
+	r.GET("/formulary", prescription.SearchFormulary)
+	r.POST("/prescriptions/{prescription_id}/revoke", prescription.RevokePrescription)
+	r.POST("/prescriptions/{prescription_id}/renew", prescription.RenewPrescription)
+	r.POST("/prescriptions/{prescription_id}/amend", prescription.AmendPrescription)
+	r.GET("/prescriptions/{prescription_id}/signature", prescription.VerifyPrescriptionSignature)
+	r.POST("/prescriptions/{prescription_id}/refills", prescription.RecordRefill)
+	r.GET("/prescriptions/{prescription_id}/refills", prescription.GetRefills)
+	r.GET("/prescriptions/{prescription_id}/pdf", prescription.GetPrescriptionPDF)
+	r.GET("/prescription-verification/{code}", prescription.VerifyPrescription)
+	r.POST("/medical-records", record.CreateMedicalRecord)
+	r.GET("/medical-records/{record_id}", record.GetMedicalRecord)
+	r.PUT("/medical-records/{record_id}", record.UpdateMedicalRecord)
+	r.POST("/medical-records/{record_id}/finalize", record.FinalizeMedicalRecord)
+	r.POST("/medical-records/{record_id}/amend", record.AmendMedicalRecord)
+	r.GET("/medical-records/{record_id}/history", record.GetMedicalRecordHistory)
+	r.POST("/medical-records/{record_id}/entered-in-error", record.EnterMedicalRecordInError)
+	r.GET("/medical-records/{record_id}/signature", record.VerifyMedicalRecordSignature)
+	r.GET("/patients/{patient_id}/profile", patient.GetPatientProfile)
+	r.PUT("/patients/{patient_id}/medical-history", patient.SetMedicalHistory)
+	r.POST("/patients/{patient_id}/vitals", vital.RecordVitals)
+	r.GET("/patients/{patient_id}/vitals", vital.GetVitalSeries)
+	r.GET("/patients/{patient_id}/lab-results", lab.GetPatientLabResults)
+	r.POST("/lab-orders", lab.CreateLabOrder)
+	r.GET("/lab-orders/{order_id}", lab.GetLabOrder)
+	r.POST("/lab-results", lab.IngestLabResults)
+	r.POST("/lab-results/hl7", lab.IngestHL7)
+	r.POST("/lab-results/{result_id}/review", lab.ReviewLabResult)
+	r.GET("/doctors/{doctor_id}/lab-inbox", lab.GetLabInbox)
+	r.POST("/admin/fhir-import", fhir.ImportBundle)
+	r.POST("/admin/import/{kind}", bulk.ImportFile)
+	r.GET("/admin/export/{kind}", bulk.Export)
+	r.GET("/reports/bookings", analytics.GetBookingsReport)
+	r.GET("/reports/utilization", analytics.GetUtilizationReport)
+	r.GET("/reports/cancellations", analytics.GetCancellationsReport)
+	r.GET("/reports/lead-time", analytics.GetLeadTimeReport)
+	r.GET("/reports/busiest-hours", analytics.GetBusiestHoursReport)
+	r.GET("/reports/medications", analytics.GetMedicationsReport)
+	for _, section := range service.ProfileSections {
+		r.GET("/patients/{patient_id}/"+section, patient.ListProfileItems(section))
+		r.POST("/patients/{patient_id}/"+section, patient.AddProfileItem(section))
+		r.PUT("/patients/{patient_id}/"+section+"/{item_id}", patient.UpdateProfileItem(section))
+		r.DELETE("/patients/{patient_id}/"+section+"/{item_id}", patient.DeleteProfileItem(section))
+	}
+
+	f := srv.Route(service.FHIRBasePath)
+	f.GET("/metadata", fhir.Metadata)
+	f.GET("/{type}", fhir.Search)
+	f.GET("/{type}/{id}", fhir.Read)
 	return srv
 }
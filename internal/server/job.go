@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/arm-1234/medical-service/internal/service"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+const (
+	defaultPrescriptionExpiryInterval = time.Hour
+	defaultLabDropInterval            = time.Minute
+	defaultPatientExportInterval      = 10 * time.Second
+	defaultAnalyticsRefreshInterval   = 15 * time.Minute
+)
+
+// job is a task the job server runs on a fixed interval.
+type job struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+// JobServer runs background jobs alongside the gRPC and HTTP servers. Each
+// job runs once at start-up and then on its interval until the app stops.
+type JobServer struct {
+	jobs []job
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+	log  *log.Helper
+}
+
+func NewJobServer(c *conf.Clinical, prescription *service.PrescriptionService, lab *service.LabService, export *service.PatientExportService, analytics *service.AnalyticsService, logger log.Logger) *JobServer {
+	expiry := defaultPrescriptionExpiryInterval
+	if c.GetPrescriptionExpiryInterval() != nil {
+		expiry = c.GetPrescriptionExpiryInterval().AsDuration()
+	}
+	exports := defaultPatientExportInterval
+	if c.GetPatientExportInterval() != nil {
+		exports = c.GetPatientExportInterval().AsDuration()
+	}
+	refresh := defaultAnalyticsRefreshInterval
+	if c.GetAnalyticsRefreshInterval() != nil {
+		refresh = c.GetAnalyticsRefreshInterval().AsDuration()
+	}
+	jobs := []job{
+		{name: "prescription-expiry", interval: expiry, run: prescription.ExpirePrescriptions},
+		{name: "patient-export", interval: exports, run: export.RunPatientExports},
+		{name: "analytics-refresh", interval: refresh, run: analytics.RefreshAnalytics},
+	}
+
+	if c.GetLabDropDir() != "" {
+		interval := defaultLabDropInterval
+		if c.GetLabDropInterval() != nil {
+			interval = c.GetLabDropInterval().AsDuration()
+		}
+		jobs = append(jobs, job{name: "lab-drop", interval: interval, run: lab.IngestDropFiles})
+	}
+
+	return &JobServer{
+		jobs: jobs,
+		stop: make(chan struct{}),
+		log:  log.NewHelper(logger),
+	}
+}
+
+func (s *JobServer) Start(ctx context.Context) error {
+	for _, j := range s.jobs {
+		if j.interval <= 0 {
+			s.log.Warnf("job %s has no interval, not scheduling it", j.name)
+			continue
+		}
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+	}
+	s.log.Infof("[Job] server started with %d jobs", len(s.jobs))
+
+	s.wg.Wait()
+	return nil
+}
+
+func (s *JobServer) Stop(ctx context.Context) error {
+	s.once.Do(func() { close(s.stop) })
+	s.wg.Wait()
+	s.log.Info("[Job] server stopped")
+	return nil
+}
+
+func (s *JobServer) loop(ctx context.Context, j job) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		if err := j.run(ctx); err != nil {
+			s.log.Errorf("job %s failed: %v", j.name, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
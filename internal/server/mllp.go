@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/arm-1234/medical-service/internal/conf"
+	"github.com/arm-1234/medical-service/internal/pkg/hl7"
+	"github.com/arm-1234/medical-service/internal/service"
+
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+const defaultMLLPIdleTimeout = 5 * time.Minute
+
+// MLLPServer accepts HL7 v2 messages from hospital partners over MLLP and
+// answers each with an ACK: AA once applied, AE when applying it failed and
+// AR for messages that are malformed or not handled at all. Messages on one
+// connection are handled in order.
+type MLLPServer struct {
+	addr     string
+	facility string
+	timeout  time.Duration
+	hl7      *service.HL7Service
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	log      *log.Helper
+}
+
+func NewMLLPServer(c *conf.Server, hl7Service *service.HL7Service, logger log.Logger) *MLLPServer {
+	timeout := defaultMLLPIdleTimeout
+	if c.GetMllp().GetTimeout() != nil {
+		timeout = c.GetMllp().GetTimeout().AsDuration()
+	}
+	return &MLLPServer{
+		addr:     c.GetMllp().GetAddr(),
+		facility: c.GetMllp().GetFacility(),
+		timeout:  timeout,
+		hl7:      hl7Service,
+		conns:    make(map[net.Conn]struct{}),
+		log:      log.NewHelper(logger),
+	}
+}
+
+func (s *MLLPServer) Start(ctx context.Context) error {
+	if s.addr == "" {
+		s.log.Info("[MLLP] no address configured, not listening")
+		return nil
+	}
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+	s.log.Infof("[MLLP] server listening on: %s", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			s.log.Errorf("failed to accept MLLP connection: %v", err)
+			continue
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serve(ctx, conn)
+	}
+}
+
+func (s *MLLPServer) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	s.log.Info("[MLLP] server stopped")
+	return nil
+}
+
+func (s *MLLPServer) serve(ctx context.Context, conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(s.timeout))
+		raw, err := hl7.ReadFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.log.Warnf("closing MLLP connection from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		reply := s.handle(ctx, raw)
+		_ = conn.SetWriteDeadline(time.Now().Add(s.timeout))
+		if err := hl7.WriteFrame(conn, reply); err != nil {
+			s.log.Warnf("failed to acknowledge MLLP message from %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// handle applies one message and returns its ACK.
+func (s *MLLPServer) handle(ctx context.Context, raw string) string {
+	m, err := hl7.Parse(raw)
+	if err != nil {
+		s.log.Warnf("rejecting malformed HL7 message: %v", err)
+		return hl7.ACK(nil, hl7.AckReject, err.Error(), hl7.Application, s.facility)
+	}
+
+	err = s.hl7.HandleMessage(ctx, m)
+	switch {
+	case errors.Is(err, hl7.ErrUnsupported):
+		return hl7.ACK(m, hl7.AckReject, err.Error(), hl7.Application, s.facility)
+	case err != nil:
+		s.log.Errorf("failed to apply HL7 message %s: %v", m.ControlID(), err)
+		return hl7.ACK(m, hl7.AckError, err.Error(), hl7.Application, s.facility)
+	}
+	return hl7.ACK(m, hl7.AckAccept, "", hl7.Application, s.facility)
+}
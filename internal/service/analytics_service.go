@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// AnalyticsService serves the clinic's usage reports.
+type AnalyticsService struct {
+	handler *biz.AnalyticsHandler
+	log     *log.Helper
+}
+
+func NewAnalyticsService(handler *biz.AnalyticsHandler, logger log.Logger) *AnalyticsService {
+	return &AnalyticsService{
+		handler: handler,
+		log:     log.NewHelper(logger),
+	}
+}
+
+// report serves one report from the query parameters shared by all of them.
+func (s *AnalyticsService) report(ctx http.Context, method string, run func(context.Context, *biz.AnalyticsReportRequest) (interface{}, error)) error {
+	var in biz.AnalyticsReportRequest
+	if err := ctx.BindQuery(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.AnalyticsService/"+method)
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "AnalyticsService."+method)
+		defer span.End()
+
+		s.log.Infof("%s request: from=%s, to=%s, doctor=%s, specialization=%d", method, in.FromDate, in.ToDate, in.DoctorID, in.Specialization)
+		return run(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *AnalyticsService) GetBookingsReport(ctx http.Context) error {
+	return s.report(ctx, "GetBookingsReport", func(ctx context.Context, in *biz.AnalyticsReportRequest) (interface{}, error) {
+		return s.handler.GetBookingsReport(ctx, in)
+	})
+}
+
+func (s *AnalyticsService) GetUtilizationReport(ctx http.Context) error {
+	return s.report(ctx, "GetUtilizationReport", func(ctx context.Context, in *biz.AnalyticsReportRequest) (interface{}, error) {
+		return s.handler.GetUtilizationReport(ctx, in)
+	})
+}
+
+func (s *AnalyticsService) GetCancellationsReport(ctx http.Context) error {
+	return s.report(ctx, "GetCancellationsReport", func(ctx context.Context, in *biz.AnalyticsReportRequest) (interface{}, error) {
+		return s.handler.GetCancellationsReport(ctx, in)
+	})
+}
+
+func (s *AnalyticsService) GetLeadTimeReport(ctx http.Context) error {
+	return s.report(ctx, "GetLeadTimeReport", func(ctx context.Context, in *biz.AnalyticsReportRequest) (interface{}, error) {
+		return s.handler.GetLeadTimeReport(ctx, in)
+	})
+}
+
+func (s *AnalyticsService) GetBusiestHoursReport(ctx http.Context) error {
+	return s.report(ctx, "GetBusiestHoursReport", func(ctx context.Context, in *biz.AnalyticsReportRequest) (interface{}, error) {
+		return s.handler.GetBusiestHoursReport(ctx, in)
+	})
+}
+
+func (s *AnalyticsService) GetMedicationsReport(ctx http.Context) error {
+	return s.report(ctx, "GetMedicationsReport", func(ctx context.Context, in *biz.AnalyticsReportRequest) (interface{}, error) {
+		return s.handler.GetMedicationsReport(ctx, in)
+	})
+}
+
+// RefreshAnalytics is run by the job server rather than served.
+func (s *AnalyticsService) RefreshAnalytics(ctx context.Context) error {
+	ctx, span := otel.Trace(ctx, "AnalyticsService.RefreshAnalytics")
+	defer span.End()
+
+	return s.handler.RefreshAnalytics(ctx)
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"strings"
 
 	requestpb "github.com/arm-1234/common-protos/medical/v1/request"
 	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
@@ -9,6 +10,7 @@ import (
 	"github.com/arm-1234/medical-service/internal/biz"
 	"github.com/arm-1234/medical-service/internal/pkg/otel"
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
 )
 
 type AppointmentService struct {
@@ -88,3 +90,66 @@ func (s *AppointmentService) GetDoctorAppointments(ctx context.Context, req *req
 	s.log.Infof("GetDoctorAppointments request: %s", req.DoctorId)
 	return s.handler.GetDoctorAppointments(ctx, req)
 }
+
+func (s *AppointmentService) BookInPerson(ctx http.Context) error {
+	var in biz.InPersonBookingRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.AppointmentService/BookInPerson")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "AppointmentService.BookInPerson")
+		defer span.End()
+
+		s.log.Infof("BookInPerson request: patient=%s, doctor=%s", in.PatientID, in.DoctorID)
+		return s.handler.BookInPerson(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *AppointmentService) GetVideoJoinInfo(ctx http.Context) error {
+	appointmentID := ctx.Vars().Get("appointment_id")
+	joinKey := ctx.Query().Get("key")
+
+	http.SetOperation(ctx, "/medical.v1.AppointmentService/GetVideoJoinInfo")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "AppointmentService.GetVideoJoinInfo")
+		defer span.End()
+
+		s.log.Infof("GetVideoJoinInfo request: appointment=%s", appointmentID)
+		return s.handler.GetVideoJoinInfo(ctx, appointmentID, joinKey)
+	})
+	out, err := h(ctx, appointmentID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *AppointmentService) ReissueJoinKey(ctx http.Context) error {
+	var in biz.ReissueJoinKeyRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.AppointmentID = ctx.Vars().Get("appointment_id")
+	in.Token = strings.TrimPrefix(ctx.Header().Get("Authorization"), "Bearer ")
+
+	http.SetOperation(ctx, "/medical.v1.AppointmentService/ReissueJoinKey")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "AppointmentService.ReissueJoinKey")
+		defer span.End()
+
+		s.log.Infof("ReissueJoinKey request: appointment=%s, participant=%s", in.AppointmentID, in.ParticipantID)
+		return s.handler.ReissueJoinKey(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"io"
+	nethttp "net/http"
+	"strconv"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/arm-1234/medical-service/internal/pkg/sheet"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// BulkService imports spreadsheets of patients, doctors and schedules and
+// streams CSV exports.
+type BulkService struct {
+	handler *biz.BulkHandler
+	log     *log.Helper
+}
+
+func NewBulkService(handler *biz.BulkHandler, logger log.Logger) *BulkService {
+	return &BulkService{
+		handler: handler,
+		log:     log.NewHelper(logger),
+	}
+}
+
+// ImportFile takes a CSV or XLSX file as the request body. With the dry_run
+// query parameter set it only reports what the import would do.
+func (s *BulkService) ImportFile(ctx http.Context) error {
+	body, err := io.ReadAll(io.LimitReader(ctx.Request().Body, sheet.MaxSize))
+	if err != nil {
+		return err
+	}
+	dryRun, _ := strconv.ParseBool(ctx.Request().URL.Query().Get("dry_run"))
+	in := &biz.BulkImportRequest{
+		Kind:   ctx.Vars().Get("kind"),
+		DryRun: dryRun,
+		File:   body,
+	}
+
+	http.SetOperation(ctx, "/medical.v1.BulkService/ImportFile")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "BulkService.ImportFile")
+		defer span.End()
+
+		s.log.Infof("ImportFile request: kind=%s, dry_run=%v, %d bytes", in.Kind, in.DryRun, len(body))
+		return s.handler.ImportFile(ctx, in)
+	})
+	out, err := h(ctx, in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+// Export streams the selected rows as a CSV download. Once rows have been
+// sent a failure can only cut the download short, so it is logged rather
+// than returned.
+func (s *BulkService) Export(ctx http.Context) error {
+	query := ctx.Request().URL.Query()
+	in := &biz.BulkExportRequest{
+		Kind: ctx.Vars().Get("kind"),
+		From: query.Get("from"),
+		To:   query.Get("to"),
+	}
+	w := &exportWriter{w: ctx.Response()}
+
+	http.SetOperation(ctx, "/medical.v1.BulkService/Export")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "BulkService.Export")
+		defer span.End()
+
+		s.log.Infof("Export request: kind=%s, from=%s, to=%s", in.Kind, in.From, in.To)
+		if _, err := s.handler.ExportFilters(ctx, in); err != nil {
+			return nil, err
+		}
+		w.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.w.Header().Set("Content-Disposition", `attachment; filename="`+in.Kind+`.csv"`)
+		return nil, s.handler.Export(ctx, in, w)
+	})
+	if _, err := h(ctx, in); err != nil {
+		if w.written {
+			s.log.Errorf("Export of %s cut short: %v", in.Kind, err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// exportWriter sends what is written to it straight on to the client and
+// remembers whether anything was.
+type exportWriter struct {
+	w       nethttp.ResponseWriter
+	written bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	e.written = true
+	n, err := e.w.Write(p)
+	if f, ok := e.w.(nethttp.Flusher); ok {
+		f.Flush()
+	}
+	return n, err
+}
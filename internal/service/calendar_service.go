@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/data/entity"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+const calendarContentType = "text/calendar; charset=utf-8"
+
+type CalendarService struct {
+	handler *biz.CalendarHandler
+	log     *log.Helper
+}
+
+func NewCalendarService(handler *biz.CalendarHandler, logger log.Logger) *CalendarService {
+	return &CalendarService{
+		handler: handler,
+		log:     log.NewHelper(logger),
+	}
+}
+
+func (s *CalendarService) IssueDoctorFeed(ctx http.Context) error {
+	return s.issueFeed(ctx, entity.CalendarOwnerDoctor, ctx.Vars().Get("doctor_id"))
+}
+
+func (s *CalendarService) IssuePatientFeed(ctx http.Context) error {
+	return s.issueFeed(ctx, entity.CalendarOwnerPatient, ctx.Vars().Get("patient_id"))
+}
+
+func (s *CalendarService) issueFeed(ctx http.Context, ownerType, ownerID string) error {
+	http.SetOperation(ctx, "/medical.v1.CalendarService/IssueFeedToken")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "CalendarService.IssueFeedToken")
+		defer span.End()
+
+		s.log.Infof("IssueFeedToken request: %s %s", ownerType, ownerID)
+		return s.handler.IssueFeedToken(ctx, ownerType, ownerID)
+	})
+	out, err := h(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *CalendarService) Feed(ctx http.Context) error {
+	token := ctx.Vars().Get("token")
+
+	http.SetOperation(ctx, "/medical.v1.CalendarService/Feed")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "CalendarService.Feed")
+		defer span.End()
+
+		s.log.Infof("Feed request")
+		return s.handler.Feed(ctx, token)
+	})
+	out, err := h(ctx, token)
+	if err != nil {
+		return err
+	}
+	return ctx.Blob(200, calendarContentType, out.([]byte))
+}
+
+func (s *CalendarService) AppointmentICS(ctx http.Context) error {
+	appointmentID := ctx.Vars().Get("appointment_id")
+
+	http.SetOperation(ctx, "/medical.v1.CalendarService/AppointmentICS")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "CalendarService.AppointmentICS")
+		defer span.End()
+
+		s.log.Infof("AppointmentICS request: %s", appointmentID)
+		return s.handler.AppointmentICS(ctx, appointmentID)
+	})
+	out, err := h(ctx, appointmentID)
+	if err != nil {
+		return err
+	}
+	ctx.Response().Header().Set("Content-Disposition", `attachment; filename="appointment-`+appointmentID+`.ics"`)
+	return ctx.Blob(200, calendarContentType, out.([]byte))
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	requestpb "github.com/arm-1234/common-protos/medical/v1/request"
+	responsepb "github.com/arm-1234/common-protos/medical/v1/response"
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+type ClinicService struct {
+	handler            *biz.ClinicHandler
+	doctorHandler      *biz.DoctorHandler
+	appointmentHandler *biz.AppointmentHandler
+	log                *log.Helper
+}
+
+func NewClinicService(
+	handler *biz.ClinicHandler,
+	doctorHandler *biz.DoctorHandler,
+	appointmentHandler *biz.AppointmentHandler,
+	logger log.Logger,
+) *ClinicService {
+	return &ClinicService{
+		handler:            handler,
+		doctorHandler:      doctorHandler,
+		appointmentHandler: appointmentHandler,
+		log:                log.NewHelper(logger),
+	}
+}
+
+func (s *ClinicService) CreateClinic(ctx http.Context) error {
+	var in biz.ClinicRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/CreateClinic")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.CreateClinic")
+		defer span.End()
+
+		s.log.Infof("CreateClinic request: %s", in.Name)
+		return s.handler.CreateClinic(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ClinicService) GetClinic(ctx http.Context) error {
+	clinicID := ctx.Vars().Get("clinic_id")
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/GetClinic")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.GetClinic")
+		defer span.End()
+
+		s.log.Infof("GetClinic request: %s", clinicID)
+		return s.handler.GetClinic(ctx, clinicID)
+	})
+	out, err := h(ctx, clinicID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ClinicService) UpdateClinic(ctx http.Context) error {
+	var in biz.ClinicRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.ClinicID = ctx.Vars().Get("clinic_id")
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/UpdateClinic")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.UpdateClinic")
+		defer span.End()
+
+		s.log.Infof("UpdateClinic request: %s", in.ClinicID)
+		return s.handler.UpdateClinic(ctx, in.ClinicID, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ClinicService) ListClinics(ctx http.Context) error {
+	name := ctx.Query().Get("name")
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/ListClinics")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.ListClinics")
+		defer span.End()
+
+		s.log.Infof("ListClinics request: name=%s", name)
+		return s.handler.ListClinics(ctx, name)
+	})
+	out, err := h(ctx, name)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ClinicService) AddRoom(ctx http.Context) error {
+	var in biz.RoomRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.ClinicID = ctx.Vars().Get("clinic_id")
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/AddRoom")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.AddRoom")
+		defer span.End()
+
+		s.log.Infof("AddRoom request for clinic: %s", in.ClinicID)
+		return s.handler.AddRoom(ctx, in.ClinicID, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ClinicService) AddEquipment(ctx http.Context) error {
+	var in biz.EquipmentRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.ClinicID = ctx.Vars().Get("clinic_id")
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/AddEquipment")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.AddEquipment")
+		defer span.End()
+
+		s.log.Infof("AddEquipment request for clinic: %s, type=%s", in.ClinicID, in.Type)
+		return s.handler.AddEquipment(ctx, in.ClinicID, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ClinicService) ListEquipment(ctx http.Context) error {
+	clinicID := ctx.Vars().Get("clinic_id")
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/ListEquipment")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.ListEquipment")
+		defer span.End()
+
+		s.log.Infof("ListEquipment request for clinic: %s", clinicID)
+		return s.handler.ListEquipment(ctx, clinicID)
+	})
+	out, err := h(ctx, clinicID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ClinicService) SearchClinicDoctors(ctx http.Context) error {
+	var in requestpb.SearchDoctorsRequest
+	if err := ctx.BindQuery(&in); err != nil {
+		return err
+	}
+	clinicID := ctx.Vars().Get("clinic_id")
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/SearchClinicDoctors")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.SearchClinicDoctors")
+		defer span.End()
+
+		s.log.Infof("SearchClinicDoctors request for clinic: %s", clinicID)
+		doctors, err := s.doctorHandler.SearchClinicDoctors(ctx, clinicID, &in)
+		if err != nil {
+			return nil, err
+		}
+		return &responsepb.SearchDoctorsResponse{Doctors: doctors}, nil
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ClinicService) SetClinicAvailability(ctx http.Context) error {
+	var in requestpb.SetAvailabilityRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	clinicID := ctx.Vars().Get("clinic_id")
+	in.DoctorId = ctx.Vars().Get("doctor_id")
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/SetClinicAvailability")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.SetClinicAvailability")
+		defer span.End()
+
+		s.log.Infof("SetClinicAvailability request: clinic=%s, doctor=%s", clinicID, in.DoctorId)
+		return s.doctorHandler.SetClinicAvailability(ctx, clinicID, in.DoctorId, in.AvailabilitySlots)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ClinicService) GetClinicSlots(ctx http.Context) error {
+	var in requestpb.GetAvailableSlotsRequest
+	if err := ctx.BindQuery(&in); err != nil {
+		return err
+	}
+	clinicID := ctx.Vars().Get("clinic_id")
+	var equipment []string
+	if e := ctx.Query().Get("equipment"); e != "" {
+		equipment = strings.Split(e, ",")
+	}
+
+	http.SetOperation(ctx, "/medical.v1.ClinicService/GetClinicSlots")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ClinicService.GetClinicSlots")
+		defer span.End()
+
+		s.log.Infof("GetClinicSlots request: clinic=%s, doctor=%s, date=%s", clinicID, in.DoctorId, in.Date)
+		return s.appointmentHandler.GetClinicSlots(ctx, clinicID, in.DoctorId, in.Date, equipment)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/arm-1234/medical-service/internal/biz"
 	"github.com/arm-1234/medical-service/internal/pkg/otel"
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
 )
 
 type DoctorService struct {
@@ -80,3 +81,90 @@ func (s *DoctorService) GetDoctorAvailability(ctx context.Context, req *requestp
 	s.log.Infof("GetDoctorAvailability request for doctor: %s", req.DoctorId)
 	return s.handler.GetDoctorAvailability(ctx, req.DoctorId)
 }
+
+func (s *DoctorService) SetDoctorTimezone(ctx http.Context) error {
+	var in biz.DoctorTimezone
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.DoctorID = ctx.Vars().Get("doctor_id")
+
+	http.SetOperation(ctx, "/medical.v1.DoctorService/SetDoctorTimezone")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "DoctorService.SetDoctorTimezone")
+		defer span.End()
+
+		s.log.Infof("SetDoctorTimezone request for doctor: %s", in.DoctorID)
+		return s.handler.SetDoctorTimezone(ctx, in.DoctorID, in.Timezone)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *DoctorService) FindDoctors(ctx http.Context) error {
+	var in biz.DoctorSearchRequest
+	if err := ctx.BindQuery(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.DoctorService/FindDoctors")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "DoctorService.FindDoctors")
+		defer span.End()
+
+		s.log.Infof("FindDoctors request: %+v", in)
+		return s.handler.FindDoctors(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *DoctorService) SetConsultationTypes(ctx http.Context) error {
+	var in biz.ConsultationTypesRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.DoctorID = ctx.Vars().Get("doctor_id")
+
+	http.SetOperation(ctx, "/medical.v1.DoctorService/SetConsultationTypes")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "DoctorService.SetConsultationTypes")
+		defer span.End()
+
+		s.log.Infof("SetConsultationTypes request for doctor: %s", in.DoctorID)
+		return s.handler.SetConsultationTypes(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *DoctorService) RenameDoctor(ctx http.Context) error {
+	var in biz.RenameDoctorRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.DoctorID = ctx.Vars().Get("doctor_id")
+
+	http.SetOperation(ctx, "/medical.v1.DoctorService/RenameDoctor")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "DoctorService.RenameDoctor")
+		defer span.End()
+
+		s.log.Infof("RenameDoctor request for doctor: %s", in.DoctorID)
+		return s.handler.RenameDoctor(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/fhir"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// FHIRBasePath is where the FHIR API is mounted.
+const FHIRBasePath = "/fhir/r4"
+
+// maxFHIRBundleSize bounds the body of a Bundle posted for import.
+const maxFHIRBundleSize = 64 << 20
+
+// FHIRService serves the FHIR API and the import of FHIR Bundles. API
+// responses, errors included, are FHIR JSON; errors are sent as
+// OperationOutcomes rather than Kratos errors.
+type FHIRService struct {
+	handler  *biz.FHIRHandler
+	importer *biz.FHIRImportHandler
+	log      *log.Helper
+}
+
+func NewFHIRService(handler *biz.FHIRHandler, importer *biz.FHIRImportHandler, logger log.Logger) *FHIRService {
+	return &FHIRService{
+		handler:  handler,
+		importer: importer,
+		log:      log.NewHelper(logger),
+	}
+}
+
+func (s *FHIRService) Metadata(ctx http.Context) error {
+	http.SetOperation(ctx, "/medical.v1.FHIRService/Metadata")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "FHIRService.Metadata")
+		defer span.End()
+
+		s.log.Infof("Metadata request")
+		return s.handler.CapabilityStatement(ctx), nil
+	})
+	out, err := h(ctx, nil)
+	return s.write(ctx, out, err)
+}
+
+func (s *FHIRService) Read(ctx http.Context) error {
+	resourceType := ctx.Vars().Get("type")
+	id := ctx.Vars().Get("id")
+
+	http.SetOperation(ctx, "/medical.v1.FHIRService/Read")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "FHIRService.Read")
+		defer span.End()
+
+		s.log.Infof("Read request: %s/%s", resourceType, id)
+		return s.handler.Read(ctx, resourceType, id)
+	})
+	out, err := h(ctx, id)
+	return s.write(ctx, out, err)
+}
+
+func (s *FHIRService) Search(ctx http.Context) error {
+	resourceType := ctx.Vars().Get("type")
+	params := ctx.Request().URL.Query()
+	base := fhirBaseURL(ctx)
+
+	http.SetOperation(ctx, "/medical.v1.FHIRService/Search")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "FHIRService.Search")
+		defer span.End()
+
+		s.log.Infof("Search request: %s?%s", resourceType, params.Encode())
+		return s.handler.Search(ctx, resourceType, params, base)
+	})
+	out, err := h(ctx, params)
+	return s.write(ctx, out, err)
+}
+
+// ImportBundle takes a FHIR Bundle as the request body, and the system it
+// was exported from as the source query parameter. Unlike the FHIR API it
+// answers with a plain JSON import report.
+func (s *FHIRService) ImportBundle(ctx http.Context) error {
+	body, err := io.ReadAll(io.LimitReader(ctx.Request().Body, maxFHIRBundleSize))
+	if err != nil {
+		return err
+	}
+	in := &biz.ImportFHIRBundleRequest{
+		Source: ctx.Request().URL.Query().Get("source"),
+		Bundle: body,
+	}
+
+	http.SetOperation(ctx, "/medical.v1.FHIRService/ImportBundle")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "FHIRService.ImportBundle")
+		defer span.End()
+
+		s.log.Infof("ImportBundle request: source=%s, %d bytes", in.Source, len(body))
+		return s.importer.ImportBundle(ctx, in)
+	})
+	out, err := h(ctx, in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+// write sends out, or err as an OperationOutcome, as FHIR JSON.
+func (s *FHIRService) write(ctx http.Context, out interface{}, err error) error {
+	status := 200
+	if err != nil {
+		status, out = fhir.Outcome(err)
+	}
+	body, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return ctx.Blob(status, fhir.ContentType, body)
+}
+
+// fhirBaseURL is the URL the FHIR API is reached at by the client, taking a
+// TLS-terminating proxy into account.
+func fhirBaseURL(ctx http.Context) string {
+	req := ctx.Request()
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + req.Host + FHIRBasePath
+}
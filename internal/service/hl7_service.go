@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/hl7"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+)
+
+// HL7Service takes the HL7 v2 messages partners send over MLLP.
+type HL7Service struct {
+	handler *biz.HL7Handler
+	log     *log.Helper
+}
+
+func NewHL7Service(handler *biz.HL7Handler, logger log.Logger) *HL7Service {
+	return &HL7Service{
+		handler: handler,
+		log:     log.NewHelper(logger),
+	}
+}
+
+// HandleMessage is called by the MLLP server rather than served.
+func (s *HL7Service) HandleMessage(ctx context.Context, m *hl7.Message) error {
+	ctx, span := otel.Trace(ctx, "HL7Service.HandleMessage")
+	defer span.End()
+
+	s.log.Infof("HandleMessage request: %s %s from %s", m.Type(), m.ControlID(), m.SendingFacility())
+	return s.handler.HandleMessage(ctx, m)
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// maxHL7MessageSize bounds the body of a posted HL7 message.
+const maxHL7MessageSize = 1 << 20
+
+type LabService struct {
+	handler *biz.LabHandler
+	log     *log.Helper
+}
+
+func NewLabService(handler *biz.LabHandler, logger log.Logger) *LabService {
+	return &LabService{
+		handler: handler,
+		log:     log.NewHelper(logger),
+	}
+}
+
+func (s *LabService) CreateLabOrder(ctx http.Context) error {
+	var in biz.CreateLabOrderRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.LabService/CreateLabOrder")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "LabService.CreateLabOrder")
+		defer span.End()
+
+		s.log.Infof("CreateLabOrder request: appointment=%s, tests=%d", in.AppointmentID, len(in.Tests))
+		return s.handler.CreateLabOrder(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *LabService) GetLabOrder(ctx http.Context) error {
+	orderID := ctx.Vars().Get("order_id")
+
+	http.SetOperation(ctx, "/medical.v1.LabService/GetLabOrder")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "LabService.GetLabOrder")
+		defer span.End()
+
+		s.log.Infof("GetLabOrder request: %s", orderID)
+		return s.handler.GetLabOrder(ctx, orderID)
+	})
+	out, err := h(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *LabService) IngestLabResults(ctx http.Context) error {
+	var in biz.IngestLabResultsRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.LabService/IngestLabResults")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "LabService.IngestLabResults")
+		defer span.End()
+
+		s.log.Infof("IngestLabResults request: order=%s, results=%d", in.OrderID, len(in.Results))
+		return s.handler.IngestLabResults(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+// IngestHL7 takes a raw HL7 v2 ORU message as the request body.
+func (s *LabService) IngestHL7(ctx http.Context) error {
+	body, err := io.ReadAll(io.LimitReader(ctx.Request().Body, maxHL7MessageSize))
+	if err != nil {
+		return err
+	}
+	raw := string(body)
+
+	http.SetOperation(ctx, "/medical.v1.LabService/IngestHL7")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "LabService.IngestHL7")
+		defer span.End()
+
+		s.log.Infof("IngestHL7 request: %d bytes", len(raw))
+		return s.handler.IngestHL7(ctx, raw)
+	})
+	out, err := h(ctx, raw)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *LabService) GetPatientLabResults(ctx http.Context) error {
+	var in biz.PatientLabResultsRequest
+	if err := ctx.BindQuery(&in); err != nil {
+		return err
+	}
+	in.PatientID = ctx.Vars().Get("patient_id")
+
+	http.SetOperation(ctx, "/medical.v1.LabService/GetPatientLabResults")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "LabService.GetPatientLabResults")
+		defer span.End()
+
+		s.log.Infof("GetPatientLabResults request: %s", in.PatientID)
+		return s.handler.GetPatientLabResults(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *LabService) GetLabInbox(ctx http.Context) error {
+	doctorID := ctx.Vars().Get("doctor_id")
+
+	http.SetOperation(ctx, "/medical.v1.LabService/GetLabInbox")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "LabService.GetLabInbox")
+		defer span.End()
+
+		s.log.Infof("GetLabInbox request: %s", doctorID)
+		return s.handler.GetLabInbox(ctx, doctorID)
+	})
+	out, err := h(ctx, doctorID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *LabService) ReviewLabResult(ctx http.Context) error {
+	var in biz.ReviewLabResultRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.ResultID = ctx.Vars().Get("result_id")
+
+	http.SetOperation(ctx, "/medical.v1.LabService/ReviewLabResult")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "LabService.ReviewLabResult")
+		defer span.End()
+
+		s.log.Infof("ReviewLabResult request: result=%s, reviewer=%s", in.ResultID, in.ReviewedBy)
+		return s.handler.ReviewLabResult(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+// IngestDropFiles is run by the job server rather than served.
+func (s *LabService) IngestDropFiles(ctx context.Context) error {
+	ctx, span := otel.Trace(ctx, "LabService.IngestDropFiles")
+	defer span.End()
+
+	return s.handler.IngestDropFiles(ctx)
+}
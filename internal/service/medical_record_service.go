@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+type MedicalRecordService struct {
+	handler *biz.MedicalRecordHandler
+	log     *log.Helper
+}
+
+func NewMedicalRecordService(handler *biz.MedicalRecordHandler, logger log.Logger) *MedicalRecordService {
+	return &MedicalRecordService{
+		handler: handler,
+		log:     log.NewHelper(logger),
+	}
+}
+
+func (s *MedicalRecordService) CreateMedicalRecord(ctx http.Context) error {
+	var in biz.CreateMedicalRecordRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.MedicalRecordService/CreateMedicalRecord")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "MedicalRecordService.CreateMedicalRecord")
+		defer span.End()
+
+		s.log.Infof("CreateMedicalRecord request: patient=%s, doctor=%s, finalize=%t", in.PatientID, in.DoctorID, in.Finalize)
+		return s.handler.CreateMedicalRecord(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *MedicalRecordService) GetMedicalRecord(ctx http.Context) error {
+	recordID := ctx.Vars().Get("record_id")
+
+	http.SetOperation(ctx, "/medical.v1.MedicalRecordService/GetMedicalRecord")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "MedicalRecordService.GetMedicalRecord")
+		defer span.End()
+
+		s.log.Infof("GetMedicalRecord request: %s", recordID)
+		return s.handler.GetMedicalRecord(ctx, recordID)
+	})
+	out, err := h(ctx, recordID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *MedicalRecordService) UpdateMedicalRecord(ctx http.Context) error {
+	var in biz.UpdateMedicalRecordRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.RecordID = ctx.Vars().Get("record_id")
+
+	http.SetOperation(ctx, "/medical.v1.MedicalRecordService/UpdateMedicalRecord")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "MedicalRecordService.UpdateMedicalRecord")
+		defer span.End()
+
+		s.log.Infof("UpdateMedicalRecord request: %s", in.RecordID)
+		return s.handler.UpdateMedicalRecord(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *MedicalRecordService) FinalizeMedicalRecord(ctx http.Context) error {
+	in := biz.FinalizeMedicalRecordRequest{RecordID: ctx.Vars().Get("record_id")}
+
+	http.SetOperation(ctx, "/medical.v1.MedicalRecordService/FinalizeMedicalRecord")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "MedicalRecordService.FinalizeMedicalRecord")
+		defer span.End()
+
+		s.log.Infof("FinalizeMedicalRecord request: %s", in.RecordID)
+		return s.handler.FinalizeMedicalRecord(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *MedicalRecordService) AmendMedicalRecord(ctx http.Context) error {
+	var in biz.AmendMedicalRecordRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.RecordID = ctx.Vars().Get("record_id")
+
+	http.SetOperation(ctx, "/medical.v1.MedicalRecordService/AmendMedicalRecord")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "MedicalRecordService.AmendMedicalRecord")
+		defer span.End()
+
+		s.log.Infof("AmendMedicalRecord request: %s by %s", in.RecordID, in.AuthorID)
+		return s.handler.AmendMedicalRecord(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *MedicalRecordService) VerifyMedicalRecordSignature(ctx http.Context) error {
+	recordID := ctx.Vars().Get("record_id")
+
+	http.SetOperation(ctx, "/medical.v1.MedicalRecordService/VerifyMedicalRecordSignature")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "MedicalRecordService.VerifyMedicalRecordSignature")
+		defer span.End()
+
+		s.log.Infof("VerifyMedicalRecordSignature request: %s", recordID)
+		return s.handler.VerifyMedicalRecordSignature(ctx, recordID)
+	})
+	out, err := h(ctx, recordID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *MedicalRecordService) GetMedicalRecordHistory(ctx http.Context) error {
+	recordID := ctx.Vars().Get("record_id")
+
+	http.SetOperation(ctx, "/medical.v1.MedicalRecordService/GetMedicalRecordHistory")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "MedicalRecordService.GetMedicalRecordHistory")
+		defer span.End()
+
+		s.log.Infof("GetMedicalRecordHistory request: %s", recordID)
+		return s.handler.GetMedicalRecordHistory(ctx, recordID)
+	})
+	out, err := h(ctx, recordID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *MedicalRecordService) EnterMedicalRecordInError(ctx http.Context) error {
+	var in biz.EnterMedicalRecordInErrorRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.RecordID = ctx.Vars().Get("record_id")
+
+	http.SetOperation(ctx, "/medical.v1.MedicalRecordService/EnterMedicalRecordInError")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "MedicalRecordService.EnterMedicalRecordInError")
+		defer span.End()
+
+		s.log.Infof("EnterMedicalRecordInError request: %s by %s", in.RecordID, in.By)
+		return s.handler.EnterMedicalRecordInError(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strconv"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+// PatientExportService gives patients a copy of everything held about them.
+type PatientExportService struct {
+	handler *biz.PatientExportHandler
+	log     *log.Helper
+}
+
+func NewPatientExportService(handler *biz.PatientExportHandler, logger log.Logger) *PatientExportService {
+	return &PatientExportService{
+		handler: handler,
+		log:     log.NewHelper(logger),
+	}
+}
+
+func (s *PatientExportService) RequestPatientExport(ctx http.Context) error {
+	var in biz.RequestPatientExportRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.PatientID = ctx.Vars().Get("patient_id")
+
+	http.SetOperation(ctx, "/medical.v1.PatientExportService/RequestPatientExport")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientExportService.RequestPatientExport")
+		defer span.End()
+
+		s.log.Infof("RequestPatientExport request: %s by %s", in.PatientID, in.RequestedBy)
+		return s.handler.RequestPatientExport(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(202, out)
+}
+
+func (s *PatientExportService) GetPatientExport(ctx http.Context) error {
+	exportID := ctx.Vars().Get("export_id")
+
+	http.SetOperation(ctx, "/medical.v1.PatientExportService/GetPatientExport")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientExportService.GetPatientExport")
+		defer span.End()
+
+		s.log.Infof("GetPatientExport request: %s", exportID)
+		return s.handler.GetPatientExport(ctx, exportID)
+	})
+	out, err := h(ctx, exportID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+// DownloadPatientExport streams the archive of a completed export.
+func (s *PatientExportService) DownloadPatientExport(ctx http.Context) error {
+	exportID := ctx.Vars().Get("export_id")
+	w := ctx.Response()
+
+	http.SetOperation(ctx, "/medical.v1.PatientExportService/DownloadPatientExport")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientExportService.DownloadPatientExport")
+		defer span.End()
+
+		s.log.Infof("DownloadPatientExport request: %s", exportID)
+		f, status, err := s.handler.OpenPatientExport(ctx, exportID)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Length", strconv.FormatInt(status.ArchiveSize, 10))
+		w.Header().Set("Content-Disposition", `attachment; filename="patient-`+status.PatientID+`-export.zip"`)
+		// Once the archive is being sent a failure can only cut the
+		// download short, so it is logged rather than returned.
+		if _, err := io.Copy(w, f); err != nil {
+			s.log.Errorf("Download of patient export %s cut short: %v", exportID, err)
+		}
+		return nil, nil
+	})
+	_, err := h(ctx, exportID)
+	return err
+}
+
+// RunPatientExports is run by the job server rather than served.
+func (s *PatientExportService) RunPatientExports(ctx context.Context) error {
+	ctx, span := otel.Trace(ctx, "PatientExportService.RunPatientExports")
+	defer span.End()
+
+	return s.handler.RunPatientExports(ctx)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/arm-1234/medical-service/internal/biz"
 	"github.com/arm-1234/medical-service/internal/pkg/otel"
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
 )
 
 type PatientService struct {
@@ -72,3 +73,243 @@ func (s *PatientService) GetMedicalHistory(ctx context.Context, req *requestpb.G
 	s.log.Infof("GetMedicalHistory request: %s", req.PatientId)
 	return s.handler.GetMedicalHistory(ctx, req.PatientId, req.GetFromDate(), req.GetToDate())
 }
+
+func (s *PatientService) FindPatients(ctx http.Context) error {
+	var in biz.PatientMatchRequest
+	if err := ctx.BindQuery(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.PatientService/FindPatients")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientService.FindPatients")
+		defer span.End()
+
+		s.log.Infof("FindPatients request: %+v", in)
+		return s.handler.FindPatients(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PatientService) CheckDuplicates(ctx http.Context) error {
+	var in biz.PatientMatchRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.PatientService/CheckDuplicates")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientService.CheckDuplicates")
+		defer span.End()
+
+		s.log.Infof("CheckDuplicates request: %s %s", in.FirstName, in.LastName)
+		return s.handler.FindDuplicates(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PatientService) GetPatientDuplicates(ctx http.Context) error {
+	patientID := ctx.Vars().Get("patient_id")
+
+	http.SetOperation(ctx, "/medical.v1.PatientService/GetPatientDuplicates")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientService.GetPatientDuplicates")
+		defer span.End()
+
+		s.log.Infof("GetPatientDuplicates request: %s", patientID)
+		return s.handler.FindPatientDuplicates(ctx, patientID)
+	})
+	out, err := h(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PatientService) MergePatient(ctx http.Context) error {
+	var in biz.MergePatientsRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.SurvivorID = ctx.Vars().Get("patient_id")
+
+	http.SetOperation(ctx, "/medical.v1.PatientService/MergePatient")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientService.MergePatient")
+		defer span.End()
+
+		s.log.Infof("MergePatient request: %s into %s by %s", in.DuplicateID, in.SurvivorID, in.PerformedBy)
+		return s.handler.MergePatients(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PatientService) ListPatientMerges(ctx http.Context) error {
+	patientID := ctx.Vars().Get("patient_id")
+
+	http.SetOperation(ctx, "/medical.v1.PatientService/ListPatientMerges")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientService.ListPatientMerges")
+		defer span.End()
+
+		s.log.Infof("ListPatientMerges request: %s", patientID)
+		return s.handler.ListPatientMerges(ctx, patientID)
+	})
+	out, err := h(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PatientService) GetPatientProfile(ctx http.Context) error {
+	patientID := ctx.Vars().Get("patient_id")
+
+	http.SetOperation(ctx, "/medical.v1.PatientService/GetPatientProfile")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientService.GetPatientProfile")
+		defer span.End()
+
+		s.log.Infof("GetPatientProfile request: %s", patientID)
+		return s.handler.GetPatientProfile(ctx, patientID)
+	})
+	out, err := h(ctx, patientID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PatientService) SetMedicalHistory(ctx http.Context) error {
+	var in biz.MedicalHistoryRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.PatientID = ctx.Vars().Get("patient_id")
+
+	http.SetOperation(ctx, "/medical.v1.PatientService/SetMedicalHistory")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PatientService.SetMedicalHistory")
+		defer span.End()
+
+		s.log.Infof("SetMedicalHistory request: %s", in.PatientID)
+		return s.handler.SetMedicalHistory(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+// ProfileSections are the patient profile sections served by the
+// *ProfileItem endpoints, each mounted under its own path segment.
+var ProfileSections = biz.ProfileSections
+
+func (s *PatientService) AddProfileItem(section string) http.HandlerFunc {
+	return func(ctx http.Context) error {
+		in, err := biz.NewProfileItemRequest(section)
+		if err != nil {
+			return err
+		}
+		if err := ctx.Bind(in); err != nil {
+			return err
+		}
+		patientID := ctx.Vars().Get("patient_id")
+
+		http.SetOperation(ctx, "/medical.v1.PatientService/AddProfileItem")
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			ctx, span := otel.Trace(ctx, "PatientService.AddProfileItem")
+			defer span.End()
+
+			s.log.Infof("AddProfileItem request: patient=%s, section=%s", patientID, section)
+			return s.handler.AddProfileItem(ctx, patientID, section, in)
+		})
+		out, err := h(ctx, in)
+		if err != nil {
+			return err
+		}
+		return ctx.Result(200, out)
+	}
+}
+
+func (s *PatientService) UpdateProfileItem(section string) http.HandlerFunc {
+	return func(ctx http.Context) error {
+		in, err := biz.NewProfileItemRequest(section)
+		if err != nil {
+			return err
+		}
+		if err := ctx.Bind(in); err != nil {
+			return err
+		}
+		patientID := ctx.Vars().Get("patient_id")
+		itemID := ctx.Vars().Get("item_id")
+
+		http.SetOperation(ctx, "/medical.v1.PatientService/UpdateProfileItem")
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			ctx, span := otel.Trace(ctx, "PatientService.UpdateProfileItem")
+			defer span.End()
+
+			s.log.Infof("UpdateProfileItem request: patient=%s, section=%s, item=%s", patientID, section, itemID)
+			return s.handler.UpdateProfileItem(ctx, patientID, section, itemID, in)
+		})
+		out, err := h(ctx, in)
+		if err != nil {
+			return err
+		}
+		return ctx.Result(200, out)
+	}
+}
+
+func (s *PatientService) DeleteProfileItem(section string) http.HandlerFunc {
+	return func(ctx http.Context) error {
+		patientID := ctx.Vars().Get("patient_id")
+		itemID := ctx.Vars().Get("item_id")
+
+		http.SetOperation(ctx, "/medical.v1.PatientService/DeleteProfileItem")
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			ctx, span := otel.Trace(ctx, "PatientService.DeleteProfileItem")
+			defer span.End()
+
+			s.log.Infof("DeleteProfileItem request: patient=%s, section=%s, item=%s", patientID, section, itemID)
+			return s.handler.DeleteProfileItem(ctx, patientID, section, itemID)
+		})
+		out, err := h(ctx, itemID)
+		if err != nil {
+			return err
+		}
+		return ctx.Result(200, out)
+	}
+}
+
+func (s *PatientService) ListProfileItems(section string) http.HandlerFunc {
+	return func(ctx http.Context) error {
+		patientID := ctx.Vars().Get("patient_id")
+
+		http.SetOperation(ctx, "/medical.v1.PatientService/ListProfileItems")
+		h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+			ctx, span := otel.Trace(ctx, "PatientService.ListProfileItems")
+			defer span.End()
+
+			s.log.Infof("ListProfileItems request: patient=%s, section=%s", patientID, section)
+			return s.handler.ListProfileItems(ctx, patientID, section)
+		})
+		out, err := h(ctx, patientID)
+		if err != nil {
+			return err
+		}
+		return ctx.Result(200, out)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/arm-1234/medical-service/internal/biz"
 	"github.com/arm-1234/medical-service/internal/pkg/otel"
 	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
 )
 
 type PrescriptionService struct {
@@ -56,3 +57,292 @@ func (s *PrescriptionService) GetDoctorPrescriptions(ctx context.Context, req *r
 	s.log.Infof("GetDoctorPrescriptions request: %s", req.DoctorId)
 	return s.handler.GetDoctorPrescriptions(ctx, req)
 }
+
+func (s *PrescriptionService) CheckPrescriptionSafety(ctx http.Context) error {
+	var in biz.SafetyCheckRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/CheckPrescriptionSafety")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.CheckPrescriptionSafety")
+		defer span.End()
+
+		s.log.Infof("CheckPrescriptionSafety request: patient=%s", in.PatientID)
+		return s.handler.CheckPrescriptionSafety(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) CreateCheckedPrescription(ctx http.Context) error {
+	var in biz.CheckedPrescriptionRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/CreateCheckedPrescription")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.CreateCheckedPrescription")
+		defer span.End()
+
+		s.log.Infof("CreateCheckedPrescription request: patient=%s, doctor=%s, overrides=%d", in.PatientID, in.DoctorID, len(in.Overrides))
+		return s.handler.CreateCheckedPrescription(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) GetSafetyOverrides(ctx http.Context) error {
+	prescriptionID := ctx.Vars().Get("prescription_id")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/GetSafetyOverrides")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.GetSafetyOverrides")
+		defer span.End()
+
+		s.log.Infof("GetSafetyOverrides request: %s", prescriptionID)
+		return s.handler.GetSafetyOverrides(ctx, prescriptionID)
+	})
+	out, err := h(ctx, prescriptionID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) SearchPrescriptions(ctx http.Context) error {
+	var in biz.PrescriptionSearchRequest
+	if err := ctx.BindQuery(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/SearchPrescriptions")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.SearchPrescriptions")
+		defer span.End()
+
+		s.log.Infof("SearchPrescriptions request: patient=%s, doctor=%s, status=%s", in.PatientID, in.DoctorID, in.Status)
+		return s.handler.SearchPrescriptions(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) RevokePrescription(ctx http.Context) error {
+	var in biz.RevokePrescriptionRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.PrescriptionID = ctx.Vars().Get("prescription_id")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/RevokePrescription")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.RevokePrescription")
+		defer span.End()
+
+		s.log.Infof("RevokePrescription request: %s by %s", in.PrescriptionID, in.RevokedBy)
+		return s.handler.RevokePrescription(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) RenewPrescription(ctx http.Context) error {
+	var in biz.RenewPrescriptionRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.PrescriptionID = ctx.Vars().Get("prescription_id")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/RenewPrescription")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.RenewPrescription")
+		defer span.End()
+
+		s.log.Infof("RenewPrescription request: %s, validity=%d, refills=%d", in.PrescriptionID, in.ValidityDays, in.Refills)
+		return s.handler.RenewPrescription(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) AmendPrescription(ctx http.Context) error {
+	var in biz.AmendPrescriptionRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.PrescriptionID = ctx.Vars().Get("prescription_id")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/AmendPrescription")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.AmendPrescription")
+		defer span.End()
+
+		s.log.Infof("AmendPrescription request: %s", in.PrescriptionID)
+		return s.handler.AmendPrescription(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) VerifyPrescriptionSignature(ctx http.Context) error {
+	prescriptionID := ctx.Vars().Get("prescription_id")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/VerifyPrescriptionSignature")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.VerifyPrescriptionSignature")
+		defer span.End()
+
+		s.log.Infof("VerifyPrescriptionSignature request: %s", prescriptionID)
+		return s.handler.VerifyPrescriptionSignature(ctx, prescriptionID)
+	})
+	out, err := h(ctx, prescriptionID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) RecordRefill(ctx http.Context) error {
+	var in biz.RecordRefillRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.PrescriptionID = ctx.Vars().Get("prescription_id")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/RecordRefill")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.RecordRefill")
+		defer span.End()
+
+		s.log.Infof("RecordRefill request: %s by %s", in.PrescriptionID, in.DispensedBy)
+		return s.handler.RecordRefill(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) GetRefills(ctx http.Context) error {
+	prescriptionID := ctx.Vars().Get("prescription_id")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/GetRefills")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.GetRefills")
+		defer span.End()
+
+		s.log.Infof("GetRefills request: %s", prescriptionID)
+		return s.handler.GetRefills(ctx, prescriptionID)
+	})
+	out, err := h(ctx, prescriptionID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+// ExpirePrescriptions is run by the job server rather than served.
+func (s *PrescriptionService) ExpirePrescriptions(ctx context.Context) error {
+	ctx, span := otel.Trace(ctx, "PrescriptionService.ExpirePrescriptions")
+	defer span.End()
+
+	return s.handler.ExpirePrescriptions(ctx)
+}
+
+func (s *PrescriptionService) GetPrescriptionItems(ctx http.Context) error {
+	prescriptionID := ctx.Vars().Get("prescription_id")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/GetPrescriptionItems")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.GetPrescriptionItems")
+		defer span.End()
+
+		s.log.Infof("GetPrescriptionItems request: %s", prescriptionID)
+		return s.handler.GetPrescriptionItems(ctx, prescriptionID)
+	})
+	out, err := h(ctx, prescriptionID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) SearchFormulary(ctx http.Context) error {
+	var in biz.FormularySearchRequest
+	if err := ctx.BindQuery(&in); err != nil {
+		return err
+	}
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/SearchFormulary")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.SearchFormulary")
+		defer span.End()
+
+		s.log.Infof("SearchFormulary request: %q", in.Query)
+		return s.handler.SearchFormulary(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *PrescriptionService) GetPrescriptionPDF(ctx http.Context) error {
+	prescriptionID := ctx.Vars().Get("prescription_id")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/GetPrescriptionPDF")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.GetPrescriptionPDF")
+		defer span.End()
+
+		s.log.Infof("GetPrescriptionPDF request: %s", prescriptionID)
+		return s.handler.RenderPrescriptionPDF(ctx, prescriptionID)
+	})
+	out, err := h(ctx, prescriptionID)
+	if err != nil {
+		return err
+	}
+	ctx.Response().Header().Set("Content-Disposition", `inline; filename="prescription-`+prescriptionID+`.pdf"`)
+	return ctx.Blob(200, "application/pdf", out.([]byte))
+}
+
+func (s *PrescriptionService) VerifyPrescription(ctx http.Context) error {
+	code := ctx.Vars().Get("code")
+
+	http.SetOperation(ctx, "/medical.v1.PrescriptionService/VerifyPrescription")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "PrescriptionService.VerifyPrescription")
+		defer span.End()
+
+		s.log.Infof("VerifyPrescription request")
+		return s.handler.VerifyPrescription(ctx, code)
+	})
+	out, err := h(ctx, code)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
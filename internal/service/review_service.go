@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+type ReviewService struct {
+	handler *biz.ReviewHandler
+	log     *log.Helper
+}
+
+func NewReviewService(handler *biz.ReviewHandler, logger log.Logger) *ReviewService {
+	return &ReviewService{
+		handler: handler,
+		log:     log.NewHelper(logger),
+	}
+}
+
+func (s *ReviewService) CreateReview(ctx http.Context) error {
+	var in biz.ReviewRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.AppointmentID = ctx.Vars().Get("appointment_id")
+
+	http.SetOperation(ctx, "/medical.v1.ReviewService/CreateReview")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ReviewService.CreateReview")
+		defer span.End()
+
+		s.log.Infof("CreateReview request: appointment=%s, patient=%s", in.AppointmentID, in.PatientID)
+		return s.handler.CreateReview(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ReviewService) ListDoctorReviews(ctx http.Context) error {
+	doctorID := ctx.Vars().Get("doctor_id")
+	includeHidden := ctx.Query().Get("include_hidden") == "true"
+
+	http.SetOperation(ctx, "/medical.v1.ReviewService/ListDoctorReviews")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ReviewService.ListDoctorReviews")
+		defer span.End()
+
+		s.log.Infof("ListDoctorReviews request for doctor: %s", doctorID)
+		return s.handler.ListDoctorReviews(ctx, doctorID, includeHidden)
+	})
+	out, err := h(ctx, doctorID)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *ReviewService) ModerateReview(ctx http.Context) error {
+	var in biz.ModerateReviewRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.ReviewID = ctx.Vars().Get("review_id")
+
+	http.SetOperation(ctx, "/medical.v1.ReviewService/ModerateReview")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "ReviewService.ModerateReview")
+		defer span.End()
+
+		s.log.Infof("ModerateReview request: review=%s, action=%s", in.ReviewID, in.Action)
+		return s.handler.ModerateReview(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
@@ -2,4 +2,4 @@ package service
 
 import "github.com/google/wire"
 
-var ProviderSet = wire.NewSet(NewPatientService, NewDoctorService, NewAppointmentService, NewPrescriptionService)
+var ProviderSet = wire.NewSet(NewPatientService, NewDoctorService, NewAppointmentService, NewPrescriptionService, NewClinicService, NewCalendarService, NewReviewService, NewMedicalRecordService, NewVitalSignService, NewLabService, NewFHIRService, NewHL7Service, NewBulkService, NewPatientExportService, NewAnalyticsService)
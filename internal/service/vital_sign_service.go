@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+
+	"github.com/arm-1234/medical-service/internal/biz"
+	"github.com/arm-1234/medical-service/internal/pkg/otel"
+	"github.com/go-kratos/kratos/v2/log"
+	"github.com/go-kratos/kratos/v2/transport/http"
+)
+
+type VitalSignService struct {
+	handler *biz.VitalSignHandler
+	log     *log.Helper
+}
+
+func NewVitalSignService(handler *biz.VitalSignHandler, logger log.Logger) *VitalSignService {
+	return &VitalSignService{
+		handler: handler,
+		log:     log.NewHelper(logger),
+	}
+}
+
+func (s *VitalSignService) RecordVitals(ctx http.Context) error {
+	var in biz.RecordVitalsRequest
+	if err := ctx.Bind(&in); err != nil {
+		return err
+	}
+	in.PatientID = ctx.Vars().Get("patient_id")
+
+	http.SetOperation(ctx, "/medical.v1.VitalSignService/RecordVitals")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "VitalSignService.RecordVitals")
+		defer span.End()
+
+		s.log.Infof("RecordVitals request: patient=%s, observations=%d", in.PatientID, len(in.Observations))
+		return s.handler.RecordVitals(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}
+
+func (s *VitalSignService) GetVitalSeries(ctx http.Context) error {
+	var in biz.VitalSeriesRequest
+	if err := ctx.BindQuery(&in); err != nil {
+		return err
+	}
+	in.PatientID = ctx.Vars().Get("patient_id")
+
+	http.SetOperation(ctx, "/medical.v1.VitalSignService/GetVitalSeries")
+	h := ctx.Middleware(func(ctx context.Context, req interface{}) (interface{}, error) {
+		ctx, span := otel.Trace(ctx, "VitalSignService.GetVitalSeries")
+		defer span.End()
+
+		s.log.Infof("GetVitalSeries request: patient=%s, codes=%s", in.PatientID, in.Codes)
+		return s.handler.GetVitalSeries(ctx, &in)
+	})
+	out, err := h(ctx, &in)
+	if err != nil {
+		return err
+	}
+	return ctx.Result(200, out)
+}